@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"ccproxy/internal/handler"
+)
+
+// runConvertCommand converts a request, response or SSE transcript between
+// the OpenAI and Anthropic formats the way the proxy does, without a server or
+// database, and returns the exit code
+func runConvertCommand(args []string) int {
+	fs := flag.NewFlagSet("convert", flag.ContinueOnError)
+	in := fs.String("in", "-", "file to convert, - for stdin")
+	to := fs.String("to", "", "target format: anthropic or openai")
+	model := fs.String("model", "", "model named in converted responses (default: the upstream model)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: ccproxy convert -to anthropic|openai [-in FILE] [-model MODEL]")
+		fmt.Fprintln(fs.Output(), "")
+		fmt.Fprintln(fs.Output(), "  -to anthropic  OpenAI chat completions request -> Anthropic Messages request")
+		fmt.Fprintln(fs.Output(), "  -to openai     Anthropic Messages request, response or SSE transcript -> OpenAI")
+		fmt.Fprintln(fs.Output(), "")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *to != "anthropic" && *to != "openai" {
+		fs.Usage()
+		return 2
+	}
+
+	var (
+		input []byte
+		err   error
+	)
+	if *in == "-" {
+		input, err = io.ReadAll(os.Stdin)
+	} else {
+		input, err = os.ReadFile(*in)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "convert: %v\n", err)
+		return 1
+	}
+
+	if err := convert(input, *to, *model, os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "convert: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// convert writes input converted to the target format. Anthropic requests,
+// given or produced, are checked like /v1/messages checks them; a request
+// upstream would reject is still written, and the reason returned.
+func convert(input []byte, to, model string, w io.Writer) error {
+	trimmed := bytes.TrimSpace(input)
+	if bytes.HasPrefix(trimmed, []byte("event:")) || bytes.HasPrefix(trimmed, []byte("data:")) {
+		if to != "openai" {
+			return fmt.Errorf("SSE transcripts can only be converted to openai")
+		}
+		return handler.ConvertAnthropicStream(bytes.NewReader(input), w, model)
+	}
+
+	if to == "anthropic" {
+		var req handler.OpenAIChatRequest
+		if err := json.Unmarshal(input, &req); err != nil {
+			return fmt.Errorf("parse OpenAI request: %w", err)
+		}
+		converted := handler.OpenAIToAnthropicRequest(&req)
+		if err := writeJSON(w, converted); err != nil {
+			return err
+		}
+		return upstreamCheck(converted)
+	}
+
+	var probe struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(input, &probe); err != nil {
+		return fmt.Errorf("parse Anthropic JSON: %w", err)
+	}
+	if probe.Type == "message" {
+		var resp handler.AnthropicResponse
+		if err := json.Unmarshal(input, &resp); err != nil {
+			return fmt.Errorf("parse Anthropic response: %w", err)
+		}
+		if model == "" {
+			model = resp.Model
+		}
+		return writeJSON(w, handler.AnthropicToOpenAIResponse(&resp, model))
+	}
+
+	var req handler.AnthropicRequest
+	if err := json.Unmarshal(input, &req); err != nil {
+		return fmt.Errorf("parse Anthropic request: %w", err)
+	}
+	if err := writeJSON(w, handler.AnthropicToOpenAIRequest(&req)); err != nil {
+		return err
+	}
+	return upstreamCheck(&req)
+}
+
+// upstreamCheck explains why upstream would reject a request with a 400
+func upstreamCheck(req *handler.AnthropicRequest) error {
+	if err := handler.ValidateAnthropicRequest(req); err != nil {
+		return fmt.Errorf("upstream would reject the Anthropic request: %w", err)
+	}
+	return nil
+}
+
+func writeJSON(w io.Writer, v any) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"ccproxy/internal/config"
+	"ccproxy/internal/service"
+	"ccproxy/internal/store"
+)
+
+// statePassphraseEnv holds the state bundle passphrase when no file is given
+const statePassphraseEnv = "CCPROXY_STATE_PASSPHRASE"
+
+// runStateCommand runs the export-state and import-state commands against the
+// configured database and returns the exit code
+func runStateCommand(name string, args []string) int {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	path := fs.String("file", "", "bundle file to write (export-state) or read (import-state), - for stdout/stdin")
+	passphraseFile := fs.String("passphrase-file", "", "file containing the bundle passphrase (default $"+statePassphraseEnv+")")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: ccproxy %s -file FILE [-passphrase-file FILE]\n", name)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *path == "" {
+		fs.Usage()
+		return 2
+	}
+
+	passphrase := os.Getenv(statePassphraseEnv)
+	if *passphraseFile != "" {
+		data, err := os.ReadFile(*passphraseFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+			return 1
+		}
+		passphrase = strings.TrimRight(string(data), "\r\n")
+	}
+	if passphrase == "" {
+		fmt.Fprintf(os.Stderr, "%s: set $%s or -passphrase-file\n", name, statePassphraseEnv)
+		return 2
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: load configuration: %v\n", name, err)
+		return 1
+	}
+	db, err := store.New(cfg.Storage.DBPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: open %s: %v\n", name, cfg.Storage.DBPath, err)
+		return 1
+	}
+	defer db.Close()
+
+	if name == "export-state" {
+		err = exportState(db, *path, passphrase)
+	} else {
+		err = importState(db, *path, passphrase)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+		return 1
+	}
+	return 0
+}
+
+func exportState(db *store.Store, path, passphrase string) error {
+	dump, err := db.ExportState()
+	if err != nil {
+		return err
+	}
+	bundle, err := service.EncryptState(dump, passphrase)
+	if err != nil {
+		return err
+	}
+	if path == "-" {
+		_, err = os.Stdout.Write(bundle)
+		return err
+	}
+	if err := os.WriteFile(path, bundle, 0600); err != nil {
+		return err
+	}
+	for _, table := range store.StateTables {
+		fmt.Fprintf(os.Stderr, "%-24s %d rows\n", table, len(dump.Tables[table].Rows))
+	}
+	fmt.Fprintf(os.Stderr, "wrote %s\n", path)
+	return nil
+}
+
+func importState(db *store.Store, path, passphrase string) error {
+	var (
+		bundle []byte
+		err    error
+	)
+	if path == "-" {
+		bundle, err = io.ReadAll(os.Stdin)
+	} else {
+		bundle, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return err
+	}
+	dump, err := service.DecryptState(bundle, passphrase)
+	if err != nil {
+		return err
+	}
+	result, err := db.ImportState(dump)
+	if err != nil {
+		return err
+	}
+	for _, table := range store.StateTables {
+		if n, ok := result.Rows[table]; ok {
+			fmt.Fprintf(os.Stderr, "%-24s %d rows\n", table, n)
+		}
+	}
+	for table, cols := range result.SkippedColumns {
+		fmt.Fprintf(os.Stderr, "skipped unknown columns of %s: %s\n", table, strings.Join(cols, ", "))
+	}
+	fmt.Fprintf(os.Stderr, "imported state exported at %s\n", dump.ExportedAt.Format("2006-01-02 15:04:05 MST"))
+	return nil
+}
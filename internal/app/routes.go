@@ -0,0 +1,542 @@
+package app
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+
+	"ccproxy/internal/config"
+	"ccproxy/internal/flags"
+	"ccproxy/internal/handler"
+	"ccproxy/internal/middleware"
+	"ccproxy/web"
+)
+
+// initRouter creates the handlers and registers all routes
+func (s *Server) initRouter() error {
+	cfg := s.cfg
+	db := s.store
+
+	// Initialize handlers
+	tokenHandler := handler.NewTokenHandler(s.jwtManager, db, cfg.JWT.DefaultExpiry)
+	jwtKeyHandler := handler.NewJWTKeyHandler(s.jwtManager, db)
+	sessionHandler := handler.NewSessionHandler(db)
+	accountHandler := handler.NewAccountHandler(db, s.oauthService)
+	accountHandler.SetSpendTracker(s.spendTracker)
+	accountHandler.SetTracer(s.tracer)
+	accountHandler.SetDefaultDrainTTL(cfg.Scheduler.StickySessionTTL)
+	accountHandler.SetPool(s.httpPool)
+	accountHandler.SetStickyInvalidator(s.scheduler)
+	accountHandler.SetJobQueue(s.jobs)
+	accountTemplateHandler := handler.NewAccountTemplateHandler(db)
+	jobsHandler := handler.NewJobsHandler(s.jobs)
+	notifyHandler := handler.NewNotifyHandler(s.notifier)
+	usageResetHandler := handler.NewUsageResetHandler(db)
+	requestLogsHandler := handler.NewRequestLogsHandler(db)
+	statsHandler := handler.NewStatsHandler(db)
+	statsHandler.SetAccountMax(cfg.Concurrency.AccountMax)
+	statsHandler.SetSLOTracker(s.sloTracker)
+	conversationsHandler := handler.NewConversationsHandler(db)
+	schedulerHandler := handler.NewSchedulerHandler(s.scheduler, db)
+	accountLoadHandler := handler.NewAccountLoadHandler(db, s.concurrencyMgr, s.circuitMgr)
+	capacityHandler := handler.NewCapacityHandler(db, s.keyPool, s.concurrencyMgr, s.circuitMgr)
+	statusHandler := handler.NewStatusHandler(db, s.build.Version)
+	mirrorHandler := handler.NewMirrorHandler(db, s.mirror)
+	privacyHandler := handler.NewPrivacyHandler(db)
+	stateHandler := handler.NewStateHandler(db)
+	systemHandler := handler.NewSystemHandler(s.build, map[string]interface{}{
+		"mode":               cfg.Server.Mode,
+		"circuit_breaker":    cfg.Circuit.Enabled,
+		"rate_limit":         cfg.RateLimit.Enabled,
+		"health_check":       cfg.Health.Enabled,
+		"metrics":            cfg.Metrics.Enabled,
+		"scheduler":          cfg.Scheduler.Strategy,
+		"count_tokens_cache": cfg.CountTokens.CacheEnabled,
+		"log_sampling":       cfg.Logging.Sampling.Enabled,
+		"log_enrichers":      cfg.Logging.Enrichers,
+		"status_page":        cfg.Status.Enabled,
+		"webhook":            cfg.Notify.WebhookURL != "",
+		"mirror":             s.mirror != nil,
+		"admin_sso":          s.oidcProvider != nil,
+		"trace_propagation":  cfg.Tracing.Propagate,
+		"client_certs":       cfg.Server.TLS.Enabled && cfg.Server.TLS.ClientCAFile != "",
+		"load_shedding":      s.shedder != nil,
+		"retry_telemetry":    cfg.Retry.TelemetryHeaders,
+	}, s.selfCheck)
+
+	// Use enhanced proxy handler
+	enhancedConfig := handler.EnhancedProxyConfig{
+		Store:         db,
+		KeyPool:       s.keyPool,
+		WebURL:        cfg.Claude.WebURL,
+		APIURL:        cfg.Claude.APIURL,
+		Pool:          s.httpPool,
+		Scheduler:     s.scheduler,
+		Circuit:       s.circuitMgr,
+		Concurrency:   s.concurrencyMgr,
+		RateLimit:     s.rateLimiter,
+		Retry:         s.retryExecutor,
+		Metrics:       s.metrics,
+		RequestLogger: s.requestLogger,
+		SpendTracker:  s.spendTracker,
+		Tracer:        s.tracer,
+		BetaHeaders:   s.betaHeaders,
+		Conversations: s.conversationCleaner,
+		OAuth:         s.oauthService,
+		PollJobs:      handler.NewPollJobStore(),
+
+		WebPromptLimit: cfg.Claude.WebPromptLimit,
+		DefaultModel:   cfg.Claude.DefaultModel,
+	}
+	enhancedProxyHandler := handler.NewEnhancedProxyHandler(enhancedConfig)
+
+	// Keep legacy handlers for specific endpoints
+	webProxyHandler := handler.NewWebProxyHandler(db, cfg.Claude.WebURL)
+	webProxyHandler.SetBetaHeaders(s.betaHeaders)
+	apiProxyHandler := handler.NewAPIProxyHandler(s.keyPool, cfg.Claude.APIURL)
+	apiProxyHandler.SetBetaHeaders(s.betaHeaders)
+
+	// Sub2API-style handler for count_tokens and cost estimates (with OAuth token refresh support)
+	sub2apiProxyHandler := handler.NewSub2APIProxyHandler(db, s.oauthService)
+	sub2apiProxyHandler.SetBetaHeaders(s.betaHeaders)
+	sub2apiProxyHandler.SetCostEstimator(s.costEstimator)
+	sub2apiProxyHandler.SetDefaultModel(cfg.Claude.DefaultModel)
+	sub2apiProxyHandler.SetUpstreamSampler(s.sampler)
+	sub2apiProxyHandler.SetFingerprints(s.fingerprints)
+	log.Info().Msg("initialized sub2api-style count_tokens handler with OAuth token refresh")
+	if cfg.CountTokens.CacheEnabled {
+		sub2apiProxyHandler.SetCountTokensCache(handler.NewCountTokensCache(handler.CountTokensCacheConfig{
+			MaxEntries: cfg.CountTokens.CacheMaxEntries,
+			TTL:        cfg.CountTokens.CacheTTL,
+		}))
+		log.Info().
+			Int("max_entries", cfg.CountTokens.CacheMaxEntries).
+			Dur("ttl", cfg.CountTokens.CacheTTL).
+			Msg("initialized count_tokens cache")
+	}
+
+	// Both completion routes are served by the enhanced pipeline, with its
+	// stages switched on or off per route
+	pipeline := func(p config.PipelineConfig) *handler.EnhancedProxyHandler {
+		return handler.NewEnhancedProxyHandler(enhancedConfig.WithStages(p.Scheduler, p.Circuit, p.Retry))
+	}
+	chatEnhanced := pipeline(cfg.Pipelines.ChatCompletions)
+	chatHandlers := []gin.HandlerFunc{handler.ResponseFooterMiddleware(), handler.OutputFilterMiddleware(), chatEnhanced.ChatCompletions}
+
+	// Sampled /v1/messages requests are mirrored to the secondary upstream
+	messagesHandlers := []gin.HandlerFunc{pipeline(cfg.Pipelines.Messages).Messages}
+	if s.mirror != nil {
+		messagesHandlers = append([]gin.HandlerFunc{handler.MirrorMiddleware(s.mirror)}, messagesHandlers...)
+	}
+	// Per-token output filters and response footers wrap the mirror so it
+	// records the upstream response; footers are added after filtering
+	messagesHandlers = append([]gin.HandlerFunc{handler.ResponseFooterMiddleware(), handler.OutputFilterMiddleware()}, messagesHandlers...)
+	messagesHandlers = append([]gin.HandlerFunc{middleware.RequireEndpoint(middleware.EndpointMessages)}, messagesHandlers...)
+	countTokens := []gin.HandlerFunc{middleware.RequireEndpoint(middleware.EndpointCountTokens), sub2apiProxyHandler.CountTokens}
+
+	// Feature flags for experimental behaviors on /v1 routes
+	flagConfig := make(map[string]flags.Flag, len(cfg.FeatureFlags))
+	for name, flag := range cfg.FeatureFlags {
+		flagConfig[name] = flags.Flag{Enabled: flag.Enabled, Percent: flag.Percent}
+	}
+	featureFlags := flags.NewEvaluator(flagConfig)
+	if unknown := featureFlags.Unknown(); len(unknown) > 0 {
+		log.Warn().Strs("flags", unknown).Strs("known", flags.Known()).Msg("ignoring unknown feature flags")
+	}
+
+	// Read-only responses carry ETags so clients can revalidate them cheaply
+	cacheModels, cacheSnapshot, cacheStats := noCache, noCache, noCache
+	if hc := cfg.Server.HTTPCache; hc.Enabled {
+		cacheModels = middleware.HTTPCache(hc.ModelsMaxAge)
+		cacheSnapshot = middleware.HTTPCache(0)
+		cacheStats = middleware.HTTPCacheFunc(handler.StatsCacheMaxAge(hc.StatsMaxAge))
+	}
+
+	// Initialize middleware
+	jwtMiddleware := middleware.NewJWTMiddleware(s.jwtManager, db)
+	if t := cfg.Server.TLS; t.Enabled && t.ClientCAFile != "" {
+		jwtMiddleware.EnableClientCerts()
+		log.Info().Str("client_auth", t.ClientAuth).Bool("crl", t.ClientCRLFile != "").Msg("client certificate authentication enabled")
+	}
+	if s.externalJWT != nil {
+		jwtMiddleware.EnableExternalJWTs(s.externalJWT)
+	}
+	adminMiddleware := middleware.NewAdminMiddleware(cfg.Admin.Key)
+	var adminAuthHandler *handler.AdminAuthHandler
+	if s.oidcProvider != nil {
+		adminMiddleware.EnableSessions(s.jwtManager, db)
+		adminAuthHandler = handler.NewAdminAuthHandler(s.oidcProvider, s.jwtManager, db,
+			cfg.Admin.OIDC.SessionTTL, cfg.Admin.OIDC.PostLoginRedirect, cfg.Admin.OIDC.RedirectURL)
+	}
+
+	// Setup router
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.New()
+	if err := router.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		return fmt.Errorf("invalid trusted proxies %v: %w", cfg.Server.TrustedProxies, err)
+	}
+	if cfg.Server.ClientIPHeader != "" {
+		// Header is trusted from any peer, so only set this when all traffic comes through that proxy
+		router.TrustedPlatform = cfg.Server.ClientIPHeader
+	}
+	log.Info().
+		Strs("trusted_proxies", cfg.Server.TrustedProxies).
+		Str("client_ip_header", cfg.Server.ClientIPHeader).
+		Msg("configured client IP resolution")
+	router.Use(gin.Recovery())
+	router.Use(middleware.RequestID())
+	router.Use(requestLogger())
+	router.Use(handler.SSEFlushMiddleware(cfg.Server.SSE.FlushInterval, cfg.Server.SSE.WriteBufferSize))
+
+	// Health check
+	router.GET("/health", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	})
+
+	// Status page (uptime, accounts, recent error rate)
+	if cfg.Status.Enabled {
+		if cfg.Status.RequireAuth {
+			router.GET("/status", adminMiddleware.Auth(), statusHandler.GetStatus)
+		} else {
+			router.GET("/status", statusHandler.GetStatus)
+		}
+	}
+
+	// Event logging endpoint (Claude Code telemetry - no auth required, just ignore)
+	router.POST("/v1/api/event_logging/batch", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"success": true})
+	})
+	router.POST("/api/event_logging/batch", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"success": true})
+	})
+
+	// Prometheus metrics endpoint
+	if s.metrics != nil {
+		router.GET(cfg.Metrics.Path, s.metrics.Handler())
+	}
+
+	// Admin SSO login; these routes authenticate the admin themselves
+	if adminAuthHandler != nil {
+		router.GET("/api/auth/oidc/login", adminAuthHandler.Login)
+		router.GET("/api/auth/oidc/callback", adminAuthHandler.Callback)
+		router.POST("/api/auth/logout", adminAuthHandler.Logout)
+	}
+
+	// Admin API routes (require admin key or SSO session)
+	adminRoutes := func(admin *gin.RouterGroup) {
+		if adminAuthHandler != nil {
+			admin.GET("/auth/me", adminAuthHandler.Me)
+		}
+
+		// System
+		admin.GET("/version", systemHandler.GetVersion)
+		admin.GET("/selfcheck", systemHandler.GetSelfCheck)
+		if cfg.Metrics.Pprof {
+			pprof := []gin.HandlerFunc{middleware.RequireAdminRole(), handler.PprofHandler()}
+			admin.GET("/debug/pprof/*name", pprof...)
+			admin.POST("/debug/pprof/*name", pprof...)
+		}
+		admin.GET("/debug/upstream/:account_id", middleware.RequireAdminRole(), handler.UpstreamSamplesHandler(s.sampler))
+
+		// Notification channels
+		admin.GET("/notify/channels", notifyHandler.ListChannels)
+		admin.POST("/notify/channels/:name/test", notifyHandler.TestChannel)
+
+		// Token management
+		admin.POST("/token/generate", tokenHandler.Generate)
+		admin.GET("/token/list", tokenHandler.List)
+		admin.POST("/token/revoke", tokenHandler.Revoke)
+		admin.PUT("/token/:id/settings", tokenHandler.UpdateSettings)
+		admin.POST("/token/:id/usage/reset", usageResetHandler.ResetTokenUsage)
+		admin.POST("/token/introspect", tokenHandler.Introspect)
+
+		// JWT signing key rotation
+		admin.GET("/jwt/keys", jwtKeyHandler.ListKeys)
+		admin.POST("/jwt/keys", jwtKeyHandler.CreateKey)
+		admin.POST("/jwt/keys/:id/activate", jwtKeyHandler.ActivateKey)
+		admin.DELETE("/jwt/keys/:id", jwtKeyHandler.RetireKey)
+
+		// Account management (replaces session management)
+		admin.POST("/account/oauth", accountHandler.CreateOAuthAccount)
+		admin.POST("/account/oauth/import", accountHandler.ImportOAuthAccount)
+		admin.GET("/jobs", jobsHandler.ListJobs)
+		admin.GET("/jobs/:id", jobsHandler.GetJob)
+		admin.POST("/jobs/:id/cancel", jobsHandler.CancelJob)
+		admin.POST("/account/apikey", accountHandler.CreateAPIKeyAccount)
+		admin.POST("/account/sessionkey", accountHandler.CreateSessionKeyAccount)
+		admin.GET("/account/list", cacheSnapshot, accountHandler.ListAccounts)
+		admin.GET("/account/templates", accountTemplateHandler.ListTemplates)
+		admin.POST("/account/templates", accountTemplateHandler.CreateTemplate)
+		admin.GET("/account/templates/:id", accountTemplateHandler.GetTemplate)
+		admin.PUT("/account/templates/:id", accountTemplateHandler.UpdateTemplate)
+		admin.DELETE("/account/templates/:id", accountTemplateHandler.DeleteTemplate)
+		admin.GET("/account/:id", accountHandler.GetAccount)
+		admin.PUT("/account/:id", accountHandler.UpdateAccount)
+		admin.GET("/account/:id/deletion", accountHandler.GetAccountDeletion)
+		admin.DELETE("/account/:id", accountHandler.DeleteAccount)
+		admin.POST("/account/:id/deactivate", accountHandler.DeactivateAccount)
+		admin.POST("/account/:id/drain", accountHandler.DrainAccount)
+		admin.GET("/account/:id/drain", accountHandler.GetAccountDrain)
+		admin.DELETE("/account/:id/drain", accountHandler.CancelAccountDrain)
+		admin.GET("/account/:id/notes", accountHandler.GetAccountNotes)
+		admin.PUT("/account/:id/notes", accountHandler.SetAccountNotes)
+		admin.POST("/account/:id/notes/reveal", accountHandler.RevealAccountNotes)
+		admin.DELETE("/account/:id/notes", accountHandler.DeleteAccountNotes)
+		admin.POST("/account/:id/refresh", accountHandler.RefreshToken)
+		admin.POST("/account/:id/check", accountHandler.CheckHealth)
+		admin.GET("/account/:id/health-history", accountHandler.GetAccountHealthHistory)
+		admin.POST("/account/:id/clone", accountHandler.CloneAccount)
+		admin.GET("/account/:id/budget", accountHandler.GetAccountBudget)
+		admin.PUT("/account/:id/budget", accountHandler.UpdateAccountBudget)
+		admin.POST("/account/:id/metadata", accountHandler.RefreshAccountMetadata)
+		admin.GET("/account/:id/tracing", accountHandler.GetAccountTracing)
+		admin.PUT("/account/:id/tracing", accountHandler.UpdateAccountTracing)
+		admin.GET("/account/:id/schedule", accountHandler.GetAccountSchedule)
+		admin.PUT("/account/:id/schedule", accountHandler.UpdateAccountSchedule)
+		admin.GET("/account/:id/reset-schedule", accountHandler.GetAccountResetSchedule)
+		admin.PUT("/account/:id/reset-schedule", accountHandler.UpdateAccountResetSchedule)
+		admin.GET("/account/:id/network", accountHandler.GetAccountNetwork)
+		admin.PUT("/account/:id/network", accountHandler.UpdateAccountNetwork)
+		admin.DELETE("/account/:id/overloads", accountHandler.ClearModelOverloads)
+		admin.POST("/account/:id/counters/reset", usageResetHandler.ResetAccountCounters)
+		admin.GET("/account/:id/project", webProxyHandler.GetAccountProject)
+		admin.POST("/account/:id/project", webProxyHandler.CreateAccountProject)
+		admin.PUT("/account/:id/project", webProxyHandler.SelectAccountProject)
+		admin.DELETE("/account/:id/project", webProxyHandler.ClearAccountProject)
+		admin.GET("/account/:id/projects", webProxyHandler.ListAccountProjects)
+		admin.GET("/accounts/load", accountLoadHandler.GetLoad)
+		admin.GET("/capacity", capacityHandler.GetCapacity)
+
+		// Legacy session endpoints (for backward compatibility)
+		admin.POST("/session/add", sessionHandler.Add)
+		admin.GET("/session/list", sessionHandler.List)
+		admin.DELETE("/session/:id", sessionHandler.Delete)
+		admin.POST("/session/:id/deactivate", sessionHandler.Deactivate)
+
+		// Key stats (API mode)
+		admin.GET("/keys/stats", apiProxyHandler.GetKeyStats)
+
+		// Request logs endpoints
+		admin.GET("/logs/requests", requestLogsHandler.ListRequestLogs)
+		admin.GET("/logs/requests/:id", requestLogsHandler.GetRequestLog)
+		admin.DELETE("/logs/requests/old", requestLogsHandler.DeleteOldRequestLogs)
+		admin.GET("/logs/requests/export", requestLogsHandler.ExportRequestLogs)
+
+		// Conversation endpoints
+		admin.GET("/conversations", conversationsHandler.ListConversations)
+		admin.GET("/conversations/:id", conversationsHandler.GetConversation)
+		admin.GET("/conversations/search", conversationsHandler.SearchConversations)
+		admin.GET("/conversations/compare", conversationsHandler.CompareConversations)
+		admin.DELETE("/conversations/:id", conversationsHandler.DeleteConversation)
+		admin.GET("/conversations/export", conversationsHandler.ExportConversations)
+		admin.GET("/conversations/compression", conversationsHandler.GetCompressionStats)
+		admin.GET("/conversations/tags", conversationsHandler.ListConversationTags)
+		admin.POST("/conversations/:id/tags", conversationsHandler.AddConversationTags)
+		admin.DELETE("/conversations/:id/tags/:tag", conversationsHandler.RemoveConversationTag)
+		admin.PUT("/conversations/:id/star", conversationsHandler.StarConversation)
+		admin.DELETE("/conversations/:id/star", conversationsHandler.UnstarConversation)
+
+		// Usage statistics endpoints
+		admin.GET("/stats/tokens/:id", cacheStats, statsHandler.GetTokenStats)
+		admin.GET("/stats/tokens/:id/trend", cacheStats, statsHandler.GetTokenTrend)
+		admin.GET("/stats/tokens/:id/end-users", statsHandler.GetTokenEndUsers)
+		admin.GET("/stats/tokens/:id/distribution", statsHandler.GetTokenDistribution)
+		admin.GET("/stats/accounts/:id", cacheStats, statsHandler.GetAccountStats)
+		admin.GET("/stats/accounts/:id/trend", cacheStats, statsHandler.GetAccountTrend)
+		admin.GET("/stats/accounts/:id/health", statsHandler.GetAccountHealth)
+		admin.GET("/stats/overview", cacheStats, statsHandler.GetOverview)
+		admin.GET("/stats/realtime", statsHandler.GetRealtimeStats)
+		admin.GET("/stats/top/tokens", cacheStats, statsHandler.GetTopTokens)
+		admin.GET("/stats/top/models", cacheStats, statsHandler.GetTopModels)
+		admin.GET("/stats/top/end-users", statsHandler.GetTopEndUsers)
+		admin.GET("/stats/failures", statsHandler.GetFailureCategories)
+		admin.GET("/stats/anomalies", statsHandler.GetAnomalies)
+		admin.GET("/stats/capacity", statsHandler.GetCapacity)
+		admin.GET("/stats/timeseries", cacheStats, statsHandler.GetTimeseries)
+		admin.GET("/stats/distributions", statsHandler.GetSizeDistributions)
+		admin.GET("/stats/slo", statsHandler.GetSLO)
+
+		// Enhanced stats endpoints
+		admin.GET("/stats/pool", func(c *gin.Context) {
+			c.JSON(http.StatusOK, s.httpPool.Stats())
+		})
+		admin.GET("/stats/circuit", func(c *gin.Context) {
+			c.JSON(http.StatusOK, s.circuitMgr.Stats())
+		})
+		admin.GET("/stats/concurrency", func(c *gin.Context) {
+			c.JSON(http.StatusOK, s.concurrencyMgr.Stats())
+		})
+		admin.GET("/stats/ratelimit", func(c *gin.Context) {
+			c.JSON(http.StatusOK, s.rateLimiter.Stats())
+		})
+		admin.GET("/stats/scheduler", func(c *gin.Context) {
+			c.JSON(http.StatusOK, s.scheduler.Stats())
+		})
+		admin.GET("/stats/canary", func(c *gin.Context) {
+			if s.canary == nil {
+				c.JSON(http.StatusOK, gin.H{"enabled": false})
+				return
+			}
+			c.JSON(http.StatusOK, gin.H{"enabled": true, "modes": s.canary.Stats()})
+		})
+		admin.GET("/stats/request-logger", func(c *gin.Context) {
+			size, capacity := s.requestLogger.GetQueueStatus()
+			c.JSON(http.StatusOK, gin.H{
+				"queue_size":       size,
+				"queue_capacity":   capacity,
+				"sampling":         s.requestLogger.GetSamplingStats(),
+				"conversation_cap": s.requestLogger.GetConversationCapStats(),
+			})
+		})
+
+		// Scheduler pins
+		admin.GET("/scheduler/explain", schedulerHandler.Explain)
+		admin.GET("/scheduler/pin", schedulerHandler.ListPins)
+		admin.POST("/scheduler/pin", schedulerHandler.Pin)
+		admin.DELETE("/scheduler/pin", schedulerHandler.Unpin)
+		admin.DELETE("/scheduler/sticky", schedulerHandler.InvalidateSticky)
+
+		// Request mirroring results
+		admin.GET("/mirror/results", mirrorHandler.ListResults)
+		admin.GET("/mirror/results/:id", mirrorHandler.GetResult)
+		admin.GET("/mirror/stats", mirrorHandler.GetStats)
+
+		// Data deletion and audit log
+		admin.POST("/privacy/purge", privacyHandler.Purge)
+		admin.GET("/audit", privacyHandler.ListAudit)
+		admin.GET("/audit/:id", privacyHandler.GetAudit)
+
+		// Encrypted export and import of the instance state
+		admin.GET("/state/export", middleware.RequireAdminRole(), stateHandler.Export)
+		admin.POST("/state/import", stateHandler.Import)
+
+		// count_tokens cache
+		admin.GET("/count-tokens/cache", sub2apiProxyHandler.CountTokensCacheStats)
+		admin.DELETE("/count-tokens/cache", sub2apiProxyHandler.InvalidateCountTokensCache)
+		admin.GET("/stats/retry", func(c *gin.Context) {
+			c.JSON(http.StatusOK, s.retryExecutor.Stats())
+		})
+		if s.healthMonitor != nil {
+			admin.GET("/stats/health", func(c *gin.Context) {
+				c.JSON(http.StatusOK, s.healthMonitor.Stats())
+			})
+		}
+		if s.shedder != nil {
+			admin.GET("/stats/shedding", func(c *gin.Context) {
+				c.JSON(http.StatusOK, s.shedder.Stats())
+			})
+		}
+	}
+
+	// User API routes (require JWT)
+	userRoutes := func(api *gin.RouterGroup) {
+		api.GET("/token/info", tokenHandler.Info)
+		api.POST("/token/children", tokenHandler.CreateChild)
+		api.GET("/token/children", tokenHandler.ListChildren)
+		api.DELETE("/token/children/:id", tokenHandler.RevokeChild)
+	}
+
+	// The same routes are served under every API version; the unversioned
+	// /api prefix is a deprecated alias of /api/v1
+	router.GET("/api/versions", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"versions": middleware.APIVersions})
+	})
+	for _, version := range middleware.APIVersions {
+		versioned := middleware.APIVersion(version.Version)
+		adminRoutes(router.Group(version.Prefix, versioned, adminMiddleware.Auth()))
+		userRoutes(router.Group(version.Prefix, versioned, jwtMiddleware.Auth()))
+	}
+	if cfg.Metrics.Pprof {
+		log.Warn().Msg("pprof profiling enabled at /api/v1/debug/pprof/")
+	}
+
+	// OpenAI-compatible endpoints (require JWT)
+	v1 := router.Group("/v1")
+	v1.Use(jwtMiddleware.Auth())
+	if s.shedder != nil {
+		v1.Use(handler.LoadSheddingMiddleware(s.shedder, s.metrics))
+	}
+	v1.Use(handler.FeatureFlagsMiddleware(featureFlags, s.metrics))
+	if cfg.Retry.TelemetryHeaders {
+		v1.Use(handler.RetryTelemetryMiddleware())
+	}
+	{
+		// Chat completions use the enhanced pipeline with the stages configured for them
+		chatCompletions := middleware.RequireEndpoint(middleware.EndpointChatCompletions)
+		v1.POST("/chat/completions", append([]gin.HandlerFunc{chatCompletions}, chatHandlers...)...)
+		v1.GET("/chat/completions/:id/poll", chatCompletions, chatEnhanced.PollCompletion)
+		v1.GET("/models", middleware.RequireEndpoint(middleware.EndpointModels), cacheModels, enhancedProxyHandler.ListModels)
+		v1.POST("/admission", enhancedProxyHandler.Admission)
+		v1.POST("/cost/estimate", sub2apiProxyHandler.EstimateCost)
+
+		// Native Anthropic API proxy - still using enhanced handler
+		v1.POST("/messages", messagesHandlers...)
+		// Use sub2api handler for count_tokens (supports Web accounts)
+		v1.POST("/messages/count_tokens", countTokens...)
+
+		// Handle double /v1/v1 paths (client has /v1 in base URL)
+		v1.POST("/v1/messages", messagesHandlers...)
+		v1.POST("/v1/messages/count_tokens", countTokens...)
+	}
+
+	// Web mode routes (direct claude.ai proxy)
+	webRoutes := router.Group("/web")
+	webRoutes.Use(jwtMiddleware.Auth())
+	webRoutes.Use(jwtMiddleware.RequireMode("web", "both"))
+	webRoutes.Use(middleware.RequireEndpoint(middleware.EndpointWebConversations))
+	if s.shedder != nil {
+		webRoutes.Use(handler.LoadSheddingMiddleware(s.shedder, s.metrics))
+	}
+	{
+		webRoutes.POST("/conversations", webProxyHandler.CreateConversation)
+		webRoutes.GET("/conversations", webProxyHandler.ListConversations)
+		webRoutes.GET("/conversations/:conversation_id", webProxyHandler.GetConversation)
+		webRoutes.DELETE("/conversations/:conversation_id", webProxyHandler.DeleteConversation)
+		webRoutes.POST("/conversations/:conversation_id/completion", webProxyHandler.SendMessage)
+	}
+
+	// Admin UI (embedded SPA)
+	adminUI, err := handler.NewAdminUIHandler(web.DistFS, "dist")
+	if err != nil {
+		log.Warn().Err(err).Msg("failed to initialize admin UI, skipping")
+	} else {
+		adminUI.RegisterRoutes(router)
+		log.Info().Msg("admin UI available at /admin/")
+	}
+
+	s.router = router
+	return nil
+}
+
+func requestLogger() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		path := c.Request.URL.Path
+		raw := c.Request.URL.RawQuery
+
+		c.Next()
+
+		latency := time.Since(start)
+		status := c.Writer.Status()
+
+		if raw != "" {
+			path = path + "?" + raw
+		}
+
+		log.Info().
+			Int("status", status).
+			Str("method", c.Request.Method).
+			Str("path", path).
+			Dur("latency", latency).
+			Str("ip", c.ClientIP()).
+			Msg("request")
+	}
+}
+
+// noCache stands in for the HTTP cache middleware when it is disabled
+func noCache(c *gin.Context) {
+	c.Next()
+}
@@ -0,0 +1,915 @@
+// Package app wires all ccproxy subsystems into a runnable server. The binary,
+// tests and embedders share this initialization path.
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+
+	"ccproxy/internal/circuit"
+	"ccproxy/internal/concurrency"
+	"ccproxy/internal/config"
+	"ccproxy/internal/handler"
+	"ccproxy/internal/health"
+	"ccproxy/internal/jobs"
+	"ccproxy/internal/loadbalancer"
+	"ccproxy/internal/metrics"
+	"ccproxy/internal/notify"
+	"ccproxy/internal/pool"
+	"ccproxy/internal/ratelimit"
+	"ccproxy/internal/retry"
+	"ccproxy/internal/scheduler"
+	"ccproxy/internal/service"
+	"ccproxy/internal/shedding"
+	"ccproxy/internal/store"
+	"ccproxy/internal/upstream"
+	"ccproxy/pkg/jwt"
+)
+
+// shutdownTimeout bounds graceful shutdown when Run's context is cancelled
+const shutdownTimeout = 5 * time.Second
+
+// Server owns every subsystem of a ccproxy instance
+type Server struct {
+	cfg   *config.Config
+	build handler.BuildInfo
+
+	store          *store.Store
+	jwtManager     *jwt.Manager
+	keyPool        *loadbalancer.KeyPool
+	oauthService   *service.OAuthService
+	httpPool       *pool.HTTPPool
+	sampler        *upstream.Sampler
+	fingerprints   *pool.Fingerprints
+	circuitMgr     circuit.Manager
+	concurrencyMgr concurrency.Manager
+	rateLimiter    ratelimit.MultiLimiter
+	scheduler      scheduler.Scheduler
+	retryExecutor  retry.Executor
+	metrics        *metrics.Metrics
+	healthMonitor  health.Monitor
+	shedder        *shedding.Controller
+	jobs           *jobs.Queue
+
+	requestLogger          *service.RequestLogger
+	statsAggregator        *service.StatsAggregator
+	conversationCompressor *service.ConversationCompressor
+	mirror                 *service.Mirror
+	spendTracker           *service.SpendTracker
+	costEstimator          *service.CostEnricher
+	tracer                 *service.Tracer
+	betaHeaders            *service.BetaHeaders
+	retentionEnforcer      *service.RetentionEnforcer
+	failureClassifier      *service.FailureClassifier
+	anomalyDetector        *service.AnomalyDetector
+	accountDrainer         *service.AccountDrainer
+	conversationCleaner    *service.WebConversationCleaner
+	rateWindowResetter     *service.RateWindowResetter
+	canary                 *service.Canary
+	sloTracker             *service.SLOTracker
+	oidcProvider           *service.OIDCProvider
+	externalJWT            *service.ExternalJWTVerifier
+	notifier               *notify.Router
+
+	selfCheck []handler.SelfCheckIssue
+	router    *gin.Engine
+	http      *http.Server
+
+	// ctx scopes background services; cancelled on Shutdown
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	startOnce    sync.Once
+	shutdownOnce sync.Once
+	shutdownErr  error
+}
+
+// New validates the configuration and wires all subsystems. Background jobs
+// (health checks, aggregation, compression) only start with Run, so a Server
+// can be used as an http.Handler in tests.
+func New(cfg *config.Config, build handler.BuildInfo) (*Server, error) {
+	if cfg.JWT.Secret == "" {
+		return nil, errors.New("JWT secret is required (set CCPROXY_JWT_SECRET)")
+	}
+	if cfg.Admin.Key == "" {
+		return nil, errors.New("admin key is required (set CCPROXY_ADMIN_KEY)")
+	}
+
+	db, err := store.New(cfg.Storage.DBPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize database: %w", err)
+	}
+	if rp := cfg.Storage.ReadPool; rp.Enabled {
+		if err := db.EnableReadPool(rp.Path, rp.MaxConns); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to open database read pool: %w", err)
+		}
+		log.Info().Str("path", rp.Path).Int("max_conns", rp.MaxConns).Msg("initialized database read pool")
+	}
+
+	s := &Server{cfg: cfg, build: build, store: db}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+
+	s.runSelfCheck()
+	if err := s.initServices(); err != nil {
+		s.Shutdown(context.Background())
+		return nil, err
+	}
+	if err := s.initRouter(); err != nil {
+		s.Shutdown(context.Background())
+		return nil, err
+	}
+
+	if s.canary != nil {
+		s.canary.SetHandler(s.router)
+	}
+
+	s.http = &http.Server{
+		Addr:         fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.Port),
+		Handler:      s.router,
+		ReadTimeout:  time.Duration(cfg.Server.ReadTimeout) * time.Second,
+		WriteTimeout: time.Duration(cfg.Server.WriteTimeout) * time.Second,
+	}
+	if cfg.Server.TLS.Enabled {
+		tlsConfig, err := newTLSConfig(cfg.Server.TLS)
+		if err != nil {
+			s.Shutdown(context.Background())
+			return nil, err
+		}
+		s.http.TLSConfig = tlsConfig
+	}
+	if cfg.Server.HTTP2.Enabled {
+		// Cleartext HTTP/2 for load balancers that speak it to backends; with
+		// TLS, HTTP/2 is negotiated through ALPN instead
+		s.http.Handler = h2c.NewHandler(s.router, &http2.Server{
+			MaxConcurrentStreams: cfg.Server.HTTP2.MaxConcurrentStreams,
+			IdleTimeout:          cfg.Server.HTTP2.IdleTimeout,
+		})
+	}
+
+	return s, nil
+}
+
+// Handler returns the HTTP handler serving all routes
+func (s *Server) Handler() http.Handler {
+	return s.http.Handler
+}
+
+// Store returns the server's database
+func (s *Server) Store() *store.Store {
+	return s.store
+}
+
+// runSelfCheck validates config consistency and logs the findings
+func (s *Server) runSelfCheck() {
+	issues := config.SelfCheck(s.cfg)
+	if s.cfg.Server.Mode != "api" && len(s.cfg.Claude.APIKeys) == 0 {
+		if accounts, err := s.store.ListAccounts(); err == nil && len(accounts) == 0 {
+			issues = append(issues, config.Issue{
+				Level:   config.IssueWarning,
+				Field:   "accounts",
+				Message: "no accounts or API keys configured, requests cannot be served until an account is added",
+			})
+		}
+	}
+
+	s.selfCheck = make([]handler.SelfCheckIssue, 0, len(issues))
+	for _, issue := range issues {
+		event := log.Warn()
+		if issue.Level == config.IssueError {
+			event = log.Error()
+		}
+		event.Str("field", issue.Field).Msg("config self-check: " + issue.Message)
+		s.selfCheck = append(s.selfCheck, handler.SelfCheckIssue(issue))
+	}
+}
+
+// initServices creates the core subsystems in dependency order
+func (s *Server) initServices() error {
+	cfg := s.cfg
+
+	// Initialize JWT manager with the previous secrets and the keys added
+	// through the admin API
+	s.jwtManager = jwt.NewManager(cfg.JWT.Secret, cfg.JWT.Issuer)
+	for _, secret := range cfg.JWT.VerificationSecrets {
+		s.jwtManager.AddSecret(secret)
+	}
+	jwtKeys, err := s.store.ListJWTKeys()
+	if err != nil {
+		return fmt.Errorf("failed to load JWT keys: %w", err)
+	}
+	for _, key := range jwtKeys {
+		if err := s.jwtManager.AddKey(key.ID, key.Secret, key.CreatedAt); err != nil {
+			return fmt.Errorf("failed to load JWT key %s: %w", key.ID, err)
+		}
+		if key.Active {
+			_ = s.jwtManager.Activate(key.ID)
+		}
+	}
+
+	// Tokens declared in the configuration, signed with the active key
+	if len(cfg.Bootstrap.Tokens) > 0 {
+		tokens := make([]service.BootstrapToken, 0, len(cfg.Bootstrap.Tokens))
+		for _, spec := range cfg.Bootstrap.Tokens {
+			t, err := config.ParseBootstrapToken(spec)
+			if err != nil {
+				return fmt.Errorf("invalid bootstrap token: %w", err)
+			}
+			if t.Expiry == 0 {
+				t.Expiry = cfg.JWT.DefaultExpiry
+			}
+			tokens = append(tokens, service.BootstrapToken{ID: t.ID, Mode: t.Mode, Expiry: t.Expiry})
+		}
+		if err := service.EnsureBootstrapTokens(s.store, s.jwtManager, tokens, cfg.Bootstrap.TokenDir); err != nil {
+			return err
+		}
+	}
+
+	// Admin single sign-on
+	if oidc := cfg.Admin.OIDC; oidc.Enabled {
+		mappings := make([]service.OIDCRoleMapping, 0, len(oidc.RoleMappings))
+		for _, m := range oidc.RoleMappings {
+			mappings = append(mappings, service.OIDCRoleMapping{Group: m.Group, Role: m.Role})
+		}
+		s.oidcProvider = service.NewOIDCProvider(service.OIDCConfig{
+			IssuerURL:    oidc.IssuerURL,
+			ClientID:     oidc.ClientID,
+			ClientSecret: oidc.ClientSecret,
+			RedirectURL:  oidc.RedirectURL,
+			Scopes:       oidc.Scopes,
+			GroupsClaim:  oidc.GroupsClaim,
+			RoleMappings: mappings,
+			DefaultRole:  oidc.DefaultRole,
+		})
+		log.Info().Str("issuer", oidc.IssuerURL).Msg("admin OIDC login enabled")
+	}
+
+	// Accept JWTs from external identity providers for mapped tokens
+	if len(cfg.JWT.ExternalIssuers) > 0 {
+		issuers := make([]service.ExternalJWTIssuer, 0, len(cfg.JWT.ExternalIssuers))
+		names := make([]string, 0, len(cfg.JWT.ExternalIssuers))
+		for _, ext := range cfg.JWT.ExternalIssuers {
+			issuers = append(issuers, service.ExternalJWTIssuer{
+				Name:         ext.Name,
+				Issuer:       ext.Issuer,
+				Audiences:    ext.Audiences,
+				JWKSURL:      ext.JWKSURL,
+				SubjectClaim: ext.SubjectClaim,
+			})
+			names = append(names, ext.Name)
+		}
+		s.externalJWT = service.NewExternalJWTVerifier(issuers, 0)
+		log.Info().Strs("issuers", names).Msg("external JWT authentication enabled")
+	}
+
+	// Initialize key pool
+	if len(cfg.Claude.APIKeys) > 0 {
+		s.keyPool = loadbalancer.NewKeyPool(cfg.Claude.APIKeys, loadbalancer.Strategy(cfg.Claude.KeyStrategy))
+		log.Info().Int("keys", s.keyPool.Size()).Msg("initialized API key pool")
+	} else {
+		s.keyPool = loadbalancer.NewKeyPool([]string{}, loadbalancer.StrategyRoundRobin)
+		log.Warn().Msg("no API keys configured, API mode will be unavailable")
+	}
+
+	// Initialize OAuth service
+	s.oauthService = service.NewOAuthService(cfg.Claude.WebURL, cfg.Claude.APIURL, s.store)
+
+	// Initialize event notifications
+	s.notifier = notify.NewRouter(notifyRoutes(cfg.Notify), cfg.Notify.Timeout)
+	if routes := s.notifier.Routes(); len(routes) > 0 {
+		log.Info().Int("channels", len(routes)).Msg("event notifications enabled")
+	}
+	notifier := s.notifier
+	s.oauthService.SetNotifier(notifier)
+	s.oauthService.SetAdminAPIKey(cfg.Claude.AdminAPIKey)
+
+	// Background jobs, including OAuth onboarding
+	s.jobs = jobs.New(s.store, jobs.Config{
+		Workers:      cfg.Jobs.Workers,
+		PollInterval: cfg.Jobs.PollInterval,
+		Retention:    cfg.Jobs.Retention,
+	})
+	s.oauthService.RegisterOnboarding(s.jobs)
+
+	// api_key accounts join the key pool and are tracked against their budget
+	var pricing []service.ModelPrice
+	for _, p := range cfg.Logging.Pricing {
+		pricing = append(pricing, service.ModelPrice{Model: p.Model, Input: p.Input, Output: p.Output})
+	}
+	s.spendTracker = service.NewSpendTracker(s.store, s.keyPool, pricing)
+	s.costEstimator = service.NewCostEnricher(pricing)
+	s.spendTracker.SetNotifier(notifier)
+	if err := s.spendTracker.Load(); err != nil {
+		return fmt.Errorf("failed to load API key accounts: %w", err)
+	}
+
+	// Hourly usage of each account is compared against its baseline
+	s.anomalyDetector = service.NewAnomalyDetector(s.store, service.DefaultAnomalyCheckInterval)
+	s.anomalyDetector.SetNotifier(notifier)
+
+	// Drained accounts are deactivated once their drain ends
+	s.accountDrainer = service.NewAccountDrainer(s.store, service.DefaultDrainCheckInterval)
+
+	// Rate limits are lifted when the account's known rate window resets
+	s.rateWindowResetter = service.NewRateWindowResetter(s.store, service.DefaultRateWindowResetInterval)
+
+	// Synthetic canaries through the full proxy path; the handler is set once
+	// the router exists
+	if cc := cfg.Canary; cc.Enabled {
+		modes := cc.Modes
+		if len(modes) == 0 {
+			if cfg.Server.Mode == "both" {
+				modes = []string{"api", "web"}
+			} else {
+				modes = []string{cfg.Server.Mode}
+			}
+		}
+		s.canary = service.NewCanary(s.store, s.jwtManager, service.CanaryConfig{
+			Interval:         cc.Interval,
+			Modes:            modes,
+			Model:            cc.Model,
+			Timeout:          cc.Timeout,
+			MaxLatency:       cc.MaxLatency,
+			FailureThreshold: cc.FailureThreshold,
+		})
+		s.canary.SetNotifier(notifier)
+	}
+
+	// Error budgets of the service level objectives, from request logs
+	if sc := cfg.SLO; sc.Enabled {
+		s.sloTracker = service.NewSLOTracker(s.store, service.SLOConfig{
+			Window:         sc.Window,
+			Availability:   sc.Availability,
+			LatencyTarget:  sc.LatencyTarget,
+			LatencyPercent: sc.LatencyPercent,
+			CheckInterval:  sc.CheckInterval,
+			FastBurnWindow: sc.FastBurnWindow,
+			FastBurnRate:   sc.FastBurnRate,
+			SlowBurnWindow: sc.SlowBurnWindow,
+			SlowBurnRate:   sc.SlowBurnRate,
+		})
+		s.sloTracker.SetNotifier(notifier)
+	}
+
+	// Trace headers on upstream API requests, with per-account sampling overrides
+	s.tracer = service.NewTracer(s.store, service.TracingConfig{
+		Propagate:     cfg.Tracing.Propagate,
+		SamplePercent: cfg.Tracing.SamplePercent,
+	})
+	if err := s.tracer.Load(); err != nil {
+		return fmt.Errorf("failed to load trace sampling overrides: %w", err)
+	}
+
+	// anthropic-beta header profiles shared by all proxy handlers
+	s.betaHeaders = service.NewBetaHeaders(service.BetaConfig{
+		Default:  cfg.Beta.Default,
+		Haiku:    cfg.Beta.Haiku,
+		APIKey:   cfg.Beta.APIKey,
+		OAuth:    cfg.Beta.OAuth,
+		Accounts: cfg.Beta.Accounts,
+	})
+
+	// Initialize enhanced components
+	s.httpPool = pool.NewHTTPPool(pool.PoolConfig{
+		MaxIdleConns:        cfg.Pool.MaxIdleConns,
+		MaxIdleConnsPerHost: cfg.Pool.MaxIdleConnsPerHost,
+		IdleConnTimeout:     cfg.Pool.IdleConnTimeout,
+		MaxClients:          cfg.Pool.MaxClients,
+		ClientIdleTTL:       cfg.Pool.ClientIdleTTL,
+		ResponseTimeout:     cfg.Pool.ResponseTimeout,
+	})
+	s.httpPool.SetEgressLookup(func(accountID string) *pool.Egress {
+		account, err := s.store.GetAccount(accountID)
+		if err != nil || account == nil || account.Network == nil {
+			return nil
+		}
+		return &pool.Egress{
+			Hosts:      account.Network.Hosts,
+			DNSServers: account.Network.DNSServers,
+			LocalAddr:  account.Network.LocalAddr,
+		}
+	})
+	log.Info().Msg("initialized connection pool")
+
+	// Accounts present rotating browser TLS fingerprints instead of sharing one
+	if fc := cfg.Pool.Fingerprint; fc.Enabled {
+		fingerprints, err := pool.NewFingerprints(pool.FingerprintConfig{
+			Profiles:       fc.Profiles,
+			RotateInterval: fc.RotateInterval,
+			Accounts:       fc.Accounts,
+		})
+		if err != nil {
+			return fmt.Errorf("invalid TLS fingerprint config: %w", err)
+		}
+		s.fingerprints = fingerprints
+		s.httpPool.SetFingerprints(fingerprints)
+		log.Info().
+			Strs("profiles", fc.Profiles).
+			Dur("rotate_interval", fc.RotateInterval).
+			Msg("TLS fingerprint rotation enabled")
+	}
+
+	if u := cfg.Metrics.UpstreamSamples; u.Enabled {
+		s.sampler = upstream.NewSampler(upstream.Config{
+			PerAccount:   u.PerAccount,
+			MaxBodyBytes: u.MaxBodyBytes,
+		})
+		s.httpPool.SetTransportWrapper(s.sampler.Transport)
+		log.Warn().Int("per_account", u.PerAccount).Msg("upstream exchange sampling enabled at /api/v1/debug/upstream/:account_id")
+	}
+
+	// claude.ai conversations created for web mode requests are deleted once
+	// their retention passes
+	if cc := cfg.Claude.ConversationCleanup; cc.Enabled {
+		s.conversationCleaner = service.NewWebConversationCleaner(s.store, service.WebConversationCleanerConfig{
+			WebURL:      cfg.Claude.WebURL,
+			Retention:   cc.Retention,
+			Interval:    cc.Interval,
+			BatchSize:   cc.BatchSize,
+			MaxAttempts: cc.MaxAttempts,
+		})
+		s.conversationCleaner.SetAccountDoer(s.httpPool)
+		s.conversationCleaner.SetBetaHeaders(s.betaHeaders)
+		s.conversationCleaner.SetTokenRefresher(s.oauthService)
+	}
+
+	s.circuitMgr = circuit.NewManager(circuit.BreakerConfig{
+		Enabled:          cfg.Circuit.Enabled,
+		FailureThreshold: cfg.Circuit.FailureThreshold,
+		SuccessThreshold: cfg.Circuit.SuccessThreshold,
+		OpenTimeout:      cfg.Circuit.OpenTimeout,
+	})
+	log.Info().Bool("enabled", cfg.Circuit.Enabled).Msg("initialized circuit breaker manager")
+
+	s.concurrencyMgr = concurrency.NewManager(concurrency.ConcurrencyConfig{
+		UserMax:       cfg.Concurrency.UserMax,
+		AccountMax:    cfg.Concurrency.AccountMax,
+		MaxWaitQueue:  cfg.Concurrency.MaxWaitQueue,
+		WaitTimeout:   cfg.Concurrency.WaitTimeout,
+		BackoffBase:   cfg.Concurrency.BackoffBase,
+		BackoffMax:    cfg.Concurrency.BackoffMax,
+		BackoffJitter: cfg.Concurrency.BackoffJitter,
+		PingInterval:  cfg.Concurrency.PingInterval,
+		FairQueue:     cfg.Concurrency.FairQueue,
+	})
+	log.Info().
+		Int("user_max", cfg.Concurrency.UserMax).
+		Int("account_max", cfg.Concurrency.AccountMax).
+		Bool("fair_queue", cfg.Concurrency.FairQueue).
+		Msg("initialized concurrency manager")
+
+	s.rateLimiter = ratelimit.NewMultiMemoryLimiter(ratelimit.RateLimitConfig{
+		Enabled: cfg.RateLimit.Enabled,
+		UserLimit: ratelimit.LimitRule{
+			Requests: cfg.RateLimit.UserLimit.Requests,
+			Window:   cfg.RateLimit.UserLimit.Window,
+		},
+		AccountLimit: ratelimit.LimitRule{
+			Requests: cfg.RateLimit.AccountLimit.Requests,
+			Window:   cfg.RateLimit.AccountLimit.Window,
+		},
+		IPLimit: ratelimit.LimitRule{
+			Requests: cfg.RateLimit.IPLimit.Requests,
+			Window:   cfg.RateLimit.IPLimit.Window,
+		},
+		GlobalLimit: ratelimit.LimitRule{
+			Requests: cfg.RateLimit.GlobalLimit.Requests,
+			Window:   cfg.RateLimit.GlobalLimit.Window,
+		},
+		EndUserLimit: ratelimit.LimitRule{
+			Requests: cfg.RateLimit.EndUserLimit.Requests,
+			Window:   cfg.RateLimit.EndUserLimit.Window,
+		},
+		IPPrefixLimit: ratelimit.LimitRule{
+			Requests: cfg.RateLimit.IPPrefixLimit.Requests,
+			Window:   cfg.RateLimit.IPPrefixLimit.Window,
+		},
+		IPv4Prefix: cfg.RateLimit.IPv4Prefix,
+		IPv6Prefix: cfg.RateLimit.IPv6Prefix,
+	})
+	log.Info().Bool("enabled", cfg.RateLimit.Enabled).Msg("initialized rate limiter")
+
+	s.scheduler = scheduler.NewScheduler(scheduler.SchedulerConfig{
+		StickySessionTTL: cfg.Scheduler.StickySessionTTL,
+		Strategy:         scheduler.Strategy(cfg.Scheduler.Strategy),
+	}, s.circuitMgr, s.concurrencyMgr)
+	log.Info().Str("strategy", cfg.Scheduler.Strategy).Msg("initialized scheduler")
+	// Accounts leaving rotation drop their sticky sessions right away
+	s.oauthService.SetStickyInvalidator(s.scheduler)
+	s.accountDrainer.SetStickyInvalidator(s.scheduler)
+
+	retryPolicy := retry.NewPolicy(retry.RetryConfig{
+		MaxAttempts:        cfg.Retry.MaxAttempts,
+		MaxAccountSwitches: cfg.Retry.MaxAccountSwitches,
+		InitialBackoff:     cfg.Retry.InitialBackoff,
+		MaxBackoff:         cfg.Retry.MaxBackoff,
+		Jitter:             cfg.Retry.Jitter,
+	})
+	s.retryExecutor = retry.NewExecutor(retryPolicy)
+	log.Info().Int("max_attempts", cfg.Retry.MaxAttempts).Int("max_switches", cfg.Retry.MaxAccountSwitches).Msg("initialized retry executor")
+
+	if cfg.Metrics.Enabled {
+		s.metrics = metrics.NewMetrics(metrics.MetricsConfig{
+			Enabled: cfg.Metrics.Enabled,
+			Path:    cfg.Metrics.Path,
+		})
+		log.Info().Str("path", cfg.Metrics.Path).Msg("initialized Prometheus metrics")
+	}
+
+	// Initialize health monitor
+	if cfg.Health.Enabled {
+		s.healthMonitor = health.NewMonitor(health.HealthConfig{
+			Enabled:            cfg.Health.Enabled,
+			CheckInterval:      cfg.Health.CheckInterval,
+			TokenRefreshBefore: cfg.Health.TokenRefreshBefore,
+			Timeout:            cfg.Health.Timeout,
+			PrewarmConcurrency: cfg.Health.PrewarmConcurrency,
+			PrewarmTimeout:     cfg.Health.PrewarmTimeout,
+		}, s.store, s.circuitMgr, s.oauthService)
+		s.scheduler.SetHealthScorer(s.healthMonitor)
+		log.Info().Dur("interval", cfg.Health.CheckInterval).Msg("initialized health monitor")
+	}
+
+	// Reject low priority requests first when the process runs short of memory
+	if sc := cfg.Shedding; sc.Enabled {
+		s.shedder = shedding.NewController(shedding.Config{
+			CheckInterval:   sc.CheckInterval,
+			MemorySoftBytes: uint64(sc.MemorySoftMB) << 20,
+			MemoryHardBytes: uint64(sc.MemoryHardMB) << 20,
+			GoroutinesSoft:  sc.GoroutinesSoft,
+			GoroutinesHard:  sc.GoroutinesHard,
+			RetryAfter:      sc.RetryAfter,
+		})
+	}
+
+	// Initialize request logger service; it runs from the start so requests
+	// served through Handler are logged even before Run
+	s.requestLogger = service.NewRequestLogger(s.store, 10000, 4)
+	enricherConfig := service.EnricherConfig{Enrichers: cfg.Logging.Enrichers, Pricing: pricing}
+	for _, r := range cfg.Logging.GeoIP {
+		enricherConfig.GeoIPRanges = append(enricherConfig.GeoIPRanges, service.GeoIPRange{CIDR: r.CIDR, Country: r.Country})
+	}
+	s.requestLogger.SetEnrichers(service.NewLogEnrichers(enricherConfig))
+	s.requestLogger.SetSamplingPolicy(service.SamplingPolicy{
+		Enabled:        cfg.Logging.Sampling.Enabled,
+		SuccessPercent: cfg.Logging.Sampling.SuccessPercent,
+		SlowThreshold:  cfg.Logging.Sampling.SlowThreshold,
+	})
+	s.requestLogger.SetConversationCap(service.ConversationCapPolicy{
+		MaxBytes:    cfg.Logging.ConvCap.MaxBytes,
+		HeadPercent: cfg.Logging.ConvCap.HeadPercent,
+	})
+	if err := s.requestLogger.Start(s.ctx); err != nil {
+		return fmt.Errorf("failed to start request logger: %w", err)
+	}
+	log.Info().Msg("initialized request logger service")
+
+	// Request mirroring; like the request logger it runs from the start
+	if cfg.Mirror.Enabled {
+		s.mirror = service.NewMirror(s.store, service.MirrorConfig{
+			Percent:      cfg.Mirror.Percent,
+			UpstreamURL:  cfg.Mirror.UpstreamURL,
+			APIKey:       cfg.Mirror.APIKey,
+			Model:        cfg.Mirror.Model,
+			Timeout:      cfg.Mirror.Timeout,
+			Workers:      cfg.Mirror.Workers,
+			QueueSize:    cfg.Mirror.QueueSize,
+			MaxBodyBytes: cfg.Mirror.MaxBodyBytes,
+		})
+		if err := s.mirror.Start(s.ctx); err != nil {
+			return fmt.Errorf("failed to start request mirror: %w", err)
+		}
+	}
+
+	// Stats aggregator (runs daily) and conversation compressor (compresses
+	// conversations older than logging.compression.age) are started by Run
+	s.statsAggregator = service.NewStatsAggregator(s.store, 24*time.Hour)
+	s.conversationCompressor = service.NewConversationCompressor(s.store, cfg.Logging.Compression.Age, 24*time.Hour)
+	if err := s.conversationCompressor.SetAlgorithm(cfg.Logging.Compression.Algorithm); err != nil {
+		log.Warn().Err(err).Msg("using gzip for conversation compression")
+	}
+
+	return nil
+}
+
+// ReloadSecrets resolves the configured secret references again. Rotated
+// Claude API keys are swapped into the key pool and a rotated JWT secret
+// signs new tokens while the previous one stays accepted until restart; the
+// other secrets are read once at startup, so changes to them are logged and
+// apply after a restart.
+func (s *Server) ReloadSecrets(ctx context.Context) error {
+	before := *s.cfg
+	oldKeys := append([]string(nil), s.cfg.Claude.APIKeys...)
+	if err := s.cfg.ResolveSecrets(ctx); err != nil {
+		return fmt.Errorf("failed to reload secrets: %w", err)
+	}
+
+	current := make(map[string]bool, len(s.cfg.Claude.APIKeys))
+	added, removed := 0, 0
+	for _, key := range s.cfg.Claude.APIKeys {
+		current[key] = true
+		if s.keyPool.Add(key) {
+			added++
+		}
+	}
+	for _, key := range oldKeys {
+		if !current[key] && s.keyPool.Remove(key) {
+			removed++
+		}
+	}
+
+	if s.cfg.JWT.Secret != before.JWT.Secret {
+		s.jwtManager.RotateSecret(before.JWT.Secret, s.cfg.JWT.Secret)
+		log.Warn().Msg("jwt.secret rotated; add the previous secret to jwt.verification_secrets to keep accepting its tokens after a restart")
+	}
+	for _, secret := range s.cfg.JWT.VerificationSecrets {
+		s.jwtManager.AddSecret(secret)
+	}
+
+	for _, changed := range []struct {
+		field string
+		old   string
+		new   string
+	}{
+		{"admin.key", before.Admin.Key, s.cfg.Admin.Key},
+		{"admin.oidc.client_secret", before.Admin.OIDC.ClientSecret, s.cfg.Admin.OIDC.ClientSecret},
+		{"claude.admin_api_key", before.Claude.AdminAPIKey, s.cfg.Claude.AdminAPIKey},
+	} {
+		if changed.old != changed.new {
+			log.Warn().Str("field", changed.field).Msg("secret changed, restart to apply it")
+		}
+	}
+
+	log.Info().Int("added", added).Int("removed", removed).Int("keys", s.keyPool.Size()).Msg("reloaded secrets")
+	return nil
+}
+
+// Run starts background jobs and serves HTTP until ctx is cancelled or the
+// listener fails, then shuts the server down
+func (s *Server) Run(ctx context.Context) error {
+	if err := s.start(); err != nil {
+		s.Shutdown(context.Background())
+		return err
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		log.Info().Str("addr", s.http.Addr).Bool("http2", s.cfg.Server.HTTP2.Enabled).Bool("tls", s.cfg.Server.TLS.Enabled).Msg("starting server")
+		log.Info().
+			Bool("pool", true).
+			Bool("circuit", s.cfg.Circuit.Enabled).
+			Bool("concurrency", true).
+			Bool("ratelimit", s.cfg.RateLimit.Enabled).
+			Bool("health", s.cfg.Health.Enabled).
+			Bool("metrics", s.cfg.Metrics.Enabled).
+			Msg("enhanced features enabled")
+		var err error
+		if t := s.cfg.Server.TLS; t.Enabled {
+			err = s.http.ListenAndServeTLS(t.CertFile, t.KeyFile)
+		} else {
+			err = s.http.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
+			errCh <- err
+		}
+		close(errCh)
+	}()
+
+	select {
+	case err, ok := <-errCh:
+		s.Shutdown(context.Background())
+		if ok {
+			return fmt.Errorf("failed to start server: %w", err)
+		}
+		return nil
+	case <-ctx.Done():
+	}
+
+	log.Info().Msg("shutting down server...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	return s.Shutdown(shutdownCtx)
+}
+
+// start launches the periodic background jobs
+func (s *Server) start() error {
+	var err error
+	s.startOnce.Do(func() {
+		if err = s.statsAggregator.Start(s.ctx); err != nil {
+			err = fmt.Errorf("failed to start stats aggregator: %w", err)
+			return
+		}
+		log.Info().Msg("initialized stats aggregator")
+
+		if err = s.conversationCompressor.Start(s.ctx); err != nil {
+			err = fmt.Errorf("failed to start conversation compressor: %w", err)
+			return
+		}
+		log.Info().Msg("initialized conversation compressor")
+
+		if err = s.spendTracker.Start(s.ctx); err != nil {
+			err = fmt.Errorf("failed to start spend tracker: %w", err)
+			return
+		}
+
+		s.retentionEnforcer = service.NewRetentionEnforcer(s.store, service.DefaultRetentionInterval)
+		if err = s.retentionEnforcer.Start(s.ctx); err != nil {
+			err = fmt.Errorf("failed to start retention enforcer: %w", err)
+			return
+		}
+
+		s.failureClassifier = service.NewFailureClassifier(s.store, service.DefaultFailureClassifyInterval)
+		if err = s.failureClassifier.Start(s.ctx); err != nil {
+			err = fmt.Errorf("failed to start failure classifier: %w", err)
+			return
+		}
+
+		if err = s.anomalyDetector.Start(s.ctx); err != nil {
+			err = fmt.Errorf("failed to start anomaly detector: %w", err)
+			return
+		}
+
+		if err = s.accountDrainer.Start(s.ctx); err != nil {
+			err = fmt.Errorf("failed to start account drainer: %w", err)
+			return
+		}
+
+		if err = s.rateWindowResetter.Start(s.ctx); err != nil {
+			err = fmt.Errorf("failed to start rate window resetter: %w", err)
+			return
+		}
+
+		if s.conversationCleaner != nil {
+			if err = s.conversationCleaner.Start(s.ctx); err != nil {
+				err = fmt.Errorf("failed to start web conversation cleaner: %w", err)
+				return
+			}
+		}
+
+		if err = s.jobs.Start(s.ctx); err != nil {
+			err = fmt.Errorf("failed to start job queue: %w", err)
+			return
+		}
+
+		if s.canary != nil {
+			if err = s.canary.Start(s.ctx); err != nil {
+				err = fmt.Errorf("failed to start canary: %w", err)
+				return
+			}
+		}
+
+		if s.sloTracker != nil {
+			if err = s.sloTracker.Start(s.ctx); err != nil {
+				err = fmt.Errorf("failed to start SLO tracker: %w", err)
+				return
+			}
+		}
+
+		if s.shedder != nil {
+			if err = s.shedder.Start(s.ctx); err != nil {
+				err = fmt.Errorf("failed to start load shedding: %w", err)
+				return
+			}
+		}
+
+		if s.healthMonitor != nil {
+			if startErr := s.healthMonitor.Start(s.ctx); startErr != nil {
+				log.Error().Err(startErr).Msg("failed to start health monitor")
+			}
+		}
+	})
+	return err
+}
+
+// Shutdown stops the HTTP server and releases all subsystems. It is safe to
+// call more than once.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.shutdownOnce.Do(func() {
+		if s.http != nil {
+			if err := s.http.Shutdown(ctx); err != nil {
+				s.shutdownErr = fmt.Errorf("server forced to shutdown: %w", err)
+			}
+		}
+
+		if s.healthMonitor != nil {
+			s.healthMonitor.Stop()
+		}
+		if s.shedder != nil {
+			s.shedder.Stop()
+		}
+		if s.jobs != nil {
+			s.jobs.Stop()
+		}
+		if s.canary != nil {
+			s.canary.Stop()
+		}
+		if s.sloTracker != nil {
+			s.sloTracker.Stop()
+		}
+		if s.anomalyDetector != nil {
+			s.anomalyDetector.Stop()
+		}
+		if s.accountDrainer != nil {
+			s.accountDrainer.Stop()
+		}
+		if s.rateWindowResetter != nil {
+			s.rateWindowResetter.Stop()
+		}
+		if s.conversationCleaner != nil {
+			s.conversationCleaner.Stop()
+		}
+		if s.failureClassifier != nil {
+			s.failureClassifier.Stop()
+		}
+		if s.retentionEnforcer != nil {
+			s.retentionEnforcer.Stop()
+		}
+		if s.spendTracker != nil {
+			s.spendTracker.Stop()
+		}
+		if s.conversationCompressor != nil {
+			s.conversationCompressor.Stop()
+		}
+		if s.statsAggregator != nil {
+			s.statsAggregator.Stop()
+		}
+		if s.requestLogger != nil {
+			s.requestLogger.Stop()
+		}
+		if s.mirror != nil {
+			s.mirror.Stop()
+		}
+		s.cancel()
+
+		if s.scheduler != nil {
+			s.scheduler.Close()
+		}
+		if s.rateLimiter != nil {
+			s.rateLimiter.Close()
+		}
+		if s.concurrencyMgr != nil {
+			s.concurrencyMgr.Close()
+		}
+		if s.circuitMgr != nil {
+			s.circuitMgr.Close()
+		}
+		if s.httpPool != nil {
+			s.httpPool.Close()
+		}
+		s.store.Close()
+
+		log.Info().Msg("server stopped")
+	})
+	return s.shutdownErr
+}
+
+// notifyRoutes builds the notification channels; the legacy webhook_url is a
+// webhook channel named "webhook" receiving every event
+func notifyRoutes(cfg config.NotifyConfig) []notify.Route {
+	var routes []notify.Route
+	if cfg.WebhookURL != "" {
+		routes = append(routes, notify.Route{
+			Name:    "webhook",
+			Type:    "webhook",
+			Channel: notify.NewWebhookNotifier(cfg.WebhookURL, cfg.Timeout),
+		})
+	}
+	for _, ch := range cfg.Channels {
+		route := notify.Route{
+			Name:        ch.Name,
+			Type:        ch.Type,
+			Events:      ch.Events,
+			MinSeverity: notify.Severity(ch.MinSeverity),
+		}
+		switch ch.Type {
+		case "webhook":
+			route.Channel = notify.NewWebhookNotifier(ch.URL, cfg.Timeout)
+		case "slack":
+			route.Channel = notify.NewSlackChannel(ch.URL)
+		case "telegram":
+			route.Channel = notify.NewTelegramChannel(ch.TelegramAPI, ch.BotToken, ch.ChatID)
+		case "smtp":
+			route.Channel = notify.NewSMTPChannel(notify.SMTPConfig{
+				Host:     ch.SMTP.Host,
+				Port:     ch.SMTP.Port,
+				Username: ch.SMTP.Username,
+				Password: ch.SMTP.Password,
+				From:     ch.SMTP.From,
+				To:       ch.SMTP.To,
+			})
+		default:
+			continue // Reported by SelfCheck
+		}
+		routes = append(routes, route)
+	}
+	return routes
+}
@@ -0,0 +1,240 @@
+package app
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+
+	"ccproxy/internal/config"
+	"ccproxy/internal/handler"
+)
+
+func newTestServer(t *testing.T, configure ...func(*config.Config)) *Server {
+	t.Helper()
+
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("config.Load: %v", err)
+	}
+	cfg.JWT.Secret = "test-secret-test-secret-test-secret"
+	cfg.Admin.Key = "test-admin-key-123"
+	cfg.Storage.DBPath = filepath.Join(t.TempDir(), "test.db")
+	cfg.Health.Enabled = false
+	cfg.Metrics.Enabled = false
+	cfg.Server.Host = "127.0.0.1"
+	cfg.Server.Port = 0
+	for _, f := range configure {
+		f(cfg)
+	}
+
+	srv, err := New(cfg, handler.BuildInfo{Version: "test", GitCommit: "abc123"})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	t.Cleanup(func() { srv.Shutdown(context.Background()) })
+	return srv
+}
+
+func TestNew_RequiresSecrets(t *testing.T) {
+	cfg := &config.Config{}
+	if _, err := New(cfg, handler.BuildInfo{}); err == nil {
+		t.Error("expected error without JWT secret and admin key")
+	}
+}
+
+func TestServer_Routes(t *testing.T) {
+	srv := newTestServer(t)
+
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("/health status = %d", w.Code)
+	}
+
+	// Admin routes require the admin key
+	w = httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/version", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("/api/version without key status = %d", w.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/version", nil)
+	req.Header.Set("X-Admin-Key", "test-admin-key-123")
+	w = httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("/api/version status = %d", w.Code)
+	}
+	var version struct {
+		Version   string `json:"version"`
+		GitCommit string `json:"git_commit"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &version); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if version.Version != "test" || version.GitCommit != "abc123" {
+		t.Errorf("unexpected version: %+v", version)
+	}
+
+	// Proxy routes require a token
+	w = httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/messages", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("/v1/messages without token status = %d", w.Code)
+	}
+}
+
+func TestServer_APIVersions(t *testing.T) {
+	srv := newTestServer(t)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("X-Admin-Key", "test-admin-key-123")
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, req)
+		return w
+	}
+
+	for _, path := range []string{"/api/version", "/api/v1/version", "/api/v2/version"} {
+		if w := get(path); w.Code != http.StatusOK {
+			t.Errorf("%s status = %d", path, w.Code)
+		}
+	}
+	if w := get("/api/version"); w.Header().Get("Deprecation") != "true" {
+		t.Errorf("unversioned API is not marked deprecated: %v", w.Header())
+	}
+	if w := get("/api/v1/version"); w.Header().Get("Deprecation") != "" || w.Header().Get("API-Version") != "v1" {
+		t.Errorf("v1 headers = %v", w.Header())
+	}
+
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v2/version", nil))
+	if w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), `"type":"authentication_error"`) {
+		t.Errorf("v2 without key = %d %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/versions", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"prefix":"/api/v2"`) {
+		t.Errorf("/api/versions = %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestServer_AdminSSORoutes(t *testing.T) {
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("config.Load: %v", err)
+	}
+	cfg.JWT.Secret = "test-secret-test-secret-test-secret"
+	cfg.Admin.Key = "test-admin-key-123"
+	cfg.Admin.OIDC = config.OIDCConfig{
+		Enabled:     true,
+		IssuerURL:   "http://127.0.0.1:1", // unreachable
+		ClientID:    "ccproxy",
+		RedirectURL: "http://localhost/api/auth/oidc/callback",
+	}
+	cfg.Storage.DBPath = filepath.Join(t.TempDir(), "test.db")
+	cfg.Health.Enabled = false
+	cfg.Metrics.Enabled = false
+
+	srv, err := New(cfg, handler.BuildInfo{Version: "test"})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	t.Cleanup(func() { srv.Shutdown(context.Background()) })
+
+	// Login is public; the provider is down
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/auth/oidc/login", nil))
+	if w.Code != http.StatusBadGateway {
+		t.Errorf("/api/auth/oidc/login status = %d", w.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/auth/me", nil)
+	req.Header.Set("X-Admin-Key", "test-admin-key-123")
+	w = httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, req)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"role":"admin"`) {
+		t.Errorf("/api/auth/me = %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestServer_HTTP2Cleartext(t *testing.T) {
+	client := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		},
+	}}
+
+	// h2c is off unless enabled
+	off := httptest.NewServer(newTestServer(t).Handler())
+	defer off.Close()
+	if resp, err := client.Get(off.URL + "/health"); err == nil {
+		resp.Body.Close()
+		t.Errorf("h2c request served by default: %s %d", resp.Proto, resp.StatusCode)
+	}
+
+	srv := newTestServer(t, func(cfg *config.Config) { cfg.Server.HTTP2.Enabled = true })
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	resp, err := client.Get(ts.URL + "/health")
+	if err != nil {
+		t.Fatalf("h2c request: %v", err)
+	}
+	resp.Body.Close()
+	if resp.ProtoMajor != 2 || resp.StatusCode != http.StatusOK {
+		t.Errorf("got %s %d, want HTTP/2.0 200", resp.Proto, resp.StatusCode)
+	}
+
+	// HTTP/1.1 clients are still served
+	resp, err = http.Get(ts.URL + "/health")
+	if err != nil {
+		t.Fatalf("HTTP/1.1 request: %v", err)
+	}
+	resp.Body.Close()
+	if resp.ProtoMajor != 1 || resp.StatusCode != http.StatusOK {
+		t.Errorf("got %s %d, want HTTP/1.1 200", resp.Proto, resp.StatusCode)
+	}
+}
+
+func TestServer_ShutdownIdempotent(t *testing.T) {
+	srv := newTestServer(t)
+	if err := srv.Shutdown(context.Background()); err != nil {
+		t.Errorf("first Shutdown: %v", err)
+	}
+	if err := srv.Shutdown(context.Background()); err != nil {
+		t.Errorf("second Shutdown: %v", err)
+	}
+}
+
+func TestServer_RunStopsOnCancel(t *testing.T) {
+	srv := newTestServer(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- srv.Run(ctx) }()
+
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Run: %v", err)
+		}
+	case <-time.After(shutdownTimeout + time.Second):
+		t.Fatal("Run did not return after cancel")
+	}
+}
@@ -0,0 +1,172 @@
+package app
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"ccproxy/internal/config"
+)
+
+// newTLSConfig builds the HTTPS configuration. With a client CA bundle, client
+// certificates are verified against it and checked against the revocation
+// list; whether a certificate is required follows client_auth. The revocation
+// check runs in VerifyConnection, which unlike VerifyPeerCertificate also runs
+// on resumed sessions.
+func newTLSConfig(cfg config.TLSConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if cfg.ClientCAFile == "" {
+		return tlsConfig, nil
+	}
+
+	data, err := os.ReadFile(cfg.ClientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client CA bundle: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("client CA bundle %s holds no PEM certificates", cfg.ClientCAFile)
+	}
+	tlsConfig.ClientCAs = pool
+	tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	if cfg.ClientAuth == "require" {
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	if cfg.ClientCRLFile != "" {
+		crl := &revocationList{path: cfg.ClientCRLFile, issuers: pemCertificates(data)}
+		if err := crl.reload(); err != nil {
+			return nil, err
+		}
+		tlsConfig.VerifyConnection = func(cs tls.ConnectionState) error {
+			return crl.verify(cs.VerifiedChains)
+		}
+	}
+	return tlsConfig, nil
+}
+
+// revocationList holds the serial numbers revoked by a CRL file, re-read when
+// the file changes so revocations apply without a restart. Only lists signed
+// by one of the client CAs are accepted.
+type revocationList struct {
+	path    string
+	issuers []*x509.Certificate
+
+	mu      sync.RWMutex
+	modTime time.Time
+	revoked map[string]bool // Keyed by issuer raw subject and serial number
+}
+
+// reload reads the CRL file if it changed since the last read
+func (r *revocationList) reload() error {
+	info, err := os.Stat(r.path)
+	if err != nil {
+		return fmt.Errorf("failed to read client CRL: %w", err)
+	}
+	r.mu.RLock()
+	unchanged := r.revoked != nil && info.ModTime().Equal(r.modTime)
+	r.mu.RUnlock()
+	if unchanged {
+		return nil
+	}
+
+	data, err := os.ReadFile(r.path)
+	if err != nil {
+		return fmt.Errorf("failed to read client CRL: %w", err)
+	}
+	revoked := make(map[string]bool)
+	for _, der := range crlBlocks(data) {
+		list, err := x509.ParseRevocationList(der)
+		if err != nil {
+			return fmt.Errorf("failed to parse client CRL %s: %w", r.path, err)
+		}
+		if err := r.checkSignature(list); err != nil {
+			return fmt.Errorf("client CRL %s: %w", r.path, err)
+		}
+		for _, entry := range list.RevokedCertificateEntries {
+			revoked[string(list.RawIssuer)+"/"+entry.SerialNumber.String()] = true
+		}
+	}
+
+	r.mu.Lock()
+	r.revoked = revoked
+	r.modTime = info.ModTime()
+	r.mu.Unlock()
+	return nil
+}
+
+// checkSignature verifies that a revocation list was signed by the client CA
+// that issued it
+func (r *revocationList) checkSignature(list *x509.RevocationList) error {
+	for _, ca := range r.issuers {
+		if !bytes.Equal(ca.RawSubject, list.RawIssuer) {
+			continue
+		}
+		if err := list.CheckSignatureFrom(ca); err == nil {
+			return nil
+		}
+	}
+	return errors.New("revocation list is not signed by a client CA")
+}
+
+// verify rejects verified chains whose certificates are revoked. A CRL that
+// fails to reload keeps its previous contents.
+func (r *revocationList) verify(chains [][]*x509.Certificate) error {
+	_ = r.reload()
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, chain := range chains {
+		for _, cert := range chain {
+			if r.revoked[string(cert.RawIssuer)+"/"+cert.SerialNumber.String()] {
+				return errors.New("client certificate has been revoked")
+			}
+		}
+	}
+	return nil
+}
+
+// pemCertificates returns the certificates of a PEM bundle
+func pemCertificates(data []byte) []*x509.Certificate {
+	var certs []*x509.Certificate
+	for rest := data; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		if cert, err := x509.ParseCertificate(block.Bytes); err == nil {
+			certs = append(certs, cert)
+		}
+	}
+	return certs
+}
+
+// crlBlocks returns the DER revocation lists of a PEM file, or the file itself
+// when it is DER
+func crlBlocks(data []byte) [][]byte {
+	var blocks [][]byte
+	for rest := data; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type == "X509 CRL" {
+			blocks = append(blocks, block.Bytes)
+		}
+	}
+	if len(blocks) == 0 {
+		blocks = append(blocks, data)
+	}
+	return blocks
+}
@@ -0,0 +1,132 @@
+package app
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"ccproxy/internal/config"
+)
+
+func TestNewTLSConfig_ClientCertRevocation(t *testing.T) {
+	dir := t.TempDir()
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, _ := x509.ParseCertificate(caDER)
+
+	clientCert := func(serial int64) *x509.Certificate {
+		key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: "client"},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		}, ca, &key.PublicKey, caKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, _ := x509.ParseCertificate(der)
+		return cert
+	}
+	good, revoked := clientCert(10), clientCert(11)
+
+	crlDER, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:                    big.NewInt(1),
+		ThisUpdate:                time.Now(),
+		NextUpdate:                time.Now().Add(time.Hour),
+		RevokedCertificateEntries: []x509.RevocationListEntry{{SerialNumber: big.NewInt(11), RevocationTime: time.Now()}},
+	}, ca, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	caFile := filepath.Join(dir, "ca.pem")
+	crlFile := filepath.Join(dir, "crl.pem")
+	_ = os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}), 0o600)
+	_ = os.WriteFile(crlFile, pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: crlDER}), 0o600)
+
+	tlsConfig, err := newTLSConfig(config.TLSConfig{
+		Enabled:       true,
+		ClientCAFile:  caFile,
+		ClientCRLFile: crlFile,
+		ClientAuth:    "optional",
+	})
+	if err != nil {
+		t.Fatalf("newTLSConfig: %v", err)
+	}
+	if tlsConfig.ClientAuth != tls.VerifyClientCertIfGiven {
+		t.Errorf("ClientAuth = %v, want VerifyClientCertIfGiven", tlsConfig.ClientAuth)
+	}
+	// The check runs on every connection, resumed sessions included
+	verify := func(cert *x509.Certificate) error {
+		return tlsConfig.VerifyConnection(tls.ConnectionState{DidResume: true, VerifiedChains: [][]*x509.Certificate{{cert, ca}}})
+	}
+	if err := verify(good); err != nil {
+		t.Errorf("valid certificate rejected: %v", err)
+	}
+	if err := verify(revoked); err == nil {
+		t.Error("revoked certificate accepted")
+	}
+
+	// A DER revocation list replacing the PEM file is picked up without a restart
+	emptyDER, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:     big.NewInt(2),
+		ThisUpdate: time.Now(),
+		NextUpdate: time.Now().Add(time.Hour),
+	}, ca, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = os.WriteFile(crlFile, emptyDER, 0o600)
+	_ = os.Chtimes(crlFile, time.Now().Add(time.Minute), time.Now().Add(time.Minute))
+	if err := verify(revoked); err != nil {
+		t.Errorf("certificate still revoked after CRL update: %v", err)
+	}
+
+	// A list signed by another key with the CA's name is refused, at startup
+	// and on reload
+	forgerKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	forgedDER, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:                    big.NewInt(3),
+		ThisUpdate:                time.Now(),
+		NextUpdate:                time.Now().Add(time.Hour),
+		RevokedCertificateEntries: []x509.RevocationListEntry{{SerialNumber: big.NewInt(10), RevocationTime: time.Now()}},
+	}, ca, forgerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = os.WriteFile(crlFile, forgedDER, 0o600)
+	_ = os.Chtimes(crlFile, time.Now().Add(2*time.Minute), time.Now().Add(2*time.Minute))
+	if err := verify(good); err != nil {
+		t.Errorf("forged CRL revoked a certificate: %v", err)
+	}
+	if _, err := newTLSConfig(config.TLSConfig{Enabled: true, ClientCAFile: caFile, ClientCRLFile: crlFile}); err == nil {
+		t.Error("expected error for a CRL not signed by a client CA")
+	}
+
+	if _, err := newTLSConfig(config.TLSConfig{Enabled: true, ClientCAFile: crlFile}); err == nil {
+		t.Error("expected error for a CA bundle without certificates")
+	}
+}
@@ -130,3 +130,32 @@ func TestManager_Disabled(t *testing.T) {
 		t.Error("expected account to be available when breaker is disabled")
 	}
 }
+
+func TestManager_OnStateChange(t *testing.T) {
+	mgr := NewManager(BreakerConfig{
+		Enabled:          true,
+		FailureThreshold: 2,
+		SuccessThreshold: 1,
+		OpenTimeout:      10 * time.Millisecond,
+	})
+	defer mgr.Close()
+
+	var changes []string
+	mgr.OnStateChange(func(accountID string, from, to State) {
+		changes = append(changes, accountID+":"+from.String()+"->"+to.String())
+	})
+
+	mgr.RecordFailure("acc1")
+	if len(changes) != 0 {
+		t.Fatalf("change before threshold: %v", changes)
+	}
+	mgr.RecordFailure("acc1")
+	time.Sleep(20 * time.Millisecond)
+	mgr.IsAvailable("acc1") // half-opens after the timeout
+	mgr.RecordSuccess("acc1")
+
+	want := []string{"acc1:closed->open", "acc1:half-open->closed"}
+	if len(changes) != len(want) || changes[0] != want[0] || changes[1] != want[1] {
+		t.Errorf("changes = %v, want %v", changes, want)
+	}
+}
@@ -20,18 +20,25 @@ type Manager interface {
 	RecordFailure(accountID string)
 	// Reset resets the breaker for an account
 	Reset(accountID string)
+	// OnStateChange registers fn to be called after a recorded request changes
+	// an account's breaker state
+	OnStateChange(fn StateChangeFunc)
 	// Stats returns statistics for all breakers
 	Stats() map[string]BreakerStats
 	// Close closes the manager
 	Close()
 }
 
+// StateChangeFunc is called when an account's breaker changes state
+type StateChangeFunc func(accountID string, from, to State)
+
 // breakerManager implements Manager
 type breakerManager struct {
-	config   BreakerConfig
-	breakers map[string]Breaker
-	mu       sync.RWMutex
-	closed   bool
+	config    BreakerConfig
+	breakers  map[string]Breaker
+	listeners []StateChangeFunc
+	mu        sync.RWMutex
+	closed    bool
 }
 
 // NewManager creates a new circuit breaker manager
@@ -101,7 +108,11 @@ func (m *breakerManager) GetAvailableAccounts(accountIDs []string) []string {
 // RecordSuccess records a successful request for an account
 func (m *breakerManager) RecordSuccess(accountID string) {
 	breaker := m.GetBreaker(accountID)
+	prevState := breaker.State()
 	breaker.RecordSuccess()
+	if newState := breaker.State(); prevState != newState {
+		m.notify(accountID, prevState, newState)
+	}
 }
 
 // RecordFailure records a failed request for an account
@@ -117,6 +128,25 @@ func (m *breakerManager) RecordFailure(accountID string) {
 			Str("prev_state", prevState.String()).
 			Str("new_state", newState.String()).
 			Msg("circuit breaker state changed")
+		m.notify(accountID, prevState, newState)
+	}
+}
+
+// OnStateChange registers a state change listener
+func (m *breakerManager) OnStateChange(fn StateChangeFunc) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.listeners = append(m.listeners, fn)
+}
+
+// notify calls the state change listeners outside the manager lock
+func (m *breakerManager) notify(accountID string, from, to State) {
+	m.mu.RLock()
+	listeners := m.listeners
+	m.mu.RUnlock()
+
+	for _, fn := range listeners {
+		fn(accountID, from, to)
 	}
 }
 
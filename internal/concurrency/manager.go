@@ -16,10 +16,13 @@ type ConcurrencyConfig struct {
 	AccountMax    int           `mapstructure:"account_max"`     // Max concurrent requests per account
 	MaxWaitQueue  int           `mapstructure:"max_wait_queue"`  // Max waiting requests
 	WaitTimeout   time.Duration `mapstructure:"wait_timeout"`    // Max time to wait for slot
+	// Backoff settings are kept for compatibility; waiters no longer poll but
+	// are handed released slots directly
 	BackoffBase   time.Duration `mapstructure:"backoff_base"`    // Initial backoff duration
 	BackoffMax    time.Duration `mapstructure:"backoff_max"`     // Maximum backoff duration
 	BackoffJitter float64       `mapstructure:"backoff_jitter"`  // Jitter factor (0-1)
 	PingInterval  time.Duration `mapstructure:"ping_interval"`   // SSE ping interval while waiting
+	FairQueue     bool          `mapstructure:"fair_queue"`      // Share an account's slots fairly between waiting tokens
 }
 
 // DefaultConcurrencyConfig returns the default concurrency configuration
@@ -33,6 +36,7 @@ func DefaultConcurrencyConfig() ConcurrencyConfig {
 		BackoffMax:    2 * time.Second,
 		BackoffJitter: 0.2,
 		PingInterval:  5 * time.Second,
+		FairQueue:     true,
 	}
 }
 
@@ -57,10 +61,11 @@ type Manager interface {
 	AcquireUserSlot(ctx context.Context, userID string) (*AcquireResult, error)
 	// ReleaseUserSlot releases a user slot
 	ReleaseUserSlot(userID string)
-	// AcquireAccountSlot acquires a slot for an account
-	AcquireAccountSlot(ctx context.Context, accountID string) (*AcquireResult, error)
-	// ReleaseAccountSlot releases an account slot
-	ReleaseAccountSlot(accountID string)
+	// AcquireAccountSlot acquires a slot for an account on behalf of a token;
+	// under contention, tokens holding fewer of the account's slots go first
+	AcquireAccountSlot(ctx context.Context, accountID, tokenID string) (*AcquireResult, error)
+	// ReleaseAccountSlot releases an account slot acquired for tokenID
+	ReleaseAccountSlot(accountID, tokenID string)
 	// GetUserLoad returns load info for a user
 	GetUserLoad(userID string) *LoadInfo
 	// GetAccountLoad returns load info for accounts
@@ -85,22 +90,144 @@ type ManagerStats struct {
 	TotalTimeouts   int64 `json:"total_timeouts"`
 }
 
-// slot tracks concurrency for a single entity
+// waiter is a request queued for a slot. ready is closed when a released slot
+// is handed to it, or when the manager closes.
+type waiter struct {
+	key     string
+	ready   chan struct{}
+	granted bool
+}
+
+// slot tracks concurrency for a single entity. Waiters are queued per fairness
+// key: a released slot goes to the key holding the fewest slots, and keys
+// holding the same number take turns, so one busy key cannot starve the others.
 type slot struct {
-	current  int32
-	max      int32
-	waiting  int32
-	total    int64
-	mu       sync.Mutex
-	cond     *sync.Cond
+	current int32
+	max     int32
+	waiting int32
+	total   int64
+	mu      sync.Mutex
+	closed  bool
+	held    map[string]int       // slots in use per key
+	queues  map[string][]*waiter // waiters per key, oldest first
+	keys    []string             // keys with waiters, in turn order
 }
 
 func newSlot(max int) *slot {
-	s := &slot{
-		max: int32(max),
+	return &slot{
+		max:    int32(max),
+		held:   make(map[string]int),
+		queues: make(map[string][]*waiter),
+	}
+}
+
+// grant takes a slot for key; s.mu must be held
+func (s *slot) grant(key string) {
+	atomic.AddInt32(&s.current, 1)
+	atomic.AddInt64(&s.total, 1)
+	s.held[key]++
+}
+
+// enqueue queues a waiter for key; s.mu must be held
+func (s *slot) enqueue(key string) *waiter {
+	w := &waiter{key: key, ready: make(chan struct{})}
+	if len(s.queues[key]) == 0 {
+		s.keys = append(s.keys, key)
+	}
+	s.queues[key] = append(s.queues[key], w)
+	atomic.AddInt32(&s.waiting, 1)
+	return w
+}
+
+// next dequeues the waiter whose key holds the fewest slots, the earliest in
+// turn order on ties. The key then moves to the back of the turn order.
+// s.mu must be held and at least one waiter queued.
+func (s *slot) next() *waiter {
+	best := 0
+	for i, key := range s.keys[1:] {
+		if s.held[key] < s.held[s.keys[best]] {
+			best = i + 1
+		}
+	}
+	key := s.keys[best]
+	queue := s.queues[key]
+	w := queue[0]
+	s.keys = append(s.keys[:best], s.keys[best+1:]...)
+	if len(queue) > 1 {
+		s.queues[key] = queue[1:]
+		s.keys = append(s.keys, key)
+	} else {
+		delete(s.queues, key)
+	}
+	atomic.AddInt32(&s.waiting, -1)
+	return w
+}
+
+// abandon removes a waiter that gave up, reporting false if a slot was handed
+// to it in the meantime and must be used or released
+func (s *slot) abandon(w *waiter) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if w.granted {
+		return false
+	}
+	queue := s.queues[w.key]
+	for i, q := range queue {
+		if q != w {
+			continue
+		}
+		if len(queue) == 1 {
+			delete(s.queues, w.key)
+			for j, key := range s.keys {
+				if key == w.key {
+					s.keys = append(s.keys[:j], s.keys[j+1:]...)
+					break
+				}
+			}
+		} else {
+			s.queues[w.key] = append(queue[:i:i], queue[i+1:]...)
+		}
+		atomic.AddInt32(&s.waiting, -1)
+		break
+	}
+	return true
+}
+
+// release frees a slot held by key and hands free slots to waiters
+func (s *slot) release(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.current <= 0 {
+		return
+	}
+	atomic.AddInt32(&s.current, -1)
+	if s.held[key] > 1 {
+		s.held[key]--
+	} else {
+		delete(s.held, key)
+	}
+
+	for !s.closed && s.current < s.max && len(s.keys) > 0 {
+		w := s.next()
+		s.grant(w.key)
+		w.granted = true
+		close(w.ready)
 	}
-	s.cond = sync.NewCond(&s.mu)
-	return s
+}
+
+// close wakes all waiters without a slot
+func (s *slot) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	for _, queue := range s.queues {
+		for _, w := range queue {
+			close(w.ready)
+		}
+	}
+	s.queues = make(map[string][]*waiter)
+	s.keys = nil
+	atomic.StoreInt32(&s.waiting, 0)
 }
 
 // concurrencyManager implements Manager
@@ -135,7 +262,7 @@ func (m *concurrencyManager) AcquireUserSlot(ctx context.Context, userID string)
 	m.closeMu.RUnlock()
 
 	slot := m.getOrCreateUserSlot(userID)
-	return m.acquireSlot(ctx, slot, "user", userID)
+	return m.acquireSlot(ctx, slot, "user", userID, "")
 }
 
 // ReleaseUserSlot releases a user slot
@@ -145,12 +272,12 @@ func (m *concurrencyManager) ReleaseUserSlot(userID string) {
 	m.userMu.RUnlock()
 
 	if ok {
-		m.releaseSlot(slot)
+		slot.release("")
 	}
 }
 
-// AcquireAccountSlot acquires a slot for an account
-func (m *concurrencyManager) AcquireAccountSlot(ctx context.Context, accountID string) (*AcquireResult, error) {
+// AcquireAccountSlot acquires a slot for an account on behalf of a token
+func (m *concurrencyManager) AcquireAccountSlot(ctx context.Context, accountID, tokenID string) (*AcquireResult, error) {
 	m.closeMu.RLock()
 	if m.closed {
 		m.closeMu.RUnlock()
@@ -159,20 +286,29 @@ func (m *concurrencyManager) AcquireAccountSlot(ctx context.Context, accountID s
 	m.closeMu.RUnlock()
 
 	slot := m.getOrCreateAccountSlot(accountID)
-	return m.acquireSlot(ctx, slot, "account", accountID)
+	return m.acquireSlot(ctx, slot, "account", accountID, m.fairKey(tokenID))
 }
 
-// ReleaseAccountSlot releases an account slot
-func (m *concurrencyManager) ReleaseAccountSlot(accountID string) {
+// ReleaseAccountSlot releases an account slot acquired for tokenID
+func (m *concurrencyManager) ReleaseAccountSlot(accountID, tokenID string) {
 	m.accountMu.RLock()
 	slot, ok := m.accountSlots[accountID]
 	m.accountMu.RUnlock()
 
 	if ok {
-		m.releaseSlot(slot)
+		slot.release(m.fairKey(tokenID))
 	}
 }
 
+// fairKey returns the key account slot waiters are queued under; without fair
+// queuing all tokens share one first-come, first-served queue
+func (m *concurrencyManager) fairKey(tokenID string) string {
+	if !m.config.FairQueue {
+		return ""
+	}
+	return tokenID
+}
+
 // getOrCreateUserSlot gets or creates a user slot
 func (m *concurrencyManager) getOrCreateUserSlot(userID string) *slot {
 	m.userMu.RLock()
@@ -219,8 +355,9 @@ func (m *concurrencyManager) getOrCreateAccountSlot(accountID string) *slot {
 	return slot
 }
 
-// acquireSlot attempts to acquire a slot with backoff
-func (m *concurrencyManager) acquireSlot(ctx context.Context, s *slot, slotType, id string) (*AcquireResult, error) {
+// acquireSlot takes a slot for key, waiting in the slot's fair queue when all
+// are in use
+func (m *concurrencyManager) acquireSlot(ctx context.Context, s *slot, slotType, id, key string) (*AcquireResult, error) {
 	start := time.Now()
 	deadline, hasDeadline := ctx.Deadline()
 	if !hasDeadline {
@@ -228,12 +365,15 @@ func (m *concurrencyManager) acquireSlot(ctx context.Context, s *slot, slotType,
 	}
 
 	s.mu.Lock()
-	defer s.mu.Unlock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil, fmt.Errorf("manager closed")
+	}
 
-	// Try immediate acquire
-	if s.current < s.max {
-		s.current++
-		atomic.AddInt64(&s.total, 1)
+	// Try immediate acquire; a free slot is left to queued requests
+	if s.current < s.max && len(s.keys) == 0 {
+		s.grant(key)
+		s.mu.Unlock()
 		atomic.AddInt64(&m.totalAcquires, 1)
 		return &AcquireResult{
 			Acquired: true,
@@ -243,21 +383,22 @@ func (m *concurrencyManager) acquireSlot(ctx context.Context, s *slot, slotType,
 
 	// Check if queue is full
 	if int(s.waiting) >= m.config.MaxWaitQueue {
+		waiting := s.waiting
+		s.mu.Unlock()
 		log.Warn().
 			Str("type", slotType).
 			Str("id", id).
-			Int32("waiting", s.waiting).
+			Int32("waiting", waiting).
 			Msg("wait queue full")
 		return &AcquireResult{
 			Acquired: false,
-			QueuePos: int(s.waiting),
+			QueuePos: int(waiting),
 		}, fmt.Errorf("wait queue full")
 	}
 
-	// Wait with exponential backoff
-	s.waiting++
+	w := s.enqueue(key)
 	queuePos := int(s.waiting)
-	backoff := m.config.BackoffBase
+	s.mu.Unlock()
 
 	log.Debug().
 		Str("type", slotType).
@@ -265,83 +406,44 @@ func (m *concurrencyManager) acquireSlot(ctx context.Context, s *slot, slotType,
 		Int("queue_pos", queuePos).
 		Msg("waiting for slot")
 
-	for {
-		// Wait with timeout
-		waitCtx, cancel := context.WithTimeout(ctx, backoff)
-		done := make(chan struct{})
-
-		go func() {
-			s.cond.Wait()
-			close(done)
-		}()
-
-		select {
-		case <-done:
-			cancel()
-			// Woken up, try to acquire
-			if s.current < s.max {
-				s.current++
-				s.waiting--
-				atomic.AddInt64(&s.total, 1)
-				atomic.AddInt64(&m.totalAcquires, 1)
-				return &AcquireResult{
-					Acquired: true,
-					WaitTime: time.Since(start),
-				}, nil
-			}
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
 
-		case <-waitCtx.Done():
-			cancel()
-			// Timeout on this iteration, check deadline
-			if time.Now().After(deadline) {
-				s.waiting--
-				atomic.AddInt64(&m.totalTimeouts, 1)
-				log.Warn().
-					Str("type", slotType).
-					Str("id", id).
-					Dur("waited", time.Since(start)).
-					Msg("timeout waiting for slot")
-				return &AcquireResult{
-					Acquired: false,
-					WaitTime: time.Since(start),
-				}, fmt.Errorf("timeout waiting for %s slot", slotType)
-			}
-
-		case <-ctx.Done():
-			s.waiting--
+	var err error
+	select {
+	case <-w.ready:
+		if !w.granted {
 			return &AcquireResult{
 				Acquired: false,
 				WaitTime: time.Since(start),
-			}, ctx.Err()
+			}, fmt.Errorf("manager closed")
 		}
-
-		// Exponential backoff with jitter
-		backoff = m.nextBackoff(backoff)
-	}
-}
-
-// releaseSlot releases a slot and signals waiters
-func (m *concurrencyManager) releaseSlot(s *slot) {
-	s.mu.Lock()
-	if s.current > 0 {
-		s.current--
+	case <-timer.C:
+		err = fmt.Errorf("timeout waiting for %s slot", slotType)
+	case <-ctx.Done():
+		err = ctx.Err()
 	}
-	s.mu.Unlock()
-	s.cond.Signal()
-}
-
-// nextBackoff calculates the next backoff duration with jitter
-func (m *concurrencyManager) nextBackoff(current time.Duration) time.Duration {
-	next := time.Duration(float64(current) * 2)
-	if next > m.config.BackoffMax {
-		next = m.config.BackoffMax
+	// A slot handed over while giving up is kept
+	if err != nil && s.abandon(w) {
+		if ctx.Err() == nil {
+			atomic.AddInt64(&m.totalTimeouts, 1)
+			log.Warn().
+				Str("type", slotType).
+				Str("id", id).
+				Dur("waited", time.Since(start)).
+				Msg("timeout waiting for slot")
+		}
+		return &AcquireResult{
+			Acquired: false,
+			WaitTime: time.Since(start),
+		}, err
 	}
 
-	// Add jitter
-	jitter := time.Duration(float64(next) * m.config.BackoffJitter)
-	next = next - jitter + time.Duration(float64(jitter*2)*0.5) // Simplified random-ish jitter
-
-	return next
+	atomic.AddInt64(&m.totalAcquires, 1)
+	return &AcquireResult{
+		Acquired: true,
+		WaitTime: time.Since(start),
+	}, nil
 }
 
 // GetUserLoad returns load info for a user
@@ -459,13 +561,13 @@ func (m *concurrencyManager) Close() {
 	// Wake up all waiters
 	m.userMu.Lock()
 	for _, s := range m.userSlots {
-		s.cond.Broadcast()
+		s.close()
 	}
 	m.userMu.Unlock()
 
 	m.accountMu.Lock()
 	for _, s := range m.accountSlots {
-		s.cond.Broadcast()
+		s.close()
 	}
 	m.accountMu.Unlock()
 
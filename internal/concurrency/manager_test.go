@@ -0,0 +1,158 @@
+package concurrency
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// queueAccount starts a request for tokenID that waits for an account slot and
+// reports the token on got once it holds one. It returns after the request is
+// queued.
+func queueAccount(t *testing.T, m Manager, accountID, tokenID string, got chan<- string) {
+	t.Helper()
+	before := m.GetAccountLoad([]string{accountID})[accountID].Waiting
+	go func() {
+		if _, err := m.AcquireAccountSlot(context.Background(), accountID, tokenID); err != nil {
+			got <- "error: " + err.Error()
+			return
+		}
+		got <- tokenID
+	}()
+	deadline := time.Now().Add(time.Second)
+	for m.GetAccountLoad([]string{accountID})[accountID].Waiting == before {
+		if time.Now().After(deadline) {
+			t.Fatalf("%s was not queued", tokenID)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func expectGrant(t *testing.T, got <-chan string, want string) {
+	t.Helper()
+	select {
+	case tok := <-got:
+		if tok != want {
+			t.Fatalf("slot went to %s, want %s", tok, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("no slot handed out, want %s", want)
+	}
+}
+
+func newTestManager(accountMax int, fair bool) Manager {
+	cfg := DefaultConcurrencyConfig()
+	cfg.AccountMax = accountMax
+	cfg.FairQueue = fair
+	return NewManager(cfg)
+}
+
+func TestManager_FairQueue(t *testing.T) {
+	m := newTestManager(2, true)
+	defer m.Close()
+	ctx := context.Background()
+
+	// A busy token holds every slot and queues more requests before another
+	// token arrives
+	for i := 0; i < 2; i++ {
+		if _, err := m.AcquireAccountSlot(ctx, "acc", "tok-busy"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got := make(chan string, 4)
+	queueAccount(t, m, "acc", "tok-busy", got)
+	queueAccount(t, m, "acc", "tok-busy", got)
+	queueAccount(t, m, "acc", "tok-quiet", got)
+
+	// The token holding no slots goes first
+	m.ReleaseAccountSlot("acc", "tok-busy")
+	expectGrant(t, got, "tok-quiet")
+	m.ReleaseAccountSlot("acc", "tok-busy")
+	expectGrant(t, got, "tok-busy")
+	m.ReleaseAccountSlot("acc", "tok-quiet")
+	expectGrant(t, got, "tok-busy")
+
+	if load := m.GetAccountLoad([]string{"acc"})["acc"]; load.Current != 2 || load.Waiting != 0 {
+		t.Errorf("load = %+v", load)
+	}
+}
+
+func TestManager_FairQueueTakesTurns(t *testing.T) {
+	m := newTestManager(1, true)
+	defer m.Close()
+
+	if _, err := m.AcquireAccountSlot(context.Background(), "acc", "tok-a"); err != nil {
+		t.Fatal(err)
+	}
+	got := make(chan string, 3)
+	queueAccount(t, m, "acc", "tok-b", got)
+	queueAccount(t, m, "acc", "tok-b", got)
+	queueAccount(t, m, "acc", "tok-c", got)
+
+	// tok-b and tok-c hold nothing, so they alternate
+	m.ReleaseAccountSlot("acc", "tok-a")
+	expectGrant(t, got, "tok-b")
+	m.ReleaseAccountSlot("acc", "tok-b")
+	expectGrant(t, got, "tok-c")
+	m.ReleaseAccountSlot("acc", "tok-c")
+	expectGrant(t, got, "tok-b")
+}
+
+func TestManager_FirstComeFirstServedWithoutFairQueue(t *testing.T) {
+	m := newTestManager(1, false)
+	defer m.Close()
+
+	if _, err := m.AcquireAccountSlot(context.Background(), "acc", "tok-busy"); err != nil {
+		t.Fatal(err)
+	}
+	got := make(chan string, 2)
+	queueAccount(t, m, "acc", "tok-busy", got)
+	queueAccount(t, m, "acc", "tok-quiet", got)
+
+	m.ReleaseAccountSlot("acc", "tok-busy")
+	expectGrant(t, got, "tok-busy")
+}
+
+func TestManager_WaitTimeout(t *testing.T) {
+	cfg := DefaultConcurrencyConfig()
+	cfg.UserMax = 1
+	cfg.WaitTimeout = 20 * time.Millisecond
+	m := NewManager(cfg)
+	defer m.Close()
+
+	if _, err := m.AcquireUserSlot(context.Background(), "tok-1"); err != nil {
+		t.Fatal(err)
+	}
+	result, err := m.AcquireUserSlot(context.Background(), "tok-1")
+	if err == nil || result.Acquired {
+		t.Fatalf("acquired past the limit: %+v", result)
+	}
+	if load := m.GetUserLoad("tok-1"); load.Current != 1 || load.Waiting != 0 {
+		t.Errorf("load after timeout = %+v", load)
+	}
+	if stats := m.Stats(); stats.TotalTimeouts != 1 {
+		t.Errorf("timeouts = %d", stats.TotalTimeouts)
+	}
+
+	// A cancelled request leaves the queue without counting as a timeout
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := m.AcquireUserSlot(ctx, "tok-1"); err != context.Canceled {
+		t.Errorf("cancelled: err = %v", err)
+	}
+	if stats := m.Stats(); stats.TotalTimeouts != 1 || m.GetUserLoad("tok-1").Waiting != 0 {
+		t.Errorf("after cancel: %+v", stats)
+	}
+}
+
+func TestManager_CloseWakesWaiters(t *testing.T) {
+	m := newTestManager(1, true)
+
+	if _, err := m.AcquireAccountSlot(context.Background(), "acc", "tok-1"); err != nil {
+		t.Fatal(err)
+	}
+	got := make(chan string, 1)
+	queueAccount(t, m, "acc", "tok-2", got)
+	m.Close()
+	expectGrant(t, got, "error: manager closed")
+}
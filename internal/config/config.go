@@ -1,6 +1,8 @@
 package config
 
 import (
+	"context"
+	"fmt"
 	"strings"
 	"time"
 
@@ -21,6 +23,26 @@ type Config struct {
 	Health      HealthConfig      `mapstructure:"health"`
 	Scheduler   SchedulerConfig   `mapstructure:"scheduler"`
 	Metrics     MetricsConfig     `mapstructure:"metrics"`
+	Logging     LoggingConfig     `mapstructure:"logging"`
+	CountTokens CountTokensConfig `mapstructure:"count_tokens"`
+	Status      StatusConfig      `mapstructure:"status"`
+	Notify      NotifyConfig      `mapstructure:"notify"`
+	Mirror      MirrorConfig      `mapstructure:"mirror"`
+	Canary      CanaryConfig      `mapstructure:"canary"`
+	SLO         SLOConfig         `mapstructure:"slo"`
+	Shedding    SheddingConfig    `mapstructure:"shedding"`
+	Tracing     TracingConfig     `mapstructure:"tracing"`
+	Beta        BetaConfig        `mapstructure:"beta"`
+	Bootstrap   BootstrapConfig   `mapstructure:"bootstrap"`
+	Jobs        JobsConfig        `mapstructure:"jobs"`
+	Pipelines   PipelinesConfig   `mapstructure:"pipelines"`
+	// FeatureFlags rolls out experimental behaviors, keyed by flag name
+	FeatureFlags map[string]FeatureFlagConfig `mapstructure:"feature_flags"`
+
+	// secretRefs holds the secret references resolved by ResolveSecrets
+	secretRefs *secretRefs
+	// parseIssues holds the values Load could not parse, reported by SelfCheck
+	parseIssues []Issue
 }
 
 type ServerConfig struct {
@@ -29,12 +51,77 @@ type ServerConfig struct {
 	Mode         string `mapstructure:"mode"` // "web", "api", or "both"
 	ReadTimeout  int    `mapstructure:"read_timeout"`
 	WriteTimeout int    `mapstructure:"write_timeout"`
+	// TrustedProxies lists proxy IPs/CIDRs whose X-Forwarded-For is honored; empty trusts none
+	TrustedProxies []string `mapstructure:"trusted_proxies"`
+	// ClientIPHeader, if set, is read for the client IP (e.g. "CF-Connecting-IP"); only use behind that proxy
+	ClientIPHeader string `mapstructure:"client_ip_header"`
+	// HTTP2 serves cleartext HTTP/2 (h2c) alongside HTTP/1.1
+	HTTP2 HTTP2Config `mapstructure:"http2"`
+	// SSE tunes how streamed responses are written to clients
+	SSE SSEConfig `mapstructure:"sse"`
+	// TLS terminates HTTPS in ccproxy, optionally authenticating clients by certificate
+	TLS TLSConfig `mapstructure:"tls"`
+	// HTTPCache adds ETag and Cache-Control headers to read-only responses
+	HTTPCache HTTPCacheConfig `mapstructure:"http_cache"`
+}
+
+// HTTPCacheConfig lets clients revalidate /v1/models, the account list and
+// usage stats with If-None-Match instead of refetching them
+type HTTPCacheConfig struct {
+	Enabled      bool          `mapstructure:"enabled"`
+	ModelsMaxAge time.Duration `mapstructure:"models_max_age"` // How long /v1/models may be reused without revalidating
+	StatsMaxAge  time.Duration `mapstructure:"stats_max_age"`  // Same for stats of ranges ending before yesterday
+}
+
+// HTTP2Config enables h2c for load balancers that speak HTTP/2 to backends.
+// h2c also accepts HTTP/1.1 "Upgrade: h2c" requests, which a fronting proxy
+// may tunnel past its own path rules, so it is off by default.
+type HTTP2Config struct {
+	Enabled              bool          `mapstructure:"enabled"`
+	MaxConcurrentStreams uint32        `mapstructure:"max_concurrent_streams"`
+	IdleTimeout          time.Duration `mapstructure:"idle_timeout"` // Closes h2c connections without open streams; read/write timeouts do not cover them
+}
+
+// SSEConfig coalesces stream flushes. With a zero flush interval every event
+// is flushed as soon as it is written.
+type SSEConfig struct {
+	FlushInterval   time.Duration `mapstructure:"flush_interval"`
+	WriteBufferSize int           `mapstructure:"write_buffer_size"` // Bytes held between flushes before writing through
+}
+
+// TLSConfig serves HTTPS. With a client CA bundle, /v1 and user API requests
+// without a bearer token can authenticate with a client certificate whose CN or
+// a SAN is mapped to a token.
+type TLSConfig struct {
+	Enabled       bool   `mapstructure:"enabled"`
+	CertFile      string `mapstructure:"cert_file"`
+	KeyFile       string `mapstructure:"key_file"`
+	ClientCAFile  string `mapstructure:"client_ca_file"`  // PEM bundle of CAs issuing client certificates; empty disables client certificates
+	ClientCRLFile string `mapstructure:"client_crl_file"` // PEM or DER revocation list, re-read when it changes
+	ClientAuth    string `mapstructure:"client_auth"`     // "optional" or "require"
 }
 
 type JWTConfig struct {
-	Secret        string        `mapstructure:"secret"`
-	DefaultExpiry time.Duration `mapstructure:"default_expiry"`
-	Issuer        string        `mapstructure:"issuer"`
+	Secret string `mapstructure:"secret"`
+	// VerificationSecrets are previous secrets still accepted for tokens
+	// signed before a rotation; they never sign new tokens
+	VerificationSecrets []string      `mapstructure:"verification_secrets"`
+	DefaultExpiry       time.Duration `mapstructure:"default_expiry"`
+	Issuer              string        `mapstructure:"issuer"`
+	// ExternalIssuers are identity providers whose JWTs authenticate as the
+	// tokens mapped to their subjects, alongside ccproxy's own tokens
+	ExternalIssuers []ExternalJWTIssuer `mapstructure:"external_issuers"`
+}
+
+// ExternalJWTIssuer accepts JWTs signed by an external identity provider.
+// A token authenticates as the ccproxy token whose external_subject is
+// "<name>:<subject claim>".
+type ExternalJWTIssuer struct {
+	Name         string   `mapstructure:"name"`
+	Issuer       string   `mapstructure:"issuer"`    // Expected iss claim
+	Audiences    []string `mapstructure:"audiences"` // The aud claim must contain one of these
+	JWKSURL      string   `mapstructure:"jwks_url"`
+	SubjectClaim string   `mapstructure:"subject_claim"` // Default "sub"
 }
 
 type ClaudeConfig struct {
@@ -42,14 +129,68 @@ type ClaudeConfig struct {
 	APIURL      string   `mapstructure:"api_url"`
 	WebURL      string   `mapstructure:"web_url"`
 	KeyStrategy string   `mapstructure:"key_strategy"` // "round_robin" or "random"
+	// AdminAPIKey is an Anthropic Admin API key (sk-ant-admin...) used to look
+	// up the workspace of api_key accounts; optional
+	AdminAPIKey string `mapstructure:"admin_api_key"`
+	// WebPromptLimit is the web mode prompt length, in characters, above which
+	// earlier messages are sent as a text attachment; 0 disables
+	WebPromptLimit int `mapstructure:"web_prompt_limit"`
+	// DefaultModel is used when a request names no model and its token has
+	// no default model; "" rejects such requests
+	DefaultModel string `mapstructure:"default_model"`
+	// ConversationCleanup deletes the claude.ai conversations web mode creates
+	ConversationCleanup ConversationCleanupConfig `mapstructure:"conversation_cleanup"`
+}
+
+// ConversationCleanupConfig configures the deletion of the claude.ai
+// conversations created for web mode requests
+type ConversationCleanupConfig struct {
+	Enabled     bool          `mapstructure:"enabled"`
+	Retention   time.Duration `mapstructure:"retention"`    // How long after its creation a conversation is deleted
+	Interval    time.Duration `mapstructure:"interval"`     // How often due conversations are deleted
+	BatchSize   int           `mapstructure:"batch_size"`   // Conversations deleted per run
+	MaxAttempts int           `mapstructure:"max_attempts"` // Failed deletions before a conversation is left alone
 }
 
 type AdminConfig struct {
-	Key string `mapstructure:"key"`
+	Key  string     `mapstructure:"key"`
+	OIDC OIDCConfig `mapstructure:"oidc"`
+}
+
+// OIDCConfig enables admin sign-in through an OpenID Connect provider
+// (authorization code flow). The admin key keeps working alongside it.
+type OIDCConfig struct {
+	Enabled           bool              `mapstructure:"enabled"`
+	IssuerURL         string            `mapstructure:"issuer_url"`
+	ClientID          string            `mapstructure:"client_id"`
+	ClientSecret      string            `mapstructure:"client_secret"`
+	RedirectURL       string            `mapstructure:"redirect_url"` // https://ccproxy.example.com/api/auth/oidc/callback
+	Scopes            []string          `mapstructure:"scopes"`
+	GroupsClaim       string            `mapstructure:"groups_claim"`  // Dotted paths like "realm_access.roles" are supported
+	RoleMappings      []OIDCRoleMapping `mapstructure:"role_mappings"` // First matching group wins
+	DefaultRole       string            `mapstructure:"default_role"`  // Role when no group matches; empty denies
+	SessionTTL        time.Duration     `mapstructure:"session_ttl"`
+	PostLoginRedirect string            `mapstructure:"post_login_redirect"`
+}
+
+// OIDCRoleMapping maps an IdP group to an admin role ("admin" or "viewer")
+type OIDCRoleMapping struct {
+	Group string `mapstructure:"group"`
+	Role  string `mapstructure:"role"`
 }
 
 type StorageConfig struct {
 	DBPath string `mapstructure:"db_path"`
+	// ReadPool serves stats, log and conversation queries from separate read-only connections
+	ReadPool ReadPoolConfig `mapstructure:"read_pool"`
+}
+
+// ReadPoolConfig configures the read-only database connections used by
+// reporting queries. Path may point to a read replica; empty reads db_path.
+type ReadPoolConfig struct {
+	Enabled  bool   `mapstructure:"enabled"`
+	Path     string `mapstructure:"path"`
+	MaxConns int    `mapstructure:"max_conns"`
 }
 
 // PoolConfig holds connection pool configuration
@@ -60,6 +201,21 @@ type PoolConfig struct {
 	MaxClients          int           `mapstructure:"max_clients"`
 	ClientIdleTTL       time.Duration `mapstructure:"client_idle_ttl"`
 	ResponseTimeout     time.Duration `mapstructure:"response_timeout"`
+	// Fingerprint varies the TLS fingerprint of each account's connections
+	Fingerprint TLSFingerprintConfig `mapstructure:"fingerprint"`
+}
+
+// TLSFingerprintProfiles are the browser TLS fingerprints upstream
+// connections can present
+var TLSFingerprintProfiles = []string{"chrome_102", "chrome_106", "chrome_120", "firefox_105", "firefox_120", "safari_16"}
+
+// TLSFingerprintConfig assigns each account a browser TLS fingerprint (JA3)
+// that rotates on a schedule, so accounts do not share one fingerprint
+type TLSFingerprintConfig struct {
+	Enabled        bool              `mapstructure:"enabled"`
+	Profiles       []string          `mapstructure:"profiles"`        // Profiles accounts rotate through
+	RotateInterval time.Duration     `mapstructure:"rotate_interval"` // How long an account keeps a profile; 0 never rotates
+	Accounts       map[string]string `mapstructure:"accounts"`        // Account ID -> profile it always uses
 }
 
 // CircuitConfig holds circuit breaker configuration
@@ -80,6 +236,7 @@ type ConcurrencyConfig struct {
 	BackoffMax    time.Duration `mapstructure:"backoff_max"`
 	BackoffJitter float64       `mapstructure:"backoff_jitter"`
 	PingInterval  time.Duration `mapstructure:"ping_interval"`
+	FairQueue     bool          `mapstructure:"fair_queue"`
 }
 
 // RateLimitConfig holds rate limiting configuration
@@ -89,6 +246,12 @@ type RateLimitConfig struct {
 	AccountLimit LimitRule `mapstructure:"account_limit"`
 	IPLimit      LimitRule `mapstructure:"ip_limit"`
 	GlobalLimit  LimitRule `mapstructure:"global_limit"`
+	EndUserLimit LimitRule `mapstructure:"end_user_limit"` // Per end user of a token, 0 requests = disabled
+	// IPPrefixLimit is shared by all addresses in an IPv4 /IPv4Prefix or
+	// IPv6 /IPv6Prefix network, so rotating addresses does not evade IPLimit
+	IPPrefixLimit LimitRule `mapstructure:"ip_prefix_limit"`
+	IPv4Prefix    int       `mapstructure:"ipv4_prefix"`
+	IPv6Prefix    int       `mapstructure:"ipv6_prefix"`
 }
 
 // LimitRule defines a rate limit rule
@@ -104,6 +267,9 @@ type RetryConfig struct {
 	InitialBackoff     time.Duration `mapstructure:"initial_backoff"`
 	MaxBackoff         time.Duration `mapstructure:"max_backoff"`
 	Jitter             float64       `mapstructure:"jitter"`
+	// TelemetryHeaders reports attempts, account switches and the hashed
+	// account in X-CCProxy-* response headers and OpenAI system_fingerprint
+	TelemetryHeaders bool `mapstructure:"telemetry_headers"`
 }
 
 // HealthConfig holds health monitor configuration
@@ -112,6 +278,9 @@ type HealthConfig struct {
 	CheckInterval      time.Duration `mapstructure:"check_interval"`
 	TokenRefreshBefore time.Duration `mapstructure:"token_refresh_before"`
 	Timeout            time.Duration `mapstructure:"timeout"`
+	// PrewarmConcurrency bounds the startup token refreshes, 0 disables them
+	PrewarmConcurrency int           `mapstructure:"prewarm_concurrency"`
+	PrewarmTimeout     time.Duration `mapstructure:"prewarm_timeout"`
 }
 
 // SchedulerConfig holds scheduler configuration
@@ -124,6 +293,253 @@ type SchedulerConfig struct {
 type MetricsConfig struct {
 	Enabled bool   `mapstructure:"enabled"`
 	Path    string `mapstructure:"path"`
+	Pprof   bool   `mapstructure:"pprof"` // Serve net/http/pprof at /api/debug/pprof to admins
+	// UpstreamSamples keeps the latest upstream exchanges of each account for admins
+	UpstreamSamples UpstreamSamplesConfig `mapstructure:"upstream_samples"`
+}
+
+// UpstreamSamplesConfig sizes the per-account ring buffers of upstream
+// exchanges served at /api/debug/upstream/:account_id
+type UpstreamSamplesConfig struct {
+	Enabled      bool `mapstructure:"enabled"`
+	PerAccount   int  `mapstructure:"per_account"`    // Exchanges kept per account
+	MaxBodyBytes int  `mapstructure:"max_body_bytes"` // Bytes kept of each request and response body
+}
+
+// LoggingConfig holds request log pipeline configuration
+type LoggingConfig struct {
+	Enrichers   []string              `mapstructure:"enrichers"` // "cost", "geo", "client"
+	Pricing     []ModelPriceConfig    `mapstructure:"pricing"`
+	GeoIP       []GeoIPRangeConfig    `mapstructure:"geoip"`
+	Sampling    LogSamplingConfig     `mapstructure:"sampling"`
+	Compression LogCompressionConfig  `mapstructure:"compression"`
+	ConvCap     ConversationCapConfig `mapstructure:"conversation_cap"`
+}
+
+// ConversationCapConfig bounds the stored size of captured conversations
+type ConversationCapConfig struct {
+	MaxBytes    int     `mapstructure:"max_bytes"`    // 0 disables
+	HeadPercent float64 `mapstructure:"head_percent"` // Share of truncated contents kept from the start
+}
+
+// LogCompressionConfig controls compression of stored conversation contents
+type LogCompressionConfig struct {
+	Algorithm string        `mapstructure:"algorithm"` // "gzip" or "zstd"
+	Age       time.Duration `mapstructure:"age"`       // Compress conversations older than this
+}
+
+// LogSamplingConfig controls request log sampling under high load
+type LogSamplingConfig struct {
+	Enabled        bool          `mapstructure:"enabled"`
+	SuccessPercent float64       `mapstructure:"success_percent"` // 0-100
+	SlowThreshold  time.Duration `mapstructure:"slow_threshold"`  // Always log requests slower than this
+}
+
+// ModelPriceConfig overrides the price of a model family (USD per million tokens)
+type ModelPriceConfig struct {
+	Model  string  `mapstructure:"model"`
+	Input  float64 `mapstructure:"input"`
+	Output float64 `mapstructure:"output"`
+}
+
+// GeoIPRangeConfig maps a CIDR block to a country code
+type GeoIPRangeConfig struct {
+	CIDR    string `mapstructure:"cidr"`
+	Country string `mapstructure:"country"`
+}
+
+// StatusConfig holds status page configuration
+type StatusConfig struct {
+	Enabled     bool `mapstructure:"enabled"`
+	RequireAuth bool `mapstructure:"require_auth"` // Require the admin key for /status
+}
+
+// CountTokensConfig holds count_tokens response cache configuration
+type CountTokensConfig struct {
+	CacheEnabled    bool          `mapstructure:"cache_enabled"`
+	CacheMaxEntries int           `mapstructure:"cache_max_entries"`
+	CacheTTL        time.Duration `mapstructure:"cache_ttl"`
+}
+
+// NotifyConfig holds event notification configuration
+type NotifyConfig struct {
+	WebhookURL string        `mapstructure:"webhook_url"` // POST JSON events here; empty disables
+	Timeout    time.Duration `mapstructure:"timeout"`
+	// Channels deliver events to email, Slack, Telegram or webhooks, each with its own routing rules
+	Channels []NotifyChannelConfig `mapstructure:"channels"`
+}
+
+// NotifyChannelConfig is a notification channel and the events routed to it
+type NotifyChannelConfig struct {
+	Name        string   `mapstructure:"name"`         // Unique, used by the test-send endpoint
+	Type        string   `mapstructure:"type"`         // "webhook", "slack", "telegram" or "smtp"
+	Events      []string `mapstructure:"events"`       // Event types or prefixes like "account.*"; empty sends all
+	MinSeverity string   `mapstructure:"min_severity"` // "info", "warning" or "critical"; empty sends all
+
+	URL string `mapstructure:"url"` // Webhook or Slack incoming webhook URL
+
+	BotToken    string `mapstructure:"bot_token"` // Telegram bot token
+	ChatID      string `mapstructure:"chat_id"`
+	TelegramAPI string `mapstructure:"telegram_api"` // Bot API base URL; empty uses api.telegram.org
+
+	SMTP NotifySMTPConfig `mapstructure:"smtp"`
+}
+
+// NotifySMTPConfig is the relay and recipients of an email channel
+type NotifySMTPConfig struct {
+	Host     string   `mapstructure:"host"`
+	Port     int      `mapstructure:"port"` // 465 uses implicit TLS, others STARTTLS when offered; 0 = 587
+	Username string   `mapstructure:"username"`
+	Password string   `mapstructure:"password"`
+	From     string   `mapstructure:"from"`
+	To       []string `mapstructure:"to"`
+}
+
+// MirrorConfig holds request mirroring configuration. A sample of /v1/messages
+// requests is replayed against a secondary Anthropic-compatible upstream and
+// both responses are stored for offline comparison.
+type MirrorConfig struct {
+	Enabled      bool          `mapstructure:"enabled"`
+	Percent      float64       `mapstructure:"percent"`      // Share of requests mirrored, 0-100
+	UpstreamURL  string        `mapstructure:"upstream_url"` // Base URL; /v1/messages is appended
+	APIKey       string        `mapstructure:"api_key"`
+	Model        string        `mapstructure:"model"` // Overrides the request model; empty keeps it
+	Timeout      time.Duration `mapstructure:"timeout"`
+	Workers      int           `mapstructure:"workers"`
+	QueueSize    int           `mapstructure:"queue_size"`
+	MaxBodyBytes int           `mapstructure:"max_body_bytes"` // Stored request/response bodies are truncated to this size
+}
+
+// CanaryConfig holds synthetic canary requests, sent periodically through the
+// full proxy path to catch breakage before users do
+type CanaryConfig struct {
+	Enabled          bool          `mapstructure:"enabled"`
+	Interval         time.Duration `mapstructure:"interval"`
+	Modes            []string      `mapstructure:"modes"` // "api" and/or "web"; empty follows server.mode
+	Model            string        `mapstructure:"model"`
+	Timeout          time.Duration `mapstructure:"timeout"`
+	MaxLatency       time.Duration `mapstructure:"max_latency"`       // Slower canaries count as failed
+	FailureThreshold int           `mapstructure:"failure_threshold"` // Consecutive failures before alerting
+}
+
+// SLOConfig defines service level objectives tracked from request logs, with
+// alerts when the error budget burns too fast
+type SLOConfig struct {
+	Enabled        bool          `mapstructure:"enabled"`
+	Window         time.Duration `mapstructure:"window"`          // Rolling window the error budget covers
+	Availability   float64       `mapstructure:"availability"`    // Percent of requests without a server-side error
+	LatencyTarget  time.Duration `mapstructure:"latency_target"`  // Time to first token for streams, total duration otherwise
+	LatencyPercent float64       `mapstructure:"latency_percent"` // Percent of successful requests meeting latency_target, 0 = not tracked
+	CheckInterval  time.Duration `mapstructure:"check_interval"`
+	FastBurnWindow time.Duration `mapstructure:"fast_burn_window"`
+	FastBurnRate   float64       `mapstructure:"fast_burn_rate"` // Critical alert at this burn rate, 0 = disabled
+	SlowBurnWindow time.Duration `mapstructure:"slow_burn_window"`
+	SlowBurnRate   float64       `mapstructure:"slow_burn_rate"` // Warning alert at this burn rate, 0 = disabled
+}
+
+// SheddingConfig rejects requests by token priority while the process is
+// under memory or goroutine pressure. A zero threshold disables that signal.
+type SheddingConfig struct {
+	Enabled        bool          `mapstructure:"enabled"`
+	CheckInterval  time.Duration `mapstructure:"check_interval"`
+	MemorySoftMB   int           `mapstructure:"memory_soft_mb"`  // Resident memory at which low priority requests are shed
+	MemoryHardMB   int           `mapstructure:"memory_hard_mb"`  // Resident memory at which normal priority requests are shed too
+	GoroutinesSoft int           `mapstructure:"goroutines_soft"` // Goroutine count at which low priority requests are shed
+	GoroutinesHard int           `mapstructure:"goroutines_hard"` // Goroutine count at which normal priority requests are shed too
+	RetryAfter     time.Duration `mapstructure:"retry_after"`     // Sent to shed clients in Retry-After
+}
+
+// JobsConfig sizes the background job queue behind /api/jobs
+type JobsConfig struct {
+	Workers      int           `mapstructure:"workers"`       // Jobs run at once
+	PollInterval time.Duration `mapstructure:"poll_interval"` // How often due jobs and retries are picked up
+	Retention    time.Duration `mapstructure:"retention"`     // How long finished jobs are kept
+}
+
+// PipelinesConfig selects the stages of the proxy pipeline behind each
+// completion route
+type PipelinesConfig struct {
+	ChatCompletions PipelineConfig `mapstructure:"chat_completions"` // /v1/chat/completions
+	Messages        PipelineConfig `mapstructure:"messages"`         // /v1/messages
+}
+
+// PipelineConfig selects which stages of the proxy pipeline run
+type PipelineConfig struct {
+	Scheduler bool `mapstructure:"scheduler"` // Sticky sessions, pins and load-aware selection
+	Circuit   bool `mapstructure:"circuit"`   // Skip and record failing accounts
+	Retry     bool `mapstructure:"retry"`     // Retry on another account
+}
+
+// TracingConfig controls W3C trace context headers on upstream Anthropic API
+// requests. Accounts can override SamplePercent through the admin API.
+type TracingConfig struct {
+	Propagate     bool    `mapstructure:"propagate"`      // Forward client traceparent/tracestate upstream
+	SamplePercent float64 `mapstructure:"sample_percent"` // Start a trace for this share of requests without one, 0-100
+}
+
+// BetaConfig holds the anthropic-beta header profiles sent upstream. Headers
+// are comma-separated flag lists; clients that send their own header keep it.
+type BetaConfig struct {
+	Default  string            `mapstructure:"default"`  // OAuth requests for non-Haiku models
+	Haiku    string            `mapstructure:"haiku"`    // OAuth requests for Haiku models
+	APIKey   string            `mapstructure:"api_key"`  // API key requests
+	OAuth    string            `mapstructure:"oauth"`    // Flag added to client headers on OAuth requests
+	Accounts map[string]string `mapstructure:"accounts"` // Account ID -> header replacing the profile
+}
+
+// FeatureFlagConfig sets the rollout of one feature flag. Tokens allowed to
+// override flags can still switch it per request with X-CCProxy-Flags.
+type FeatureFlagConfig struct {
+	Enabled bool    `mapstructure:"enabled"`
+	Percent float64 `mapstructure:"percent"` // Share of tokens the flag is on for, 0-100
+}
+
+// BootstrapConfig declares API tokens that are created at startup, so a fresh
+// deployment can serve requests without minting a token through the admin API
+type BootstrapConfig struct {
+	// Tokens are "id[:mode[:expiry]]" specs, e.g. "ci:both:8760h"; mode
+	// defaults to both and expiry to jwt.default_expiry
+	Tokens []string `mapstructure:"tokens"`
+	// TokenDir receives each signed token as <id>.token; empty logs them
+	TokenDir string `mapstructure:"token_dir"`
+}
+
+// BootstrapToken is a parsed bootstrap token spec
+type BootstrapToken struct {
+	ID     string
+	Mode   string
+	Expiry time.Duration // 0 = jwt.default_expiry
+}
+
+// ParseBootstrapToken parses an "id[:mode[:expiry]]" bootstrap token spec
+func ParseBootstrapToken(spec string) (BootstrapToken, error) {
+	parts := strings.Split(strings.TrimSpace(spec), ":")
+	if len(parts) > 3 {
+		return BootstrapToken{}, fmt.Errorf("%q has too many fields, expected id[:mode[:expiry]]", spec)
+	}
+	token := BootstrapToken{ID: parts[0], Mode: "both"}
+	if token.ID == "" {
+		return BootstrapToken{}, fmt.Errorf("%q has no id, expected id[:mode[:expiry]]", spec)
+	}
+	for _, r := range token.ID {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.') {
+			return BootstrapToken{}, fmt.Errorf("id %q may only contain letters, digits, '-', '_' and '.'", token.ID)
+		}
+	}
+	if len(parts) > 1 && parts[1] != "" {
+		token.Mode = parts[1]
+	}
+	if token.Mode != "web" && token.Mode != "api" && token.Mode != "both" {
+		return BootstrapToken{}, fmt.Errorf("token %q has unknown mode %q, expected web, api or both", token.ID, token.Mode)
+	}
+	if len(parts) > 2 && parts[2] != "" {
+		d, err := time.ParseDuration(parts[2])
+		if err != nil || d <= 0 {
+			return BootstrapToken{}, fmt.Errorf("token %q has invalid expiry %q, expected %s", token.ID, parts[2], durationFormat)
+		}
+		token.Expiry = d
+	}
+	return token, nil
 }
 
 var cfg *Config
@@ -140,18 +556,54 @@ func Load() (*Config, error) {
 	viper.SetDefault("server.mode", "both")
 	viper.SetDefault("server.read_timeout", 30)
 	viper.SetDefault("server.write_timeout", 300)
+	viper.SetDefault("server.trusted_proxies", []string{"127.0.0.1", "::1"})
+	viper.SetDefault("server.client_ip_header", "")
+	viper.SetDefault("server.http2.enabled", false)
+	viper.SetDefault("server.http2.max_concurrent_streams", 250)
+	viper.SetDefault("server.http2.idle_timeout", "120s")
+	viper.SetDefault("server.sse.flush_interval", "0s")
+	viper.SetDefault("server.sse.write_buffer_size", 32768)
+	viper.SetDefault("server.http_cache.enabled", true)
+	viper.SetDefault("server.http_cache.models_max_age", "5m")
+	viper.SetDefault("server.http_cache.stats_max_age", "1h")
+	viper.SetDefault("server.tls.enabled", false)
+	viper.SetDefault("server.tls.cert_file", "")
+	viper.SetDefault("server.tls.key_file", "")
+	viper.SetDefault("server.tls.client_ca_file", "")
+	viper.SetDefault("server.tls.client_crl_file", "")
+	viper.SetDefault("server.tls.client_auth", "optional")
 
 	// Set defaults - JWT
 	viper.SetDefault("jwt.default_expiry", "720h")
 	viper.SetDefault("jwt.issuer", "ccproxy")
+	viper.SetDefault("jwt.verification_secrets", []string{})
 
 	// Set defaults - Claude
 	viper.SetDefault("claude.api_url", "https://api.anthropic.com")
 	viper.SetDefault("claude.web_url", "https://claude.ai")
 	viper.SetDefault("claude.key_strategy", "round_robin")
+	viper.SetDefault("claude.admin_api_key", "")
+	viper.SetDefault("claude.web_prompt_limit", 50000)
+	viper.SetDefault("claude.default_model", "")
+	viper.SetDefault("claude.conversation_cleanup.enabled", false)
+	viper.SetDefault("claude.conversation_cleanup.retention", "1h")
+	viper.SetDefault("claude.conversation_cleanup.interval", "1m")
+	viper.SetDefault("claude.conversation_cleanup.batch_size", 50)
+	viper.SetDefault("claude.conversation_cleanup.max_attempts", 5)
+
+	// Set defaults - Admin SSO
+	viper.SetDefault("admin.oidc.enabled", false)
+	viper.SetDefault("admin.oidc.scopes", []string{"openid", "profile", "email"})
+	viper.SetDefault("admin.oidc.groups_claim", "groups")
+	viper.SetDefault("admin.oidc.default_role", "")
+	viper.SetDefault("admin.oidc.session_ttl", "8h")
+	viper.SetDefault("admin.oidc.post_login_redirect", "/admin/")
 
 	// Set defaults - Storage
 	viper.SetDefault("storage.db_path", "./ccproxy.db")
+	viper.SetDefault("storage.read_pool.enabled", false)
+	viper.SetDefault("storage.read_pool.path", "")
+	viper.SetDefault("storage.read_pool.max_conns", 4)
 
 	// Set defaults - Pool
 	viper.SetDefault("pool.max_idle_conns", 240)
@@ -160,6 +612,9 @@ func Load() (*Config, error) {
 	viper.SetDefault("pool.max_clients", 5000)
 	viper.SetDefault("pool.client_idle_ttl", "15m")
 	viper.SetDefault("pool.response_timeout", "10m")
+	viper.SetDefault("pool.fingerprint.enabled", false)
+	viper.SetDefault("pool.fingerprint.profiles", []string{"chrome_120", "chrome_106", "chrome_102"})
+	viper.SetDefault("pool.fingerprint.rotate_interval", "24h")
 
 	// Set defaults - Circuit Breaker
 	viper.SetDefault("circuit.enabled", true)
@@ -176,6 +631,7 @@ func Load() (*Config, error) {
 	viper.SetDefault("concurrency.backoff_max", "2s")
 	viper.SetDefault("concurrency.backoff_jitter", 0.2)
 	viper.SetDefault("concurrency.ping_interval", "5s")
+	viper.SetDefault("concurrency.fair_queue", true)
 
 	// Set defaults - Rate Limit
 	viper.SetDefault("ratelimit.enabled", true)
@@ -187,6 +643,12 @@ func Load() (*Config, error) {
 	viper.SetDefault("ratelimit.ip_limit.window", "1m")
 	viper.SetDefault("ratelimit.global_limit.requests", 10000)
 	viper.SetDefault("ratelimit.global_limit.window", "1m")
+	viper.SetDefault("ratelimit.end_user_limit.requests", 0)
+	viper.SetDefault("ratelimit.end_user_limit.window", "1m")
+	viper.SetDefault("ratelimit.ip_prefix_limit.requests", 0)
+	viper.SetDefault("ratelimit.ip_prefix_limit.window", "1m")
+	viper.SetDefault("ratelimit.ipv4_prefix", 24)
+	viper.SetDefault("ratelimit.ipv6_prefix", 64)
 
 	// Set defaults - Retry
 	viper.SetDefault("retry.max_attempts", 3)
@@ -194,12 +656,15 @@ func Load() (*Config, error) {
 	viper.SetDefault("retry.initial_backoff", "100ms")
 	viper.SetDefault("retry.max_backoff", "2s")
 	viper.SetDefault("retry.jitter", 0.2)
+	viper.SetDefault("retry.telemetry_headers", false)
 
 	// Set defaults - Health
 	viper.SetDefault("health.enabled", true)
 	viper.SetDefault("health.check_interval", "5m")
 	viper.SetDefault("health.token_refresh_before", "30m")
 	viper.SetDefault("health.timeout", "30s")
+	viper.SetDefault("health.prewarm_concurrency", 4)
+	viper.SetDefault("health.prewarm_timeout", "30s")
 
 	// Set defaults - Scheduler
 	viper.SetDefault("scheduler.sticky_session_ttl", "1h")
@@ -208,6 +673,106 @@ func Load() (*Config, error) {
 	// Set defaults - Metrics
 	viper.SetDefault("metrics.enabled", true)
 	viper.SetDefault("metrics.path", "/metrics")
+	viper.SetDefault("metrics.pprof", false)
+	viper.SetDefault("metrics.upstream_samples.enabled", false)
+	viper.SetDefault("metrics.upstream_samples.per_account", 20)
+	viper.SetDefault("metrics.upstream_samples.max_body_bytes", 4096)
+
+	// Set defaults - Logging
+	viper.SetDefault("logging.enrichers", []string{"cost", "client"})
+	viper.SetDefault("logging.sampling.enabled", false)
+	viper.SetDefault("logging.sampling.success_percent", 100)
+	viper.SetDefault("logging.sampling.slow_threshold", "10s")
+	viper.SetDefault("logging.compression.algorithm", "gzip")
+	viper.SetDefault("logging.compression.age", "168h")
+	viper.SetDefault("logging.conversation_cap.max_bytes", 1048576)
+	viper.SetDefault("logging.conversation_cap.head_percent", 50)
+
+	// Set defaults - Status page
+	viper.SetDefault("status.enabled", true)
+	viper.SetDefault("status.require_auth", false)
+
+	// Set defaults - count_tokens cache
+	viper.SetDefault("count_tokens.cache_enabled", true)
+	viper.SetDefault("count_tokens.cache_max_entries", 1000)
+	viper.SetDefault("count_tokens.cache_ttl", "1m")
+
+	// Set defaults - Notifications
+	viper.SetDefault("notify.webhook_url", "")
+	viper.SetDefault("notify.timeout", "10s")
+
+	// Set defaults - Request mirroring
+	viper.SetDefault("mirror.enabled", false)
+	viper.SetDefault("mirror.percent", 0)
+	viper.SetDefault("mirror.upstream_url", "")
+	viper.SetDefault("mirror.api_key", "")
+	viper.SetDefault("mirror.model", "")
+	viper.SetDefault("mirror.timeout", "120s")
+	viper.SetDefault("mirror.workers", 2)
+	viper.SetDefault("mirror.queue_size", 100)
+	viper.SetDefault("mirror.max_body_bytes", 65536)
+
+	// Set defaults - Canary requests
+	viper.SetDefault("canary.enabled", false)
+	viper.SetDefault("canary.interval", "5m")
+	viper.SetDefault("canary.modes", []string{})
+	viper.SetDefault("canary.model", "claude-3-5-haiku-20241022")
+	viper.SetDefault("canary.timeout", "60s")
+	viper.SetDefault("canary.max_latency", "20s")
+	viper.SetDefault("canary.failure_threshold", 2)
+
+	// Set defaults - Service level objectives
+	viper.SetDefault("slo.enabled", false)
+	viper.SetDefault("slo.window", "720h")
+	viper.SetDefault("slo.availability", 99.5)
+	viper.SetDefault("slo.latency_target", "30s")
+	viper.SetDefault("slo.latency_percent", 95)
+	viper.SetDefault("slo.check_interval", "5m")
+	viper.SetDefault("slo.fast_burn_window", "1h")
+	viper.SetDefault("slo.fast_burn_rate", 14.4)
+	viper.SetDefault("slo.slow_burn_window", "6h")
+	viper.SetDefault("slo.slow_burn_rate", 6)
+
+	// Set defaults - Load shedding
+	viper.SetDefault("shedding.enabled", false)
+	viper.SetDefault("shedding.check_interval", "1s")
+	viper.SetDefault("shedding.memory_soft_mb", 0)
+	viper.SetDefault("shedding.memory_hard_mb", 0)
+	viper.SetDefault("shedding.goroutines_soft", 0)
+	viper.SetDefault("shedding.goroutines_hard", 0)
+	viper.SetDefault("shedding.retry_after", "5s")
+
+	// Set defaults - Background jobs
+	viper.SetDefault("jobs.workers", 2)
+	viper.SetDefault("jobs.poll_interval", "1s")
+	viper.SetDefault("jobs.retention", "168h")
+
+	// Set defaults - Proxy pipelines
+	for _, route := range []string{"chat_completions", "messages"} {
+		viper.SetDefault("pipelines."+route+".scheduler", true)
+		viper.SetDefault("pipelines."+route+".circuit", true)
+		viper.SetDefault("pipelines."+route+".retry", true)
+	}
+
+	// Set defaults - Upstream tracing
+	viper.SetDefault("tracing.propagate", false)
+	viper.SetDefault("tracing.sample_percent", 0)
+
+	// Set defaults - anthropic-beta header profiles
+	viper.SetDefault("beta.default", "claude-code-20250219,oauth-2025-04-20,interleaved-thinking-2025-05-14,fine-grained-tool-streaming-2025-05-14")
+	viper.SetDefault("beta.haiku", "oauth-2025-04-20,interleaved-thinking-2025-05-14")
+	viper.SetDefault("beta.api_key", "claude-code-20250219,interleaved-thinking-2025-05-14,fine-grained-tool-streaming-2025-05-14")
+	viper.SetDefault("beta.oauth", "oauth-2025-04-20")
+
+	// Set defaults - feature flags
+	viper.SetDefault("feature_flags.thinking_retry.enabled", true)
+	viper.SetDefault("feature_flags.thinking_retry.percent", 100)
+	viper.SetDefault("feature_flags.count_tokens_cache.enabled", true)
+	viper.SetDefault("feature_flags.count_tokens_cache.percent", 100)
+
+	// Set defaults - Bootstrap tokens
+	viper.SetDefault("bootstrap.tokens", []string{})
+	viper.SetDefault("bootstrap.token_dir", "")
 
 	// Environment variable support
 	viper.SetEnvPrefix("CCPROXY")
@@ -224,91 +789,134 @@ func Load() (*Config, error) {
 
 	cfg = &Config{}
 	if err := viper.Unmarshal(cfg); err != nil {
-		return nil, err
+		return nil, fmt.Errorf("invalid configuration: %w", err)
 	}
 
 	// Parse durations
-	parseDurations(cfg)
+	cfg.parseIssues = parseDurations(cfg)
 
-	return cfg, nil
-}
-
-// parseDurations parses duration strings from viper
-func parseDurations(cfg *Config) {
-	// JWT expiry
-	if expiryStr := viper.GetString("jwt.default_expiry"); expiryStr != "" {
-		if d, err := time.ParseDuration(expiryStr); err == nil {
-			cfg.JWT.DefaultExpiry = d
-		}
-	}
-
-	// Pool durations
-	if d, err := time.ParseDuration(viper.GetString("pool.idle_conn_timeout")); err == nil {
-		cfg.Pool.IdleConnTimeout = d
-	}
-	if d, err := time.ParseDuration(viper.GetString("pool.client_idle_ttl")); err == nil {
-		cfg.Pool.ClientIdleTTL = d
-	}
-	if d, err := time.ParseDuration(viper.GetString("pool.response_timeout")); err == nil {
-		cfg.Pool.ResponseTimeout = d
-	}
-
-	// Circuit durations
-	if d, err := time.ParseDuration(viper.GetString("circuit.open_timeout")); err == nil {
-		cfg.Circuit.OpenTimeout = d
-	}
-
-	// Concurrency durations
-	if d, err := time.ParseDuration(viper.GetString("concurrency.wait_timeout")); err == nil {
-		cfg.Concurrency.WaitTimeout = d
-	}
-	if d, err := time.ParseDuration(viper.GetString("concurrency.backoff_base")); err == nil {
-		cfg.Concurrency.BackoffBase = d
-	}
-	if d, err := time.ParseDuration(viper.GetString("concurrency.backoff_max")); err == nil {
-		cfg.Concurrency.BackoffMax = d
-	}
-	if d, err := time.ParseDuration(viper.GetString("concurrency.ping_interval")); err == nil {
-		cfg.Concurrency.PingInterval = d
-	}
-
-	// Rate limit durations
-	if d, err := time.ParseDuration(viper.GetString("ratelimit.user_limit.window")); err == nil {
-		cfg.RateLimit.UserLimit.Window = d
-	}
-	if d, err := time.ParseDuration(viper.GetString("ratelimit.account_limit.window")); err == nil {
-		cfg.RateLimit.AccountLimit.Window = d
-	}
-	if d, err := time.ParseDuration(viper.GetString("ratelimit.ip_limit.window")); err == nil {
-		cfg.RateLimit.IPLimit.Window = d
-	}
-	if d, err := time.ParseDuration(viper.GetString("ratelimit.global_limit.window")); err == nil {
-		cfg.RateLimit.GlobalLimit.Window = d
+	// Resolve vault:// and aws-sm:// secret references
+	ctx, cancel := context.WithTimeout(context.Background(), secretResolveTimeout)
+	defer cancel()
+	if err := cfg.ResolveSecrets(ctx); err != nil {
+		return nil, err
 	}
 
-	// Retry durations
-	if d, err := time.ParseDuration(viper.GetString("retry.initial_backoff")); err == nil {
-		cfg.Retry.InitialBackoff = d
-	}
-	if d, err := time.ParseDuration(viper.GetString("retry.max_backoff")); err == nil {
-		cfg.Retry.MaxBackoff = d
-	}
+	return cfg, nil
+}
 
-	// Health durations
-	if d, err := time.ParseDuration(viper.GetString("health.check_interval")); err == nil {
-		cfg.Health.CheckInterval = d
-	}
-	if d, err := time.ParseDuration(viper.GetString("health.token_refresh_before")); err == nil {
-		cfg.Health.TokenRefreshBefore = d
-	}
-	if d, err := time.ParseDuration(viper.GetString("health.timeout")); err == nil {
-		cfg.Health.Timeout = d
+// durationFormat describes the accepted duration syntax in validation messages
+const durationFormat = `a number with a unit, e.g. "500ms", "30s", "5m" or "1h30m"`
+
+// parseDurations parses duration strings from viper. Values that do not parse,
+// such as a bare number that would otherwise be read as nanoseconds, are
+// returned as issues and reported by SelfCheck.
+func parseDurations(cfg *Config) []Issue {
+	durations := []struct {
+		key string
+		dst *time.Duration
+	}{
+		// Server
+		{"server.sse.flush_interval", &cfg.Server.SSE.FlushInterval},
+		{"server.http_cache.models_max_age", &cfg.Server.HTTPCache.ModelsMaxAge},
+		{"server.http_cache.stats_max_age", &cfg.Server.HTTPCache.StatsMaxAge},
+
+		// JWT expiry
+		{"jwt.default_expiry", &cfg.JWT.DefaultExpiry},
+
+		// Admin SSO
+		{"admin.oidc.session_ttl", &cfg.Admin.OIDC.SessionTTL},
+
+		// Pool
+		{"pool.idle_conn_timeout", &cfg.Pool.IdleConnTimeout},
+		{"pool.client_idle_ttl", &cfg.Pool.ClientIdleTTL},
+		{"pool.response_timeout", &cfg.Pool.ResponseTimeout},
+		{"pool.fingerprint.rotate_interval", &cfg.Pool.Fingerprint.RotateInterval},
+
+		// Circuit
+		{"circuit.open_timeout", &cfg.Circuit.OpenTimeout},
+
+		// Concurrency
+		{"concurrency.wait_timeout", &cfg.Concurrency.WaitTimeout},
+		{"concurrency.backoff_base", &cfg.Concurrency.BackoffBase},
+		{"concurrency.backoff_max", &cfg.Concurrency.BackoffMax},
+		{"concurrency.ping_interval", &cfg.Concurrency.PingInterval},
+
+		// Rate limit windows
+		{"ratelimit.user_limit.window", &cfg.RateLimit.UserLimit.Window},
+		{"ratelimit.account_limit.window", &cfg.RateLimit.AccountLimit.Window},
+		{"ratelimit.ip_limit.window", &cfg.RateLimit.IPLimit.Window},
+		{"ratelimit.global_limit.window", &cfg.RateLimit.GlobalLimit.Window},
+		{"ratelimit.end_user_limit.window", &cfg.RateLimit.EndUserLimit.Window},
+		{"ratelimit.ip_prefix_limit.window", &cfg.RateLimit.IPPrefixLimit.Window},
+
+		// Retry
+		{"retry.initial_backoff", &cfg.Retry.InitialBackoff},
+		{"retry.max_backoff", &cfg.Retry.MaxBackoff},
+
+		// Health
+		{"health.check_interval", &cfg.Health.CheckInterval},
+		{"health.token_refresh_before", &cfg.Health.TokenRefreshBefore},
+		{"health.timeout", &cfg.Health.Timeout},
+		{"health.prewarm_timeout", &cfg.Health.PrewarmTimeout},
+
+		// Scheduler
+		{"scheduler.sticky_session_ttl", &cfg.Scheduler.StickySessionTTL},
+
+		// Logging
+		{"logging.sampling.slow_threshold", &cfg.Logging.Sampling.SlowThreshold},
+		{"logging.compression.age", &cfg.Logging.Compression.Age},
+
+		// count_tokens cache
+		{"count_tokens.cache_ttl", &cfg.CountTokens.CacheTTL},
+
+		// Notifications
+		{"notify.timeout", &cfg.Notify.Timeout},
+
+		// Mirror
+		{"mirror.timeout", &cfg.Mirror.Timeout},
+
+		// Canary
+		{"canary.interval", &cfg.Canary.Interval},
+		{"canary.timeout", &cfg.Canary.Timeout},
+		{"canary.max_latency", &cfg.Canary.MaxLatency},
+
+		// Service level objectives
+		{"slo.window", &cfg.SLO.Window},
+		{"slo.latency_target", &cfg.SLO.LatencyTarget},
+		{"slo.check_interval", &cfg.SLO.CheckInterval},
+		{"slo.fast_burn_window", &cfg.SLO.FastBurnWindow},
+		{"slo.slow_burn_window", &cfg.SLO.SlowBurnWindow},
+
+		// Load shedding
+		{"shedding.check_interval", &cfg.Shedding.CheckInterval},
+		{"shedding.retry_after", &cfg.Shedding.RetryAfter},
+
+		// Background jobs
+		{"jobs.poll_interval", &cfg.Jobs.PollInterval},
+		{"jobs.retention", &cfg.Jobs.Retention},
+		{"claude.conversation_cleanup.retention", &cfg.Claude.ConversationCleanup.Retention},
+		{"claude.conversation_cleanup.interval", &cfg.Claude.ConversationCleanup.Interval},
 	}
 
-	// Scheduler durations
-	if d, err := time.ParseDuration(viper.GetString("scheduler.sticky_session_ttl")); err == nil {
-		cfg.Scheduler.StickySessionTTL = d
+	var issues []Issue
+	for _, d := range durations {
+		value := strings.TrimSpace(viper.GetString(d.key))
+		if value == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			issues = append(issues, Issue{
+				Level:   IssueError,
+				Field:   d.key,
+				Message: fmt.Sprintf("invalid duration %q, expected %s", value, durationFormat),
+			})
+			continue
+		}
+		*d.dst = parsed
 	}
+	return issues
 }
 
 func Get() *Config {
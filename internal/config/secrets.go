@@ -0,0 +1,216 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// secretResolveTimeout bounds resolving all secrets of one config load
+const secretResolveTimeout = 30 * time.Second
+
+// SecretProvider resolves secret references of the form
+// "<scheme>://<path>#<key>". key selects one field of a structured secret
+// and may be empty for single-value secrets.
+type SecretProvider interface {
+	Resolve(ctx context.Context, path, key string) (string, error)
+}
+
+var (
+	secretProvidersMu sync.RWMutex
+	secretProviders   = map[string]SecretProvider{
+		"vault":  VaultProvider{},
+		"aws-sm": AWSSecretsManagerProvider{},
+	}
+)
+
+// RegisterSecretProvider makes scheme:// references resolve through p,
+// replacing any provider already registered for the scheme
+func RegisterSecretProvider(scheme string, p SecretProvider) {
+	secretProvidersMu.Lock()
+	defer secretProvidersMu.Unlock()
+	secretProviders[scheme] = p
+}
+
+// ResolveSecret returns the secret a reference such as
+// "vault://secret/data/ccproxy#jwt_secret" points to. Values without a
+// registered scheme are returned unchanged.
+func ResolveSecret(ctx context.Context, value string) (string, error) {
+	scheme, ref, ok := strings.Cut(value, "://")
+	if !ok {
+		return value, nil
+	}
+	secretProvidersMu.RLock()
+	provider, ok := secretProviders[scheme]
+	secretProvidersMu.RUnlock()
+	if !ok {
+		return value, nil
+	}
+
+	path, key, _ := strings.Cut(ref, "#")
+	secret, err := provider.Resolve(ctx, path, key)
+	if err != nil {
+		return "", fmt.Errorf("resolve %s://%s: %w", scheme, path, err)
+	}
+	return secret, nil
+}
+
+// secretRefs keeps the configured secret values, references included, so
+// secrets can be resolved again on reload
+type secretRefs struct {
+	jwtSecret        string
+	jwtVerification  []string
+	adminKey         string
+	oidcClientSecret string
+	adminAPIKey      string
+	apiKeys          []string
+	notify           []notifySecrets
+}
+
+// notifySecrets are the secret fields of a notification channel
+type notifySecrets struct {
+	url      string
+	botToken string
+	password string
+}
+
+// ResolveSecrets replaces secret references in the JWT secrets, admin key,
+// OIDC client secret, Claude API keys and notification channel URLs, bot
+// tokens and SMTP passwords with the secrets they point to. An
+// API key reference may hold several comma or newline separated keys. Calling
+// it again re-reads the original references, picking up rotated secrets.
+func (c *Config) ResolveSecrets(ctx context.Context) error {
+	if c.secretRefs == nil {
+		c.secretRefs = &secretRefs{
+			jwtSecret:        c.JWT.Secret,
+			jwtVerification:  append([]string(nil), c.JWT.VerificationSecrets...),
+			adminKey:         c.Admin.Key,
+			oidcClientSecret: c.Admin.OIDC.ClientSecret,
+			adminAPIKey:      c.Claude.AdminAPIKey,
+			apiKeys:          append([]string(nil), c.Claude.APIKeys...),
+		}
+		for _, ch := range c.Notify.Channels {
+			c.secretRefs.notify = append(c.secretRefs.notify, notifySecrets{
+				url:      ch.URL,
+				botToken: ch.BotToken,
+				password: ch.SMTP.Password,
+			})
+		}
+	}
+	refs := c.secretRefs
+
+	fields := []struct {
+		name string
+		ref  string
+		dst  *string
+	}{
+		{"jwt.secret", refs.jwtSecret, &c.JWT.Secret},
+		{"admin.key", refs.adminKey, &c.Admin.Key},
+		{"admin.oidc.client_secret", refs.oidcClientSecret, &c.Admin.OIDC.ClientSecret},
+		{"claude.admin_api_key", refs.adminAPIKey, &c.Claude.AdminAPIKey},
+	}
+	resolved := make([]string, len(fields))
+	for i, f := range fields {
+		value, err := ResolveSecret(ctx, f.ref)
+		if err != nil {
+			return fmt.Errorf("%s: %w", f.name, err)
+		}
+		resolved[i] = value
+	}
+
+	verification := make([]string, 0, len(refs.jwtVerification))
+	for i, ref := range refs.jwtVerification {
+		value, err := ResolveSecret(ctx, ref)
+		if err != nil {
+			return fmt.Errorf("jwt.verification_secrets[%d]: %w", i, err)
+		}
+		verification = append(verification, value)
+	}
+
+	var apiKeys []string
+	for i, ref := range refs.apiKeys {
+		value, err := ResolveSecret(ctx, ref)
+		if err != nil {
+			return fmt.Errorf("claude.api_keys[%d]: %w", i, err)
+		}
+		if value == ref {
+			apiKeys = append(apiKeys, value)
+			continue
+		}
+		for _, key := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == '\n' }) {
+			if key = strings.TrimSpace(key); key != "" {
+				apiKeys = append(apiKeys, key)
+			}
+		}
+	}
+
+	notifyResolved := make([]notifySecrets, len(refs.notify))
+	for i, ref := range refs.notify {
+		for _, f := range []struct {
+			name string
+			ref  string
+			dst  *string
+		}{
+			{"url", ref.url, &notifyResolved[i].url},
+			{"bot_token", ref.botToken, &notifyResolved[i].botToken},
+			{"smtp.password", ref.password, &notifyResolved[i].password},
+		} {
+			value, err := ResolveSecret(ctx, f.ref)
+			if err != nil {
+				return fmt.Errorf("notify.channels[%d].%s: %w", i, f.name, err)
+			}
+			*f.dst = value
+		}
+	}
+
+	// Only apply once everything resolved, so a failed reload keeps the old secrets
+	for i, f := range fields {
+		*f.dst = resolved[i]
+	}
+	c.JWT.VerificationSecrets = verification
+	c.Claude.APIKeys = apiKeys
+	for i, resolved := range notifyResolved {
+		if i < len(c.Notify.Channels) {
+			c.Notify.Channels[i].URL = resolved.url
+			c.Notify.Channels[i].BotToken = resolved.botToken
+			c.Notify.Channels[i].SMTP.Password = resolved.password
+		}
+	}
+	return nil
+}
+
+// secretHTTPClient is shared by the built-in HTTP based providers
+var secretHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// secretResponseError describes a failed provider response, including the
+// start of the body, which carries the provider's error message
+func secretResponseError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+}
+
+// secretField picks key from a structured secret; without a key the secret
+// must have exactly one field
+func secretField(fields map[string]interface{}, key string) (string, error) {
+	if key == "" {
+		if len(fields) != 1 {
+			return "", fmt.Errorf("secret has %d fields, select one with #<field>", len(fields))
+		}
+		for k := range fields {
+			key = k
+		}
+	}
+	value, ok := fields[key]
+	if !ok {
+		return "", fmt.Errorf("secret has no field %q", key)
+	}
+	s, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("field %q is not a string", key)
+	}
+	return s, nil
+}
@@ -0,0 +1,197 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// staticSecrets is a SecretProvider backed by a map; a missing path fails
+type staticSecrets map[string]string
+
+func (s staticSecrets) Resolve(_ context.Context, path, _ string) (string, error) {
+	value, ok := s[path]
+	if !ok {
+		return "", errors.New("not found")
+	}
+	return value, nil
+}
+
+func TestResolveSecret_PlainValuesUnchanged(t *testing.T) {
+	for _, value := range []string{"", "sk-ant-plain", "https://example.com/not-a-secret"} {
+		got, err := ResolveSecret(context.Background(), value)
+		if err != nil || got != value {
+			t.Errorf("ResolveSecret(%q) = %q, %v", value, got, err)
+		}
+	}
+}
+
+func TestVaultProvider(t *testing.T) {
+	vault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "root-token" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errors":["permission denied"]}`))
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/secret/data/ccproxy": // KV v2
+			w.Write([]byte(`{"data":{"data":{"jwt_secret":"jwt-from-vault","admin_key":"admin-from-vault"},"metadata":{"version":3}}}`))
+		case "/v1/kv/ccproxy": // KV v1
+			w.Write([]byte(`{"data":{"api_keys":"sk-1,sk-2"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errors":[]}`))
+		}
+	}))
+	defer vault.Close()
+	t.Setenv("VAULT_ADDR", vault.URL)
+	t.Setenv("VAULT_TOKEN", "root-token")
+
+	ctx := context.Background()
+	if got, err := ResolveSecret(ctx, "vault://secret/data/ccproxy#jwt_secret"); err != nil || got != "jwt-from-vault" {
+		t.Errorf("KV v2 = %q, %v", got, err)
+	}
+	if got, err := ResolveSecret(ctx, "vault://kv/ccproxy"); err != nil || got != "sk-1,sk-2" {
+		t.Errorf("KV v1 single field = %q, %v", got, err)
+	}
+	if _, err := ResolveSecret(ctx, "vault://secret/data/ccproxy"); err == nil || !strings.Contains(err.Error(), "#<field>") {
+		t.Errorf("expected field selection error, got %v", err)
+	}
+	if _, err := ResolveSecret(ctx, "vault://secret/data/missing#x"); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("expected not found error, got %v", err)
+	}
+
+	t.Setenv("VAULT_TOKEN", "wrong")
+	if _, err := ResolveSecret(ctx, "vault://secret/data/ccproxy#jwt_secret"); err == nil || !strings.Contains(err.Error(), "permission denied") {
+		t.Errorf("expected permission error, got %v", err)
+	}
+}
+
+func TestAWSSecretsManagerProvider(t *testing.T) {
+	var gotAuth, gotTarget, gotToken string
+	aws := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		gotTarget = r.Header.Get("X-Amz-Target")
+		gotToken = r.Header.Get("X-Amz-Security-Token")
+
+		var req struct {
+			SecretId string
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		switch req.SecretId {
+		case "ccproxy/prod", "arn:aws:secretsmanager:eu-west-1:123456789012:secret:ccproxy/prod-AbCdEf":
+			w.Write([]byte(`{"Name":"ccproxy/prod","SecretString":"{\"admin_key\":\"admin-from-aws\"}"}`))
+		case "plain":
+			w.Write([]byte(`{"Name":"plain","SecretString":"jwt-from-aws"}`))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"__type":"ResourceNotFoundException","message":"Secrets Manager can't find the specified secret."}`))
+		}
+	}))
+	defer aws.Close()
+	t.Setenv("AWS_ENDPOINT_URL_SECRETS_MANAGER", aws.URL)
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_SESSION_TOKEN", "session")
+	t.Setenv("AWS_REGION", "us-east-1")
+
+	ctx := context.Background()
+	if got, err := ResolveSecret(ctx, "aws-sm://ccproxy/prod#admin_key"); err != nil || got != "admin-from-aws" {
+		t.Errorf("json key = %q, %v", got, err)
+	}
+	if !strings.HasPrefix(gotAuth, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/") ||
+		!strings.Contains(gotAuth, "/us-east-1/secretsmanager/aws4_request") ||
+		!strings.Contains(gotAuth, "SignedHeaders=content-type;host;x-amz-date;x-amz-security-token;x-amz-target") {
+		t.Errorf("unexpected Authorization header %q", gotAuth)
+	}
+	if gotTarget != "secretsmanager.GetSecretValue" || gotToken != "session" {
+		t.Errorf("unexpected target %q or session token %q", gotTarget, gotToken)
+	}
+
+	if got, err := ResolveSecret(ctx, "aws-sm://plain"); err != nil || got != "jwt-from-aws" {
+		t.Errorf("plain secret = %q, %v", got, err)
+	}
+
+	// The region of an ARN wins over AWS_REGION
+	if _, err := ResolveSecret(ctx, "aws-sm://arn:aws:secretsmanager:eu-west-1:123456789012:secret:ccproxy/prod-AbCdEf#admin_key"); err != nil {
+		t.Fatalf("ARN: %v", err)
+	}
+	if !strings.Contains(gotAuth, "/eu-west-1/secretsmanager/") {
+		t.Errorf("ARN request not signed for its region: %q", gotAuth)
+	}
+
+	if _, err := ResolveSecret(ctx, "aws-sm://missing"); err == nil || !strings.Contains(err.Error(), "ResourceNotFoundException") {
+		t.Errorf("expected not found error, got %v", err)
+	}
+}
+
+func TestSignAWSRequest(t *testing.T) {
+	// "get-vanilla" from the AWS Signature Version 4 test suite
+	req, _ := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+	signed, _ := time.Parse("20060102T150405Z", "20150830T123600Z")
+	signAWSRequest(req, nil, "AKIDEXAMPLE", "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", "us-east-1", "service", signed)
+
+	want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+		"SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"
+	if got := req.Header.Get("Authorization"); got != want {
+		t.Errorf("Authorization = %q, want %q", got, want)
+	}
+}
+
+func TestConfig_ResolveSecrets(t *testing.T) {
+	secrets := staticSecrets{
+		"jwt":  "jwt-v1",
+		"keys": "sk-a, sk-b\nsk-c",
+		"smtp": "smtp-pass",
+	}
+	RegisterSecretProvider("test", secrets)
+	t.Cleanup(func() {
+		secretProvidersMu.Lock()
+		delete(secretProviders, "test")
+		secretProvidersMu.Unlock()
+	})
+
+	cfg := &Config{}
+	cfg.JWT.Secret = "test://jwt"
+	cfg.JWT.VerificationSecrets = []string{"jwt-v0"}
+	cfg.Admin.Key = "plain-admin-key"
+	cfg.Claude.APIKeys = []string{"test://keys", "sk-d"}
+	cfg.Notify.Channels = []NotifyChannelConfig{{Name: "email", Type: "smtp", SMTP: NotifySMTPConfig{Password: "test://smtp"}}}
+
+	if err := cfg.ResolveSecrets(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := cfg.Notify.Channels[0].SMTP.Password; got != "smtp-pass" {
+		t.Errorf("smtp password = %q", got)
+	}
+	if cfg.JWT.Secret != "jwt-v1" || cfg.Admin.Key != "plain-admin-key" {
+		t.Errorf("unexpected secrets: jwt=%q admin=%q", cfg.JWT.Secret, cfg.Admin.Key)
+	}
+	if got := strings.Join(cfg.Claude.APIKeys, ","); got != "sk-a,sk-b,sk-c,sk-d" {
+		t.Errorf("api keys = %s", got)
+	}
+
+	// Reloading re-reads the references
+	secrets["jwt"] = "jwt-v2"
+	if err := cfg.ResolveSecrets(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.JWT.Secret != "jwt-v2" || len(cfg.JWT.VerificationSecrets) != 1 || cfg.JWT.VerificationSecrets[0] != "jwt-v0" {
+		t.Errorf("rotated jwt secrets = %q %q", cfg.JWT.Secret, cfg.JWT.VerificationSecrets)
+	}
+
+	// A failed reload keeps the previous secrets
+	secrets["jwt"] = "jwt-v3"
+	delete(secrets, "keys")
+	if err := cfg.ResolveSecrets(context.Background()); err == nil || !strings.Contains(err.Error(), "claude.api_keys[0]") {
+		t.Fatalf("expected api key error, got %v", err)
+	}
+	if cfg.JWT.Secret != "jwt-v2" || len(cfg.Claude.APIKeys) != 4 {
+		t.Errorf("failed reload changed secrets: jwt=%q keys=%v", cfg.JWT.Secret, cfg.Claude.APIKeys)
+	}
+}
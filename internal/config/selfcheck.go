@@ -0,0 +1,528 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Issue severity levels
+const (
+	IssueError   = "error"
+	IssueWarning = "warning"
+)
+
+// Issue is a configuration problem found by SelfCheck
+type Issue struct {
+	Level   string `json:"level"` // "error" or "warning"
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists the error-level issues that prevent startup
+type ValidationError struct {
+	Issues []Issue
+}
+
+func (e *ValidationError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "invalid configuration, %d error(s):", len(e.Issues))
+	for _, issue := range e.Issues {
+		fmt.Fprintf(&b, "\n  * %s: %s", issue.Field, issue.Message)
+	}
+	return b.String()
+}
+
+// Validate runs SelfCheck and returns a *ValidationError listing every
+// error-level issue, so all invalid fields can be fixed in one pass. Warnings
+// do not fail validation.
+func (c *Config) Validate() error {
+	var errs []Issue
+	for _, issue := range SelfCheck(c) {
+		if issue.Level == IssueError {
+			errs = append(errs, issue)
+		}
+	}
+	if len(errs) > 0 {
+		return &ValidationError{Issues: errs}
+	}
+	return nil
+}
+
+// SelfCheck validates configuration consistency. It never fails startup by
+// itself; callers decide how to report the returned issues.
+func SelfCheck(cfg *Config) []Issue {
+	// Values Load could not parse come first
+	issues := append([]Issue(nil), cfg.parseIssues...)
+	add := func(level, field, format string, args ...interface{}) {
+		issues = append(issues, Issue{Level: level, Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	// Server
+	switch cfg.Server.Mode {
+	case "web", "api", "both":
+	default:
+		add(IssueError, "server.mode", "unknown mode %q, expected web, api or both", cfg.Server.Mode)
+	}
+	for _, p := range cfg.Server.TrustedProxies {
+		if net.ParseIP(p) == nil {
+			if _, _, err := net.ParseCIDR(p); err != nil {
+				add(IssueError, "server.trusted_proxies", "%q is not an IP or CIDR", p)
+			}
+		}
+	}
+	if cfg.Server.SSE.FlushInterval < 0 {
+		add(IssueError, "server.sse.flush_interval", "must not be negative")
+	} else if cfg.Server.SSE.FlushInterval > time.Second {
+		add(IssueWarning, "server.sse.flush_interval", "%s delays every stream event by up to that long", cfg.Server.SSE.FlushInterval)
+	}
+	if cfg.Server.SSE.WriteBufferSize < 0 {
+		add(IssueError, "server.sse.write_buffer_size", "must not be negative")
+	}
+	if cfg.Server.HTTP2.Enabled && cfg.Server.HTTP2.IdleTimeout <= 0 {
+		add(IssueWarning, "server.http2.idle_timeout", "not set, idle h2c connections are never closed")
+	}
+	if cfg.Server.HTTPCache.ModelsMaxAge < 0 {
+		add(IssueError, "server.http_cache.models_max_age", "must not be negative")
+	}
+	if cfg.Server.HTTPCache.StatsMaxAge < 0 {
+		add(IssueError, "server.http_cache.stats_max_age", "must not be negative")
+	}
+
+	if t := cfg.Server.TLS; t.Enabled {
+		if t.CertFile == "" || t.KeyFile == "" {
+			add(IssueError, "server.tls", "cert_file and key_file are required when TLS is enabled")
+		}
+		switch t.ClientAuth {
+		case "optional", "require":
+		default:
+			add(IssueError, "server.tls.client_auth", "unknown value %q, expected optional or require", t.ClientAuth)
+		}
+		if t.ClientCAFile == "" && t.ClientAuth == "require" {
+			add(IssueError, "server.tls.client_ca_file", "is required when client_auth is require")
+		}
+		if t.ClientCAFile == "" && t.ClientCRLFile != "" {
+			add(IssueWarning, "server.tls.client_crl_file", "is ignored without client_ca_file")
+		}
+	} else if t.ClientCAFile != "" {
+		add(IssueWarning, "server.tls.client_ca_file", "client certificates need server.tls.enabled")
+	}
+
+	// Storage
+	if rp := cfg.Storage.ReadPool; rp.Enabled && rp.MaxConns < 1 {
+		add(IssueError, "storage.read_pool.max_conns", "must be at least 1")
+	}
+
+	// Secrets
+	if len(cfg.JWT.Secret) < 32 {
+		add(IssueWarning, "jwt.secret", "secret is shorter than 32 characters")
+	}
+	for i, secret := range cfg.JWT.VerificationSecrets {
+		if secret == "" {
+			add(IssueError, fmt.Sprintf("jwt.verification_secrets[%d]", i), "must not be empty")
+		}
+	}
+	names, issuers := map[string]bool{}, map[string]bool{}
+	for i, ext := range cfg.JWT.ExternalIssuers {
+		field := fmt.Sprintf("jwt.external_issuers[%d]", i)
+		switch {
+		case ext.Name == "" || strings.Contains(ext.Name, ":"):
+			add(IssueError, field+".name", "must be set and must not contain ':'")
+		case names[ext.Name]:
+			add(IssueError, field+".name", "duplicate issuer name %q", ext.Name)
+		}
+		names[ext.Name] = true
+		switch {
+		case ext.Issuer == "":
+			add(IssueError, field+".issuer", "is required")
+		case ext.Issuer == cfg.JWT.Issuer:
+			add(IssueError, field+".issuer", "must differ from jwt.issuer, which signs ccproxy's own tokens")
+		case issuers[ext.Issuer]:
+			add(IssueError, field+".issuer", "duplicate issuer %q", ext.Issuer)
+		}
+		issuers[ext.Issuer] = true
+		if len(ext.Audiences) == 0 {
+			add(IssueError, field+".audiences", "at least one audience is required")
+		}
+		if u, err := url.Parse(ext.JWKSURL); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			add(IssueError, field+".jwks_url", "must be an http(s) URL")
+		} else if u.Scheme == "http" {
+			add(IssueWarning, field+".jwks_url", "signing keys are fetched over plain http")
+		}
+	}
+	if len(cfg.Admin.Key) < 16 {
+		add(IssueWarning, "admin.key", "admin key is shorter than 16 characters")
+	}
+
+	// Admin SSO
+	if oidc := cfg.Admin.OIDC; oidc.Enabled {
+		if oidc.IssuerURL == "" {
+			add(IssueError, "admin.oidc.issuer_url", "is required when OIDC login is enabled")
+		}
+		if oidc.ClientID == "" {
+			add(IssueError, "admin.oidc.client_id", "is required when OIDC login is enabled")
+		}
+		if oidc.RedirectURL == "" {
+			add(IssueError, "admin.oidc.redirect_url", "is required when OIDC login is enabled")
+		}
+		for _, m := range oidc.RoleMappings {
+			if m.Role != "admin" && m.Role != "viewer" {
+				add(IssueError, "admin.oidc.role_mappings", "group %q has unknown role %q, expected admin or viewer", m.Group, m.Role)
+			}
+		}
+		switch oidc.DefaultRole {
+		case "", "admin", "viewer":
+		default:
+			add(IssueError, "admin.oidc.default_role", "unknown role %q, expected admin, viewer or empty", oidc.DefaultRole)
+		}
+		if len(oidc.RoleMappings) == 0 && oidc.DefaultRole == "" {
+			add(IssueWarning, "admin.oidc.role_mappings", "no role mappings and no default role, every OIDC login will be denied")
+		}
+	}
+
+	// Auth sources: API mode needs API keys (web accounts are checked against the store by the caller)
+	if cfg.Server.Mode == "api" && len(cfg.Claude.APIKeys) == 0 {
+		add(IssueError, "claude.api_keys", "api mode requires at least one API key")
+	}
+	if cfg.Claude.WebPromptLimit < 0 {
+		add(IssueError, "claude.web_prompt_limit", "must not be negative")
+	} else if cfg.Claude.WebPromptLimit > 0 && cfg.Claude.WebPromptLimit < 1000 {
+		add(IssueWarning, "claude.web_prompt_limit", "%d characters leaves little room for the latest messages", cfg.Claude.WebPromptLimit)
+	}
+
+	// Retry
+	if cfg.Retry.MaxAttempts < 1 {
+		add(IssueError, "retry.max_attempts", "must be at least 1")
+	}
+	if cfg.Retry.InitialBackoff <= 0 {
+		add(IssueError, "retry.initial_backoff", "must be greater than 0")
+	}
+	if cfg.Retry.MaxBackoff < cfg.Retry.InitialBackoff {
+		add(IssueWarning, "retry.max_backoff", "is lower than retry.initial_backoff (%s < %s)", cfg.Retry.MaxBackoff, cfg.Retry.InitialBackoff)
+	}
+	if cfg.Retry.Jitter < 0 || cfg.Retry.Jitter > 1 {
+		add(IssueWarning, "retry.jitter", "should be between 0 and 1")
+	}
+
+	// Concurrency
+	if cfg.Concurrency.UserMax <= 0 {
+		add(IssueError, "concurrency.user_max", "must be greater than 0")
+	}
+	if cfg.Concurrency.AccountMax <= 0 {
+		add(IssueError, "concurrency.account_max", "must be greater than 0")
+	}
+	if cfg.Concurrency.WaitTimeout <= 0 {
+		add(IssueWarning, "concurrency.wait_timeout", "is not positive, queued requests fail immediately")
+	}
+	if cfg.Concurrency.MaxWaitQueue < 0 {
+		add(IssueError, "concurrency.max_wait_queue", "must not be negative")
+	}
+	if cfg.Concurrency.BackoffBase <= 0 {
+		add(IssueError, "concurrency.backoff_base", "must be greater than 0")
+	}
+
+	// Circuit breaker
+	if cfg.Circuit.Enabled {
+		if cfg.Circuit.FailureThreshold <= 0 {
+			add(IssueError, "circuit.failure_threshold", "must be greater than 0")
+		}
+		if cfg.Circuit.SuccessThreshold <= 0 {
+			add(IssueError, "circuit.success_threshold", "must be greater than 0")
+		}
+		if cfg.Circuit.OpenTimeout <= 0 {
+			add(IssueError, "circuit.open_timeout", "must be greater than 0")
+		}
+	}
+
+	// Rate limits
+	if cfg.RateLimit.Enabled {
+		rules := []struct {
+			field string
+			rule  LimitRule
+		}{
+			{"ratelimit.user_limit", cfg.RateLimit.UserLimit},
+			{"ratelimit.account_limit", cfg.RateLimit.AccountLimit},
+			{"ratelimit.ip_limit", cfg.RateLimit.IPLimit},
+			{"ratelimit.global_limit", cfg.RateLimit.GlobalLimit},
+			{"ratelimit.end_user_limit", cfg.RateLimit.EndUserLimit},
+			{"ratelimit.ip_prefix_limit", cfg.RateLimit.IPPrefixLimit},
+		}
+		for _, r := range rules {
+			if r.rule.Requests > 0 && r.rule.Window <= 0 {
+				add(IssueError, r.field+".window", "must be greater than 0")
+			}
+		}
+		if p := cfg.RateLimit.IPv4Prefix; p < 1 || p > 32 {
+			add(IssueError, "ratelimit.ipv4_prefix", "must be between 1 and 32")
+		}
+		if p := cfg.RateLimit.IPv6Prefix; p < 1 || p > 128 {
+			add(IssueError, "ratelimit.ipv6_prefix", "must be between 1 and 128")
+		}
+	}
+
+	// Health
+	if cfg.Health.Enabled && cfg.Health.CheckInterval <= 0 {
+		add(IssueError, "health.check_interval", "must be greater than 0")
+	}
+	if cfg.Health.Enabled && cfg.Health.Timeout <= 0 {
+		add(IssueError, "health.timeout", "must be greater than 0")
+	}
+	if cfg.Health.PrewarmConcurrency < 0 {
+		add(IssueError, "health.prewarm_concurrency", "must not be negative, 0 disables the startup pre-warm")
+	}
+	if cfg.Health.Enabled && cfg.Health.PrewarmConcurrency > 0 && cfg.Health.PrewarmTimeout <= 0 {
+		add(IssueError, "health.prewarm_timeout", "must be greater than 0 when the startup pre-warm is enabled")
+	}
+
+	// Scheduler
+	switch cfg.Scheduler.Strategy {
+	case "least_loaded", "round_robin", "random":
+	default:
+		add(IssueWarning, "scheduler.strategy", "unknown strategy %q, least_loaded is used", cfg.Scheduler.Strategy)
+	}
+
+	// Upstream exchange samples
+	if u := cfg.Metrics.UpstreamSamples; u.Enabled {
+		if u.PerAccount <= 0 {
+			add(IssueError, "metrics.upstream_samples.per_account", "must be greater than 0")
+		}
+		if u.MaxBodyBytes < 0 {
+			add(IssueError, "metrics.upstream_samples.max_body_bytes", "must not be negative")
+		}
+		add(IssueWarning, "metrics.upstream_samples.enabled", "request and response bodies are kept in memory with known secrets redacted; turn off when done debugging")
+	}
+
+	// Logging
+	if s := cfg.Logging.Sampling; s.Enabled && (s.SuccessPercent < 0 || s.SuccessPercent > 100) {
+		add(IssueWarning, "logging.sampling.success_percent", "should be between 0 and 100")
+	}
+	for _, name := range cfg.Logging.Enrichers {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "cost", "geo", "client":
+		default:
+			add(IssueWarning, "logging.enrichers", "unknown enricher %q is ignored", name)
+		}
+	}
+	switch cfg.Logging.Compression.Algorithm {
+	case "gzip", "zstd":
+	default:
+		add(IssueWarning, "logging.compression.algorithm", "unknown algorithm %q, gzip is used", cfg.Logging.Compression.Algorithm)
+	}
+
+	if cfg.Logging.ConvCap.MaxBytes < 0 {
+		add(IssueWarning, "logging.conversation_cap.max_bytes", "is negative, conversations are stored whole")
+	} else if cfg.Logging.ConvCap.MaxBytes > 0 && cfg.Logging.ConvCap.MaxBytes < 4096 {
+		add(IssueWarning, "logging.conversation_cap.max_bytes", "%d bytes leaves little besides truncation markers", cfg.Logging.ConvCap.MaxBytes)
+	}
+	if p := cfg.Logging.ConvCap.HeadPercent; p < 0 || p > 100 {
+		add(IssueWarning, "logging.conversation_cap.head_percent", "should be between 0 and 100")
+	}
+
+	// count_tokens cache
+	if cfg.CountTokens.CacheEnabled && cfg.CountTokens.CacheTTL <= 0 {
+		add(IssueWarning, "count_tokens.cache_ttl", "is not positive, the default is used")
+	}
+
+	// Notification channels
+	channelNames := map[string]bool{}
+	for i, ch := range cfg.Notify.Channels {
+		field := fmt.Sprintf("notify.channels[%d]", i)
+		if ch.Name == "" {
+			add(IssueError, field+".name", "is required")
+		} else if channelNames[ch.Name] {
+			add(IssueError, field+".name", "duplicates channel %q", ch.Name)
+		}
+		channelNames[ch.Name] = true
+		switch ch.Type {
+		case "webhook", "slack":
+			if ch.URL == "" {
+				add(IssueError, field+".url", "is required for %s channels", ch.Type)
+			}
+		case "telegram":
+			if ch.BotToken == "" || ch.ChatID == "" {
+				add(IssueError, field, "bot_token and chat_id are required for telegram channels")
+			}
+		case "smtp":
+			if ch.SMTP.Host == "" || ch.SMTP.From == "" || len(ch.SMTP.To) == 0 {
+				add(IssueError, field+".smtp", "host, from and to are required for smtp channels")
+			}
+		default:
+			add(IssueError, field+".type", "unknown type %q, use webhook, slack, telegram or smtp", ch.Type)
+		}
+		switch ch.MinSeverity {
+		case "", "info", "warning", "critical":
+		default:
+			add(IssueError, field+".min_severity", "unknown severity %q, use info, warning or critical", ch.MinSeverity)
+		}
+	}
+
+	// Request mirroring
+	if cfg.Mirror.Enabled {
+		if cfg.Mirror.UpstreamURL == "" {
+			add(IssueError, "mirror.upstream_url", "is required when mirroring is enabled")
+		}
+		if cfg.Mirror.Percent <= 0 || cfg.Mirror.Percent > 100 {
+			add(IssueWarning, "mirror.percent", "should be between 0 (exclusive) and 100")
+		}
+	}
+
+	// Canary requests
+	if c := cfg.Canary; c.Enabled {
+		if c.Interval <= 0 {
+			add(IssueError, "canary.interval", "must be positive")
+		}
+		if c.Model == "" {
+			add(IssueError, "canary.model", "is required when canaries are enabled")
+		}
+		for _, mode := range c.Modes {
+			if mode != "api" && mode != "web" {
+				add(IssueError, "canary.modes", "unknown mode %q, must be \"api\" or \"web\"", mode)
+			}
+		}
+		if c.MaxLatency > 0 && c.Timeout > 0 && c.MaxLatency > c.Timeout {
+			add(IssueWarning, "canary.max_latency", "is longer than canary.timeout")
+		}
+	}
+
+	// Service level objectives
+	if c := cfg.SLO; c.Enabled {
+		if c.Window <= 0 {
+			add(IssueError, "slo.window", "must be positive")
+		}
+		if c.Availability <= 0 || c.Availability >= 100 {
+			add(IssueError, "slo.availability", "must be between 0 and 100 (exclusive)")
+		}
+		if c.LatencyPercent < 0 || c.LatencyPercent >= 100 {
+			add(IssueError, "slo.latency_percent", "must be between 0 and 100 (exclusive)")
+		}
+		if c.LatencyPercent > 0 && c.LatencyTarget <= 0 {
+			add(IssueError, "slo.latency_target", "must be positive when slo.latency_percent is set")
+		}
+		if c.FastBurnRate > 0 && c.FastBurnWindow > c.Window {
+			add(IssueWarning, "slo.fast_burn_window", "is longer than slo.window")
+		}
+		if c.SlowBurnRate > 0 && c.SlowBurnWindow > c.Window {
+			add(IssueWarning, "slo.slow_burn_window", "is longer than slo.window")
+		}
+	}
+
+	// Load shedding
+	if c := cfg.Shedding; c.Enabled {
+		if c.CheckInterval <= 0 {
+			add(IssueError, "shedding.check_interval", "must be positive")
+		}
+		if c.MemorySoftMB < 0 || c.MemoryHardMB < 0 || c.GoroutinesSoft < 0 || c.GoroutinesHard < 0 {
+			add(IssueError, "shedding", "thresholds must not be negative")
+		}
+		if c.MemorySoftMB == 0 && c.MemoryHardMB == 0 && c.GoroutinesSoft == 0 && c.GoroutinesHard == 0 {
+			add(IssueWarning, "shedding", "is enabled without thresholds, no requests will be shed")
+		}
+		if c.MemoryHardMB > 0 && c.MemorySoftMB > c.MemoryHardMB {
+			add(IssueWarning, "shedding.memory_soft_mb", "is above shedding.memory_hard_mb")
+		}
+		if c.GoroutinesHard > 0 && c.GoroutinesSoft > c.GoroutinesHard {
+			add(IssueWarning, "shedding.goroutines_soft", "is above shedding.goroutines_hard")
+		}
+	}
+
+	// Background jobs
+	if cfg.Jobs.Workers < 1 {
+		add(IssueError, "jobs.workers", "must be at least 1")
+	}
+	if cfg.Jobs.PollInterval <= 0 {
+		add(IssueError, "jobs.poll_interval", "must be positive")
+	}
+	if cfg.Jobs.Retention <= 0 {
+		add(IssueError, "jobs.retention", "must be positive")
+	}
+
+	// TLS fingerprints
+	if c := cfg.Pool.Fingerprint; c.Enabled {
+		known := map[string]bool{}
+		for _, name := range TLSFingerprintProfiles {
+			known[name] = true
+		}
+		for i, name := range c.Profiles {
+			if !known[name] {
+				add(IssueError, fmt.Sprintf("pool.fingerprint.profiles[%d]", i), "unknown profile %q, use one of %s",
+					name, strings.Join(TLSFingerprintProfiles, ", "))
+			}
+		}
+		for accountID, name := range c.Accounts {
+			if !known[name] {
+				add(IssueError, "pool.fingerprint.accounts."+accountID, "unknown profile %q, use one of %s",
+					name, strings.Join(TLSFingerprintProfiles, ", "))
+			}
+		}
+		if c.RotateInterval < 0 {
+			add(IssueError, "pool.fingerprint.rotate_interval", "must not be negative")
+		}
+	}
+
+	// Web conversation cleanup; deleting a conversation while its completion
+	// still streams would cut the response short
+	if c := cfg.Claude.ConversationCleanup; c.Enabled {
+		if c.Retention <= 0 {
+			add(IssueError, "claude.conversation_cleanup.retention", "must be positive")
+		} else if cfg.Pool.ResponseTimeout > 0 && c.Retention < cfg.Pool.ResponseTimeout {
+			add(IssueWarning, "claude.conversation_cleanup.retention", "%s is shorter than pool.response_timeout (%s); long responses may be cut off",
+				c.Retention, cfg.Pool.ResponseTimeout)
+		}
+		if c.Interval <= 0 {
+			add(IssueError, "claude.conversation_cleanup.interval", "must be positive")
+		}
+		if c.BatchSize < 1 {
+			add(IssueError, "claude.conversation_cleanup.batch_size", "must be at least 1")
+		}
+		if c.MaxAttempts < 1 {
+			add(IssueError, "claude.conversation_cleanup.max_attempts", "must be at least 1")
+		}
+	}
+
+	// Upstream tracing
+	if cfg.Tracing.SamplePercent < 0 || cfg.Tracing.SamplePercent > 100 {
+		add(IssueError, "tracing.sample_percent", "must be between 0 and 100")
+	}
+
+	// anthropic-beta profiles; OAuth tokens are rejected without the OAuth flag
+	if cfg.Beta.OAuth == "" {
+		add(IssueWarning, "beta.oauth", "is empty, client headers on OAuth requests are sent unchanged")
+	}
+	profiles := []struct {
+		field  string
+		header string
+	}{
+		{"beta.default", cfg.Beta.Default},
+		{"beta.haiku", cfg.Beta.Haiku},
+	}
+	for _, p := range profiles {
+		if cfg.Beta.OAuth != "" && !strings.Contains(p.header, cfg.Beta.OAuth) {
+			add(IssueWarning, p.field, "does not include the OAuth flag %q", cfg.Beta.OAuth)
+		}
+	}
+
+	// Bootstrap tokens
+	bootstrapIDs := map[string]bool{}
+	for _, spec := range cfg.Bootstrap.Tokens {
+		token, err := ParseBootstrapToken(spec)
+		if err != nil {
+			add(IssueError, "bootstrap.tokens", "%v", err)
+			continue
+		}
+		if bootstrapIDs[token.ID] {
+			add(IssueError, "bootstrap.tokens", "token %q is declared more than once", token.ID)
+		}
+		bootstrapIDs[token.ID] = true
+	}
+
+	// Feature flags
+	for name, flag := range cfg.FeatureFlags {
+		if flag.Percent < 0 || flag.Percent > 100 {
+			add(IssueError, "feature_flags."+name+".percent", "must be between 0 and 100")
+		}
+	}
+
+	return issues
+}
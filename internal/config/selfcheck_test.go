@@ -0,0 +1,343 @@
+package config
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestValidate_Defaults(t *testing.T) {
+	defer viper.Reset()
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("default configuration is invalid: %v", err)
+	}
+}
+
+func TestValidate_ListsEveryInvalidField(t *testing.T) {
+	defer viper.Reset()
+
+	// A bare number is not a duration; it used to be read as nanoseconds
+	viper.Set("circuit.open_timeout", 30)
+	viper.Set("circuit.failure_threshold", 0)
+	viper.Set("retry.max_attempts", 0)
+	viper.Set("jwt.secret", "short") // Only a warning
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	err = cfg.Validate()
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("Validate() = %v, want a *ValidationError", err)
+	}
+
+	fields := map[string]string{}
+	for _, issue := range verr.Issues {
+		if issue.Level != IssueError {
+			t.Errorf("warning %s reported as a validation error", issue.Field)
+		}
+		fields[issue.Field] = issue.Message
+	}
+	for _, field := range []string{"circuit.open_timeout", "circuit.failure_threshold", "retry.max_attempts"} {
+		if _, ok := fields[field]; !ok {
+			t.Errorf("%s missing from %v", field, verr.Issues)
+		}
+	}
+	if msg := fields["circuit.open_timeout"]; !strings.Contains(msg, `"30"`) || !strings.Contains(msg, `"30s"`) {
+		t.Errorf("duration message %q does not name the value and the expected format", msg)
+	}
+	if _, ok := fields["jwt.secret"]; ok {
+		t.Error("jwt.secret warning failed validation")
+	}
+	if !strings.Contains(err.Error(), "circuit.failure_threshold: must be greater than 0") {
+		t.Errorf("error message = %q", err.Error())
+	}
+}
+
+func TestSelfCheck_Pipelines(t *testing.T) {
+	tests := []struct {
+		name      string
+		pipelines PipelinesConfig
+		wantField string
+	}{
+		{"defaults", PipelinesConfig{ChatCompletions: PipelineConfig{Scheduler: true, Circuit: true, Retry: true}}, ""},
+		{"chat without retry", PipelinesConfig{ChatCompletions: PipelineConfig{Scheduler: true}}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{Pipelines: tt.pipelines}
+			var got []Issue
+			for _, issue := range SelfCheck(cfg) {
+				if strings.HasPrefix(issue.Field, "pipelines.") {
+					got = append(got, issue)
+				}
+			}
+			if tt.wantField == "" {
+				if len(got) != 0 {
+					t.Errorf("issues = %v, want none", got)
+				}
+				return
+			}
+			if len(got) != 1 || got[0].Field != tt.wantField || got[0].Level != IssueError {
+				t.Errorf("issues = %v, want an error for %s", got, tt.wantField)
+			}
+		})
+	}
+}
+
+func TestSelfCheck_ExternalIssuers(t *testing.T) {
+	valid := ExternalJWTIssuer{Name: "corp", Issuer: "https://login.example.com", Audiences: []string{"ccproxy"}, JWKSURL: "https://login.example.com/jwks"}
+	tests := []struct {
+		name      string
+		issuers   func() []ExternalJWTIssuer
+		wantField string
+		wantLevel string
+	}{
+		{"valid", func() []ExternalJWTIssuer { return []ExternalJWTIssuer{valid} }, "", ""},
+		{"name with colon", func() []ExternalJWTIssuer {
+			ext := valid
+			ext.Name = "corp:prod"
+			return []ExternalJWTIssuer{ext}
+		}, "jwt.external_issuers[0].name", IssueError},
+		{"internal issuer", func() []ExternalJWTIssuer {
+			ext := valid
+			ext.Issuer = "ccproxy"
+			return []ExternalJWTIssuer{ext}
+		}, "jwt.external_issuers[0].issuer", IssueError},
+		{"duplicate issuer", func() []ExternalJWTIssuer {
+			ext := valid
+			ext.Name = "corp2"
+			return []ExternalJWTIssuer{valid, ext}
+		}, "jwt.external_issuers[1].issuer", IssueError},
+		{"no audience", func() []ExternalJWTIssuer {
+			ext := valid
+			ext.Audiences = nil
+			return []ExternalJWTIssuer{ext}
+		}, "jwt.external_issuers[0].audiences", IssueError},
+		{"plain http keys", func() []ExternalJWTIssuer {
+			ext := valid
+			ext.JWKSURL = "http://idp.internal/jwks"
+			return []ExternalJWTIssuer{ext}
+		}, "jwt.external_issuers[0].jwks_url", IssueWarning},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{JWT: JWTConfig{Issuer: "ccproxy", ExternalIssuers: tt.issuers()}}
+			var got []Issue
+			for _, issue := range SelfCheck(cfg) {
+				if strings.HasPrefix(issue.Field, "jwt.external_issuers") {
+					got = append(got, issue)
+				}
+			}
+			if tt.wantField == "" {
+				if len(got) != 0 {
+					t.Errorf("issues = %v, want none", got)
+				}
+				return
+			}
+			if len(got) != 1 || got[0].Field != tt.wantField || got[0].Level != tt.wantLevel {
+				t.Errorf("issues = %v, want a %s for %s", got, tt.wantLevel, tt.wantField)
+			}
+		})
+	}
+}
+
+func TestParseDurations_KeepsValidValues(t *testing.T) {
+	defer viper.Reset()
+
+	viper.Set("health.timeout", "45s")
+	viper.Set("retry.initial_backoff", "1 minute")
+
+	cfg := &Config{}
+	issues := parseDurations(cfg)
+	if cfg.Health.Timeout != 45*time.Second {
+		t.Errorf("health.timeout = %s, want 45s", cfg.Health.Timeout)
+	}
+	if len(issues) != 1 || issues[0].Field != "retry.initial_backoff" {
+		t.Errorf("issues = %v, want only retry.initial_backoff", issues)
+	}
+}
+
+func TestParseBootstrapToken(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    BootstrapToken
+		wantErr bool
+	}{
+		{spec: "ci", want: BootstrapToken{ID: "ci", Mode: "both"}},
+		{spec: "ci:api", want: BootstrapToken{ID: "ci", Mode: "api"}},
+		{spec: " dev-1::72h", want: BootstrapToken{ID: "dev-1", Mode: "both", Expiry: 72 * time.Hour}},
+		{spec: "", wantErr: true},
+		{spec: "ci:admin", wantErr: true},
+		{spec: "ci:api:30", wantErr: true},
+		{spec: "../ci", wantErr: true},
+		{spec: "ci:api:1h:extra", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseBootstrapToken(tt.spec)
+		if (err != nil) != tt.wantErr || (!tt.wantErr && got != tt.want) {
+			t.Errorf("ParseBootstrapToken(%q) = %+v, %v", tt.spec, got, err)
+		}
+	}
+}
+
+func TestBootstrapTokensFromEnv(t *testing.T) {
+	defer viper.Reset()
+	t.Setenv("CCPROXY_BOOTSTRAP_TOKENS", "ci:api:24h,ci")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(cfg.Bootstrap.Tokens) != 2 {
+		t.Fatalf("tokens = %q", cfg.Bootstrap.Tokens)
+	}
+	var verr *ValidationError
+	if !errors.As(cfg.Validate(), &verr) || len(verr.Issues) != 1 || verr.Issues[0].Field != "bootstrap.tokens" {
+		t.Errorf("duplicate bootstrap token not reported: %v", verr)
+	}
+}
+
+func TestSelfCheck_NotifyChannels(t *testing.T) {
+	slack := NotifyChannelConfig{Name: "ops", Type: "slack", URL: "https://hooks.slack.com/services/x"}
+	tests := []struct {
+		name      string
+		channels  func() []NotifyChannelConfig
+		wantField string
+	}{
+		{"valid", func() []NotifyChannelConfig {
+			email := NotifyChannelConfig{Name: "email", Type: "smtp", MinSeverity: "critical",
+				SMTP: NotifySMTPConfig{Host: "smtp.example.com", From: "ccproxy@example.com", To: []string{"ops@example.com"}}}
+			return []NotifyChannelConfig{slack, email}
+		}, ""},
+		{"duplicate name", func() []NotifyChannelConfig {
+			return []NotifyChannelConfig{slack, slack}
+		}, "notify.channels[1].name"},
+		{"unknown type", func() []NotifyChannelConfig {
+			ch := slack
+			ch.Type = "pager"
+			return []NotifyChannelConfig{ch}
+		}, "notify.channels[0].type"},
+		{"telegram without chat", func() []NotifyChannelConfig {
+			return []NotifyChannelConfig{{Name: "tg", Type: "telegram", BotToken: "123:abc"}}
+		}, "notify.channels[0]"},
+		{"smtp without recipients", func() []NotifyChannelConfig {
+			return []NotifyChannelConfig{{Name: "email", Type: "smtp", SMTP: NotifySMTPConfig{Host: "smtp.example.com", From: "a@example.com"}}}
+		}, "notify.channels[0].smtp"},
+		{"unknown severity", func() []NotifyChannelConfig {
+			ch := slack
+			ch.MinSeverity = "error"
+			return []NotifyChannelConfig{ch}
+		}, "notify.channels[0].min_severity"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{Notify: NotifyConfig{Channels: tt.channels()}}
+			var got []Issue
+			for _, issue := range SelfCheck(cfg) {
+				if strings.HasPrefix(issue.Field, "notify.channels") {
+					got = append(got, issue)
+				}
+			}
+			if tt.wantField == "" {
+				if len(got) != 0 {
+					t.Errorf("issues = %v, want none", got)
+				}
+				return
+			}
+			if len(got) != 1 || got[0].Field != tt.wantField || got[0].Level != IssueError {
+				t.Errorf("issues = %v, want an error for %s", got, tt.wantField)
+			}
+		})
+	}
+}
+
+func TestSelfCheck_ConversationCleanup(t *testing.T) {
+	valid := ConversationCleanupConfig{Enabled: true, Retention: time.Hour, Interval: time.Minute, BatchSize: 50, MaxAttempts: 5}
+	tests := []struct {
+		name      string
+		mutate    func(c *ConversationCleanupConfig)
+		wantField string
+		wantLevel string
+	}{
+		{"valid", func(c *ConversationCleanupConfig) {}, "", ""},
+		{"disabled ignores values", func(c *ConversationCleanupConfig) { *c = ConversationCleanupConfig{} }, "", ""},
+		{"retention below response timeout", func(c *ConversationCleanupConfig) { c.Retention = time.Minute },
+			"claude.conversation_cleanup.retention", IssueWarning},
+		{"zero interval", func(c *ConversationCleanupConfig) { c.Interval = 0 },
+			"claude.conversation_cleanup.interval", IssueError},
+		{"zero batch size", func(c *ConversationCleanupConfig) { c.BatchSize = 0 },
+			"claude.conversation_cleanup.batch_size", IssueError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cleanup := valid
+			tt.mutate(&cleanup)
+			cfg := &Config{
+				Claude: ClaudeConfig{ConversationCleanup: cleanup},
+				Pool:   PoolConfig{ResponseTimeout: 10 * time.Minute},
+			}
+			var got []Issue
+			for _, issue := range SelfCheck(cfg) {
+				if strings.HasPrefix(issue.Field, "claude.conversation_cleanup") {
+					got = append(got, issue)
+				}
+			}
+			if tt.wantField == "" {
+				if len(got) != 0 {
+					t.Errorf("issues = %v, want none", got)
+				}
+				return
+			}
+			if len(got) != 1 || got[0].Field != tt.wantField || got[0].Level != tt.wantLevel {
+				t.Errorf("issues = %v, want %s for %s", got, tt.wantLevel, tt.wantField)
+			}
+		})
+	}
+}
+
+func TestSelfCheck_TLSFingerprint(t *testing.T) {
+	tests := []struct {
+		name      string
+		cfg       TLSFingerprintConfig
+		wantField string
+	}{
+		{"valid", TLSFingerprintConfig{Enabled: true, Profiles: []string{"chrome_120", "safari_16"}, RotateInterval: time.Hour}, ""},
+		{"disabled ignores values", TLSFingerprintConfig{Profiles: []string{"netscape_4"}}, ""},
+		{"unknown profile", TLSFingerprintConfig{Enabled: true, Profiles: []string{"chrome_120", "netscape_4"}},
+			"pool.fingerprint.profiles[1]"},
+		{"unknown account profile", TLSFingerprintConfig{Enabled: true, Accounts: map[string]string{"acc-1": "opera"}},
+			"pool.fingerprint.accounts.acc-1"},
+		{"negative interval", TLSFingerprintConfig{Enabled: true, RotateInterval: -time.Hour},
+			"pool.fingerprint.rotate_interval"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{Pool: PoolConfig{Fingerprint: tt.cfg}}
+			var got []Issue
+			for _, issue := range SelfCheck(cfg) {
+				if strings.HasPrefix(issue.Field, "pool.fingerprint") {
+					got = append(got, issue)
+				}
+			}
+			if tt.wantField == "" {
+				if len(got) != 0 {
+					t.Errorf("issues = %v, want none", got)
+				}
+				return
+			}
+			if len(got) != 1 || got[0].Field != tt.wantField || got[0].Level != IssueError {
+				t.Errorf("issues = %v, want an error for %s", got, tt.wantField)
+			}
+		})
+	}
+}
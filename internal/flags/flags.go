@@ -0,0 +1,185 @@
+// Package flags resolves feature flags for experimental proxy behaviors.
+// Flags are rolled out per token from configuration, and tokens allowed to
+// do so can override them per request with the X-CCProxy-Flags header.
+package flags
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strings"
+)
+
+// Header carries per-request flag overrides, e.g. "thinking_retry=off,count_tokens_cache"
+const Header = "X-CCProxy-Flags"
+
+// Known flags
+const (
+	ThinkingRetry    = "thinking_retry"     // Retry /v1/messages with filtered bodies when thinking blocks are rejected
+	CountTokensCache = "count_tokens_cache" // Serve repeated count_tokens requests from the cache
+	// StrictPassthrough forwards /v1/messages API mode bodies byte-exact in
+	// both directions, without buffering or rewriting them
+	StrictPassthrough = "strict_passthrough"
+)
+
+// defaults holds the state of every known flag when it is not configured
+var defaults = map[string]bool{
+	ThinkingRetry:     true,
+	CountTokensCache:  true,
+	StrictPassthrough: false,
+}
+
+// Known returns the names of all known flags, sorted
+func Known() []string {
+	names := make([]string, 0, len(defaults))
+	for name := range defaults {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// IsKnown reports whether name is a known flag
+func IsKnown(name string) bool {
+	_, ok := defaults[name]
+	return ok
+}
+
+// Flag configures the rollout of one flag
+type Flag struct {
+	Enabled bool
+	Percent float64 // Share of tokens the flag is on for when enabled, 0-100
+}
+
+// Evaluator resolves the flags of a request
+type Evaluator struct {
+	flags map[string]Flag
+}
+
+// NewEvaluator creates an evaluator from configured flags. Unknown names are
+// kept so Unknown can report them, but never affect a Set.
+func NewEvaluator(flags map[string]Flag) *Evaluator {
+	e := &Evaluator{flags: make(map[string]Flag, len(flags))}
+	for name, flag := range flags {
+		e.flags[strings.ToLower(name)] = flag
+	}
+	return e
+}
+
+// Unknown returns the configured flag names that are not known, sorted
+func (e *Evaluator) Unknown() []string {
+	var names []string
+	for name := range e.flags {
+		if !IsKnown(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Resolve returns the flags for subject, usually the token ID. A flag rolled
+// out to a percentage is on for a stable subset of subjects, so each token
+// stays in the same group across requests. Overrides win over configuration.
+func (e *Evaluator) Resolve(subject string, overrides map[string]bool) *Set {
+	s := &Set{values: make(map[string]bool, len(defaults))}
+	for name, value := range defaults {
+		if flag, ok := e.flags[name]; ok {
+			value = flag.Enabled && bucket(name, subject) < flag.Percent
+		}
+		if override, ok := overrides[name]; ok {
+			value = override
+		}
+		s.values[name] = value
+	}
+	return s
+}
+
+// bucket maps a flag and subject to a stable value in [0, 100)
+func bucket(name, subject string) float64 {
+	h := fnv.New32a()
+	h.Write([]byte(name + ":" + subject))
+	return float64(h.Sum32()%10000) / 100
+}
+
+// ParseOverrides parses an X-CCProxy-Flags header: a comma-separated list of
+// flag names, each optionally followed by =on/off (true/false, 1/0)
+func ParseOverrides(header string) (map[string]bool, error) {
+	overrides := make(map[string]bool)
+	for _, item := range strings.Split(header, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, value, hasValue := strings.Cut(item, "=")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !IsKnown(name) {
+			return nil, fmt.Errorf("unknown flag %q", name)
+		}
+		enabled := true
+		if hasValue {
+			switch strings.ToLower(strings.TrimSpace(value)) {
+			case "on", "true", "1":
+			case "off", "false", "0":
+				enabled = false
+			default:
+				return nil, fmt.Errorf("invalid value %q for flag %q, expected on or off", value, name)
+			}
+		}
+		overrides[name] = enabled
+	}
+	return overrides, nil
+}
+
+// Set is the resolved flags of one request
+type Set struct {
+	values map[string]bool
+}
+
+// Enabled reports whether the flag is on. A nil Set reports the defaults.
+func (s *Set) Enabled(name string) bool {
+	if s == nil {
+		return defaults[name]
+	}
+	return s.values[name]
+}
+
+// Each calls fn for every known flag in name order
+func (s *Set) Each(fn func(name string, enabled bool)) {
+	for _, name := range Known() {
+		fn(name, s.Enabled(name))
+	}
+}
+
+// String formats the set like an X-CCProxy-Flags header
+func (s *Set) String() string {
+	var parts []string
+	s.Each(func(name string, enabled bool) {
+		state := "off"
+		if enabled {
+			state = "on"
+		}
+		parts = append(parts, name+"="+state)
+	})
+	return strings.Join(parts, ",")
+}
+
+type setContextKey struct{}
+
+// WithSet attaches resolved flags to ctx
+func WithSet(ctx context.Context, s *Set) context.Context {
+	return context.WithValue(ctx, setContextKey{}, s)
+}
+
+// FromContext returns the flags attached with WithSet, or nil
+func FromContext(ctx context.Context) *Set {
+	s, _ := ctx.Value(setContextKey{}).(*Set)
+	return s
+}
+
+// Enabled reports whether the flag is on for the request carrying ctx,
+// falling back to the defaults when no flags were resolved
+func Enabled(ctx context.Context, name string) bool {
+	return FromContext(ctx).Enabled(name)
+}
@@ -0,0 +1,91 @@
+package flags
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestResolve_DefaultsAndConfig(t *testing.T) {
+	s := NewEvaluator(nil).Resolve("token-1", nil)
+	if !s.Enabled(ThinkingRetry) || !s.Enabled(CountTokensCache) {
+		t.Errorf("defaults not applied: %s", s)
+	}
+
+	e := NewEvaluator(map[string]Flag{
+		ThinkingRetry:    {Enabled: false, Percent: 100},
+		CountTokensCache: {Enabled: true, Percent: 100},
+	})
+	s = e.Resolve("token-1", nil)
+	if s.Enabled(ThinkingRetry) || !s.Enabled(CountTokensCache) {
+		t.Errorf("config not applied: %s", s)
+	}
+	if got := s.String(); got != "count_tokens_cache=on,strict_passthrough=off,thinking_retry=off" {
+		t.Errorf("String() = %q", got)
+	}
+}
+
+func TestResolve_PercentRollout(t *testing.T) {
+	e := NewEvaluator(map[string]Flag{ThinkingRetry: {Enabled: true, Percent: 30}})
+
+	on := 0
+	for i := 0; i < 1000; i++ {
+		subject := fmt.Sprintf("token-%d", i)
+		enabled := e.Resolve(subject, nil).Enabled(ThinkingRetry)
+		if enabled {
+			on++
+		}
+		// A subject stays in its group
+		if e.Resolve(subject, nil).Enabled(ThinkingRetry) != enabled {
+			t.Fatalf("%s flipped between requests", subject)
+		}
+	}
+	if on < 230 || on > 370 {
+		t.Errorf("%d of 1000 subjects enabled, want about 300", on)
+	}
+
+	e = NewEvaluator(map[string]Flag{ThinkingRetry: {Enabled: true, Percent: 0}})
+	if e.Resolve("token-1", nil).Enabled(ThinkingRetry) {
+		t.Error("0% rollout enabled the flag")
+	}
+}
+
+func TestResolve_Overrides(t *testing.T) {
+	e := NewEvaluator(map[string]Flag{ThinkingRetry: {Enabled: false}})
+
+	overrides, err := ParseOverrides(" THINKING_RETRY , count_tokens_cache=off")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := e.Resolve("token-1", overrides)
+	if !s.Enabled(ThinkingRetry) || s.Enabled(CountTokensCache) {
+		t.Errorf("overrides not applied: %s", s)
+	}
+
+	for _, header := range []string{"hedging", "thinking_retry=maybe"} {
+		if _, err := ParseOverrides(header); err == nil {
+			t.Errorf("ParseOverrides(%q) succeeded", header)
+		}
+	}
+	if overrides, err := ParseOverrides(""); err != nil || len(overrides) != 0 {
+		t.Errorf("empty header = %v, %v", overrides, err)
+	}
+}
+
+func TestEvaluator_Unknown(t *testing.T) {
+	e := NewEvaluator(map[string]Flag{"Hedging": {Enabled: true}, ThinkingRetry: {Enabled: true}})
+	if got := e.Unknown(); len(got) != 1 || got[0] != "hedging" {
+		t.Errorf("Unknown() = %v", got)
+	}
+}
+
+func TestContext(t *testing.T) {
+	ctx := context.Background()
+	if !Enabled(ctx, ThinkingRetry) {
+		t.Error("defaults not used without a set")
+	}
+	s := NewEvaluator(map[string]Flag{ThinkingRetry: {Enabled: false}}).Resolve("", nil)
+	if Enabled(WithSet(ctx, s), ThinkingRetry) {
+		t.Error("set in context not used")
+	}
+}
@@ -8,6 +8,8 @@ import (
 	"github.com/google/uuid"
 	"github.com/rs/zerolog/log"
 
+	"ccproxy/internal/jobs"
+	"ccproxy/internal/pool"
 	"ccproxy/internal/service"
 	"ccproxy/internal/store"
 )
@@ -15,49 +17,459 @@ import (
 type AccountHandler struct {
 	store        *store.Store
 	oauthService *service.OAuthService
+	spendTracker *service.SpendTracker
+	tracer       *service.Tracer
+	drainTTL     time.Duration
+	pool         pool.Pool
+	sticky       service.StickyInvalidator
+	jobs         *jobs.Queue
 }
 
 func NewAccountHandler(store *store.Store, oauthService *service.OAuthService) *AccountHandler {
 	return &AccountHandler{
 		store:        store,
 		oauthService: oauthService,
+		drainTTL:     defaultDrainTTL,
 	}
 }
 
-// CreateOAuthAccount creates a new OAuth account via login flow
+// SetSpendTracker enables API key accounts: their keys join the API key pool
+// and their spend is tracked against a monthly budget
+func (h *AccountHandler) SetSpendTracker(tracker *service.SpendTracker) {
+	h.spendTracker = tracker
+}
+
+// SetTracer enables per-account overrides of upstream trace sampling
+func (h *AccountHandler) SetTracer(tracer *service.Tracer) {
+	h.tracer = tracer
+}
+
+// SetStickyInvalidator drops the sticky sessions of accounts taken out of
+// rotation by hand
+func (h *AccountHandler) SetStickyInvalidator(inv service.StickyInvalidator) {
+	h.sticky = inv
+}
+
+// SetJobQueue runs OAuth logins in the background
+func (h *AccountHandler) SetJobQueue(q *jobs.Queue) {
+	h.jobs = q
+}
+
+// invalidateSessions drops the sticky sessions bound to an account
+func (h *AccountHandler) invalidateSessions(id string) {
+	if h.sticky != nil {
+		h.sticky.InvalidateAccount(id)
+	}
+}
+
+// CreateOAuthAccount starts the OAuth login flow for a session key in the
+// background and returns the job to follow at /api/jobs/:id
 func (h *AccountHandler) CreateOAuthAccount(c *gin.Context) {
-	var req service.LoginRequest
+	var req struct {
+		service.LoginRequest
+		TemplateID string `json:"template_id"`
+	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	template, ok := h.accountTemplate(c, req.TemplateID)
+	if !ok {
+		return
+	}
+
+	if req.SessionKey == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "session_key is required"})
+		return
+	}
+	if h.jobs == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "OAuth onboarding is not available"})
+		return
+	}
 
-	result, err := h.oauthService.Login(req)
+	payload := service.OnboardingRequest{LoginRequest: req.LoginRequest}
+	if template != nil {
+		payload.TemplateID = template.ID
+	}
+	job, err := h.jobs.Enqueue(service.OnboardingJobType, payload)
 	if err != nil {
-		log.Error().Err(err).Msg("OAuth login failed")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		log.Error().Err(err).Msg("failed to queue OAuth login")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start OAuth login"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"job_id":     job.ID,
+		"status":     job.Status,
+		"status_url": "/api/jobs/" + job.ID,
+		"message":    "OAuth login started",
+	})
+}
+
+// ImportOAuthAccount creates an OAuth account from existing access/refresh tokens
+func (h *AccountHandler) ImportOAuthAccount(c *gin.Context) {
+	var req struct {
+		service.ImportRequest
+		TemplateID string `json:"template_id"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	template, ok := h.accountTemplate(c, req.TemplateID)
+	if !ok {
+		return
+	}
+
+	account, err := h.oauthService.ImportAccount(req.ImportRequest)
+	if err != nil {
+		log.Error().Err(err).Msg("OAuth import failed")
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	h.applyTemplate(account.ID, template)
+
+	c.JSON(http.StatusOK, gin.H{
+		"account_id":      account.ID,
+		"organization_id": account.OrganizationID,
+		"expires_at":      account.ExpiresAt,
+		"message":         "OAuth credentials imported",
+	})
+}
+
+// CreateAPIKeyAccount creates an account backed by an Anthropic API key and
+// adds the key to the API key pool
+func (h *AccountHandler) CreateAPIKeyAccount(c *gin.Context) {
+	if h.spendTracker == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "API key accounts are not enabled"})
+		return
+	}
+
+	var req struct {
+		service.APIKeyAccountRequest
+		TemplateID string `json:"template_id"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	template, ok := h.accountTemplate(c, req.TemplateID)
+	if !ok {
+		return
+	}
+
+	account, info, err := h.oauthService.CreateAPIKeyAccount(req.APIKeyAccountRequest)
+	if err != nil {
+		log.Error().Err(err).Msg("API key account creation failed")
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	h.spendTracker.Register(account)
+	h.applyTemplate(account.ID, template)
+
+	c.JSON(http.StatusOK, gin.H{
+		"account_id":         account.ID,
+		"organization_id":    account.OrganizationID,
+		"workspace_id":       info.WorkspaceID,
+		"workspace_name":     info.WorkspaceName,
+		"key_name":           info.KeyName,
+		"monthly_budget_usd": info.MonthlyBudgetUSD,
+		"message":            "API key account created",
+	})
+}
+
+// GetAccountBudget returns an API key account's monthly spend and budget
+func (h *AccountHandler) GetAccountBudget(c *gin.Context) {
+	account, ok := h.apiKeyAccount(c)
+	if !ok {
+		return
+	}
+
+	budget, err := h.spendTracker.Budget(account.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get account budget"})
+		return
+	}
+
+	c.JSON(http.StatusOK, budget)
+}
+
+// UpdateAccountBudget sets an API key account's monthly budget (0 = unlimited)
+func (h *AccountHandler) UpdateAccountBudget(c *gin.Context) {
+	account, ok := h.apiKeyAccount(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		MonthlyBudgetUSD *float64 `json:"monthly_budget_usd" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if *req.MonthlyBudgetUSD < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "monthly_budget_usd must not be negative"})
+		return
+	}
+
+	if err := h.spendTracker.SetBudget(account.ID, *req.MonthlyBudgetUSD); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update budget"})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"account_id":      result.AccountID,
-		"organization_id": result.OrganizationID,
-		"expires_at":      result.ExpiresAt,
-		"message":         "OAuth login successful",
+		"message":            "budget updated",
+		"monthly_budget_usd": *req.MonthlyBudgetUSD,
 	})
 }
 
+// RefreshAccountMetadata re-fetches an API key account's organization and workspace
+func (h *AccountHandler) RefreshAccountMetadata(c *gin.Context) {
+	account, ok := h.apiKeyAccount(c)
+	if !ok {
+		return
+	}
+
+	info, err := h.oauthService.RefreshAPIKeyMetadata(account)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"organization_id": account.OrganizationID,
+		"workspace_id":    info.WorkspaceID,
+		"workspace_name":  info.WorkspaceName,
+		"key_name":        info.KeyName,
+		"fetched_at":      info.MetadataFetchedAt,
+	})
+}
+
+// GetAccountTracing returns the trace sampling rate applied to an account
+func (h *AccountHandler) GetAccountTracing(c *gin.Context) {
+	account, ok := h.tracingAccount(c)
+	if !ok {
+		return
+	}
+
+	percent, overridden := h.tracer.AccountSampling(account.ID)
+	c.JSON(http.StatusOK, gin.H{
+		"account_id":     account.ID,
+		"sample_percent": percent,
+		"overridden":     overridden,
+	})
+}
+
+// UpdateAccountTracing overrides an account's trace sampling rate; a null
+// sample_percent restores the global rate and 0 disables trace headers
+func (h *AccountHandler) UpdateAccountTracing(c *gin.Context) {
+	account, ok := h.tracingAccount(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		SamplePercent *float64 `json:"sample_percent"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.SamplePercent != nil && (*req.SamplePercent < 0 || *req.SamplePercent > 100) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "sample_percent must be between 0 and 100"})
+		return
+	}
+
+	if err := h.tracer.SetAccountSampling(account.ID, req.SamplePercent); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update account tracing"})
+		return
+	}
+
+	percent, overridden := h.tracer.AccountSampling(account.ID)
+	c.JSON(http.StatusOK, gin.H{
+		"account_id":     account.ID,
+		"sample_percent": percent,
+		"overridden":     overridden,
+	})
+}
+
+// GetAccountSchedule returns an account's scheduling windows
+func (h *AccountHandler) GetAccountSchedule(c *gin.Context) {
+	account, ok := h.scheduleAccount(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, accountScheduleResponse(account))
+}
+
+// UpdateAccountSchedule sets an account's scheduling windows; a null schedule
+// removes them so the account can be scheduled at any time
+func (h *AccountHandler) UpdateAccountSchedule(c *gin.Context) {
+	account, ok := h.scheduleAccount(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Schedule *store.AccountSchedule `json:"schedule"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Schedule != nil {
+		if err := req.Schedule.Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if err := h.store.SetAccountSchedule(account.ID, req.Schedule); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update account schedule"})
+		return
+	}
+
+	account.Schedule = req.Schedule
+	c.JSON(http.StatusOK, accountScheduleResponse(account))
+}
+
+func accountScheduleResponse(account *store.Account) gin.H {
+	return gin.H{
+		"account_id":         account.ID,
+		"schedule":           account.Schedule,
+		"in_schedule_window": account.InScheduleWindow(time.Now()),
+	}
+}
+
+// GetAccountResetSchedule returns when an account's rate window resets
+func (h *AccountHandler) GetAccountResetSchedule(c *gin.Context) {
+	account, ok := h.scheduleAccount(c)
+	if !ok {
+		return
+	}
+	schedule, err := h.store.GetAccountResetSchedule(account.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get reset schedule"})
+		return
+	}
+	c.JSON(http.StatusOK, resetScheduleResponse(account.ID, schedule))
+}
+
+// UpdateAccountResetSchedule sets when an account's rate window resets, so
+// its rate limit is lifted at that time; a null schedule removes it
+func (h *AccountHandler) UpdateAccountResetSchedule(c *gin.Context) {
+	account, ok := h.scheduleAccount(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		ResetSchedule *store.ResetSchedule `json:"reset_schedule"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.ResetSchedule != nil {
+		if err := req.ResetSchedule.Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if err := h.store.SetAccountResetSchedule(account.ID, req.ResetSchedule); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update reset schedule"})
+		return
+	}
+	c.JSON(http.StatusOK, resetScheduleResponse(account.ID, req.ResetSchedule))
+}
+
+func resetScheduleResponse(accountID string, schedule *store.ResetSchedule) gin.H {
+	resp := gin.H{
+		"account_id":     accountID,
+		"reset_schedule": schedule,
+	}
+	if schedule != nil {
+		resp["last_reset"] = schedule.LastReset(time.Now())
+	}
+	return resp
+}
+
+// scheduleAccount loads the account named in the path for the schedule and
+// network endpoints
+func (h *AccountHandler) scheduleAccount(c *gin.Context) (*store.Account, bool) {
+	account, err := h.store.GetAccount(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get account"})
+		return nil, false
+	}
+	if account == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "account not found"})
+		return nil, false
+	}
+	return account, true
+}
+
+// tracingAccount loads the account named in the path for the tracing endpoints
+func (h *AccountHandler) tracingAccount(c *gin.Context) (*store.Account, bool) {
+	if h.tracer == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "tracing is not enabled"})
+		return nil, false
+	}
+
+	account, err := h.store.GetAccount(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get account"})
+		return nil, false
+	}
+	if account == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "account not found"})
+		return nil, false
+	}
+	return account, true
+}
+
+// apiKeyAccount loads the API key account named in the path, writing an
+// error response when it is missing or of another type
+func (h *AccountHandler) apiKeyAccount(c *gin.Context) (*store.Account, bool) {
+	if h.spendTracker == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "API key accounts are not enabled"})
+		return nil, false
+	}
+
+	account, err := h.store.GetAccount(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get account"})
+		return nil, false
+	}
+	if account == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "account not found"})
+		return nil, false
+	}
+	if account.Type != store.AccountTypeAPIKey {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "account is not an API key account"})
+		return nil, false
+	}
+	return account, true
+}
+
 // CreateSessionKeyAccount creates a new session key account (legacy support)
 func (h *AccountHandler) CreateSessionKeyAccount(c *gin.Context) {
 	var req struct {
 		Name           string `json:"name" binding:"required"`
 		SessionKey     string `json:"session_key" binding:"required"`
 		OrganizationID string `json:"organization_id"`
+		TemplateID     string `json:"template_id"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	template, ok := h.accountTemplate(c, req.TemplateID)
+	if !ok {
+		return
+	}
 
 	account := &store.Account{
 		ID:             "acc_" + uuid.New().String(),
@@ -76,6 +488,7 @@ func (h *AccountHandler) CreateSessionKeyAccount(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create account"})
 		return
 	}
+	h.applyTemplate(account.ID, template)
 
 	c.JSON(http.StatusOK, gin.H{
 		"id":              account.ID,
@@ -87,6 +500,158 @@ func (h *AccountHandler) CreateSessionKeyAccount(c *gin.Context) {
 	})
 }
 
+// CloneAccount creates an account of the same type as an existing one with new
+// credentials, copying its settings (priority, max_concurrency, groups, labels),
+// organization and, for API key accounts, monthly budget
+func (h *AccountHandler) CloneAccount(c *gin.Context) {
+	source, err := h.store.GetAccount(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get account"})
+		return
+	}
+	if source == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "account not found"})
+		return
+	}
+
+	var req struct {
+		Name           string `json:"name" binding:"required"`
+		SessionKey     string `json:"session_key"`   // session_key accounts
+		APIKey         string `json:"api_key"`       // api_key accounts
+		AccessToken    string `json:"access_token"`  // oauth accounts
+		RefreshToken   string `json:"refresh_token"` // oauth accounts
+		SkipValidation bool   `json:"skip_validation"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	settings, err := h.store.GetAccountSettings(source.ID)
+	if err != nil || settings == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get account settings"})
+		return
+	}
+
+	var clone *store.Account
+	switch source.Type {
+	case store.AccountTypeSessionKey:
+		if req.SessionKey == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "session_key is required to clone a session key account"})
+			return
+		}
+		clone = &store.Account{
+			ID:             "acc_" + uuid.New().String(),
+			Name:           req.Name,
+			Type:           store.AccountTypeSessionKey,
+			OrganizationID: source.OrganizationID,
+			Credentials: store.Credentials{
+				SessionKey: req.SessionKey,
+			},
+			CreatedAt:    time.Now(),
+			IsActive:     true,
+			HealthStatus: "unknown",
+		}
+		if err := h.store.CreateAccount(clone); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create account"})
+			return
+		}
+
+	case store.AccountTypeOAuth:
+		if req.RefreshToken == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "refresh_token is required to clone an OAuth account"})
+			return
+		}
+		clone, err = h.oauthService.ImportAccount(service.ImportRequest{
+			Name:           req.Name,
+			AccessToken:    req.AccessToken,
+			RefreshToken:   req.RefreshToken,
+			OrganizationID: source.OrganizationID,
+			SkipValidation: req.SkipValidation,
+		})
+		if err != nil {
+			log.Error().Err(err).Str("source", source.ID).Msg("OAuth account clone failed")
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+	case store.AccountTypeAPIKey:
+		if h.spendTracker == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "API key accounts are not enabled"})
+			return
+		}
+		if req.APIKey == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "api_key is required to clone an API key account"})
+			return
+		}
+		var budget float64
+		if info, err := h.store.GetAPIKeyAccountInfo(source.ID); err == nil && info != nil {
+			budget = info.MonthlyBudgetUSD
+		}
+		clone, _, err = h.oauthService.CreateAPIKeyAccount(service.APIKeyAccountRequest{
+			Name:             req.Name,
+			APIKey:           req.APIKey,
+			MonthlyBudgetUSD: budget,
+		})
+		if err != nil {
+			log.Error().Err(err).Str("source", source.ID).Msg("API key account clone failed")
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		h.spendTracker.Register(clone)
+
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "accounts of type " + string(source.Type) + " cannot be cloned"})
+		return
+	}
+
+	if err := h.store.UpdateAccountSettings(clone.ID, settings); err != nil {
+		log.Error().Err(err).Str("account_id", clone.ID).Msg("failed to copy account settings to clone")
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"id":              clone.ID,
+		"name":            clone.Name,
+		"type":            clone.Type,
+		"organization_id": clone.OrganizationID,
+		"cloned_from":     source.ID,
+		"priority":        settings.Priority,
+		"max_concurrency": settings.MaxConcurrency,
+		"groups":          settings.Groups,
+		"labels":          settings.Labels,
+		"created_at":      clone.CreatedAt,
+	})
+}
+
+// accountTemplate loads the template named in an account creation request.
+// An empty ID means no template.
+func (h *AccountHandler) accountTemplate(c *gin.Context, id string) (*store.AccountTemplate, bool) {
+	if id == "" {
+		return nil, true
+	}
+	template, err := h.store.GetAccountTemplate(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get account template"})
+		return nil, false
+	}
+	if template == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "account template not found"})
+		return nil, false
+	}
+	return template, true
+}
+
+// applyTemplate copies a template's settings to a newly created account
+func (h *AccountHandler) applyTemplate(accountID string, template *store.AccountTemplate) {
+	if template == nil {
+		return
+	}
+	settings := template.AccountSettings
+	if err := h.store.UpdateAccountSettings(accountID, &settings); err != nil {
+		log.Error().Err(err).Str("account_id", accountID).Str("template", template.ID).Msg("failed to apply account template")
+	}
+}
+
 // ListAccounts lists all accounts
 func (h *AccountHandler) ListAccounts(c *gin.Context) {
 	accounts, err := h.store.ListAccounts()
@@ -130,19 +695,44 @@ func (h *AccountHandler) GetAccount(c *gin.Context) {
 		return
 	}
 
+	modelOverloads, err := h.store.GetAccountModelOverloads(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get model overloads"})
+		return
+	}
+	if modelOverloads == nil {
+		modelOverloads = []*store.ModelOverload{}
+	}
+
+	settings, err := h.store.GetAccountSettings(id)
+	if err != nil || settings == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get account settings"})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"id":              account.ID,
-		"name":            account.Name,
-		"type":            account.Type,
-		"organization_id": account.OrganizationID,
-		"expires_at":      account.ExpiresAt,
-		"created_at":      account.CreatedAt,
-		"last_used_at":    account.LastUsedAt,
-		"is_active":       account.IsActive,
-		"last_check_at":   account.LastCheckAt,
-		"health_status":   account.HealthStatus,
-		"error_count":     account.ErrorCount,
-		"success_count":   account.SuccessCount,
+		"id":                 account.ID,
+		"name":               account.Name,
+		"type":               account.Type,
+		"organization_id":    account.OrganizationID,
+		"expires_at":         account.ExpiresAt,
+		"created_at":         account.CreatedAt,
+		"last_used_at":       account.LastUsedAt,
+		"is_active":          account.IsActive,
+		"last_check_at":      account.LastCheckAt,
+		"health_status":      account.HealthStatus,
+		"error_count":        account.ErrorCount,
+		"success_count":      account.SuccessCount,
+		"priority":           settings.Priority,
+		"max_concurrency":    settings.MaxConcurrency,
+		"groups":             settings.Groups,
+		"labels":             settings.Labels,
+		"model_overloads":    modelOverloads,
+		"schedule":           account.Schedule,
+		"in_schedule_window": account.InScheduleWindow(time.Now()),
+		"extra_cookies":      account.ExtraCookieNames(),
+		"project":            account.Project,
+		"network":            account.Network,
 	})
 }
 
@@ -162,11 +752,28 @@ func (h *AccountHandler) UpdateAccount(c *gin.Context) {
 	var req struct {
 		Name     string `json:"name"`
 		IsActive *bool  `json:"is_active"`
+		// ExtraCookies replaces the account's extra cookies; {} clears them
+		ExtraCookies map[string]string `json:"extra_cookies"`
+		accountSettingsRequest
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if err := store.ValidateExtraCookies(req.ExtraCookies); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	settings, err := h.store.GetAccountSettings(id)
+	if err != nil || settings == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get account settings"})
+		return
+	}
+	if err := req.apply(settings); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	if req.Name != "" {
 		account.Name = req.Name
@@ -174,37 +781,75 @@ func (h *AccountHandler) UpdateAccount(c *gin.Context) {
 	if req.IsActive != nil {
 		account.IsActive = *req.IsActive
 	}
+	if req.ExtraCookies != nil {
+		account.Credentials.ExtraCookies = req.ExtraCookies
+	}
 
 	if err := h.store.UpdateAccount(account); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update account"})
 		return
 	}
+	if err := h.store.UpdateAccountSettings(id, settings); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update account settings"})
+		return
+	}
+	if req.IsActive != nil {
+		// Activating or deactivating by hand ends a drain
+		if _, err := h.store.CancelAccountDrain(id); err != nil {
+			log.Error().Err(err).Str("account_id", id).Msg("failed to cancel account drain")
+		}
+		if !account.IsActive {
+			h.invalidateSessions(id)
+		}
+	}
+	if h.spendTracker != nil && req.IsActive != nil {
+		if account.IsActive {
+			h.spendTracker.Register(account)
+		} else {
+			h.spendTracker.Unregister(account)
+		}
+	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "account updated"})
 }
 
-// DeleteAccount deletes an account
-func (h *AccountHandler) DeleteAccount(c *gin.Context) {
+// ClearModelOverloads removes all per-model overload cooldowns of an account
+func (h *AccountHandler) ClearModelOverloads(c *gin.Context) {
 	id := c.Param("id")
-	if err := h.store.DeleteAccount(id); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete account"})
+	if err := h.store.ClearAccountModelOverloads(id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to clear model overloads"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "account deleted"})
+	c.JSON(http.StatusOK, gin.H{"message": "model overloads cleared"})
 }
 
 // DeactivateAccount deactivates an account
 func (h *AccountHandler) DeactivateAccount(c *gin.Context) {
 	id := c.Param("id")
+	h.unregisterAPIKey(id)
 	if err := h.store.DeactivateAccount(id); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to deactivate account"})
 		return
 	}
+	if _, err := h.store.CancelAccountDrain(id); err != nil {
+		log.Error().Err(err).Str("account_id", id).Msg("failed to cancel account drain")
+	}
+	h.invalidateSessions(id)
 
 	c.JSON(http.StatusOK, gin.H{"message": "account deactivated"})
 }
 
+// unregisterAPIKey takes an API key account's key out of the pool
+func (h *AccountHandler) unregisterAPIKey(id string) {
+	if h.spendTracker == nil {
+		return
+	}
+	if account, err := h.store.GetAccount(id); err == nil && account != nil {
+		h.spendTracker.Unregister(account)
+	}
+}
+
 // RefreshToken manually refreshes an OAuth account's token
 func (h *AccountHandler) RefreshToken(c *gin.Context) {
 	id := c.Param("id")
@@ -247,7 +892,23 @@ func (h *AccountHandler) CheckHealth(c *gin.Context) {
 		return
 	}
 
-	if err := h.oauthService.CheckHealth(account); err != nil {
+	start := time.Now()
+	err = h.oauthService.CheckHealth(account)
+	record := &store.HealthCheckRecord{
+		AccountID: account.ID,
+		Healthy:   err == nil,
+		LatencyMs: time.Since(start).Milliseconds(),
+		Source:    store.HealthCheckSourceManual,
+		CheckedAt: start,
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+	if recordErr := h.store.RecordHealthCheck(record); recordErr != nil {
+		log.Warn().Err(recordErr).Str("account_id", account.ID).Msg("failed to record health check")
+	}
+
+	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"status":  "unhealthy",
 			"message": err.Error(),
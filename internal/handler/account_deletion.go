@@ -0,0 +1,138 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+
+	"ccproxy/internal/store"
+)
+
+// accountRecentTraffic is how far back requests make an account deletion
+// require a confirmation token
+const accountRecentTraffic = 7 * 24 * time.Hour
+
+// GetAccountDeletion previews deleting an account: its recorded usage and,
+// when it served requests recently, the confirmation token DeleteAccount needs
+func (h *AccountHandler) GetAccountDeletion(c *gin.Context) {
+	account, summary, ok := h.deletionAccount(c)
+	if !ok {
+		return
+	}
+
+	resp := gin.H{
+		"account_id":            account.ID,
+		"name":                  account.Name,
+		"usage":                 summary,
+		"confirmation_required": summary.RecentRequests > 0,
+	}
+	if summary.RecentRequests > 0 {
+		resp["confirm"] = accountDeletionToken(account.ID, summary)
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// DeleteAccount deletes an account. Its request logs, daily stats and spend
+// move to an anonymous archive ID so totals are kept; accounts with recent
+// traffic are only deleted with ?confirm=<token> from GetAccountDeletion.
+func (h *AccountHandler) DeleteAccount(c *gin.Context) {
+	account, summary, ok := h.deletionAccount(c)
+	if !ok {
+		return
+	}
+
+	if summary.RecentRequests > 0 {
+		token := accountDeletionToken(account.ID, summary)
+		if c.Query("confirm") != token {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":   fmt.Sprintf("account served %d requests in the last %d days, repeat with ?confirm=<token> to delete it", summary.RecentRequests, int(accountRecentTraffic.Hours()/24)),
+				"confirm": token,
+				"usage":   summary,
+			})
+			return
+		}
+	}
+
+	h.unregisterAPIKey(account.ID)
+
+	archiveID := "deleted_" + strings.ReplaceAll(uuid.New().String(), "-", "")[:12]
+	counts, err := h.store.ArchiveAndDeleteAccount(account.ID, archiveID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "account not found"})
+			return
+		}
+		log.Error().Err(err).Str("account_id", account.ID).Msg("failed to delete account")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete account"})
+		return
+	}
+
+	entry := &store.AuditEntry{
+		ID:        "aud_" + uuid.New().String(),
+		CreatedAt: time.Now(),
+		Action:    store.AuditActionAccountDelete,
+		Actor:     auditActor(c),
+		Subject:   account.ID,
+		Details: map[string]interface{}{
+			"name":       account.Name,
+			"type":       account.Type,
+			"archive_id": archiveID,
+			"usage":      summary,
+			"counts":     counts,
+			"client_ip":  c.ClientIP(),
+		},
+	}
+	if err := h.store.CreateAuditEntry(entry); err != nil {
+		log.Error().Err(err).Str("account_id", account.ID).Msg("failed to record account deletion")
+	}
+
+	h.invalidateSessions(account.ID)
+
+	log.Info().Str("account_id", account.ID).Str("archive_id", archiveID).Msg("account deleted")
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "account deleted",
+		"archive_id": archiveID,
+		"counts":     counts,
+		"audit_id":   entry.ID,
+	})
+}
+
+// deletionAccount loads the account named in the path and its usage summary
+func (h *AccountHandler) deletionAccount(c *gin.Context) (*store.Account, *store.AccountUsageSummary, bool) {
+	account, err := h.store.GetAccount(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get account"})
+		return nil, nil, false
+	}
+	if account == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "account not found"})
+		return nil, nil, false
+	}
+
+	summary, err := h.store.GetAccountUsageSummary(account.ID, time.Now().Add(-accountRecentTraffic))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get account usage"})
+		return nil, nil, false
+	}
+	return account, summary, true
+}
+
+// accountDeletionToken derives the confirmation token from the account's
+// recent traffic, so a token stops working once new requests arrive
+func accountDeletionToken(accountID string, summary *store.AccountUsageSummary) string {
+	var last int64
+	if summary.LastRequestAt != nil {
+		last = summary.LastRequestAt.UnixNano()
+	}
+	sum := sha256.Sum256([]byte(fmt.Sprintf("delete:%s:%d:%d", accountID, summary.RequestLogs, last)))
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,120 @@
+package handler
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"ccproxy/internal/middleware"
+	"ccproxy/internal/service"
+	"ccproxy/internal/store"
+)
+
+func TestAccountHandler_DeleteArchivesUsage(t *testing.T) {
+	router, db := newAccountTestRouter(t)
+	accounts := NewAccountHandler(db, nil)
+	router.GET("/account/:id/deletion", accounts.GetAccountDeletion)
+	router.DELETE("/account/:id", func(c *gin.Context) { c.Set(middleware.ContextKeyAdminSubject, "ops@example.com") }, accounts.DeleteAccount)
+
+	createAccount := func(id string) {
+		t.Helper()
+		if err := db.CreateAccount(&store.Account{
+			ID:          id,
+			Name:        id,
+			Type:        store.AccountTypeSessionKey,
+			Credentials: store.Credentials{SessionKey: "sk-ant-sid01-" + id},
+			CreatedAt:   time.Now(),
+			IsActive:    true,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	logRequest := func(i int, account string, at time.Time) {
+		t.Helper()
+		if err := db.CreateRequestLog(&store.RequestLog{
+			ID:          fmt.Sprintf("log-%d", i),
+			TokenID:     "tok-1",
+			AccountID:   sql.NullString{String: account, Valid: true},
+			Mode:        "web",
+			Model:       "claude-sonnet-4",
+			RequestAt:   at,
+			TotalTokens: 10,
+			Success:     true,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// An idle account is deleted right away
+	createAccount("acc-idle")
+	old := time.Now().AddDate(0, 0, -30)
+	for i := 0; i < 3; i++ {
+		logRequest(i, "acc-idle", old.Add(time.Duration(i)*time.Minute))
+	}
+	if err := service.NewStatsAggregator(db, time.Hour).AggregateDate(old); err != nil {
+		t.Fatal(err)
+	}
+
+	code, resp := doJSON(t, router, http.MethodDelete, "/account/acc-idle", "")
+	if code != http.StatusOK {
+		t.Fatalf("delete idle account: %d %v", code, resp)
+	}
+	archiveID, _ := resp["archive_id"].(string)
+	if !strings.HasPrefix(archiveID, "deleted_") {
+		t.Fatalf("archive id = %q", archiveID)
+	}
+	if account, _ := db.GetAccount("acc-idle"); account != nil {
+		t.Error("account not deleted")
+	}
+
+	// Stats and logs now point at the archive ID, not the deleted account
+	if summary, _ := db.GetAccountUsageSummary("acc-idle", old); summary.RequestLogs != 0 || summary.StatsRows != 0 {
+		t.Errorf("references to the deleted account remain: %+v", summary)
+	}
+	summary, err := db.GetAccountUsageSummary(archiveID, old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.RequestLogs != 3 || summary.Requests != 3 || summary.TotalTokens != 30 {
+		t.Errorf("archived usage = %+v", summary)
+	}
+
+	entries, err := db.ListAuditEntries(store.AuditFilter{Action: store.AuditActionAccountDelete})
+	if err != nil || len(entries) != 1 || entries[0].Subject != "acc-idle" || entries[0].Actor != "ops@example.com" ||
+		entries[0].Details["archive_id"] != archiveID {
+		t.Errorf("audit entries = %+v, %v", entries, err)
+	}
+
+	// An account with recent traffic needs the confirmation token
+	createAccount("acc-busy")
+	logRequest(10, "acc-busy", time.Now().Add(-time.Hour))
+
+	code, resp = doJSON(t, router, http.MethodDelete, "/account/acc-busy", "")
+	if code != http.StatusConflict {
+		t.Fatalf("delete busy account without confirmation: %d %v", code, resp)
+	}
+	code, preview := doJSON(t, router, http.MethodGet, "/account/acc-busy/deletion", "")
+	if code != http.StatusOK || preview["confirmation_required"] != true || preview["confirm"] != resp["confirm"] {
+		t.Fatalf("preview = %d %v", code, preview)
+	}
+	token := preview["confirm"].(string)
+
+	// New traffic invalidates the token
+	logRequest(11, "acc-busy", time.Now())
+	if code, _ := doJSON(t, router, http.MethodDelete, "/account/acc-busy?confirm="+token, ""); code != http.StatusConflict {
+		t.Errorf("stale confirmation token: got %d", code)
+	}
+
+	_, preview = doJSON(t, router, http.MethodGet, "/account/acc-busy/deletion", "")
+	if code, resp := doJSON(t, router, http.MethodDelete, "/account/acc-busy?confirm="+preview["confirm"].(string), ""); code != http.StatusOK {
+		t.Errorf("confirmed delete: %d %v", code, resp)
+	}
+	if code, _ := doJSON(t, router, http.MethodDelete, "/account/acc-busy", ""); code != http.StatusNotFound {
+		t.Errorf("delete missing account: got %d", code)
+	}
+}
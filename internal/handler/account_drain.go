@@ -0,0 +1,135 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+
+	"ccproxy/internal/store"
+)
+
+// defaultDrainTTL is how long a drained account keeps serving its sticky
+// sessions when the request names no ttl
+const defaultDrainTTL = time.Hour
+
+// SetDefaultDrainTTL sets how long drained accounts keep serving their sticky
+// sessions by default, normally the sticky session TTL
+func (h *AccountHandler) SetDefaultDrainTTL(ttl time.Duration) {
+	if ttl > 0 {
+		h.drainTTL = ttl
+	}
+}
+
+// DrainAccount takes an account out of rotation: it gets no new sessions but
+// keeps serving in-flight requests and its sticky sessions and pins until the
+// ttl (e.g. "30m") has passed, then it is deactivated. Draining a draining
+// account again moves its deadline.
+func (h *AccountHandler) DrainAccount(c *gin.Context) {
+	account, err := h.store.GetAccount(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get account"})
+		return
+	}
+	if account == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "account not found"})
+		return
+	}
+	if account.Type == store.AccountTypeAPIKey {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "API key accounts have no sessions to drain, deactivate them directly"})
+		return
+	}
+	if !account.IsActive {
+		c.JSON(http.StatusConflict, gin.H{"error": "account is not active"})
+		return
+	}
+
+	var req struct {
+		TTL string `json:"ttl"` // Defaults to the sticky session TTL
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	ttl := h.drainTTL
+	if ttl <= 0 {
+		ttl = defaultDrainTTL
+	}
+	if req.TTL != "" {
+		d, err := time.ParseDuration(req.TTL)
+		if err != nil || d <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid ttl format"})
+			return
+		}
+		ttl = d
+	}
+
+	drain, err := h.store.StartAccountDrain(account.ID, time.Now().Add(ttl))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to drain account"})
+		return
+	}
+	log.Info().
+		Str("account_id", account.ID).
+		Time("drain_until", drain.DrainUntil).
+		Msg("account draining")
+
+	c.JSON(http.StatusOK, drain)
+}
+
+// GetAccountDrain returns an account's drain, or 404 if it is not draining
+func (h *AccountHandler) GetAccountDrain(c *gin.Context) {
+	drain, err := h.store.GetAccountDrain(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get account drain"})
+		return
+	}
+	if drain == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "account is not draining"})
+		return
+	}
+
+	c.JSON(http.StatusOK, drain)
+}
+
+// CancelAccountDrain puts a draining account back into rotation
+func (h *AccountHandler) CancelAccountDrain(c *gin.Context) {
+	cancelled, err := h.store.CancelAccountDrain(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to cancel account drain"})
+		return
+	}
+	if !cancelled {
+		c.JSON(http.StatusNotFound, gin.H{"error": "account is not draining"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "account drain cancelled"})
+}
+
+// splitDraining separates draining accounts, which may only serve their
+// existing sessions, from those that can take new ones; on lookup failure
+// all accounts are schedulable
+func splitDraining(st *store.Store, accountIDs []string) (schedulable, draining []string) {
+	drains, err := st.GetDrainingAccounts()
+	if err != nil {
+		log.Error().Err(err).Msg("failed to load account drains")
+		return accountIDs, nil
+	}
+	if len(drains) == 0 {
+		return accountIDs, nil
+	}
+
+	schedulable = make([]string, 0, len(accountIDs))
+	for _, id := range accountIDs {
+		if _, ok := drains[id]; ok {
+			draining = append(draining, id)
+		} else {
+			schedulable = append(schedulable, id)
+		}
+	}
+	return schedulable, draining
+}
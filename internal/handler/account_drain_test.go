@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"ccproxy/internal/store"
+)
+
+func TestAccountHandler_Drain(t *testing.T) {
+	router, db := newAccountTestRouter(t)
+	accounts := NewAccountHandler(db, nil)
+	accounts.SetDefaultDrainTTL(30 * time.Minute)
+	router.POST("/account/:id/drain", accounts.DrainAccount)
+	router.GET("/account/:id/drain", accounts.GetAccountDrain)
+	router.DELETE("/account/:id/drain", accounts.CancelAccountDrain)
+
+	for _, account := range []*store.Account{
+		{ID: "acc-1", Type: store.AccountTypeSessionKey, Credentials: store.Credentials{SessionKey: "sk-ant-sid01-1"}},
+		{ID: "acc-2", Type: store.AccountTypeSessionKey, Credentials: store.Credentials{SessionKey: "sk-ant-sid01-2"}},
+		{ID: "acc-key", Type: store.AccountTypeAPIKey, Credentials: store.Credentials{APIKey: "sk-ant-api03-key"}},
+	} {
+		account.Name, account.CreatedAt, account.IsActive = account.ID, time.Now(), true
+		if err := db.CreateAccount(account); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Without a body the default ttl applies
+	code, resp := doJSON(t, router, http.MethodPost, "/account/acc-1/drain", "")
+	if code != http.StatusOK {
+		t.Fatalf("drain: %d %v", code, resp)
+	}
+	until, _ := time.Parse(time.RFC3339Nano, resp["drain_until"].(string))
+	if d := time.Until(until); d < 29*time.Minute || d > 31*time.Minute {
+		t.Errorf("drain_until = %v", resp["drain_until"])
+	}
+
+	if code, _ := doJSON(t, router, http.MethodPost, "/account/acc-2/drain", `{"ttl":"soon"}`); code != http.StatusBadRequest {
+		t.Errorf("invalid ttl: got %d", code)
+	}
+	if code, _ := doJSON(t, router, http.MethodPost, "/account/acc-key/drain", `{"ttl":"5m"}`); code != http.StatusBadRequest {
+		t.Errorf("API key account: got %d", code)
+	}
+	if code, _ := doJSON(t, router, http.MethodPost, "/account/acc-none/drain", ""); code != http.StatusNotFound {
+		t.Errorf("missing account: got %d", code)
+	}
+
+	schedulable, draining := splitDraining(db, []string{"acc-1", "acc-2"})
+	if len(schedulable) != 1 || schedulable[0] != "acc-2" || len(draining) != 1 || draining[0] != "acc-1" {
+		t.Errorf("split = %v / %v", schedulable, draining)
+	}
+
+	if code, _ := doJSON(t, router, http.MethodGet, "/account/acc-1/drain", ""); code != http.StatusOK {
+		t.Errorf("get drain: got %d", code)
+	}
+	if code, _ := doJSON(t, router, http.MethodDelete, "/account/acc-1/drain", ""); code != http.StatusOK {
+		t.Errorf("cancel drain: got %d", code)
+	}
+	if code, _ := doJSON(t, router, http.MethodGet, "/account/acc-1/drain", ""); code != http.StatusNotFound {
+		t.Errorf("cancelled drain: got %d", code)
+	}
+
+	// An inactive account cannot be drained
+	if err := db.DeactivateAccount("acc-2"); err != nil {
+		t.Fatal(err)
+	}
+	if code, _ := doJSON(t, router, http.MethodPost, "/account/acc-2/drain", ""); code != http.StatusConflict {
+		t.Errorf("inactive account: got %d", code)
+	}
+}
@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// uptimeWindows are the periods uptime is reported for
+var uptimeWindows = []struct {
+	name   string
+	period time.Duration
+}{
+	{"24h", 24 * time.Hour},
+	{"7d", 7 * 24 * time.Hour},
+}
+
+// GetAccountHealthHistory returns an account's recent health check results,
+// newest first, with its uptime over the last 24 hours and 7 days. Query
+// parameters: hours (default 24, at most 720) and limit (default 100, at
+// most 1000).
+func (h *AccountHandler) GetAccountHealthHistory(c *gin.Context) {
+	account, err := h.store.GetAccount(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get account"})
+		return
+	}
+	if account == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "account not found"})
+		return
+	}
+
+	hours, err := strconv.Atoi(c.DefaultQuery("hours", "24"))
+	if err != nil || hours <= 0 || hours > 24*30 {
+		hours = 24
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+
+	now := time.Now()
+	checks, err := h.store.ListHealthChecks(account.ID, now.Add(-time.Duration(hours)*time.Hour), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get health checks"})
+		return
+	}
+
+	uptime := gin.H{}
+	for _, window := range uptimeWindows {
+		u, err := h.store.GetHealthUptime(account.ID, now.Add(-window.period))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get uptime"})
+			return
+		}
+		uptime[window.name] = u
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"account_id":    account.ID,
+		"health_status": account.HealthStatus,
+		"last_check_at": account.LastCheckAt,
+		"hours":         hours,
+		"checks":        checks,
+		"uptime":        uptime,
+	})
+}
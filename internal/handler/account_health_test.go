@@ -0,0 +1,88 @@
+package handler
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"ccproxy/internal/store"
+)
+
+func TestAccountHandler_GetAccountHealthHistory(t *testing.T) {
+	router, db := newAccountTestRouter(t)
+	router.GET("/account/:id/health-history", NewAccountHandler(db, nil).GetAccountHealthHistory)
+
+	if err := db.CreateAccount(&store.Account{
+		ID:          "acc-1",
+		Name:        "acc-1",
+		Type:        store.AccountTypeSessionKey,
+		Credentials: store.Credentials{SessionKey: "sk-ant-sid01-acc-1"},
+		CreatedAt:   time.Now(),
+		IsActive:    true,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	for i, check := range []struct {
+		healthy bool
+		age     time.Duration
+	}{
+		{true, time.Hour},
+		{false, 2 * time.Hour},
+		{true, 3 * time.Hour},
+		{true, 4 * time.Hour},
+		{false, 3 * 24 * time.Hour}, // Only within the 7 day window
+		{true, 10 * 24 * time.Hour}, // Outside both windows
+	} {
+		record := &store.HealthCheckRecord{
+			AccountID: "acc-1",
+			Healthy:   check.healthy,
+			LatencyMs: int64(100 * (i + 1)),
+			Source:    store.HealthCheckSourceMonitor,
+			CheckedAt: now.Add(-check.age),
+		}
+		if !check.healthy {
+			record.Error = "session expired"
+		}
+		if err := db.RecordHealthCheck(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	code, resp := doJSON(t, router, http.MethodGet, "/account/acc-1/health-history", "")
+	if code != http.StatusOK {
+		t.Fatalf("health history: %d %v", code, resp)
+	}
+	checks := resp["checks"].([]interface{})
+	if len(checks) != 4 {
+		t.Fatalf("got %d checks in 24h, want 4", len(checks))
+	}
+	latest := checks[0].(map[string]interface{})
+	if latest["status"] != "healthy" || latest["latency_ms"] != 100.0 || latest["source"] != "monitor" {
+		t.Errorf("latest check = %v", latest)
+	}
+	if failed := checks[1].(map[string]interface{}); failed["status"] != "unhealthy" || failed["error"] != "session expired" {
+		t.Errorf("failed check = %v", failed)
+	}
+
+	uptime := resp["uptime"].(map[string]interface{})
+	day := uptime["24h"].(map[string]interface{})
+	if day["checks"] != 4.0 || day["uptime_percent"] != 75.0 {
+		t.Errorf("24h uptime = %v", day)
+	}
+	week := uptime["7d"].(map[string]interface{})
+	if week["checks"] != 5.0 || week["uptime_percent"] != 60.0 {
+		t.Errorf("7d uptime = %v", week)
+	}
+
+	// A longer range and a limit
+	_, resp = doJSON(t, router, http.MethodGet, "/account/acc-1/health-history?hours=720&limit=5", "")
+	if checks := resp["checks"].([]interface{}); len(checks) != 5 {
+		t.Errorf("got %d checks with limit 5", len(checks))
+	}
+
+	if code, _ := doJSON(t, router, http.MethodGet, "/account/missing/health-history", ""); code != http.StatusNotFound {
+		t.Errorf("missing account: got %d", code)
+	}
+}
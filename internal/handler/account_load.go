@@ -0,0 +1,159 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"ccproxy/internal/circuit"
+	"ccproxy/internal/concurrency"
+	"ccproxy/internal/store"
+)
+
+// AccountLoadHandler serves the live per-account concurrency view
+type AccountLoadHandler struct {
+	store       store.AccountStore
+	concurrency concurrency.Manager
+	circuitMgr  circuit.Manager
+}
+
+func NewAccountLoadHandler(st store.AccountStore, concurrencyMgr concurrency.Manager, circuitMgr circuit.Manager) *AccountLoadHandler {
+	return &AccountLoadHandler{
+		store:       st,
+		concurrency: concurrencyMgr,
+		circuitMgr:  circuitMgr,
+	}
+}
+
+// AccountLoad is the live load of a single account
+type AccountLoad struct {
+	AccountID           string  `json:"account_id"`
+	Name                string  `json:"name"`
+	Type                string  `json:"type"`
+	Status              string  `json:"status"`
+	Priority            int     `json:"priority"`
+	HealthScore         int     `json:"health_score"`
+	Schedulable         bool    `json:"schedulable"`
+	UnschedulableReason string  `json:"unschedulable_reason,omitempty"`
+	CircuitState        string  `json:"circuit_state"`
+	Current             int     `json:"current"`
+	Max                 int     `json:"max"`
+	Waiting             int     `json:"waiting"`
+	Total               int64   `json:"total"`
+	Utilization         float64 `json:"utilization"` // current / max
+	Saturated           bool    `json:"saturated"`   // all slots in use or requests queued
+}
+
+// AccountLoadSummary aggregates load across accounts
+type AccountLoadSummary struct {
+	Accounts      int `json:"accounts"`
+	Schedulable   int `json:"schedulable"`
+	Saturated     int `json:"saturated"`
+	CircuitOpen   int `json:"circuit_open"`
+	ActiveSlots   int `json:"active_slots"`
+	TotalCapacity int `json:"total_capacity"`
+	Waiting       int `json:"waiting"`
+}
+
+// GetLoad returns concurrency, circuit state and schedulability for every account
+func (h *AccountLoadHandler) GetLoad(c *gin.Context) {
+	accounts, err := h.store.ListAccountsWithStatus()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list accounts"})
+		return
+	}
+
+	ids := make([]string, 0, len(accounts))
+	for _, account := range accounts {
+		ids = append(ids, account.ID)
+	}
+
+	var loads map[string]*concurrency.LoadInfo
+	if h.concurrency != nil {
+		loads = h.concurrency.GetAccountLoad(ids)
+	}
+
+	var breakers map[string]circuit.BreakerStats
+	if h.circuitMgr != nil {
+		breakers = h.circuitMgr.Stats()
+	}
+
+	result := make([]AccountLoad, 0, len(accounts))
+	var summary AccountLoadSummary
+	for _, account := range accounts {
+		item := AccountLoad{
+			AccountID:    account.ID,
+			Name:         account.Name,
+			Type:         string(account.Type),
+			Status:       string(account.Status),
+			Priority:     account.Priority,
+			HealthScore:  account.HealthScore,
+			Schedulable:  account.IsSchedulable(),
+			CircuitState: circuit.StateClosed.String(),
+		}
+		if !item.Schedulable {
+			item.UnschedulableReason = unschedulableReason(account)
+		}
+
+		if stats, ok := breakers[account.ID]; ok {
+			item.CircuitState = stats.State.String()
+			if stats.State == circuit.StateOpen {
+				summary.CircuitOpen++
+			}
+		}
+
+		if load, ok := loads[account.ID]; ok {
+			item.Current = load.Current
+			item.Max = load.Max
+			item.Waiting = load.Waiting
+			item.Total = load.Total
+			if load.Max > 0 {
+				item.Utilization = float64(load.Current) / float64(load.Max)
+			}
+			item.Saturated = (load.Max > 0 && load.Current >= load.Max) || load.Waiting > 0
+		}
+
+		summary.Accounts++
+		if item.Schedulable {
+			summary.Schedulable++
+		}
+		if item.Saturated {
+			summary.Saturated++
+		}
+		summary.ActiveSlots += item.Current
+		summary.TotalCapacity += item.Max
+		summary.Waiting += item.Waiting
+
+		result = append(result, item)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"accounts":   result,
+		"summary":    summary,
+		"updated_at": time.Now(),
+	})
+}
+
+// unschedulableReason explains why Account.IsSchedulable returned false
+func unschedulableReason(account *store.Account) string {
+	now := time.Now()
+	switch {
+	case account.Status != store.AccountStatusActive:
+		return "status " + string(account.Status)
+	case !account.Schedulable:
+		return "scheduling disabled"
+	case account.ExpiresAt != nil && now.After(*account.ExpiresAt):
+		return "token expired"
+	case account.OverloadUntil != nil && now.Before(*account.OverloadUntil):
+		return "overloaded"
+	case account.RateLimitResetAt != nil && now.Before(*account.RateLimitResetAt):
+		return "rate limited"
+	case account.TempUnschedulableUntil != nil && now.Before(*account.TempUnschedulableUntil):
+		if account.TempUnschedulableReason != "" {
+			return account.TempUnschedulableReason
+		}
+		return "temporarily unschedulable"
+	}
+	return ""
+}
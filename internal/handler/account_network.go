@@ -0,0 +1,59 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"ccproxy/internal/pool"
+	"ccproxy/internal/store"
+)
+
+// SetPool lets egress changes take effect on the next request by rebuilding
+// the account's pooled client
+func (h *AccountHandler) SetPool(p pool.Pool) {
+	h.pool = p
+}
+
+// GetAccountNetwork returns an account's egress configuration
+func (h *AccountHandler) GetAccountNetwork(c *gin.Context) {
+	account, ok := h.scheduleAccount(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"account_id": account.ID, "network": account.Network})
+}
+
+// UpdateAccountNetwork pins an account's upstream connections to static host
+// IPs, custom DNS servers and/or a local address; a null network restores the
+// default path. Open connections are dropped so the next request uses it.
+func (h *AccountHandler) UpdateAccountNetwork(c *gin.Context) {
+	account, ok := h.scheduleAccount(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Network *store.AccountNetwork `json:"network"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Network != nil {
+		if err := req.Network.Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if err := h.store.SetAccountNetwork(account.ID, req.Network); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update account network"})
+		return
+	}
+	if h.pool != nil {
+		h.pool.Reset(account.ID)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"account_id": account.ID, "network": req.Network})
+}
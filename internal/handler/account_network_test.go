@@ -0,0 +1,59 @@
+package handler
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"ccproxy/internal/store"
+)
+
+func TestAccountHandler_Network(t *testing.T) {
+	router, db := newAccountTestRouter(t)
+	accounts := NewAccountHandler(db, nil)
+	router.GET("/account/:id/network", accounts.GetAccountNetwork)
+	router.PUT("/account/:id/network", accounts.UpdateAccountNetwork)
+
+	if err := db.CreateAccount(&store.Account{
+		ID:          "acc-1",
+		Name:        "acc-1",
+		Type:        store.AccountTypeSessionKey,
+		Credentials: store.Credentials{SessionKey: "sk-ant-sid01-1"},
+		CreatedAt:   time.Now(),
+		IsActive:    true,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, body := range []string{
+		`{"network": {"hosts": {"claude.ai": "not-an-ip"}}}`,
+		`{"network": {"dns_servers": ["dns.example"]}}`,
+		`{"network": {"local_addr": "10.0.0"}}`,
+		`{"network": {}}`,
+	} {
+		if code, resp := doJSON(t, router, http.MethodPut, "/account/acc-1/network", body); code != http.StatusBadRequest {
+			t.Errorf("%s: got %d %v", body, code, resp)
+		}
+	}
+
+	code, resp := doJSON(t, router, http.MethodPut, "/account/acc-1/network",
+		`{"network": {"hosts": {"Claude.AI": "160.79.104.10"}, "dns_servers": ["1.1.1.1", "9.9.9.9:53"], "local_addr": "10.0.0.2"}}`)
+	if code != http.StatusOK {
+		t.Fatalf("update: %d %v", code, resp)
+	}
+
+	account, err := db.GetAccount("acc-1")
+	if err != nil || account.Network == nil {
+		t.Fatalf("stored network: %+v, %v", account, err)
+	}
+	if account.Network.Hosts["claude.ai"] != "160.79.104.10" || len(account.Network.DNSServers) != 2 || account.Network.LocalAddr != "10.0.0.2" {
+		t.Errorf("network = %+v", account.Network)
+	}
+
+	if code, _ := doJSON(t, router, http.MethodPut, "/account/acc-1/network", `{"network": null}`); code != http.StatusOK {
+		t.Errorf("clear: got %d", code)
+	}
+	if _, resp := doJSON(t, router, http.MethodGet, "/account/acc-1/network", ""); resp["network"] != nil {
+		t.Errorf("cleared network = %v", resp["network"])
+	}
+}
@@ -0,0 +1,166 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+
+	"ccproxy/internal/service"
+	"ccproxy/internal/store"
+)
+
+// NotesPassphraseHeader carries the passphrase account notes are sealed with
+const NotesPassphraseHeader = "X-Notes-Passphrase"
+
+// maxSecureNoteLength bounds the notes of an account
+const maxSecureNoteLength = 16 * 1024
+
+// SetAccountNotes seals the request's notes, e.g. recovery codes, under the
+// passphrase in X-Notes-Passphrase, replacing the account's notes
+func (h *AccountHandler) SetAccountNotes(c *gin.Context) {
+	account, ok := h.notesAccount(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Notes string `json:"notes" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(req.Notes) > maxSecureNoteLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "notes are too long"})
+		return
+	}
+
+	ciphertext, err := service.SealSecureNote(req.Notes, c.GetHeader(NotesPassphraseHeader))
+	if errors.Is(err, service.ErrSecureNotePassphrase) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": NotesPassphraseHeader + " header must be at least 8 characters"})
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Str("account_id", account.ID).Msg("failed to seal account notes")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to seal notes"})
+		return
+	}
+	if err := h.store.SetAccountSecureNote(account.ID, ciphertext); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save notes"})
+		return
+	}
+	h.auditNotes(c, store.AuditActionNotesUpdate, account.ID, nil)
+
+	note, err := h.store.GetAccountSecureNote(account.ID)
+	if err != nil || note == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get notes"})
+		return
+	}
+	c.JSON(http.StatusOK, note)
+}
+
+// GetAccountNotes reports whether an account has notes and when they
+// changed, without their content
+func (h *AccountHandler) GetAccountNotes(c *gin.Context) {
+	note, err := h.store.GetAccountSecureNote(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get notes"})
+		return
+	}
+	if note == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "account has no notes"})
+		return
+	}
+	c.JSON(http.StatusOK, note)
+}
+
+// RevealAccountNotes decrypts an account's notes with the passphrase in
+// X-Notes-Passphrase. Every attempt is recorded in the audit log.
+func (h *AccountHandler) RevealAccountNotes(c *gin.Context) {
+	id := c.Param("id")
+	note, err := h.store.GetAccountSecureNote(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get notes"})
+		return
+	}
+	if note == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "account has no notes"})
+		return
+	}
+
+	notes, err := service.OpenSecureNote(note.Ciphertext, c.GetHeader(NotesPassphraseHeader))
+	if err != nil {
+		h.auditNotes(c, store.AuditActionNotesReveal, id, map[string]interface{}{"success": false})
+		if errors.Is(err, service.ErrSecureNotePassphrase) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": NotesPassphraseHeader + " header is required"})
+			return
+		}
+		if errors.Is(err, service.ErrSecureNoteInvalid) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "wrong passphrase"})
+			return
+		}
+		log.Error().Err(err).Str("account_id", id).Msg("failed to open account notes")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to open notes"})
+		return
+	}
+	h.auditNotes(c, store.AuditActionNotesReveal, id, map[string]interface{}{"success": true})
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, gin.H{
+		"account_id": id,
+		"notes":      notes,
+		"updated_at": note.UpdatedAt,
+	})
+}
+
+// DeleteAccountNotes removes an account's notes; no passphrase is needed
+func (h *AccountHandler) DeleteAccountNotes(c *gin.Context) {
+	id := c.Param("id")
+	deleted, err := h.store.DeleteAccountSecureNote(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete notes"})
+		return
+	}
+	if !deleted {
+		c.JSON(http.StatusNotFound, gin.H{"error": "account has no notes"})
+		return
+	}
+	h.auditNotes(c, store.AuditActionNotesUpdate, id, map[string]interface{}{"deleted": true})
+
+	c.JSON(http.StatusOK, gin.H{"message": "notes deleted"})
+}
+
+func (h *AccountHandler) notesAccount(c *gin.Context) (*store.Account, bool) {
+	account, err := h.store.GetAccount(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get account"})
+		return nil, false
+	}
+	if account == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "account not found"})
+		return nil, false
+	}
+	return account, true
+}
+
+func (h *AccountHandler) auditNotes(c *gin.Context, action, accountID string, details map[string]interface{}) {
+	if details == nil {
+		details = map[string]interface{}{}
+	}
+	details["client_ip"] = c.ClientIP()
+	entry := &store.AuditEntry{
+		ID:        "aud_" + uuid.New().String(),
+		CreatedAt: time.Now(),
+		Action:    action,
+		Actor:     auditActor(c),
+		Subject:   accountID,
+		Details:   details,
+	}
+	if err := h.store.CreateAuditEntry(entry); err != nil {
+		log.Error().Err(err).Str("action", action).Str("account_id", accountID).Msg("failed to record notes audit entry")
+	}
+}
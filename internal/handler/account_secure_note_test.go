@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"ccproxy/internal/middleware"
+	"ccproxy/internal/store"
+)
+
+func TestAccountHandler_SecureNotes(t *testing.T) {
+	router, db := newAccountTestRouter(t)
+	accounts := NewAccountHandler(db, nil)
+	router.GET("/account/list", accounts.ListAccounts)
+	router.GET("/account/:id/notes", accounts.GetAccountNotes)
+	router.PUT("/account/:id/notes", accounts.SetAccountNotes)
+	signedIn := func(c *gin.Context) { c.Set(middleware.ContextKeyAdminSubject, "ops@example.com") }
+	router.POST("/account/:id/notes/reveal", signedIn, accounts.RevealAccountNotes)
+	router.DELETE("/account/:id/notes", accounts.DeleteAccountNotes)
+
+	account := &store.Account{ID: "acc-1", Name: "acc-1", Type: store.AccountTypeSessionKey, IsActive: true,
+		CreatedAt: time.Now(), Credentials: store.Credentials{SessionKey: "sk-ant-sid01-1"}}
+	if err := db.CreateAccount(account); err != nil {
+		t.Fatal(err)
+	}
+
+	do := func(method, path, passphrase, body string) (int, string) {
+		t.Helper()
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		if passphrase != "" {
+			req.Header.Set(NotesPassphraseHeader, passphrase)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code, w.Body.String()
+	}
+
+	const codes = "backup codes: 1234-5678 8765-4321"
+	body := `{"notes":"` + codes + `"}`
+	if code, _ := do(http.MethodPut, "/account/acc-1/notes", "short", body); code != http.StatusBadRequest {
+		t.Errorf("short passphrase: got %d", code)
+	}
+	if code, _ := do(http.MethodPut, "/account/acc-none/notes", "long passphrase", body); code != http.StatusNotFound {
+		t.Errorf("missing account: got %d", code)
+	}
+	if code, _ := do(http.MethodGet, "/account/acc-1/notes", "", ""); code != http.StatusNotFound {
+		t.Errorf("no notes yet: got %d", code)
+	}
+	if code, resp := do(http.MethodPut, "/account/acc-1/notes", "long passphrase", body); code != http.StatusOK {
+		t.Fatalf("set notes: %d %s", code, resp)
+	}
+
+	// Neither the notes nor their ciphertext leave the store unasked
+	for _, path := range []string{"/account/acc-1/notes", "/account/list"} {
+		code, resp := do(http.MethodGet, path, "", "")
+		if code != http.StatusOK || strings.Contains(resp, "1234-5678") || strings.Contains(resp, "ciphertext") {
+			t.Errorf("GET %s: %d %s", path, code, resp)
+		}
+	}
+	if note, _ := db.GetAccountSecureNote("acc-1"); note == nil || strings.Contains(note.Ciphertext, "1234") {
+		t.Errorf("stored note = %+v", note)
+	}
+
+	if code, _ := do(http.MethodPost, "/account/acc-1/notes/reveal", "", ""); code != http.StatusBadRequest {
+		t.Errorf("reveal without passphrase: got %d", code)
+	}
+	if code, _ := do(http.MethodPost, "/account/acc-1/notes/reveal", "wrong passphrase", ""); code != http.StatusForbidden {
+		t.Errorf("reveal with wrong passphrase: got %d", code)
+	}
+	code, resp := do(http.MethodPost, "/account/acc-1/notes/reveal", "long passphrase", "")
+	var revealed struct {
+		Notes string `json:"notes"`
+	}
+	json.Unmarshal([]byte(resp), &revealed)
+	if code != http.StatusOK || revealed.Notes != codes {
+		t.Errorf("reveal: %d %s", code, resp)
+	}
+
+	entries, err := db.ListAuditEntries(store.AuditFilter{Action: store.AuditActionNotesReveal})
+	if err != nil || len(entries) != 3 {
+		t.Errorf("reveal audit entries = %d, %v", len(entries), err)
+	}
+	for _, e := range entries {
+		if e.Actor != "ops@example.com" {
+			t.Errorf("reveal audit actor = %q, want the signed-in admin", e.Actor)
+		}
+	}
+
+	if code, _ := do(http.MethodDelete, "/account/acc-1/notes", "", ""); code != http.StatusOK {
+		t.Errorf("delete notes: got %d", code)
+	}
+	if code, _ := do(http.MethodPost, "/account/acc-1/notes/reveal", "long passphrase", ""); code != http.StatusNotFound {
+		t.Errorf("reveal deleted notes: got %d", code)
+	}
+}
@@ -0,0 +1,223 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"ccproxy/internal/store"
+)
+
+// AccountTemplateHandler manages templates of default account settings
+// (priority, max_concurrency, groups, labels) used when onboarding accounts
+type AccountTemplateHandler struct {
+	store *store.Store
+}
+
+func NewAccountTemplateHandler(store *store.Store) *AccountTemplateHandler {
+	return &AccountTemplateHandler{store: store}
+}
+
+// accountSettingsRequest is a partial update of account settings
+type accountSettingsRequest struct {
+	Priority       *int              `json:"priority"`
+	MaxConcurrency *int              `json:"max_concurrency"`
+	Groups         []string          `json:"groups"`
+	Labels         map[string]string `json:"labels"`
+}
+
+// apply merges the fields present in the request into settings and validates the result
+func (r *accountSettingsRequest) apply(settings *store.AccountSettings) error {
+	if r.Priority != nil {
+		settings.Priority = *r.Priority
+	}
+	if r.MaxConcurrency != nil {
+		settings.MaxConcurrency = *r.MaxConcurrency
+	}
+	if r.Groups != nil {
+		settings.Groups = r.Groups
+	}
+	if r.Labels != nil {
+		settings.Labels = r.Labels
+	}
+	return normalizeAccountSettings(settings)
+}
+
+// normalizeAccountSettings trims and de-duplicates groups and rejects invalid values
+func normalizeAccountSettings(settings *store.AccountSettings) error {
+	if settings.MaxConcurrency < 1 {
+		return fmt.Errorf("max_concurrency must be at least 1")
+	}
+
+	groups := make([]string, 0, len(settings.Groups))
+	seen := make(map[string]bool)
+	for _, group := range settings.Groups {
+		group = strings.TrimSpace(group)
+		if group == "" {
+			return fmt.Errorf("groups must not be empty")
+		}
+		if !seen[group] {
+			seen[group] = true
+			groups = append(groups, group)
+		}
+	}
+	settings.Groups = groups
+
+	if settings.Labels == nil {
+		settings.Labels = map[string]string{}
+	}
+	for key := range settings.Labels {
+		if strings.TrimSpace(key) == "" {
+			return fmt.Errorf("label keys must not be empty")
+		}
+	}
+	return nil
+}
+
+// ListTemplates lists all account templates
+func (h *AccountTemplateHandler) ListTemplates(c *gin.Context) {
+	templates, err := h.store.ListAccountTemplates()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list account templates"})
+		return
+	}
+	if templates == nil {
+		templates = []*store.AccountTemplate{}
+	}
+
+	c.JSON(http.StatusOK, templates)
+}
+
+// CreateTemplate creates an account template
+func (h *AccountTemplateHandler) CreateTemplate(c *gin.Context) {
+	var req struct {
+		Name        string `json:"name" binding:"required"`
+		Description string `json:"description"`
+		accountSettingsRequest
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	existing, err := h.store.GetAccountTemplate(req.Name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get account template"})
+		return
+	}
+	if existing != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "account template already exists"})
+		return
+	}
+
+	now := time.Now()
+	template := &store.AccountTemplate{
+		ID:              "tpl_" + uuid.New().String(),
+		Name:            req.Name,
+		Description:     req.Description,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+		AccountSettings: store.AccountSettings{MaxConcurrency: store.DefaultMaxConcurrency},
+	}
+	if err := req.apply(&template.AccountSettings); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.store.CreateAccountTemplate(template); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create account template"})
+		return
+	}
+
+	c.JSON(http.StatusOK, template)
+}
+
+// GetTemplate returns an account template by ID or name
+func (h *AccountTemplateHandler) GetTemplate(c *gin.Context) {
+	template, ok := h.template(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, template)
+}
+
+// UpdateTemplate updates the fields present in the request. Accounts already
+// created from the template are not changed.
+func (h *AccountTemplateHandler) UpdateTemplate(c *gin.Context) {
+	template, ok := h.template(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Name        string  `json:"name"`
+		Description *string `json:"description"`
+		accountSettingsRequest
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Name != "" && req.Name != template.Name {
+		existing, err := h.store.GetAccountTemplate(req.Name)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get account template"})
+			return
+		}
+		if existing != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "account template already exists"})
+			return
+		}
+		template.Name = req.Name
+	}
+	if req.Description != nil {
+		template.Description = *req.Description
+	}
+	if err := req.apply(&template.AccountSettings); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	template.UpdatedAt = time.Now()
+
+	if err := h.store.UpdateAccountTemplate(template); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update account template"})
+		return
+	}
+
+	c.JSON(http.StatusOK, template)
+}
+
+// DeleteTemplate deletes an account template
+func (h *AccountTemplateHandler) DeleteTemplate(c *gin.Context) {
+	template, ok := h.template(c)
+	if !ok {
+		return
+	}
+
+	if err := h.store.DeleteAccountTemplate(template.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete account template"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "account template deleted"})
+}
+
+// template loads the template named in the path
+func (h *AccountTemplateHandler) template(c *gin.Context) (*store.AccountTemplate, bool) {
+	template, err := h.store.GetAccountTemplate(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get account template"})
+		return nil, false
+	}
+	if template == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "account template not found"})
+		return nil, false
+	}
+	return template, true
+}
@@ -0,0 +1,122 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"ccproxy/internal/store"
+)
+
+func newAccountTestRouter(t *testing.T) (*gin.Engine, *store.Store) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	db, err := store.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	accounts := NewAccountHandler(db, nil)
+	templates := NewAccountTemplateHandler(db)
+	router := gin.New()
+	router.POST("/account/sessionkey", accounts.CreateSessionKeyAccount)
+	router.GET("/account/templates", templates.ListTemplates)
+	router.POST("/account/templates", templates.CreateTemplate)
+	router.PUT("/account/templates/:id", templates.UpdateTemplate)
+	router.GET("/account/:id", accounts.GetAccount)
+	router.PUT("/account/:id", accounts.UpdateAccount)
+	router.POST("/account/:id/clone", accounts.CloneAccount)
+	router.GET("/account/:id/schedule", accounts.GetAccountSchedule)
+	router.PUT("/account/:id/schedule", accounts.UpdateAccountSchedule)
+	return router, db
+}
+
+func doJSON(t *testing.T, router *gin.Engine, method, path, body string) (int, map[string]interface{}) {
+	t.Helper()
+	req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var resp map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	return w.Code, resp
+}
+
+func TestAccountTemplates_AppliedOnCreateAndClone(t *testing.T) {
+	router, db := newAccountTestRouter(t)
+
+	code, tpl := doJSON(t, router, http.MethodPost, "/account/templates",
+		`{"name":"team-a","priority":2,"max_concurrency":3,"groups":["team-a"," team-a ","batch"],"labels":{"env":"prod"}}`)
+	if code != http.StatusOK {
+		t.Fatalf("create template: %d %v", code, tpl)
+	}
+	if code, _ := doJSON(t, router, http.MethodPost, "/account/templates", `{"name":"team-a"}`); code != http.StatusConflict {
+		t.Errorf("duplicate template name: got %d", code)
+	}
+	if code, _ := doJSON(t, router, http.MethodPost, "/account/templates", `{"name":"bad","max_concurrency":0}`); code != http.StatusBadRequest {
+		t.Errorf("invalid max_concurrency: got %d", code)
+	}
+
+	// Templates can be referenced by name
+	code, created := doJSON(t, router, http.MethodPost, "/account/sessionkey",
+		`{"name":"acct-1","session_key":"sk-ant-sid01-one","organization_id":"org-1","template_id":"team-a"}`)
+	if code != http.StatusOK {
+		t.Fatalf("create account: %d %v", code, created)
+	}
+	id := created["id"].(string)
+
+	settings, err := db.GetAccountSettings(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settings.Priority != 2 || settings.MaxConcurrency != 3 || len(settings.Groups) != 2 || settings.Labels["env"] != "prod" {
+		t.Errorf("unexpected settings from template: %+v", settings)
+	}
+
+	if code, _ := doJSON(t, router, http.MethodPost, "/account/sessionkey",
+		`{"name":"acct-x","session_key":"sk-ant-sid01-x","template_id":"missing"}`); code != http.StatusBadRequest {
+		t.Errorf("unknown template: got %d", code)
+	}
+
+	// Editing the account does not touch the template
+	if code, resp := doJSON(t, router, http.MethodPut, "/account/"+id, `{"labels":{"env":"staging"}}`); code != http.StatusOK {
+		t.Fatalf("update account: %d %v", code, resp)
+	}
+
+	// Clones get new credentials and the source's settings
+	if code, _ := doJSON(t, router, http.MethodPost, "/account/"+id+"/clone", `{"name":"acct-2"}`); code != http.StatusBadRequest {
+		t.Errorf("clone without credentials: got %d", code)
+	}
+	code, clone := doJSON(t, router, http.MethodPost, "/account/"+id+"/clone", `{"name":"acct-2","session_key":"sk-ant-sid01-two"}`)
+	if code != http.StatusOK {
+		t.Fatalf("clone: %d %v", code, clone)
+	}
+	if clone["cloned_from"] != id || clone["organization_id"] != "org-1" {
+		t.Errorf("unexpected clone: %v", clone)
+	}
+
+	code, account := doJSON(t, router, http.MethodGet, "/account/"+clone["id"].(string), "")
+	if code != http.StatusOK {
+		t.Fatalf("get clone: %d", code)
+	}
+	labels, _ := account["labels"].(map[string]interface{})
+	if account["priority"] != float64(2) || account["max_concurrency"] != float64(3) || labels["env"] != "staging" {
+		t.Errorf("clone settings not copied: %v", account)
+	}
+
+	cloned, err := db.GetAccount(clone["id"].(string))
+	if err != nil || cloned == nil {
+		t.Fatal(err)
+	}
+	if cloned.Credentials.SessionKey != "sk-ant-sid01-two" {
+		t.Errorf("clone credentials = %+v", cloned.Credentials)
+	}
+}
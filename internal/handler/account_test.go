@@ -0,0 +1,151 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"ccproxy/internal/store"
+)
+
+func TestAccountSchedule_Allows(t *testing.T) {
+	overnight := &store.AccountSchedule{
+		TimeZone: "Asia/Shanghai",
+		Windows:  []store.ScheduleWindow{{Start: "22:00", End: "06:00"}},
+	}
+	if err := overnight.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	// 15:00 UTC is 23:00 in Shanghai, 00:00 UTC is 08:00
+	if !overnight.Allows(time.Date(2025, 1, 1, 15, 0, 0, 0, time.UTC)) {
+		t.Error("23:00 local should be inside the overnight window")
+	}
+	if overnight.Allows(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Error("08:00 local should be outside the overnight window")
+	}
+
+	for _, bad := range []*store.AccountSchedule{
+		{TimeZone: "Mars/Olympus", Windows: []store.ScheduleWindow{{Start: "00:00", End: "08:00"}}},
+		{Windows: []store.ScheduleWindow{{Start: "8am", End: "10:00"}}},
+		{Windows: []store.ScheduleWindow{{Start: "08:00", End: "08:00"}}},
+		{Windows: nil},
+	} {
+		if err := bad.Validate(); err == nil {
+			t.Errorf("expected error for %+v", bad)
+		}
+	}
+}
+
+func TestAccountHandler_Schedule(t *testing.T) {
+	router, db := newAccountTestRouter(t)
+	code, created := doJSON(t, router, http.MethodPost, "/account/sessionkey",
+		`{"name":"night-owl","session_key":"sk-ant-sid01-one"}`)
+	if code != http.StatusOK {
+		t.Fatalf("create account: %d %v", code, created)
+	}
+	id := created["id"].(string)
+
+	schedulable := func() bool {
+		accounts, err := db.GetSchedulableAccounts()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, account := range accounts {
+			if account.ID == id {
+				return true
+			}
+		}
+		return false
+	}
+	if !schedulable() {
+		t.Fatal("account without a schedule should be schedulable")
+	}
+
+	now := time.Now().UTC()
+	clock := func(d time.Duration) string { return now.Add(d).Format("15:04") }
+
+	if code, _ := doJSON(t, router, http.MethodPut, "/account/"+id+"/schedule",
+		`{"schedule":{"time_zone":"Nowhere/City","windows":[{"start":"00:00","end":"08:00"}]}}`); code != http.StatusBadRequest {
+		t.Errorf("invalid time zone: got %d", code)
+	}
+
+	body := fmt.Sprintf(`{"schedule":{"time_zone":"UTC","windows":[{"start":%q,"end":%q}]}}`, clock(2*time.Hour), clock(3*time.Hour))
+	code, resp := doJSON(t, router, http.MethodPut, "/account/"+id+"/schedule", body)
+	if code != http.StatusOK || resp["in_schedule_window"] != false {
+		t.Fatalf("set schedule: %d %v", code, resp)
+	}
+	if schedulable() {
+		t.Error("account outside its window should not be schedulable")
+	}
+	_, detail := doJSON(t, router, http.MethodGet, "/account/"+id, "")
+	if detail["schedule"] == nil || detail["in_schedule_window"] != false {
+		t.Errorf("schedule missing from account detail: %v", detail)
+	}
+
+	body = fmt.Sprintf(`{"schedule":{"windows":[{"start":%q,"end":%q}]}}`, clock(-time.Hour), clock(time.Hour))
+	if code, resp := doJSON(t, router, http.MethodPut, "/account/"+id+"/schedule", body); code != http.StatusOK || resp["in_schedule_window"] != true {
+		t.Fatalf("set schedule: %d %v", code, resp)
+	}
+	if !schedulable() {
+		t.Error("account inside its window should be schedulable")
+	}
+
+	if code, resp := doJSON(t, router, http.MethodPut, "/account/"+id+"/schedule", `{"schedule":null}`); code != http.StatusOK || resp["schedule"] != nil {
+		t.Fatalf("clear schedule: %d %v", code, resp)
+	}
+}
+
+func TestAccountHandler_ExtraCookies(t *testing.T) {
+	router, db := newAccountTestRouter(t)
+	code, created := doJSON(t, router, http.MethodPost, "/account/sessionkey",
+		`{"name":"cf","session_key":"sk-ant-sid01-one"}`)
+	if code != http.StatusOK {
+		t.Fatalf("create account: %d %v", code, created)
+	}
+	id := created["id"].(string)
+
+	for _, bad := range []string{
+		`{"extra_cookies":{"sessionKey":"other"}}`,
+		`{"extra_cookies":{"bad name":"x"}}`,
+		`{"extra_cookies":{"cf_clearance":"a;b"}}`,
+	} {
+		if code, resp := doJSON(t, router, http.MethodPut, "/account/"+id, bad); code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d %v", bad, code, resp)
+		}
+	}
+
+	if code, resp := doJSON(t, router, http.MethodPut, "/account/"+id,
+		`{"extra_cookies":{"cf_clearance":"abc.123-0","intercom-device-id-lupk8zyo":"d1"}}`); code != http.StatusOK {
+		t.Fatalf("update cookies: %d %v", code, resp)
+	}
+	account, err := db.GetAccount(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := account.WebCookieHeader(), "sessionKey=sk-ant-sid01-one; cf_clearance=abc.123-0; intercom-device-id-lupk8zyo=d1"; got != want {
+		t.Errorf("cookie header = %q, want %q", got, want)
+	}
+
+	// Values are not returned, only names
+	_, detail := doJSON(t, router, http.MethodGet, "/account/"+id, "")
+	if fmt.Sprint(detail["extra_cookies"]) != "[cf_clearance intercom-device-id-lupk8zyo]" {
+		t.Errorf("extra_cookies = %v", detail["extra_cookies"])
+	}
+
+	// Updates without extra_cookies keep them; {} clears them
+	doJSON(t, router, http.MethodPut, "/account/"+id, `{"name":"renamed"}`)
+	if account, _ = db.GetAccount(id); len(account.Credentials.ExtraCookies) != 2 {
+		t.Errorf("cookies lost on unrelated update: %v", account.Credentials.ExtraCookies)
+	}
+	doJSON(t, router, http.MethodPut, "/account/"+id, `{"extra_cookies":{}}`)
+	if account, _ = db.GetAccount(id); account.WebCookieHeader() != "sessionKey=sk-ant-sid01-one" {
+		t.Errorf("cookie header after clearing = %q", account.WebCookieHeader())
+	}
+
+	// OAuth accounts send only their extra cookies
+	oauth := &store.Account{Type: store.AccountTypeOAuth, Credentials: store.Credentials{ExtraCookies: map[string]string{"cf_clearance": "x"}}}
+	if got := oauth.WebCookieHeader(); got != "cf_clearance=x" {
+		t.Errorf("oauth cookie header = %q", got)
+	}
+}
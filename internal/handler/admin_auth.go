@@ -0,0 +1,146 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+
+	"ccproxy/internal/middleware"
+	"ccproxy/internal/service"
+	"ccproxy/internal/store"
+	"ccproxy/pkg/jwt"
+)
+
+// AdminAuthHandler signs administrators in through OIDC and issues admin
+// sessions, so the static admin key does not have to be shared
+type AdminAuthHandler struct {
+	provider          *service.OIDCProvider
+	jwtManager        *jwt.Manager
+	store             *store.Store
+	sessionTTL        time.Duration
+	postLoginRedirect string
+	secureCookie      bool
+}
+
+func NewAdminAuthHandler(provider *service.OIDCProvider, jwtManager *jwt.Manager, store *store.Store, sessionTTL time.Duration, postLoginRedirect, redirectURL string) *AdminAuthHandler {
+	if sessionTTL <= 0 {
+		sessionTTL = 8 * time.Hour
+	}
+	if postLoginRedirect == "" {
+		postLoginRedirect = "/admin/"
+	}
+	return &AdminAuthHandler{
+		provider:          provider,
+		jwtManager:        jwtManager,
+		store:             store,
+		sessionTTL:        sessionTTL,
+		postLoginRedirect: postLoginRedirect,
+		secureCookie:      strings.HasPrefix(redirectURL, "https://"),
+	}
+}
+
+// Login redirects the browser to the identity provider
+func (h *AdminAuthHandler) Login(c *gin.Context) {
+	authURL, err := h.provider.AuthURL(c.Request.Context())
+	if err != nil {
+		log.Error().Err(err).Msg("failed to start OIDC login")
+		c.JSON(http.StatusBadGateway, gin.H{"error": "identity provider unavailable"})
+		return
+	}
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// Callback completes the login, sets the session cookie and redirects to the admin UI
+func (h *AdminAuthHandler) Callback(c *gin.Context) {
+	if errCode := c.Query("error"); errCode != "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "login failed: " + errCode, "description": c.Query("error_description")})
+		return
+	}
+	code, state := c.Query("code"), c.Query("state")
+	if code == "" || state == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "code and state are required"})
+		return
+	}
+
+	identity, err := h.provider.Exchange(c.Request.Context(), code, state)
+	switch {
+	case errors.Is(err, service.ErrOIDCInvalidState):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, service.ErrOIDCNoRole):
+		log.Warn().Str("sub", identity.Subject).Str("email", identity.Email).Strs("groups", identity.Groups).Msg("OIDC login denied: no admin role")
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		log.Error().Err(err).Msg("OIDC login failed")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "login failed"})
+		return
+	}
+
+	token, claims, err := h.jwtManager.GenerateAdminSession(identity.Subject, identity.Name, identity.Email, identity.Role, h.sessionTTL)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create session"})
+		return
+	}
+	session := &store.AdminSession{ID: claims.ID, Subject: identity.Subject, CreatedAt: claims.IssuedAt.Time, ExpiresAt: claims.ExpiresAt.Time}
+	if err := h.store.CreateAdminSession(session); err != nil {
+		log.Error().Err(err).Str("sub", identity.Subject).Msg("failed to record admin session")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create session"})
+		return
+	}
+
+	entry := &store.AuditEntry{
+		ID:        "aud_" + uuid.New().String(),
+		CreatedAt: time.Now(),
+		Action:    store.AuditActionAdminLogin,
+		Actor:     identity.Subject,
+		Subject:   identity.Subject,
+		Details: map[string]interface{}{
+			"email":      identity.Email,
+			"name":       identity.Name,
+			"groups":     identity.Groups,
+			"role":       identity.Role,
+			"session_id": claims.ID,
+			"client_ip":  c.ClientIP(),
+		},
+	}
+	if err := h.store.CreateAuditEntry(entry); err != nil {
+		log.Error().Err(err).Str("sub", identity.Subject).Msg("failed to record admin login")
+	}
+
+	log.Info().Str("sub", identity.Subject).Str("email", identity.Email).Str("role", identity.Role).Msg("admin signed in via OIDC")
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(middleware.AdminSessionCookie, token, int(h.sessionTTL.Seconds()), "/", "", h.secureCookie, true)
+	c.Redirect(http.StatusFound, h.postLoginRedirect)
+}
+
+// Logout revokes the session and clears the session cookie, so a copy of the
+// session token cannot be used any more either
+func (h *AdminAuthHandler) Logout(c *gin.Context) {
+	if tokenString := middleware.AdminSessionToken(c); tokenString != "" {
+		if claims, err := h.jwtManager.ValidateAdminSession(tokenString); err == nil {
+			if err := h.store.RevokeAdminSession(claims.ID); err != nil {
+				log.Error().Err(err).Str("sub", claims.Subject).Msg("failed to revoke admin session")
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to sign out"})
+				return
+			}
+		}
+	}
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(middleware.AdminSessionCookie, "", -1, "/", "", h.secureCookie, true)
+	c.JSON(http.StatusOK, gin.H{"message": "signed out"})
+}
+
+// Me returns the authenticated administrator and role. It works for both the
+// admin key and SSO sessions.
+func (h *AdminAuthHandler) Me(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"subject": c.GetString(middleware.ContextKeyAdminSubject),
+		"role":    c.GetString(middleware.ContextKeyAdminRole),
+	})
+}
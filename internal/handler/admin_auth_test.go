@@ -0,0 +1,62 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"ccproxy/internal/middleware"
+	"ccproxy/internal/store"
+	"ccproxy/pkg/jwt"
+)
+
+func TestAdminAuthHandler_LogoutRevokesSession(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, err := store.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	manager := jwt.NewManager("test-secret-test-secret-test-secret", "ccproxy")
+	admin := middleware.NewAdminMiddleware("admin-key-admin-key")
+	admin.EnableSessions(manager, db)
+	h := NewAdminAuthHandler(nil, manager, db, time.Hour, "", "https://admin.example.com/callback")
+
+	router := gin.New()
+	router.POST("/api/auth/logout", h.Logout)
+	router.GET("/api/auth/me", admin.Auth(), h.Me)
+
+	token, claims, err := manager.GenerateAdminSession("user-1", "Alice", "alice@example.com", middleware.AdminRoleAdmin, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CreateAdminSession(&store.AdminSession{ID: claims.ID, Subject: "user-1", CreatedAt: claims.IssuedAt.Time, ExpiresAt: claims.ExpiresAt.Time}); err != nil {
+		t.Fatal(err)
+	}
+	do := func(method, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.AddCookie(&http.Cookie{Name: middleware.AdminSessionCookie, Value: token})
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do(http.MethodGet, "/api/auth/me"); w.Code != http.StatusOK {
+		t.Fatalf("before logout: status = %d %s", w.Code, w.Body.String())
+	}
+	if w := do(http.MethodPost, "/api/auth/logout"); w.Code != http.StatusOK {
+		t.Fatalf("logout: status = %d %s", w.Code, w.Body.String())
+	}
+	// A copy of the token kept past logout is rejected
+	if w := do(http.MethodGet, "/api/auth/me"); w.Code != http.StatusUnauthorized {
+		t.Errorf("after logout: status = %d, want 401", w.Code)
+	}
+	session, err := db.GetAdminSession(claims.ID)
+	if err != nil || session == nil || session.RevokedAt == nil {
+		t.Errorf("session = %+v, %v, want it revoked", session, err)
+	}
+}
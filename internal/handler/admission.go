@@ -0,0 +1,293 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+
+	"ccproxy/internal/middleware"
+	"ccproxy/internal/ratelimit"
+	"ccproxy/internal/store"
+)
+
+const (
+	// admissionContextTokens is the context window of current Claude models
+	admissionContextTokens = 200000
+	// admissionDefaultDuration stands in for the typical request duration of
+	// models without recent requests
+	admissionDefaultDuration = 30 * time.Second
+)
+
+// AdmissionRequest describes a hypothetical request
+type AdmissionRequest struct {
+	Model       string `json:"model" binding:"required"`
+	InputTokens int    `json:"input_tokens"` // Estimated prompt size
+	MaxTokens   int    `json:"max_tokens"`
+	EndUserID   string `json:"user,omitempty"` // metadata.user_id of the request, if any
+}
+
+// AdmissionReason is a check that would reject the request, or make it wait
+type AdmissionReason struct {
+	Check   string     `json:"check"` // rate_limit, concurrency, accounts, context_window, request_budget
+	Message string     `json:"message"`
+	WaitMs  int64      `json:"wait_ms,omitempty"`
+	RetryAt *time.Time `json:"retry_at,omitempty"`
+}
+
+// AdmissionAccounts summarizes the accounts or keys that could serve a request
+type AdmissionAccounts struct {
+	Mode        string     `json:"mode"`
+	Available   int        `json:"available"`              // Accounts the request could be scheduled on
+	Overloaded  int        `json:"overloaded"`             // Cooling down for the model
+	CircuitOpen int        `json:"circuit_open"`           // Excluded by open circuit breakers
+	FreeSlots   int        `json:"free_slots"`             // Unused concurrency slots on available accounts
+	APIKeys     int        `json:"api_keys,omitempty"`     // Healthy pooled keys in API mode
+	NextFreeAt  *time.Time `json:"next_free_at,omitempty"` // When the first model cooldown ends
+}
+
+// Admission evaluates rate limits, concurrency, schedulable accounts and the
+// token's request budget for a hypothetical request without sending or
+// counting it, so clients can back off before uploading a large payload.
+// The response is 200 with allowed=false when the request would be rejected.
+func (h *EnhancedProxyHandler) Admission(c *gin.Context) {
+	var req AdmissionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.InputTokens < 0 || req.MaxTokens < 0 || req.MaxTokens > maxTokensLimit {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("input_tokens must not be negative and max_tokens must be between 0 and %d", maxTokensLimit)})
+		return
+	}
+
+	tokenID := c.GetString(middleware.ContextKeyTokenID)
+	quotaID := middleware.QuotaSubject(c, tokenID)
+	mode := h.determineMode(c)
+	now := time.Now()
+	typical := h.typicalDuration(req.Model, now)
+
+	var denied, waits []AdmissionReason
+
+	if total := req.InputTokens + req.MaxTokens; total > admissionContextTokens {
+		denied = append(denied, AdmissionReason{
+			Check:   "context_window",
+			Message: fmt.Sprintf("%d input and output tokens exceed the %d token context window", total, admissionContextTokens),
+		})
+	}
+
+	// Rate limits, without counting the request
+	limits := []ratelimit.LimitStatus{}
+	if h.ratelimit != nil {
+		bypass := rateLimitBypass(c)
+		ip := c.ClientIP()
+		if bypass.IP {
+			ip = ""
+		}
+		var statuses []ratelimit.LimitStatus
+		for _, status := range h.ratelimit.PeekAll(c.Request.Context(), quotaID, req.EndUserID, ip) {
+			if status.Name == ratelimit.ClassGlobal && bypass.Global {
+				continue
+			}
+			statuses = append(statuses, status)
+		}
+		for _, status := range statuses {
+			if status.Allowed {
+				continue
+			}
+			reason := AdmissionReason{
+				Check:   "rate_limit",
+				Message: fmt.Sprintf("%s rate limit of %d requests per %s reached", status.Name, status.Limit, status.Window),
+				RetryAt: status.RetryAt,
+			}
+			if status.RetryAt != nil {
+				reason.WaitMs = status.RetryAt.Sub(now).Milliseconds()
+			}
+			denied = append(denied, reason)
+		}
+		if statuses != nil {
+			limits = statuses
+		}
+	}
+
+	// User concurrency slots
+	resp := gin.H{}
+	if h.concurrency != nil {
+		load := h.concurrency.GetUserLoad(quotaID)
+		resp["user_concurrency"] = load
+		if wait := slotWait(load.Current, load.Max, load.Waiting, typical); wait > 0 {
+			waits = append(waits, AdmissionReason{
+				Check:   "concurrency",
+				Message: fmt.Sprintf("all %d concurrent request slots of the token are in use, %d requests waiting", load.Max, load.Waiting),
+				WaitMs:  wait.Milliseconds(),
+			})
+		}
+	}
+
+	// Accounts or keys to serve the request
+	accounts, reason, err := h.admissionAccounts(mode, req.Model, typical, now)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to evaluate admission accounts")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list accounts"})
+		return
+	}
+	if reason != nil {
+		if reason.Check == "accounts" {
+			denied = append(denied, *reason)
+		} else {
+			waits = append(waits, *reason)
+		}
+	}
+
+	var waitMs int64
+	for _, r := range append(append([]AdmissionReason{}, denied...), waits...) {
+		if r.WaitMs > waitMs {
+			waitMs = r.WaitMs
+		}
+	}
+
+	// The token's end-to-end budget covers slot waits and the request itself
+	if budget := middleware.MaxRequestDuration(c); budget > 0 {
+		if expected := time.Duration(waitMs)*time.Millisecond + typical; expected > budget {
+			denied = append(denied, AdmissionReason{
+				Check:   "request_budget",
+				Message: fmt.Sprintf("expected wait and duration of %s exceed the token's max request duration of %s", expected.Round(time.Second), budget),
+			})
+		}
+	}
+
+	reasons := append(denied, waits...)
+	if reasons == nil {
+		reasons = []AdmissionReason{}
+	}
+	resp["allowed"] = len(denied) == 0
+	resp["mode"] = mode
+	resp["model"] = req.Model
+	resp["reasons"] = reasons
+	resp["estimated_wait_ms"] = waitMs
+	resp["typical_duration_ms"] = typical.Milliseconds()
+	resp["rate_limits"] = limits
+	resp["accounts"] = accounts
+	c.JSON(http.StatusOK, resp)
+}
+
+// admissionAccounts counts the accounts a request could be scheduled on the
+// way the proxy selects them, returning a reason when there are none or all
+// of them are busy
+func (h *EnhancedProxyHandler) admissionAccounts(mode, model string, typical time.Duration, now time.Time) (*AdmissionAccounts, *AdmissionReason, error) {
+	if mode == "api" && h.keyPool.Size() > 0 {
+		return &AdmissionAccounts{Mode: "api", Available: h.keyPool.Size(), APIKeys: h.keyPool.Size()}, nil, nil
+	}
+	result := &AdmissionAccounts{Mode: "web"}
+
+	accounts, err := h.store.ListAccounts()
+	if err != nil {
+		return nil, nil, err
+	}
+	var ids []string
+	for _, account := range accounts {
+		if account.IsActive && !account.IsExpired() {
+			ids = append(ids, account.ID)
+		}
+	}
+	// New requests are not scheduled on draining accounts
+	ids, _ = splitDraining(h.store, ids)
+	if len(ids) == 0 {
+		return result, &AdmissionReason{Check: "accounts", Message: "no active accounts available"}, nil
+	}
+
+	overloaded, err := h.store.GetModelOverloadedAccounts(model)
+	if err != nil {
+		return nil, nil, err
+	}
+	available := make([]string, 0, len(ids))
+	for _, id := range ids {
+		until, ok := overloaded[id]
+		if !ok {
+			available = append(available, id)
+			continue
+		}
+		result.Overloaded++
+		if result.NextFreeAt == nil || until.Before(*result.NextFreeAt) {
+			next := until
+			result.NextFreeAt = &next
+		}
+	}
+	if h.circuit != nil {
+		open := len(available)
+		available = h.circuit.GetAvailableAccounts(available)
+		result.CircuitOpen = open - len(available)
+	}
+	result.Available = len(available)
+
+	if len(available) == 0 {
+		reason := &AdmissionReason{Check: "accounts", Message: fmt.Sprintf("all accounts are overloaded for model %s or have open circuit breakers", model)}
+		if result.NextFreeAt != nil {
+			reason.RetryAt = result.NextFreeAt
+			reason.WaitMs = result.NextFreeAt.Sub(now).Milliseconds()
+		}
+		return result, reason, nil
+	}
+
+	if h.concurrency == nil {
+		return result, nil, nil
+	}
+	// The scheduler prefers the least loaded account, so the shortest wait applies
+	var shortest time.Duration = -1
+	for _, load := range h.concurrency.GetAccountLoad(available) {
+		if load.Max > load.Current {
+			result.FreeSlots += load.Max - load.Current
+		}
+		if wait := slotWait(load.Current, load.Max, load.Waiting, typical); shortest < 0 || wait < shortest {
+			shortest = wait
+		}
+	}
+	if shortest > 0 {
+		return result, &AdmissionReason{
+			Check:   "concurrency",
+			Message: fmt.Sprintf("all concurrent request slots of the %d available accounts are in use", len(available)),
+			WaitMs:  shortest.Milliseconds(),
+		}, nil
+	}
+	return result, nil, nil
+}
+
+// typicalDuration is the average duration of the model's requests in the
+// last hour, or admissionDefaultDuration without any
+func (h *EnhancedProxyHandler) typicalDuration(model string, now time.Time) time.Duration {
+	series, err := h.store.GetTimeseries(store.TimeseriesQuery{
+		From:        now.Add(-time.Hour),
+		To:          now,
+		Granularity: time.Hour,
+		Model:       model,
+	})
+	if err != nil {
+		log.Warn().Err(err).Str("model", model).Msg("failed to load recent request durations")
+		return admissionDefaultDuration
+	}
+
+	var weighted, requests int64
+	for _, s := range series {
+		for _, p := range s.Points {
+			if p.AvgDurationMs > 0 {
+				weighted += p.AvgDurationMs * p.Requests
+				requests += p.Requests
+			}
+		}
+	}
+	if requests == 0 {
+		return admissionDefaultDuration
+	}
+	return time.Duration(weighted/requests) * time.Millisecond
+}
+
+// slotWait estimates the wait for one of max slots with current in use and
+// waiting requests queued, assuming in-flight requests are halfway done
+func slotWait(current, max, waiting int, typical time.Duration) time.Duration {
+	if max <= 0 || current < max {
+		return 0
+	}
+	return typical/2 + time.Duration(waiting/max)*typical
+}
@@ -0,0 +1,113 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"ccproxy/internal/concurrency"
+	"ccproxy/internal/loadbalancer"
+	"ccproxy/internal/middleware"
+	"ccproxy/internal/ratelimit"
+	"ccproxy/internal/store"
+)
+
+func TestEnhancedProxyHandler_Admission(t *testing.T) {
+	router, db := newAccountTestRouter(t)
+
+	limiter := ratelimit.NewMultiMemoryLimiter(ratelimit.RateLimitConfig{
+		Enabled:   true,
+		UserLimit: ratelimit.LimitRule{Requests: 2, Window: time.Hour},
+	})
+	defer limiter.Close()
+	slots := concurrency.NewManager(concurrency.ConcurrencyConfig{UserMax: 1, AccountMax: 1, MaxWaitQueue: 5, WaitTimeout: time.Second})
+	defer slots.Close()
+
+	h := NewEnhancedProxyHandler(EnhancedProxyConfig{
+		Store:       db,
+		KeyPool:     loadbalancer.NewKeyPool(nil, loadbalancer.StrategyRoundRobin),
+		RateLimit:   limiter,
+		Concurrency: slots,
+	})
+	router.POST("/v1/admission", func(c *gin.Context) {
+		c.Set(middleware.ContextKeyTokenID, "tok-1")
+		c.Set(middleware.ContextKeyTokenMode, "web")
+	}, h.Admission)
+
+	admit := func(body string) map[string]interface{} {
+		t.Helper()
+		code, resp := doJSON(t, router, http.MethodPost, "/v1/admission", body)
+		if code != http.StatusOK {
+			t.Fatalf("admission: %d %v", code, resp)
+		}
+		return resp
+	}
+	checks := func(resp map[string]interface{}) []string {
+		var names []string
+		for _, r := range resp["reasons"].([]interface{}) {
+			names = append(names, r.(map[string]interface{})["check"].(string))
+		}
+		return names
+	}
+
+	// No accounts yet
+	resp := admit(`{"model": "claude-sonnet-4", "input_tokens": 1000, "max_tokens": 1024}`)
+	if resp["allowed"] != false || len(checks(resp)) != 1 || checks(resp)[0] != "accounts" {
+		t.Fatalf("without accounts: %v", resp)
+	}
+
+	if err := db.CreateAccount(&store.Account{
+		ID:          "acc-1",
+		Name:        "acc-1",
+		Type:        store.AccountTypeSessionKey,
+		Credentials: store.Credentials{SessionKey: "sk-ant-sid01-acc-1"},
+		CreatedAt:   time.Now(),
+		IsActive:    true,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	resp = admit(`{"model": "claude-sonnet-4", "input_tokens": 1000, "max_tokens": 1024}`)
+	if resp["allowed"] != true || len(checks(resp)) != 0 || resp["accounts"].(map[string]interface{})["free_slots"] != 1.0 {
+		t.Fatalf("with an idle account: %v", resp)
+	}
+
+	// Oversized payloads are rejected before they are sent
+	resp = admit(`{"model": "claude-sonnet-4", "input_tokens": 199000, "max_tokens": 4096}`)
+	if resp["allowed"] != false || checks(resp)[0] != "context_window" {
+		t.Errorf("oversized request: %v", resp)
+	}
+
+	// Busy slots make the request wait but do not reject it
+	ctx := context.Background()
+	if _, err := slots.AcquireUserSlot(ctx, "tok-1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := slots.AcquireAccountSlot(ctx, "acc-1", "tok-1"); err != nil {
+		t.Fatal(err)
+	}
+	resp = admit(`{"model": "claude-sonnet-4"}`)
+	if resp["allowed"] != true || len(checks(resp)) != 2 || resp["estimated_wait_ms"] != float64(admissionDefaultDuration.Milliseconds()/2) {
+		t.Errorf("busy slots: %v", resp)
+	}
+	slots.ReleaseUserSlot("tok-1")
+	slots.ReleaseAccountSlot("acc-1", "tok-1")
+
+	// Exhausted rate limits reject the request; admission checks are not counted
+	for i := 0; i < 2; i++ {
+		if result, _ := limiter.CheckUser(ctx, "tok-1"); !result.Allowed {
+			t.Fatal("admission checks were counted against the rate limit")
+		}
+	}
+	resp = admit(`{"model": "claude-sonnet-4"}`)
+	reasons := resp["reasons"].([]interface{})
+	if resp["allowed"] != false || checks(resp)[0] != "rate_limit" || reasons[0].(map[string]interface{})["retry_at"] == nil {
+		t.Errorf("rate limited: %v", resp)
+	}
+
+	if code, _ := doJSON(t, router, http.MethodPost, "/v1/admission", `{"max_tokens": 10}`); code != http.StatusBadRequest {
+		t.Errorf("missing model: got %d", code)
+	}
+}
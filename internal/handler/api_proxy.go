@@ -12,12 +12,14 @@ import (
 
 	"ccproxy/internal/httpclient"
 	"ccproxy/internal/loadbalancer"
+	"ccproxy/internal/service"
 )
 
 type APIProxyHandler struct {
 	keyPool   *loadbalancer.KeyPool
 	apiURL    string
 	reqClient *req.Client
+	beta      *service.BetaHeaders
 }
 
 func NewAPIProxyHandler(keyPool *loadbalancer.KeyPool, apiURL string) *APIProxyHandler {
@@ -28,6 +30,11 @@ func NewAPIProxyHandler(keyPool *loadbalancer.KeyPool, apiURL string) *APIProxyH
 	}
 }
 
+// SetBetaHeaders sets the anthropic-beta header profiles
+func (h *APIProxyHandler) SetBetaHeaders(beta *service.BetaHeaders) {
+	h.beta = beta
+}
+
 // Messages proxies the /v1/messages endpoint (Anthropic Messages API)
 func (h *APIProxyHandler) Messages(c *gin.Context) {
 	h.proxyRequest(c, "/v1/messages")
@@ -117,10 +124,9 @@ func (h *APIProxyHandler) proxyRequest(c *gin.Context, path string) {
 	if c.Request.Header.Get("Accept-Encoding") == "" {
 		r.SetHeader("Accept-Encoding", "gzip, deflate, br")
 	}
-	// Set default anthropic-beta if not provided (for API-key accounts)
-	// Matches sub2api's APIKeyBetaHeader constant
+	// Set the API key beta profile if the client sent no anthropic-beta
 	if c.Request.Header.Get("anthropic-beta") == "" {
-		r.SetHeader("anthropic-beta", "claude-code-20250219,interleaved-thinking-2025-05-14,fine-grained-tool-streaming-2025-05-14")
+		r.SetHeader("anthropic-beta", h.beta.Resolve(nil, "", ""))
 	}
 
 	// Enable streaming response
@@ -156,6 +162,18 @@ func (h *APIProxyHandler) proxyRequest(c *gin.Context, path string) {
 		h.keyPool.ReportError(apiKey)
 	}
 
+	// Streams are scanned line by line, so a compressed one is decoded first;
+	// other responses are passed through in the encoding the client accepted
+	contentType := resp.GetHeader("Content-Type")
+	streaming := strings.Contains(contentType, "text/event-stream")
+	if streaming {
+		if err := httpclient.DecodeResponseBody(resp.Response); err != nil {
+			log.Error().Err(err).Str("url", targetURL).Msg("failed to decode upstream stream")
+			c.JSON(http.StatusBadGateway, gin.H{"error": "unsupported upstream response encoding"})
+			return
+		}
+	}
+
 	// Copy response headers
 	for key, values := range resp.Header {
 		for _, value := range values {
@@ -163,9 +181,7 @@ func (h *APIProxyHandler) proxyRequest(c *gin.Context, path string) {
 		}
 	}
 
-	// Check if it's a streaming response
-	contentType := resp.GetHeader("Content-Type")
-	if strings.Contains(contentType, "text/event-stream") {
+	if streaming {
 		c.Header("Content-Type", "text/event-stream")
 		c.Header("Cache-Control", "no-cache")
 		c.Header("Connection", "keep-alive")
@@ -0,0 +1,96 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+// maxUsageBufferBytes bounds how much of a non-streaming response is kept to
+// read its usage block
+const maxUsageBufferBytes = 4 << 20
+
+// usageRecorder extracts token usage from an Anthropic response while it is
+// copied to the client. It handles both JSON and SSE bodies.
+type usageRecorder struct {
+	streaming    bool
+	buf          bytes.Buffer
+	overflow     bool
+	inputTokens  int
+	outputTokens int
+}
+
+func newUsageRecorder(contentType string) *usageRecorder {
+	return &usageRecorder{streaming: strings.HasPrefix(contentType, "text/event-stream")}
+}
+
+// Write implements io.Writer for use with io.TeeReader
+func (u *usageRecorder) Write(p []byte) (int, error) {
+	if !u.streaming {
+		if u.buf.Len()+len(p) > maxUsageBufferBytes {
+			u.overflow = true
+			u.buf.Reset()
+		}
+		if !u.overflow {
+			u.buf.Write(p)
+		}
+		return len(p), nil
+	}
+
+	u.buf.Write(p)
+	for {
+		line, err := u.buf.ReadBytes('\n')
+		if err != nil {
+			// Keep the incomplete line for the next write
+			rest := append([]byte(nil), line...)
+			u.buf.Reset()
+			u.buf.Write(rest)
+			break
+		}
+		u.parseEvent(bytes.TrimSpace(line))
+	}
+	return len(p), nil
+}
+
+// parseEvent reads usage from message_start and message_delta events
+func (u *usageRecorder) parseEvent(line []byte) {
+	data, ok := bytes.CutPrefix(line, []byte("data:"))
+	if !ok {
+		return
+	}
+
+	var event AnthropicStreamEvent
+	if err := json.Unmarshal(bytes.TrimSpace(data), &event); err != nil {
+		return
+	}
+	switch event.Type {
+	case "message_start":
+		if event.Message != nil {
+			u.inputTokens = event.Message.Usage.InputTokens
+			u.outputTokens = event.Message.Usage.OutputTokens
+		}
+	case "message_delta":
+		// Delta usage is cumulative
+		if event.Usage != nil {
+			if event.Usage.InputTokens > 0 {
+				u.inputTokens = event.Usage.InputTokens
+			}
+			u.outputTokens = event.Usage.OutputTokens
+		}
+	}
+}
+
+// Usage returns the input and output tokens seen in the response
+func (u *usageRecorder) Usage() (int, int) {
+	if !u.streaming && !u.overflow && u.buf.Len() > 0 {
+		var resp struct {
+			Usage AnthropicUsage `json:"usage"`
+		}
+		if err := json.Unmarshal(u.buf.Bytes(), &resp); err == nil {
+			u.inputTokens = resp.Usage.InputTokens
+			u.outputTokens = resp.Usage.OutputTokens
+		}
+		u.buf.Reset()
+	}
+	return u.inputTokens, u.outputTokens
+}
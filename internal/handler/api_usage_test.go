@@ -0,0 +1,41 @@
+package handler
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestUsageRecorder_Stream(t *testing.T) {
+	body := "event: message_start\n" +
+		`data: {"type":"message_start","message":{"id":"msg_1","usage":{"input_tokens":120,"output_tokens":1}}}` + "\n\n" +
+		"event: content_block_delta\n" +
+		`data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"hi"}}` + "\n\n" +
+		"event: message_delta\n" +
+		`data: {"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":42}}` + "\n\n"
+
+	usage := newUsageRecorder("text/event-stream; charset=utf-8")
+	// Copy in small chunks so events are split across writes
+	reader := io.TeeReader(strings.NewReader(body), usage)
+	buf := make([]byte, 7)
+	for {
+		if _, err := reader.Read(buf); err != nil {
+			break
+		}
+	}
+
+	in, out := usage.Usage()
+	if in != 120 || out != 42 {
+		t.Errorf("usage = %d/%d, want 120/42", in, out)
+	}
+}
+
+func TestUsageRecorder_JSON(t *testing.T) {
+	usage := newUsageRecorder("application/json")
+	io.Copy(io.Discard, io.TeeReader(strings.NewReader(`{"id":"msg_1","content":[],"usage":{"input_tokens":10,"output_tokens":5}}`), usage))
+
+	in, out := usage.Usage()
+	if in != 10 || out != 5 {
+		t.Errorf("usage = %d/%d, want 10/5", in, out)
+	}
+}
@@ -0,0 +1,199 @@
+package handler
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"ccproxy/internal/circuit"
+	"ccproxy/internal/concurrency"
+	"ccproxy/internal/loadbalancer"
+	"ccproxy/internal/store"
+)
+
+// CapacityHandler combines the API key pool and the account pool into one
+// view of the capacity requests can be scheduled on
+type CapacityHandler struct {
+	store       *store.Store
+	keyPool     *loadbalancer.KeyPool
+	concurrency concurrency.Manager
+	circuitMgr  circuit.Manager
+}
+
+func NewCapacityHandler(st *store.Store, keyPool *loadbalancer.KeyPool, concurrencyMgr concurrency.Manager, circuitMgr circuit.Manager) *CapacityHandler {
+	return &CapacityHandler{
+		store:       st,
+		keyPool:     keyPool,
+		concurrency: concurrencyMgr,
+		circuitMgr:  circuitMgr,
+	}
+}
+
+// Capacity sources
+const (
+	CapacitySourceAPIKeys  = "api_keys"
+	CapacitySourceAccounts = "accounts"
+)
+
+// ModeCapacity is the schedulable capacity behind one mode
+type ModeCapacity struct {
+	Mode        string             `json:"mode"`
+	Source      string             `json:"source"`              // "api_keys" or "accounts"
+	Total       int                `json:"total"`               // Active keys or accounts
+	Healthy     int                `json:"healthy"`             // Of Total, those requests can be scheduled on now
+	Concurrency int                `json:"concurrency"`         // Slots across healthy accounts
+	Unlimited   bool               `json:"unlimited,omitempty"` // API keys have no slot limit
+	Load        int                `json:"load"`                // Requests holding a slot
+	Waiting     int                `json:"waiting"`             // Requests queued for a slot
+	Utilization float64            `json:"utilization"`         // load / concurrency
+	Cooldowns   []CapacityCooldown `json:"cooldowns"`
+}
+
+// CapacityCooldown is a key or account that is temporarily out of rotation,
+// entirely or for one model
+type CapacityCooldown struct {
+	ID     string     `json:"id"`
+	Name   string     `json:"name,omitempty"`
+	Reason string     `json:"reason"`
+	Model  string     `json:"model,omitempty"` // Set for model cooldowns
+	Until  *time.Time `json:"until,omitempty"`
+}
+
+// GetCapacity returns the capacity of the api and web modes. API mode
+// requests are served from the API key pool, or from the accounts when it
+// is empty; web mode requests are served from the accounts.
+func (h *CapacityHandler) GetCapacity(c *gin.Context) {
+	now := time.Now()
+	accounts, err := h.accountCapacity(now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list accounts"})
+		return
+	}
+
+	web := *accounts
+	web.Mode = "web"
+	api := *accounts
+	api.Mode = "api"
+	if h.keyPool != nil && h.keyPool.Size() > 0 {
+		api = h.keyCapacity()
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"modes":      gin.H{"api": api, "web": web},
+		"updated_at": now,
+	})
+}
+
+// keyCapacity describes the API key pool
+func (h *CapacityHandler) keyCapacity() ModeCapacity {
+	capacity := ModeCapacity{
+		Mode:      "api",
+		Source:    CapacitySourceAPIKeys,
+		Unlimited: true,
+		Cooldowns: []CapacityCooldown{},
+	}
+	for _, key := range h.keyPool.GetStats() {
+		capacity.Total++
+		if key.IsHealthy {
+			capacity.Healthy++
+			continue
+		}
+		capacity.Cooldowns = append(capacity.Cooldowns, CapacityCooldown{ID: key.Key, Reason: "unhealthy"})
+	}
+	return capacity
+}
+
+// accountCapacity describes the active accounts. API key accounts are left
+// out, as they are served from the key pool.
+func (h *CapacityHandler) accountCapacity(now time.Time) (*ModeCapacity, error) {
+	all, err := h.store.ListAccountsWithStatus()
+	if err != nil {
+		return nil, err
+	}
+	drains, err := h.store.GetDrainingAccounts()
+	if err != nil {
+		return nil, err
+	}
+	var breakers map[string]circuit.BreakerStats
+	if h.circuitMgr != nil {
+		breakers = h.circuitMgr.Stats()
+	}
+
+	capacity := &ModeCapacity{Source: CapacitySourceAccounts, Cooldowns: []CapacityCooldown{}}
+	var accounts []*store.Account
+	var ids []string
+	for _, account := range all {
+		if account.Type == store.AccountTypeAPIKey || !account.IsActive {
+			continue
+		}
+		accounts = append(accounts, account)
+		ids = append(ids, account.ID)
+	}
+	var loads map[string]*concurrency.LoadInfo
+	if h.concurrency != nil {
+		loads = h.concurrency.GetAccountLoad(ids)
+	}
+
+	for _, account := range accounts {
+		capacity.Total++
+		cooldown := func(reason string, until *time.Time) {
+			capacity.Cooldowns = append(capacity.Cooldowns, CapacityCooldown{ID: account.ID, Name: account.Name, Reason: reason, Until: until})
+		}
+
+		// Accounts that are disabled or errored are not cooling down; they
+		// only count against Healthy
+		healthy := account.IsSchedulable()
+		if !healthy && account.Status == store.AccountStatusActive && account.Schedulable {
+			reason := unschedulableReason(account)
+			switch {
+			case account.OverloadUntil != nil && now.Before(*account.OverloadUntil):
+				cooldown(reason, account.OverloadUntil)
+			case account.RateLimitResetAt != nil && now.Before(*account.RateLimitResetAt):
+				cooldown(reason, account.RateLimitResetAt)
+			case account.TempUnschedulableUntil != nil && now.Before(*account.TempUnschedulableUntil):
+				cooldown(reason, account.TempUnschedulableUntil)
+			}
+		}
+		if until, ok := drains[account.ID]; ok {
+			healthy = false
+			cooldown("draining", &until)
+		}
+		if stats, ok := breakers[account.ID]; ok && stats.State == circuit.StateOpen {
+			healthy = false
+			cooldown("circuit open", nil)
+		}
+
+		overloads, err := h.store.GetAccountModelOverloads(account.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, overload := range overloads {
+			until := overload.OverloadUntil
+			capacity.Cooldowns = append(capacity.Cooldowns, CapacityCooldown{
+				ID: account.ID, Name: account.Name, Reason: "model overloaded", Model: overload.Model, Until: &until,
+			})
+		}
+
+		if load, ok := loads[account.ID]; ok {
+			capacity.Load += load.Current
+			capacity.Waiting += load.Waiting
+			if healthy {
+				capacity.Concurrency += load.Max
+			}
+		}
+		if healthy {
+			capacity.Healthy++
+		}
+	}
+
+	if capacity.Concurrency > 0 {
+		capacity.Utilization = float64(capacity.Load) / float64(capacity.Concurrency)
+	}
+	sort.SliceStable(capacity.Cooldowns, func(i, j int) bool {
+		a, b := capacity.Cooldowns[i].Until, capacity.Cooldowns[j].Until
+		return a != nil && (b == nil || a.Before(*b))
+	})
+	return capacity, nil
+}
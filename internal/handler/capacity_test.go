@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"ccproxy/internal/loadbalancer"
+	"ccproxy/internal/store"
+)
+
+func TestCapacityHandler_GetCapacity(t *testing.T) {
+	router, db := newAccountTestRouter(t)
+
+	for _, account := range []*store.Account{
+		{ID: "acc-ok", Type: store.AccountTypeSessionKey, Credentials: store.Credentials{SessionKey: "sk-ant-sid01-1"}},
+		{ID: "acc-busy", Type: store.AccountTypeSessionKey, Credentials: store.Credentials{SessionKey: "sk-ant-sid01-2"}},
+		{ID: "acc-drain", Type: store.AccountTypeSessionKey, Credentials: store.Credentials{SessionKey: "sk-ant-sid01-3"}},
+		{ID: "acc-key", Type: store.AccountTypeAPIKey, Credentials: store.Credentials{APIKey: "sk-ant-api03-key"}},
+	} {
+		account.Name, account.CreatedAt, account.IsActive = account.ID, time.Now(), true
+		if err := db.CreateAccount(account); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.SetAccountOverload("acc-busy", time.Now().Add(10*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.StartAccountDrain("acc-drain", time.Now().Add(5*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetAccountModelOverload("acc-ok", "claude-opus-4", time.Now().Add(time.Minute), "529"); err != nil {
+		t.Fatal(err)
+	}
+
+	keyPool := loadbalancer.NewKeyPool(nil, loadbalancer.StrategyRoundRobin)
+	capacity := NewCapacityHandler(db, keyPool, nil, nil)
+	router.GET("/capacity", capacity.GetCapacity)
+
+	modeOf := func(resp map[string]interface{}, mode string) map[string]interface{} {
+		return resp["modes"].(map[string]interface{})[mode].(map[string]interface{})
+	}
+
+	// Without API keys the api mode falls back to the accounts
+	code, resp := doJSON(t, router, http.MethodGet, "/capacity", "")
+	if code != http.StatusOK {
+		t.Fatalf("capacity: %d %v", code, resp)
+	}
+	web := modeOf(resp, "web")
+	if web["source"] != CapacitySourceAccounts || web["total"] != 3.0 || web["healthy"] != 1.0 {
+		t.Errorf("web = %v", web)
+	}
+	reasons := map[string]bool{}
+	for _, cd := range web["cooldowns"].([]interface{}) {
+		cooldown := cd.(map[string]interface{})
+		reasons[cooldown["id"].(string)+":"+cooldown["reason"].(string)] = true
+	}
+	for _, want := range []string{"acc-busy:overloaded", "acc-drain:draining", "acc-ok:model overloaded"} {
+		if !reasons[want] {
+			t.Errorf("missing cooldown %s in %v", want, reasons)
+		}
+	}
+	if api := modeOf(resp, "api"); api["source"] != CapacitySourceAccounts || api["total"] != 3.0 {
+		t.Errorf("api without keys = %v", api)
+	}
+
+	// With API keys the api mode reports the key pool
+	keyPool.Add("sk-ant-api03-a")
+	keyPool.Add("sk-ant-api03-b")
+	keyPool.MarkUnhealthy("sk-ant-api03-b")
+	_, resp = doJSON(t, router, http.MethodGet, "/capacity", "")
+	api := modeOf(resp, "api")
+	if api["source"] != CapacitySourceAPIKeys || api["total"] != 2.0 || api["healthy"] != 1.0 || api["unlimited"] != true {
+		t.Errorf("api = %v", api)
+	}
+	if cooldowns := api["cooldowns"].([]interface{}); len(cooldowns) != 1 {
+		t.Errorf("api cooldowns = %v", cooldowns)
+	}
+}
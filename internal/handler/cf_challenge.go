@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"ccproxy/internal/retry"
+	"ccproxy/internal/store"
+)
+
+const (
+	// cfChallengeQuarantine keeps an account that hit a Cloudflare challenge
+	// out of scheduling; its session usually needs fresh cookies
+	cfChallengeQuarantine = 15 * time.Minute
+	// cfChallengeReason is the temp-unschedulable reason set on quarantine
+	cfChallengeReason = "cf_challenge"
+	// cfChallengePeekBytes bounds how much of an HTML body is inspected
+	cfChallengePeekBytes = 64 * 1024
+)
+
+// errCloudflareChallenge is returned by web requests answered with a
+// Cloudflare challenge page; the retry executor moves on to another account
+var errCloudflareChallenge = fmt.Errorf("blocked by Cloudflare challenge: %w", retry.ErrSwitchAccount)
+
+// cfChallengeMarkers appear in Cloudflare interstitial pages
+var cfChallengeMarkers = [][]byte{
+	[]byte("just a moment..."),
+	[]byte("cf-chl-"),
+	[]byte("cf_chl_opt"),
+	[]byte("challenge-platform"),
+	[]byte("attention required! | cloudflare"),
+}
+
+// isCloudflareChallenge reports whether a claude.ai response is a Cloudflare
+// challenge instead of an API answer. Only HTML bodies are inspected; the
+// bytes read are put back so resp can still be consumed as usual.
+func isCloudflareChallenge(resp *http.Response) bool {
+	if resp == nil {
+		return false
+	}
+	if strings.EqualFold(resp.Header.Get("cf-mitigated"), "challenge") {
+		return true
+	}
+	if !strings.Contains(strings.ToLower(resp.Header.Get("Content-Type")), "text/html") || resp.Body == nil {
+		return false
+	}
+
+	peek, _ := io.ReadAll(io.LimitReader(resp.Body, cfChallengePeekBytes))
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(peek), resp.Body), resp.Body}
+
+	lower := bytes.ToLower(peek)
+	for _, marker := range cfChallengeMarkers {
+		if bytes.Contains(lower, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// quarantineCloudflareChallenge takes an account out of scheduling for
+// cfChallengeQuarantine after claude.ai served it a challenge page
+func quarantineCloudflareChallenge(st *store.Store, accountID string) {
+	until := time.Now().Add(cfChallengeQuarantine)
+
+	log.Warn().
+		Str("account_id", accountID).
+		Time("until", until).
+		Msg("Cloudflare challenge on web request, quarantining account")
+
+	if err := st.SetAccountTempUnschedulable(accountID, until, cfChallengeReason); err != nil {
+		log.Error().Err(err).Str("account_id", accountID).Msg("failed to quarantine account")
+	}
+}
@@ -0,0 +1,154 @@
+package handler
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"ccproxy/internal/loadbalancer"
+	"ccproxy/internal/retry"
+	"ccproxy/internal/store"
+)
+
+const cfChallengePage = `<!DOCTYPE html><html lang="en-US"><head><title>Just a moment...</title></head>
+<body><div id="challenge-body-text">claude.ai needs to review the security of your connection before proceeding.</div>
+<script>window._cf_chl_opt={cvId: '3'};</script></body></html>`
+
+func TestIsCloudflareChallenge(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		contentType string
+		mitigated   string
+		body        string
+		want        bool
+	}{
+		{"challenge page", http.StatusForbidden, "text/html; charset=UTF-8", "", cfChallengePage, true},
+		{"cf-mitigated header", http.StatusForbidden, "", "challenge", "", true},
+		{"json auth error", http.StatusForbidden, "application/json", "", `{"error":{"type":"permission_error","message":"Just a moment"}}`, false},
+		{"other html", http.StatusBadGateway, "text/html", "", "<html><body>502 Bad Gateway</body></html>", false},
+		{"event stream", http.StatusOK, "text/event-stream", "", "data: {\"completion\":\"hi\"}\n\n", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{
+				StatusCode: tt.status,
+				Header:     http.Header{},
+				Body:       io.NopCloser(strings.NewReader(tt.body)),
+			}
+			resp.Header.Set("Content-Type", tt.contentType)
+			if tt.mitigated != "" {
+				resp.Header.Set("cf-mitigated", tt.mitigated)
+			}
+
+			if got := isCloudflareChallenge(resp); got != tt.want {
+				t.Errorf("isCloudflareChallenge() = %v, want %v", got, tt.want)
+			}
+			// The body is still readable in full
+			if body, _ := io.ReadAll(resp.Body); string(body) != tt.body {
+				t.Errorf("body after detection = %q", body)
+			}
+		})
+	}
+}
+
+func TestMessagesWeb_SwitchesAccountOnCloudflareChallenge(t *testing.T) {
+	var challenged, completions atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.Header.Get("Cookie"), "sessionKey=sk-ant-sid01-blocked") {
+			challenged.Add(1)
+			w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+			w.WriteHeader(http.StatusForbidden)
+			io.WriteString(w, cfChallengePage)
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, "/completion") {
+			completions.Add(1)
+			w.Header().Set("Content-Type", "text/event-stream")
+			io.WriteString(w, "data: {\"type\":\"completion\",\"completion\":\"hello\"}\n\n")
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, `{"uuid":"conv"}`)
+	}))
+	defer upstream.Close()
+
+	db, err := store.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// Accounts are listed newest first, so the blocked one is tried first
+	now := time.Now()
+	for i, key := range []string{"sk-ant-sid01-ok", "sk-ant-sid01-blocked"} {
+		account := &store.Account{
+			ID:             strings.TrimPrefix(key, "sk-ant-sid01-"),
+			Name:           key,
+			Type:           store.AccountTypeSessionKey,
+			Credentials:    store.Credentials{SessionKey: key},
+			OrganizationID: "org",
+			CreatedAt:      now.Add(time.Duration(i) * time.Minute),
+			IsActive:       true,
+		}
+		if err := db.CreateAccount(account); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	h := NewEnhancedProxyHandler(EnhancedProxyConfig{
+		Store:   db,
+		KeyPool: loadbalancer.NewKeyPool(nil, loadbalancer.StrategyRoundRobin),
+		WebURL:  upstream.URL,
+		Retry:   retry.NewExecutor(retry.NewPolicy(retry.DefaultRetryConfig())),
+	})
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/v1/messages", h.Messages)
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages",
+		strings.NewReader(`{"model":"claude-sonnet-4-20250514","max_tokens":100,"messages":[{"role":"user","content":"hi"}]}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Proxy-Mode", "web")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "hello") {
+		t.Fatalf("got %d %s, want the answer from the unblocked account", w.Code, w.Body.String())
+	}
+	if n := completions.Load(); n != 1 {
+		t.Errorf("completions = %d, want 1", n)
+	}
+	// The challenged account is not retried before switching
+	if n := challenged.Load(); n != 1 {
+		t.Errorf("challenged requests = %d, want 1", n)
+	}
+
+	blocked, err := db.GetAccount("blocked")
+	if err != nil {
+		t.Fatal(err)
+	}
+	accounts, err := db.ListAccountsWithStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, account := range accounts {
+		if account.ID != "blocked" {
+			continue
+		}
+		if account.TempUnschedulableReason != cfChallengeReason || !account.IsTempUnschedulable() {
+			t.Errorf("blocked account not quarantined: reason %q until %v", account.TempUnschedulableReason, account.TempUnschedulableUntil)
+		}
+	}
+	if blocked.Status == store.AccountStatusError {
+		t.Error("challenge must not be treated as an authentication failure")
+	}
+}
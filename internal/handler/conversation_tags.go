@@ -0,0 +1,151 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxConversationTags caps the tags on one conversation
+const maxConversationTags = 20
+
+// conversationTagPattern is a lowercase label such as "prompt-bug" or "eval:v2"
+var conversationTagPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._:-]{0,63}$`)
+
+// ConversationTagsRequest lists tags to add to a conversation
+type ConversationTagsRequest struct {
+	Tags []string `json:"tags" binding:"required"`
+}
+
+// normalizeConversationTag lowercases and validates a tag
+func normalizeConversationTag(tag string) (string, error) {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if !conversationTagPattern.MatchString(tag) {
+		return "", fmt.Errorf("invalid tag %q: use up to 64 letters, digits, '.', '_', ':' or '-'", tag)
+	}
+	return tag, nil
+}
+
+// mergeConversationTags adds tags to existing, sorted and without duplicates
+func mergeConversationTags(existing, tags []string) ([]string, error) {
+	set := make(map[string]bool, len(existing)+len(tags))
+	for _, tag := range existing {
+		set[tag] = true
+	}
+	for _, tag := range tags {
+		normalized, err := normalizeConversationTag(tag)
+		if err != nil {
+			return nil, err
+		}
+		set[normalized] = true
+	}
+	if len(set) > maxConversationTags {
+		return nil, fmt.Errorf("a conversation can have at most %d tags", maxConversationTags)
+	}
+
+	merged := make([]string, 0, len(set))
+	for tag := range set {
+		merged = append(merged, tag)
+	}
+	sort.Strings(merged)
+	return merged, nil
+}
+
+// AddConversationTags adds tags to a conversation
+func (h *ConversationsHandler) AddConversationTags(c *gin.Context) {
+	var req ConversationTagsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	conv, err := h.store.GetConversation(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get conversation"})
+		return
+	}
+	if conv == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "conversation not found"})
+		return
+	}
+
+	tags, err := mergeConversationTags(conv.Tags, req.Tags)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	h.saveConversationTags(c, conv.ID, tags, conv.Starred)
+}
+
+// RemoveConversationTag removes a tag from a conversation
+func (h *ConversationsHandler) RemoveConversationTag(c *gin.Context) {
+	conv, err := h.store.GetConversation(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get conversation"})
+		return
+	}
+	if conv == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "conversation not found"})
+		return
+	}
+
+	removed := strings.ToLower(strings.TrimSpace(c.Param("tag")))
+	tags := []string{}
+	for _, tag := range conv.Tags {
+		if tag != removed {
+			tags = append(tags, tag)
+		}
+	}
+	h.saveConversationTags(c, conv.ID, tags, conv.Starred)
+}
+
+func (h *ConversationsHandler) saveConversationTags(c *gin.Context, id string, tags []string, starred bool) {
+	found, err := h.store.SetConversationTags(id, tags)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update conversation tags"})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "conversation not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"id": id, "tags": tags, "starred": starred})
+}
+
+// StarConversation stars a conversation
+func (h *ConversationsHandler) StarConversation(c *gin.Context) {
+	h.setConversationStarred(c, true)
+}
+
+// UnstarConversation removes the star from a conversation
+func (h *ConversationsHandler) UnstarConversation(c *gin.Context) {
+	h.setConversationStarred(c, false)
+}
+
+func (h *ConversationsHandler) setConversationStarred(c *gin.Context, starred bool) {
+	id := c.Param("id")
+	found, err := h.store.SetConversationStarred(id, starred)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update conversation"})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "conversation not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"id": id, "starred": starred})
+}
+
+// ListConversationTags returns every tag in use with its number of conversations
+func (h *ConversationsHandler) ListConversationTags(c *gin.Context) {
+	counts, err := h.store.ListConversationTags()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list conversation tags"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"tags": counts})
+}
@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"ccproxy/internal/store"
+)
+
+func TestConversationTagsAndStars(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, err := store.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	for _, id := range []string{"conv-1", "conv-2"} {
+		if err := db.CreateConversation(&store.ConversationContent{
+			ID: id, RequestLogID: "log-" + id, TokenID: "tok-1", MessagesJSON: "[]", CreatedAt: time.Now(),
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	h := NewConversationsHandler(db)
+	router := gin.New()
+	router.GET("/conversations", h.ListConversations)
+	router.GET("/conversations/tags", h.ListConversationTags)
+	router.POST("/conversations/:id/tags", h.AddConversationTags)
+	router.DELETE("/conversations/:id/tags/:tag", h.RemoveConversationTag)
+	router.PUT("/conversations/:id/star", h.StarConversation)
+	router.DELETE("/conversations/:id/star", h.UnstarConversation)
+
+	code, resp := doJSON(t, router, http.MethodPost, "/conversations/conv-1/tags", `{"tags":["Prompt-Bug","eval:v2","prompt-bug"]}`)
+	if code != http.StatusOK || len(resp["tags"].([]interface{})) != 2 {
+		t.Fatalf("add tags: %d %v", code, resp)
+	}
+	if code, _ := doJSON(t, router, http.MethodPost, "/conversations/conv-1/tags", `{"tags":["bad tag"]}`); code != http.StatusBadRequest {
+		t.Errorf("invalid tag: %d", code)
+	}
+	if code, _ := doJSON(t, router, http.MethodPost, "/conversations/missing/tags", `{"tags":["x"]}`); code != http.StatusNotFound {
+		t.Errorf("missing conversation: %d", code)
+	}
+	doJSON(t, router, http.MethodPost, "/conversations/conv-2/tags", `{"tags":["eval:v2"]}`)
+	doJSON(t, router, http.MethodPut, "/conversations/conv-2/star", "")
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"?tag=prompt-bug", []string{"conv-1"}},
+		{"?tag=EVAL:v2", []string{"conv-1", "conv-2"}},
+		{"?starred=true", []string{"conv-2"}},
+		{"?starred=false&tag=eval:v2", []string{"conv-1"}},
+		{"?tag=unknown", nil},
+	}
+	for _, tt := range tests {
+		code, resp := doJSON(t, router, http.MethodGet, "/conversations"+tt.query, "")
+		if code != http.StatusOK {
+			t.Fatalf("%s: %d %v", tt.query, code, resp)
+		}
+		got := map[string]bool{}
+		for _, conv := range resp["conversations"].([]interface{}) {
+			got[conv.(map[string]interface{})["id"].(string)] = true
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.query, got, tt.want)
+		}
+		for _, id := range tt.want {
+			if !got[id] {
+				t.Errorf("%s: missing %s in %v", tt.query, id, got)
+			}
+		}
+	}
+
+	_, resp = doJSON(t, router, http.MethodGet, "/conversations/tags", "")
+	if tags := resp["tags"].(map[string]interface{}); tags["eval:v2"] != 2.0 || tags["prompt-bug"] != 1.0 {
+		t.Errorf("tag counts = %v", tags)
+	}
+
+	doJSON(t, router, http.MethodDelete, "/conversations/conv-1/tags/prompt-bug", "")
+	doJSON(t, router, http.MethodDelete, "/conversations/conv-2/star", "")
+	conv, _ := db.GetConversation("conv-1")
+	if len(conv.Tags) != 1 || conv.Tags[0] != "eval:v2" {
+		t.Errorf("tags after removal = %v", conv.Tags)
+	}
+	if conv, _ := db.GetConversation("conv-2"); conv.Starred {
+		t.Error("conv-2 still starred")
+	}
+	if code, _ := doJSON(t, router, http.MethodPut, "/conversations/missing/star", ""); code != http.StatusNotFound {
+		t.Errorf("star missing conversation: %d", code)
+	}
+}
@@ -5,9 +5,12 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"ccproxy/internal/service"
 	"ccproxy/internal/store"
 )
 
@@ -25,6 +28,8 @@ type ListConversationsRequest struct {
 	TokenID  string `form:"token_id"`
 	FromDate string `form:"from_date"`
 	ToDate   string `form:"to_date"`
+	Tag      string `form:"tag"`
+	Starred  *bool  `form:"starred"`
 	Page     int    `form:"page"`
 	Limit    int    `form:"limit"`
 }
@@ -33,12 +38,17 @@ type ConversationDTO struct {
 	ID            string  `json:"id"`
 	RequestLogID  string  `json:"request_log_id"`
 	TokenID       string  `json:"token_id"`
+	Title         string  `json:"title"`
+	MessageCount  int     `json:"message_count"`
 	SystemPrompt  *string `json:"system_prompt,omitempty"`
 	MessagesJSON  string  `json:"messages_json"`
 	Prompt        string  `json:"prompt"`
 	Completion    string  `json:"completion"`
 	CreatedAt     string  `json:"created_at"`
-	IsCompressed  bool    `json:"is_compressed"`
+	IsCompressed  bool    `json:"is_compressed"` // Stored compressed; contents are returned decompressed
+	Tags          []string `json:"tags"`
+	Starred       bool    `json:"starred"`
+	Truncated     bool    `json:"truncated,omitempty"` // The stream was interrupted; the completion is partial
 }
 
 type ListConversationsResponse struct {
@@ -59,6 +69,8 @@ func (h *ConversationsHandler) ListConversations(c *gin.Context) {
 	// Build filter
 	filter := store.ConversationFilter{
 		TokenID: req.TokenID,
+		Tag:     strings.ToLower(strings.TrimSpace(req.Tag)),
+		Starred: req.Starred,
 		Page:    req.Page,
 		Limit:   req.Limit,
 	}
@@ -178,8 +190,25 @@ func (h *ConversationsHandler) DeleteConversation(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "conversation deleted successfully"})
 }
 
-// toConversationDTO converts a store.ConversationContent to a ConversationDTO
+// GetCompressionStats returns how many conversations are compressed and the space saved
+func (h *ConversationsHandler) GetCompressionStats(c *gin.Context) {
+	stats, err := h.store.GetConversationCompressionStats()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get compression stats"})
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
+
+// toConversationDTO converts a store.ConversationContent to a ConversationDTO,
+// decompressing compressed contents
 func (h *ConversationsHandler) toConversationDTO(conv *store.ConversationContent) *ConversationDTO {
+	compressed := conv.IsCompressed
+	if err := service.DecompressConversation(conv); err != nil {
+		log.Warn().Err(err).Str("conv_id", conv.ID).Msg("Failed to decompress conversation, returning stored contents")
+	}
+
 	dto := &ConversationDTO{
 		ID:           conv.ID,
 		RequestLogID: conv.RequestLogID,
@@ -188,7 +217,23 @@ func (h *ConversationsHandler) toConversationDTO(conv *store.ConversationContent
 		Prompt:       conv.Prompt,
 		Completion:   conv.Completion,
 		CreatedAt:    conv.CreatedAt.Format(time.RFC3339),
-		IsCompressed: conv.IsCompressed,
+		IsCompressed: compressed,
+		Title:        conv.Title,
+		Tags:         conv.Tags,
+		Starred:      conv.Starred,
+		Truncated:    conv.Truncated,
+	}
+	if dto.Tags == nil {
+		dto.Tags = []string{}
+	}
+
+	var messages []OpenAIMessage
+	if err := json.Unmarshal([]byte(conv.MessagesJSON), &messages); err == nil {
+		dto.MessageCount = len(messages)
+	}
+	// Conversations stored before titles existed get one from their contents
+	if dto.Title == "" {
+		dto.Title = extractConversationTitle(messages, conv.Prompt)
 	}
 
 	if conv.SystemPrompt.Valid {
@@ -216,6 +261,8 @@ func (h *ConversationsHandler) ExportConversations(c *gin.Context) {
 	// Build filter (no pagination for export)
 	filter := store.ConversationFilter{
 		TokenID: req.TokenID,
+		Tag:     strings.ToLower(strings.TrimSpace(req.Tag)),
+		Starred: req.Starred,
 		Limit:   10000, // Max export limit
 	}
 
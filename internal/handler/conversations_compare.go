@@ -0,0 +1,288 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"ccproxy/internal/service"
+	"ccproxy/internal/store"
+)
+
+// Alignment of the messages of two compared conversations
+const (
+	MessageEqual   = "equal"   // Same role and content in both
+	MessageChanged = "changed" // Same role at the same position, different content
+	MessageRemoved = "removed" // Only in conversation a
+	MessageAdded   = "added"   // Only in conversation b
+)
+
+// CompareSide describes one compared conversation and the request that
+// produced it
+type CompareSide struct {
+	ID               string `json:"id"`
+	RequestLogID     string `json:"request_log_id"`
+	TokenID          string `json:"token_id"`
+	CreatedAt        string `json:"created_at"`
+	Model            string `json:"model,omitempty"`
+	AccountID        string `json:"account_id,omitempty"`
+	StatusCode       int    `json:"status_code,omitempty"`
+	DurationMs       int64  `json:"duration_ms,omitempty"`
+	PromptTokens     int    `json:"prompt_tokens,omitempty"`
+	CompletionTokens int    `json:"completion_tokens,omitempty"`
+	MessageCount     int    `json:"message_count"`
+}
+
+// TextCompare is the line diff of one text field
+type TextCompare struct {
+	Equal      bool             `json:"equal"`
+	Similarity float64          `json:"similarity"` // Share of lines in common, 0-1
+	Diff       []service.DiffOp `json:"diff"`
+}
+
+// MessageCompare is one row of the aligned message transcripts. Index fields
+// are positions in the messages of a and b; removed messages have no IndexB
+// and added ones no IndexA.
+type MessageCompare struct {
+	Status string           `json:"status"`
+	IndexA *int             `json:"index_a"`
+	IndexB *int             `json:"index_b"`
+	RoleA  string           `json:"role_a,omitempty"`
+	RoleB  string           `json:"role_b,omitempty"`
+	Diff   []service.DiffOp `json:"diff"`
+}
+
+// CompareSummary counts the aligned messages by status
+type CompareSummary struct {
+	MessagesEqual        int     `json:"messages_equal"`
+	MessagesChanged      int     `json:"messages_changed"`
+	MessagesRemoved      int     `json:"messages_removed"`
+	MessagesAdded        int     `json:"messages_added"`
+	CompletionSimilarity float64 `json:"completion_similarity"`
+}
+
+// ConversationCompare is the aligned diff of two conversations
+type ConversationCompare struct {
+	A            *CompareSide      `json:"a"`
+	B            *CompareSide      `json:"b"`
+	SystemPrompt *TextCompare      `json:"system_prompt"`
+	Messages     []*MessageCompare `json:"messages"`
+	Completion   *TextCompare      `json:"completion"`
+	Summary      CompareSummary    `json:"summary"`
+}
+
+// CompareConversations returns an aligned diff of two conversations, such as
+// the same prompt sent to different models or accounts: the system prompts,
+// the request messages aligned by role and content, and the completions.
+// Changed messages and texts are diffed line by line.
+func (h *ConversationsHandler) CompareConversations(c *gin.Context) {
+	idA, idB := c.Query("a"), c.Query("b")
+	if idA == "" || idB == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "query parameters 'a' and 'b' are required"})
+		return
+	}
+
+	convs := make([]*store.ConversationContent, 2)
+	for i, id := range []string{idA, idB} {
+		conv, err := h.store.GetConversation(id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get conversation"})
+			return
+		}
+		if conv == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "conversation not found", "id": id})
+			return
+		}
+		convs[i] = conv
+	}
+
+	dtoA, dtoB := h.toConversationDTO(convs[0]), h.toConversationDTO(convs[1])
+	var messagesA, messagesB []OpenAIMessage
+	_ = json.Unmarshal([]byte(dtoA.MessagesJSON), &messagesA)
+	_ = json.Unmarshal([]byte(dtoB.MessagesJSON), &messagesB)
+
+	var systemA, systemB string
+	if dtoA.SystemPrompt != nil {
+		systemA = *dtoA.SystemPrompt
+	}
+	if dtoB.SystemPrompt != nil {
+		systemB = *dtoB.SystemPrompt
+	}
+
+	result := &ConversationCompare{
+		A:            h.compareSide(dtoA),
+		B:            h.compareSide(dtoB),
+		SystemPrompt: compareText(systemA, systemB),
+		Messages:     alignMessages(messagesA, messagesB),
+		Completion:   compareText(dtoA.Completion, dtoB.Completion),
+	}
+	for _, m := range result.Messages {
+		switch m.Status {
+		case MessageEqual:
+			result.Summary.MessagesEqual++
+		case MessageChanged:
+			result.Summary.MessagesChanged++
+		case MessageRemoved:
+			result.Summary.MessagesRemoved++
+		case MessageAdded:
+			result.Summary.MessagesAdded++
+		}
+	}
+	result.Summary.CompletionSimilarity = result.Completion.Similarity
+
+	c.JSON(http.StatusOK, result)
+}
+
+// compareSide describes a conversation with the details of its request log,
+// when the log still exists
+func (h *ConversationsHandler) compareSide(dto *ConversationDTO) *CompareSide {
+	side := &CompareSide{
+		ID:           dto.ID,
+		RequestLogID: dto.RequestLogID,
+		TokenID:      dto.TokenID,
+		CreatedAt:    dto.CreatedAt,
+		MessageCount: dto.MessageCount,
+	}
+	if l, err := h.store.GetRequestLog(dto.RequestLogID); err == nil && l != nil {
+		side.Model = l.Model
+		side.AccountID = l.AccountID.String
+		side.StatusCode = l.StatusCode
+		side.DurationMs = l.DurationMs.Int64
+		side.PromptTokens = l.PromptTokens
+		side.CompletionTokens = l.CompletionTokens
+	}
+	return side
+}
+
+func compareText(a, b string) *TextCompare {
+	diff := service.DiffLines(a, b)
+	if diff == nil {
+		diff = []service.DiffOp{}
+	}
+	return &TextCompare{
+		Equal:      a == b,
+		Similarity: service.DiffSimilarity(diff),
+		Diff:       diff,
+	}
+}
+
+// alignMessages aligns two message lists on their longest common subsequence
+// of identical messages. Between aligned messages, each removed message is
+// paired as changed with the next added message of the same role, in order.
+func alignMessages(a, b []OpenAIMessage) []*MessageCompare {
+	keysA, keysB := make([]string, len(a)), make([]string, len(b))
+	for i, m := range a {
+		keysA[i] = m.Role + "\x00" + messageTranscript(m.Content)
+	}
+	for i, m := range b {
+		keysB[i] = m.Role + "\x00" + messageTranscript(m.Content)
+	}
+
+	rows := []*MessageCompare{}
+	ia, ib := 0, 0
+	var removed, added []int
+	flush := func() {
+		j := 0
+		for _, i := range removed {
+			k := j
+			for k < len(added) && b[added[k]].Role != a[i].Role {
+				k++
+			}
+			if k == len(added) {
+				rows = append(rows, &MessageCompare{
+					Status: MessageRemoved,
+					IndexA: intPtr(i),
+					RoleA:  a[i].Role,
+					Diff:   singleDiff(service.DiffDelete, messageTranscript(a[i].Content)),
+				})
+				continue
+			}
+			for ; j < k; j++ {
+				rows = append(rows, addedMessage(b, added[j]))
+			}
+			rows = append(rows, &MessageCompare{
+				Status: MessageChanged,
+				IndexA: intPtr(i),
+				IndexB: intPtr(added[k]),
+				RoleA:  a[i].Role,
+				RoleB:  b[added[k]].Role,
+				Diff:   service.DiffLines(messageTranscript(a[i].Content), messageTranscript(b[added[k]].Content)),
+			})
+			j = k + 1
+		}
+		for ; j < len(added); j++ {
+			rows = append(rows, addedMessage(b, added[j]))
+		}
+		removed, added = nil, nil
+	}
+
+	for _, op := range service.DiffSequences(keysA, keysB) {
+		for range op.Lines {
+			switch op.Op {
+			case service.DiffEqual:
+				flush()
+				rows = append(rows, &MessageCompare{
+					Status: MessageEqual,
+					IndexA: intPtr(ia),
+					IndexB: intPtr(ib),
+					RoleA:  a[ia].Role,
+					RoleB:  b[ib].Role,
+					Diff:   singleDiff(service.DiffEqual, messageTranscript(a[ia].Content)),
+				})
+				ia++
+				ib++
+			case service.DiffDelete:
+				removed = append(removed, ia)
+				ia++
+			case service.DiffInsert:
+				added = append(added, ib)
+				ib++
+			}
+		}
+	}
+	flush()
+	return rows
+}
+
+func addedMessage(b []OpenAIMessage, j int) *MessageCompare {
+	return &MessageCompare{
+		Status: MessageAdded,
+		IndexB: intPtr(j),
+		RoleB:  b[j].Role,
+		Diff:   singleDiff(service.DiffInsert, messageTranscript(b[j].Content)),
+	}
+}
+
+// messageTranscript renders message content for diffing: text as is, other
+// content blocks such as tool calls as one line of JSON each
+func messageTranscript(content interface{}) string {
+	blocks, ok := content.([]interface{})
+	if !ok {
+		return extractTextFromContent(content)
+	}
+	parts := make([]string, 0, len(blocks))
+	for _, block := range blocks {
+		if text := extractTextFromContent([]interface{}{block}); text != "" {
+			parts = append(parts, text)
+			continue
+		}
+		if data, err := json.Marshal(block); err == nil {
+			parts = append(parts, string(data))
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// singleDiff returns text as one run of op, or no runs for empty text
+func singleDiff(op, text string) []service.DiffOp {
+	if text == "" {
+		return []service.DiffOp{}
+	}
+	return []service.DiffOp{{Op: op, Lines: strings.Split(strings.TrimSuffix(text, "\n"), "\n")}}
+}
+
+func intPtr(i int) *int {
+	return &i
+}
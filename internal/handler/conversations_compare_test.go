@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"database/sql"
+	"net/http"
+	"testing"
+	"time"
+
+	"ccproxy/internal/store"
+)
+
+func TestConversationsHandler_Compare(t *testing.T) {
+	router, db := newAccountTestRouter(t)
+	router.GET("/conversations/compare", NewConversationsHandler(db).CompareConversations)
+
+	now := time.Now()
+	create := func(id, model, messages, completion string) {
+		t.Helper()
+		if err := db.CreateRequestLog(&store.RequestLog{
+			ID:         "log-" + id,
+			TokenID:    "tok-1",
+			Mode:       "api",
+			Model:      model,
+			RequestAt:  now,
+			StatusCode: 200,
+			Success:    true,
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.CreateConversation(&store.ConversationContent{
+			ID:           id,
+			RequestLogID: "log-" + id,
+			TokenID:      "tok-1",
+			SystemPrompt: sql.NullString{String: "Be brief.", Valid: true},
+			MessagesJSON: messages,
+			Prompt:       "prompt",
+			Completion:   completion,
+			CreatedAt:    now,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	create("conv-a", "claude-sonnet-4",
+		`[{"role":"user","content":"Hello"},{"role":"assistant","content":"Hi"},{"role":"user","content":"Sum 1 and 2"}]`,
+		"The sum is 3.\nDone.")
+	create("conv-b", "claude-opus-4",
+		`[{"role":"user","content":"Hello"},{"role":"user","content":[{"type":"text","text":"Sum 1 and 3"}]},{"role":"user","content":"Thanks"}]`,
+		"The sum is 4.\nDone.")
+
+	code, resp := doJSON(t, router, http.MethodGet, "/conversations/compare?a=conv-a&b=conv-b", "")
+	if code != http.StatusOK {
+		t.Fatalf("compare: %d %v", code, resp)
+	}
+	if a := resp["a"].(map[string]interface{}); a["model"] != "claude-sonnet-4" {
+		t.Errorf("a = %v", a)
+	}
+	if sp := resp["system_prompt"].(map[string]interface{}); sp["equal"] != true {
+		t.Errorf("system prompt = %v", sp)
+	}
+
+	var statuses []string
+	for _, m := range resp["messages"].([]interface{}) {
+		statuses = append(statuses, m.(map[string]interface{})["status"].(string))
+	}
+	want := []string{MessageEqual, MessageRemoved, MessageChanged, MessageAdded}
+	if len(statuses) != len(want) {
+		t.Fatalf("statuses = %v, want %v", statuses, want)
+	}
+	for i := range want {
+		if statuses[i] != want[i] {
+			t.Fatalf("statuses = %v, want %v", statuses, want)
+		}
+	}
+
+	summary := resp["summary"].(map[string]interface{})
+	if summary["messages_changed"] != 1.0 || summary["completion_similarity"] != 0.5 {
+		t.Errorf("summary = %v", summary)
+	}
+
+	if code, _ := doJSON(t, router, http.MethodGet, "/conversations/compare?a=conv-a&b=missing", ""); code != http.StatusNotFound {
+		t.Errorf("missing conversation: %d", code)
+	}
+	if code, _ := doJSON(t, router, http.MethodGet, "/conversations/compare?a=conv-a", ""); code != http.StatusBadRequest {
+		t.Errorf("missing b: %d", code)
+	}
+}
@@ -0,0 +1,49 @@
+package handler
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"ccproxy/internal/store"
+)
+
+func TestExtractConversationTitle(t *testing.T) {
+	messages := []OpenAIMessage{
+		{Role: "system", Content: "You are terse"},
+		{Role: "user", Content: []interface{}{map[string]interface{}{"type": "text", "text": "  How do I\n\nrotate   logs?  "}}},
+		{Role: "assistant", Content: "Use logrotate."},
+		{Role: "user", Content: "Thanks"},
+	}
+	if got := extractConversationTitle(messages, "Thanks"); got != "How do I rotate logs?" {
+		t.Errorf("got %q", got)
+	}
+	if got := extractConversationTitle(nil, "only a prompt"); got != "only a prompt" {
+		t.Errorf("fallback: got %q", got)
+	}
+
+	long := strings.Repeat("word ", 40)
+	got := extractConversationTitle([]OpenAIMessage{{Role: "user", Content: long}}, "")
+	if !strings.HasSuffix(got, "word…") || len([]rune(got)) > conversationTitleLength+1 {
+		t.Errorf("long title not cut at a word boundary: %q", got)
+	}
+}
+
+func TestConversationDTO_TitleFallback(t *testing.T) {
+	h := NewConversationsHandler(nil)
+	conv := &store.ConversationContent{
+		ID:           "conv-1",
+		MessagesJSON: `[{"role":"user","content":"Summarize this file"},{"role":"assistant","content":"Sure"},{"role":"user","content":"Shorter"}]`,
+		Prompt:       "Shorter",
+		CreatedAt:    time.Now(),
+	}
+	dto := h.toConversationDTO(conv)
+	if dto.Title != "Summarize this file" || dto.MessageCount != 3 {
+		t.Errorf("unexpected DTO: title=%q messages=%d", dto.Title, dto.MessageCount)
+	}
+
+	conv.Title = "Stored title"
+	if dto := h.toConversationDTO(conv); dto.Title != "Stored title" {
+		t.Errorf("stored title not used: %q", dto.Title)
+	}
+}
@@ -0,0 +1,271 @@
+package handler
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// The conversions between the OpenAI and Anthropic formats used by the
+// proxy. They are plain functions so the convert command can run them
+// offline.
+
+// OpenAIToAnthropicRequest converts an OpenAI chat completions request into
+// the Anthropic Messages request sent upstream
+func OpenAIToAnthropicRequest(req *OpenAIChatRequest) *AnthropicRequest {
+	anthropicReq := &AnthropicRequest{
+		Model:       req.Model,
+		MaxTokens:   req.MaxTokens,
+		Temperature: req.Temperature,
+		TopP:        req.TopP,
+		Stream:      req.Stream,
+	}
+
+	if endUserID := req.EndUserID(); endUserID != "" {
+		anthropicReq.Metadata = &AnthropicMetadata{UserID: endUserID}
+	}
+
+	if anthropicReq.MaxTokens == 0 {
+		anthropicReq.MaxTokens = 4096
+	}
+
+	if len(req.Stop) > 0 {
+		anthropicReq.StopSequences = req.Stop
+	}
+
+	// Convert messages and extract system prompt
+	var systemText string
+	prefill := trailingPrefill(req.Messages)
+	for i, msg := range req.Messages {
+		if msg.Role == "system" {
+			systemText = appendToSystem(systemText, extractTextFromContent(msg.Content))
+		} else if msg.Role == "assistant" && i == len(req.Messages)-1 {
+			// A trailing assistant message is a prefill Anthropic continues
+			if prefill != "" {
+				anthropicReq.Messages = append(anthropicReq.Messages, AnthropicMessage{
+					Role:    "assistant",
+					Content: prefill,
+				})
+			}
+		} else {
+			role := "user"
+			if msg.Role == "assistant" {
+				role = "assistant"
+			}
+			anthropicReq.Messages = append(anthropicReq.Messages, AnthropicMessage{
+				Role:    role,
+				Content: anthropicContent(msg.Content), // Keep original format (string or []any)
+			})
+		}
+	}
+
+	if systemText != "" {
+		anthropicReq.System = systemText
+	}
+
+	return anthropicReq
+}
+
+// anthropicContent converts OpenAI image_url blocks into Anthropic image
+// blocks, with a base64 source for data URLs and a url source otherwise.
+// Other content is kept as is.
+func anthropicContent(content interface{}) interface{} {
+	blocks, ok := content.([]interface{})
+	if !ok {
+		return content
+	}
+	converted := make([]interface{}, len(blocks))
+	for i, block := range blocks {
+		converted[i] = block
+		blockMap, ok := block.(map[string]interface{})
+		if !ok || blockMap["type"] != "image_url" {
+			continue
+		}
+		imageURL, _ := blockMap["image_url"].(map[string]interface{})
+		url, _ := imageURL["url"].(string)
+		if url == "" {
+			continue
+		}
+		source := map[string]interface{}{"type": "url", "url": url}
+		if strings.HasPrefix(url, "data:") {
+			mediaType, data, err := parseDataURL(url)
+			if err != nil {
+				continue
+			}
+			source = map[string]interface{}{"type": "base64", "media_type": mediaType, "data": base64.StdEncoding.EncodeToString(data)}
+		}
+		converted[i] = map[string]interface{}{"type": "image", "source": source}
+	}
+	return converted
+}
+
+// AnthropicToOpenAIRequest converts an Anthropic Messages request into the
+// OpenAI format served by web mode
+func AnthropicToOpenAIRequest(req *AnthropicRequest) *OpenAIChatRequest {
+	openaiReq := &OpenAIChatRequest{
+		Model:       req.Model,
+		MaxTokens:   req.MaxTokens,
+		Temperature: req.Temperature,
+		TopP:        req.TopP,
+		Stream:      req.Stream,
+		Stop:        req.StopSequences,
+		User:        req.EndUserID(),
+	}
+
+	// Add system message if present
+	if req.System != nil && req.System != "" {
+		openaiReq.Messages = append(openaiReq.Messages, OpenAIMessage{
+			Role:    "system",
+			Content: req.System,
+		})
+	}
+
+	// Add messages
+	for _, msg := range req.Messages {
+		openaiReq.Messages = append(openaiReq.Messages, OpenAIMessage{
+			Role:    msg.Role,
+			Content: msg.Content,
+		})
+	}
+
+	return openaiReq
+}
+
+// AnthropicToOpenAIResponse converts an Anthropic Messages response into an
+// OpenAI chat completion
+func AnthropicToOpenAIResponse(resp *AnthropicResponse, model string) *OpenAIChatResponse {
+	content := ""
+	for _, c := range resp.Content {
+		if c.Type == "text" {
+			content += c.Text
+		}
+	}
+
+	finishReason := openAIFinishReason(resp.StopReason)
+	return &OpenAIChatResponse{
+		ID:      resp.ID,
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   model,
+		Choices: []OpenAIChoice{
+			{
+				Index: 0,
+				Message: OpenAIMessage{
+					Role:    "assistant",
+					Content: content,
+				},
+				FinishReason: &finishReason,
+			},
+		},
+		Usage: &OpenAIUsage{
+			PromptTokens:     resp.Usage.InputTokens,
+			CompletionTokens: resp.Usage.OutputTokens,
+			TotalTokens:      resp.Usage.InputTokens + resp.Usage.OutputTokens,
+		},
+	}
+}
+
+func openAIFinishReason(stopReason string) string {
+	if stopReason == "max_tokens" {
+		return "length"
+	}
+	return "stop"
+}
+
+// openAIStream converts the events of one Anthropic stream into OpenAI
+// chat.completion.chunk events
+type openAIStream struct {
+	id    string
+	model string
+}
+
+func newOpenAIStream(model string) *openAIStream {
+	return &openAIStream{id: "chatcmpl-" + uuid.New().String()[:8], model: model}
+}
+
+// convert returns the OpenAI data payload for an Anthropic event, if it has one
+func (s *openAIStream) convert(event *AnthropicStreamEvent) (string, bool) {
+	switch event.Type {
+	case "content_block_delta":
+		if event.Delta == nil || event.Delta.Text == "" {
+			return "", false
+		}
+		return s.chunk(&OpenAIMessage{Content: event.Delta.Text}, nil), true
+	case "message_delta":
+		if event.Delta == nil || event.Delta.StopReason == "" {
+			return "", false
+		}
+		finishReason := openAIFinishReason(event.Delta.StopReason)
+		return s.chunk(&OpenAIMessage{}, &finishReason), true
+	case "message_stop":
+		return "[DONE]", true
+	}
+	return "", false
+}
+
+func (s *openAIStream) chunk(delta *OpenAIMessage, finishReason *string) string {
+	chunk := OpenAIChatResponse{
+		ID:      s.id,
+		Object:  "chat.completion.chunk",
+		Created: time.Now().Unix(),
+		Model:   s.model,
+		Choices: []OpenAIChoice{
+			{
+				Index:        0,
+				Delta:        delta,
+				FinishReason: finishReason,
+			},
+		},
+	}
+	chunkJSON, _ := json.Marshal(chunk)
+	return string(chunkJSON)
+}
+
+// ConvertAnthropicStream converts an Anthropic SSE transcript into the OpenAI
+// chunks the proxy would stream for it. Lines that are not data lines and
+// events that cannot be parsed are skipped, as the proxy does.
+func ConvertAnthropicStream(r io.Reader, w io.Writer, model string) error {
+	scanner := bufio.NewScanner(r)
+	buf := make([]byte, 0, 64*1024)
+	scanner.Buffer(buf, 1024*1024)
+
+	stream := newOpenAIStream(model)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		if data == "[DONE]" {
+			if _, err := fmt.Fprint(w, "data: [DONE]\n\n"); err != nil {
+				return err
+			}
+			continue
+		}
+
+		var event AnthropicStreamEvent
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			continue
+		}
+		if stream.model == "" && event.Message != nil {
+			stream.model = event.Message.Model
+		}
+		if payload, ok := stream.convert(&event); ok {
+			if _, err := fmt.Fprintf(w, "data: %s\n\n", payload); err != nil {
+				return err
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+// ValidateAnthropicRequest checks a Messages request the way /v1/messages
+// does before sending it upstream
+func ValidateAnthropicRequest(req *AnthropicRequest) error {
+	return validateMessagesRequest(req)
+}
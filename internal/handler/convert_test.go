@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestAnthropicToOpenAIRequest(t *testing.T) {
+	tests := []struct {
+		name      string
+		req       AnthropicRequest
+		wantRoles string
+	}{
+		{"no system", AnthropicRequest{Messages: []AnthropicMessage{{Role: "user", Content: "hi"}}}, "user"},
+		{"system", AnthropicRequest{System: "be brief", Messages: []AnthropicMessage{{Role: "user", Content: "hi"}}}, "system,user"},
+		{"empty system", AnthropicRequest{System: "", Messages: []AnthropicMessage{{Role: "user", Content: "hi"}}}, "user"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var roles []string
+			for _, m := range AnthropicToOpenAIRequest(&tt.req).Messages {
+				roles = append(roles, m.Role)
+			}
+			if got := strings.Join(roles, ","); got != tt.wantRoles {
+				t.Errorf("roles = %s, want %s", got, tt.wantRoles)
+			}
+		})
+	}
+}
+
+func TestConvertAnthropicStream(t *testing.T) {
+	transcript := `event: message_start
+data: {"type":"message_start","message":{"id":"msg_1","model":"claude-opus-4"}}
+
+event: content_block_delta
+data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hel"}}
+
+data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"lo"}}
+
+data: not json
+
+data: {"type":"message_delta","delta":{"stop_reason":"max_tokens"},"usage":{"output_tokens":2}}
+
+data: {"type":"message_stop"}
+`
+	var out bytes.Buffer
+	if err := ConvertAnthropicStream(strings.NewReader(transcript), &out, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	var text, finish, model string
+	var done bool
+	for _, event := range strings.Split(strings.TrimSpace(out.String()), "\n\n") {
+		data := strings.TrimPrefix(event, "data: ")
+		if data == "[DONE]" {
+			done = true
+			continue
+		}
+		var chunk OpenAIChatResponse
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			t.Fatalf("chunk %q: %v", data, err)
+		}
+		model = chunk.Model
+		if content, ok := chunk.Choices[0].Delta.Content.(string); ok {
+			text += content
+		}
+		if chunk.Choices[0].FinishReason != nil {
+			finish = *chunk.Choices[0].FinishReason
+		}
+	}
+	if text != "Hello" || finish != "length" || model != "claude-opus-4" || !done {
+		t.Errorf("converted stream: text %q, finish %q, model %q, done %v", text, finish, model, done)
+	}
+}
@@ -0,0 +1,229 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+
+	"ccproxy/internal/flags"
+	"ccproxy/internal/service"
+	"ccproxy/internal/store"
+)
+
+const (
+	// costEstimateDefaultMaxTokens is the output cap of requests without
+	// max_tokens, matching the default of converted chat completions
+	costEstimateDefaultMaxTokens = 4096
+	// costEstimateHistory is how far back the typical output size is measured
+	costEstimateHistory = 24 * time.Hour
+)
+
+// CostEstimateRequest is a chat request in Anthropic Messages or OpenAI chat
+// completions format; other fields such as stream are ignored
+type CostEstimateRequest struct {
+	Model               string          `json:"model"`
+	System              interface{}     `json:"system,omitempty"`
+	Messages            []OpenAIMessage `json:"messages"`
+	Tools               json.RawMessage `json:"tools,omitempty"`
+	MaxTokens           int             `json:"max_tokens,omitempty"`
+	MaxCompletionTokens int             `json:"max_completion_tokens,omitempty"` // OpenAI name of max_tokens
+}
+
+// TokenRange is a predicted number of tokens
+type TokenRange struct {
+	Low  int `json:"low"`
+	High int `json:"high"`
+}
+
+// CostRange is a predicted cost in USD
+type CostRange struct {
+	Low  float64 `json:"low"`
+	High float64 `json:"high"`
+}
+
+// CostEstimateResponse previews the size and cost of a request
+type CostEstimateResponse struct {
+	Model              string     `json:"model"`
+	InputTokens        int        `json:"input_tokens"`
+	InputTokensSource  string     `json:"input_tokens_source"` // "count_tokens" or "local"
+	OutputTokens       TokenRange `json:"output_tokens"`
+	OutputTokensSource string     `json:"output_tokens_source"` // "history" or "max_tokens"
+	CostUSD            *CostRange `json:"cost_usd"`             // null for models without a price
+	PricedAs           string     `json:"priced_as,omitempty"`  // Price table entry used
+}
+
+// EstimateCost previews the input tokens, output range and cost of a chat
+// request without sending it. Input tokens come from count_tokens on an OAuth
+// account, falling back to a local estimate; the output ranges from the
+// model's average completion over the last day up to max_tokens.
+func (h *Sub2APIProxyHandler) EstimateCost(c *gin.Context) {
+	var req CostEstimateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		invalidRequest(c, err)
+		return
+	}
+	applyDefaultModel(c, &req.Model, h.defaultModel)
+	if req.Model == "" {
+		invalidRequest(c, errors.New("model: field required"))
+		return
+	}
+	if len(req.Messages) == 0 {
+		invalidRequest(c, errors.New("messages: must not be empty"))
+		return
+	}
+
+	// Chat completions carry the system prompt as messages
+	system := extractTextFromContent(req.System)
+	var messages []OpenAIMessage
+	var texts []string
+	for _, msg := range req.Messages {
+		if msg.Role == "system" {
+			system = appendToSystem(system, extractTextFromContent(msg.Content))
+			continue
+		}
+		role := "user"
+		if msg.Role == "assistant" {
+			role = "assistant"
+		}
+		messages = append(messages, OpenAIMessage{Role: role, Content: msg.Content})
+		texts = append(texts, extractTextFromContent(msg.Content))
+	}
+
+	resp := CostEstimateResponse{Model: req.Model, InputTokensSource: "local"}
+	countBody := gin.H{"model": req.Model, "messages": messages}
+	if system != "" {
+		countBody["system"] = system
+	}
+	if len(req.Tools) > 0 {
+		countBody["tools"] = req.Tools
+	}
+	body, _ := json.Marshal(countBody)
+	if tokens, ok := h.countInputTokens(c, req.Model, body); ok {
+		resp.InputTokens, resp.InputTokensSource = tokens, "count_tokens"
+	} else {
+		resp.InputTokens = service.EstimateMessageTokens(system, texts, string(req.Tools))
+	}
+
+	maxTokens := req.MaxTokens
+	if maxTokens <= 0 {
+		maxTokens = req.MaxCompletionTokens
+	}
+	if maxTokens <= 0 {
+		maxTokens = costEstimateDefaultMaxTokens
+	}
+	resp.OutputTokens = TokenRange{High: maxTokens}
+	resp.OutputTokensSource = "max_tokens"
+	if typical := h.typicalCompletionTokens(req.Model, time.Now()); typical > 0 {
+		resp.OutputTokens.Low = min(typical, maxTokens)
+		resp.OutputTokensSource = "history"
+	}
+
+	estimator := h.costEstimator
+	if estimator == nil {
+		estimator = service.NewCostEnricher(nil)
+	}
+	if price, ok := estimator.Price(req.Model); ok {
+		low, _ := estimator.Estimate(req.Model, resp.InputTokens, resp.OutputTokens.Low)
+		high, _ := estimator.Estimate(req.Model, resp.InputTokens, resp.OutputTokens.High)
+		resp.CostUSD = &CostRange{Low: low, High: high}
+		resp.PricedAs = price.Model
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// countInputTokens counts the input tokens of a count_tokens body upstream,
+// through the count_tokens cache. ok is false when no OAuth account can count
+// or the upstream fails.
+func (h *Sub2APIProxyHandler) countInputTokens(c *gin.Context, model string, body []byte) (int, bool) {
+	var result struct {
+		InputTokens int `json:"input_tokens"`
+	}
+
+	var cacheKey string
+	if h.countCache != nil && flags.Enabled(c.Request.Context(), flags.CountTokensCache) {
+		cacheKey = countTokensCacheKey(body, c.GetHeader("anthropic-beta"))
+		if cached, ok := h.countCache.Get(cacheKey); ok && json.Unmarshal(cached, &result) == nil {
+			return result.InputTokens, true
+		}
+	}
+
+	accounts, err := h.store.GetSchedulableAccounts()
+	if err != nil {
+		log.Warn().Err(err).Msg("failed to get schedulable accounts for cost estimate")
+		return 0, false
+	}
+	var account *store.Account
+	for _, a := range accounts {
+		if a.IsOAuth() {
+			account = a
+			break
+		}
+	}
+	if account == nil {
+		return 0, false
+	}
+	accessToken, err := h.getValidAccessToken(account)
+	if err != nil {
+		log.Warn().Err(err).Str("account_id", account.ID).Msg("failed to get access token for cost estimate")
+		return 0, false
+	}
+
+	req, err := http.NewRequestWithContext(c.Request.Context(), http.MethodPost, "https://api.anthropic.com/v1/messages/count_tokens?beta=true", bytes.NewReader(body))
+	if err != nil {
+		return 0, false
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	setCountTokensHeaders(req, h.betaHeaders.Resolve(account, model, c.GetHeader("anthropic-beta")))
+
+	client := h.upstreamClient(account.ID, countTokensTimeout)
+	resp, err := client.Do(req)
+	if err != nil {
+		log.Warn().Err(err).Str("account_id", account.ID).Msg("count_tokens failed for cost estimate")
+		return 0, false
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil || resp.StatusCode != http.StatusOK || json.Unmarshal(respBody, &result) != nil {
+		log.Warn().Int("status", resp.StatusCode).Str("account_id", account.ID).Msg("count_tokens failed for cost estimate, using local estimate")
+		return 0, false
+	}
+
+	if cacheKey != "" {
+		h.countCache.Set(cacheKey, account.ID, respBody)
+	}
+	return result.InputTokens, true
+}
+
+// typicalCompletionTokens is the model's average completion size over
+// successful requests of the last day, 0 without history
+func (h *Sub2APIProxyHandler) typicalCompletionTokens(model string, now time.Time) int {
+	series, err := h.store.GetTimeseries(store.TimeseriesQuery{
+		From:        now.Add(-costEstimateHistory),
+		To:          now,
+		Granularity: time.Hour,
+		Model:       model,
+	})
+	if err != nil {
+		log.Warn().Err(err).Str("model", model).Msg("failed to load recent completion sizes")
+		return 0
+	}
+
+	var tokens, requests int64
+	for _, s := range series {
+		for _, p := range s.Points {
+			tokens += p.CompletionTokens
+			requests += p.Successes
+		}
+	}
+	if requests == 0 {
+		return 0
+	}
+	return int(tokens / requests)
+}
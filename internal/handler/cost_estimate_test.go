@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"ccproxy/internal/service"
+	"ccproxy/internal/store"
+)
+
+func TestSub2APIProxyHandler_EstimateCost(t *testing.T) {
+	router, db := newAccountTestRouter(t)
+	h := NewSub2APIProxyHandler(db, nil)
+	h.SetCostEstimator(service.NewCostEnricher([]service.ModelPrice{{Model: "claude-sonnet-4", Input: 3, Output: 15}}))
+	router.POST("/v1/cost/estimate", h.EstimateCost)
+
+	// Without OAuth accounts the input is estimated locally; chat completion
+	// system messages count like a system prompt
+	code, resp := doJSON(t, router, http.MethodPost, "/v1/cost/estimate", `{
+		"model": "claude-sonnet-4-20250514",
+		"max_tokens": 1000,
+		"messages": [{"role": "system", "content": "be brief"}, {"role": "user", "content": "Hello, world!"}]
+	}`)
+	if code != http.StatusOK {
+		t.Fatalf("estimate: %d %v", code, resp)
+	}
+	if resp["input_tokens"] != 10.0 || resp["input_tokens_source"] != "local" || resp["output_tokens_source"] != "max_tokens" {
+		t.Fatalf("local estimate: %v", resp)
+	}
+	cost := resp["cost_usd"].(map[string]interface{})
+	if cost["low"] != 0.00003 || cost["high"] != 0.01503 || resp["priced_as"] != "claude-sonnet-4" {
+		t.Errorf("cost = %v (%v), want 0.00003-0.01503", cost, resp["priced_as"])
+	}
+
+	// The low end of the output follows recent completions of the model
+	for i, completion := range []int{200, 400} {
+		if err := db.CreateRequestLog(&store.RequestLog{
+			ID:               "log-" + string(rune('a'+i)),
+			TokenID:          "tok-1",
+			Mode:             "api",
+			Model:            "claude-sonnet-4-20250514",
+			RequestAt:        time.Now().Add(-time.Minute),
+			CompletionTokens: completion,
+			StatusCode:       http.StatusOK,
+			Success:          true,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, resp = doJSON(t, router, http.MethodPost, "/v1/cost/estimate", `{"model": "claude-sonnet-4-20250514", "messages": [{"role": "user", "content": "hi"}]}`)
+	output := resp["output_tokens"].(map[string]interface{})
+	if output["low"] != 300.0 || output["high"] != float64(costEstimateDefaultMaxTokens) || resp["output_tokens_source"] != "history" {
+		t.Errorf("output tokens = %v (%v), want 300-%d from history", output, resp["output_tokens_source"], costEstimateDefaultMaxTokens)
+	}
+
+	// Unpriced models still get token estimates
+	_, resp = doJSON(t, router, http.MethodPost, "/v1/cost/estimate", `{"model": "gpt-4o", "messages": [{"role": "user", "content": "hi"}]}`)
+	if resp["cost_usd"] != nil || resp["input_tokens"] == nil {
+		t.Errorf("unpriced model: %v", resp)
+	}
+
+	if code, _ := doJSON(t, router, http.MethodPost, "/v1/cost/estimate", `{"model": "claude-sonnet-4", "messages": []}`); code != http.StatusBadRequest {
+		t.Errorf("empty messages: status %d, want 400", code)
+	}
+}
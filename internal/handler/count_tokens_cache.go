@@ -0,0 +1,180 @@
+package handler
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// CountTokensCacheConfig configures the count_tokens response cache
+type CountTokensCacheConfig struct {
+	MaxEntries int
+	TTL        time.Duration
+}
+
+// DefaultCountTokensCacheConfig returns the default cache configuration
+func DefaultCountTokensCacheConfig() CountTokensCacheConfig {
+	return CountTokensCacheConfig{
+		MaxEntries: 1000,
+		TTL:        1 * time.Minute,
+	}
+}
+
+// CountTokensCacheStats contains cache statistics
+type CountTokensCacheStats struct {
+	Entries       int   `json:"entries"`
+	MaxEntries    int   `json:"max_entries"`
+	Hits          int64 `json:"hits"`
+	Misses        int64 `json:"misses"`
+	Evictions     int64 `json:"evictions"`
+	Invalidations int64 `json:"invalidations"`
+}
+
+type countTokensEntry struct {
+	key       string
+	accountID string
+	body      []byte
+	expiresAt time.Time
+}
+
+// CountTokensCache is an LRU cache of count_tokens responses keyed by request hash.
+// Clients like Claude Code send near-identical count_tokens requests many times per
+// turn; caching them briefly avoids spending account quota on repeated lookups.
+type CountTokensCache struct {
+	config  CountTokensCacheConfig
+	entries map[string]*list.Element
+	order   *list.List // front = most recently used
+	mu      sync.Mutex
+
+	hits          int64
+	misses        int64
+	evictions     int64
+	invalidations int64
+}
+
+// NewCountTokensCache creates a count_tokens cache
+func NewCountTokensCache(config CountTokensCacheConfig) *CountTokensCache {
+	if config.MaxEntries <= 0 {
+		config.MaxEntries = DefaultCountTokensCacheConfig().MaxEntries
+	}
+	if config.TTL <= 0 {
+		config.TTL = DefaultCountTokensCacheConfig().TTL
+	}
+	return &CountTokensCache{
+		config:  config,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// countTokensCacheKey hashes the request body together with the client beta header
+func countTokensCacheKey(body []byte, betaHeader string) string {
+	h := sha256.New()
+	h.Write([]byte(betaHeader))
+	h.Write([]byte{0})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Get returns a cached response body if present and not expired
+func (c *CountTokensCache) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		c.misses++
+		return nil, false
+	}
+
+	entry := elem.Value.(*countTokensEntry)
+	if time.Now().After(entry.expiresAt) {
+		c.removeLocked(elem)
+		c.misses++
+		return nil, false
+	}
+
+	c.order.MoveToFront(elem)
+	c.hits++
+	return entry.body, true
+}
+
+// Set stores a response body produced by the given account
+func (c *CountTokensCache) Set(key, accountID string, body []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expiresAt := time.Now().Add(c.config.TTL)
+	if elem, ok := c.entries[key]; ok {
+		entry := elem.Value.(*countTokensEntry)
+		entry.accountID = accountID
+		entry.body = body
+		entry.expiresAt = expiresAt
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&countTokensEntry{
+		key:       key,
+		accountID: accountID,
+		body:      body,
+		expiresAt: expiresAt,
+	})
+
+	for c.order.Len() > c.config.MaxEntries {
+		c.removeLocked(c.order.Back())
+		c.evictions++
+	}
+}
+
+// InvalidateAccount removes all entries produced by an account and returns how many were removed
+func (c *CountTokensCache) InvalidateAccount(accountID string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	removed := 0
+	for elem := c.order.Front(); elem != nil; {
+		next := elem.Next()
+		if elem.Value.(*countTokensEntry).accountID == accountID {
+			c.removeLocked(elem)
+			removed++
+		}
+		elem = next
+	}
+	c.invalidations += int64(removed)
+	return removed
+}
+
+// Clear removes all entries and returns how many were removed
+func (c *CountTokensCache) Clear() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	removed := c.order.Len()
+	c.entries = make(map[string]*list.Element)
+	c.order.Init()
+	c.invalidations += int64(removed)
+	return removed
+}
+
+// Stats returns cache statistics
+func (c *CountTokensCache) Stats() CountTokensCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return CountTokensCacheStats{
+		Entries:       c.order.Len(),
+		MaxEntries:    c.config.MaxEntries,
+		Hits:          c.hits,
+		Misses:        c.misses,
+		Evictions:     c.evictions,
+		Invalidations: c.invalidations,
+	}
+}
+
+func (c *CountTokensCache) removeLocked(elem *list.Element) {
+	entry := c.order.Remove(elem).(*countTokensEntry)
+	delete(c.entries, entry.key)
+}
@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCountTokensCacheKey(t *testing.T) {
+	body := []byte(`{"model":"claude-sonnet-4","messages":[]}`)
+	if countTokensCacheKey(body, "") != countTokensCacheKey(body, "") {
+		t.Error("identical requests should share a key")
+	}
+	if countTokensCacheKey(body, "") == countTokensCacheKey(body, "oauth-2025-04-20") {
+		t.Error("beta header should be part of the key")
+	}
+}
+
+func TestCountTokensCacheLRU(t *testing.T) {
+	cache := NewCountTokensCache(CountTokensCacheConfig{MaxEntries: 2, TTL: time.Minute})
+	cache.Set("a", "acc1", []byte("1"))
+	cache.Set("b", "acc1", []byte("2"))
+
+	// Touch "a" so "b" becomes least recently used
+	if _, ok := cache.Get("a"); !ok {
+		t.Fatal("expected hit for a")
+	}
+	cache.Set("c", "acc2", []byte("3"))
+
+	if _, ok := cache.Get("b"); ok {
+		t.Error("b should have been evicted")
+	}
+	if _, ok := cache.Get("a"); !ok {
+		t.Error("a should still be cached")
+	}
+	if stats := cache.Stats(); stats.Evictions != 1 || stats.Entries != 2 {
+		t.Errorf("got evictions=%d entries=%d, want 1 and 2", stats.Evictions, stats.Entries)
+	}
+}
+
+func TestCountTokensCacheExpiry(t *testing.T) {
+	cache := NewCountTokensCache(CountTokensCacheConfig{MaxEntries: 10, TTL: 20 * time.Millisecond})
+	cache.Set("a", "acc1", []byte("1"))
+
+	time.Sleep(40 * time.Millisecond)
+
+	if _, ok := cache.Get("a"); ok {
+		t.Error("expired entry should not be returned")
+	}
+}
+
+func TestCountTokensCacheInvalidateAccount(t *testing.T) {
+	cache := NewCountTokensCache(CountTokensCacheConfig{MaxEntries: 10, TTL: time.Minute})
+	cache.Set("a", "acc1", []byte("1"))
+	cache.Set("b", "acc2", []byte("2"))
+	cache.Set("c", "acc1", []byte("3"))
+
+	if removed := cache.InvalidateAccount("acc1"); removed != 2 {
+		t.Errorf("removed = %d, want 2", removed)
+	}
+	if _, ok := cache.Get("b"); !ok {
+		t.Error("entries of other accounts should be kept")
+	}
+	if _, ok := cache.Get("a"); ok {
+		t.Error("invalidated entry should be gone")
+	}
+}
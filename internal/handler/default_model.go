@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"encoding/json"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+
+	"ccproxy/internal/middleware"
+)
+
+// contextKeyModelDefaulted is set when the request's model was filled in
+const contextKeyModelDefaulted = "model_defaulted"
+
+// applyDefaultModel fills in the model of a request that names none: the
+// token's default model, else fallback. It reports whether a default was
+// substituted; the request log records it.
+func applyDefaultModel(c *gin.Context, model *string, fallback string) bool {
+	if *model != "" {
+		return false
+	}
+	defaultModel := c.GetString(middleware.ContextKeyDefaultModel)
+	if defaultModel == "" {
+		defaultModel = fallback
+	}
+	if defaultModel == "" {
+		return false
+	}
+	*model = defaultModel
+	c.Set(contextKeyModelDefaulted, true)
+	log.Debug().
+		Str("token_id", c.GetString(middleware.ContextKeyTokenID)).
+		Str("model", defaultModel).
+		Msg("request names no model, using default")
+	return true
+}
+
+// modelDefaulted reports whether applyDefaultModel filled in the model
+func modelDefaulted(c *gin.Context) bool {
+	return c.GetBool(contextKeyModelDefaulted)
+}
+
+// setBodyModel sets the model field of a JSON request body, keeping all
+// other fields; the body is returned unchanged if it is not a JSON object
+func setBodyModel(body []byte, model string) []byte {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return body
+	}
+	fields["model"], _ = json.Marshal(model)
+	out, err := json.Marshal(fields)
+	if err != nil {
+		return body
+	}
+	return out
+}
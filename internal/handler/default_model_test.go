@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"ccproxy/internal/middleware"
+)
+
+func TestApplyDefaultModel(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name         string
+		model        string
+		tokenDefault string
+		fallback     string
+		want         string
+		wantApplied  bool
+	}{
+		{"model given", "claude-opus-4", "claude-haiku-4", "claude-sonnet-4", "claude-opus-4", false},
+		{"token default", "", "claude-haiku-4", "claude-sonnet-4", "claude-haiku-4", true},
+		{"config default", "", "", "claude-sonnet-4", "claude-sonnet-4", true},
+		{"no default", "", "", "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			if tt.tokenDefault != "" {
+				c.Set(middleware.ContextKeyDefaultModel, tt.tokenDefault)
+			}
+			model := tt.model
+			applied := applyDefaultModel(c, &model, tt.fallback)
+			if model != tt.want || applied != tt.wantApplied || modelDefaulted(c) != tt.wantApplied {
+				t.Errorf("model = %q (applied %v, logged %v), want %q (%v)", model, applied, modelDefaulted(c), tt.want, tt.wantApplied)
+			}
+		})
+	}
+}
+
+func TestSetBodyModel(t *testing.T) {
+	body := setBodyModel([]byte(`{"max_tokens": 10, "unknown_field": {"kept": true}}`), "claude-sonnet-4")
+	var fields map[string]interface{}
+	if err := json.Unmarshal(body, &fields); err != nil {
+		t.Fatal(err)
+	}
+	if fields["model"] != "claude-sonnet-4" || fields["max_tokens"] != 10.0 || fields["unknown_field"] == nil {
+		t.Errorf("body = %s", body)
+	}
+	if got := setBodyModel([]byte(`not json`), "claude-sonnet-4"); string(got) != "not json" {
+		t.Errorf("invalid body changed to %s", got)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -17,6 +18,7 @@ import (
 
 	"ccproxy/internal/circuit"
 	"ccproxy/internal/concurrency"
+	"ccproxy/internal/flags"
 	"ccproxy/internal/loadbalancer"
 	"ccproxy/internal/metrics"
 	"ccproxy/internal/middleware"
@@ -44,6 +46,22 @@ type EnhancedProxyHandler struct {
 	retry         retry.Executor
 	metrics       *metrics.Metrics
 	requestLogger *service.RequestLogger
+	spendTracker  *service.SpendTracker
+	tracer        *service.Tracer
+	betaHeaders   *service.BetaHeaders
+	conversations *service.WebConversationCleaner
+	oauth         *service.OAuthService
+	pollJobs      *PollJobStore
+
+	// errorClassifier takes rate limited, unauthorized and overloaded web
+	// accounts out of scheduling
+	errorClassifier *ErrorClassifier
+
+	// webPromptLimit is the web mode prompt length, in characters, above
+	// which earlier messages are sent as a text attachment; 0 disables
+	webPromptLimit int
+	// defaultModel fills in requests without a model after the token's default
+	defaultModel string
 }
 
 // EnhancedProxyConfig holds configuration for the enhanced proxy handler
@@ -60,6 +78,40 @@ type EnhancedProxyConfig struct {
 	Retry         retry.Executor
 	Metrics       *metrics.Metrics
 	RequestLogger *service.RequestLogger
+	SpendTracker  *service.SpendTracker // Optional: spend of api_key account keys
+	Tracer        *service.Tracer       // Optional: trace headers for upstream API requests
+	BetaHeaders   *service.BetaHeaders  // Optional: anthropic-beta profiles, defaults when nil
+	// Conversations deletes the claude.ai conversations of web mode requests
+	// after their retention; optional
+	Conversations *service.WebConversationCleaner
+	// OAuth refreshes web mode OAuth tokens about to expire before they are
+	// used; optional
+	OAuth *service.OAuthService
+	// PollJobs keeps the jobs of chat completions sent with "poll": true;
+	// nil rejects them
+	PollJobs *PollJobStore
+	// WebPromptLimit moves earlier messages of longer web mode prompts into a
+	// text attachment; 0 disables
+	WebPromptLimit int
+	// DefaultModel is used for requests without a model when the token has no
+	// default model; "" rejects them
+	DefaultModel string
+}
+
+// WithStages returns the config without the scheduler, circuit breaker and
+// retry stages that are switched off. Without a scheduler the first eligible
+// account is used; without retry a failed request is not sent again.
+func (cfg EnhancedProxyConfig) WithStages(scheduler, circuit, retry bool) EnhancedProxyConfig {
+	if !scheduler {
+		cfg.Scheduler = nil
+	}
+	if !circuit {
+		cfg.Circuit = nil
+	}
+	if !retry {
+		cfg.Retry = nil
+	}
+	return cfg
 }
 
 // NewEnhancedProxyHandler creates a new enhanced proxy handler
@@ -77,21 +129,60 @@ func NewEnhancedProxyHandler(cfg EnhancedProxyConfig) *EnhancedProxyHandler {
 		retry:         cfg.Retry,
 		metrics:       cfg.Metrics,
 		requestLogger: cfg.RequestLogger,
+		spendTracker:  cfg.SpendTracker,
+		tracer:        cfg.Tracer,
+		betaHeaders:   cfg.BetaHeaders,
+		conversations: cfg.Conversations,
+		oauth:         cfg.OAuth,
+		pollJobs:      cfg.PollJobs,
+
+		errorClassifier: NewErrorClassifier(cfg.Store),
+
+		webPromptLimit: cfg.WebPromptLimit,
+		defaultModel:   cfg.DefaultModel,
 	}
 }
 
-// ChatCompletions handles OpenAI-compatible chat completions with enhanced features
-func (h *EnhancedProxyHandler) ChatCompletions(c *gin.Context) {
-	rawBody, err := io.ReadAll(c.Request.Body)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read request body"})
-		return
+// applyBeta sets the anthropic-beta header of an upstream Anthropic API
+// request sent with a pooled API key
+func (h *EnhancedProxyHandler) applyBeta(c *gin.Context, upstream *http.Request, apiKey, model string) {
+	var account *store.Account
+	if h.spendTracker != nil {
+		if accountID, ok := h.spendTracker.AccountID(apiKey); ok {
+			account = &store.Account{ID: accountID, Type: store.AccountTypeAPIKey}
+		}
 	}
-	filteredBody := FilterThinkingBlocks(rawBody)
-	c.Request.Body = io.NopCloser(bytes.NewBuffer(filteredBody))
+	if beta := h.betaHeaders.Resolve(account, model, c.GetHeader("anthropic-beta")); beta != "" {
+		upstream.Header.Set("anthropic-beta", beta)
+	}
+}
 
+// applyTrace adds trace headers to an upstream Anthropic API request and
+// returns the trace ID sent, if any
+func (h *EnhancedProxyHandler) applyTrace(c *gin.Context, upstream *http.Request, apiKey string) string {
+	if h.tracer == nil {
+		return ""
+	}
+	var accountID string
+	if h.spendTracker != nil {
+		accountID, _ = h.spendTracker.AccountID(apiKey)
+	}
+	trace := h.tracer.Context(accountID, c.GetHeader("traceparent"), c.GetHeader("tracestate"))
+	if trace.Traceparent == "" {
+		return ""
+	}
+	upstream.Header.Set("traceparent", trace.Traceparent)
+	if trace.Tracestate != "" {
+		upstream.Header.Set("tracestate", trace.Tracestate)
+	}
+	return trace.TraceID
+}
+
+// ChatCompletions handles OpenAI-compatible chat completions with enhanced features
+func (h *EnhancedProxyHandler) ChatCompletions(c *gin.Context) {
 	var req OpenAIChatRequest
-	if err := json.Unmarshal(filteredBody, &req); err != nil {
+	requestBytes, err := bindChatRequest(c, &req)
+	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
@@ -101,6 +192,29 @@ func (h *EnhancedProxyHandler) ChatCompletions(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "messages cannot be empty"})
 		return
 	}
+	applyDefaultModel(c, &req.Model, h.defaultModel)
+
+	// Files and poll jobs are only served in web mode; images are sent to
+	// the API as image blocks
+	mode := h.chatMode(c, &req)
+	if mode == "api" && hasFileAttachments(c, req.Messages) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file attachments require web mode"})
+		return
+	}
+	if mode == "api" && req.Poll {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "poll requires web mode"})
+		return
+	}
+	if mode == "web" {
+		if req.Attachments, err = collectWebAttachments(c, req.Messages); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if req.Poll && h.pollJobs == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "poll jobs are not enabled"})
+		return
+	}
 
 	// Get user info from context (token), fallback to metadata.user_id
 	userID, _ := c.Get(middleware.ContextKeyTokenID)
@@ -114,7 +228,6 @@ func (h *EnhancedProxyHandler) ChatCompletions(c *gin.Context) {
 	}
 
 	// Start metrics tracking
-	mode := h.determineMode(c)
 	tracker := h.metrics.NewRequestTracker(mode, req.Model)
 	defer func() {
 		tracker.Finish(c.Writer.Status())
@@ -139,15 +252,43 @@ func (h *EnhancedProxyHandler) ChatCompletions(c *gin.Context) {
 		enableConvLogging,
 		req.Messages,
 	)
+	logCtx.RequestID = middleware.GetRequestID(c)
+	logCtx.ModelDefaulted = modelDefaulted(c)
+	logCtx.EndUserID = req.EndUserID()
+	logCtx.ClientIP = c.ClientIP()
+	logCtx.UserAgent = c.Request.UserAgent()
+	logCtx.RequestBytes = requestBytes
+	c.Request = c.Request.WithContext(withQueueWait(c.Request.Context()))
+	logCtx.queueWait = queueWaitFromContext(c.Request.Context())
 	c.Set("log_context", logCtx)
 
+	// Child tokens count against their issuer's limits
+	quotaID := middleware.QuotaSubject(c, userIDStr)
+
+	// A poll job outlives this request; it holds the request's concurrency
+	// slot until its completion has been read
+	var poll *pollJobRun
+	if req.Poll {
+		poll = newPollJobRun(c)
+		defer poll.abandon()
+	}
+
 	// Rate limit check
 	if h.ratelimit != nil {
-		result, err := h.ratelimit.CheckAll(c.Request.Context(), userIDStr, "", c.ClientIP())
+		result, err := h.ratelimit.CheckAllExcept(c.Request.Context(), quotaID, "", c.ClientIP(), rateLimitBypass(c))
+		if err == nil && result.Allowed {
+			h.recordRateLimitBypass(c, result.Bypassed)
+		}
+		limitType := "user"
+		if err == nil && result.Allowed && logCtx.EndUserID != "" {
+			result, err = h.ratelimit.CheckEndUser(c.Request.Context(), userIDStr, logCtx.EndUserID)
+			limitType = "end_user"
+		}
 		if err != nil || !result.Allowed {
 			if h.metrics != nil {
-				h.metrics.RecordRateLimitHit("user")
+				h.metrics.RecordRateLimitHit(limitType)
 			}
+			setRateLimitHints(c, result)
 			c.JSON(http.StatusTooManyRequests, gin.H{
 				"error":    "rate limit exceeded",
 				"retry_at": result.RetryAt,
@@ -158,25 +299,57 @@ func (h *EnhancedProxyHandler) ChatCompletions(c *gin.Context) {
 
 	// Acquire user concurrency slot
 	if h.concurrency != nil {
-		result, err := h.concurrency.AcquireUserSlot(c.Request.Context(), userIDStr)
+		result, err := h.concurrency.AcquireUserSlot(c.Request.Context(), quotaID)
 		if err != nil {
+			if middleware.RequestTimedOut(c) {
+				middleware.AbortWithRequestTimeout(c)
+				return
+			}
 			c.JSON(http.StatusTooManyRequests, gin.H{"error": "too many concurrent requests"})
 			return
 		}
 		if result.WaitTime > 0 && h.metrics != nil {
 			h.metrics.RecordWait("user", result.WaitTime)
 		}
-		defer h.concurrency.ReleaseUserSlot(userIDStr)
+		addQueueWait(c.Request.Context(), result.WaitTime)
+		release := func() { h.concurrency.ReleaseUserSlot(quotaID) }
+		if poll != nil {
+			poll.onEnd(release)
+		} else {
+			defer release()
+		}
 	}
 
 	if mode == "web" {
-		h.handleWebModeEnhanced(c, &req, userIDStr, tracker)
+		h.handleWebModeEnhanced(c, &req, userIDStr, tracker, poll)
 	} else {
 		h.handleAPIModeEnhanced(c, &req, userIDStr, tracker)
 	}
 }
 
 func (h *EnhancedProxyHandler) determineMode(c *gin.Context) string {
+	if mode := requestedMode(c); mode != "" {
+		return mode
+	}
+	return h.defaultMode()
+}
+
+// chatMode picks the mode of a chat completion. Requests with file
+// attachments or a poll job go to web mode unless the token or header asks
+// for API mode.
+func (h *EnhancedProxyHandler) chatMode(c *gin.Context, req *OpenAIChatRequest) string {
+	if mode := requestedMode(c); mode != "" {
+		return mode
+	}
+	if hasFileAttachments(c, req.Messages) || req.Poll {
+		return "web"
+	}
+	return h.defaultMode()
+}
+
+// requestedMode returns the mode the token is limited to or the X-Proxy-Mode
+// header asks for, or "" when either mode may be used
+func requestedMode(c *gin.Context) string {
 	// Check token mode
 	if tokenMode, exists := c.Get(middleware.ContextKeyTokenMode); exists {
 		mode := tokenMode.(string)
@@ -191,14 +364,50 @@ func (h *EnhancedProxyHandler) determineMode(c *gin.Context) string {
 			return modeHeader
 		}
 	}
+	return ""
+}
 
-	// Default to API mode if keys are available, otherwise web
+// defaultMode is API mode if keys are available, otherwise web
+func (h *EnhancedProxyHandler) defaultMode() string {
 	if h.keyPool.Size() > 0 {
 		return "api"
 	}
 	return "web"
 }
 
+// bindChatRequest parses a JSON chat request, or a multipart/form-data request
+// with the JSON in a "request" field and files in "files" parts, without its
+// thinking blocks. Attachments are collected once the mode is known. It
+// returns the size of the request body.
+func bindChatRequest(c *gin.Context, req *OpenAIChatRequest) (int64, error) {
+	if strings.HasPrefix(c.ContentType(), "multipart/form-data") {
+		form, err := c.MultipartForm()
+		if err != nil {
+			return 0, fmt.Errorf("invalid multipart form: %w", err)
+		}
+		payload := form.Value["request"]
+		if len(payload) == 0 {
+			return 0, fmt.Errorf("multipart request requires a \"request\" field with the JSON body")
+		}
+		if err := json.Unmarshal(FilterThinkingBlocks([]byte(payload[0])), req); err != nil {
+			return 0, fmt.Errorf("invalid request field: %w", err)
+		}
+		return c.Request.ContentLength, nil
+	}
+
+	rawBody, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read request body")
+	}
+	filteredBody := FilterThinkingBlocks(rawBody)
+	c.Request.Body = io.NopCloser(bytes.NewBuffer(filteredBody))
+
+	if err := json.Unmarshal(filteredBody, req); err != nil {
+		return 0, err
+	}
+	return int64(len(rawBody)), nil
+}
+
 func (h *EnhancedProxyHandler) handleAPIModeEnhanced(c *gin.Context, req *OpenAIChatRequest, userID string, tracker *metrics.RequestTracker) {
 	apiKey := h.keyPool.Get()
 	if apiKey == "" {
@@ -220,6 +429,8 @@ func (h *EnhancedProxyHandler) handleAPIModeEnhanced(c *gin.Context, req *OpenAI
 	httpReq.Header.Set("x-api-key", apiKey)
 	httpReq.Header.Set("anthropic-version", "2023-06-01")
 	httpReq.Header.Set("Content-Type", "application/json")
+	h.applyBeta(c, httpReq, apiKey, anthropicReq.Model)
+	traceID := h.applyTrace(c, httpReq, apiKey)
 
 	var resp *http.Response
 	if h.pool != nil {
@@ -230,6 +441,10 @@ func (h *EnhancedProxyHandler) handleAPIModeEnhanced(c *gin.Context, req *OpenAI
 	}
 
 	if err != nil {
+		if middleware.RequestTimedOut(c) {
+			middleware.AbortWithRequestTimeout(c)
+			return
+		}
 		h.keyPool.ReportError(apiKey)
 		log.Error().Err(err).Msg("failed to call Anthropic API")
 		c.JSON(http.StatusBadGateway, gin.H{"error": "failed to connect to Anthropic API"})
@@ -243,6 +458,15 @@ func (h *EnhancedProxyHandler) handleAPIModeEnhanced(c *gin.Context, req *OpenAI
 		h.keyPool.ReportError(apiKey)
 	}
 
+	if logCtxVal, ok := c.Get("log_context"); ok {
+		if logCtx, ok := logCtxVal.(*RequestLogContext); ok {
+			logCtx.UpstreamRequestID = resp.Header.Get("request-id")
+			logCtx.TraceID = traceID
+			trackResponseBytes(resp, logCtx)
+		}
+	}
+	recordRetryTelemetry(c, 1, 0, "")
+
 	if req.Stream {
 		h.streamAPIResponseEnhanced(c, resp, req.Model, tracker)
 	} else {
@@ -250,11 +474,15 @@ func (h *EnhancedProxyHandler) handleAPIModeEnhanced(c *gin.Context, req *OpenAI
 	}
 }
 
-func (h *EnhancedProxyHandler) handleWebModeEnhanced(c *gin.Context, req *OpenAIChatRequest, userID string, tracker *metrics.RequestTracker) {
+func (h *EnhancedProxyHandler) handleWebModeEnhanced(c *gin.Context, req *OpenAIChatRequest, userID string, tracker *metrics.RequestTracker, poll *pollJobRun) {
 	ctx := c.Request.Context()
+	if poll != nil {
+		ctx = poll.ctx
+	}
 
-	// Get available accounts
-	accounts, err := h.store.ListAccounts()
+	// Get available accounts, leaving out rate limited, overloaded and
+	// quarantined ones and those outside their schedule windows
+	accounts, err := h.store.GetSchedulableAccounts()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list accounts"})
 		return
@@ -262,7 +490,7 @@ func (h *EnhancedProxyHandler) handleWebModeEnhanced(c *gin.Context, req *OpenAI
 
 	var accountIDs []string
 	for _, acc := range accounts {
-		if acc.IsActive && !acc.IsExpired() {
+		if acc.IsActive {
 			accountIDs = append(accountIDs, acc.ID)
 		}
 	}
@@ -272,9 +500,22 @@ func (h *EnhancedProxyHandler) handleWebModeEnhanced(c *gin.Context, req *OpenAI
 		return
 	}
 
+	// Skip accounts cooling down for this model
+	activeIDs := accountIDs
+	accountIDs = filterModelOverloaded(h.store, accountIDs, req.Model)
+	if len(accountIDs) == 0 {
+		setModelCooldownHints(c, h.store, activeIDs, req.Model)
+		c.JSON(StatusOverloaded, gin.H{"error": fmt.Sprintf("all accounts are overloaded for model %s, retry later", req.Model)})
+		return
+	}
+
+	// Draining accounts only finish their existing sessions
+	accountIDs, drainingIDs := splitDraining(h.store, accountIDs)
+
 	// Generate sticky session hash
 	stickyOpts := scheduler.StickyHashOptions{
-		UserID: userID,
+		UserID:    userID,
+		EndUserID: req.EndUserID(),
 	}
 	for _, msg := range req.Messages {
 		if msg.Role == "system" && stickyOpts.SystemPrompt == "" {
@@ -290,6 +531,7 @@ func (h *EnhancedProxyHandler) handleWebModeEnhanced(c *gin.Context, req *OpenAI
 		if h.scheduler != nil {
 			result, err := h.scheduler.SelectAccountWithRetry(ctx, scheduler.SelectOptions{
 				AccountIDs:  accountIDs,
+				DrainingIDs: drainingIDs,
 				SessionHash: sessionHash,
 				UserID:      userID,
 			}, excludeIDs)
@@ -316,8 +558,9 @@ func (h *EnhancedProxyHandler) handleWebModeEnhanced(c *gin.Context, req *OpenAI
 
 	// Operation function
 	opFn := func(ctx context.Context, accountID string) (*http.Response, error) {
-		return h.executeWebRequest(ctx, accountID, req)
+		return h.executeWebRequest(ctx, accountID, userID, req)
 	}
+	ctx = retry.WithBody(ctx, retry.NewPreparedBody(h.webPayload(req.Messages)))
 
 	// Execute with retry
 	var result *retry.ExecuteResult
@@ -343,6 +586,10 @@ func (h *EnhancedProxyHandler) handleWebModeEnhanced(c *gin.Context, req *OpenAI
 	}
 
 	if err != nil {
+		if middleware.RequestTimedOut(c) {
+			middleware.AbortWithRequestTimeout(c)
+			return
+		}
 		log.Error().Err(err).Int("attempts", result.Attempts).Int("switches", result.AccountSwitches).Msg("web request failed")
 		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
 		return
@@ -352,7 +599,13 @@ func (h *EnhancedProxyHandler) handleWebModeEnhanced(c *gin.Context, req *OpenAI
 		c.JSON(http.StatusBadGateway, gin.H{"error": "no response"})
 		return
 	}
-	defer result.Response.Body.Close()
+	// A poll job closes the response once it has read it
+	defer func() {
+		if poll == nil || !poll.started {
+			result.Response.Body.Close()
+		}
+	}()
+	recordRetryTelemetry(c, result.Attempts, result.AccountSwitches, result.AccountID)
 
 	// Update account last used
 	go h.store.UpdateAccountLastUsed(result.AccountID)
@@ -366,6 +619,7 @@ func (h *EnhancedProxyHandler) handleWebModeEnhanced(c *gin.Context, req *OpenAI
 	if logCtxVal, exists := c.Get("log_context"); exists {
 		if logCtx, ok := logCtxVal.(*RequestLogContext); ok {
 			logCtx.AccountID = result.AccountID
+			trackResponseBytes(result.Response, logCtx)
 		}
 	}
 
@@ -386,30 +640,41 @@ func (h *EnhancedProxyHandler) handleWebModeEnhanced(c *gin.Context, req *OpenAI
 		return
 	}
 
-	if req.Stream {
-		h.streamWebResponseEnhanced(c, result.Response, req.Model, tracker)
+	if poll != nil {
+		h.startPollJob(c, result.Response, req.Model, trailingPrefill(req.Messages), poll)
+	} else if req.Stream {
+		h.streamWebResponseEnhanced(c, result.Response, req.Model, trailingPrefill(req.Messages), tracker)
 	} else {
-		h.handleWebResponseEnhanced(c, result.Response, req.Model)
+		h.handleWebResponseEnhanced(c, result.Response, req.Model, trailingPrefill(req.Messages))
 	}
 }
 
-// executeWebRequest executes a web request for a specific account
-func (h *EnhancedProxyHandler) executeWebRequest(ctx context.Context, accountID string, req *OpenAIChatRequest) (*http.Response, error) {
+// executeWebRequest executes a web request for a specific account on behalf of a token
+func (h *EnhancedProxyHandler) executeWebRequest(ctx context.Context, accountID, tokenID string, req *OpenAIChatRequest) (*http.Response, error) {
 	account, err := h.store.GetAccount(accountID)
 	if err != nil || account == nil {
 		return nil, fmt.Errorf("account not found: %s", accountID)
 	}
 
+	// Refresh an OAuth token about to expire; if that fails the current one
+	// is tried
+	if h.oauth != nil && account.NeedsRefresh() {
+		if err := h.oauth.RefreshAccountToken(account); err != nil {
+			log.Warn().Err(err).Str("account_id", accountID).Msg("failed to refresh expiring OAuth token")
+		}
+	}
+
 	// Acquire account concurrency slot
 	if h.concurrency != nil {
-		result, err := h.concurrency.AcquireAccountSlot(ctx, accountID)
+		result, err := h.concurrency.AcquireAccountSlot(ctx, accountID, tokenID)
 		if err != nil {
 			return nil, fmt.Errorf("account concurrency limit: %w", err)
 		}
 		if result.WaitTime > 0 && h.metrics != nil {
 			h.metrics.RecordWait("account", result.WaitTime)
 		}
-		defer h.concurrency.ReleaseAccountSlot(accountID)
+		addQueueWait(ctx, result.WaitTime)
+		defer h.concurrency.ReleaseAccountSlot(accountID, tokenID)
 	}
 
 	// Check circuit breaker
@@ -417,16 +682,9 @@ func (h *EnhancedProxyHandler) executeWebRequest(ctx context.Context, accountID
 		return nil, fmt.Errorf("account unavailable (circuit open)")
 	}
 
-	// Build prompt from messages
-	prompt := h.buildPromptFromMessages(req.Messages)
-
-	// Create conversation
+	// Create conversation, in the account's project if it has one
 	convUUID := uuid.New().String()
-	createPayload := map[string]interface{}{
-		"uuid": convUUID,
-		"name": "",
-	}
-	createPayloadBytes, _ := json.Marshal(createPayload)
+	createPayloadBytes := webConversationPayload(convUUID, account)
 
 	createURL := fmt.Sprintf("%s/api/organizations/%s/chat_conversations", h.webURL, account.OrganizationID)
 	createReq, _ := http.NewRequestWithContext(ctx, "POST", createURL, bytes.NewReader(createPayloadBytes))
@@ -447,20 +705,39 @@ func (h *EnhancedProxyHandler) executeWebRequest(ctx context.Context, accountID
 	}
 	defer createResp.Body.Close()
 
+	if isCloudflareChallenge(createResp) {
+		h.recordAccountError(accountID)
+		quarantineCloudflareChallenge(h.store, accountID)
+		return nil, errCloudflareChallenge
+	}
+
 	if createResp.StatusCode != http.StatusOK && createResp.StatusCode != http.StatusCreated {
 		h.recordAccountError(accountID)
 		body, _ := io.ReadAll(createResp.Body)
 		return nil, fmt.Errorf("failed to create conversation: %s", string(body))
 	}
+	h.conversations.Track(account, convUUID)
+
+	// Send message; the payload is the same for every attempt, so reuse the
+	// caller's prepared one. When the project instructions carry the system
+	// prompt it is not inlined again.
+	var msgPayloadBytes []byte
+	if account.Project.CoversSystem(webSystemText(req.Messages)) {
+		msgPayloadBytes = h.webPayload(withoutSystemMessages(req.Messages))
+	} else if body := retry.BodyFromContext(ctx); body != nil {
+		msgPayloadBytes = body.Original()
+	} else {
+		msgPayloadBytes = h.webPayload(req.Messages)
+	}
 
-	// Send message
-	msgPayload := map[string]interface{}{
-		"prompt":      prompt,
-		"timezone":    "UTC",
-		"attachments": []any{},
-		"files":       []any{},
+	// Files are uploaded to the account's organization on every attempt
+	if len(req.Attachments) > 0 {
+		inline, files, err := h.prepareWebAttachments(ctx, account, req.Attachments)
+		if err != nil {
+			return nil, err
+		}
+		msgPayloadBytes = withWebAttachments(msgPayloadBytes, inline, files)
 	}
-	msgPayloadBytes, _ := json.Marshal(msgPayload)
 
 	msgURL := fmt.Sprintf("%s/api/organizations/%s/chat_conversations/%s/completion",
 		h.webURL, account.OrganizationID, convUUID)
@@ -482,8 +759,22 @@ func (h *EnhancedProxyHandler) executeWebRequest(ctx context.Context, accountID
 		return nil, fmt.Errorf("failed to send message: %w", err)
 	}
 
+	// Never stream a challenge page to the client
+	if isCloudflareChallenge(msgResp) {
+		msgResp.Body.Close()
+		h.recordAccountError(accountID)
+		quarantineCloudflareChallenge(h.store, accountID)
+		return nil, errCloudflareChallenge
+	}
+
 	if msgResp.StatusCode != http.StatusOK {
 		h.recordAccountError(accountID)
+		// Rate limits, auth failures and overloads also take the account out
+		// of scheduling until they clear; a 529 only for this model
+		switch msgResp.StatusCode {
+		case http.StatusTooManyRequests, http.StatusUnauthorized, http.StatusForbidden, http.StatusServiceUnavailable, StatusOverloaded:
+			h.errorClassifier.ClassifyAndHandleError(msgResp, accountID, req.Model)
+		}
 	} else {
 		h.recordAccountSuccess(accountID)
 	}
@@ -505,65 +796,38 @@ func (h *EnhancedProxyHandler) recordAccountSuccess(accountID string) {
 	if h.circuit != nil {
 		h.circuit.RecordSuccess(accountID)
 	}
-	go h.store.IncrementAccountSuccess(accountID)
+	go h.errorClassifier.RecordSuccess(accountID)
 }
 
 func (h *EnhancedProxyHandler) convertToAnthropic(req *OpenAIChatRequest) *AnthropicRequest {
-	anthropicReq := &AnthropicRequest{
-		Model:       req.Model,
-		MaxTokens:   req.MaxTokens,
-		Temperature: req.Temperature,
-		TopP:        req.TopP,
-		Stream:      req.Stream,
-	}
-
-	if anthropicReq.MaxTokens == 0 {
-		anthropicReq.MaxTokens = 4096
-	}
-
-	if len(req.Stop) > 0 {
-		anthropicReq.StopSequences = req.Stop
-	}
-
-	// Convert messages and extract system prompt
-	var systemText string
-	for _, msg := range req.Messages {
-		if msg.Role == "system" {
-			systemText = appendToSystem(systemText, extractTextFromContent(msg.Content))
-		} else {
-			role := msg.Role
-			if role == "assistant" {
-				role = "assistant"
-			} else {
-				role = "user"
-			}
-			anthropicReq.Messages = append(anthropicReq.Messages, AnthropicMessage{
-				Role:    role,
-				Content: msg.Content, // Keep original format (string or []any)
-			})
-		}
-	}
-
-	if systemText != "" {
-		anthropicReq.System = systemText
-	}
+	return OpenAIToAnthropicRequest(req)
+}
 
-	return anthropicReq
+// webPayload builds the claude.ai completion request for a conversation
+func (h *EnhancedProxyHandler) webPayload(messages []OpenAIMessage) []byte {
+	return webCompletionPayload(h.promptParts(messages), h.webPromptLimit)
 }
 
-func (h *EnhancedProxyHandler) buildPromptFromMessages(messages []OpenAIMessage) string {
+// promptParts flattens each message into a prompt paragraph
+func (h *EnhancedProxyHandler) promptParts(messages []OpenAIMessage) []string {
 	var parts []string
-	for _, msg := range messages {
+	for i, msg := range messages {
 		switch msg.Role {
 		case "system":
 			parts = append(parts, fmt.Sprintf("[System: %s]", extractTextFromContent(msg.Content)))
 		case "user":
 			parts = append(parts, extractTextFromContent(msg.Content))
 		case "assistant":
+			if i == len(messages)-1 {
+				if prefill := trailingPrefill(messages); prefill != "" {
+					parts = append(parts, prefillInstruction(prefill))
+				}
+				continue
+			}
 			parts = append(parts, fmt.Sprintf("[Assistant: %s]", extractTextFromContent(msg.Content)))
 		}
 	}
-	return strings.Join(parts, "\n\n")
+	return parts
 }
 
 func (h *EnhancedProxyHandler) setWebHeaders(req *http.Request, account *store.Account) {
@@ -583,9 +847,11 @@ func (h *EnhancedProxyHandler) setWebHeaders(req *http.Request, account *store.A
 
 	if account.IsOAuth() {
 		req.Header.Set("Authorization", "Bearer "+account.Credentials.AccessToken)
-		req.Header.Set("anthropic-beta", "oauth-2025-04-20")
-	} else {
-		req.Header.Set("Cookie", fmt.Sprintf("sessionKey=%s", account.Credentials.SessionKey))
+		req.Header.Set("anthropic-beta", h.betaHeaders.Resolve(account, "", ""))
+	}
+	// Session key and extra cookies such as cf_clearance
+	if cookie := account.WebCookieHeader(); cookie != "" {
+		req.Header.Set("Cookie", cookie)
 	}
 }
 
@@ -647,43 +913,12 @@ func (h *EnhancedProxyHandler) handleAPIResponseEnhanced(c *gin.Context, resp *h
 	}
 
 	openaiResp := h.convertToOpenAI(&anthropicResp, model)
+	openaiResp.SystemFingerprint = retryFingerprint(c)
 	c.JSON(http.StatusOK, openaiResp)
 }
 
 func (h *EnhancedProxyHandler) convertToOpenAI(resp *AnthropicResponse, model string) *OpenAIChatResponse {
-	content := ""
-	for _, c := range resp.Content {
-		if c.Type == "text" {
-			content += c.Text
-		}
-	}
-
-	finishReason := "stop"
-	if resp.StopReason == "max_tokens" {
-		finishReason = "length"
-	}
-
-	return &OpenAIChatResponse{
-		ID:      resp.ID,
-		Object:  "chat.completion",
-		Created: time.Now().Unix(),
-		Model:   model,
-		Choices: []OpenAIChoice{
-			{
-				Index: 0,
-				Message: OpenAIMessage{
-					Role:    "assistant",
-					Content: content,
-				},
-				FinishReason: &finishReason,
-			},
-		},
-		Usage: &OpenAIUsage{
-			PromptTokens:     resp.Usage.InputTokens,
-			CompletionTokens: resp.Usage.OutputTokens,
-			TotalTokens:      resp.Usage.InputTokens + resp.Usage.OutputTokens,
-		},
-	}
+	return AnthropicToOpenAIResponse(resp, model)
 }
 
 func (h *EnhancedProxyHandler) streamAPIResponseEnhanced(c *gin.Context, resp *http.Response, model string, tracker *metrics.RequestTracker) {
@@ -715,8 +950,9 @@ func (h *EnhancedProxyHandler) streamAPIResponseEnhanced(c *gin.Context, resp *h
 	buf := make([]byte, 0, 64*1024)
 	scanner.Buffer(buf, 1024*1024)
 
-	responseID := "chatcmpl-" + uuid.New().String()[:8]
+	stream := newOpenAIStream(model)
 	firstToken := true
+	completed := false
 	var completion strings.Builder
 	var inputTokens, outputTokens int
 
@@ -746,24 +982,6 @@ func (h *EnhancedProxyHandler) streamAPIResponseEnhanced(c *gin.Context, resp *h
 					firstToken = false
 				}
 				completion.WriteString(event.Delta.Text)
-				chunk := OpenAIChatResponse{
-					ID:      responseID,
-					Object:  "chat.completion.chunk",
-					Created: time.Now().Unix(),
-					Model:   model,
-					Choices: []OpenAIChoice{
-						{
-							Index: 0,
-							Delta: &OpenAIMessage{
-								Content: event.Delta.Text,
-							},
-							FinishReason: nil,
-						},
-					},
-				}
-				chunkJSON, _ := json.Marshal(chunk)
-				fmt.Fprintf(c.Writer, "data: %s\n\n", chunkJSON)
-				c.Writer.Flush()
 			}
 		case "message_start":
 			// Extract message ID for conversation ID
@@ -776,30 +994,12 @@ func (h *EnhancedProxyHandler) streamAPIResponseEnhanced(c *gin.Context, resp *h
 				inputTokens = event.Usage.InputTokens
 				outputTokens = event.Usage.OutputTokens
 			}
-			if event.Delta != nil && event.Delta.StopReason != "" {
-				finishReason := "stop"
-				if event.Delta.StopReason == "max_tokens" {
-					finishReason = "length"
-				}
-				chunk := OpenAIChatResponse{
-					ID:      responseID,
-					Object:  "chat.completion.chunk",
-					Created: time.Now().Unix(),
-					Model:   model,
-					Choices: []OpenAIChoice{
-						{
-							Index:        0,
-							Delta:        &OpenAIMessage{},
-							FinishReason: &finishReason,
-						},
-					},
-				}
-				chunkJSON, _ := json.Marshal(chunk)
-				fmt.Fprintf(c.Writer, "data: %s\n\n", chunkJSON)
-				c.Writer.Flush()
-			}
 		case "message_stop":
-			fmt.Fprintf(c.Writer, "data: [DONE]\n\n")
+			completed = true
+		}
+
+		if payload, ok := stream.convert(&event); ok {
+			fmt.Fprintf(c.Writer, "data: %s\n\n", payload)
 			c.Writer.Flush()
 		}
 	}
@@ -812,16 +1012,20 @@ func (h *EnhancedProxyHandler) streamAPIResponseEnhanced(c *gin.Context, resp *h
 		logCtx.PromptTokens = inputTokens
 		logCtx.CompletionTokens = outputTokens
 		logCtx.TotalTokens = inputTokens + outputTokens
+		if !completed {
+			logCtx.markTruncated(streamInterruption(c, scanner.Err()))
+		}
 		go h.logRequest(logCtx)
 	}
 }
 
-func (h *EnhancedProxyHandler) handleWebResponseEnhanced(c *gin.Context, resp *http.Response, model string) {
+func (h *EnhancedProxyHandler) handleWebResponseEnhanced(c *gin.Context, resp *http.Response, model, prefill string) {
 	// Get log context
 	logCtxVal, _ := c.Get("log_context")
 	logCtx, _ := logCtxVal.(*RequestLogContext)
 
 	var content strings.Builder
+	echo := newPrefillEcho(prefill)
 	scanner := bufio.NewScanner(resp.Body)
 	buf := make([]byte, 0, 64*1024)
 	scanner.Buffer(buf, 1024*1024)
@@ -846,7 +1050,7 @@ func (h *EnhancedProxyHandler) handleWebResponseEnhanced(c *gin.Context, resp *h
 			}
 
 			if completion, ok := event["completion"].(string); ok && completion != "" {
-				content.WriteString(completion)
+				content.WriteString(echo.Write(completion))
 			}
 
 			if reason, ok := event["stop_reason"].(string); ok && reason != "" {
@@ -857,6 +1061,7 @@ func (h *EnhancedProxyHandler) handleWebResponseEnhanced(c *gin.Context, resp *h
 			}
 		}
 	}
+	content.WriteString(echo.Flush())
 
 	if content.Len() == 0 {
 		// Update log context with error
@@ -895,12 +1100,107 @@ func (h *EnhancedProxyHandler) handleWebResponseEnhanced(c *gin.Context, resp *h
 				FinishReason: &stopReason,
 			},
 		},
+		SystemFingerprint: retryFingerprint(c),
 	}
 
 	c.JSON(http.StatusOK, openaiResp)
 }
 
-func (h *EnhancedProxyHandler) streamWebResponseEnhanced(c *gin.Context, resp *http.Response, model string, tracker *metrics.RequestTracker) {
+// startPollJob reads the upstream completion into a poll job in the
+// background and replies with the job, which the client polls via
+// GET /v1/chat/completions/:id/poll
+func (h *EnhancedProxyHandler) startPollJob(c *gin.Context, resp *http.Response, model, prefill string, run *pollJobRun) {
+	logCtxVal, _ := c.Get("log_context")
+	logCtx, _ := logCtxVal.(*RequestLogContext)
+
+	job := h.pollJobs.Create(c.GetString(middleware.ContextKeyTokenID), model)
+	run.started = true
+
+	go func() {
+		defer run.end()
+		defer resp.Body.Close()
+
+		var completion strings.Builder
+		echo := newPrefillEcho(prefill)
+		write := func(text string) {
+			if text != "" {
+				completion.WriteString(text)
+				job.append(text)
+			}
+		}
+		finishReason, err := readWebCompletion(resp.Body, func(text string) {
+			write(echo.Write(text))
+		})
+		write(echo.Flush())
+
+		// The request was logged as accepted; the log holds the completion
+		if logCtx != nil {
+			logCtx.StatusCode = http.StatusOK
+			logCtx.ResponseAt = time.Now()
+			logCtx.Completion = completion.String()
+			if err != nil {
+				logCtx.markTruncated(err.Error())
+			}
+			go h.logRequest(logCtx)
+		}
+
+		if err != nil {
+			log.Error().Err(err).Str("job_id", job.ID).Msg("poll job upstream read failed")
+			job.finish("", "upstream stream interrupted")
+			return
+		}
+		job.finish(finishReason, "")
+	}()
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"id":       job.ID,
+		"object":   "chat.completion.job",
+		"created":  job.CreatedAt.Unix(),
+		"model":    model,
+		"status":   PollJobRunning,
+		"poll_url": "/v1/chat/completions/" + job.ID + "/poll",
+	})
+}
+
+// PollCompletion returns the accumulated text of a poll job.
+// Query params: cursor (byte offset already received), wait (long-poll duration, e.g. "20s", "0" to return immediately).
+func (h *EnhancedProxyHandler) PollCompletion(c *gin.Context) {
+	var job *PollJob
+	if h.pollJobs != nil {
+		job = h.pollJobs.Get(c.Param("id"))
+	}
+
+	tokenID := c.GetString(middleware.ContextKeyTokenID)
+	if job == nil || job.TokenID != tokenID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
+		return
+	}
+
+	cursor, err := strconv.Atoi(c.DefaultQuery("cursor", "0"))
+	if err != nil || cursor < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid cursor"})
+		return
+	}
+
+	wait := pollDefaultWait
+	if waitStr := c.Query("wait"); waitStr != "" {
+		if wait, err = time.ParseDuration(waitStr); err != nil || wait < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid wait duration"})
+			return
+		}
+	}
+	if wait > pollMaxWait {
+		wait = pollMaxWait
+	}
+
+	if wait > 0 {
+		job.Wait(cursor, wait, c.Request.Context().Done())
+	}
+
+	c.JSON(http.StatusOK, job.Snapshot(cursor))
+}
+
+func (h *EnhancedProxyHandler) streamWebResponseEnhanced(c *gin.Context, resp *http.Response, model, prefill string, tracker *metrics.RequestTracker) {
 	// Get log context
 	logCtxVal, _ := c.Get("log_context")
 	logCtx, _ := logCtxVal.(*RequestLogContext)
@@ -915,9 +1215,36 @@ func (h *EnhancedProxyHandler) streamWebResponseEnhanced(c *gin.Context, resp *h
 	scanner.Buffer(buf, 1024*1024)
 	responseID := "chatcmpl-" + uuid.New().String()[:8]
 	firstToken := true
+	completed := false
 	var completion strings.Builder
+	echo := newPrefillEcho(prefill)
+	emit := func(text string) {
+		if text == "" {
+			return
+		}
+		completion.WriteString(text)
+		chunk := OpenAIChatResponse{
+			ID:      responseID,
+			Object:  "chat.completion.chunk",
+			Created: time.Now().Unix(),
+			Model:   model,
+			Choices: []OpenAIChoice{
+				{
+					Index: 0,
+					Delta: &OpenAIMessage{
+						Content: text,
+					},
+					FinishReason: nil,
+				},
+			},
+		}
+		chunkJSON, _ := json.Marshal(chunk)
+		fmt.Fprintf(c.Writer, "data: %s\n\n", chunkJSON)
+		c.Writer.Flush()
+	}
 
 	defer func() {
+		emit(echo.Flush())
 		fmt.Fprintf(c.Writer, "data: [DONE]\n\n")
 		c.Writer.Flush()
 
@@ -927,6 +1254,9 @@ func (h *EnhancedProxyHandler) streamWebResponseEnhanced(c *gin.Context, resp *h
 			logCtx.ResponseAt = time.Now()
 			logCtx.Completion = completion.String()
 			// Note: Web mode may not provide token counts, they'll remain 0
+			if !completed {
+				logCtx.markTruncated(streamInterruption(c, scanner.Err()))
+			}
 			go h.logRequest(logCtx)
 		}
 	}()
@@ -943,6 +1273,7 @@ func (h *EnhancedProxyHandler) streamWebResponseEnhanced(c *gin.Context, resp *h
 
 		data := strings.TrimPrefix(line, "data: ")
 		if data == "[DONE]" {
+			completed = true
 			break
 		}
 
@@ -956,28 +1287,11 @@ func (h *EnhancedProxyHandler) streamWebResponseEnhanced(c *gin.Context, resp *h
 				tracker.RecordTTFT()
 				firstToken = false
 			}
-			completion.WriteString(completionText)
-			chunk := OpenAIChatResponse{
-				ID:      responseID,
-				Object:  "chat.completion.chunk",
-				Created: time.Now().Unix(),
-				Model:   model,
-				Choices: []OpenAIChoice{
-					{
-						Index: 0,
-						Delta: &OpenAIMessage{
-							Content: completionText,
-						},
-						FinishReason: nil,
-					},
-				},
-			}
-			chunkJSON, _ := json.Marshal(chunk)
-			fmt.Fprintf(c.Writer, "data: %s\n\n", chunkJSON)
-			c.Writer.Flush()
+			emit(echo.Write(completionText))
 		}
 
 		if stopReason, ok := event["stop_reason"].(string); ok && stopReason != "" {
+			emit(echo.Flush())
 			finishReason := "stop"
 			if stopReason == "max_tokens" {
 				finishReason = "length"
@@ -998,6 +1312,7 @@ func (h *EnhancedProxyHandler) streamWebResponseEnhanced(c *gin.Context, resp *h
 			chunkJSON, _ := json.Marshal(chunk)
 			fmt.Fprintf(c.Writer, "data: %s\n\n", chunkJSON)
 			c.Writer.Flush()
+			completed = true
 			break
 		}
 	}
@@ -1007,10 +1322,26 @@ func (h *EnhancedProxyHandler) streamWebResponseEnhanced(c *gin.Context, resp *h
 func (h *EnhancedProxyHandler) Messages(c *gin.Context) {
 	log.Info().Msg("[Messages] Request received")
 
+	// Kept for strict passthrough, which forwards the body as received
+	rawBody, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read request body"})
+		return
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(rawBody))
+
 	var req AnthropicRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		log.Error().Err(err).Msg("[Messages] Failed to parse request")
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		invalidRequest(c, err)
+		return
+	}
+	if applyDefaultModel(c, &req.Model, h.defaultModel) {
+		rawBody = setBodyModel(rawBody, req.Model)
+	}
+	if err := validateMessagesRequest(&req); err != nil {
+		log.Warn().Err(err).Str("model", req.Model).Msg("[Messages] Invalid request")
+		invalidRequest(c, err)
 		return
 	}
 
@@ -1037,15 +1368,28 @@ func (h *EnhancedProxyHandler) Messages(c *gin.Context) {
 	defer func() {
 		tracker.Finish(c.Writer.Status())
 	}()
+	c.Request = c.Request.WithContext(withQueueWait(c.Request.Context()))
+
+	// Child tokens count against their issuer's limits
+	quotaID := middleware.QuotaSubject(c, userIDStr)
 
 	// Rate limit check
 	if h.ratelimit != nil {
-		result, err := h.ratelimit.CheckAll(c.Request.Context(), userIDStr, "", c.ClientIP())
+		result, err := h.ratelimit.CheckAllExcept(c.Request.Context(), quotaID, "", c.ClientIP(), rateLimitBypass(c))
+		if err == nil && result.Allowed {
+			h.recordRateLimitBypass(c, result.Bypassed)
+		}
+		limitType := "user"
+		if endUserID := req.EndUserID(); err == nil && result.Allowed && endUserID != "" {
+			result, err = h.ratelimit.CheckEndUser(c.Request.Context(), userIDStr, endUserID)
+			limitType = "end_user"
+		}
 		if err != nil || !result.Allowed {
-			log.Warn().Str("user_id", userIDStr).Msg("[Messages] Rate limit exceeded")
+			log.Warn().Str("user_id", userIDStr).Str("limit", limitType).Msg("[Messages] Rate limit exceeded")
 			if h.metrics != nil {
-				h.metrics.RecordRateLimitHit("user")
+				h.metrics.RecordRateLimitHit(limitType)
 			}
+			setRateLimitHints(c, result)
 			c.JSON(http.StatusTooManyRequests, gin.H{
 				"error":    "rate limit exceeded",
 				"retry_at": result.RetryAt,
@@ -1056,8 +1400,12 @@ func (h *EnhancedProxyHandler) Messages(c *gin.Context) {
 
 	// Acquire user concurrency slot
 	if h.concurrency != nil {
-		result, err := h.concurrency.AcquireUserSlot(c.Request.Context(), userIDStr)
+		result, err := h.concurrency.AcquireUserSlot(c.Request.Context(), quotaID)
 		if err != nil {
+			if middleware.RequestTimedOut(c) {
+				middleware.AbortWithRequestTimeout(c)
+				return
+			}
 			log.Warn().Str("user_id", userIDStr).Err(err).Msg("[Messages] Concurrency limit exceeded")
 			c.JSON(http.StatusTooManyRequests, gin.H{"error": "too many concurrent requests"})
 			return
@@ -1065,20 +1413,21 @@ func (h *EnhancedProxyHandler) Messages(c *gin.Context) {
 		if result.WaitTime > 0 && h.metrics != nil {
 			h.metrics.RecordWait("user", result.WaitTime)
 		}
-		defer h.concurrency.ReleaseUserSlot(userIDStr)
+		addQueueWait(c.Request.Context(), result.WaitTime)
+		defer h.concurrency.ReleaseUserSlot(quotaID)
 	}
 
 	// Try API mode first if keys available, otherwise use Web mode
 	if mode == "api" && h.keyPool.Size() > 0 {
 		log.Info().Msg("[Messages] Using API mode")
-		h.handleMessagesAPI(c, &req, userIDStr, tracker)
+		h.handleMessagesAPI(c, &req, rawBody, userIDStr, tracker)
 	} else {
 		log.Info().Str("reason", fmt.Sprintf("mode=%s, keypool_size=%d", mode, h.keyPool.Size())).Msg("[Messages] Using Web mode")
 		h.handleMessagesWeb(c, &req, userIDStr, tracker)
 	}
 }
 
-func (h *EnhancedProxyHandler) handleMessagesAPI(c *gin.Context, req *AnthropicRequest, userID string, tracker *metrics.RequestTracker) {
+func (h *EnhancedProxyHandler) handleMessagesAPI(c *gin.Context, req *AnthropicRequest, rawBody []byte, userID string, tracker *metrics.RequestTracker) {
 	log.Info().Msg("[Messages API] Getting API key from pool")
 	apiKey := h.keyPool.Get()
 	if apiKey == "" {
@@ -1089,32 +1438,80 @@ func (h *EnhancedProxyHandler) handleMessagesAPI(c *gin.Context, req *AnthropicR
 	}
 	log.Debug().Str("key_prefix", apiKey[:20]+"...").Msg("[Messages API] Got API key")
 
-	payloadBytes, _ := json.Marshal(req)
-	targetURL := h.apiURL + "/v1/messages"
-	httpReq, err := http.NewRequestWithContext(c.Request.Context(), "POST", targetURL, bytes.NewReader(payloadBytes))
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create request"})
-		return
+	// Strict passthrough sends the client's bytes instead of the re-encoded
+	// request, so fields the proxy does not know about survive
+	strict := strictPassthrough(c)
+	payloadBytes := rawBody
+	if !strict {
+		payloadBytes, _ = json.Marshal(req)
 	}
+	body := retry.NewPreparedBody(payloadBytes)
+	targetURL := h.apiURL + "/v1/messages"
 
-	httpReq.Header.Set("x-api-key", apiKey)
-	httpReq.Header.Set("anthropic-version", "2023-06-01")
-	httpReq.Header.Set("Content-Type", "application/json")
-
-	// Copy anthropic-beta header if present
-	if beta := c.GetHeader("anthropic-beta"); beta != "" {
-		httpReq.Header.Set("anthropic-beta", beta)
+	userName, _ := c.Get(middleware.ContextKeyUserName)
+	userNameStr, _ := userName.(string)
+	logCtx := createRequestLogContext(userID, "", userNameStr, "api", req.Model, req.Stream, false, nil)
+	logCtx.ModelDefaulted = modelDefaulted(c)
+	logCtx.RequestID = middleware.GetRequestID(c)
+	logCtx.queueWait = queueWaitFromContext(c.Request.Context())
+	logCtx.EndUserID = req.EndUserID()
+	logCtx.ClientIP = c.ClientIP()
+	logCtx.UserAgent = c.Request.UserAgent()
+	logCtx.RequestBytes = int64(len(payloadBytes))
+	if h.spendTracker != nil {
+		logCtx.AccountID, _ = h.spendTracker.AccountID(apiKey)
+	}
+
+	send := func(payload []byte) (*http.Response, error) {
+		httpReq, err := http.NewRequestWithContext(c.Request.Context(), "POST", targetURL, bytes.NewReader(payload))
+		if err != nil {
+			return nil, err
+		}
+		httpReq.Header.Set("x-api-key", apiKey)
+		httpReq.Header.Set("anthropic-version", "2023-06-01")
+		httpReq.Header.Set("Content-Type", "application/json")
+		h.applyBeta(c, httpReq, apiKey, req.Model)
+		logCtx.TraceID = h.applyTrace(c, httpReq, apiKey)
+
+		if h.pool != nil {
+			return h.pool.Do(httpReq, "api")
+		}
+		client := &http.Client{Timeout: 10 * time.Minute}
+		return client.Do(httpReq)
 	}
 
-	var resp *http.Response
-	if h.pool != nil {
-		resp, err = h.pool.Do(httpReq, "api")
-	} else {
-		client := &http.Client{Timeout: 10 * time.Minute}
-		resp, err = client.Do(httpReq)
+	resp, err := send(body.Original())
+	attempts := 1
+
+	// Rejected thinking blocks are retried with filtered bodies, each variant
+	// derived once and only if needed
+	sent := body.Original()
+	thinkingRetry := !strict && flags.Enabled(c.Request.Context(), flags.ThinkingRetry)
+	for _, variant := range thinkingRetryVariants {
+		if !thinkingRetry || err != nil || resp.StatusCode != http.StatusBadRequest {
+			break
+		}
+		errBody, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		resp.Body = io.NopCloser(bytes.NewReader(errBody))
+		if !isThinkingBlockError(errBody) {
+			break
+		}
+		payload := body.Variant(variant.name, variant.derive)
+		if bytes.Equal(payload, sent) {
+			continue
+		}
+		log.Warn().Str("variant", variant.name).Msg("[Messages API] Thinking blocks rejected, retrying with filtered body")
+		sent = payload
+		resp, err = send(payload)
+		attempts++
 	}
 
 	if err != nil {
+		if middleware.RequestTimedOut(c) {
+			middleware.AbortWithRequestTimeout(c)
+			return
+		}
 		h.keyPool.ReportError(apiKey)
 		log.Error().Err(err).Msg("failed to call Anthropic API")
 		c.JSON(http.StatusBadGateway, gin.H{"error": "failed to connect to Anthropic API"})
@@ -1134,10 +1531,36 @@ func (h *EnhancedProxyHandler) handleMessagesAPI(c *gin.Context, req *AnthropicR
 			c.Writer.Header().Add(key, value)
 		}
 	}
+	recordRetryTelemetry(c, attempts, 0, logCtx.AccountID)
+
+	logCtx.StatusCode = resp.StatusCode
+	logCtx.UpstreamRequestID = resp.Header.Get("request-id")
+	trackResponseBytes(resp, logCtx)
+	defer func() {
+		logCtx.ResponseAt = time.Now()
+		go h.logRequest(logCtx)
+	}()
 
 	// Stream response directly (no conversion needed for Anthropic native format)
 	c.Status(resp.StatusCode)
-	io.Copy(c.Writer, resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(c.Writer, resp.Body)
+		return
+	}
+
+	// Read usage on the way through for the request log and the key's spend
+	usage := newUsageRecorder(resp.Header.Get("Content-Type"))
+	if err := copyStream(c.Writer, io.TeeReader(resp.Body, usage)); err != nil {
+		log.Warn().Err(err).Msg("[Messages API] Response stream interrupted")
+		logCtx.markTruncated(streamInterruption(c, err))
+	}
+	inputTokens, outputTokens := usage.Usage()
+	logCtx.PromptTokens = inputTokens
+	logCtx.CompletionTokens = outputTokens
+	logCtx.TotalTokens = inputTokens + outputTokens
+	if h.spendTracker != nil {
+		h.spendTracker.Record(apiKey, req.Model, inputTokens, outputTokens)
+	}
 }
 
 func (h *EnhancedProxyHandler) handleMessagesWeb(c *gin.Context, req *AnthropicRequest, userID string, tracker *metrics.RequestTracker) {
@@ -1176,12 +1599,26 @@ func (h *EnhancedProxyHandler) handleMessagesWeb(c *gin.Context, req *AnthropicR
 		return
 	}
 
+	// Skip accounts cooling down for this model
+	activeIDs := accountIDs
+	accountIDs = filterModelOverloaded(h.store, accountIDs, req.Model)
+	if len(accountIDs) == 0 {
+		setModelCooldownHints(c, h.store, activeIDs, req.Model)
+		log.Warn().Str("model", req.Model).Msg("[Messages Web] All accounts overloaded for model - returning 529")
+		c.JSON(StatusOverloaded, gin.H{"error": fmt.Sprintf("all accounts are overloaded for model %s, retry later", req.Model)})
+		return
+	}
+
+	// Draining accounts only finish their existing sessions
+	accountIDs, drainingIDs := splitDraining(h.store, accountIDs)
+
 	// Convert Anthropic request to OpenAI format for internal processing
 	openaiReq := h.convertAnthropicToOpenAI(req)
 
 	// Generate sticky session hash
 	stickyOpts := scheduler.StickyHashOptions{
 		UserID:       userID,
+		EndUserID:    req.EndUserID(),
 		SystemPrompt: extractTextFromContent(req.System),
 	}
 	for _, msg := range req.Messages {
@@ -1196,6 +1633,7 @@ func (h *EnhancedProxyHandler) handleMessagesWeb(c *gin.Context, req *AnthropicR
 		if h.scheduler != nil {
 			result, err := h.scheduler.SelectAccountWithRetry(ctx, scheduler.SelectOptions{
 				AccountIDs:  accountIDs,
+				DrainingIDs: drainingIDs,
 				SessionHash: sessionHash,
 				UserID:      userID,
 			}, excludeIDs)
@@ -1222,8 +1660,9 @@ func (h *EnhancedProxyHandler) handleMessagesWeb(c *gin.Context, req *AnthropicR
 
 	// Operation function
 	opFn := func(ctx context.Context, accountID string) (*http.Response, error) {
-		return h.executeWebRequest(ctx, accountID, openaiReq)
+		return h.executeWebRequest(ctx, accountID, userID, openaiReq)
 	}
+	ctx = retry.WithBody(ctx, retry.NewPreparedBody(h.webPayload(openaiReq.Messages)))
 
 	// Execute with retry
 	var result *retry.ExecuteResult
@@ -1249,6 +1688,10 @@ func (h *EnhancedProxyHandler) handleMessagesWeb(c *gin.Context, req *AnthropicR
 	}
 
 	if err != nil {
+		if middleware.RequestTimedOut(c) {
+			middleware.AbortWithRequestTimeout(c)
+			return
+		}
 		log.Error().Err(err).Int("attempts", result.Attempts).Int("switches", result.AccountSwitches).Msg("web request failed")
 		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
 		return
@@ -1259,6 +1702,7 @@ func (h *EnhancedProxyHandler) handleMessagesWeb(c *gin.Context, req *AnthropicR
 		return
 	}
 	defer result.Response.Body.Close()
+	recordRetryTelemetry(c, result.Attempts, result.AccountSwitches, result.AccountID)
 
 	// Update account last used
 	go h.store.UpdateAccountLastUsed(result.AccountID)
@@ -1284,32 +1728,7 @@ func (h *EnhancedProxyHandler) handleMessagesWeb(c *gin.Context, req *AnthropicR
 
 // convertAnthropicToOpenAI converts Anthropic request to OpenAI format for Web mode
 func (h *EnhancedProxyHandler) convertAnthropicToOpenAI(req *AnthropicRequest) *OpenAIChatRequest {
-	openaiReq := &OpenAIChatRequest{
-		Model:       req.Model,
-		MaxTokens:   req.MaxTokens,
-		Temperature: req.Temperature,
-		TopP:        req.TopP,
-		Stream:      req.Stream,
-		Stop:        req.StopSequences,
-	}
-
-	// Add system message if present
-	if req.System != "" {
-		openaiReq.Messages = append(openaiReq.Messages, OpenAIMessage{
-			Role:    "system",
-			Content: req.System,
-		})
-	}
-
-	// Add messages
-	for _, msg := range req.Messages {
-		openaiReq.Messages = append(openaiReq.Messages, OpenAIMessage{
-			Role:    msg.Role,
-			Content: msg.Content,
-		})
-	}
-
-	return openaiReq
+	return AnthropicToOpenAIRequest(req)
 }
 
 // handleWebResponseToAnthropic converts Web SSE response to Anthropic format
@@ -22,7 +22,7 @@ func NewErrorClassifier(st *store.Store) *ErrorClassifier {
 
 // ClassifyAndHandleError classifies an HTTP error and updates account status
 // Returns true if the error should trigger account switching (for retry logic)
-func (e *ErrorClassifier) ClassifyAndHandleError(resp *http.Response, accountID string) bool {
+func (e *ErrorClassifier) ClassifyAndHandleError(resp *http.Response, accountID, model string) bool {
 	if resp == nil {
 		// Network error - mark as temporary issue
 		log.Warn().Str("account_id", accountID).Msg("network error, marking account as temporarily unavailable")
@@ -46,6 +46,11 @@ func (e *ErrorClassifier) ClassifyAndHandleError(resp *http.Response, accountID
 		e.handleServiceUnavailable(accountID)
 		return true // Should switch to another account
 
+	case statusCode == StatusOverloaded: // 529 overloaded_error
+		// Only this model is overloaded, the account keeps serving others
+		recordModelOverload(e.store, resp, accountID, model)
+		return true // Should switch to another account
+
 	case statusCode >= 500: // 500, 502, 504, etc
 		e.handleServerError(statusCode, accountID)
 		return false // Don't switch, just retry (server issue, not account issue)
@@ -0,0 +1,51 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+
+	"ccproxy/internal/flags"
+	"ccproxy/internal/metrics"
+	"ccproxy/internal/middleware"
+)
+
+// FeatureFlagsMiddleware resolves the feature flags of each request and
+// attaches them to the request context. Tokens allowed to override flags may
+// switch them with X-CCProxy-Flags and get the resolved flags echoed back in
+// the same header; other tokens' headers are ignored. Every request is counted
+// per flag state so the variants can be compared in metrics.
+func FeatureFlagsMiddleware(evaluator *flags.Evaluator, m *metrics.Metrics) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var overrides map[string]bool
+		allowed := middleware.AllowFlagOverrides(c)
+		if header := c.GetHeader(flags.Header); header != "" {
+			if !allowed {
+				log.Debug().Str("token_id", c.GetString(middleware.ContextKeyTokenID)).Msg("ignoring feature flag overrides from token without permission")
+			} else {
+				var err error
+				if overrides, err = flags.ParseOverrides(header); err != nil {
+					c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid " + flags.Header + " header: " + err.Error()})
+					return
+				}
+			}
+		}
+
+		set := evaluator.Resolve(c.GetString(middleware.ContextKeyTokenID), overrides)
+		c.Request = c.Request.WithContext(flags.WithSet(c.Request.Context(), set))
+		if allowed {
+			c.Header(flags.Header, set.String())
+		}
+
+		start := time.Now()
+		c.Next()
+
+		duration := time.Since(start)
+		status := c.Writer.Status()
+		set.Each(func(name string, enabled bool) {
+			m.RecordFeatureFlag(name, enabled, status, duration)
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"ccproxy/internal/flags"
+	"ccproxy/internal/metrics"
+	"ccproxy/internal/middleware"
+)
+
+// serveWithFlags runs a request through the feature flags middleware for a
+// token and returns the response and the flags the handler saw
+func serveWithFlags(t *testing.T, m *metrics.Metrics, allowOverrides bool, header string) (*httptest.ResponseRecorder, *flags.Set) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	evaluator := flags.NewEvaluator(map[string]flags.Flag{
+		flags.ThinkingRetry: {Enabled: false, Percent: 100},
+	})
+
+	var seen *flags.Set
+	router := gin.New()
+	router.POST("/v1/messages", func(c *gin.Context) {
+		c.Set(middleware.ContextKeyTokenID, "token-1")
+		if allowOverrides {
+			c.Set(middleware.ContextKeyAllowFlagOverrides, true)
+		}
+	}, FeatureFlagsMiddleware(evaluator, m), func(c *gin.Context) {
+		seen = flags.FromContext(c.Request.Context())
+		c.JSON(http.StatusOK, gin.H{"ok": true})
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+	if header != "" {
+		req.Header.Set(flags.Header, header)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w, seen
+}
+
+func TestFeatureFlagsMiddleware_Overrides(t *testing.T) {
+	// Without permission the header is ignored and nothing is echoed
+	w, seen := serveWithFlags(t, nil, false, "thinking_retry=on")
+	if w.Code != http.StatusOK || seen == nil || seen.Enabled(flags.ThinkingRetry) {
+		t.Fatalf("override applied without permission: %d %s", w.Code, seen)
+	}
+	if w.Header().Get(flags.Header) != "" {
+		t.Error("flags echoed to a token without permission")
+	}
+
+	w, seen = serveWithFlags(t, nil, true, "thinking_retry=on,count_tokens_cache=off")
+	if w.Code != http.StatusOK || !seen.Enabled(flags.ThinkingRetry) || seen.Enabled(flags.CountTokensCache) {
+		t.Fatalf("override not applied: %d %s", w.Code, seen)
+	}
+	if got := w.Header().Get(flags.Header); got != "count_tokens_cache=off,strict_passthrough=off,thinking_retry=on" {
+		t.Errorf("echoed flags = %q", got)
+	}
+
+	w, _ = serveWithFlags(t, nil, true, "hedging")
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("unknown flag status = %d, want 400", w.Code)
+	}
+}
+
+func TestFeatureFlagsMiddleware_Metrics(t *testing.T) {
+	m := metrics.NewMetrics(metrics.MetricsConfig{Enabled: true})
+	serveWithFlags(t, m, false, "")
+	serveWithFlags(t, m, true, "thinking_retry")
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stats struct {
+		FeatureFlags map[string]struct {
+			Requests int64 `json:"requests"`
+			Errors   int64 `json:"errors"`
+		} `json:"feature_flags"`
+	}
+	if err := json.Unmarshal(data, &stats); err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]int64{
+		"thinking_retry:on":      1,
+		"thinking_retry:off":     1,
+		"count_tokens_cache:on":  2,
+		"count_tokens_cache:off": 0,
+	} {
+		if got := stats.FeatureFlags[key].Requests; got != want {
+			t.Errorf("%s requests = %d, want %d", key, got, want)
+		}
+	}
+}
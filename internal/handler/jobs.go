@@ -0,0 +1,81 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"ccproxy/internal/jobs"
+	"ccproxy/internal/store"
+)
+
+// JobsHandler lists, reports and cancels background jobs
+type JobsHandler struct {
+	queue *jobs.Queue
+}
+
+func NewJobsHandler(queue *jobs.Queue) *JobsHandler {
+	return &JobsHandler{queue: queue}
+}
+
+// ListJobsRequest filters the job list
+type ListJobsRequest struct {
+	Type   string `form:"type"`
+	Status string `form:"status"`
+	Limit  int    `form:"limit"`
+	Offset int    `form:"offset"`
+}
+
+// ListJobs lists jobs, newest first
+func (h *JobsHandler) ListJobs(c *gin.Context) {
+	var req ListJobsRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Limit <= 0 || req.Limit > 200 {
+		req.Limit = 50
+	}
+
+	list, total, err := h.queue.List(store.JobFilter{
+		Type:   req.Type,
+		Status: req.Status,
+		Limit:  req.Limit,
+		Offset: req.Offset,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list jobs"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"jobs": list, "total": total, "limit": req.Limit, "offset": req.Offset})
+}
+
+// GetJob returns a job with its progress and the state of each of its steps
+func (h *JobsHandler) GetJob(c *gin.Context) {
+	job, err := h.queue.Get(c.Param("id"))
+	if errors.Is(err, jobs.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get job"})
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+// CancelJob cancels a pending or running job
+func (h *JobsHandler) CancelJob(c *gin.Context) {
+	job, err := h.queue.Cancel(c.Param("id"))
+	switch {
+	case errors.Is(err, jobs.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
+	case errors.Is(err, jobs.ErrFinished):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to cancel job"})
+	default:
+		c.JSON(http.StatusOK, gin.H{"job": job, "message": "cancel requested"})
+	}
+}
@@ -0,0 +1,142 @@
+package handler
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+
+	"ccproxy/internal/store"
+	"ccproxy/pkg/jwt"
+)
+
+// minJWTKeySecret is the shortest secret accepted for a new signing key
+const minJWTKeySecret = 32
+
+// JWTKeyHandler manages the keys tokens are signed and validated with
+type JWTKeyHandler struct {
+	jwtManager *jwt.Manager
+	store      *store.Store
+}
+
+func NewJWTKeyHandler(jwtManager *jwt.Manager, store *store.Store) *JWTKeyHandler {
+	return &JWTKeyHandler{jwtManager: jwtManager, store: store}
+}
+
+// CreateJWTKeyRequest adds a key. Without a secret a random one is generated.
+type CreateJWTKeyRequest struct {
+	Secret   string `json:"secret"`
+	Activate bool   `json:"activate"`
+}
+
+// ListKeys returns all keys accepted for validation, without their secrets
+func (h *JWTKeyHandler) ListKeys(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"keys": h.jwtManager.Keys()})
+}
+
+// CreateKey adds a key, accepted for validation right away; with activate it
+// also signs new tokens from now on
+func (h *JWTKeyHandler) CreateKey(c *gin.Context) {
+	var req CreateJWTKeyRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if req.Secret == "" {
+		buf := make([]byte, 32)
+		if _, err := rand.Read(buf); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate secret"})
+			return
+		}
+		req.Secret = base64.RawURLEncoding.EncodeToString(buf)
+	} else if len(req.Secret) < minJWTKeySecret {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "secret must be at least 32 characters"})
+		return
+	}
+
+	key := &store.JWTKey{
+		ID:        "jwk_" + uuid.New().String()[:8],
+		Secret:    req.Secret,
+		CreatedAt: time.Now(),
+	}
+	if err := h.store.CreateJWTKey(key); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to store key"})
+		return
+	}
+	if err := h.jwtManager.AddKey(key.ID, key.Secret, key.CreatedAt); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	log.Info().Str("kid", key.ID).Msg("added JWT signing key")
+
+	if req.Activate && !h.activate(c, key.ID) {
+		return
+	}
+	info, _ := h.jwtManager.Key(key.ID)
+	c.JSON(http.StatusCreated, info)
+}
+
+// ActivateKey makes a key sign new tokens. Activating a configured key
+// switches back to the config file's secret.
+func (h *JWTKeyHandler) ActivateKey(c *gin.Context) {
+	id := c.Param("id")
+	if _, ok := h.jwtManager.Key(id); !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "key not found"})
+		return
+	}
+	if !h.activate(c, id) {
+		return
+	}
+	info, _ := h.jwtManager.Key(id)
+	c.JSON(http.StatusOK, info)
+}
+
+func (h *JWTKeyHandler) activate(c *gin.Context, id string) bool {
+	if err := h.store.SetActiveJWTKey(id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to activate key"})
+		return false
+	}
+	if err := h.jwtManager.Activate(id); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return false
+	}
+	log.Info().Str("kid", id).Msg("activated JWT signing key")
+	return true
+}
+
+// RetireKey removes a key; tokens signed with it stop validating. The active
+// key and keys from the config file cannot be retired here.
+func (h *JWTKeyHandler) RetireKey(c *gin.Context) {
+	id := c.Param("id")
+	info, ok := h.jwtManager.Key(id)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "key not found"})
+		return
+	}
+	if info.Configured {
+		c.JSON(http.StatusConflict, gin.H{"error": "key is configured; remove it from jwt.secret or jwt.verification_secrets"})
+		return
+	}
+	if info.Active {
+		c.JSON(http.StatusConflict, gin.H{"error": jwt.ErrKeyActive.Error()})
+		return
+	}
+
+	if err := h.store.DeleteJWTKey(id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete key"})
+		return
+	}
+	if err := h.jwtManager.Retire(id); err != nil && !errors.Is(err, jwt.ErrKeyNotFound) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	log.Info().Str("kid", id).Msg("retired JWT signing key")
+	c.JSON(http.StatusOK, gin.H{"message": "key retired"})
+}
@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"ccproxy/internal/store"
+	"ccproxy/pkg/jwt"
+)
+
+func TestJWTKeyHandler_Rotation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, err := store.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	const configured = "test-secret-test-secret-test-secret"
+	manager := jwt.NewManager(configured, "ccproxy")
+	keys := NewJWTKeyHandler(manager, db)
+	router := gin.New()
+	router.GET("/jwt/keys", keys.ListKeys)
+	router.POST("/jwt/keys", keys.CreateKey)
+	router.POST("/jwt/keys/:id/activate", keys.ActivateKey)
+	router.DELETE("/jwt/keys/:id", keys.RetireKey)
+
+	oldToken, _, err := manager.Generate("alice", "both", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if code, _ := doJSON(t, router, http.MethodPost, "/jwt/keys", `{"secret":"short"}`); code != http.StatusBadRequest {
+		t.Errorf("short secret: got %d", code)
+	}
+	code, created := doJSON(t, router, http.MethodPost, "/jwt/keys", `{"activate":true}`)
+	if code != http.StatusCreated || created["active"] != true {
+		t.Fatalf("create: %d %v", code, created)
+	}
+	kid := created["id"].(string)
+
+	// New tokens are signed with the new key; old tokens still validate
+	newToken, _, err := manager.Generate("bob", "both", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, token := range []string{oldToken, newToken} {
+		if _, err := manager.Validate(token); err != nil {
+			t.Errorf("token rejected after rotation: %v", err)
+		}
+	}
+
+	// The active key and the configured secret cannot be retired
+	if code, _ := doJSON(t, router, http.MethodDelete, "/jwt/keys/"+kid, ""); code != http.StatusConflict {
+		t.Errorf("retire active key: got %d", code)
+	}
+	cfgKID := jwt.ConfiguredKeyID(configured)
+	if code, _ := doJSON(t, router, http.MethodDelete, "/jwt/keys/"+cfgKID, ""); code != http.StatusConflict {
+		t.Errorf("retire configured key: got %d", code)
+	}
+
+	// The stored keys survive a restart
+	stored, err := db.ListJWTKeys()
+	if err != nil || len(stored) != 1 || stored[0].ID != kid || !stored[0].Active {
+		t.Fatalf("stored keys = %+v, %v", stored, err)
+	}
+
+	// Switching back to the configured secret lets the key be retired
+	if code, resp := doJSON(t, router, http.MethodPost, "/jwt/keys/"+cfgKID+"/activate", ""); code != http.StatusOK {
+		t.Fatalf("activate configured key: %d %v", code, resp)
+	}
+	if code, _ := doJSON(t, router, http.MethodDelete, "/jwt/keys/"+kid, ""); code != http.StatusOK {
+		t.Fatalf("retire: got %d", code)
+	}
+	if _, err := manager.Validate(newToken); err != jwt.ErrInvalidToken {
+		t.Errorf("token of retired key: err = %v", err)
+	}
+	if _, err := manager.Validate(oldToken); err != nil {
+		t.Errorf("configured key token: %v", err)
+	}
+	if code, _ := doJSON(t, router, http.MethodDelete, "/jwt/keys/"+kid, ""); code != http.StatusNotFound {
+		t.Errorf("retire twice: got %d", code)
+	}
+
+	_, list := doJSON(t, router, http.MethodGet, "/jwt/keys", "")
+	if listed, _ := list["keys"].([]interface{}); len(listed) != 1 {
+		t.Errorf("keys = %v", list)
+	}
+}
@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+
+	"ccproxy/internal/metrics"
+	"ccproxy/internal/middleware"
+	"ccproxy/internal/shedding"
+)
+
+// LoadSheddingMiddleware rejects requests the controller does not admit at
+// the token's priority with 503 and a Retry-After hint, before any upstream
+// work is started. It must run after JWT authentication.
+func LoadSheddingMiddleware(controller *shedding.Controller, m *metrics.Metrics) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		priority := c.GetString(middleware.ContextKeyPriority)
+		ok, reason := controller.Admit(priority)
+		if ok {
+			c.Next()
+			return
+		}
+
+		if priority == "" {
+			priority = shedding.PriorityNormal
+		}
+		m.RecordLoadShed(priority, reason)
+		log.Debug().
+			Str("token_id", c.GetString(middleware.ContextKeyTokenID)).
+			Str("priority", priority).
+			Str("reason", reason).
+			Msg("shed request under load")
+
+		retryAfter := int(controller.RetryAfter().Seconds())
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+			"type": "error",
+			"error": gin.H{
+				"type":    "overloaded_error",
+				"message": "ccproxy is under " + reason + " pressure, retry later",
+			},
+		})
+	}
+}
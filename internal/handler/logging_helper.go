@@ -3,8 +3,12 @@ package handler
 import (
 	"database/sql"
 	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
 	"time"
 
+	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/rs/zerolog/log"
 
@@ -34,6 +38,58 @@ type RequestLogContext struct {
 	StatusCode            int
 	ErrorMessage          string
 	ConversationID        string
+	ClientIP              string
+	UserAgent             string
+	UpstreamRequestID     string
+	TraceID               string
+	EndUserID             string
+	RequestBytes          int64 // Size of the request payload
+	ModelDefaulted        bool  // Model was filled in from a default
+	Truncated             bool  // Stream was interrupted; Completion is partial
+	queueWait             *queueWait // Slot waits of the request, nil when not tracked
+	responseBody          *countingBody // Upstream response body, nil when not tracked
+}
+
+// markTruncated records that the response stream was interrupted, so the
+// completion received so far is logged as partial
+func (l *RequestLogContext) markTruncated(reason string) {
+	l.Truncated = true
+	l.ErrorMessage = "stream interrupted: " + reason
+}
+
+// streamInterruption explains why a stream ended before it completed, given
+// the error reading it, if any
+func streamInterruption(c *gin.Context, err error) string {
+	if c.Request.Context().Err() != nil {
+		return "client disconnected"
+	}
+	if err != nil {
+		return err.Error()
+	}
+	return "upstream ended the stream early"
+}
+
+// countingBody counts the bytes read from a response body
+type countingBody struct {
+	io.ReadCloser
+	n int64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	return n, err
+}
+
+// trackResponseBytes records the size of resp's body in the log context as
+// the handler reads it. The body must be read before the request is logged.
+func trackResponseBytes(resp *http.Response, logCtx *RequestLogContext) {
+	if logCtx == nil || resp == nil || resp.Body == nil {
+		return
+	}
+	body := &countingBody{ReadCloser: resp.Body}
+	resp.Body = body
+	logCtx.responseBody = body
 }
 
 // extractSystemPrompt extracts system prompt from messages
@@ -60,6 +116,34 @@ func extractPrompt(messages []OpenAIMessage) string {
 	return ""
 }
 
+// conversationTitleLength is the maximum length of a conversation title in runes
+const conversationTitleLength = 80
+
+// extractConversationTitle builds a conversation title from the first user
+// message, falling back to prompt. Whitespace is collapsed and long titles are
+// cut at a word boundary.
+func extractConversationTitle(messages []OpenAIMessage, prompt string) string {
+	text := prompt
+	for _, msg := range messages {
+		if msg.Role == "user" {
+			if t := extractTextFromContent(msg.Content); strings.TrimSpace(t) != "" {
+				text = t
+				break
+			}
+		}
+	}
+
+	title := []rune(strings.Join(strings.Fields(text), " "))
+	if len(title) <= conversationTitleLength {
+		return string(title)
+	}
+	title = title[:conversationTitleLength]
+	if i := strings.LastIndex(string(title), " "); i > conversationTitleLength/2 {
+		return string(title)[:i] + "…"
+	}
+	return string(title) + "…"
+}
+
 // buildLogEntry builds a log entry from the request context
 func buildLogEntry(logCtx *RequestLogContext) *service.LogEntry {
 	if logCtx == nil {
@@ -96,8 +180,9 @@ func buildLogEntry(logCtx *RequestLogContext) *service.LogEntry {
 	entry.Log.CompletionTokens = logCtx.CompletionTokens
 	entry.Log.TotalTokens = logCtx.TotalTokens
 
-	// Set success status
-	entry.Log.Success = logCtx.StatusCode >= 200 && logCtx.StatusCode < 400
+	// Set success status; an interrupted stream did not deliver the response
+	entry.Log.Success = logCtx.StatusCode >= 200 && logCtx.StatusCode < 400 && !logCtx.Truncated
+	entry.Log.Truncated = logCtx.Truncated
 
 	// Set error message if present
 	if logCtx.ErrorMessage != "" {
@@ -109,8 +194,45 @@ func buildLogEntry(logCtx *RequestLogContext) *service.LogEntry {
 		entry.Log.ConversationID = sql.NullString{String: logCtx.ConversationID, Valid: true}
 	}
 
-	// Build conversation content if enabled
-	if logCtx.EnableConvLogging && logCtx.Prompt != "" && logCtx.Completion != "" {
+	entry.Log.ModelDefaulted = logCtx.ModelDefaulted
+
+	// Set end user for per-end-user attribution
+	if logCtx.EndUserID != "" {
+		entry.Log.EndUserID = sql.NullString{String: logCtx.EndUserID, Valid: true}
+	}
+
+	// Set slot wait time for capacity planning
+	if logCtx.queueWait != nil {
+		entry.Log.QueueWaitMs = sql.NullInt64{Int64: logCtx.queueWait.total().Milliseconds(), Valid: true}
+	}
+
+	// Set payload sizes for size distributions
+	if logCtx.RequestBytes > 0 {
+		entry.Log.RequestBytes = sql.NullInt64{Int64: logCtx.RequestBytes, Valid: true}
+	}
+	if logCtx.responseBody != nil {
+		entry.Log.ResponseBytes = sql.NullInt64{Int64: logCtx.responseBody.n, Valid: true}
+	}
+
+	// Set client info for enrichers
+	if logCtx.ClientIP != "" {
+		entry.Log.ClientIP = sql.NullString{String: logCtx.ClientIP, Valid: true}
+	}
+	if logCtx.UserAgent != "" {
+		entry.Log.UserAgent = sql.NullString{String: logCtx.UserAgent, Valid: true}
+	}
+
+	// Set upstream tracing info
+	if logCtx.UpstreamRequestID != "" {
+		entry.Log.UpstreamRequestID = sql.NullString{String: logCtx.UpstreamRequestID, Valid: true}
+	}
+	if logCtx.TraceID != "" {
+		entry.Log.TraceID = sql.NullString{String: logCtx.TraceID, Valid: true}
+	}
+
+	// Build conversation content if enabled, keeping what an interrupted
+	// stream delivered
+	if logCtx.EnableConvLogging && logCtx.Prompt != "" && (logCtx.Completion != "" || logCtx.Truncated) {
 		messagesJSON, err := json.Marshal(logCtx.Messages)
 		if err != nil {
 			log.Error().Err(err).Msg("Failed to marshal messages for conversation logging")
@@ -124,6 +246,8 @@ func buildLogEntry(logCtx *RequestLogContext) *service.LogEntry {
 				MessagesJSON: string(messagesJSON),
 				CreatedAt:    logCtx.RequestAt,
 				IsCompressed: false,
+				Title:        extractConversationTitle(logCtx.Messages, logCtx.Prompt),
+				Truncated:    logCtx.Truncated,
 			}
 
 			if logCtx.SystemPrompt != "" {
@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestBuildLogEntry_Truncated(t *testing.T) {
+	tests := []struct {
+		name        string
+		completion  string
+		truncated   bool
+		wantConv    bool
+		wantSuccess bool
+	}{
+		{"complete", "Hello there", false, true, true},
+		{"partial", "Hel", true, true, false},
+		{"interrupted before any text", "", true, true, false},
+		{"empty and complete", "", false, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logCtx := createRequestLogContext("tok-1", "", "", "api", "claude-sonnet-4", true, true,
+				[]OpenAIMessage{{Role: "user", Content: "Say hello"}})
+			logCtx.StatusCode = http.StatusOK
+			logCtx.Completion = tt.completion
+			if tt.truncated {
+				logCtx.markTruncated("unexpected EOF")
+			}
+
+			entry := buildLogEntry(logCtx)
+			if entry.Log.Truncated != tt.truncated || entry.Log.Success != tt.wantSuccess {
+				t.Errorf("log truncated %v success %v", entry.Log.Truncated, entry.Log.Success)
+			}
+			if tt.truncated && entry.Log.ErrorMessage.String != "stream interrupted: unexpected EOF" {
+				t.Errorf("error message = %q", entry.Log.ErrorMessage.String)
+			}
+			if (entry.Conversation != nil) != tt.wantConv {
+				t.Fatalf("conversation = %+v, want %v", entry.Conversation, tt.wantConv)
+			}
+			if entry.Conversation != nil && (entry.Conversation.Truncated != tt.truncated || entry.Conversation.Completion != tt.completion) {
+				t.Errorf("conversation truncated %v completion %q", entry.Conversation.Truncated, entry.Conversation.Completion)
+			}
+		})
+	}
+}
+
+func TestStreamInterruption(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		err  error
+		want string
+	}{
+		{"read error", context.Background(), errors.New("unexpected EOF"), "unexpected EOF"},
+		{"ended early", context.Background(), nil, "upstream ended the stream early"},
+		{"client gone", canceled, context.Canceled, "client disconnected"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil).WithContext(tt.ctx)
+			if got := streamInterruption(c, tt.err); got != tt.want {
+				t.Errorf("streamInterruption = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
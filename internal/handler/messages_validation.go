@@ -0,0 +1,146 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxTokensLimit is the largest max_tokens any Claude model accepts
+const maxTokensLimit = 128000
+
+// contentBlockRoles lists the content block types accepted in /v1/messages
+// requests and the message roles that may carry them
+var contentBlockRoles = map[string]map[string]bool{
+	"text":                   {"user": true, "assistant": true},
+	"image":                  {"user": true},
+	"document":               {"user": true},
+	"search_result":          {"user": true},
+	"tool_result":            {"user": true},
+	"tool_use":               {"assistant": true},
+	"server_tool_use":        {"assistant": true},
+	"web_search_tool_result": {"assistant": true},
+	"thinking":               {"assistant": true},
+	"redacted_thinking":      {"assistant": true},
+}
+
+// validateMessagesRequest checks a /v1/messages request against the Anthropic
+// schema before an account is picked, so malformed bodies are rejected here
+// instead of spending upstream quota and retries. Errors name the offending
+// field the way the Anthropic API does, e.g. "messages.2.role: ...".
+func validateMessagesRequest(req *AnthropicRequest) error {
+	if req.Model == "" {
+		return fmt.Errorf("model: field required")
+	}
+	if req.MaxTokens < 1 || req.MaxTokens > maxTokensLimit {
+		return fmt.Errorf("max_tokens: must be between 1 and %d, got %d", maxTokensLimit, req.MaxTokens)
+	}
+	if req.Temperature < 0 || req.Temperature > 1 {
+		return fmt.Errorf("temperature: must be between 0 and 1")
+	}
+	if req.TopP < 0 || req.TopP > 1 {
+		return fmt.Errorf("top_p: must be between 0 and 1")
+	}
+	if err := validateSystem(req.System); err != nil {
+		return err
+	}
+
+	if len(req.Messages) == 0 {
+		return fmt.Errorf("messages: at least one message is required")
+	}
+	for i, msg := range req.Messages {
+		field := fmt.Sprintf("messages.%d", i)
+		switch {
+		case msg.Role != "user" && msg.Role != "assistant":
+			return fmt.Errorf("%s.role: must be \"user\" or \"assistant\", got %q", field, msg.Role)
+		case i == 0 && msg.Role != "user":
+			return fmt.Errorf("%s.role: the first message must use the \"user\" role", field)
+		case i > 0 && msg.Role == req.Messages[i-1].Role:
+			return fmt.Errorf("%s.role: roles must alternate between \"user\" and \"assistant\"", field)
+		}
+		// Only a final assistant message (a prefill) may be empty
+		allowEmpty := i == len(req.Messages)-1 && msg.Role == "assistant"
+		if err := validateContent(field+".content", msg.Role, msg.Content, allowEmpty); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateSystem(system interface{}) error {
+	switch v := system.(type) {
+	case nil, string:
+		return nil
+	case []interface{}:
+		for i, block := range v {
+			b, ok := block.(map[string]interface{})
+			if !ok || b["type"] != "text" {
+				return fmt.Errorf("system.%d: system blocks must be text blocks", i)
+			}
+			if _, ok := b["text"].(string); !ok {
+				return fmt.Errorf("system.%d.text: field required", i)
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("system: must be a string or a list of text blocks")
+	}
+}
+
+func validateContent(field, role string, content interface{}, allowEmpty bool) error {
+	switch v := content.(type) {
+	case string:
+		if v == "" && !allowEmpty {
+			return fmt.Errorf("%s: must not be empty", field)
+		}
+		return nil
+	case []interface{}:
+		if len(v) == 0 && !allowEmpty {
+			return fmt.Errorf("%s: must not be empty", field)
+		}
+		for i, block := range v {
+			blockField := fmt.Sprintf("%s.%d", field, i)
+			b, ok := block.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("%s: content blocks must be objects", blockField)
+			}
+			blockType, _ := b["type"].(string)
+			roles, known := contentBlockRoles[blockType]
+			switch {
+			case blockType == "":
+				return fmt.Errorf("%s.type: field required", blockField)
+			case !known:
+				return fmt.Errorf("%s.type: unknown content block type %q", blockField, blockType)
+			case !roles[role]:
+				return fmt.Errorf("%s.type: %q blocks are not allowed in %s messages", blockField, blockType, role)
+			}
+			if blockType == "text" {
+				if _, ok := b["text"].(string); !ok {
+					return fmt.Errorf("%s.text: field required", blockField)
+				}
+			}
+			if blockType == "tool_result" {
+				if id, _ := b["tool_use_id"].(string); id == "" {
+					return fmt.Errorf("%s.tool_use_id: field required", blockField)
+				}
+			}
+		}
+		return nil
+	case nil:
+		return fmt.Errorf("%s: field required", field)
+	default:
+		return fmt.Errorf("%s: must be a string or a list of content blocks", field)
+	}
+}
+
+// invalidRequest writes an Anthropic-style invalid_request_error
+func invalidRequest(c *gin.Context, err error) {
+	c.JSON(http.StatusBadRequest, gin.H{
+		"type": "error",
+		"error": gin.H{
+			"type":    "invalid_request_error",
+			"message": err.Error(),
+		},
+	})
+}
@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestValidateMessagesRequest(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string // substring of the error, empty for valid requests
+	}{
+		{"valid string content", `{"model":"claude-sonnet-4","max_tokens":1024,"messages":[{"role":"user","content":"hi"}]}`, ""},
+		{"valid blocks and prefill", `{"model":"claude-sonnet-4","max_tokens":1024,"system":[{"type":"text","text":"be terse"}],"messages":[
+			{"role":"user","content":[{"type":"text","text":"hi"},{"type":"image","source":{}}]},
+			{"role":"assistant","content":[{"type":"tool_use","id":"tu_1","name":"x","input":{}}]},
+			{"role":"user","content":[{"type":"tool_result","tool_use_id":"tu_1","content":"ok"}]},
+			{"role":"assistant","content":""}]}`, ""},
+		{"missing model", `{"max_tokens":1024,"messages":[{"role":"user","content":"hi"}]}`, "model: field required"},
+		{"missing max_tokens", `{"model":"claude-sonnet-4","messages":[{"role":"user","content":"hi"}]}`, "max_tokens: must be between 1 and"},
+		{"max_tokens too large", `{"model":"claude-sonnet-4","max_tokens":1000000,"messages":[{"role":"user","content":"hi"}]}`, "max_tokens"},
+		{"temperature", `{"model":"claude-sonnet-4","max_tokens":1,"temperature":1.5,"messages":[{"role":"user","content":"hi"}]}`, "temperature"},
+		{"no messages", `{"model":"claude-sonnet-4","max_tokens":1,"messages":[]}`, "messages: at least one message"},
+		{"unknown role", `{"model":"claude-sonnet-4","max_tokens":1,"messages":[{"role":"system","content":"hi"}]}`, "messages.0.role"},
+		{"assistant first", `{"model":"claude-sonnet-4","max_tokens":1,"messages":[{"role":"assistant","content":"hi"}]}`, "messages.0.role: the first message"},
+		{"no alternation", `{"model":"claude-sonnet-4","max_tokens":1,"messages":[{"role":"user","content":"a"},{"role":"user","content":"b"}]}`, "messages.1.role: roles must alternate"},
+		{"empty user content", `{"model":"claude-sonnet-4","max_tokens":1,"messages":[{"role":"user","content":""}]}`, "messages.0.content: must not be empty"},
+		{"unknown block", `{"model":"claude-sonnet-4","max_tokens":1,"messages":[{"role":"user","content":[{"type":"video"}]}]}`, "messages.0.content.0.type: unknown content block type"},
+		{"block in wrong role", `{"model":"claude-sonnet-4","max_tokens":1,"messages":[{"role":"user","content":[{"type":"tool_use"}]}]}`, "not allowed in user messages"},
+		{"text block without text", `{"model":"claude-sonnet-4","max_tokens":1,"messages":[{"role":"user","content":[{"type":"text"}]}]}`, "messages.0.content.0.text: field required"},
+		{"tool_result without id", `{"model":"claude-sonnet-4","max_tokens":1,"messages":[{"role":"user","content":[{"type":"tool_result"}]}]}`, "tool_use_id: field required"},
+		{"system block type", `{"model":"claude-sonnet-4","max_tokens":1,"system":[{"type":"image"}],"messages":[{"role":"user","content":"hi"}]}`, "system.0"},
+	}
+	for _, tt := range tests {
+		var req AnthropicRequest
+		if err := json.Unmarshal([]byte(tt.body), &req); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		err := validateMessagesRequest(&req)
+		switch {
+		case tt.want == "" && err != nil:
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+		case tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)):
+			t.Errorf("%s: got %v, want error containing %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestMessages_RejectsInvalidRequest(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	// No scheduler, limiter or key pool: the request must be rejected before any of them
+	router.POST("/v1/messages", NewEnhancedProxyHandler(EnhancedProxyConfig{}).Messages)
+
+	code, resp := doJSON(t, router, http.MethodPost, "/v1/messages",
+		`{"model":"claude-sonnet-4","max_tokens":1024,"messages":[{"role":"user","content":"a"},{"role":"user","content":"b"}]}`)
+	if code != http.StatusBadRequest {
+		t.Fatalf("got %d %v", code, resp)
+	}
+	errBody, _ := resp["error"].(map[string]interface{})
+	if resp["type"] != "error" || errBody["type"] != "invalid_request_error" ||
+		!strings.HasPrefix(errBody["message"].(string), "messages.1.role") {
+		t.Errorf("unexpected error body: %v", resp)
+	}
+}
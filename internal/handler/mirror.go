@@ -0,0 +1,152 @@
+package handler
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"ccproxy/internal/middleware"
+	"ccproxy/internal/service"
+	"ccproxy/internal/store"
+)
+
+// mirrorCaptureWriter copies the primary response, up to limit bytes, while
+// it is written to the client
+type mirrorCaptureWriter struct {
+	gin.ResponseWriter
+	buf   bytes.Buffer
+	limit int
+}
+
+func (w *mirrorCaptureWriter) capture(p []byte) {
+	if remaining := w.limit - w.buf.Len(); remaining > 0 {
+		if len(p) > remaining {
+			p = p[:remaining+1] // one extra byte marks truncation
+		}
+		w.buf.Write(p)
+	}
+}
+
+func (w *mirrorCaptureWriter) Write(p []byte) (int, error) {
+	w.capture(p)
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *mirrorCaptureWriter) WriteString(s string) (int, error) {
+	w.capture([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+// MirrorMiddleware duplicates sampled requests to the mirror's secondary
+// upstream once the primary response is complete. The primary request is
+// never delayed by the mirrored call.
+func MirrorMiddleware(mirror *service.Mirror) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != http.MethodPost || !mirror.ShouldMirror() {
+			c.Next()
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.Next()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		writer := &mirrorCaptureWriter{ResponseWriter: c.Writer, limit: mirror.MaxBodyBytes()}
+		c.Writer = writer
+		start := time.Now()
+
+		c.Next()
+
+		tokenID, _ := c.Get(middleware.ContextKeyTokenID)
+		tokenIDStr, _ := tokenID.(string)
+		mirror.Submit(&service.MirrorJob{
+			Path:            c.Request.URL.Path,
+			TokenID:         tokenIDStr,
+			Body:            body,
+			PrimaryStatus:   writer.Status(),
+			PrimaryLatency:  time.Since(start),
+			PrimaryResponse: writer.buf.Bytes(),
+			CreatedAt:       start,
+		})
+	}
+}
+
+// MirrorHandler exposes stored mirror results for offline comparison
+type MirrorHandler struct {
+	store  *store.Store
+	mirror *service.Mirror
+}
+
+// NewMirrorHandler creates a mirror handler; mirror may be nil when disabled
+func NewMirrorHandler(store *store.Store, mirror *service.Mirror) *MirrorHandler {
+	return &MirrorHandler{
+		store:  store,
+		mirror: mirror,
+	}
+}
+
+// ListResults lists mirror results, newest first. Bodies are included with
+// ?bodies=true.
+func (h *MirrorHandler) ListResults(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	withBodies := c.Query("bodies") == "true"
+
+	results, err := h.store.ListMirrorResults(limit, offset, withBodies)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list mirror results"})
+		return
+	}
+	if results == nil {
+		results = []*store.MirrorResult{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"results": results,
+		"limit":   limit,
+		"offset":  offset,
+	})
+}
+
+// GetResult returns a single mirror result including bodies
+func (h *MirrorHandler) GetResult(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	result, err := h.store.GetMirrorResult(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get mirror result"})
+		return
+	}
+	if result == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "mirror result not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// GetStats returns mirroring counters
+func (h *MirrorHandler) GetStats(c *gin.Context) {
+	if h.mirror == nil {
+		c.JSON(http.StatusOK, service.MirrorStats{})
+		return
+	}
+	c.JSON(http.StatusOK, h.mirror.Stats())
+}
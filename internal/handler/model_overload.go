@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"ccproxy/internal/store"
+)
+
+const (
+	// StatusOverloaded is Anthropic's non-standard "overloaded_error" status code
+	StatusOverloaded = 529
+	// defaultModelOverloadCooldown applies when the upstream sends no Retry-After
+	defaultModelOverloadCooldown = 30 * time.Second
+)
+
+// recordModelOverload puts the (account, model) pair into cooldown so the
+// account keeps serving other models
+func recordModelOverload(st *store.Store, resp *http.Response, accountID, model string) {
+	cooldown := defaultModelOverloadCooldown
+	if resp != nil {
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+			cooldown = time.Duration(seconds) * time.Second
+		}
+	}
+	until := time.Now().Add(cooldown)
+
+	log.Warn().
+		Str("account_id", accountID).
+		Str("model", model).
+		Time("overload_until", until).
+		Msg("model overloaded on account, cooling down pair")
+
+	if err := st.SetAccountModelOverload(accountID, model, until, "overloaded_error"); err != nil {
+		log.Error().Err(err).Str("account_id", accountID).Str("model", model).Msg("failed to set model overload")
+	}
+}
+
+// filterModelOverloaded drops accounts cooling down for the model; on lookup
+// failure the input is returned unchanged
+func filterModelOverloaded(st *store.Store, accountIDs []string, model string) []string {
+	overloaded, err := st.GetModelOverloadedAccounts(model)
+	if err != nil {
+		log.Error().Err(err).Str("model", model).Msg("failed to load model overloads")
+		return accountIDs
+	}
+	if len(overloaded) == 0 {
+		return accountIDs
+	}
+
+	filtered := make([]string, 0, len(accountIDs))
+	for _, id := range accountIDs {
+		if _, ok := overloaded[id]; !ok {
+			filtered = append(filtered, id)
+		}
+	}
+	return filtered
+}
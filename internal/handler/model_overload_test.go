@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"ccproxy/internal/store"
+)
+
+func TestModelOverload_SkipsPairOnly(t *testing.T) {
+	db, err := store.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	accounts := []string{"acc-1", "acc-2"}
+	for _, id := range accounts {
+		if err := db.CreateAccount(&store.Account{
+			ID: id, Name: id, Type: store.AccountTypeSessionKey,
+			Credentials: store.Credentials{SessionKey: "sk-ant-sid01-" + id},
+			CreatedAt:   time.Now(), IsActive: true,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	resp := &http.Response{StatusCode: StatusOverloaded, Header: http.Header{"Retry-After": {"120"}}}
+	recordModelOverload(db, resp, "acc-1", "claude-opus-4")
+
+	if got := filterModelOverloaded(db, accounts, "claude-opus-4"); !reflect.DeepEqual(got, []string{"acc-2"}) {
+		t.Errorf("opus candidates = %v, want [acc-2]", got)
+	}
+	if got := filterModelOverloaded(db, accounts, "claude-haiku-4"); !reflect.DeepEqual(got, accounts) {
+		t.Errorf("haiku candidates = %v, want %v", got, accounts)
+	}
+
+	overloads, err := db.GetAccountModelOverloads("acc-1")
+	if err != nil || len(overloads) != 1 {
+		t.Fatalf("overloads = %v, %v", overloads, err)
+	}
+	if left := time.Until(overloads[0].OverloadUntil); left < 110*time.Second || left > 120*time.Second {
+		t.Errorf("cooldown left = %v, want Retry-After's 120s", left)
+	}
+}
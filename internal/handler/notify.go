@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"ccproxy/internal/notify"
+)
+
+// NotifyHandler lists notification channels and sends test notifications
+type NotifyHandler struct {
+	router *notify.Router
+}
+
+func NewNotifyHandler(router *notify.Router) *NotifyHandler {
+	return &NotifyHandler{router: router}
+}
+
+// notifyChannel describes a channel and its routing rules
+type notifyChannel struct {
+	Name        string   `json:"name"`
+	Type        string   `json:"type"`
+	Events      []string `json:"events"`
+	MinSeverity string   `json:"min_severity"`
+}
+
+// ListChannels lists the configured channels without their credentials
+func (h *NotifyHandler) ListChannels(c *gin.Context) {
+	channels := []notifyChannel{}
+	for _, route := range h.router.Routes() {
+		events := route.Events
+		if events == nil {
+			events = []string{}
+		}
+		minSeverity := string(route.MinSeverity)
+		if minSeverity == "" {
+			minSeverity = string(notify.SeverityInfo)
+		}
+		channels = append(channels, notifyChannel{
+			Name:        route.Name,
+			Type:        route.Type,
+			Events:      events,
+			MinSeverity: minSeverity,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"channels": channels})
+}
+
+// TestChannel sends a test event to a channel, ignoring its routing rules,
+// and reports whether it was delivered
+func (h *NotifyHandler) TestChannel(c *gin.Context) {
+	name := c.Param("name")
+	err := h.router.Test(c.Request.Context(), name)
+	if errors.Is(err, notify.ErrUnknownChannel) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "notification channel not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"channel": name, "sent": false, "error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"channel": name, "sent": true})
+}
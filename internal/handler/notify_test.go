@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"ccproxy/internal/notify"
+)
+
+func TestNotifyHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	hits := 0
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		if hits > 1 {
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	defer hook.Close()
+
+	h := NewNotifyHandler(notify.NewRouter([]notify.Route{{
+		Name:        "ops",
+		Type:        "slack",
+		Channel:     notify.NewSlackChannel(hook.URL),
+		Events:      []string{"account.*"},
+		MinSeverity: notify.SeverityWarning,
+	}}, time.Second))
+	router := gin.New()
+	router.GET("/notify/channels", h.ListChannels)
+	router.POST("/notify/channels/:name/test", h.TestChannel)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/notify/channels", nil))
+	var list struct {
+		Channels []map[string]interface{} `json:"channels"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &list)
+	if len(list.Channels) != 1 || list.Channels[0]["name"] != "ops" || list.Channels[0]["min_severity"] != "warning" {
+		t.Errorf("channels = %s", w.Body.String())
+	}
+	if _, ok := list.Channels[0]["url"]; ok {
+		t.Error("channel list exposes the webhook URL")
+	}
+
+	for _, tt := range []struct {
+		name     string
+		wantCode int
+	}{
+		{"ops", http.StatusOK},
+		{"ops", http.StatusBadGateway}, // The hook rejects the second message
+		{"missing", http.StatusNotFound},
+	} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/notify/channels/"+tt.name+"/test", nil))
+		if w.Code != tt.wantCode {
+			t.Errorf("test %s = %d, want %d: %s", tt.name, w.Code, tt.wantCode, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,495 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"ccproxy/internal/middleware"
+)
+
+// Output filters a token can enable to repair common artefacts in responses
+const (
+	OutputFilterCodeFences      = "code_fences"      // Close a code fence left open at the end of a response
+	OutputFilterSurrogates      = "surrogates"       // Rejoin surrogate pairs split across stream events
+	OutputFilterAssistantPrefix = "assistant_prefix" // Strip an "[Assistant:" label echoed at the start
+)
+
+// OutputFilters lists the output filters in the order they are applied
+var OutputFilters = []string{
+	OutputFilterSurrogates,
+	OutputFilterAssistantPrefix,
+	OutputFilterCodeFences,
+}
+
+// ParseOutputFilters splits a stored filter list
+func ParseOutputFilters(filters string) []string {
+	if filters == "" {
+		return nil
+	}
+	var parsed []string
+	for _, filter := range strings.Split(filters, ",") {
+		if filter = strings.TrimSpace(filter); filter != "" {
+			parsed = append(parsed, filter)
+		}
+	}
+	return parsed
+}
+
+// NormalizeOutputFilters validates a list of output filters and returns it
+// deduplicated, in order and comma-separated, as stored on tokens
+func NormalizeOutputFilters(filters []string) (string, error) {
+	enabled := make(map[string]bool, len(filters))
+	for _, filter := range filters {
+		filter = strings.ToLower(strings.TrimSpace(filter))
+		valid := false
+		for _, f := range OutputFilters {
+			valid = valid || f == filter
+		}
+		if !valid {
+			return "", fmt.Errorf("unknown output filter %q (valid: %s)", filter, strings.Join(OutputFilters, ", "))
+		}
+		enabled[filter] = true
+	}
+
+	var normalized []string
+	for _, filter := range OutputFilters {
+		if enabled[filter] {
+			normalized = append(normalized, filter)
+		}
+	}
+	return strings.Join(normalized, ","), nil
+}
+
+// assistantPrefixes are the role labels claude.ai sometimes echoes at the
+// start of a web mode completion
+var assistantPrefixes = []string{"[Assistant:", "Assistant:"}
+
+var (
+	// A text value ending in the high half of a surrogate pair, and one
+	// starting with the low half; the halves are JSON escapes
+	trailingHighSurrogate = regexp.MustCompile(`("(?:text|completion|content)"\s*:\s*"(?:[^"\\]|\\.)*?)(\\u[dD][89abAB][0-9a-fA-F]{2})"`)
+	leadingLowSurrogate   = regexp.MustCompile(`("(?:text|completion|content)"\s*:\s*")(\\u[dD][c-fC-F][0-9a-fA-F]{2})`)
+	textValueStart        = regexp.MustCompile(`"(?:text|completion|content)"\s*:\s*"`)
+)
+
+// filterWriter applies a token's output filters to successful responses.
+// Streams are rewritten event by event, text deltas in place; JSON bodies are
+// buffered and rewritten whole.
+type filterWriter struct {
+	gin.ResponseWriter
+	codeFences      bool
+	surrogates      bool
+	assistantPrefix bool
+
+	mode footerMode
+	buf  bytes.Buffer
+
+	// Stream state
+	nextIndex   int    // next free Anthropic content block index
+	surrogate   string // high surrogate escape held for the next text delta
+	prefixHead  string // text held while it may still be an assistant label
+	prefixIndex int    // Anthropic content block the held text belongs to
+	prefixLabel bool   // the label was stripped; leading spaces still are
+	prefixDone  bool
+	fenceOpen   bool
+	fenceLine   string // text after the last newline
+	closed      bool
+}
+
+// OutputFilterMiddleware applies the token's output_filters, when set, to
+// /v1/messages and /v1/chat/completions responses, except under strict
+// passthrough
+func OutputFilterMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filters := ParseOutputFilters(middleware.OutputFilters(c))
+		if len(filters) == 0 || strictPassthrough(c) {
+			c.Next()
+			return
+		}
+
+		writer := &filterWriter{ResponseWriter: c.Writer}
+		for _, filter := range filters {
+			switch filter {
+			case OutputFilterCodeFences:
+				writer.codeFences = true
+			case OutputFilterSurrogates:
+				writer.surrogates = true
+			case OutputFilterAssistantPrefix:
+				writer.assistantPrefix = true
+			}
+		}
+		writer.prefixDone = !writer.assistantPrefix
+		c.Writer = writer
+		c.Next()
+		writer.finish()
+	}
+}
+
+// decide picks how the response is handled on the first write, once the
+// status and content type are known
+func (w *filterWriter) decide() {
+	if w.mode != footerUndecided {
+		return
+	}
+	contentType := w.Header().Get("Content-Type")
+	switch {
+	case w.Status() != http.StatusOK:
+		w.mode = footerPassthrough
+	case strings.HasPrefix(contentType, "text/event-stream"):
+		w.mode = footerStream
+	case strings.HasPrefix(contentType, "application/json"):
+		w.mode = footerJSON
+	default:
+		w.mode = footerPassthrough
+	}
+	if w.mode != footerPassthrough {
+		// The body length changes, so an upstream Content-Length no longer applies
+		w.Header().Del("Content-Length")
+	}
+}
+
+func (w *filterWriter) Write(p []byte) (int, error) {
+	w.decide()
+	switch w.mode {
+	case footerJSON:
+		if w.buf.Len()+len(p) > maxUsageBufferBytes {
+			// Too large to rewrite; send it unchanged
+			w.mode = footerPassthrough
+			if _, err := w.ResponseWriter.Write(w.buf.Bytes()); err != nil {
+				return 0, err
+			}
+			w.buf.Reset()
+			return w.ResponseWriter.Write(p)
+		}
+		return w.buf.Write(p)
+
+	case footerStream:
+		w.buf.Write(p)
+		for {
+			end := bytes.Index(w.buf.Bytes(), []byte("\n\n"))
+			if end < 0 {
+				break
+			}
+			event := append([]byte(nil), w.buf.Next(end+2)...)
+			if _, err := w.ResponseWriter.Write(w.filterEvent(event)); err != nil {
+				return 0, err
+			}
+		}
+		return len(p), nil
+
+	default:
+		return w.ResponseWriter.Write(p)
+	}
+}
+
+func (w *filterWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *filterWriter) Flush() {
+	w.decide()
+	w.ResponseWriter.Flush()
+}
+
+// finish writes whatever is still buffered once the handler returns
+func (w *filterWriter) finish() {
+	if w.buf.Len() == 0 {
+		return
+	}
+	body := w.buf.Bytes()
+	if w.mode == footerJSON {
+		body = w.filterJSON(body)
+	}
+	w.ResponseWriter.Write(body)
+	w.buf.Reset()
+}
+
+// filterEvent returns a stream event with its text filtered, preceded by any
+// events the filters add
+func (w *filterWriter) filterEvent(event []byte) []byte {
+	if w.surrogates {
+		event = w.rejoinSurrogates(event)
+	}
+
+	var name string
+	var data []byte
+	for _, line := range bytes.Split(event, []byte("\n")) {
+		if value, ok := bytes.CutPrefix(line, []byte("event:")); ok {
+			name = string(bytes.TrimSpace(value))
+		} else if payload, ok := bytes.CutPrefix(line, []byte("data:")); ok {
+			data = bytes.TrimSpace(payload)
+		}
+	}
+	if len(data) == 0 {
+		return event
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var payload map[string]interface{}
+	if err := decoder.Decode(&payload); err != nil {
+		return event
+	}
+
+	var before []byte
+	changed := false
+	switch payload["type"] {
+	case "content_block_start":
+		if index, err := jsonInt(payload["index"]); err == nil && index >= w.nextIndex {
+			w.nextIndex = index + 1
+		}
+
+	case "content_block_delta":
+		delta, _ := payload["delta"].(map[string]interface{})
+		text, ok := delta["text"].(string)
+		if !ok {
+			break
+		}
+		if !w.prefixDone && w.prefixHead == "" {
+			w.prefixIndex, _ = jsonInt(payload["index"])
+		}
+		if filtered := w.filterText(text); filtered != text {
+			delta["text"] = filtered
+			changed = true
+		}
+
+	case "content_block_stop":
+		// A label-like start that never grew into the label is sent after all
+		if index, _ := jsonInt(payload["index"]); w.prefixHead != "" && index == w.prefixIndex {
+			if held := w.releasePrefix(); held != "" {
+				before = sseEvent("content_block_delta", map[string]interface{}{
+					"type":  "content_block_delta",
+					"index": index,
+					"delta": map[string]interface{}{"type": "text_delta", "text": held},
+				})
+			}
+		}
+
+	case "message_delta":
+		// Anthropic Messages stream
+		delta, _ := payload["delta"].(map[string]interface{})
+		if delta == nil || delta["stop_reason"] == nil {
+			break
+		}
+		if closing := w.closingText(delta["stop_reason"] != "tool_use"); closing != "" {
+			before = anthropicTextBlockEvents(w.nextIndex, closing)
+			w.nextIndex++
+		}
+
+	case "completion":
+		// claude.ai web stream
+		text, _ := payload["completion"].(string)
+		filtered := w.filterText(text)
+		if reason, _ := payload["stop_reason"].(string); reason != "" {
+			filtered += w.closingText(true)
+		}
+		if filtered != text {
+			payload["completion"] = filtered
+			changed = true
+		}
+
+	case nil:
+		// OpenAI chat.completion.chunk stream
+		choices, _ := payload["choices"].([]interface{})
+		if len(choices) == 0 {
+			break
+		}
+		choice, _ := choices[0].(map[string]interface{})
+		delta, _ := choice["delta"].(map[string]interface{})
+		if delta == nil {
+			break
+		}
+		text, hasText := delta["content"].(string)
+		filtered := w.filterText(text)
+		if reason, _ := choice["finish_reason"].(string); reason != "" {
+			filtered += w.closingText(reason != "tool_calls")
+		}
+		if filtered != text && (hasText || filtered != "") {
+			delta["content"] = filtered
+			changed = true
+		}
+	}
+
+	if changed {
+		event = sseEvent(name, payload)
+	}
+	return append(before, event...)
+}
+
+// rejoinSurrogates moves the high half of a surrogate pair that ends a text
+// delta to the start of the next one, where the low half is. Clients decode
+// each event on its own and would otherwise show two replacement characters.
+func (w *filterWriter) rejoinSurrogates(event []byte) []byte {
+	if !textValueStart.Match(event) {
+		return event
+	}
+	if w.surrogate != "" {
+		if loc := leadingLowSurrogate.FindSubmatchIndex(event); loc != nil {
+			event = append(event[:loc[3]:loc[3]], append([]byte(w.surrogate), event[loc[3]:]...)...)
+		}
+		// An unpaired high surrogate is dropped
+		w.surrogate = ""
+	}
+	if loc := trailingHighSurrogate.FindSubmatchIndex(event); loc != nil {
+		w.surrogate = string(event[loc[4]:loc[5]])
+		event = append(event[:loc[4]:loc[4]], event[loc[5]:]...)
+	}
+	return event
+}
+
+// filterText applies the text filters to the next piece of the response
+func (w *filterWriter) filterText(text string) string {
+	if !w.prefixDone {
+		text = w.stripAssistantPrefix(text)
+	}
+	w.trackFences(text)
+	return text
+}
+
+// stripAssistantPrefix drops an assistant label at the start of the
+// response. Text is held back while it may still turn out to be a label.
+func (w *filterWriter) stripAssistantPrefix(text string) string {
+	s := w.prefixHead + text
+	w.prefixHead = ""
+	trimmed := strings.TrimLeft(s, " \t\r\n")
+	if w.prefixLabel {
+		// Spaces after a stripped label may come in later deltas
+		if trimmed == "" {
+			return ""
+		}
+		w.prefixDone = true
+		return trimmed
+	}
+	for _, label := range assistantPrefixes {
+		if strings.HasPrefix(trimmed, label) {
+			w.prefixLabel = true
+			return w.stripAssistantPrefix(trimmed[len(label):])
+		}
+		if strings.HasPrefix(label, trimmed) {
+			w.prefixHead = s
+			return ""
+		}
+	}
+	w.prefixDone = true
+	return s
+}
+
+// releasePrefix ends the assistant label check, returning the text held for it
+func (w *filterWriter) releasePrefix() string {
+	held := ""
+	if !w.prefixLabel {
+		held = w.prefixHead
+	}
+	w.prefixHead = ""
+	w.prefixDone = true
+	w.trackFences(held)
+	return held
+}
+
+// trackFences follows whether the response is inside a fenced code block
+func (w *filterWriter) trackFences(text string) {
+	if !w.codeFences || text == "" {
+		return
+	}
+	lines := strings.Split(w.fenceLine+text, "\n")
+	for _, line := range lines[:len(lines)-1] {
+		if isCodeFence(line) {
+			w.fenceOpen = !w.fenceOpen
+		}
+	}
+	w.fenceLine = lines[len(lines)-1]
+}
+
+// closingText returns the text that ends the response: text held for the
+// assistant label check and, when closeFence is set, the fence closing an
+// open code block
+func (w *filterWriter) closingText(closeFence bool) string {
+	if w.closed {
+		return ""
+	}
+	w.closed = true
+	text := w.releasePrefix()
+	if !w.codeFences || !closeFence {
+		return text
+	}
+	open := w.fenceOpen
+	if isCodeFence(w.fenceLine) {
+		open = !open
+	}
+	if !open {
+		return text
+	}
+	if w.fenceLine != "" {
+		text += "\n"
+	}
+	return text + "```"
+}
+
+func isCodeFence(line string) bool {
+	return strings.HasPrefix(strings.TrimLeft(line, " "), "```")
+}
+
+// filterJSON filters the text of an Anthropic message or an OpenAI chat
+// completion. Other bodies are returned unchanged.
+func (w *filterWriter) filterJSON(body []byte) []byte {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var payload map[string]interface{}
+	if err := decoder.Decode(&payload); err != nil {
+		return body
+	}
+
+	switch {
+	case payload["type"] == "message":
+		content, _ := payload["content"].([]interface{})
+		var last map[string]interface{}
+		for _, item := range content {
+			block, _ := item.(map[string]interface{})
+			if text, ok := block["text"].(string); ok && block["type"] == "text" {
+				block["text"] = w.filterText(text)
+				last = block
+			}
+		}
+		if last == nil {
+			return body
+		}
+		last["text"] = last["text"].(string) + w.closingText(payload["stop_reason"] != "tool_use")
+
+	case payload["object"] == "chat.completion":
+		choices, _ := payload["choices"].([]interface{})
+		if len(choices) == 0 {
+			return body
+		}
+		choice, _ := choices[0].(map[string]interface{})
+		message, _ := choice["message"].(map[string]interface{})
+		text, ok := message["content"].(string)
+		if !ok {
+			return body
+		}
+		message["content"] = w.filterText(text) + w.closingText(choice["finish_reason"] != "tool_calls")
+
+	default:
+		return body
+	}
+
+	rewritten, err := json.Marshal(payload)
+	if err != nil {
+		return body
+	}
+	return rewritten
+}
+
+// jsonInt reads a JSON number decoded with UseNumber
+func jsonInt(v interface{}) (int, error) {
+	n, ok := v.(json.Number)
+	if !ok {
+		return 0, fmt.Errorf("not a number: %v", v)
+	}
+	i, err := n.Int64()
+	return int(i), err
+}
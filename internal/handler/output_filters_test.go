@@ -0,0 +1,214 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"ccproxy/internal/middleware"
+)
+
+// serveWithFilters runs handler behind the output filter middleware for a
+// token with filters
+func serveWithFilters(t *testing.T, filters string, handler gin.HandlerFunc) *httptest.ResponseRecorder {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/v1/messages", func(c *gin.Context) {
+		c.Set(middleware.ContextKeyOutputFilters, filters)
+	}, OutputFilterMiddleware(), handler)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/messages", nil))
+	return w
+}
+
+// streamText concatenates the text of Anthropic, claude.ai and OpenAI stream events
+func streamText(t *testing.T, body string) string {
+	t.Helper()
+	var text strings.Builder
+	for _, event := range strings.Split(body, "\n\n") {
+		for _, line := range strings.Split(event, "\n") {
+			data, ok := strings.CutPrefix(line, "data: ")
+			if !ok {
+				continue
+			}
+			var payload struct {
+				Delta struct {
+					Text string `json:"text"`
+				} `json:"delta"`
+				Completion string `json:"completion"`
+				Choices    []struct {
+					Delta struct {
+						Content string `json:"content"`
+					} `json:"delta"`
+				} `json:"choices"`
+			}
+			if err := json.Unmarshal([]byte(data), &payload); err != nil {
+				t.Fatalf("event %q: %v", data, err)
+			}
+			text.WriteString(payload.Delta.Text + payload.Completion)
+			for _, choice := range payload.Choices {
+				text.WriteString(choice.Delta.Content)
+			}
+		}
+	}
+	return text.String()
+}
+
+func sseStream(events ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Content-Type", "text/event-stream")
+		c.Status(http.StatusOK)
+		for _, event := range events {
+			c.Writer.Write([]byte(event + "\n\n"))
+		}
+	}
+}
+
+func TestNormalizeOutputFilters(t *testing.T) {
+	tests := []struct {
+		filters []string
+		want    string
+		wantErr bool
+	}{
+		{nil, "", false},
+		{[]string{"code_fences", " Surrogates", "code_fences"}, "surrogates,code_fences", false},
+		{[]string{"assistant_prefix"}, "assistant_prefix", false},
+		{[]string{"markdown"}, "", true},
+	}
+	for _, tt := range tests {
+		got, err := NormalizeOutputFilters(tt.filters)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("NormalizeOutputFilters(%v) = %q, %v; want %q", tt.filters, got, err, tt.want)
+		}
+	}
+}
+
+func TestOutputFilters_AnthropicStream(t *testing.T) {
+	w := serveWithFilters(t, "assistant_prefix,code_fences", sseStream(
+		"event: content_block_start\ndata: {\"type\":\"content_block_start\",\"index\":0,\"content_block\":{\"type\":\"text\",\"text\":\"\"}}",
+		"event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"text_delta\",\"text\":\"[Assis\"}}",
+		"event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"text_delta\",\"text\":\"tant: Sure:\\n```go\\nfmt\"}}",
+		"event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"text_delta\",\"text\":\".Println()\"}}",
+		"event: content_block_stop\ndata: {\"type\":\"content_block_stop\",\"index\":0}",
+		"event: message_delta\ndata: {\"type\":\"message_delta\",\"delta\":{\"stop_reason\":\"max_tokens\"},\"usage\":{\"output_tokens\":1234567}}",
+		"event: message_stop\ndata: {\"type\":\"message_stop\"}",
+	))
+
+	body := w.Body.String()
+	if got, want := streamText(t, body), "Sure:\n```go\nfmt.Println()\n```"; got != want {
+		t.Errorf("text = %q, want %q", got, want)
+	}
+	if !strings.Contains(body, `"index":1,"type":"content_block_start"`) || strings.Index(body, "\\n```\"") > strings.Index(body, "message_delta") {
+		t.Errorf("closing fence should be a new block before message_delta:\n%s", body)
+	}
+	if !strings.Contains(body, `"output_tokens":1234567`) {
+		t.Errorf("numbers should be kept as sent:\n%s", body)
+	}
+}
+
+func TestOutputFilters_TextStreams(t *testing.T) {
+	tests := []struct {
+		name    string
+		filters string
+		events  []string
+		want    string
+	}{
+		{
+			"web label-like start that is not a label",
+			"assistant_prefix",
+			[]string{
+				`data: {"type":"completion","completion":"Assis"}`,
+				`data: {"type":"completion","completion":"tance is here"}`,
+				`data: {"type":"completion","completion":"","stop_reason":"stop_sequence"}`,
+			},
+			"Assistance is here",
+		},
+		{
+			"web response shorter than the label",
+			"assistant_prefix",
+			[]string{
+				`data: {"type":"completion","completion":" Assist"}`,
+				`data: {"type":"completion","completion":"","stop_reason":"stop_sequence"}`,
+			},
+			" Assist",
+		},
+		{
+			"web label split from its space",
+			"assistant_prefix",
+			[]string{
+				`data: {"type":"completion","completion":"Assistant:"}`,
+				`data: {"type":"completion","completion":" Hi"}`,
+			},
+			"Hi",
+		},
+		{
+			"openai surrogate pair split across chunks",
+			"surrogates",
+			[]string{
+				`data: {"id":"c1","object":"chat.completion.chunk","choices":[{"index":0,"delta":{"content":"hi \ud83d"}}]}`,
+				`data: {"id":"c1","object":"chat.completion.chunk","choices":[{"index":0,"delta":{"content":"\ude00!"}}]}`,
+				`data: [DONE]`,
+			},
+			"hi \U0001F600!",
+		},
+		{
+			"openai balanced fences untouched",
+			"code_fences",
+			[]string{
+				`data: {"id":"c1","object":"chat.completion.chunk","choices":[{"index":0,"delta":{"content":"` + "```" + `\nx\n` + "```" + `"}}]}`,
+				`data: {"id":"c1","object":"chat.completion.chunk","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`,
+			},
+			"```\nx\n```",
+		},
+		{
+			"openai open fence closed in the finish chunk",
+			"code_fences",
+			[]string{
+				`data: {"id":"c1","object":"chat.completion.chunk","choices":[{"index":0,"delta":{"content":"` + "```" + `sh\nls\n"}}]}`,
+				`data: {"id":"c1","object":"chat.completion.chunk","choices":[{"index":0,"delta":{},"finish_reason":"length"}]}`,
+			},
+			"```sh\nls\n```",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events := tt.events
+			// [DONE] is not JSON; leave it out of the text
+			w := serveWithFilters(t, tt.filters, sseStream(events...))
+			body := strings.Replace(w.Body.String(), "data: [DONE]\n\n", "", 1)
+			if got := streamText(t, body); got != tt.want {
+				t.Errorf("text = %q, want %q\n%s", got, tt.want, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestOutputFilters_JSON(t *testing.T) {
+	w := serveWithFilters(t, "assistant_prefix,code_fences", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"object":  "chat.completion",
+			"choices": []gin.H{{"message": gin.H{"role": "assistant", "content": "[Assistant: ```\ncode"}, "finish_reason": "length"}},
+		})
+	})
+	var resp OpenAIChatResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if got := resp.Choices[0].Message.Content; got != "```\ncode\n```" {
+		t.Errorf("content = %q", got)
+	}
+
+	// Errors pass through untouched
+	w = serveWithFilters(t, "code_fences", func(c *gin.Context) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "```"})
+	})
+	if w.Body.String() != `{"error":"`+"```"+`"}` {
+		t.Errorf("error body = %s", w.Body.String())
+	}
+}
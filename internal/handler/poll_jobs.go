@@ -0,0 +1,295 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"ccproxy/internal/middleware"
+)
+
+const (
+	// pollJobTimeout bounds how long an upstream completion may run for a poll job
+	pollJobTimeout = 10 * time.Minute
+	// pollJobTTL is how long finished jobs are kept for clients to collect
+	pollJobTTL = 15 * time.Minute
+	// pollDefaultWait is the default long-poll wait when the client sends none
+	pollDefaultWait = 20 * time.Second
+	// pollMaxWait caps the long-poll wait to stay below common proxy timeouts
+	pollMaxWait = 60 * time.Second
+)
+
+// Poll job statuses
+const (
+	PollJobRunning   = "running"
+	PollJobCompleted = "completed"
+	PollJobFailed    = "failed"
+)
+
+// PollJob accumulates a completion for clients that cannot consume SSE
+type PollJob struct {
+	ID        string
+	TokenID   string
+	Model     string
+	CreatedAt time.Time
+
+	mu           sync.Mutex
+	content      strings.Builder
+	status       string
+	finishReason string
+	errMsg       string
+	finishedAt   time.Time
+	changed      chan struct{} // closed and replaced on every update
+}
+
+// PollJobSnapshot is the state returned to polling clients
+type PollJobSnapshot struct {
+	ID           string  `json:"id"`
+	Object       string  `json:"object"`
+	Created      int64   `json:"created"`
+	Model        string  `json:"model"`
+	Status       string  `json:"status"`
+	Content      string  `json:"content"`
+	Delta        string  `json:"delta"`
+	Cursor       int     `json:"cursor"`
+	FinishReason *string `json:"finish_reason"`
+	Error        string  `json:"error,omitempty"`
+}
+
+func newPollJob(tokenID, model string) *PollJob {
+	return &PollJob{
+		ID:        "pollcmpl-" + uuid.New().String(),
+		TokenID:   tokenID,
+		Model:     model,
+		CreatedAt: time.Now(),
+		status:    PollJobRunning,
+		changed:   make(chan struct{}),
+	}
+}
+
+// append adds completion text and wakes up waiters
+func (j *PollJob) append(text string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.content.WriteString(text)
+	j.notifyLocked()
+}
+
+// finish marks the job as done; an empty errMsg means success
+func (j *PollJob) finish(finishReason, errMsg string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.status != PollJobRunning {
+		return
+	}
+	if errMsg != "" {
+		j.status = PollJobFailed
+		j.errMsg = errMsg
+	} else {
+		j.status = PollJobCompleted
+		j.finishReason = finishReason
+	}
+	j.finishedAt = time.Now()
+	j.notifyLocked()
+}
+
+func (j *PollJob) notifyLocked() {
+	close(j.changed)
+	j.changed = make(chan struct{})
+}
+
+// Wait blocks until the job has content beyond cursor, finishes, or the timeout/done fires
+func (j *PollJob) Wait(cursor int, timeout time.Duration, done <-chan struct{}) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		j.mu.Lock()
+		if j.status != PollJobRunning || j.content.Len() > cursor {
+			j.mu.Unlock()
+			return
+		}
+		changed := j.changed
+		j.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-timer.C:
+			return
+		case <-done:
+			return
+		}
+	}
+}
+
+// Snapshot returns the job state, with Delta holding text after cursor
+func (j *PollJob) Snapshot(cursor int) *PollJobSnapshot {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	content := j.content.String()
+	if cursor < 0 || cursor > len(content) {
+		cursor = 0
+	}
+
+	snap := &PollJobSnapshot{
+		ID:      j.ID,
+		Object:  "chat.completion.poll",
+		Created: j.CreatedAt.Unix(),
+		Model:   j.Model,
+		Status:  j.status,
+		Content: content,
+		Delta:   content[cursor:],
+		Cursor:  len(content),
+		Error:   j.errMsg,
+	}
+	if j.status == PollJobCompleted {
+		reason := j.finishReason
+		snap.FinishReason = &reason
+	}
+	return snap
+}
+
+func (j *PollJob) expired(now time.Time) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.status == PollJobRunning {
+		return now.Sub(j.CreatedAt) > pollJobTimeout+pollJobTTL
+	}
+	return now.Sub(j.finishedAt) > pollJobTTL
+}
+
+// PollJobStore keeps poll jobs in memory until they expire
+type PollJobStore struct {
+	jobs map[string]*PollJob
+	mu   sync.RWMutex
+}
+
+// NewPollJobStore creates a job store and starts its cleanup loop
+func NewPollJobStore() *PollJobStore {
+	s := &PollJobStore{
+		jobs: make(map[string]*PollJob),
+	}
+	go s.cleanup()
+	return s
+}
+
+// Create registers a new running job
+func (s *PollJobStore) Create(tokenID, model string) *PollJob {
+	job := newPollJob(tokenID, model)
+	s.mu.Lock()
+	s.jobs[job.ID] = job
+	s.mu.Unlock()
+	return job
+}
+
+// Get returns a job by ID, or nil
+func (s *PollJobStore) Get(id string) *PollJob {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.jobs[id]
+}
+
+// cleanup periodically removes expired jobs
+func (s *PollJobStore) cleanup() {
+	ticker := time.NewTicker(1 * time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		now := time.Now()
+		s.mu.Lock()
+		for id, job := range s.jobs {
+			if job.expired(now) {
+				delete(s.jobs, id)
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+// pollJobRun carries a poll job's request past its handler: a context that is
+// not canceled when the client's request ends, and the cleanups to run once
+// the job's completion has been read
+type pollJobRun struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	cleanup []func()
+	started bool // A job reads the response and calls end
+}
+
+// newPollJobRun bounds the job by pollJobTimeout, or the token's request
+// budget when shorter
+func newPollJobRun(c *gin.Context) *pollJobRun {
+	timeout := pollJobTimeout
+	if budget := middleware.MaxRequestDuration(c); budget > 0 && budget < timeout {
+		timeout = budget
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(c.Request.Context()), timeout)
+	return &pollJobRun{ctx: ctx, cancel: cancel}
+}
+
+// onEnd registers a cleanup for the end of the job
+func (r *pollJobRun) onEnd(f func()) {
+	r.cleanup = append(r.cleanup, f)
+}
+
+// end cancels the job's context and runs its cleanups, newest first
+func (r *pollJobRun) end() {
+	r.cancel()
+	for i := len(r.cleanup) - 1; i >= 0; i-- {
+		r.cleanup[i]()
+	}
+}
+
+// abandon ends the run when the request returns without starting a job
+func (r *pollJobRun) abandon() {
+	if !r.started {
+		r.end()
+	}
+}
+
+// readWebCompletion reads a claude.ai completion SSE stream, calling onText for
+// every text delta, and returns the OpenAI-style finish reason
+func readWebCompletion(body io.Reader, onText func(string)) (string, error) {
+	scanner := bufio.NewScanner(body)
+	buf := make([]byte, 0, 64*1024)
+	scanner.Buffer(buf, 1024*1024)
+
+	finishReason := "stop"
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+
+		data := strings.TrimPrefix(line, "data: ")
+		if data == "[DONE]" {
+			break
+		}
+
+		var event map[string]interface{}
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			continue
+		}
+
+		if completion, ok := event["completion"].(string); ok && completion != "" {
+			onText(completion)
+		}
+
+		if reason, ok := event["stop_reason"].(string); ok && reason != "" {
+			if reason == "max_tokens" {
+				finishReason = "length"
+			}
+			break
+		}
+	}
+
+	return finishReason, scanner.Err()
+}
@@ -0,0 +1,138 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadWebCompletion(t *testing.T) {
+	stream := strings.Join([]string{
+		`event: completion`,
+		`data: {"completion":"Hello","stop_reason":null}`,
+		``,
+		`data: {"completion":", world","stop_reason":null}`,
+		``,
+		`data: {"completion":"","stop_reason":"max_tokens"}`,
+		``,
+	}, "\n")
+
+	var got strings.Builder
+	finishReason, err := readWebCompletion(strings.NewReader(stream), func(text string) {
+		got.WriteString(text)
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.String() != "Hello, world" {
+		t.Errorf("content = %q, want %q", got.String(), "Hello, world")
+	}
+	if finishReason != "length" {
+		t.Errorf("finish reason = %q, want %q", finishReason, "length")
+	}
+}
+
+func TestPollJobSnapshotCursor(t *testing.T) {
+	job := newPollJob("token1", "claude-sonnet-4")
+	job.append("Hello")
+	job.append(" there")
+
+	snap := job.Snapshot(5)
+	if snap.Delta != " there" {
+		t.Errorf("delta = %q, want %q", snap.Delta, " there")
+	}
+	if snap.Cursor != 11 {
+		t.Errorf("cursor = %d, want 11", snap.Cursor)
+	}
+	if snap.FinishReason != nil {
+		t.Error("running job should not have a finish reason")
+	}
+
+	job.finish("stop", "")
+	snap = job.Snapshot(snap.Cursor)
+	if snap.Status != PollJobCompleted || snap.Delta != "" {
+		t.Errorf("got status=%s delta=%q, want completed with empty delta", snap.Status, snap.Delta)
+	}
+	if snap.FinishReason == nil || *snap.FinishReason != "stop" {
+		t.Error("completed job should report finish reason stop")
+	}
+}
+
+func TestPollJobWaitWakesOnAppend(t *testing.T) {
+	job := newPollJob("token1", "claude-sonnet-4")
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		job.append("hi")
+	}()
+
+	start := time.Now()
+	job.Wait(0, 2*time.Second, nil)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Wait returned after %v, expected to wake on append", elapsed)
+	}
+	if snap := job.Snapshot(0); snap.Content != "hi" {
+		t.Errorf("content = %q, want %q", snap.Content, "hi")
+	}
+}
+
+func TestChatCompletionsWeb_PollJob(t *testing.T) {
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/completion") {
+			w.WriteHeader(http.StatusCreated)
+			io.WriteString(w, `{"uuid":"conv"}`)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "data: {\"completion\":\"Hello\"}\n\n")
+		w.(http.Flusher).Flush()
+		// The job keeps reading after the creating request has returned
+		<-release
+		io.WriteString(w, "data: {\"completion\":\", world\",\"stop_reason\":\"stop_sequence\"}\n\n")
+	}))
+	defer upstream.Close()
+	defer close(release)
+	router := newWebChatTestHandler(t, upstream.URL)
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions",
+		strings.NewReader(`{"model":"claude-sonnet-4","messages":[{"role":"user","content":"Hi"}],"poll":true}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("create: %d %s", w.Code, w.Body.String())
+	}
+	var created struct {
+		PollURL string `json:"poll_url"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &created)
+
+	poll := func(query string) PollJobSnapshot {
+		t.Helper()
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, created.PollURL+query, nil))
+		var snap PollJobSnapshot
+		if err := json.Unmarshal(w.Body.Bytes(), &snap); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("poll: %d %s", w.Code, w.Body.String())
+		}
+		return snap
+	}
+
+	snap := poll("?wait=5s")
+	if snap.Status != PollJobRunning || snap.Content != "Hello" {
+		t.Fatalf("first poll = %+v", snap)
+	}
+	release <- struct{}{}
+	for snap.Status == PollJobRunning {
+		snap = poll("?wait=5s&cursor=" + strconv.Itoa(snap.Cursor))
+	}
+	if snap.Status != PollJobCompleted || snap.Content != "Hello, world" {
+		t.Errorf("final poll = %+v", snap)
+	}
+}
@@ -0,0 +1,29 @@
+package handler
+
+import (
+	"net/http/pprof"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PprofHandler serves the net/http/pprof profiles, e.g. at
+// /api/debug/pprof/heap or /api/debug/pprof/profile?seconds=30
+func PprofHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch name := strings.Trim(c.Param("name"), "/"); name {
+		case "":
+			pprof.Index(c.Writer, c.Request)
+		case "cmdline":
+			pprof.Cmdline(c.Writer, c.Request)
+		case "profile":
+			pprof.Profile(c.Writer, c.Request)
+		case "symbol":
+			pprof.Symbol(c.Writer, c.Request)
+		case "trace":
+			pprof.Trace(c.Writer, c.Request)
+		default:
+			pprof.Handler(name).ServeHTTP(c.Writer, c.Request)
+		}
+	}
+}
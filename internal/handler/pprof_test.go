@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"ccproxy/internal/middleware"
+	"ccproxy/internal/store"
+	"ccproxy/internal/store/storetest"
+	"ccproxy/pkg/jwt"
+)
+
+func TestPprofHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	manager := jwt.NewManager("test-secret-test-secret-test-secret", "ccproxy")
+	admin := middleware.NewAdminMiddleware("admin-key-admin-key")
+	sessions := storetest.NewMemoryStore()
+	admin.EnableSessions(manager, sessions)
+	viewer, claims, err := manager.GenerateAdminSession("user-1", "Alice", "alice@example.com", middleware.AdminRoleViewer, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessions.CreateAdminSession(&store.AdminSession{ID: claims.ID, Subject: "user-1", CreatedAt: claims.IssuedAt.Time, ExpiresAt: claims.ExpiresAt.Time})
+
+	router := gin.New()
+	router.GET("/api/debug/pprof/*name", admin.Auth(), middleware.RequireAdminRole(), PprofHandler())
+
+	tests := []struct {
+		name     string
+		path     string
+		auth     func(*http.Request)
+		wantCode int
+		wantBody string
+	}{
+		{"index", "/api/debug/pprof/", adminKey, http.StatusOK, "goroutine"},
+		{"named profile", "/api/debug/pprof/goroutine?debug=1", adminKey, http.StatusOK, "goroutine profile"},
+		{"cmdline", "/api/debug/pprof/cmdline", adminKey, http.StatusOK, ""},
+		{"unknown profile", "/api/debug/pprof/nope", adminKey, http.StatusNotFound, ""},
+		{"viewer rejected", "/api/debug/pprof/heap", func(r *http.Request) {
+			r.AddCookie(&http.Cookie{Name: middleware.AdminSessionCookie, Value: viewer})
+		}, http.StatusForbidden, ""},
+		{"anonymous rejected", "/api/debug/pprof/heap", func(r *http.Request) {}, http.StatusUnauthorized, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			tt.auth(req)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantCode, w.Body.String())
+			}
+			if !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Errorf("body does not contain %q: %.200s", tt.wantBody, w.Body.String())
+			}
+		})
+	}
+}
+
+func adminKey(r *http.Request) {
+	r.Header.Set("X-Admin-Key", "admin-key-admin-key")
+}
@@ -0,0 +1,60 @@
+package handler
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// trailingPrefill is the text of a conversation's final assistant message,
+// which Anthropic continues rather than answers. Trailing whitespace is
+// dropped as the Messages API rejects it. "" when the last message is not a
+// non-empty assistant message.
+func trailingPrefill(messages []OpenAIMessage) string {
+	if len(messages) == 0 || messages[len(messages)-1].Role != "assistant" {
+		return ""
+	}
+	return strings.TrimRightFunc(extractTextFromContent(messages[len(messages)-1].Content), unicode.IsSpace)
+}
+
+// prefillInstruction asks claude.ai, which has no prefill, to continue the
+// prefilled text instead of answering it
+func prefillInstruction(prefill string) string {
+	return fmt.Sprintf("[Continue your reply from exactly where the following text ends. Output only the continuation, without repeating any of it:]\n%s", prefill)
+}
+
+// prefillEcho strips a repeat of the prefill from the start of a web
+// completion, so clients only receive the continuation as they would from
+// the Messages API. Text is held back while it could still be an echo.
+type prefillEcho struct {
+	prefill string
+	pending strings.Builder
+	done    bool
+}
+
+func newPrefillEcho(prefill string) *prefillEcho {
+	return &prefillEcho{prefill: prefill, done: prefill == ""}
+}
+
+// Write takes the next completion text and returns what can be sent
+func (e *prefillEcho) Write(text string) string {
+	if e.done {
+		return text
+	}
+	e.pending.WriteString(text)
+	got := e.pending.String()
+	if strings.HasPrefix(e.prefill, got) && got != e.prefill {
+		return ""
+	}
+	e.done = true
+	return strings.TrimPrefix(got, e.prefill)
+}
+
+// Flush returns text still held back at the end of the completion
+func (e *prefillEcho) Flush() string {
+	if e.done {
+		return ""
+	}
+	e.done = true
+	return e.pending.String()
+}
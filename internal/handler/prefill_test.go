@@ -0,0 +1,99 @@
+package handler
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestConvertToAnthropicPrefill(t *testing.T) {
+	h := &EnhancedProxyHandler{}
+	tests := []struct {
+		name      string
+		messages  []OpenAIMessage
+		wantRoles string
+		wantLast  interface{}
+	}{
+		{
+			"trailing assistant kept as prefill",
+			[]OpenAIMessage{{Role: "system", Content: "Be terse"}, {Role: "user", Content: "List primes"}, {Role: "assistant", Content: "2, 3, \n"}},
+			"user,assistant",
+			"2, 3,",
+		},
+		{
+			"block content flattened",
+			[]OpenAIMessage{{Role: "user", Content: "Hi"}, {Role: "assistant", Content: []interface{}{map[string]interface{}{"type": "text", "text": "{"}}}},
+			"user,assistant",
+			"{",
+		},
+		{
+			"empty prefill dropped",
+			[]OpenAIMessage{{Role: "user", Content: "Hi"}, {Role: "assistant", Content: "  "}},
+			"user",
+			"Hi",
+		},
+		{
+			"tool message still user",
+			[]OpenAIMessage{{Role: "user", Content: "Hi"}, {Role: "assistant", Content: "Calling"}, {Role: "tool", Content: "42"}},
+			"user,assistant,user",
+			"42",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := h.convertToAnthropic(&OpenAIChatRequest{Model: "claude-sonnet-4", Messages: tt.messages})
+			var roles []string
+			for _, m := range req.Messages {
+				roles = append(roles, m.Role)
+			}
+			if got := strings.Join(roles, ","); got != tt.wantRoles {
+				t.Fatalf("roles = %s, want %s", got, tt.wantRoles)
+			}
+			if last := req.Messages[len(req.Messages)-1].Content; last != tt.wantLast {
+				t.Errorf("last content = %#v, want %#v", last, tt.wantLast)
+			}
+		})
+	}
+}
+
+func TestPromptPartsPrefill(t *testing.T) {
+	h := &EnhancedProxyHandler{}
+	parts := h.promptParts([]OpenAIMessage{
+		{Role: "user", Content: "Write a haiku"},
+		{Role: "assistant", Content: "Autumn moonlight "},
+	})
+	if len(parts) != 2 || parts[1] != prefillInstruction("Autumn moonlight") {
+		t.Errorf("parts = %q", parts)
+	}
+	if parts := h.promptParts([]OpenAIMessage{{Role: "user", Content: "Hi"}}); len(parts) != 1 || parts[0] != "Hi" {
+		t.Errorf("parts without prefill = %q", parts)
+	}
+}
+
+func TestPrefillEcho(t *testing.T) {
+	tests := []struct {
+		name    string
+		prefill string
+		chunks  []string
+		want    string
+	}{
+		{"no prefill", "", []string{"Hello", " world"}, "Hello world"},
+		{"continuation only", "Autumn", []string{" moon", "light"}, " moonlight"},
+		{"echo stripped across chunks", "Autumn moon", []string{"Aut", "umn mo", "on", "light"}, "light"},
+		{"echo followed in same chunk", "Autumn", []string{"Autumn moonlight"}, " moonlight"},
+		{"partial echo flushed", "Autumn moon", []string{"Autumn"}, "Autumn"},
+		{"diverges from prefill", "Autumn moon", []string{"Au", "tomatic"}, "Automatic"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			echo := newPrefillEcho(tt.prefill)
+			var got strings.Builder
+			for _, chunk := range tt.chunks {
+				got.WriteString(echo.Write(chunk))
+			}
+			got.WriteString(echo.Flush())
+			if got.String() != tt.want {
+				t.Errorf("output = %q, want %q", got.String(), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"ccproxy/internal/retry"
+)
+
+// thinkingRetryVariants are the /v1/messages body variants tried, in order,
+// when Anthropic rejects a request's thinking blocks or their signatures
+var thinkingRetryVariants = []struct {
+	name   string
+	derive retry.BodyVariant
+}{
+	{"thinking_filtered", FilterThinkingBlocksForRetry},
+	{"signature_filtered", FilterSignatureSensitiveBlocksForRetry},
+}
+
+// isThinkingBlockError reports whether a 400 response body rejects the
+// request's thinking blocks, e.g. "Invalid `signature` in `thinking` block"
+func isThinkingBlockError(body []byte) bool {
+	lower := bytes.ToLower(body)
+	return bytes.Contains(lower, []byte("signature")) ||
+		(bytes.Contains(lower, []byte("thinking")) && bytes.Contains(lower, []byte("block")))
+}
+
+// webPromptOverflowFile is the text attachment carrying the start of a web
+// mode conversation whose prompt is over the limit
+const webPromptOverflowFile = "conversation.txt"
+
+// webCompletionPayload serializes a claude.ai completion request from the
+// flattened messages of a conversation. It does not depend on the account, so
+// retries reuse it through a retry.PreparedBody.
+//
+// A prompt longer than limit characters (0 = no limit) hits claude.ai's
+// length limits, so the earliest messages move into a text attachment and the
+// prompt keeps the latest messages that fit.
+func webCompletionPayload(parts []string, limit int) []byte {
+	prompt := strings.Join(parts, "\n\n")
+	attachments := []any{}
+	if limit > 0 && utf8.RuneCountInString(prompt) > limit {
+		var overflow string
+		prompt, overflow = splitWebPrompt(parts, limit)
+		attachments = append(attachments, map[string]interface{}{
+			"file_name":         webPromptOverflowFile,
+			"file_type":         "text/plain",
+			"file_size":         len(overflow),
+			"extracted_content": overflow,
+		})
+	}
+
+	payload, _ := json.Marshal(map[string]interface{}{
+		"prompt":      prompt,
+		"timezone":    "UTC",
+		"attachments": attachments,
+		"files":       []any{},
+	})
+	return payload
+}
+
+// splitWebPrompt keeps the trailing messages that fit within limit in the
+// prompt, behind a note pointing at the attachment, and returns the earlier
+// messages as the attachment's content
+func splitWebPrompt(parts []string, limit int) (prompt, overflow string) {
+	note := fmt.Sprintf("The earlier part of this conversation is in the attached %s.", webPromptOverflowFile)
+	size := utf8.RuneCountInString(note)
+	keep := len(parts)
+	for keep > 0 {
+		n := utf8.RuneCountInString(parts[keep-1]) + 2 // paragraph separator
+		if size+n > limit {
+			break
+		}
+		size += n
+		keep--
+	}
+	if keep == len(parts) {
+		// Not even the last message fits; it is answered from the attachment
+		note = fmt.Sprintf("This conversation is in the attached %s. Reply to its last message.", webPromptOverflowFile)
+	}
+
+	overflow = strings.Join(parts[:keep], "\n\n")
+	prompt = strings.Join(append([]string{note}, parts[keep:]...), "\n\n")
+	return prompt, overflow
+}
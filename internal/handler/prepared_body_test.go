@@ -0,0 +1,132 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"ccproxy/internal/loadbalancer"
+)
+
+const thinkingRequest = `{
+	"model": "claude-sonnet-4-20250514",
+	"max_tokens": 100,
+	"messages": [
+		{"role": "user", "content": "hi"},
+		{"role": "assistant", "content": [{"type": "thinking", "thinking": "let me think", "signature": "stale"}, {"type": "text", "text": "hello"}]},
+		{"role": "user", "content": "again"}
+	]
+}`
+
+func TestMessagesAPI_RetriesRejectedThinkingBlocks(t *testing.T) {
+	var requests atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		body, _ := io.ReadAll(r.Body)
+		if bytes.Contains(body, []byte(`"type":"thinking"`)) {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"type":"error","error":{"type":"invalid_request_error","message":"messages.1.content.0: Invalid ` + "`signature`" + ` in ` + "`thinking`" + ` block"}}`))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"type":"message","role":"assistant","content":[{"type":"text","text":"ok"}]}`))
+	}))
+	defer upstream.Close()
+
+	h := NewEnhancedProxyHandler(EnhancedProxyConfig{
+		KeyPool: loadbalancer.NewKeyPool([]string{"sk-ant-REDACTED"}, loadbalancer.StrategyRoundRobin),
+		APIURL:  upstream.URL,
+	})
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/v1/messages", h.Messages)
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(thinkingRequest))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Proxy-Mode", "api")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", w.Code, w.Body.String())
+	}
+	if n := requests.Load(); n != 2 {
+		t.Errorf("upstream requests = %d, want 2", n)
+	}
+}
+
+func TestMessagesAPI_OtherBadRequestsNotRetried(t *testing.T) {
+	var requests atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"type":"error","error":{"type":"invalid_request_error","message":"prompt is too long"}}`))
+	}))
+	defer upstream.Close()
+
+	h := NewEnhancedProxyHandler(EnhancedProxyConfig{
+		KeyPool: loadbalancer.NewKeyPool([]string{"sk-ant-REDACTED"}, loadbalancer.StrategyRoundRobin),
+		APIURL:  upstream.URL,
+	})
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/v1/messages", h.Messages)
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(thinkingRequest))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Proxy-Mode", "api")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "prompt is too long") {
+		t.Errorf("got %d %s, want the upstream 400", w.Code, w.Body.String())
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("upstream requests = %d, want 1", n)
+	}
+}
+
+func TestWebCompletionPayload_Overflow(t *testing.T) {
+	decode := func(payload []byte) (string, []map[string]interface{}) {
+		var body struct {
+			Prompt      string                   `json:"prompt"`
+			Attachments []map[string]interface{} `json:"attachments"`
+		}
+		if err := json.Unmarshal(payload, &body); err != nil {
+			t.Fatal(err)
+		}
+		return body.Prompt, body.Attachments
+	}
+
+	parts := []string{"[System: be brief]", strings.Repeat("a", 400), "[Assistant: ok]", "What now?"}
+
+	prompt, attachments := decode(webCompletionPayload(parts, 0))
+	if prompt != strings.Join(parts, "\n\n") || len(attachments) != 0 {
+		t.Errorf("unlimited prompt split: %d attachments", len(attachments))
+	}
+
+	// The latest messages stay in the prompt, the rest moves to the attachment
+	prompt, attachments = decode(webCompletionPayload(parts, 200))
+	if len(attachments) != 1 || attachments[0]["file_name"] != webPromptOverflowFile {
+		t.Fatalf("attachments = %v", attachments)
+	}
+	if content := attachments[0]["extracted_content"]; content != parts[0]+"\n\n"+parts[1] {
+		t.Errorf("attachment content = %q", content)
+	}
+	if !strings.HasSuffix(prompt, "[Assistant: ok]\n\nWhat now?") || !strings.Contains(prompt, webPromptOverflowFile) || len(prompt) > 200 {
+		t.Errorf("prompt = %q", prompt)
+	}
+
+	// A last message over the limit is answered from the attachment
+	prompt, attachments = decode(webCompletionPayload([]string{"hi", strings.Repeat("b", 300)}, 200))
+	if len(attachments) != 1 || strings.Contains(prompt, "bbb") || !strings.Contains(prompt, "Reply to its last message") {
+		t.Errorf("prompt = %q, attachments = %v", prompt, attachments)
+	}
+}
@@ -0,0 +1,195 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+
+	"ccproxy/internal/middleware"
+	"ccproxy/internal/store"
+)
+
+// PrivacyHandler serves data deletion requests and the audit log
+type PrivacyHandler struct {
+	store *store.Store
+}
+
+func NewPrivacyHandler(store *store.Store) *PrivacyHandler {
+	return &PrivacyHandler{store: store}
+}
+
+// PurgeRequest selects the data to delete. At least one of UserName and
+// TokenID is required; with UserName every token issued to that user is
+// purged.
+type PurgeRequest struct {
+	UserName     string `json:"user_name"`
+	TokenID      string `json:"token_id"`
+	Reason       string `json:"reason"`
+	RequestedBy  string `json:"requested_by"` // Recorded in the receipt; the actor is the signed-in admin
+	RevokeTokens bool   `json:"revoke_tokens"`
+}
+
+// Purge deletes all logs, conversations and search rows for a user or token
+// and returns the deletion receipt recorded in the audit log
+func (h *PrivacyHandler) Purge(c *gin.Context) {
+	var req PurgeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.UserName == "" && req.TokenID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user_name or token_id is required"})
+		return
+	}
+
+	requestedAt := time.Now()
+
+	var tokenIDs []string
+	subject := req.TokenID
+	if req.UserName != "" {
+		ids, err := h.store.ListTokenIDsByUserName(req.UserName)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to look up tokens"})
+			return
+		}
+		tokenIDs = ids
+		subject = req.UserName
+	}
+	if req.TokenID != "" {
+		token, err := h.store.GetToken(req.TokenID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to look up token"})
+			return
+		}
+		if token == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "token not found"})
+			return
+		}
+		if req.UserName != "" && token.UserName != req.UserName {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "token does not belong to user_name"})
+			return
+		}
+		if req.UserName == "" {
+			tokenIDs = []string{req.TokenID}
+		}
+	}
+
+	counts, err := h.store.PurgeTokenData(tokenIDs, req.UserName)
+	if err != nil {
+		log.Error().Err(err).Str("subject", subject).Msg("privacy purge failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to purge data"})
+		return
+	}
+
+	var revoked []string
+	if req.RevokeTokens {
+		for _, id := range tokenIDs {
+			if err := h.store.RevokeToken(id); err != nil {
+				log.Error().Err(err).Str("token_id", id).Msg("failed to revoke token after purge")
+				continue
+			}
+			revoked = append(revoked, id)
+		}
+	}
+
+	if tokenIDs == nil {
+		tokenIDs = []string{}
+	}
+	details := map[string]interface{}{
+		"token_ids":    tokenIDs,
+		"counts":       counts,
+		"total":        counts.Total(),
+		"reason":       req.Reason,
+		"client_ip":    c.ClientIP(),
+		"requested_at": requestedAt,
+		"completed_at": time.Now(),
+	}
+	if req.UserName != "" {
+		details["user_name"] = req.UserName
+	}
+	if req.RequestedBy != "" {
+		details["requested_by"] = req.RequestedBy
+	}
+	if req.RevokeTokens {
+		details["revoked_tokens"] = revoked
+	}
+
+	receipt := &store.AuditEntry{
+		ID:        "aud_" + uuid.New().String(),
+		CreatedAt: requestedAt,
+		Action:    store.AuditActionPrivacyPurge,
+		Actor:     auditActor(c),
+		Subject:   subject,
+		Details:   details,
+	}
+	if err := h.store.CreateAuditEntry(receipt); err != nil {
+		// The data is gone; report the purge even though the receipt was lost
+		log.Error().Err(err).Str("subject", subject).Msg("failed to record purge receipt")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "data purged but failed to record receipt", "counts": counts})
+		return
+	}
+
+	log.Info().Str("subject", subject).Int64("rows", counts.Total()).Msg("privacy purge completed")
+	c.JSON(http.StatusOK, receipt)
+}
+
+// auditActor returns who made an admin request, as authenticated by the
+// admin middleware: the SSO subject or "admin-key". Request bodies never set
+// it, so audit entries cannot be attributed to someone else.
+func auditActor(c *gin.Context) string {
+	if subject := c.GetString(middleware.ContextKeyAdminSubject); subject != "" {
+		return subject
+	}
+	return "admin"
+}
+
+// ListAudit returns audit log entries, newest first
+func (h *PrivacyHandler) ListAudit(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	entries, err := h.store.ListAuditEntries(store.AuditFilter{
+		Action:  c.Query("action"),
+		Subject: c.Query("subject"),
+		Limit:   limit,
+		Offset:  offset,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list audit log"})
+		return
+	}
+	if entries == nil {
+		entries = []*store.AuditEntry{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"entries": entries,
+		"limit":   limit,
+		"offset":  offset,
+	})
+}
+
+// GetAudit returns a single audit entry, such as a deletion receipt
+func (h *PrivacyHandler) GetAudit(c *gin.Context) {
+	entry, err := h.store.GetAuditEntry(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get audit entry"})
+		return
+	}
+	if entry == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "audit entry not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, entry)
+}
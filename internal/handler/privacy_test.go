@@ -0,0 +1,35 @@
+package handler
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"ccproxy/internal/middleware"
+	"ccproxy/internal/store"
+)
+
+func TestPrivacyHandler_PurgeActor(t *testing.T) {
+	router, db := newAccountTestRouter(t)
+	h := NewPrivacyHandler(db)
+	signedIn := func(c *gin.Context) { c.Set(middleware.ContextKeyAdminSubject, "alice@example.com") }
+	router.POST("/privacy/purge", signedIn, h.Purge)
+
+	if err := db.CreateToken(&store.Token{ID: "tok-1", UserName: "bob", Mode: "both", CreatedAt: time.Now(), ExpiresAt: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+
+	// requested_by is kept for the record but does not choose the actor
+	code, resp := doJSON(t, router, http.MethodPost, "/privacy/purge", `{"token_id":"tok-1","reason":"erasure","requested_by":"mallory"}`)
+	if code != http.StatusOK {
+		t.Fatalf("purge: %d %v", code, resp)
+	}
+	if resp["actor"] != "alice@example.com" {
+		t.Errorf("actor = %v, want the signed-in admin", resp["actor"])
+	}
+	if details := resp["details"].(map[string]interface{}); details["requested_by"] != "mallory" {
+		t.Errorf("details = %v", details)
+	}
+}
@@ -0,0 +1,42 @@
+package handler
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// queueWait accumulates the time a request spent waiting for user and
+// account concurrency slots; it is stored with the request log for capacity
+// planning
+type queueWait struct {
+	ns int64
+}
+
+type queueWaitContextKey struct{}
+
+// withQueueWait attaches a fresh queue wait accumulator to ctx
+func withQueueWait(ctx context.Context) context.Context {
+	return context.WithValue(ctx, queueWaitContextKey{}, &queueWait{})
+}
+
+// queueWaitFromContext returns the accumulator attached with withQueueWait, or nil
+func queueWaitFromContext(ctx context.Context) *queueWait {
+	w, _ := ctx.Value(queueWaitContextKey{}).(*queueWait)
+	return w
+}
+
+// addQueueWait adds a slot wait to the request's accumulator, if any
+func addQueueWait(ctx context.Context, d time.Duration) {
+	if w := queueWaitFromContext(ctx); w != nil && d > 0 {
+		atomic.AddInt64(&w.ns, int64(d))
+	}
+}
+
+// total returns the accumulated wait; a nil accumulator has waited 0
+func (w *queueWait) total() time.Duration {
+	if w == nil {
+		return 0
+	}
+	return time.Duration(atomic.LoadInt64(&w.ns))
+}
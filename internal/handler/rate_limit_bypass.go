@@ -0,0 +1,27 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+
+	"ccproxy/internal/middleware"
+	"ccproxy/internal/ratelimit"
+)
+
+// rateLimitBypass is the set of rate limit classes the request's token is
+// exempt from
+func rateLimitBypass(c *gin.Context) ratelimit.Bypass {
+	return ratelimit.ParseBypass(c.GetString(middleware.ContextKeyRateLimitBypass))
+}
+
+// recordRateLimitBypass makes rate limit checks skipped for an exempt token
+// visible in metrics
+func (h *EnhancedProxyHandler) recordRateLimitBypass(c *gin.Context, bypassed []string) {
+	for _, class := range bypassed {
+		h.metrics.RecordRateLimitBypass(class)
+		log.Debug().
+			Str("token_id", c.GetString(middleware.ContextKeyTokenID)).
+			Str("limit", class).
+			Msg("rate limit bypassed")
+	}
+}
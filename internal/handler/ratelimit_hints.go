@@ -0,0 +1,102 @@
+package handler
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+
+	"ccproxy/internal/ratelimit"
+	"ccproxy/internal/store"
+)
+
+// Headers the Anthropic API sends with its rate limits. Clients such as
+// Claude Code wait for retry-after instead of retrying at once, so the proxy
+// sends them too when it rejects a request itself.
+const (
+	headerRateLimitRequestsLimit     = "anthropic-ratelimit-requests-limit"
+	headerRateLimitRequestsRemaining = "anthropic-ratelimit-requests-remaining"
+	headerRateLimitRequestsReset     = "anthropic-ratelimit-requests-reset"
+	headerRetryAfter                 = "retry-after"
+)
+
+// setRateLimitHints describes a rejected proxy rate limit check in the
+// Anthropic rate limit headers
+func setRateLimitHints(c *gin.Context, result *ratelimit.Result) {
+	if result == nil {
+		return
+	}
+	resetAt := result.ResetAt
+	if result.RetryAt != nil {
+		resetAt = *result.RetryAt
+	}
+	if result.Limit > 0 {
+		c.Header(headerRateLimitRequestsLimit, strconv.Itoa(result.Limit))
+	}
+	setRetryHints(c, resetAt)
+}
+
+// setRetryHints tells the client no requests remain until resetAt. Nothing
+// is set when resetAt is unknown.
+func setRetryHints(c *gin.Context, resetAt time.Time) {
+	if resetAt.IsZero() {
+		return
+	}
+	seconds := int(time.Until(resetAt).Round(time.Second).Seconds())
+	if seconds < 1 {
+		seconds = 1
+	}
+	c.Header(headerRateLimitRequestsRemaining, "0")
+	c.Header(headerRateLimitRequestsReset, resetAt.UTC().Format(time.RFC3339))
+	c.Header(headerRetryAfter, strconv.Itoa(seconds))
+}
+
+// setModelCooldownHints sets the retry hints for when the first of
+// accountIDs leaves its cooldown for model
+func setModelCooldownHints(c *gin.Context, st *store.Store, accountIDs []string, model string) {
+	overloaded, err := st.GetModelOverloadedAccounts(model)
+	if err != nil {
+		log.Error().Err(err).Str("model", model).Msg("failed to load model overloads")
+		return
+	}
+	var resetAt time.Time
+	for _, id := range accountIDs {
+		if until, ok := overloaded[id]; ok && (resetAt.IsZero() || until.Before(resetAt)) {
+			resetAt = until
+		}
+	}
+	setRetryHints(c, resetAt)
+}
+
+// accountsRecoverAt returns when the first of accounts that is only cooling
+// down can serve model again: after its rate limit, overload and temporary
+// unschedulable periods and its cooldown for the model have all passed.
+// Accounts that are disabled, expired, outside their scheduling window or
+// unschedulable without a cooldown do not recover by waiting and are
+// ignored. The zero time means none recovers.
+func accountsRecoverAt(accounts []*store.Account, overloaded map[string]time.Time) time.Time {
+	now := time.Now()
+	var first time.Time
+	for _, acc := range accounts {
+		if acc.Status != store.AccountStatusActive || acc.IsExpired() {
+			continue
+		}
+		var at time.Time
+		for _, until := range []*time.Time{acc.RateLimitResetAt, acc.OverloadUntil, acc.TempUnschedulableUntil} {
+			if until != nil && until.After(at) {
+				at = *until
+			}
+		}
+		if until, ok := overloaded[acc.ID]; ok && until.After(at) {
+			at = until
+		}
+		if !at.After(now) || !acc.InScheduleWindow(at) {
+			continue
+		}
+		if first.IsZero() || at.Before(first) {
+			first = at
+		}
+	}
+	return first
+}
@@ -0,0 +1,95 @@
+package handler
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"ccproxy/internal/ratelimit"
+	"ccproxy/internal/store"
+)
+
+func TestSetRateLimitHints(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	retryAt := time.Now().Add(42 * time.Second)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	setRateLimitHints(c, &ratelimit.Result{Limit: 100, ResetAt: time.Now().Add(time.Minute), RetryAt: &retryAt})
+
+	want := map[string]string{
+		"anthropic-ratelimit-requests-limit":     "100",
+		"anthropic-ratelimit-requests-remaining": "0",
+		"anthropic-ratelimit-requests-reset":     retryAt.UTC().Format(time.RFC3339),
+		"retry-after":                            "42",
+	}
+	for header, value := range want {
+		if got := w.Header().Get(header); got != value {
+			t.Errorf("%s = %q, want %q", header, got, value)
+		}
+	}
+
+	// A reset already passed still asks for a short wait
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	setRetryHints(c, time.Now().Add(-time.Second))
+	if got := w.Header().Get("retry-after"); got != "1" {
+		t.Errorf("retry-after for a passed reset = %q", got)
+	}
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	setRetryHints(c, time.Time{})
+	if len(w.Header()) != 0 {
+		t.Errorf("unknown reset set headers: %v", w.Header())
+	}
+}
+
+func TestAccountsRecoverAt(t *testing.T) {
+	now := time.Now()
+	at := func(d time.Duration) *time.Time {
+		t := now.Add(d)
+		return &t
+	}
+	account := func(id string, status store.AccountStatus) *store.Account {
+		return &store.Account{ID: id, Status: status}
+	}
+	rateLimited := account("rate-limited", store.AccountStatusActive)
+	rateLimited.RateLimitResetAt = at(5 * time.Minute)
+	overloaded := account("overloaded", store.AccountStatusActive)
+	overloaded.OverloadUntil = at(2 * time.Minute)
+	overloaded.TempUnschedulableUntil = at(3 * time.Minute)
+	disabled := account("disabled", store.AccountStatusDisabled)
+	disabled.RateLimitResetAt = at(time.Minute)
+	stale := account("stale", store.AccountStatusActive)
+	stale.RateLimitResetAt = at(-time.Minute)
+
+	tests := []struct {
+		name        string
+		accounts    []*store.Account
+		modelCooled map[string]time.Time
+		want        *time.Time
+	}{
+		{"latest cooldown of each account, earliest account", []*store.Account{rateLimited, overloaded}, nil, overloaded.TempUnschedulableUntil},
+		{"model cooldown extends the account", []*store.Account{overloaded}, map[string]time.Time{"overloaded": now.Add(10 * time.Minute)}, at(10 * time.Minute)},
+		{"model cooldown alone", []*store.Account{account("ok", store.AccountStatusActive)}, map[string]time.Time{"ok": now.Add(time.Minute)}, at(time.Minute)},
+		{"disabled accounts do not recover", []*store.Account{disabled}, nil, nil},
+		{"passed cooldowns give no hint", []*store.Account{stale}, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := accountsRecoverAt(tt.accounts, tt.modelCooled)
+			if tt.want == nil {
+				if !got.IsZero() {
+					t.Errorf("got %v, want zero", got)
+				}
+				return
+			}
+			if !got.Equal(*tt.want) {
+				t.Errorf("got %v, want %v", got, *tt.want)
+			}
+		})
+	}
+}
@@ -14,10 +14,10 @@ import (
 )
 
 type RequestLogsHandler struct {
-	store *store.Store
+	store store.LogStore
 }
 
-func NewRequestLogsHandler(store *store.Store) *RequestLogsHandler {
+func NewRequestLogsHandler(store store.LogStore) *RequestLogsHandler {
 	return &RequestLogsHandler{
 		store: store,
 	}
@@ -34,6 +34,12 @@ type ListRequestLogsRequest struct {
 	ToDate    string `form:"to_date"`
 	Page      int    `form:"page"`
 	Limit     int    `form:"limit"`
+	// UpstreamRequestID looks up a request by the Anthropic request-id
+	UpstreamRequestID string `form:"upstream_request_id"`
+	// EndUserID filters by the end user sent as the OpenAI user field or metadata.user_id
+	EndUserID string `form:"end_user_id"`
+	// FailureCategory filters by the category assigned to failed requests
+	FailureCategory string `form:"failure_category"`
 }
 
 type ListRequestLogsResponse struct {
@@ -44,24 +50,35 @@ type ListRequestLogsResponse struct {
 }
 
 type RequestLogDTO struct {
-	ID               string  `json:"id"`
-	TokenID          string  `json:"token_id"`
-	AccountID        *string `json:"account_id,omitempty"`
-	UserName         string  `json:"user_name"`
-	Mode             string  `json:"mode"`
-	Model            string  `json:"model"`
-	Stream           bool    `json:"stream"`
-	RequestAt        string  `json:"request_at"`
-	ResponseAt       *string `json:"response_at,omitempty"`
-	DurationMs       *int64  `json:"duration_ms,omitempty"`
-	TTFTMs           *int64  `json:"ttft_ms,omitempty"`
-	PromptTokens     int     `json:"prompt_tokens"`
-	CompletionTokens int     `json:"completion_tokens"`
-	TotalTokens      int     `json:"total_tokens"`
-	StatusCode       int     `json:"status_code"`
-	Success          bool    `json:"success"`
-	ErrorMessage     *string `json:"error_message,omitempty"`
-	ConversationID   *string `json:"conversation_id,omitempty"`
+	ID               string   `json:"id"`
+	TokenID          string   `json:"token_id"`
+	AccountID        *string  `json:"account_id,omitempty"`
+	UserName         string   `json:"user_name"`
+	Mode             string   `json:"mode"`
+	Model            string   `json:"model"`
+	Stream           bool     `json:"stream"`
+	RequestAt        string   `json:"request_at"`
+	ResponseAt       *string  `json:"response_at,omitempty"`
+	DurationMs       *int64   `json:"duration_ms,omitempty"`
+	TTFTMs           *int64   `json:"ttft_ms,omitempty"`
+	PromptTokens     int      `json:"prompt_tokens"`
+	CompletionTokens int      `json:"completion_tokens"`
+	TotalTokens      int      `json:"total_tokens"`
+	StatusCode       int      `json:"status_code"`
+	Success          bool     `json:"success"`
+	ErrorMessage     *string  `json:"error_message,omitempty"`
+	ConversationID   *string  `json:"conversation_id,omitempty"`
+	ClientIP         *string  `json:"client_ip,omitempty"`
+	UserAgent        *string  `json:"user_agent,omitempty"`
+	CostUSD          *float64 `json:"cost_usd,omitempty"`
+	ClientCountry    *string  `json:"client_country,omitempty"`
+	ClientName       *string  `json:"client_name,omitempty"`
+	UpstreamRequestID *string `json:"upstream_request_id,omitempty"`
+	TraceID           *string `json:"trace_id,omitempty"`
+	EndUserID         *string `json:"end_user_id,omitempty"`
+	FailureCategory   *string `json:"failure_category,omitempty"`
+	ModelDefaulted    bool    `json:"model_defaulted,omitempty"` // Model was filled in from the token or config default
+	Truncated         bool    `json:"truncated,omitempty"`       // Stream was interrupted midway
 }
 
 // ListRequestLogs lists request logs with filtering and pagination
@@ -82,6 +99,10 @@ func (h *RequestLogsHandler) ListRequestLogs(c *gin.Context) {
 		Success:   req.Success,
 		Page:      req.Page,
 		Limit:     req.Limit,
+
+		UpstreamRequestID: req.UpstreamRequestID,
+		EndUserID:         req.EndUserID,
+		FailureCategory:   req.FailureCategory,
 	}
 
 	// Parse dates
@@ -186,6 +207,53 @@ func (h *RequestLogsHandler) toRequestLogDTO(log *store.RequestLog) *RequestLogD
 		dto.ConversationID = &convID
 	}
 
+	if log.ClientIP.Valid {
+		clientIP := log.ClientIP.String
+		dto.ClientIP = &clientIP
+	}
+
+	if log.UserAgent.Valid {
+		userAgent := log.UserAgent.String
+		dto.UserAgent = &userAgent
+	}
+
+	if log.CostUSD.Valid {
+		cost := log.CostUSD.Float64
+		dto.CostUSD = &cost
+	}
+
+	if log.ClientCountry.Valid {
+		country := log.ClientCountry.String
+		dto.ClientCountry = &country
+	}
+
+	if log.ClientName.Valid {
+		clientName := log.ClientName.String
+		dto.ClientName = &clientName
+	}
+
+	if log.UpstreamRequestID.Valid {
+		upstreamRequestID := log.UpstreamRequestID.String
+		dto.UpstreamRequestID = &upstreamRequestID
+	}
+
+	if log.TraceID.Valid {
+		traceID := log.TraceID.String
+		dto.TraceID = &traceID
+	}
+
+	if log.EndUserID.Valid {
+		endUserID := log.EndUserID.String
+		dto.EndUserID = &endUserID
+	}
+
+	if log.FailureCategory.Valid {
+		failureCategory := log.FailureCategory.String
+		dto.FailureCategory = &failureCategory
+	}
+	dto.ModelDefaulted = log.ModelDefaulted
+	dto.Truncated = log.Truncated
+
 	return dto
 }
 
@@ -233,6 +301,10 @@ func (h *RequestLogsHandler) ExportRequestLogs(c *gin.Context) {
 		Model:     req.Model,
 		Success:   req.Success,
 		Limit:     10000, // Max export limit
+
+		UpstreamRequestID: req.UpstreamRequestID,
+		EndUserID:         req.EndUserID,
+		FailureCategory:   req.FailureCategory,
 	}
 
 	// Parse dates
@@ -275,6 +347,8 @@ func (h *RequestLogsHandler) exportCSV(c *gin.Context, logs []*store.RequestLog)
 		"RequestAt", "ResponseAt", "DurationMs", "TTFTMs",
 		"PromptTokens", "CompletionTokens", "TotalTokens",
 		"StatusCode", "Success", "ErrorMessage", "ConversationID",
+		"ClientIP", "UserAgent", "CostUSD", "ClientCountry", "ClientName",
+		"UpstreamRequestID", "TraceID", "EndUserID", "FailureCategory",
 	}
 	writer.Write(header)
 
@@ -299,6 +373,15 @@ func (h *RequestLogsHandler) exportCSV(c *gin.Context, logs []*store.RequestLog)
 			fmt.Sprintf("%t", log.Success),
 			log.ErrorMessage.String,
 			log.ConversationID.String,
+			log.ClientIP.String,
+			log.UserAgent.String,
+			formatNullFloat64(log.CostUSD),
+			log.ClientCountry.String,
+			log.ClientName.String,
+			log.UpstreamRequestID.String,
+			log.TraceID.String,
+			log.EndUserID.String,
+			log.FailureCategory.String,
 		}
 		writer.Write(row)
 	}
@@ -334,3 +417,10 @@ func formatNullInt64(ni sql.NullInt64) string {
 	}
 	return ""
 }
+
+func formatNullFloat64(nf sql.NullFloat64) string {
+	if nf.Valid {
+		return fmt.Sprintf("%.6f", nf.Float64)
+	}
+	return ""
+}
@@ -0,0 +1,278 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"ccproxy/internal/middleware"
+)
+
+// maxResponseFooterLength bounds the per-token response footer
+const maxResponseFooterLength = 1000
+
+type footerMode int
+
+const (
+	footerUndecided footerMode = iota
+	footerPassthrough
+	footerStream
+	footerJSON
+)
+
+// footerWriter appends the token's response footer to successful responses.
+// Streams get it as a final text delta before the finish event; JSON bodies
+// are buffered and get it as a final text block (or appended to the message
+// content for OpenAI responses). Responses that end in a tool call are left
+// alone so clients still see the tool call last.
+type footerWriter struct {
+	gin.ResponseWriter
+	footer    string
+	mode      footerMode
+	buf       bytes.Buffer
+	injected  bool
+	nextIndex int // next free Anthropic content block index
+}
+
+// ResponseFooterMiddleware appends the token's response_footer, when set, to
+// /v1/messages and /v1/chat/completions responses, except under strict
+// passthrough
+func ResponseFooterMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		footer := middleware.ResponseFooter(c)
+		if footer == "" || strictPassthrough(c) {
+			c.Next()
+			return
+		}
+
+		writer := &footerWriter{ResponseWriter: c.Writer, footer: footer}
+		c.Writer = writer
+		c.Next()
+		writer.finish()
+	}
+}
+
+// decide picks how the response is handled on the first write, once the
+// status and content type are known
+func (w *footerWriter) decide() {
+	if w.mode != footerUndecided {
+		return
+	}
+	contentType := w.Header().Get("Content-Type")
+	switch {
+	case w.Status() != http.StatusOK:
+		w.mode = footerPassthrough
+	case strings.HasPrefix(contentType, "text/event-stream"):
+		w.mode = footerStream
+	case strings.HasPrefix(contentType, "application/json"):
+		w.mode = footerJSON
+	default:
+		w.mode = footerPassthrough
+	}
+	if w.mode != footerPassthrough {
+		// The body length changes, so an upstream Content-Length no longer applies
+		w.Header().Del("Content-Length")
+	}
+}
+
+func (w *footerWriter) Write(p []byte) (int, error) {
+	w.decide()
+	switch w.mode {
+	case footerJSON:
+		if w.buf.Len()+len(p) > maxUsageBufferBytes {
+			// Too large to rewrite; send it unchanged
+			w.mode = footerPassthrough
+			if _, err := w.ResponseWriter.Write(w.buf.Bytes()); err != nil {
+				return 0, err
+			}
+			w.buf.Reset()
+			return w.ResponseWriter.Write(p)
+		}
+		return w.buf.Write(p)
+
+	case footerStream:
+		w.buf.Write(p)
+		for {
+			end := bytes.Index(w.buf.Bytes(), []byte("\n\n"))
+			if end < 0 {
+				break
+			}
+			event := append([]byte(nil), w.buf.Next(end+2)...)
+			if _, err := w.ResponseWriter.Write(append(w.beforeEvent(event), event...)); err != nil {
+				return 0, err
+			}
+		}
+		return len(p), nil
+
+	default:
+		return w.ResponseWriter.Write(p)
+	}
+}
+
+func (w *footerWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *footerWriter) Flush() {
+	w.decide()
+	w.ResponseWriter.Flush()
+}
+
+// finish writes whatever is still buffered once the handler returns
+func (w *footerWriter) finish() {
+	if w.buf.Len() == 0 {
+		return
+	}
+	body := w.buf.Bytes()
+	if w.mode == footerJSON {
+		body = w.appendToJSON(body)
+	}
+	w.ResponseWriter.Write(body)
+	w.buf.Reset()
+}
+
+// beforeEvent returns the events to send before a stream event: the footer
+// goes in front of the first finish event
+func (w *footerWriter) beforeEvent(event []byte) []byte {
+	var data []byte
+	for _, line := range bytes.Split(event, []byte("\n")) {
+		if payload, ok := bytes.CutPrefix(line, []byte("data:")); ok {
+			data = bytes.TrimSpace(payload)
+		}
+	}
+	if w.injected || len(data) == 0 {
+		return nil
+	}
+
+	var payload map[string]interface{}
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return nil
+	}
+
+	switch payload["type"] {
+	case "content_block_start":
+		if index, ok := payload["index"].(float64); ok && int(index) >= w.nextIndex {
+			w.nextIndex = int(index) + 1
+		}
+
+	case "message_delta":
+		// Anthropic Messages stream
+		delta, _ := payload["delta"].(map[string]interface{})
+		if delta == nil || delta["stop_reason"] == "tool_use" {
+			return nil
+		}
+		w.injected = true
+		index := w.nextIndex
+		w.nextIndex++
+		return anthropicTextBlockEvents(index, w.footer)
+
+	case "completion":
+		// claude.ai web stream
+		if reason, _ := payload["stop_reason"].(string); reason != "" {
+			w.injected = true
+			return sseEvent("", map[string]interface{}{
+				"type":        "completion",
+				"completion":  w.footer,
+				"stop_reason": nil,
+				"model":       payload["model"],
+			})
+		}
+
+	case nil:
+		// OpenAI chat.completion.chunk stream
+		choices, _ := payload["choices"].([]interface{})
+		if len(choices) == 0 {
+			return nil
+		}
+		choice, _ := choices[0].(map[string]interface{})
+		if reason, _ := choice["finish_reason"].(string); reason != "" && reason != "tool_calls" {
+			w.injected = true
+			return sseEvent("", map[string]interface{}{
+				"id":      payload["id"],
+				"object":  "chat.completion.chunk",
+				"created": payload["created"],
+				"model":   payload["model"],
+				"choices": []map[string]interface{}{{
+					"index":         0,
+					"delta":         map[string]interface{}{"content": w.footer},
+					"finish_reason": nil,
+				}},
+			})
+		}
+	}
+	return nil
+}
+
+// anthropicTextBlockEvents returns the stream events of a complete text
+// content block
+func anthropicTextBlockEvents(index int, text string) []byte {
+	var events bytes.Buffer
+	events.Write(sseEvent("content_block_start", map[string]interface{}{
+		"type":          "content_block_start",
+		"index":         index,
+		"content_block": map[string]interface{}{"type": "text", "text": ""},
+	}))
+	events.Write(sseEvent("content_block_delta", map[string]interface{}{
+		"type":  "content_block_delta",
+		"index": index,
+		"delta": map[string]interface{}{"type": "text_delta", "text": text},
+	}))
+	events.Write(sseEvent("content_block_stop", map[string]interface{}{
+		"type":  "content_block_stop",
+		"index": index,
+	}))
+	return events.Bytes()
+}
+
+// appendToJSON adds the footer to an Anthropic message or an OpenAI chat
+// completion. Other bodies are returned unchanged.
+func (w *footerWriter) appendToJSON(body []byte) []byte {
+	var payload map[string]interface{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return body
+	}
+
+	switch {
+	case payload["type"] == "message":
+		content, ok := payload["content"].([]interface{})
+		if !ok || payload["stop_reason"] == "tool_use" {
+			return body
+		}
+		payload["content"] = append(content, map[string]interface{}{"type": "text", "text": w.footer})
+
+	case payload["object"] == "chat.completion":
+		choices, _ := payload["choices"].([]interface{})
+		if len(choices) == 0 {
+			return body
+		}
+		choice, _ := choices[0].(map[string]interface{})
+		message, _ := choice["message"].(map[string]interface{})
+		text, ok := message["content"].(string)
+		if !ok || choice["finish_reason"] == "tool_calls" {
+			return body
+		}
+		message["content"] = text + w.footer
+
+	default:
+		return body
+	}
+
+	rewritten, err := json.Marshal(payload)
+	if err != nil {
+		return body
+	}
+	return rewritten
+}
+
+// sseEvent formats a server-sent event; an empty name sends a data-only event
+func sseEvent(name string, data interface{}) []byte {
+	payload, _ := json.Marshal(data)
+	if name == "" {
+		return []byte(fmt.Sprintf("data: %s\n\n", payload))
+	}
+	return []byte(fmt.Sprintf("event: %s\ndata: %s\n\n", name, payload))
+}
@@ -0,0 +1,134 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"ccproxy/internal/middleware"
+)
+
+// serveWithFooter runs handler behind the footer middleware for a token with footer
+func serveWithFooter(t *testing.T, footer string, handler gin.HandlerFunc) *httptest.ResponseRecorder {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/v1/messages", func(c *gin.Context) {
+		if footer != "" {
+			c.Set(middleware.ContextKeyResponseFooter, footer)
+		}
+	}, ResponseFooterMiddleware(), handler)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/messages", nil))
+	return w
+}
+
+func TestResponseFooter_AnthropicStream(t *testing.T) {
+	stream := "event: message_start\ndata: {\"type\":\"message_start\",\"message\":{\"id\":\"msg_1\"}}\n\n" +
+		"event: content_block_start\ndata: {\"type\":\"content_block_start\",\"index\":0,\"content_block\":{\"type\":\"text\",\"text\":\"\"}}\n\n" +
+		"event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"text_delta\",\"text\":\"Hello\"}}\n\n" +
+		"event: content_block_stop\ndata: {\"type\":\"content_block_stop\",\"index\":0}\n\n" +
+		"event: message_delta\ndata: {\"type\":\"message_delta\",\"delta\":{\"stop_reason\":\"end_turn\"},\"usage\":{\"output_tokens\":5}}\n\n" +
+		"event: message_stop\ndata: {\"type\":\"message_stop\"}\n\n"
+
+	w := serveWithFooter(t, "\n\n— via ccproxy", func(c *gin.Context) {
+		c.Header("Content-Type", "text/event-stream")
+		c.Header("Content-Length", "999")
+		c.Status(http.StatusOK)
+		// Events split across writes
+		for i := 0; i < len(stream); i += 7 {
+			end := i + 7
+			if end > len(stream) {
+				end = len(stream)
+			}
+			c.Writer.Write([]byte(stream[i:end]))
+		}
+	})
+
+	body := w.Body.String()
+	if w.Header().Get("Content-Length") != "" {
+		t.Error("Content-Length should be dropped")
+	}
+	footerAt := strings.Index(body, `"text":"\n\n— via ccproxy"`)
+	if footerAt < 0 {
+		t.Fatalf("footer not injected:\n%s", body)
+	}
+	if !strings.Contains(body, `{"content_block":{"text":"","type":"text"},"index":1,"type":"content_block_start"}`) {
+		t.Errorf("footer block should use the next index:\n%s", body)
+	}
+	if footerAt > strings.Index(body, "message_delta") {
+		t.Error("footer should come before message_delta")
+	}
+	if strings.Count(body, "— via ccproxy") != 1 {
+		t.Error("footer should be injected once")
+	}
+}
+
+func TestResponseFooter_SkipsToolUse(t *testing.T) {
+	stream := "data: {\"type\":\"content_block_start\",\"index\":0,\"content_block\":{\"type\":\"tool_use\"}}\n\n" +
+		"data: {\"type\":\"message_delta\",\"delta\":{\"stop_reason\":\"tool_use\"}}\n\n"
+
+	w := serveWithFooter(t, "-- footer", func(c *gin.Context) {
+		c.Header("Content-Type", "text/event-stream")
+		c.String(http.StatusOK, stream)
+	})
+	if w.Body.String() != stream {
+		t.Errorf("tool_use stream should be unchanged:\n%s", w.Body.String())
+	}
+}
+
+func TestResponseFooter_JSON(t *testing.T) {
+	w := serveWithFooter(t, " -- footer", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"type":        "message",
+			"stop_reason": "end_turn",
+			"content":     []gin.H{{"type": "text", "text": "Hello"}},
+		})
+	})
+	var message struct {
+		Content []AnthropicContent `json:"content"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &message); err != nil {
+		t.Fatal(err)
+	}
+	if len(message.Content) != 2 || message.Content[1].Text != " -- footer" {
+		t.Errorf("unexpected content: %+v", message.Content)
+	}
+
+	w = serveWithFooter(t, " -- footer", func(c *gin.Context) {
+		c.JSON(http.StatusOK, &OpenAIChatResponse{
+			Object:  "chat.completion",
+			Choices: []OpenAIChoice{{Message: OpenAIMessage{Role: "assistant", Content: "Hello"}}},
+		})
+	})
+	var completion OpenAIChatResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &completion); err != nil {
+		t.Fatal(err)
+	}
+	if completion.Choices[0].Message.Content != "Hello -- footer" {
+		t.Errorf("content = %v", completion.Choices[0].Message.Content)
+	}
+}
+
+func TestResponseFooter_LeavesErrorsAndOtherTokens(t *testing.T) {
+	errorBody := `{"type":"error","error":{"type":"overloaded_error"}}`
+	w := serveWithFooter(t, " -- footer", func(c *gin.Context) {
+		c.Data(529, "application/json", []byte(errorBody))
+	})
+	if w.Body.String() != errorBody {
+		t.Errorf("error response changed: %s", w.Body.String())
+	}
+
+	messageBody := `{"type":"message","content":[{"type":"text","text":"Hello"}]}`
+	w = serveWithFooter(t, "", func(c *gin.Context) {
+		c.Data(http.StatusOK, "application/json", []byte(messageBody))
+	})
+	if w.Body.String() != messageBody {
+		t.Errorf("response without footer changed: %s", w.Body.String())
+	}
+}
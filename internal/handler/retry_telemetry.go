@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Retry telemetry response headers
+const (
+	HeaderAttempts        = "X-CCProxy-Attempts"         // Upstream requests made, including retries
+	HeaderAccountSwitches = "X-CCProxy-Account-Switches" // Accounts given up on before the one that answered
+	HeaderAccount         = "X-CCProxy-Account"          // Hash of the account that answered
+)
+
+const (
+	contextKeyRetryTelemetry = "retry_telemetry"
+	contextKeyRetryResult    = "retry_result"
+)
+
+// retryResult is how a request was served upstream
+type retryResult struct {
+	attempts        int
+	accountSwitches int
+	accountID       string
+}
+
+// RetryTelemetryMiddleware exposes how each request was served in response
+// headers, and in the system_fingerprint of OpenAI responses, so clients can
+// correlate their latency with proxy-side retries. Account IDs are hashed.
+func RetryTelemetryMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(contextKeyRetryTelemetry, true)
+		c.Next()
+	}
+}
+
+// recordRetryTelemetry notes the attempts behind the response about to be
+// written. It must be called before the response headers are sent; without
+// RetryTelemetryMiddleware it does nothing.
+func recordRetryTelemetry(c *gin.Context, attempts, accountSwitches int, accountID string) {
+	if !c.GetBool(contextKeyRetryTelemetry) {
+		return
+	}
+	c.Set(contextKeyRetryResult, retryResult{attempts: attempts, accountSwitches: accountSwitches, accountID: accountID})
+	c.Header(HeaderAttempts, strconv.Itoa(attempts))
+	c.Header(HeaderAccountSwitches, strconv.Itoa(accountSwitches))
+	if accountID != "" {
+		c.Header(HeaderAccount, hashAccountID(accountID))
+	}
+}
+
+// retryFingerprint is the system_fingerprint of an OpenAI response carrying
+// the recorded retry telemetry, "" when there is none
+func retryFingerprint(c *gin.Context) string {
+	v, ok := c.Get(contextKeyRetryResult)
+	if !ok {
+		return ""
+	}
+	r := v.(retryResult)
+	fingerprint := fmt.Sprintf("ccproxy_a%d_s%d", r.attempts, r.accountSwitches)
+	if r.accountID != "" {
+		fingerprint += "_" + hashAccountID(r.accountID)
+	}
+	return fingerprint
+}
+
+// hashAccountID identifies an account to clients without revealing its ID;
+// admins can hash their account IDs the same way to look one up
+func hashAccountID(accountID string) string {
+	sum := sha256.Sum256([]byte(accountID))
+	return hex.EncodeToString(sum[:6])
+}
@@ -0,0 +1,42 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRetryTelemetry(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	respond := func(c *gin.Context) {
+		recordRetryTelemetry(c, 3, 1, "acc-2")
+		c.JSON(http.StatusOK, &OpenAIChatResponse{Object: "chat.completion", SystemFingerprint: retryFingerprint(c)})
+	}
+	router := gin.New()
+	router.POST("/on", RetryTelemetryMiddleware(), respond)
+	router.POST("/off", respond)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/on", nil))
+	account := hashAccountID("acc-2")
+	if len(account) != 12 || account == hashAccountID("acc-1") {
+		t.Fatalf("hashAccountID = %q", account)
+	}
+	if w.Header().Get(HeaderAttempts) != "3" || w.Header().Get(HeaderAccountSwitches) != "1" || w.Header().Get(HeaderAccount) != account {
+		t.Errorf("headers = %v", w.Header())
+	}
+	var resp OpenAIChatResponse
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	if want := "ccproxy_a3_s1_" + account; resp.SystemFingerprint != want {
+		t.Errorf("system_fingerprint = %q, want %q", resp.SystemFingerprint, want)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/off", nil))
+	if w.Header().Get(HeaderAttempts) != "" || w.Body.String() != `{"id":"","object":"chat.completion","created":0,"model":"","choices":null}` {
+		t.Errorf("telemetry without middleware: %v %s", w.Header(), w.Body.String())
+	}
+}
@@ -0,0 +1,238 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"ccproxy/internal/scheduler"
+	"ccproxy/internal/store"
+)
+
+type SchedulerHandler struct {
+	scheduler scheduler.Scheduler
+	store     *store.Store
+}
+
+func NewSchedulerHandler(sched scheduler.Scheduler, store *store.Store) *SchedulerHandler {
+	return &SchedulerHandler{
+		scheduler: sched,
+		store:     store,
+	}
+}
+
+// PinRequest pins a user (token ID or metadata.user_id) or a sticky session hash to an account
+type PinRequest struct {
+	UserID      string `json:"user_id" form:"user_id"`
+	SessionHash string `json:"session_hash" form:"session_hash"`
+	AccountID   string `json:"account_id" form:"account_id"`
+	TTL         string `json:"ttl" form:"ttl"` // e.g. "30m"; empty means no expiry
+}
+
+// Pin forces matching traffic onto a specific account
+func (h *SchedulerHandler) Pin(c *gin.Context) {
+	var req PinRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.AccountID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "account_id is required"})
+		return
+	}
+
+	var ttl time.Duration
+	if req.TTL != "" {
+		d, err := time.ParseDuration(req.TTL)
+		if err != nil || d < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid ttl format"})
+			return
+		}
+		ttl = d
+	}
+
+	account, err := h.store.GetAccount(req.AccountID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get account"})
+		return
+	}
+	if account == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "account not found"})
+		return
+	}
+
+	pin, err := h.scheduler.PinAccount(c.Request.Context(), scheduler.PinOptions{
+		UserID:      req.UserID,
+		SessionHash: req.SessionHash,
+		AccountID:   req.AccountID,
+		TTL:         ttl,
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, pin)
+}
+
+// Unpin removes a pin; accepts user_id or session_hash as JSON body or query params
+func (h *SchedulerHandler) Unpin(c *gin.Context) {
+	var req PinRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.UserID == "" && req.SessionHash == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id or session_hash is required"})
+		return
+	}
+
+	if !h.scheduler.UnpinAccount(c.Request.Context(), req.UserID, req.SessionHash) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "pin not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "pin removed successfully"})
+}
+
+// ListPins returns all active pins
+func (h *SchedulerHandler) ListPins(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"pins": h.scheduler.ListPins()})
+}
+
+// InvalidateSticky drops the sticky sessions bound to the account_id query
+// parameter, so they are scheduled afresh on their next request
+func (h *SchedulerHandler) InvalidateSticky(c *gin.Context) {
+	accountID := c.Query("account_id")
+	if accountID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "account_id is required"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"invalidated": h.scheduler.InvalidateAccount(accountID)})
+}
+
+// Reasons an account is left out before the scheduler runs
+const (
+	explainFilterInactive        = "inactive"
+	explainFilterExpired         = "expired"
+	explainFilterModelOverloaded = "model_overloaded"
+)
+
+// ExplainAccount is one account's standing in an explained selection
+type ExplainAccount struct {
+	AccountID string `json:"account_id"`
+	Name      string `json:"name"`
+	// Filtered is why the scheduler cannot pick the account
+	Filtered string `json:"filtered,omitempty"`
+	// Draining accounts only serve the pins and sticky sessions bound to them
+	Draining bool `json:"draining,omitempty"`
+	// Schedulable and Flags are the account's own scheduling state, which
+	// /v1/chat/completions selects by
+	Schedulable bool     `json:"schedulable"`
+	Flags       []string `json:"flags,omitempty"`
+}
+
+// Explain shows how the scheduler would pick an account for a hypothetical
+// /v1/messages web mode request from user_id with session_hash for model,
+// without affecting sticky sessions or statistics
+func (h *SchedulerHandler) Explain(c *gin.Context) {
+	userID := c.Query("user_id")
+	sessionHash := c.Query("session_hash")
+	model := c.Query("model")
+
+	accounts, err := h.store.ListAccountsWithStatus()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list accounts"})
+		return
+	}
+
+	explained := make([]*ExplainAccount, 0, len(accounts))
+	byID := make(map[string]*ExplainAccount, len(accounts))
+	var activeIDs []string
+	now := time.Now()
+	for _, account := range accounts {
+		entry := &ExplainAccount{
+			AccountID:   account.ID,
+			Name:        account.Name,
+			Schedulable: account.IsSchedulable(),
+			Flags:       accountFlags(account, now),
+		}
+		switch {
+		case !account.IsActive:
+			entry.Filtered = explainFilterInactive
+		case account.IsExpired():
+			entry.Filtered = explainFilterExpired
+		default:
+			activeIDs = append(activeIDs, account.ID)
+		}
+		explained = append(explained, entry)
+		byID[account.ID] = entry
+	}
+
+	// The same filters, in the same order, as web mode /v1/messages
+	accountIDs := activeIDs
+	if model != "" {
+		accountIDs = filterModelOverloaded(h.store, activeIDs, model)
+		kept := make(map[string]bool, len(accountIDs))
+		for _, id := range accountIDs {
+			kept[id] = true
+		}
+		for _, id := range activeIDs {
+			if !kept[id] {
+				byID[id].Filtered = explainFilterModelOverloaded
+			}
+		}
+	}
+	accountIDs, drainingIDs := splitDraining(h.store, accountIDs)
+
+	explanation := h.scheduler.Explain(c.Request.Context(), scheduler.SelectOptions{
+		AccountIDs:  accountIDs,
+		DrainingIDs: drainingIDs,
+		SessionHash: sessionHash,
+		UserID:      userID,
+	}, nil)
+	for _, candidate := range explanation.Candidates {
+		entry := byID[candidate.AccountID]
+		entry.Draining = candidate.Draining
+		if candidate.Filtered != "" {
+			entry.Filtered = candidate.Filtered
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user_id":      userID,
+		"session_hash": sessionHash,
+		"model":        model,
+		"accounts":     explained,
+		"pin":          explanation.Pin,
+		"sticky":       explanation.Sticky,
+		"selected":     explanation.Selected,
+		"reason":       explanation.Reason,
+		"load_score":   explanation.LoadScore,
+	})
+}
+
+// accountFlags lists the account's scheduling flags in effect at now
+func accountFlags(account *store.Account, now time.Time) []string {
+	var flags []string
+	if account.Status != store.AccountStatusActive {
+		flags = append(flags, "status_"+string(account.Status))
+	}
+	if account.RateLimitResetAt != nil && now.Before(*account.RateLimitResetAt) {
+		flags = append(flags, "rate_limited")
+	}
+	if account.TempUnschedulableUntil != nil && now.Before(*account.TempUnschedulableUntil) {
+		flags = append(flags, "temp_unschedulable:"+account.TempUnschedulableReason)
+	}
+	if account.OverloadUntil != nil && now.Before(*account.OverloadUntil) {
+		flags = append(flags, "overloaded")
+	}
+	if !account.InScheduleWindow(now) {
+		flags = append(flags, "outside_schedule_window")
+	}
+	return flags
+}
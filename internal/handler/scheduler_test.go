@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"ccproxy/internal/scheduler"
+	"ccproxy/internal/store"
+)
+
+func TestSchedulerHandler_Explain(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, err := store.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	// acc-0 is the newest, so it is listed first
+	for i, id := range []string{"acc-3", "acc-2", "acc-1", "acc-0"} {
+		if err := db.CreateAccount(&store.Account{
+			ID:          id,
+			Name:        id,
+			Type:        store.AccountTypeSessionKey,
+			Credentials: store.Credentials{SessionKey: "sk-ant-sid01-" + id},
+			CreatedAt:   time.Now().Add(time.Duration(i) * time.Second),
+			IsActive:    id != "acc-3",
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.SetAccountModelOverload("acc-2", "claude-opus-4", time.Now().Add(time.Hour), "overloaded"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetAccountRateLimit("acc-1", time.Now().Add(time.Hour), "rate_limited"); err != nil {
+		t.Fatal(err)
+	}
+
+	sched := scheduler.NewScheduler(scheduler.SchedulerConfig{StickySessionTTL: time.Hour, Strategy: scheduler.StrategyRoundRobin}, nil, nil)
+	defer sched.Close()
+	h := NewSchedulerHandler(sched, db)
+	router := gin.New()
+	router.GET("/scheduler/explain", h.Explain)
+
+	code, resp := doJSON(t, router, http.MethodGet, "/scheduler/explain?model=claude-opus-4&session_hash=abc", "")
+	if code != http.StatusOK {
+		t.Fatalf("explain: %d %v", code, resp)
+	}
+	if resp["selected"] != "acc-0" || resp["reason"] != "round_robin" {
+		t.Errorf("selected %v (%v)", resp["selected"], resp["reason"])
+	}
+
+	accounts := make(map[string]map[string]interface{})
+	for _, a := range resp["accounts"].([]interface{}) {
+		account := a.(map[string]interface{})
+		accounts[account["account_id"].(string)] = account
+	}
+	if accounts["acc-3"]["filtered"] != "inactive" || accounts["acc-2"]["filtered"] != "model_overloaded" {
+		t.Errorf("filtered: acc-3 %v, acc-2 %v", accounts["acc-3"]["filtered"], accounts["acc-2"]["filtered"])
+	}
+	acc1 := accounts["acc-1"]
+	if acc1["filtered"] != nil || acc1["schedulable"] != false {
+		t.Errorf("acc-1 = %v", acc1)
+	}
+	if flags, _ := acc1["flags"].([]interface{}); len(flags) != 2 || flags[0] != "rate_limited" || flags[1] != "temp_unschedulable:rate_limited" {
+		t.Errorf("acc-1 flags = %v", acc1["flags"])
+	}
+
+	// Explaining binds no sticky session
+	if _, ok := sched.GetStickyAccount(context.Background(), "abc"); ok {
+		t.Error("explain bound a sticky session")
+	}
+}
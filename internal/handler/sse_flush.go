@@ -0,0 +1,190 @@
+package handler
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"ccproxy/internal/middleware"
+)
+
+// defaultSSEWriteBuffer is used when no write buffer size is configured
+const defaultSSEWriteBuffer = 32 * 1024
+
+// Bounds of the per-token stream flush settings
+const (
+	maxStreamFlushMs    = 1000
+	maxStreamFlushBytes = 1 << 20
+)
+
+// validateStreamFlush checks a token's stream flush interval and buffer size
+func validateStreamFlush(flushMs, flushBytes int) error {
+	if flushMs < 0 || flushMs > maxStreamFlushMs {
+		return fmt.Errorf("stream_flush_ms must be between 0 and %d", maxStreamFlushMs)
+	}
+	if flushBytes < 0 || flushBytes > maxStreamFlushBytes {
+		return fmt.Errorf("stream_flush_bytes must be between 0 and %d", maxStreamFlushBytes)
+	}
+	return nil
+}
+
+// sseFlushWriter coalesces the per-event flushes of streamed responses so at
+// most one flush goes out per interval. Events are held until the pending
+// flush fires, or flushed at once when the buffer is full. Other responses
+// pass through untouched.
+type sseFlushWriter struct {
+	gin.ResponseWriter
+	c          *gin.Context
+	interval   time.Duration
+	bufferSize int
+
+	mu        sync.Mutex
+	decided   bool
+	stream    bool
+	buf       bytes.Buffer
+	lastFlush time.Time
+	timer     *time.Timer
+	done      bool
+}
+
+// SSEFlushMiddleware coalesces text/event-stream flushes to one per interval,
+// buffering up to bufferSize bytes in between. Tokens can set their own
+// interval and buffer size; with a zero interval and no token setting every
+// event is flushed immediately.
+func SSEFlushMiddleware(interval time.Duration, bufferSize int) gin.HandlerFunc {
+	if bufferSize <= 0 {
+		bufferSize = defaultSSEWriteBuffer
+	}
+	return func(c *gin.Context) {
+		writer := &sseFlushWriter{ResponseWriter: c.Writer, c: c, interval: interval, bufferSize: bufferSize}
+		c.Writer = writer
+		c.Next()
+		writer.finish()
+	}
+}
+
+// decide picks passthrough or stream handling once the content type is
+// known. By then auth has run, so the token's flush settings replace the
+// server's; strict passthrough requests always flush every event.
+func (w *sseFlushWriter) decide() {
+	if w.decided {
+		return
+	}
+	w.decided = true
+	if interval, ok := w.c.Get(middleware.ContextKeyStreamFlushInterval); ok {
+		w.interval = interval.(time.Duration)
+	}
+	if bufferSize := w.c.GetInt(middleware.ContextKeyStreamFlushBytes); bufferSize > 0 {
+		w.bufferSize = bufferSize
+	}
+	w.stream = w.interval > 0 &&
+		strings.HasPrefix(w.Header().Get("Content-Type"), "text/event-stream") && !strictPassthrough(w.c)
+}
+
+func (w *sseFlushWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.decide()
+	if !w.stream || w.done {
+		return w.ResponseWriter.Write(p)
+	}
+	w.buf.Write(p)
+	if w.buf.Len() >= w.bufferSize {
+		if err := w.writeBuffered(); err != nil {
+			return 0, err
+		}
+		w.ResponseWriter.Flush()
+		w.lastFlush = time.Now()
+	}
+	return len(p), nil
+}
+
+func (w *sseFlushWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Written reports buffered events as written, so middleware does not send an
+// error response in the middle of a stream
+func (w *sseFlushWriter) Written() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.Len() > 0 || w.ResponseWriter.Written()
+}
+
+func (w *sseFlushWriter) Size() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	size := w.ResponseWriter.Size()
+	if w.buf.Len() > 0 {
+		size = max(size, 0) + w.buf.Len()
+	}
+	return size
+}
+
+// Flush flushes now if the last flush is at least an interval old and
+// otherwise schedules one for when it is
+func (w *sseFlushWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.decide()
+	if !w.stream || w.done {
+		w.ResponseWriter.Flush()
+		return
+	}
+	if w.timer != nil {
+		return
+	}
+	wait := w.interval - time.Since(w.lastFlush)
+	if wait <= 0 {
+		w.flushNow()
+		return
+	}
+	w.timer = time.AfterFunc(wait, func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		w.timer = nil
+		if !w.done {
+			w.flushNow()
+		}
+	})
+}
+
+// finish sends whatever is still buffered before the handler chain returns;
+// later writes go straight through
+func (w *sseFlushWriter) finish() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.done = true
+	pending := w.timer != nil
+	if pending {
+		w.timer.Stop()
+		w.timer = nil
+	}
+	if pending || w.buf.Len() > 0 {
+		w.flushNow()
+	}
+}
+
+func (w *sseFlushWriter) flushNow() {
+	if err := w.writeBuffered(); err != nil {
+		return
+	}
+	w.ResponseWriter.Flush()
+	w.lastFlush = time.Now()
+}
+
+func (w *sseFlushWriter) writeBuffered() error {
+	if w.buf.Len() == 0 {
+		return nil
+	}
+	_, err := w.ResponseWriter.Write(w.buf.Bytes())
+	w.buf.Reset()
+	return err
+}
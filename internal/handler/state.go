@@ -0,0 +1,123 @@
+package handler
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+
+	"ccproxy/internal/service"
+	"ccproxy/internal/store"
+)
+
+// StatePassphraseHeader carries the passphrase of a state bundle
+const StatePassphraseHeader = "X-State-Passphrase"
+
+// maxStateBundleSize bounds uploaded state bundles
+const maxStateBundleSize = 64 << 20
+
+// StateHandler exports and imports encrypted bundles of the instance state:
+// accounts, tokens, JWT signing keys and per-account settings
+type StateHandler struct {
+	store *store.Store
+}
+
+func NewStateHandler(store *store.Store) *StateHandler {
+	return &StateHandler{store: store}
+}
+
+// Export returns the instance state as an encrypted bundle
+func (h *StateHandler) Export(c *gin.Context) {
+	passphrase := c.GetHeader(StatePassphraseHeader)
+	if passphrase == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": StatePassphraseHeader + " header is required"})
+		return
+	}
+	if len(passphrase) < service.MinStatePassphrase {
+		c.JSON(http.StatusBadRequest, gin.H{"error": service.ErrStatePassphraseTooShort.Error()})
+		return
+	}
+
+	dump, err := h.store.ExportState()
+	if err != nil {
+		log.Error().Err(err).Msg("failed to export state")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to export state"})
+		return
+	}
+	bundle, err := service.EncryptState(dump, passphrase)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to encrypt state")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to encrypt state"})
+		return
+	}
+
+	counts := make(map[string]int, len(dump.Tables))
+	for table, state := range dump.Tables {
+		counts[table] = len(state.Rows)
+	}
+	h.audit(c, store.AuditActionStateExport, map[string]interface{}{"rows": counts})
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=ccproxy_state_%s.bin", time.Now().Format("20060102_150405")))
+	c.Data(http.StatusOK, "application/octet-stream", bundle)
+}
+
+// Import restores the instance state from an encrypted bundle sent as the
+// request body. JWT signing keys and api_key accounts are loaded at startup,
+// so the server must be restarted for those to take effect.
+func (h *StateHandler) Import(c *gin.Context) {
+	passphrase := c.GetHeader(StatePassphraseHeader)
+	if passphrase == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": StatePassphraseHeader + " header is required"})
+		return
+	}
+
+	bundle, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxStateBundleSize))
+	if err != nil {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "state bundle is too large"})
+		return
+	}
+	dump, err := service.DecryptState(bundle, passphrase)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := h.store.ImportState(dump)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to import state")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to import state: " + err.Error()})
+		return
+	}
+
+	h.audit(c, store.AuditActionStateImport, map[string]interface{}{
+		"rows":        result.Rows,
+		"exported_at": dump.ExportedAt,
+	})
+	log.Info().Interface("rows", result.Rows).Time("exported_at", dump.ExportedAt).Msg("state imported")
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":          "state imported; restart the server to load JWT keys and api_key accounts",
+		"exported_at":      dump.ExportedAt,
+		"rows":             result.Rows,
+		"skipped_columns":  result.SkippedColumns,
+		"restart_required": true,
+	})
+}
+
+func (h *StateHandler) audit(c *gin.Context, action string, details map[string]interface{}) {
+	details["client_ip"] = c.ClientIP()
+	entry := &store.AuditEntry{
+		ID:        "aud_" + uuid.New().String(),
+		CreatedAt: time.Now(),
+		Action:    action,
+		Actor:     auditActor(c),
+		Details:   details,
+	}
+	if err := h.store.CreateAuditEntry(entry); err != nil {
+		log.Error().Err(err).Str("action", action).Msg("failed to record state audit entry")
+	}
+}
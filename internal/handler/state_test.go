@@ -0,0 +1,102 @@
+package handler
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"ccproxy/internal/middleware"
+	"ccproxy/internal/store"
+)
+
+func TestStateHandler_ExportImport(t *testing.T) {
+	newRouter := func() (*gin.Engine, *store.Store) {
+		router, db := newAccountTestRouter(t)
+		h := NewStateHandler(db)
+		router.GET("/state/export", func(c *gin.Context) { c.Set(middleware.ContextKeyAdminSubject, "ops@example.com") }, h.Export)
+		router.POST("/state/import", h.Import)
+		return router, db
+	}
+	srcRouter, src := newRouter()
+	if err := src.CreateAccount(&store.Account{
+		ID:          "acc-1",
+		Name:        "one",
+		Type:        store.AccountTypeSessionKey,
+		Credentials: store.Credentials{SessionKey: "sk-ant-sid01-a"},
+		CreatedAt:   time.Now(),
+		IsActive:    true,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	do := func(router *gin.Engine, method, path, passphrase string, body []byte) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewReader(body))
+		if passphrase != "" {
+			req.Header.Set(StatePassphraseHeader, passphrase)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do(srcRouter, http.MethodGet, "/state/export", "", nil); w.Code != http.StatusBadRequest {
+		t.Errorf("export without passphrase: got %d", w.Code)
+	}
+	if w := do(srcRouter, http.MethodGet, "/state/export", "pass", nil); w.Code != http.StatusBadRequest {
+		t.Errorf("export with a short passphrase: got %d", w.Code)
+	}
+	w := do(srcRouter, http.MethodGet, "/state/export", "long random passphrase", nil)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/octet-stream" {
+		t.Fatalf("export: %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	bundle := w.Body.Bytes()
+	if bytes.Contains(bundle, []byte("sk-ant-sid01-a")) {
+		t.Fatal("bundle contains plaintext credentials")
+	}
+
+	dstRouter, dst := newRouter()
+	if w := do(dstRouter, http.MethodPost, "/state/import", "nope", bundle); w.Code != http.StatusBadRequest {
+		t.Errorf("import with wrong passphrase: got %d", w.Code)
+	}
+	if w := do(dstRouter, http.MethodPost, "/state/import", "long random passphrase", bundle); w.Code != http.StatusOK {
+		t.Fatalf("import: %d %s", w.Code, w.Body.String())
+	}
+	account, err := dst.GetAccount("acc-1")
+	if err != nil || account == nil || account.Credentials.SessionKey != "sk-ant-sid01-a" {
+		t.Errorf("imported account = %+v, %v", account, err)
+	}
+
+	for _, db := range []*store.Store{src, dst} {
+		entries, err := db.ListAuditEntries(store.AuditFilter{})
+		if err != nil || len(entries) != 1 {
+			t.Fatalf("audit entries = %v, %v", entries, err)
+		}
+	}
+	entries, _ := src.ListAuditEntries(store.AuditFilter{})
+	if entries[0].Actor != "ops@example.com" {
+		t.Errorf("export actor = %q, want the signed-in admin", entries[0].Actor)
+	}
+}
+
+func TestStateHandler_ImportRejectsGarbage(t *testing.T) {
+	db, err := store.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	router := gin.New()
+	router.POST("/state/import", NewStateHandler(db).Import)
+
+	req := httptest.NewRequest(http.MethodPost, "/state/import", bytes.NewReader([]byte("not a bundle")))
+	req.Header.Set(StatePassphraseHeader, "pass")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("got %d %s", w.Code, w.Body.String())
+	}
+}
@@ -6,11 +6,14 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"ccproxy/internal/service"
 	"ccproxy/internal/store"
 )
 
 type StatsHandler struct {
-	store *store.Store
+	store      *store.Store
+	accountMax int // Concurrency slots per account, for capacity reports
+	slo        *service.SLOTracker
 }
 
 func NewStatsHandler(store *store.Store) *StatsHandler {
@@ -19,6 +22,12 @@ func NewStatsHandler(store *store.Store) *StatsHandler {
 	}
 }
 
+// SetAccountMax sets the concurrency slots per account used to size the pool
+// in capacity reports
+func (h *StatsHandler) SetAccountMax(n int) {
+	h.accountMax = n
+}
+
 type GetStatsRequest struct {
 	FromDate string `form:"from_date"`
 	ToDate   string `form:"to_date"`
@@ -135,6 +144,44 @@ func (h *StatsHandler) GetAccountTrend(c *gin.Context) {
 	})
 }
 
+// GetAccountHealth retrieves the health score history for a specific account
+func (h *StatsHandler) GetAccountHealth(c *gin.Context) {
+	accountID := c.Param("id")
+	if accountID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "account_id is required"})
+		return
+	}
+
+	hoursStr := c.DefaultQuery("hours", "24")
+	hours, err := strconv.Atoi(hoursStr)
+	if err != nil || hours <= 0 || hours > 24*30 {
+		hours = 24
+	}
+
+	account, err := h.store.GetAccount(accountID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get account"})
+		return
+	}
+	if account == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "account not found"})
+		return
+	}
+
+	history, err := h.store.GetAccountHealthHistory(accountID, time.Now().Add(-time.Duration(hours)*time.Hour))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get account health history"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"account_id":   accountID,
+		"hours":        hours,
+		"health_score": account.HealthScore,
+		"history":      history,
+	})
+}
+
 // GetOverview retrieves global statistics overview
 func (h *StatsHandler) GetOverview(c *gin.Context) {
 	// Parse request
@@ -177,7 +224,7 @@ func (h *StatsHandler) GetRealtimeStats(c *gin.Context) {
 		WHERE DATE(request_at) = DATE('now')
 	`
 
-	row := h.store.GetDB().QueryRow(query)
+	row := h.store.GetReadDB().QueryRow(query)
 
 	var stats struct {
 		TotalRequests  int     `json:"total_requests"`
@@ -230,7 +277,7 @@ func (h *StatsHandler) GetTopTokens(c *gin.Context) {
 		LIMIT ?
 	`
 
-	rows, err := h.store.GetDB().Query(query, days, limit)
+	rows, err := h.store.GetReadDB().Query(query, days, limit)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get top tokens"})
 		return
@@ -285,7 +332,7 @@ func (h *StatsHandler) GetTopModels(c *gin.Context) {
 		ORDER BY total_requests DESC
 	`
 
-	rows, err := h.store.GetDB().Query(query, days)
+	rows, err := h.store.GetReadDB().Query(query, days)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get top models"})
 		return
@@ -318,6 +365,155 @@ func (h *StatsHandler) GetTopModels(c *gin.Context) {
 	})
 }
 
+// GetTopEndUsers retrieves the busiest end users (OpenAI user field or
+// metadata.user_id) from request logs, optionally for one token
+func (h *StatsHandler) GetTopEndUsers(c *gin.Context) {
+	h.getEndUserStats(c, c.Query("token_id"))
+}
+
+// GetTokenEndUsers aggregates a token's usage by end user
+func (h *StatsHandler) GetTokenEndUsers(c *gin.Context) {
+	h.getEndUserStats(c, c.Param("id"))
+}
+
+func (h *StatsHandler) getEndUserStats(c *gin.Context, tokenID string) {
+	limitStr := c.DefaultQuery("limit", "10")
+	limit, err := strconv.Atoi(limitStr)
+	if err != nil || limit <= 0 || limit > 100 {
+		limit = 10
+	}
+
+	daysStr := c.DefaultQuery("days", "7")
+	days, err := strconv.Atoi(daysStr)
+	if err != nil || days <= 0 || days > 365 {
+		days = 7
+	}
+
+	from := time.Now().AddDate(0, 0, -days)
+	endUsers, err := h.store.ListEndUserStats(tokenID, from, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get end user stats"})
+		return
+	}
+	if endUsers == nil {
+		endUsers = []*store.EndUserStats{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"days":      days,
+		"limit":     limit,
+		"end_users": endUsers,
+	})
+}
+
+// GetFailureCategories breaks down recent failed requests by failure
+// category, optionally for one account
+func (h *StatsHandler) GetFailureCategories(c *gin.Context) {
+	daysStr := c.DefaultQuery("days", "7")
+	days, err := strconv.Atoi(daysStr)
+	if err != nil || days <= 0 || days > 365 {
+		days = 7
+	}
+
+	from := time.Now().AddDate(0, 0, -days)
+	counts, err := h.store.GetFailureCategoryCounts(from, c.Query("account_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get failure categories"})
+		return
+	}
+	if counts == nil {
+		counts = []*store.FailureCategoryCount{}
+	}
+
+	total := 0
+	for _, count := range counts {
+		total += count.Count
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"days":       days,
+		"total":      total,
+		"categories": counts,
+	})
+}
+
+// GetAnomalies lists account usage anomalies flagged by the anomaly detector
+// in the last hours, optionally for one account
+func (h *StatsHandler) GetAnomalies(c *gin.Context) {
+	hoursStr := c.DefaultQuery("hours", "24")
+	hours, err := strconv.Atoi(hoursStr)
+	if err != nil || hours <= 0 || hours > 24*90 {
+		hours = 24
+	}
+
+	since := time.Now().Add(-time.Duration(hours) * time.Hour)
+	anomalies, err := h.store.ListAccountAnomalies(since, c.Query("account_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get anomalies"})
+		return
+	}
+	if anomalies == nil {
+		anomalies = []*store.AccountAnomaly{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"hours":     hours,
+		"total":     len(anomalies),
+		"anomalies": anomalies,
+	})
+}
+
+// GetCapacity reports hourly peak concurrency, slot wait percentiles and
+// account saturation over the last hours, and forecasts when the current pool
+// of schedulable accounts will be insufficient. Only aggregates are returned.
+func (h *StatsHandler) GetCapacity(c *gin.Context) {
+	hours, err := strconv.Atoi(c.DefaultQuery("hours", "168"))
+	if err != nil || hours <= 0 || hours > 24*90 {
+		hours = 168
+	}
+	horizonDays, err := strconv.Atoi(c.DefaultQuery("horizon_days", "30"))
+	if err != nil || horizonDays <= 0 || horizonDays > 365 {
+		horizonDays = 30
+	}
+	method := c.Query("method")
+	switch method {
+	case "", service.ForecastLinear, service.ForecastHoltWinters:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "method must be linear or holt_winters"})
+		return
+	}
+
+	accounts, err := h.store.ListAccountsWithStatus()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list accounts"})
+		return
+	}
+	schedulable := 0
+	for _, account := range accounts {
+		if account.IsSchedulable() {
+			schedulable++
+		}
+	}
+
+	// Requests started shortly before the window still count toward its concurrency
+	now := time.Now()
+	since := now.Truncate(time.Hour).Add(-time.Duration(hours-1) * time.Hour)
+	timings, err := h.store.ListRequestTimings(since.Add(-time.Hour), now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get request timings"})
+		return
+	}
+
+	c.JSON(http.StatusOK, service.BuildCapacityReport(timings, service.CapacityOptions{
+		Now:          now,
+		Hours:        hours,
+		HorizonHours: horizonDays * 24,
+		Method:       method,
+		AccountMax:   h.accountMax,
+		Accounts:     schedulable,
+	}))
+}
+
 // getDateRange parses the date range from request parameters
 func (h *StatsHandler) getDateRange(req GetStatsRequest) (time.Time, time.Time) {
 	var from, to time.Time
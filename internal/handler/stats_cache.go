@@ -0,0 +1,40 @@
+package handler
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// StatsCacheMaxAge returns the max age of a stats response for
+// middleware.HTTPCacheFunc: maxAge when the request names a range that
+// ended before yesterday, otherwise 0. Yesterday's usage is aggregated at
+// some point today, so only older ranges no longer change.
+func StatsCacheMaxAge(maxAge time.Duration) func(c *gin.Context) time.Duration {
+	return func(c *gin.Context) time.Duration {
+		if statsRangeFinal(c, time.Now()) {
+			return maxAge
+		}
+		return 0
+	}
+}
+
+// statsRangeFinal reports whether the request's explicit range, to_date or
+// to, ended before the day before now
+func statsRangeFinal(c *gin.Context, now time.Time) bool {
+	y, m, d := now.Date()
+	yesterday := time.Date(y, m, d-1, 0, 0, 0, 0, now.Location())
+
+	if c.Query("days") != "" {
+		return false
+	}
+	if value := c.Query("to_date"); value != "" {
+		day, err := time.ParseInLocation("2006-01-02", value, now.Location())
+		return err == nil && day.Before(yesterday)
+	}
+	if value := c.Query("to"); value != "" {
+		to, err := parseTimeseriesTime(value)
+		return err == nil && !to.After(yesterday)
+	}
+	return false
+}
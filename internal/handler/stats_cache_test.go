@@ -0,0 +1,35 @@
+package handler
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestStatsRangeFinal(t *testing.T) {
+	now := time.Date(2026, 10, 15, 9, 30, 0, 0, time.Local)
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{"", false},
+		{"days=7", false},
+		{"from_date=2026-10-01", false},
+		{"from_date=2026-10-01&to_date=2026-10-13", true},
+		{"from_date=2026-10-01&to_date=2026-10-14", false},
+		{"to_date=2026-10-13&days=30", false},
+		{"to_date=bogus", false},
+		{"from=2026-10-12&to=2026-10-14", true},
+		{"to=2026-10-14T12:00:00Z", false},
+		{"hours=24", false},
+	}
+	for _, tt := range tests {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest("GET", "/api/stats/overview?"+tt.query, nil)
+		if got := statsRangeFinal(c, now); got != tt.want {
+			t.Errorf("statsRangeFinal(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
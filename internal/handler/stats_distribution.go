@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"ccproxy/internal/service"
+)
+
+// distributionHours parses the hours query parameter of the distribution
+// endpoints: default 24, at most a week
+func distributionHours(c *gin.Context) int {
+	hours, err := strconv.Atoi(c.DefaultQuery("hours", "24"))
+	if err != nil || hours <= 0 || hours > 24*7 {
+		hours = 24
+	}
+	return hours
+}
+
+// GetTokenDistribution returns the distributions of one token's prompt and
+// completion tokens, request and response sizes and per-minute request rate
+// over the last hours (default 24, at most 168). distribution is null when
+// the token sent no requests in that period.
+func (h *StatsHandler) GetTokenDistribution(c *gin.Context) {
+	tokenID := c.Param("id")
+	if tokenID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "token_id is required"})
+		return
+	}
+	hours := distributionHours(c)
+
+	to := time.Now()
+	from := to.Add(-time.Duration(hours) * time.Hour)
+	sizes, err := h.store.ListRequestSizes(tokenID, from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get request sizes"})
+		return
+	}
+
+	var dist *service.TokenSizeDistribution
+	if dists := service.BuildSizeDistributions(sizes, to.Sub(from)); len(dists) > 0 {
+		dist = dists[0]
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"hours":        hours,
+		"from":         from,
+		"to":           to,
+		"distribution": dist,
+	})
+}
+
+// GetSizeDistributions ranks tokens by the p99 of a size or rate metric over
+// the last hours, to find tokens sending pathological payloads. Query
+// parameters: hours (default 24, at most 168), sort (prompt_tokens,
+// completion_tokens, request_bytes, response_bytes or requests_per_minute;
+// default prompt_tokens) and limit (default 20, at most 100).
+func (h *StatsHandler) GetSizeDistributions(c *gin.Context) {
+	hours := distributionHours(c)
+	metric := c.DefaultQuery("sort", service.SizeMetricPromptTokens)
+	if !service.ValidSizeMetric(metric) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "sort must be prompt_tokens, completion_tokens, request_bytes, response_bytes or requests_per_minute"})
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit <= 0 || limit > 100 {
+		limit = 20
+	}
+
+	to := time.Now()
+	from := to.Add(-time.Duration(hours) * time.Hour)
+	sizes, err := h.store.ListRequestSizes("", from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get request sizes"})
+		return
+	}
+
+	dists := service.BuildSizeDistributions(sizes, to.Sub(from))
+	service.SortSizeDistributions(dists, metric)
+	total := len(dists)
+	if len(dists) > limit {
+		dists = dists[:limit]
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"hours":        hours,
+		"from":         from,
+		"to":           to,
+		"sort":         metric,
+		"total_tokens": total,
+		"tokens":       dists,
+	})
+}
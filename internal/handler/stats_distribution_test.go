@@ -0,0 +1,95 @@
+package handler
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"ccproxy/internal/store"
+)
+
+func TestStatsHandler_SizeDistributions(t *testing.T) {
+	router, db := newAccountTestRouter(t)
+	h := NewStatsHandler(db)
+	router.GET("/stats/tokens/:id/distribution", h.GetTokenDistribution)
+	router.GET("/stats/distributions", h.GetSizeDistributions)
+
+	now := time.Now()
+	logRequest := func(i int, tokenID string, prompt int, requestBytes int64) {
+		t.Helper()
+		if err := db.CreateRequestLog(&store.RequestLog{
+			ID:               fmt.Sprintf("log-%d", i),
+			TokenID:          tokenID,
+			Mode:             "api",
+			Model:            "claude-sonnet-4",
+			RequestAt:        now.Add(-time.Duration(i) * time.Minute),
+			PromptTokens:     prompt,
+			CompletionTokens: 100,
+			Success:          true,
+			RequestBytes:     sql.NullInt64{Int64: requestBytes, Valid: true},
+			ResponseBytes:    sql.NullInt64{Int64: 2048, Valid: true},
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 1; i <= 5; i++ {
+		logRequest(i, "tok-small", 300, 1500)
+	}
+	logRequest(6, "tok-big", 150000, 600000)
+	logRequest(7, "tok-big", 120000, 480000)
+
+	code, resp := doJSON(t, router, http.MethodGet, "/stats/tokens/tok-small/distribution", "")
+	if code != http.StatusOK {
+		t.Fatalf("token distribution: %d %v", code, resp)
+	}
+	dist := resp["distribution"].(map[string]interface{})
+	if dist["requests"] != 5.0 {
+		t.Errorf("requests = %v", dist["requests"])
+	}
+	requestBytes := dist["request_bytes"].(map[string]interface{})
+	if requestBytes["p50"] != 1500.0 || requestBytes["samples"] != 5.0 {
+		t.Errorf("request_bytes = %v", requestBytes)
+	}
+
+	_, resp = doJSON(t, router, http.MethodGet, "/stats/tokens/tok-none/distribution", "")
+	if resp["distribution"] != nil {
+		t.Errorf("token without requests: %v", resp)
+	}
+
+	code, resp = doJSON(t, router, http.MethodGet, "/stats/distributions?sort=request_bytes&limit=1", "")
+	if code != http.StatusOK {
+		t.Fatalf("distributions: %d %v", code, resp)
+	}
+	tokens := resp["tokens"].([]interface{})
+	if len(tokens) != 1 || resp["total_tokens"] != 2.0 || tokens[0].(map[string]interface{})["token_id"] != "tok-big" {
+		t.Errorf("ranked by request_bytes: %v", resp)
+	}
+
+	if code, _ := doJSON(t, router, http.MethodGet, "/stats/distributions?sort=latency", ""); code != http.StatusBadRequest {
+		t.Errorf("unknown sort: got %d", code)
+	}
+}
+
+func TestBuildLogEntry_PayloadSizes(t *testing.T) {
+	logCtx := createRequestLogContext("tok-1", "", "", "api", "claude-sonnet-4", false, false, nil)
+	logCtx.RequestBytes = 42
+	resp := &http.Response{Body: io.NopCloser(strings.NewReader(`{"id":"msg_1"}`))}
+	trackResponseBytes(resp, logCtx)
+	if _, err := io.ReadAll(resp.Body); err != nil {
+		t.Fatal(err)
+	}
+
+	entry := buildLogEntry(logCtx)
+	if entry.Log.RequestBytes.Int64 != 42 || entry.Log.ResponseBytes.Int64 != 14 || !entry.Log.ResponseBytes.Valid {
+		t.Errorf("sizes = %v / %v", entry.Log.RequestBytes, entry.Log.ResponseBytes)
+	}
+
+	// Without a tracked response the size stays NULL
+	if entry := buildLogEntry(createRequestLogContext("tok-1", "", "", "api", "m", false, false, nil)); entry.Log.ResponseBytes.Valid {
+		t.Error("untracked response size is set")
+	}
+}
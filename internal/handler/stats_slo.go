@@ -0,0 +1,32 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"ccproxy/internal/service"
+)
+
+// SetSLOTracker sets the tracker behind the SLO report; without one the
+// report says SLOs are disabled
+func (h *StatsHandler) SetSLOTracker(t *service.SLOTracker) {
+	h.slo = t
+}
+
+// GetSLO returns the error budget consumption and burn rates of all traffic
+// and of each token over the rolling SLO window. token_id limits the tokens
+// reported; the overall figures always cover every token.
+func (h *StatsHandler) GetSLO(c *gin.Context) {
+	if h.slo == nil {
+		c.JSON(http.StatusOK, gin.H{"enabled": false})
+		return
+	}
+
+	report, err := h.slo.Report(c.Query("token_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to compute SLO report"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"enabled": true, "slo": report})
+}
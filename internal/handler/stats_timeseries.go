@@ -0,0 +1,200 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"ccproxy/internal/store"
+)
+
+// maxTimeseriesBuckets bounds the points per series, e.g. a week of 5 minute buckets
+const maxTimeseriesBuckets = 2016
+
+// Timeseries metric sets and the point fields they select
+var timeseriesMetrics = map[string][]string{
+	"requests": {"requests", "successes"},
+	"tokens":   {"prompt_tokens", "completion_tokens", "total_tokens"},
+	"errors":   {"errors", "error_rate"},
+	"latency":  {"avg_duration_ms", "avg_ttft_ms", "duration_percentiles"},
+}
+
+// timeseriesMetricOrder is the default metric selection
+var timeseriesMetricOrder = []string{"requests", "tokens", "errors", "latency"}
+
+// GetTimeseries returns usage per time bucket, optionally per token, account
+// or model. Query parameters:
+//
+//	granularity  bucket size such as 5m, 1h or 1d (default 1h)
+//	from, to     RFC 3339 times or dates; default the last hours (default 24)
+//	metrics      comma-separated requests, tokens, errors, latency (default all)
+//	group_by     token, account or model
+//	token_id, account_id, model  filters
+func (h *StatsHandler) GetTimeseries(c *gin.Context) {
+	granularity, err := parseGranularity(c.DefaultQuery("granularity", "1h"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	from, to, err := timeseriesRange(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if buckets := int(to.Sub(from)/granularity) + 1; buckets > maxTimeseriesBuckets {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("range has %d buckets of %s, at most %d are allowed", buckets, granularity, maxTimeseriesBuckets)})
+		return
+	}
+
+	metrics := timeseriesMetricOrder
+	if value := c.Query("metrics"); value != "" {
+		metrics = nil
+		for _, name := range strings.Split(value, ",") {
+			name = strings.TrimSpace(name)
+			if _, ok := timeseriesMetrics[name]; !ok {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown metric %q, expected requests, tokens, errors or latency", name)})
+				return
+			}
+			metrics = append(metrics, name)
+		}
+	}
+
+	groupBy := c.Query("group_by")
+	if !store.ValidTimeseriesGroup(groupBy) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "group_by must be token, account or model"})
+		return
+	}
+
+	series, err := h.store.GetTimeseries(store.TimeseriesQuery{
+		From:        from,
+		To:          to,
+		Granularity: granularity,
+		GroupBy:     groupBy,
+		TokenID:     c.Query("token_id"),
+		AccountID:   c.Query("account_id"),
+		Model:       c.Query("model"),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get timeseries"})
+		return
+	}
+
+	out := make([]gin.H, 0, len(series))
+	for _, s := range series {
+		points := make([]gin.H, 0, len(s.Points))
+		for _, p := range s.Points {
+			points = append(points, timeseriesPoint(p, metrics))
+		}
+		entry := gin.H{"points": points}
+		if groupBy != "" {
+			entry["group"] = s.Group
+		}
+		out = append(out, entry)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"granularity": granularity.String(),
+		"from":        from,
+		"to":          to,
+		"group_by":    groupBy,
+		"metrics":     metrics,
+		"series":      out,
+	})
+}
+
+// timeseriesPoint keeps the fields of the selected metrics
+func timeseriesPoint(p *store.TimeseriesPoint, metrics []string) gin.H {
+	all := map[string]interface{}{
+		"requests":             p.Requests,
+		"successes":            p.Successes,
+		"prompt_tokens":        p.PromptTokens,
+		"completion_tokens":    p.CompletionTokens,
+		"total_tokens":         p.TotalTokens,
+		"errors":               p.Errors,
+		"error_rate":           0.0,
+		"avg_duration_ms":      p.AvgDurationMs,
+		"avg_ttft_ms":          p.AvgTTFTMs,
+		"duration_percentiles": p.Duration,
+	}
+	if p.Requests > 0 {
+		all["error_rate"] = float64(p.Errors) / float64(p.Requests)
+	}
+
+	point := gin.H{"time": p.Time}
+	for _, metric := range metrics {
+		for _, field := range timeseriesMetrics[metric] {
+			point[field] = all[field]
+		}
+	}
+	return point
+}
+
+// parseGranularity parses a bucket size: a Go duration or a number of days
+// such as "1d", in whole minutes
+func parseGranularity(value string) (time.Duration, error) {
+	var d time.Duration
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("invalid granularity %q", value)
+		}
+		d = time.Duration(n) * 24 * time.Hour
+	} else {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return 0, fmt.Errorf("invalid granularity %q", value)
+		}
+		d = parsed
+	}
+	if d < time.Minute || d%time.Minute != 0 {
+		return 0, fmt.Errorf("granularity must be a whole number of minutes")
+	}
+	return d, nil
+}
+
+// timeseriesRange parses from and to, defaulting to the last hours
+func timeseriesRange(c *gin.Context) (time.Time, time.Time, error) {
+	to := time.Now()
+	if value := c.Query("to"); value != "" {
+		t, err := parseTimeseriesTime(value)
+		if err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+		to = t
+	}
+
+	var from time.Time
+	if value := c.Query("from"); value != "" {
+		t, err := parseTimeseriesTime(value)
+		if err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+		from = t
+	} else {
+		hours, err := strconv.Atoi(c.DefaultQuery("hours", "24"))
+		if err != nil || hours <= 0 {
+			return time.Time{}, time.Time{}, fmt.Errorf("hours must be a positive number")
+		}
+		from = to.Add(-time.Duration(hours) * time.Hour)
+	}
+
+	if !from.Before(to) {
+		return time.Time{}, time.Time{}, fmt.Errorf("from must be before to")
+	}
+	return from, to, nil
+}
+
+func parseTimeseriesTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q, expected RFC 3339 or YYYY-MM-DD", value)
+}
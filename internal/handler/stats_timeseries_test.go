@@ -0,0 +1,119 @@
+package handler
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"ccproxy/internal/service"
+	"ccproxy/internal/store"
+)
+
+func TestStatsHandler_GetTimeseries(t *testing.T) {
+	router, db := newAccountTestRouter(t)
+	router.GET("/stats/timeseries", NewStatsHandler(db).GetTimeseries)
+
+	logRequest := func(i int, model string, at time.Time, success bool) {
+		t.Helper()
+		if err := db.CreateRequestLog(&store.RequestLog{
+			ID:          fmt.Sprintf("log-%d", i),
+			TokenID:     "tok-1",
+			AccountID:   sql.NullString{String: "acc-1", Valid: true},
+			Mode:        "api",
+			Model:       model,
+			RequestAt:   at,
+			DurationMs:  sql.NullInt64{Int64: 1000, Valid: true},
+			TotalTokens: 10,
+			Success:     success,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Three requests in one 5 minute bucket, one in the next
+	start := time.Now().UTC().Truncate(time.Hour).Add(-2 * time.Hour)
+	logRequest(1, "claude-sonnet-4", start.Add(time.Minute), true)
+	logRequest(2, "claude-sonnet-4", start.Add(2*time.Minute), false)
+	logRequest(3, "claude-opus-4", start.Add(3*time.Minute), true)
+	logRequest(4, "claude-opus-4", start.Add(6*time.Minute), true)
+
+	query := url.Values{
+		"granularity": {"5m"},
+		"from":        {start.Format(time.RFC3339)},
+		"to":          {start.Add(time.Hour).Format(time.RFC3339)},
+		"metrics":     {"requests,errors"},
+		"group_by":    {"model"},
+	}
+	code, resp := doJSON(t, router, http.MethodGet, "/stats/timeseries?"+query.Encode(), "")
+	if code != http.StatusOK {
+		t.Fatalf("timeseries: %d %v", code, resp)
+	}
+	series := resp["series"].([]interface{})
+	if len(series) != 2 {
+		t.Fatalf("series = %v", series)
+	}
+	opus := series[0].(map[string]interface{})
+	if opus["group"] != "claude-opus-4" {
+		t.Fatalf("first series = %v", opus["group"])
+	}
+	points := opus["points"].([]interface{})
+	if len(points) != 12 {
+		t.Fatalf("got %d points, want 12", len(points))
+	}
+	first := points[0].(map[string]interface{})
+	if first["requests"] != 1.0 || points[1].(map[string]interface{})["requests"] != 1.0 || points[2].(map[string]interface{})["requests"] != 0.0 {
+		t.Errorf("opus points = %v", points[:3])
+	}
+	if _, ok := first["total_tokens"]; ok {
+		t.Error("unselected metric in point")
+	}
+	sonnet := series[1].(map[string]interface{})["points"].([]interface{})[0].(map[string]interface{})
+	if sonnet["requests"] != 2.0 || sonnet["errors"] != 1.0 || sonnet["error_rate"] != 0.5 {
+		t.Errorf("sonnet point = %v", sonnet)
+	}
+
+	// Whole days before today come from the daily stats
+	old := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, -3).Add(12 * time.Hour)
+	logRequest(5, "claude-sonnet-4", old, true)
+	if err := service.NewStatsAggregator(db, time.Hour).AggregateDate(old); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.DeleteOldRequestLogs(2); err != nil {
+		t.Fatal(err)
+	}
+	query = url.Values{
+		"granularity": {"1d"},
+		"from":        {old.AddDate(0, 0, -1).Format(time.RFC3339)},
+		"to":          {old.AddDate(0, 0, 2).Format(time.RFC3339)},
+		"metrics":     {"tokens"},
+	}
+	code, resp = doJSON(t, router, http.MethodGet, "/stats/timeseries?"+query.Encode(), "")
+	if code != http.StatusOK {
+		t.Fatalf("daily timeseries: %d %v", code, resp)
+	}
+	var requests, tokens float64
+	for _, p := range resp["series"].([]interface{})[0].(map[string]interface{})["points"].([]interface{}) {
+		tokens += p.(map[string]interface{})["total_tokens"].(float64)
+		if n, ok := p.(map[string]interface{})["requests"]; ok {
+			requests += n.(float64)
+		}
+	}
+	if tokens != 10 || requests != 0 {
+		t.Errorf("daily totals: %v tokens, %v requests", tokens, requests)
+	}
+
+	for _, bad := range []string{
+		"granularity=30s",
+		"granularity=fast",
+		"group_by=user",
+		"metrics=requests,cost",
+		"granularity=1m&hours=720",
+	} {
+		if code, _ := doJSON(t, router, http.MethodGet, "/stats/timeseries?"+bad, ""); code != http.StatusBadRequest {
+			t.Errorf("%s: got %d, want 400", bad, code)
+		}
+	}
+}
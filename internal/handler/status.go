@@ -0,0 +1,143 @@
+package handler
+
+import (
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+
+	"ccproxy/internal/store"
+)
+
+// StatusHandler serves a lightweight instance status page
+type StatusHandler struct {
+	store     *store.Store
+	version   string
+	startedAt time.Time
+}
+
+func NewStatusHandler(st *store.Store, version string) *StatusHandler {
+	return &StatusHandler{
+		store:     st,
+		version:   version,
+		startedAt: time.Now(),
+	}
+}
+
+// StatusSummary is the status page payload
+type StatusSummary struct {
+	Status              string    `json:"status"` // "ok", "degraded" or "down"
+	Version             string    `json:"version"`
+	StartedAt           time.Time `json:"started_at"`
+	Uptime              string    `json:"uptime"`
+	UptimeSeconds       int64     `json:"uptime_seconds"`
+	TotalAccounts       int       `json:"total_accounts"`
+	SchedulableAccounts int       `json:"schedulable_accounts"`
+	RequestsLastHour    int       `json:"requests_last_hour"`
+	ErrorsLastHour      int       `json:"errors_last_hour"`
+	ErrorRate           float64   `json:"error_rate"` // 0-1 over the last hour
+}
+
+// degradedErrorRate is the hourly error rate above which the instance reports "degraded"
+const degradedErrorRate = 0.2
+
+var statusPageTemplate = template.Must(template.New("status").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="30">
+<title>ccproxy status</title>
+<style>
+body { font-family: -apple-system, sans-serif; margin: 2rem; color: #222; }
+table { border-collapse: collapse; }
+td { padding: 0.3rem 1rem 0.3rem 0; }
+.ok { color: #1a7f37; } .degraded { color: #9a6700; } .down { color: #cf222e; }
+</style>
+</head>
+<body>
+<h1>ccproxy <span class="{{.Status}}">{{.Status}}</span></h1>
+<table>
+<tr><td>Version</td><td>{{.Version}}</td></tr>
+<tr><td>Uptime</td><td>{{.Uptime}}</td></tr>
+<tr><td>Schedulable accounts</td><td>{{.SchedulableAccounts}} / {{.TotalAccounts}}</td></tr>
+<tr><td>Requests (last hour)</td><td>{{.RequestsLastHour}}</td></tr>
+<tr><td>Errors (last hour)</td><td>{{.ErrorsLastHour}} ({{printf "%.1f" .ErrorRatePercent}}%)</td></tr>
+</table>
+</body>
+</html>
+`))
+
+// GetStatus returns the status summary as HTML for browsers and JSON otherwise.
+// Use ?format=json or ?format=html to force a format.
+func (h *StatusHandler) GetStatus(c *gin.Context) {
+	summary, err := h.buildSummary()
+	if err != nil {
+		log.Error().Err(err).Msg("failed to build status summary")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to build status summary"})
+		return
+	}
+
+	format := c.Query("format")
+	if format == "" && strings.Contains(c.GetHeader("Accept"), "text/html") {
+		format = "html"
+	}
+
+	if format != "html" {
+		c.JSON(http.StatusOK, summary)
+		return
+	}
+
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Status(http.StatusOK)
+	if err := statusPageTemplate.Execute(c.Writer, struct {
+		*StatusSummary
+		ErrorRatePercent float64
+	}{summary, summary.ErrorRate * 100}); err != nil {
+		log.Error().Err(err).Msg("failed to render status page")
+	}
+}
+
+func (h *StatusHandler) buildSummary() (*StatusSummary, error) {
+	uptime := time.Since(h.startedAt)
+	summary := &StatusSummary{
+		Status:        "ok",
+		Version:       h.version,
+		StartedAt:     h.startedAt,
+		Uptime:        uptime.Truncate(time.Second).String(),
+		UptimeSeconds: int64(uptime.Seconds()),
+	}
+
+	accounts, err := h.store.ListAccounts()
+	if err != nil {
+		return nil, err
+	}
+	summary.TotalAccounts = len(accounts)
+
+	schedulable, err := h.store.GetSchedulableAccounts()
+	if err != nil {
+		return nil, err
+	}
+	summary.SchedulableAccounts = len(schedulable)
+
+	requests, err := h.store.GetRequestSummary(time.Now().Add(-1 * time.Hour))
+	if err != nil {
+		return nil, err
+	}
+	summary.RequestsLastHour = requests.TotalRequests
+	summary.ErrorsLastHour = requests.FailedRequests
+	if requests.TotalRequests > 0 {
+		summary.ErrorRate = float64(requests.FailedRequests) / float64(requests.TotalRequests)
+	}
+
+	switch {
+	case summary.SchedulableAccounts == 0:
+		summary.Status = "down"
+	case summary.ErrorRate > degradedErrorRate:
+		summary.Status = "degraded"
+	}
+
+	return summary, nil
+}
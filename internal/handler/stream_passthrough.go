@@ -0,0 +1,40 @@
+package handler
+
+import (
+	"io"
+
+	"github.com/gin-gonic/gin"
+
+	"ccproxy/internal/flags"
+)
+
+// streamCopyBufferSize is the largest chunk copyStream writes at once
+const streamCopyBufferSize = 32 * 1024
+
+// copyStream copies an upstream body to the client unchanged, flushing after
+// every read so stream events such as ping and input_json_delta go out as
+// soon as they arrive instead of waiting for the server's write buffer to fill
+func copyStream(w gin.ResponseWriter, body io.Reader) error {
+	buf := make([]byte, streamCopyBufferSize)
+	for {
+		n, err := body.Read(buf)
+		if n > 0 {
+			if _, werr := w.Write(buf[:n]); werr != nil {
+				return werr
+			}
+			w.Flush()
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// strictPassthrough reports whether the request asked for its body to be
+// forwarded byte-exact, which turns off response rewriting middleware
+func strictPassthrough(c *gin.Context) bool {
+	return flags.Enabled(c.Request.Context(), flags.StrictPassthrough)
+}
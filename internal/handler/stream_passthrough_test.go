@@ -0,0 +1,211 @@
+package handler
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"ccproxy/internal/flags"
+	"ccproxy/internal/loadbalancer"
+	"ccproxy/internal/middleware"
+	"ccproxy/internal/store"
+)
+
+// Anthropic Messages streams covering every event type clients depend on.
+// Spacing and key order differ from what encoding/json produces on purpose,
+// so any re-encoding shows up as a mismatch.
+var conformanceStreams = map[string][]string{
+	"tool_use": {
+		"event: message_start\ndata: {\"type\":\"message_start\",\"message\":{\"id\":\"msg_01\",\"type\":\"message\",\"role\":\"assistant\",\"model\":\"claude-sonnet-4-20250514\",\"content\":[],\"stop_reason\":null,\"usage\":{\"input_tokens\":25,\"output_tokens\":1}}}\n\n",
+		"event: ping\ndata: {\"type\": \"ping\"}\n\n",
+		"event: content_block_start\ndata: {\"type\":\"content_block_start\",\"index\":0,\"content_block\":{\"type\":\"tool_use\",\"id\":\"toolu_01\",\"name\":\"get_weather\",\"input\":{}}}\n\n",
+		"event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"input_json_delta\",\"partial_json\":\"\"}}\n\n",
+		"event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"input_json_delta\",\"partial_json\":\"{\\\"location\\\": \\\"Par\"}}\n\n",
+		"event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"input_json_delta\",\"partial_json\":\"is\\\"}\"}}\n\n",
+		"event: content_block_stop\ndata: {\"type\":\"content_block_stop\",\"index\":0}\n\n",
+		"event: message_delta\ndata: {\"type\":\"message_delta\",\"delta\":{\"stop_reason\":\"tool_use\",\"stop_sequence\":null},\"usage\":{\"output_tokens\":40}}\n\n",
+		"event: message_stop\ndata: {\"type\":\"message_stop\"}\n\n",
+	},
+	"thinking": {
+		"event: message_start\ndata: {\"type\":\"message_start\",\"message\":{\"id\":\"msg_02\",\"type\":\"message\",\"role\":\"assistant\",\"content\":[],\"usage\":{\"input_tokens\":12,\"output_tokens\":1}}}\n\n",
+		"event: content_block_start\ndata: {\"type\":\"content_block_start\",\"index\":0,\"content_block\":{\"type\":\"thinking\",\"thinking\":\"\"}}\n\n",
+		"event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"thinking_delta\",\"thinking\":\"Let me add 2 and 2.\"}}\n\n",
+		"event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"signature_delta\",\"signature\":\"EqQBCgIYAhIM1gbcDa9GJwZA2b3hGgxBdjrkzLoky3dl1pkiMOYds==\"}}\n\n",
+		"event: content_block_stop\ndata: {\"type\":\"content_block_stop\",\"index\":0}\n\n",
+		"event: ping\ndata: {\"type\": \"ping\"}\n\n",
+		"event: content_block_start\ndata: {\"type\":\"content_block_start\",\"index\":1,\"content_block\":{\"type\":\"text\",\"text\":\"\"}}\n\n",
+		"event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":1,\"delta\":{\"type\":\"text_delta\",\"text\":\"4 \\u2014 done.\"}}\n\n",
+		"event: content_block_stop\ndata: {\"type\":\"content_block_stop\",\"index\":1}\n\n",
+		"event: message_delta\ndata: {\"type\":\"message_delta\",\"delta\":{\"stop_reason\":\"end_turn\",\"stop_sequence\":null},\"usage\":{\"output_tokens\":30}}\n\n",
+		"event: message_stop\ndata: {\"type\":\"message_stop\"}\n\n",
+	},
+	"error": {
+		"event: message_start\ndata: {\"type\":\"message_start\",\"message\":{\"id\":\"msg_03\",\"type\":\"message\",\"role\":\"assistant\",\"content\":[],\"usage\":{\"input_tokens\":8,\"output_tokens\":1}}}\n\n",
+		"event: ping\ndata: {\"type\": \"ping\"}\n\n",
+		"event: error\ndata: {\"type\": \"error\", \"error\": {\"type\": \"overloaded_error\", \"message\": \"Overloaded\"}}\n\n",
+	},
+}
+
+// passthroughRouter wires the /v1/messages middleware chain the way the
+// server does, for a token with a response footer that may override flags
+func passthroughRouter(t *testing.T, upstreamURL string, flushInterval time.Duration) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	db, err := store.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	h := NewEnhancedProxyHandler(EnhancedProxyConfig{
+		Store:   db,
+		KeyPool: loadbalancer.NewKeyPool([]string{"sk-ant-REDACTED"}, loadbalancer.StrategyRoundRobin),
+		APIURL:  upstreamURL,
+	})
+	router := gin.New()
+	router.Use(SSEFlushMiddleware(flushInterval, 0))
+	router.Use(func(c *gin.Context) {
+		c.Set(middleware.ContextKeyTokenID, "token-1")
+		c.Set(middleware.ContextKeyAllowFlagOverrides, true)
+		c.Set(middleware.ContextKeyResponseFooter, "-- sent via ccproxy")
+	})
+	router.Use(FeatureFlagsMiddleware(flags.NewEvaluator(nil), nil))
+	router.POST("/v1/messages", ResponseFooterMiddleware(), h.Messages)
+	return router
+}
+
+func passthroughRequest(body, flagHeader string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Proxy-Mode", "api")
+	if flagHeader != "" {
+		req.Header.Set(flags.Header, flagHeader)
+	}
+	return req
+}
+
+func TestMessagesAPI_StrictPassthroughConformance(t *testing.T) {
+	for name, events := range conformanceStreams {
+		t.Run(name, func(t *testing.T) {
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/event-stream")
+				for _, event := range events {
+					io.WriteString(w, event)
+					w.(http.Flusher).Flush()
+				}
+			}))
+			defer upstream.Close()
+			want := strings.Join(events, "")
+			request := `{"model":"claude-sonnet-4-20250514","max_tokens":100,"stream":true,"messages":[{"role":"user","content":"hi"}]}`
+
+			// Strict passthrough skips the footer and flush coalescing
+			w := httptest.NewRecorder()
+			passthroughRouter(t, upstream.URL, 20*time.Millisecond).ServeHTTP(w, passthroughRequest(request, "strict_passthrough"))
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body %s", w.Code, w.Body.String())
+			}
+			if got := w.Body.String(); got != want {
+				t.Errorf("strict passthrough changed the stream:\ngot  %q\nwant %q", got, want)
+			}
+
+			// Without it the footer is injected before message_delta, unless
+			// the response ends in a tool call
+			w = httptest.NewRecorder()
+			passthroughRouter(t, upstream.URL, 0).ServeHTTP(w, passthroughRequest(request, ""))
+			footed := strings.Contains(w.Body.String(), "sent via ccproxy")
+			if footed != (name == "thinking") {
+				t.Errorf("footer injected = %v", footed)
+			}
+		})
+	}
+}
+
+func TestMessagesAPI_StrictPassthroughRequestBody(t *testing.T) {
+	received := make(chan string, 1)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- string(body)
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"type":"message","content":[]}`)
+	}))
+	defer upstream.Close()
+
+	// A field the proxy does not model and unusual formatting
+	body := "{\"max_tokens\": 100, \"model\": \"claude-sonnet-4-20250514\",\n \"messages\": [{\"role\": \"user\", \"content\": \"hi\"}], \"future_option\": {\"x\": 1}}"
+
+	w := httptest.NewRecorder()
+	passthroughRouter(t, upstream.URL, 0).ServeHTTP(w, passthroughRequest(body, "strict_passthrough"))
+	if got := <-received; got != body {
+		t.Errorf("upstream body = %q, want %q", got, body)
+	}
+
+	w = httptest.NewRecorder()
+	passthroughRouter(t, upstream.URL, 0).ServeHTTP(w, passthroughRequest(body, ""))
+	if got := <-received; strings.Contains(got, "future_option") {
+		t.Errorf("re-encoded body kept unknown field: %q", got)
+	}
+}
+
+func TestMessagesAPI_StreamFlushesEachEvent(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		interval time.Duration
+		flags    string
+	}{
+		{"default", 0, ""},
+		{"strict with coalescing configured", time.Hour, "strict_passthrough"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			release := make(chan struct{})
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/event-stream")
+				io.WriteString(w, "event: ping\ndata: {\"type\": \"ping\"}\n\n")
+				w.(http.Flusher).Flush()
+				// The rest only comes once the client saw the ping
+				<-release
+				io.WriteString(w, "event: message_stop\ndata: {\"type\":\"message_stop\"}\n\n")
+			}))
+			defer upstream.Close()
+			proxy := httptest.NewServer(passthroughRouter(t, upstream.URL, tc.interval))
+			defer proxy.Close()
+			// Runs first, so the servers can shut down even when the test fails
+			defer close(release)
+
+			req, _ := http.NewRequest(http.MethodPost, proxy.URL+"/v1/messages",
+				strings.NewReader(`{"model":"claude-sonnet-4-20250514","max_tokens":10,"stream":true,"messages":[{"role":"user","content":"hi"}]}`))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("X-Proxy-Mode", "api")
+			if tc.flags != "" {
+				req.Header.Set(flags.Header, tc.flags)
+			}
+
+			lines := make(chan string, 1)
+			go func() {
+				resp, err := http.DefaultClient.Do(req)
+				if err != nil {
+					lines <- err.Error()
+					return
+				}
+				defer resp.Body.Close()
+				line, _ := bufio.NewReader(resp.Body).ReadString('\n')
+				lines <- line
+			}()
+
+			select {
+			case line := <-lines:
+				if line != "event: ping\n" {
+					t.Errorf("first line = %q", line)
+				}
+			case <-time.After(2 * time.Second):
+				t.Error("ping was held back by the proxy")
+			}
+		})
+	}
+}
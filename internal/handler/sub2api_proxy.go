@@ -2,40 +2,83 @@ package handler
 
 import (
 	"bytes"
-	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
-	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
 	"github.com/rs/zerolog/log"
 
+	"ccproxy/internal/flags"
+	"ccproxy/internal/middleware"
+	"ccproxy/internal/pool"
 	"ccproxy/internal/service"
 	"ccproxy/internal/store"
+	"ccproxy/internal/upstream"
 )
 
-// Sub2APIProxyHandler handles proxy requests with sub2api-style account selection
+// countTokensTimeout bounds upstream count_tokens requests
+const countTokensTimeout = 30 * time.Second
+
+// Sub2APIProxyHandler serves count_tokens and cost estimates with sub2api-style
+// account selection; chat completions go through the enhanced pipeline
 type Sub2APIProxyHandler struct {
-	store           *store.Store
-	webURL          string
-	errorClassifier *ErrorClassifier
-	oauthService    *service.OAuthService // For token refresh (matches sub2api's ClaudeTokenProvider)
+	store         *store.Store
+	oauthService  *service.OAuthService // For token refresh (matches sub2api's ClaudeTokenProvider)
+	countCache    *CountTokensCache     // Optional count_tokens response cache
+	betaHeaders   *service.BetaHeaders  // anthropic-beta profiles; nil uses the defaults
+	costEstimator *service.CostEnricher // Prices cost estimates; nil uses the default prices
+	defaultModel  string                // Model of requests naming none, after the token's default
+	sampler       *upstream.Sampler     // Records upstream exchanges for debugging; nil disables
+	fingerprints  *pool.Fingerprints    // TLS fingerprint per account; nil uses Go's default
 }
 
 // NewSub2APIProxyHandler creates a new sub2api-style proxy handler
-func NewSub2APIProxyHandler(st *store.Store, webURL string, oauthService *service.OAuthService) *Sub2APIProxyHandler {
+func NewSub2APIProxyHandler(st *store.Store, oauthService *service.OAuthService) *Sub2APIProxyHandler {
 	return &Sub2APIProxyHandler{
-		store:           st,
-		webURL:          webURL,
-		errorClassifier: NewErrorClassifier(st),
-		oauthService:    oauthService,
+		store:        st,
+		oauthService: oauthService,
 	}
 }
 
+// SetCountTokensCache enables caching of count_tokens responses
+func (h *Sub2APIProxyHandler) SetCountTokensCache(cache *CountTokensCache) {
+	h.countCache = cache
+}
+
+// SetBetaHeaders sets the anthropic-beta header profiles
+func (h *Sub2APIProxyHandler) SetBetaHeaders(beta *service.BetaHeaders) {
+	h.betaHeaders = beta
+}
+
+// SetCostEstimator sets the price table used by cost estimates
+func (h *Sub2APIProxyHandler) SetCostEstimator(estimator *service.CostEnricher) {
+	h.costEstimator = estimator
+}
+
+// SetUpstreamSampler records the handler's upstream exchanges per account
+func (h *Sub2APIProxyHandler) SetUpstreamSampler(sampler *upstream.Sampler) {
+	h.sampler = sampler
+}
+
+// SetFingerprints presents each account's TLS fingerprint profile upstream
+func (h *Sub2APIProxyHandler) SetFingerprints(f *pool.Fingerprints) {
+	h.fingerprints = f
+}
+
+// upstreamClient returns a client for requests made on behalf of an account
+func (h *Sub2APIProxyHandler) upstreamClient(accountID string, timeout time.Duration) *http.Client {
+	return &http.Client{Timeout: timeout, Transport: h.sampler.Transport(accountID, h.fingerprints.Transport(accountID))}
+}
+
+// SetDefaultModel sets the model used for requests without one when the
+// token has no default model
+func (h *Sub2APIProxyHandler) SetDefaultModel(model string) {
+	h.defaultModel = model
+}
+
 // getValidAccessToken gets a valid access token for OAuth account, refreshing if needed
 // Matches sub2api's ClaudeTokenProvider.GetAccessToken behavior
 func (h *Sub2APIProxyHandler) getValidAccessToken(account *store.Account) (string, error) {
@@ -70,312 +113,31 @@ func (h *Sub2APIProxyHandler) getValidAccessToken(account *store.Account) (strin
 	return account.Credentials.AccessToken, nil
 }
 
-// ChatCompletions handles OpenAI-compatible chat completion requests
-func (h *Sub2APIProxyHandler) ChatCompletions(c *gin.Context) {
-	var req OpenAIChatRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+// CountTokens handles the count_tokens endpoint using Anthropic API
+func (h *Sub2APIProxyHandler) CountTokens(c *gin.Context) {
+	// Read request body
+	bodyBytes, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		h.countTokensError(c, http.StatusBadRequest, "invalid_request_error", "Failed to read request body")
 		return
 	}
 
-	if len(req.Messages) == 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "messages cannot be empty"})
+	if len(bodyBytes) == 0 {
+		h.countTokensError(c, http.StatusBadRequest, "invalid_request_error", "Request body is empty")
 		return
 	}
 
-	ctx := c.Request.Context()
-
-	// Select account with retry logic (sub2api style)
-	maxRetries := 3
-	var excludedAccountIDs []string
-
-	for attempt := 0; attempt < maxRetries; attempt++ {
-		// Get schedulable accounts
-		accounts, err := h.store.GetSchedulableAccounts()
-		if err != nil {
-			log.Error().Err(err).Msg("failed to get schedulable accounts")
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to query accounts"})
-			return
-		}
-
-		// Filter out excluded accounts
-		var availableAccounts []*store.Account
-		for _, acc := range accounts {
-			excluded := false
-			for _, exID := range excludedAccountIDs {
-				if acc.ID == exID {
-					excluded = true
-					break
-				}
-			}
-			if !excluded && acc.IsSchedulable() {
-				availableAccounts = append(availableAccounts, acc)
-			}
-		}
-
-		if len(availableAccounts) == 0 {
-			log.Warn().
-				Int("attempt", attempt+1).
-				Int("excluded", len(excludedAccountIDs)).
-				Msg("no schedulable accounts available")
-			c.JSON(http.StatusServiceUnavailable, gin.H{
-				"error":   "no available accounts",
-				"details": fmt.Sprintf("excluded=%d, attempt=%d/%d", len(excludedAccountIDs), attempt+1, maxRetries),
-			})
-			return
-		}
-
-		// Select best account (lowest priority, least recently used)
-		account := selectBestAccount(availableAccounts)
-
-		log.Info().
-			Str("account_id", account.ID).
-			Str("account_name", account.Name).
-			Int("attempt", attempt+1).
-			Int("available", len(availableAccounts)).
-			Msg("selected account for request")
-
-		// Execute request
-		resp, err := h.executeWebRequest(ctx, account, &req)
-
-		// Handle errors
-		if err != nil {
-			log.Error().
-				Err(err).
-				Str("account_id", account.ID).
-				Int("attempt", attempt+1).
-				Msg("request execution failed")
-
-			// Classify error and update account status
-			shouldSwitch := h.errorClassifier.ClassifyAndHandleError(nil, account.ID)
-
-			if shouldSwitch && attempt < maxRetries-1 {
-				excludedAccountIDs = append(excludedAccountIDs, account.ID)
-				log.Info().Str("account_id", account.ID).Msg("switching to next account")
-				continue
-			}
-
-			c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+	// Serve repeated requests from cache
+	var cacheKey string
+	if h.countCache != nil && flags.Enabled(c.Request.Context(), flags.CountTokensCache) {
+		cacheKey = countTokensCacheKey(bodyBytes, c.GetHeader("anthropic-beta"))
+		if cached, ok := h.countCache.Get(cacheKey); ok {
+			c.Header("X-Cache", "HIT")
+			c.Data(http.StatusOK, "application/json", cached)
 			return
 		}
-
-		// Check response status
-		if resp.StatusCode >= 400 {
-			// Error response, classify and handle
-			shouldSwitch := h.errorClassifier.ClassifyAndHandleError(resp, account.ID)
-
-			// For non-success responses, read body and return
-			if resp.StatusCode >= 400 {
-				body, _ := io.ReadAll(resp.Body)
-				resp.Body.Close()
-
-				// If should switch and we have retries left, try next account
-				if shouldSwitch && attempt < maxRetries-1 && (resp.StatusCode == 429 || resp.StatusCode == 401 || resp.StatusCode == 403 || resp.StatusCode == 503) {
-					excludedAccountIDs = append(excludedAccountIDs, account.ID)
-					log.Info().
-						Str("account_id", account.ID).
-						Int("status_code", resp.StatusCode).
-						Msg("switching account due to error")
-					continue
-				}
-
-				// Return error to client
-				c.Data(resp.StatusCode, resp.Header.Get("Content-Type"), body)
-				return
-			}
-		}
-
-		// Success! Record it
-		h.errorClassifier.RecordSuccess(account.ID)
-		go h.store.UpdateAccountLastUsed(account.ID)
-
-		// Stream or return response
-		if req.Stream {
-			h.streamResponse(c, resp, account.ID)
-		} else {
-			h.returnResponse(c, resp)
-		}
-		return
-	}
-
-	// All retries exhausted
-	c.JSON(http.StatusServiceUnavailable, gin.H{
-		"error": "all retry attempts exhausted",
-	})
-}
-
-// selectBestAccount selects the best account from available accounts
-// Priority: lower priority value > least recently used
-func selectBestAccount(accounts []*store.Account) *store.Account {
-	if len(accounts) == 0 {
-		return nil
-	}
-
-	best := accounts[0]
-	for _, acc := range accounts[1:] {
-		// Lower priority number = higher priority
-		if acc.Priority < best.Priority {
-			best = acc
-			continue
-		}
-
-		// Same priority, prefer least recently used
-		if acc.Priority == best.Priority {
-			if acc.LastUsedAt == nil {
-				best = acc // Never used is best
-			} else if best.LastUsedAt != nil && acc.LastUsedAt.Before(*best.LastUsedAt) {
-				best = acc
-			}
-		}
-	}
-
-	return best
-}
-
-// executeWebRequest executes a request to claude.ai
-func (h *Sub2APIProxyHandler) executeWebRequest(ctx context.Context, account *store.Account, req *OpenAIChatRequest) (*http.Response, error) {
-	// Get valid access token for OAuth accounts (auto-refresh if needed)
-	var accessToken string
-	if account.IsOAuth() {
-		var err error
-		accessToken, err = h.getValidAccessToken(account)
-		if err != nil {
-			return nil, fmt.Errorf("failed to get valid access token: %w", err)
-		}
-	}
-
-	// Build prompt from messages
-	prompt := buildPromptFromMessages(req.Messages)
-
-	// Create conversation
-	convUUID := uuid.New().String()
-	createPayload := map[string]interface{}{
-		"uuid": convUUID,
-		"name": "",
-	}
-	createPayloadBytes, _ := json.Marshal(createPayload)
-
-	createURL := fmt.Sprintf("%s/api/organizations/%s/chat_conversations", h.webURL, account.OrganizationID)
-	createReq, _ := http.NewRequestWithContext(ctx, "POST", createURL, bytes.NewReader(createPayloadBytes))
-	setWebHeaders(createReq, account, h.webURL, accessToken)
-	createReq.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{Timeout: 30 * time.Second}
-	createResp, err := client.Do(createReq)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create conversation: %w", err)
-	}
-	defer createResp.Body.Close()
-
-	if createResp.StatusCode != http.StatusOK && createResp.StatusCode != http.StatusCreated {
-		body, _ := io.ReadAll(createResp.Body)
-		return createResp, fmt.Errorf("failed to create conversation: %s", string(body))
-	}
-
-	// Send message
-	msgPayload := map[string]interface{}{
-		"prompt":      prompt,
-		"timezone":    "UTC",
-		"attachments": []any{},
-		"files":       []any{},
-	}
-	msgPayloadBytes, _ := json.Marshal(msgPayload)
-
-	msgURL := fmt.Sprintf("%s/api/organizations/%s/chat_conversations/%s/completion",
-		h.webURL, account.OrganizationID, convUUID)
-	msgReq, _ := http.NewRequestWithContext(ctx, "POST", msgURL, bytes.NewReader(msgPayloadBytes))
-	setWebHeaders(msgReq, account, h.webURL, accessToken)
-	msgReq.Header.Set("Content-Type", "application/json")
-	msgReq.Header.Set("Accept", "text/event-stream")
-
-	msgResp, err := client.Do(msgReq)
-	if err != nil {
-		return nil, fmt.Errorf("failed to send message: %w", err)
-	}
-
-	return msgResp, nil
-}
-
-// setWebHeaders sets request headers for claude.ai requests
-// accessToken parameter is used for OAuth accounts (empty for session_key accounts)
-func setWebHeaders(r *http.Request, account *store.Account, webURL string, accessToken string) {
-	// Modern browser Client Hints
-	r.Header.Set("Sec-Ch-Ua", `"Chromium";v="131", "Not_A Brand";v="24"`)
-	r.Header.Set("Sec-Ch-Ua-Mobile", "?0")
-	r.Header.Set("Sec-Ch-Ua-Platform", `"macOS"`)
-
-	// Security headers
-	r.Header.Set("Sec-Fetch-Site", "same-origin")
-	r.Header.Set("Sec-Fetch-Mode", "cors")
-	r.Header.Set("Sec-Fetch-Dest", "empty")
-
-	// Standard headers
-	r.Header.Set("Accept", "application/json")
-	r.Header.Set("Accept-Language", "en-US,en;q=0.9,zh-CN;q=0.8,zh;q=0.7")
-	r.Header.Set("Cache-Control", "no-cache")
-	r.Header.Set("Pragma", "no-cache")
-
-	// Origin and Referer
-	r.Header.Set("Origin", webURL)
-	r.Header.Set("Referer", webURL+"/")
-
-	// Set authentication (matches sub2api's complete beta header for OAuth)
-	if account.IsOAuth() {
-		r.Header.Set("Authorization", "Bearer "+accessToken)
-		// Complete OAuth beta flags (matches sub2api's DefaultBetaHeader)
-		r.Header.Set("anthropic-beta", "claude-code-20250219,oauth-2025-04-20,interleaved-thinking-2025-05-14,fine-grained-tool-streaming-2025-05-14")
-	} else {
-		r.Header.Set("Cookie", fmt.Sprintf("sessionKey=%s", account.Credentials.SessionKey))
-	}
-}
-
-// buildPromptFromMessages builds a prompt string from OpenAI messages
-func buildPromptFromMessages(messages []OpenAIMessage) string {
-	var prompt string
-	for _, msg := range messages {
-		if msg.Role == "user" {
-			if str, ok := msg.Content.(string); ok {
-				prompt = str
-				break
-			}
-		}
 	}
-	return prompt
-}
-
-// streamResponse streams the response back to the client
-func (h *Sub2APIProxyHandler) streamResponse(c *gin.Context, resp *http.Response, _ string) {
-	defer resp.Body.Close()
-
-	c.Header("Content-Type", "text/event-stream")
-	c.Header("Cache-Control", "no-cache")
-	c.Header("Connection", "keep-alive")
-
-	c.Stream(func(w io.Writer) bool {
-		buf := make([]byte, 4096)
-		for {
-			n, err := resp.Body.Read(buf)
-			if n > 0 {
-				w.Write(buf[:n])
-				c.Writer.Flush()
-			}
-			if err != nil {
-				return false
-			}
-		}
-	})
-}
 
-// returnResponse returns the full response to the client
-func (h *Sub2APIProxyHandler) returnResponse(c *gin.Context, resp *http.Response) {
-	defer resp.Body.Close()
-
-	body, _ := io.ReadAll(resp.Body)
-	c.Data(resp.StatusCode, resp.Header.Get("Content-Type"), body)
-}
-
-// CountTokens handles the count_tokens endpoint using Anthropic API
-func (h *Sub2APIProxyHandler) CountTokens(c *gin.Context) {
 	// Get schedulable accounts
 	accounts, err := h.store.GetSchedulableAccounts()
 	if err != nil {
@@ -392,18 +154,6 @@ func (h *Sub2APIProxyHandler) CountTokens(c *gin.Context) {
 	// Use first available account for token counting
 	account := accounts[0]
 
-	// Read request body
-	bodyBytes, err := io.ReadAll(c.Request.Body)
-	if err != nil {
-		h.countTokensError(c, http.StatusBadRequest, "invalid_request_error", "Failed to read request body")
-		return
-	}
-
-	if len(bodyBytes) == 0 {
-		h.countTokensError(c, http.StatusBadRequest, "invalid_request_error", "Request body is empty")
-		return
-	}
-
 	// Use Anthropic API endpoint (not web API)
 	countURL := "https://api.anthropic.com/v1/messages/count_tokens?beta=true"
 
@@ -431,57 +181,22 @@ func (h *Sub2APIProxyHandler) CountTokens(c *gin.Context) {
 		return
 	}
 
-	// Set required headers
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("anthropic-version", "2023-06-01")
-
-	// Set anthropic-beta header for OAuth accounts (matches sub2api's getBetaHeader logic)
-	betaHeader := c.GetHeader("anthropic-beta")
-	if betaHeader == "" {
-		// Extract model from request body to determine appropriate beta header
-		var reqBody map[string]interface{}
-		if err := json.Unmarshal(bodyBytes, &reqBody); err == nil {
-			if modelID, ok := reqBody["model"].(string); ok && strings.Contains(strings.ToLower(modelID), "haiku") {
-				// Haiku models don't need claude-code beta (matches sub2api's HaikuBetaHeader)
-				betaHeader = "oauth-2025-04-20,interleaved-thinking-2025-05-14"
-			}
-		}
-
-		// Default for non-Haiku models (matches sub2api's DefaultBetaHeader)
-		if betaHeader == "" {
-			betaHeader = "claude-code-20250219,oauth-2025-04-20,interleaved-thinking-2025-05-14,fine-grained-tool-streaming-2025-05-14"
-		}
-	} else {
-		// Client provided beta header - ensure oauth beta is included (matches sub2api's getBetaHeader)
-		if !strings.Contains(betaHeader, "oauth-2025-04-20") {
-			// Insert oauth beta after claude-code if present
-			if strings.Contains(betaHeader, "claude-code-20250219") {
-				betaHeader = strings.Replace(betaHeader, "claude-code-20250219", "claude-code-20250219,oauth-2025-04-20", 1)
-			} else {
-				// No claude-code, put oauth first
-				betaHeader = "oauth-2025-04-20," + betaHeader
-			}
-		}
+	// Set anthropic-beta header (Haiku models get the Haiku profile, client
+	// headers get the OAuth flag added)
+	var reqBody struct {
+		Model string `json:"model"`
 	}
-	req.Header.Set("anthropic-beta", betaHeader)
-
-	// Add Claude Code client headers (matches sub2api defaults)
-	req.Header.Set("User-Agent", "claude-cli/2.0.62 (external, cli)")
-	req.Header.Set("X-Stainless-Lang", "js")
-	req.Header.Set("X-Stainless-Package-Version", "0.52.0")
-	req.Header.Set("X-Stainless-OS", "Linux")
-	req.Header.Set("X-Stainless-Arch", "x64")
-	req.Header.Set("X-Stainless-Runtime", "node")
-	req.Header.Set("X-Stainless-Runtime-Version", "v22.14.0")
-	req.Header.Set("X-App", "cli")
-	req.Header.Set("Anthropic-Dangerous-Direct-Browser-Access", "true")
-	req.Header.Set("Accept", "application/json")
-	req.Header.Set("Accept-Language", "en-US,en;q=0.9")
+	_ = json.Unmarshal(bodyBytes, &reqBody)
+	setCountTokensHeaders(req, h.betaHeaders.Resolve(account, reqBody.Model, c.GetHeader("anthropic-beta")))
 
 	// Execute request
-	client := &http.Client{Timeout: 30 * time.Second}
+	client := h.upstreamClient(account.ID, countTokensTimeout)
 	resp, err := client.Do(req)
 	if err != nil {
+		if middleware.RequestTimedOut(c) {
+			middleware.AbortWithRequestTimeout(c)
+			return
+		}
 		log.Error().Err(err).Str("account_id", account.ID).Msg("failed to count tokens")
 		h.countTokensError(c, http.StatusBadGateway, "upstream_error", "Request failed")
 		return
@@ -503,6 +218,11 @@ func (h *Sub2APIProxyHandler) CountTokens(c *gin.Context) {
 			Str("response", string(respBody)).
 			Msg("count_tokens upstream error")
 
+		// Cached results from an account that lost access are no longer trustworthy
+		if h.countCache != nil && (resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden) {
+			h.countCache.InvalidateAccount(account.ID)
+		}
+
 		// Return error in Anthropic API format
 		var errMsg string
 		switch resp.StatusCode {
@@ -523,10 +243,65 @@ func (h *Sub2APIProxyHandler) CountTokens(c *gin.Context) {
 		return
 	}
 
+	if cacheKey != "" && resp.StatusCode == http.StatusOK {
+		h.countCache.Set(cacheKey, account.ID, respBody)
+		c.Header("X-Cache", "MISS")
+	}
+
 	// Return successful response
 	c.Data(resp.StatusCode, "application/json", respBody)
 }
 
+// setCountTokensHeaders sets the headers of an upstream count_tokens request
+// besides authentication
+func setCountTokensHeaders(req *http.Request, betaHeader string) {
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("anthropic-version", "2023-06-01")
+	req.Header.Set("anthropic-beta", betaHeader)
+
+	// Add Claude Code client headers (matches sub2api defaults)
+	req.Header.Set("User-Agent", "claude-cli/2.0.62 (external, cli)")
+	req.Header.Set("X-Stainless-Lang", "js")
+	req.Header.Set("X-Stainless-Package-Version", "0.52.0")
+	req.Header.Set("X-Stainless-OS", "Linux")
+	req.Header.Set("X-Stainless-Arch", "x64")
+	req.Header.Set("X-Stainless-Runtime", "node")
+	req.Header.Set("X-Stainless-Runtime-Version", "v22.14.0")
+	req.Header.Set("X-App", "cli")
+	req.Header.Set("Anthropic-Dangerous-Direct-Browser-Access", "true")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Accept-Language", "en-US,en;q=0.9")
+}
+
+// CountTokensCacheStats returns count_tokens cache statistics
+func (h *Sub2APIProxyHandler) CountTokensCacheStats(c *gin.Context) {
+	if h.countCache == nil {
+		c.JSON(http.StatusOK, gin.H{"enabled": false})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"enabled": true,
+		"stats":   h.countCache.Stats(),
+	})
+}
+
+// InvalidateCountTokensCache clears cached count_tokens responses, optionally only for one account
+func (h *Sub2APIProxyHandler) InvalidateCountTokensCache(c *gin.Context) {
+	if h.countCache == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "count_tokens cache is disabled"})
+		return
+	}
+
+	var removed int
+	if accountID := c.Query("account_id"); accountID != "" {
+		removed = h.countCache.InvalidateAccount(accountID)
+	} else {
+		removed = h.countCache.Clear()
+	}
+
+	c.JSON(http.StatusOK, gin.H{"removed": removed})
+}
+
 // countTokensError returns count_tokens error in Anthropic API format
 func (h *Sub2APIProxyHandler) countTokensError(c *gin.Context, status int, errType, message string) {
 	c.JSON(status, gin.H{
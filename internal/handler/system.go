@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// BuildInfo describes the running binary
+type BuildInfo struct {
+	Version   string `json:"version"`
+	GitCommit string `json:"git_commit"`
+	BuildTime string `json:"build_time"`
+	GoVersion string `json:"go_version"`
+}
+
+// SelfCheckIssue is a configuration problem found at startup
+type SelfCheckIssue struct {
+	Level   string `json:"level"` // "error" or "warning"
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// SystemHandler serves build info and the startup self-check report
+type SystemHandler struct {
+	build     BuildInfo
+	features  map[string]interface{}
+	issues    []SelfCheckIssue
+	checkedAt time.Time
+}
+
+func NewSystemHandler(build BuildInfo, features map[string]interface{}, issues []SelfCheckIssue) *SystemHandler {
+	if issues == nil {
+		issues = []SelfCheckIssue{}
+	}
+	return &SystemHandler{
+		build:     build,
+		features:  features,
+		issues:    issues,
+		checkedAt: time.Now(),
+	}
+}
+
+// GetVersion returns build information and enabled features
+func (h *SystemHandler) GetVersion(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"version":    h.build.Version,
+		"git_commit": h.build.GitCommit,
+		"build_time": h.build.BuildTime,
+		"go_version": h.build.GoVersion,
+		"features":   h.features,
+	})
+}
+
+// GetSelfCheck returns the startup self-check report
+func (h *SystemHandler) GetSelfCheck(c *gin.Context) {
+	errors, warnings := 0, 0
+	for _, issue := range h.issues {
+		if issue.Level == "error" {
+			errors++
+		} else {
+			warnings++
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"ok":         errors == 0,
+		"errors":     errors,
+		"warnings":   warnings,
+		"issues":     h.issues,
+		"checked_at": h.checkedAt,
+	})
+}
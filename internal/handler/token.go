@@ -2,22 +2,25 @@ package handler
 
 import (
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 
 	"ccproxy/internal/middleware"
+	"ccproxy/internal/ratelimit"
+	"ccproxy/internal/shedding"
 	"ccproxy/internal/store"
 	"ccproxy/pkg/jwt"
 )
 
 type TokenHandler struct {
 	jwtManager    *jwt.Manager
-	store         *store.Store
+	store         store.TokenStore
 	defaultExpiry time.Duration
 }
 
-func NewTokenHandler(jwtManager *jwt.Manager, store *store.Store, defaultExpiry time.Duration) *TokenHandler {
+func NewTokenHandler(jwtManager *jwt.Manager, store store.TokenStore, defaultExpiry time.Duration) *TokenHandler {
 	return &TokenHandler{
 		jwtManager:    jwtManager,
 		store:         store,
@@ -29,6 +32,30 @@ type GenerateTokenRequest struct {
 	Name      string `json:"name" binding:"required"`
 	ExpiresIn string `json:"expires_in"` // e.g., "720h", "30d"
 	Mode      string `json:"mode"`       // "web", "api", or "both"
+	// MaxRequestSeconds caps the end-to-end duration of each request, 0 = unlimited
+	MaxRequestSeconds int `json:"max_request_seconds"`
+	// ConversationRetentionDays deletes logged conversations after N days, 0 = keep forever
+	ConversationRetentionDays int `json:"conversation_retention_days"`
+	// ResponseFooter is appended to every successful response as a final text block, "" = disabled
+	ResponseFooter string `json:"response_footer"`
+	// AllowFlagOverrides lets the token switch feature flags per request with X-CCProxy-Flags
+	AllowFlagOverrides bool `json:"allow_flag_overrides"`
+	// IsIssuer lets the token mint and revoke child tokens through /api/token/children
+	IsIssuer bool `json:"is_issuer"`
+	// Priority decides which requests are shed first under load: "low", "normal" or "critical"
+	Priority string `json:"priority"`
+	// DefaultModel is used when a request names no model, "" = claude.default_model
+	DefaultModel string `json:"default_model"`
+	// RateLimitBypass exempts a trusted internal service from the "ip" and/or "global" rate limits
+	RateLimitBypass []string `json:"rate_limit_bypass"`
+	// AllowedEndpoints limits the token to these endpoint groups, empty = all
+	AllowedEndpoints []string `json:"allowed_endpoints"`
+	// StreamFlushMs coalesces stream chunks into one flush per N ms, 0 = server.sse.flush_interval
+	StreamFlushMs int `json:"stream_flush_ms"`
+	// StreamFlushBytes flushes coalesced chunks once N bytes are held, 0 = server.sse.write_buffer_size
+	StreamFlushBytes int `json:"stream_flush_bytes"`
+	// OutputFilters repair common artefacts in responses, empty = none
+	OutputFilters []string `json:"output_filters"`
 }
 
 type GenerateTokenResponse struct {
@@ -66,6 +93,41 @@ func (h *TokenHandler) Generate(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid mode, must be 'web', 'api', or 'both'"})
 		return
 	}
+	if req.MaxRequestSeconds < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "max_request_seconds must not be negative"})
+		return
+	}
+	if req.ConversationRetentionDays < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "conversation_retention_days must not be negative"})
+		return
+	}
+	if len(req.ResponseFooter) > maxResponseFooterLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "response_footer is too long"})
+		return
+	}
+	if !shedding.ValidPriority(req.Priority) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid priority, must be 'low', 'normal', or 'critical'"})
+		return
+	}
+	bypass, err := ratelimit.NormalizeBypass(req.RateLimitBypass)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	endpoints, err := middleware.NormalizeEndpoints(req.AllowedEndpoints)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateStreamFlush(req.StreamFlushMs, req.StreamFlushBytes); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	filters, err := NormalizeOutputFilters(req.OutputFilters)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	// Generate JWT
 	tokenString, tokenInfo, err := h.jwtManager.Generate(req.Name, mode, expiry)
@@ -76,11 +138,23 @@ func (h *TokenHandler) Generate(c *gin.Context) {
 
 	// Store token in database
 	dbToken := &store.Token{
-		ID:        tokenInfo.ID,
-		UserName:  tokenInfo.UserName,
-		Mode:      mode,
-		CreatedAt: tokenInfo.IssuedAt,
-		ExpiresAt: tokenInfo.ExpiresAt,
+		ID:                        tokenInfo.ID,
+		UserName:                  tokenInfo.UserName,
+		Mode:                      mode,
+		CreatedAt:                 tokenInfo.IssuedAt,
+		ExpiresAt:                 tokenInfo.ExpiresAt,
+		MaxRequestSeconds:         req.MaxRequestSeconds,
+		ConversationRetentionDays: req.ConversationRetentionDays,
+		ResponseFooter:            req.ResponseFooter,
+		AllowFlagOverrides:        req.AllowFlagOverrides,
+		IsIssuer:                  req.IsIssuer,
+		Priority:                  req.Priority,
+		DefaultModel:              req.DefaultModel,
+		RateLimitBypass:           bypass,
+		AllowedEndpoints:          endpoints,
+		StreamFlushMs:             req.StreamFlushMs,
+		StreamFlushBytes:          req.StreamFlushBytes,
+		OutputFilters:             filters,
 	}
 	if err := h.store.CreateToken(dbToken); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to store token"})
@@ -112,6 +186,53 @@ type TokenInfo struct {
 	EnableConversationLogging bool       `json:"enable_conversation_logging"`
 	TotalRequests             int        `json:"total_requests"`
 	TotalTokensUsed           int        `json:"total_tokens_used"`
+	MaxRequestSeconds         int        `json:"max_request_seconds"`
+	ConversationRetentionDays int        `json:"conversation_retention_days"`
+	ResponseFooter            string     `json:"response_footer,omitempty"`
+	AllowFlagOverrides        bool       `json:"allow_flag_overrides"`
+	IsIssuer                  bool       `json:"is_issuer"`
+	ParentID                  string     `json:"parent_id,omitempty"`
+	ClientCertIdentity        string     `json:"client_cert_identity,omitempty"`
+	ExternalSubject           string     `json:"external_subject,omitempty"`
+	Priority                  string     `json:"priority,omitempty"`
+	DefaultModel              string     `json:"default_model,omitempty"`
+	RateLimitBypass           []string   `json:"rate_limit_bypass,omitempty"`
+	AllowedEndpoints          []string   `json:"allowed_endpoints,omitempty"` // Empty = all
+	StreamFlushMs             int        `json:"stream_flush_ms"`
+	StreamFlushBytes          int        `json:"stream_flush_bytes"`
+	OutputFilters             []string   `json:"output_filters,omitempty"`
+}
+
+// newTokenInfo describes a stored token
+func newTokenInfo(t *store.Token, now time.Time) *TokenInfo {
+	return &TokenInfo{
+		ID:                        t.ID,
+		Name:                      t.UserName,
+		Mode:                      t.Mode,
+		CreatedAt:                 t.CreatedAt,
+		ExpiresAt:                 t.ExpiresAt,
+		RevokedAt:                 t.RevokedAt,
+		LastUsedAt:                t.LastUsedAt,
+		IsValid:                   t.RevokedAt == nil && t.ExpiresAt.After(now),
+		EnableConversationLogging: t.EnableConversationLogging,
+		TotalRequests:             t.TotalRequests,
+		TotalTokensUsed:           t.TotalTokensUsed,
+		MaxRequestSeconds:         t.MaxRequestSeconds,
+		ConversationRetentionDays: t.ConversationRetentionDays,
+		ResponseFooter:            t.ResponseFooter,
+		AllowFlagOverrides:        t.AllowFlagOverrides,
+		IsIssuer:                  t.IsIssuer,
+		ParentID:                  t.ParentID,
+		ClientCertIdentity:        t.ClientCertIdentity,
+		ExternalSubject:           t.ExternalSubject,
+		Priority:                  t.Priority,
+		DefaultModel:              t.DefaultModel,
+		RateLimitBypass:           ratelimit.ParseBypass(t.RateLimitBypass).Classes(),
+		AllowedEndpoints:          middleware.ParseEndpoints(t.AllowedEndpoints),
+		StreamFlushMs:             t.StreamFlushMs,
+		StreamFlushBytes:          t.StreamFlushBytes,
+		OutputFilters:             ParseOutputFilters(t.OutputFilters),
+	}
 }
 
 func (h *TokenHandler) List(c *gin.Context) {
@@ -124,20 +245,7 @@ func (h *TokenHandler) List(c *gin.Context) {
 	now := time.Now()
 	response := make([]*TokenInfo, len(tokens))
 	for i, t := range tokens {
-		isValid := t.RevokedAt == nil && t.ExpiresAt.After(now)
-		response[i] = &TokenInfo{
-			ID:                        t.ID,
-			Name:                      t.UserName,
-			Mode:                      t.Mode,
-			CreatedAt:                 t.CreatedAt,
-			ExpiresAt:                 t.ExpiresAt,
-			RevokedAt:                 t.RevokedAt,
-			LastUsedAt:                t.LastUsedAt,
-			IsValid:                   isValid,
-			EnableConversationLogging: t.EnableConversationLogging,
-			TotalRequests:             t.TotalRequests,
-			TotalTokensUsed:           t.TotalTokensUsed,
-		}
+		response[i] = newTokenInfo(t, now)
 	}
 
 	c.JSON(http.StatusOK, TokenListResponse{Tokens: response})
@@ -161,22 +269,7 @@ func (h *TokenHandler) Info(c *gin.Context) {
 		return
 	}
 
-	now := time.Now()
-	isValid := token.RevokedAt == nil && token.ExpiresAt.After(now)
-
-	c.JSON(http.StatusOK, TokenInfo{
-		ID:                        token.ID,
-		Name:                      token.UserName,
-		Mode:                      token.Mode,
-		CreatedAt:                 token.CreatedAt,
-		ExpiresAt:                 token.ExpiresAt,
-		RevokedAt:                 token.RevokedAt,
-		LastUsedAt:                token.LastUsedAt,
-		IsValid:                   isValid,
-		EnableConversationLogging: token.EnableConversationLogging,
-		TotalRequests:             token.TotalRequests,
-		TotalTokensUsed:           token.TotalTokensUsed,
-	})
+	c.JSON(http.StatusOK, newTokenInfo(token, time.Now()))
 }
 
 type RevokeTokenRequest struct {
@@ -199,7 +292,21 @@ func (h *TokenHandler) Revoke(c *gin.Context) {
 }
 
 type UpdateTokenSettingsRequest struct {
-	EnableConversationLogging *bool `json:"enable_conversation_logging"`
+	EnableConversationLogging *bool     `json:"enable_conversation_logging"`
+	MaxRequestSeconds         *int      `json:"max_request_seconds"`         // End-to-end request budget, 0 = unlimited
+	ConversationRetentionDays *int      `json:"conversation_retention_days"` // Days to keep logged conversations, 0 = forever
+	ResponseFooter            *string   `json:"response_footer"`             // Text appended to responses, "" = disabled
+	AllowFlagOverrides        *bool     `json:"allow_flag_overrides"`        // Honor X-CCProxy-Flags overrides
+	IsIssuer                  *bool     `json:"is_issuer"`                   // May mint child tokens
+	ClientCertIdentity        *string   `json:"client_cert_identity"`        // Client certificate CN or SAN authenticating as the token, "" = none
+	ExternalSubject           *string   `json:"external_subject"`            // "<issuer name>:<sub>" of external JWTs authenticating as the token, "" = none
+	Priority                  *string   `json:"priority"`                    // Load shedding priority, "" = normal
+	DefaultModel              *string   `json:"default_model"`               // Model of requests naming none, "" = config default
+	RateLimitBypass           *[]string `json:"rate_limit_bypass"`           // Rate limit classes the token is exempt from, [] = none
+	AllowedEndpoints          *[]string `json:"allowed_endpoints"`           // Endpoint groups the token may call, [] = all
+	StreamFlushMs             *int      `json:"stream_flush_ms"`             // Stream chunk coalescing interval, 0 = server default
+	StreamFlushBytes          *int      `json:"stream_flush_bytes"`          // Stream chunk coalescing buffer, 0 = server default
+	OutputFilters             *[]string `json:"output_filters"`              // Filters applied to responses, [] = none
 }
 
 func (h *TokenHandler) UpdateSettings(c *gin.Context) {
@@ -215,6 +322,119 @@ func (h *TokenHandler) UpdateSettings(c *gin.Context) {
 		return
 	}
 
+	if req.MaxRequestSeconds != nil && *req.MaxRequestSeconds < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "max_request_seconds must not be negative"})
+		return
+	}
+	if req.ConversationRetentionDays != nil && *req.ConversationRetentionDays < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "conversation_retention_days must not be negative"})
+		return
+	}
+	if req.ResponseFooter != nil && len(*req.ResponseFooter) > maxResponseFooterLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "response_footer is too long"})
+		return
+	}
+	if req.Priority != nil && !shedding.ValidPriority(*req.Priority) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid priority, must be 'low', 'normal', or 'critical'"})
+		return
+	}
+	var bypass string
+	if req.RateLimitBypass != nil {
+		var err error
+		if bypass, err = ratelimit.NormalizeBypass(*req.RateLimitBypass); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	var endpoints string
+	if req.AllowedEndpoints != nil {
+		var err error
+		if endpoints, err = middleware.NormalizeEndpoints(*req.AllowedEndpoints); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	var filters string
+	if req.OutputFilters != nil {
+		var err error
+		if filters, err = NormalizeOutputFilters(*req.OutputFilters); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	// Either stream flush setting may be updated alone
+	var flushMs, flushBytes int
+	if req.StreamFlushMs != nil || req.StreamFlushBytes != nil {
+		token, err := h.store.GetToken(id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get token info"})
+			return
+		}
+		if token == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "token not found"})
+			return
+		}
+		flushMs, flushBytes = token.StreamFlushMs, token.StreamFlushBytes
+		if req.StreamFlushMs != nil {
+			flushMs = *req.StreamFlushMs
+		}
+		if req.StreamFlushBytes != nil {
+			flushBytes = *req.StreamFlushBytes
+		}
+		if err := validateStreamFlush(flushMs, flushBytes); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	// A certificate identity authenticates as a single token
+	if req.ClientCertIdentity != nil && *req.ClientCertIdentity != "" {
+		owner, err := h.store.TokenIDByClientCert(*req.ClientCertIdentity)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get token info"})
+			return
+		}
+		if owner != "" && owner != id {
+			c.JSON(http.StatusConflict, gin.H{"error": "client_cert_identity is already mapped to another token"})
+			return
+		}
+	}
+
+	// An external subject authenticates as a single token
+	if req.ExternalSubject != nil && *req.ExternalSubject != "" {
+		if name, sub, ok := strings.Cut(*req.ExternalSubject, ":"); !ok || name == "" || sub == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "external_subject must be '<issuer name>:<sub>'"})
+			return
+		}
+		owner, err := h.store.TokenIDByExternalSubject(*req.ExternalSubject)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get token info"})
+			return
+		}
+		if owner != "" && owner != id {
+			c.JSON(http.StatusConflict, gin.H{"error": "external_subject is already mapped to another token"})
+			return
+		}
+	}
+
+	// Only tokens issued by an admin can mint children
+	if req.IsIssuer != nil && *req.IsIssuer {
+		token, err := h.store.GetToken(id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get token info"})
+			return
+		}
+		if token == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "token not found"})
+			return
+		}
+		if token.ParentID != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "child tokens cannot be issuers"})
+			return
+		}
+	}
+
 	// Update conversation logging setting
 	if req.EnableConversationLogging != nil {
 		if err := h.store.UpdateTokenSettings(id, *req.EnableConversationLogging); err != nil {
@@ -223,5 +443,193 @@ func (h *TokenHandler) UpdateSettings(c *gin.Context) {
 		}
 	}
 
+	// Update request budget
+	if req.MaxRequestSeconds != nil {
+		if err := h.store.UpdateTokenMaxRequestSeconds(id, *req.MaxRequestSeconds); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update token settings"})
+			return
+		}
+	}
+
+	// Update conversation retention
+	if req.ConversationRetentionDays != nil {
+		if err := h.store.UpdateTokenRetentionDays(id, *req.ConversationRetentionDays); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update token settings"})
+			return
+		}
+	}
+
+	// Update response footer
+	if req.ResponseFooter != nil {
+		if err := h.store.UpdateTokenResponseFooter(id, *req.ResponseFooter); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update token settings"})
+			return
+		}
+	}
+
+	// Update feature flag overrides
+	if req.AllowFlagOverrides != nil {
+		if err := h.store.UpdateTokenFlagOverrides(id, *req.AllowFlagOverrides); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update token settings"})
+			return
+		}
+	}
+
+	// Update issuer permission; existing children stay valid when it is removed
+	if req.IsIssuer != nil {
+		if err := h.store.UpdateTokenIssuer(id, *req.IsIssuer); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update token settings"})
+			return
+		}
+	}
+
+	// Update client certificate identity
+	if req.ClientCertIdentity != nil {
+		if err := h.store.UpdateTokenClientCertIdentity(id, *req.ClientCertIdentity); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update token settings"})
+			return
+		}
+	}
+
+	// Update external JWT subject
+	if req.ExternalSubject != nil {
+		if err := h.store.UpdateTokenExternalSubject(id, *req.ExternalSubject); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update token settings"})
+			return
+		}
+	}
+
+	// Update load shedding priority
+	if req.Priority != nil {
+		if err := h.store.UpdateTokenPriority(id, *req.Priority); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update token settings"})
+			return
+		}
+	}
+
+	// Update default model
+	if req.DefaultModel != nil {
+		if err := h.store.UpdateTokenDefaultModel(id, *req.DefaultModel); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update token settings"})
+			return
+		}
+	}
+
+	// Update rate limit exemptions
+	if req.RateLimitBypass != nil {
+		if err := h.store.UpdateTokenRateLimitBypass(id, bypass); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update token settings"})
+			return
+		}
+	}
+
+	// Update allowed endpoints
+	if req.AllowedEndpoints != nil {
+		if err := h.store.UpdateTokenAllowedEndpoints(id, endpoints); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update token settings"})
+			return
+		}
+	}
+
+	// Update stream chunk coalescing
+	if req.StreamFlushMs != nil || req.StreamFlushBytes != nil {
+		if err := h.store.UpdateTokenStreamFlush(id, flushMs, flushBytes); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update token settings"})
+			return
+		}
+	}
+
+	// Update output filters
+	if req.OutputFilters != nil {
+		if err := h.store.UpdateTokenOutputFilters(id, filters); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update token settings"})
+			return
+		}
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "token settings updated successfully"})
 }
+
+// IntrospectTokenRequest follows RFC 7662: the token is sent as a form field,
+// JSON bodies are accepted as well for convenience.
+type IntrospectTokenRequest struct {
+	Token         string `json:"token" form:"token" binding:"required"`
+	TokenTypeHint string `json:"token_type_hint" form:"token_type_hint"`
+}
+
+// IntrospectTokenResponse is an RFC 7662 introspection response with ccproxy extensions
+type IntrospectTokenResponse struct {
+	Active          bool   `json:"active"`
+	Scope           string `json:"scope,omitempty"`
+	TokenType       string `json:"token_type,omitempty"`
+	Username        string `json:"username,omitempty"`
+	Sub             string `json:"sub,omitempty"`
+	Iss             string `json:"iss,omitempty"`
+	Jti             string `json:"jti,omitempty"`
+	Exp             int64  `json:"exp,omitempty"`
+	Iat             int64  `json:"iat,omitempty"`
+	Mode            string `json:"mode,omitempty"`
+	TotalRequests   int    `json:"total_requests,omitempty"`
+	TotalTokensUsed int    `json:"total_tokens_used,omitempty"`
+	LastUsedAt      int64  `json:"last_used_at,omitempty"`
+}
+
+// Introspect reports whether a JWT is currently active (RFC 7662).
+// Invalid, expired, revoked or unknown tokens all yield {"active": false}.
+func (h *TokenHandler) Introspect(c *gin.Context) {
+	var req IntrospectTokenRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request"})
+		return
+	}
+
+	inactive := IntrospectTokenResponse{Active: false}
+
+	claims, err := h.jwtManager.Validate(req.Token)
+	if err != nil {
+		c.JSON(http.StatusOK, inactive)
+		return
+	}
+
+	token, err := h.store.GetToken(claims.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get token info"})
+		return
+	}
+	if token == nil || token.RevokedAt != nil || !token.ExpiresAt.After(time.Now()) {
+		c.JSON(http.StatusOK, inactive)
+		return
+	}
+
+	resp := IntrospectTokenResponse{
+		Active:          true,
+		Scope:           modeToScope(token.Mode),
+		TokenType:       "Bearer",
+		Username:        token.UserName,
+		Sub:             claims.Subject,
+		Iss:             claims.Issuer,
+		Jti:             token.ID,
+		Exp:             token.ExpiresAt.Unix(),
+		Iat:             token.CreatedAt.Unix(),
+		Mode:            token.Mode,
+		TotalRequests:   token.TotalRequests,
+		TotalTokensUsed: token.TotalTokensUsed,
+	}
+	if token.LastUsedAt != nil {
+		resp.LastUsedAt = token.LastUsedAt.Unix()
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// modeToScope maps a token mode to a space-separated OAuth2 scope string
+func modeToScope(mode string) string {
+	switch mode {
+	case "web":
+		return "web"
+	case "api":
+		return "api"
+	default:
+		return "web api"
+	}
+}
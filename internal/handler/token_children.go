@@ -0,0 +1,197 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+
+	"ccproxy/internal/middleware"
+	"ccproxy/internal/store"
+)
+
+// CreateChildTokenRequest mints a token under the calling issuer token. The
+// child shares the issuer's rate limits and concurrency slots and can never
+// outlive it or exceed its mode and request budget.
+type CreateChildTokenRequest struct {
+	Name      string `json:"name" binding:"required"`
+	ExpiresIn string `json:"expires_in"` // Capped at the issuer's expiry
+	Mode      string `json:"mode"`       // Defaults to the issuer's mode
+	// MaxRequestSeconds caps each request, 0 = the issuer's budget
+	MaxRequestSeconds int `json:"max_request_seconds"`
+}
+
+// callerToken returns the token making the request, or writes an error
+func (h *TokenHandler) callerToken(c *gin.Context) (*store.Token, bool) {
+	tokenID := c.GetString(middleware.ContextKeyTokenID)
+	if tokenID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "not authenticated"})
+		return nil, false
+	}
+	token, err := h.store.GetToken(tokenID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get token info"})
+		return nil, false
+	}
+	if token == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "token not found"})
+		return nil, false
+	}
+	return token, true
+}
+
+// CreateChild mints a child token for the calling issuer token. Children
+// inherit the issuer's logging, retention, footer and flag settings; the JWT
+// middleware also holds them to the issuer's current restrictions.
+func (h *TokenHandler) CreateChild(c *gin.Context) {
+	parent, ok := h.callerToken(c)
+	if !ok {
+		return
+	}
+	if !parent.IsIssuer {
+		c.JSON(http.StatusForbidden, gin.H{"error": "token is not allowed to issue child tokens"})
+		return
+	}
+
+	var req CreateChildTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	expiry := h.defaultExpiry
+	if req.ExpiresIn != "" {
+		d, err := time.ParseDuration(req.ExpiresIn)
+		if err != nil || d <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid expires_in format"})
+			return
+		}
+		expiry = d
+	}
+	if remaining := time.Until(parent.ExpiresAt); expiry > remaining {
+		expiry = remaining
+	}
+
+	mode := req.Mode
+	if mode == "" {
+		mode = parent.Mode
+	}
+	if mode != "web" && mode != "api" && mode != "both" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid mode, must be 'web', 'api', or 'both'"})
+		return
+	}
+	if parent.Mode != "both" && mode != parent.Mode {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "mode must be within the issuer's mode '" + parent.Mode + "'"})
+		return
+	}
+
+	maxSeconds := req.MaxRequestSeconds
+	if maxSeconds < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "max_request_seconds must not be negative"})
+		return
+	}
+	if parent.MaxRequestSeconds > 0 {
+		if maxSeconds == 0 {
+			maxSeconds = parent.MaxRequestSeconds
+		} else if maxSeconds > parent.MaxRequestSeconds {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "max_request_seconds exceeds the issuer's budget"})
+			return
+		}
+	}
+
+	tokenString, tokenInfo, err := h.jwtManager.Generate(req.Name, mode, expiry)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate token"})
+		return
+	}
+
+	expiresAt := tokenInfo.ExpiresAt
+	if expiresAt.After(parent.ExpiresAt) {
+		expiresAt = parent.ExpiresAt
+	}
+
+	child := &store.Token{
+		ID:                        tokenInfo.ID,
+		UserName:                  tokenInfo.UserName,
+		Mode:                      mode,
+		CreatedAt:                 tokenInfo.IssuedAt,
+		ExpiresAt:                 expiresAt,
+		EnableConversationLogging: parent.EnableConversationLogging,
+		MaxRequestSeconds:         maxSeconds,
+		ConversationRetentionDays: parent.ConversationRetentionDays,
+		ResponseFooter:            parent.ResponseFooter,
+		AllowFlagOverrides:        parent.AllowFlagOverrides,
+		ParentID:                  parent.ID,
+		Priority:                  parent.Priority,
+		DefaultModel:              parent.DefaultModel,
+		RateLimitBypass:           parent.RateLimitBypass,
+		AllowedEndpoints:          parent.AllowedEndpoints,
+		StreamFlushMs:             parent.StreamFlushMs,
+		StreamFlushBytes:          parent.StreamFlushBytes,
+		OutputFilters:             parent.OutputFilters,
+	}
+	if err := h.store.CreateToken(child); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to store token"})
+		return
+	}
+	log.Info().Str("parent_id", parent.ID).Str("token_id", child.ID).Str("name", req.Name).Msg("issued child token")
+
+	c.JSON(http.StatusOK, GenerateTokenResponse{
+		Token:     tokenString,
+		ID:        child.ID,
+		Name:      req.Name,
+		Mode:      mode,
+		ExpiresAt: child.ExpiresAt,
+	})
+}
+
+// ListChildren returns the child tokens minted by the calling token
+func (h *TokenHandler) ListChildren(c *gin.Context) {
+	parent, ok := h.callerToken(c)
+	if !ok {
+		return
+	}
+
+	tokens, err := h.store.ListTokens()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list tokens"})
+		return
+	}
+
+	now := time.Now()
+	response := []*TokenInfo{}
+	for _, t := range tokens {
+		if t.ParentID == parent.ID {
+			response = append(response, newTokenInfo(t, now))
+		}
+	}
+
+	c.JSON(http.StatusOK, TokenListResponse{Tokens: response})
+}
+
+// RevokeChild revokes a child token minted by the calling token
+func (h *TokenHandler) RevokeChild(c *gin.Context) {
+	parent, ok := h.callerToken(c)
+	if !ok {
+		return
+	}
+
+	child, err := h.store.GetToken(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get token info"})
+		return
+	}
+	if child == nil || child.ParentID != parent.ID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "token not found"})
+		return
+	}
+
+	if err := h.store.RevokeToken(child.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke token"})
+		return
+	}
+	log.Info().Str("parent_id", parent.ID).Str("token_id", child.ID).Msg("revoked child token")
+
+	c.JSON(http.StatusOK, gin.H{"message": "token revoked successfully"})
+}
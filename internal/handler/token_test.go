@@ -0,0 +1,220 @@
+package handler
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"ccproxy/internal/middleware"
+	"ccproxy/internal/store"
+	"ccproxy/internal/store/storetest"
+	"ccproxy/pkg/jwt"
+)
+
+func TestTokenHandler_GenerateUpdateRevoke(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	st := storetest.NewMemoryStore()
+	tokens := NewTokenHandler(jwt.NewManager("test-secret-test-secret-test-secret", "ccproxy"), st, time.Hour)
+
+	router := gin.New()
+	router.POST("/tokens", tokens.Generate)
+	router.GET("/tokens", tokens.List)
+	router.PUT("/tokens/:id/settings", tokens.UpdateSettings)
+	router.POST("/tokens/revoke", tokens.Revoke)
+
+	if code, _ := doJSON(t, router, http.MethodPost, "/tokens", `{"name":"alice","mode":"cli"}`); code != http.StatusBadRequest {
+		t.Errorf("invalid mode: got %d", code)
+	}
+	code, created := doJSON(t, router, http.MethodPost, "/tokens", `{"name":"alice","max_request_seconds":30}`)
+	if code != http.StatusOK {
+		t.Fatalf("generate: %d %v", code, created)
+	}
+	id := created["id"].(string)
+
+	code, resp := doJSON(t, router, http.MethodPut, "/tokens/"+id+"/settings",
+		`{"enable_conversation_logging":true,"conversation_retention_days":7,"response_footer":"-- sent via ccproxy"}`)
+	if code != http.StatusOK {
+		t.Fatalf("update settings: %d %v", code, resp)
+	}
+	token, err := st.GetToken(id)
+	if err != nil || token == nil {
+		t.Fatalf("token not stored: %v", err)
+	}
+	if token.Mode != "both" || token.MaxRequestSeconds != 30 || !token.EnableConversationLogging ||
+		token.ConversationRetentionDays != 7 || token.ResponseFooter != "-- sent via ccproxy" {
+		t.Errorf("unexpected token: %+v", token)
+	}
+
+	if code, _ := doJSON(t, router, http.MethodPut, "/tokens/"+id+"/settings", `{"rate_limit_bypass":["user"]}`); code != http.StatusBadRequest {
+		t.Errorf("invalid rate limit class: got %d", code)
+	}
+	if code, _ := doJSON(t, router, http.MethodPut, "/tokens/"+id+"/settings", `{"rate_limit_bypass":["global","IP"]}`); code != http.StatusOK {
+		t.Errorf("rate limit bypass: got %d", code)
+	}
+	if token, _ := st.GetToken(id); token.RateLimitBypass != "ip,global" {
+		t.Errorf("rate_limit_bypass = %q", token.RateLimitBypass)
+	}
+
+	if code, _ := doJSON(t, router, http.MethodPut, "/tokens/"+id+"/settings", `{"allowed_endpoints":["admin"]}`); code != http.StatusBadRequest {
+		t.Errorf("invalid endpoint: got %d", code)
+	}
+	if code, _ := doJSON(t, router, http.MethodPut, "/tokens/"+id+"/settings", `{"allowed_endpoints":["models","messages"]}`); code != http.StatusOK {
+		t.Errorf("allowed endpoints: got %d", code)
+	}
+	if token, _ := st.GetToken(id); token.AllowedEndpoints != "messages,models" {
+		t.Errorf("allowed_endpoints = %q", token.AllowedEndpoints)
+	}
+
+	if code, _ := doJSON(t, router, http.MethodPut, "/tokens/"+id+"/settings", `{"stream_flush_ms":5000}`); code != http.StatusBadRequest {
+		t.Errorf("stream_flush_ms out of range: got %d", code)
+	}
+	if code, _ := doJSON(t, router, http.MethodPut, "/tokens/"+id+"/settings", `{"stream_flush_ms":25,"stream_flush_bytes":8192}`); code != http.StatusOK {
+		t.Errorf("stream flush: got %d", code)
+	}
+	if code, _ := doJSON(t, router, http.MethodPut, "/tokens/"+id+"/settings", `{"stream_flush_ms":50}`); code != http.StatusOK {
+		t.Errorf("stream flush interval only: got %d", code)
+	}
+	if token, _ := st.GetToken(id); token.StreamFlushMs != 50 || token.StreamFlushBytes != 8192 {
+		t.Errorf("stream flush = %d ms, %d bytes", token.StreamFlushMs, token.StreamFlushBytes)
+	}
+
+	if code, _ := doJSON(t, router, http.MethodPost, "/tokens/revoke", `{"id":"`+id+`"}`); code != http.StatusOK {
+		t.Fatalf("revoke: %d", code)
+	}
+	if valid, _ := st.ValidateToken(id); valid != nil {
+		t.Error("revoked token should not validate")
+	}
+	_, list := doJSON(t, router, http.MethodGet, "/tokens", "")
+	listed, _ := list["tokens"].([]interface{})
+	if len(listed) != 1 || listed[0].(map[string]interface{})["is_valid"] != false {
+		t.Errorf("unexpected token list: %v", list)
+	}
+}
+
+func TestRequestLogsHandler_ListFilters(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	st := storetest.NewMemoryStore()
+	now := time.Now()
+	for i, endUser := range []string{"u1", "u2", "u1"} {
+		if err := st.CreateRequestLog(&store.RequestLog{
+			ID:         "log-" + string(rune('a'+i)),
+			TokenID:    "tok-1",
+			Model:      "claude-sonnet-4",
+			RequestAt:  now.Add(time.Duration(i) * time.Minute),
+			StatusCode: http.StatusOK,
+			Success:    true,
+			EndUserID:  sql.NullString{String: endUser, Valid: true},
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	router := gin.New()
+	router.GET("/logs", NewRequestLogsHandler(st).ListRequestLogs)
+
+	code, resp := doJSON(t, router, http.MethodGet, "/logs?token_id=tok-1&end_user_id=u1&limit=1", "")
+	if code != http.StatusOK {
+		t.Fatalf("list: %d %v", code, resp)
+	}
+	logs, _ := resp["logs"].([]interface{})
+	if resp["total"] != float64(2) || len(logs) != 1 {
+		t.Fatalf("unexpected page: %v", resp)
+	}
+	if id := logs[0].(map[string]interface{})["id"]; id != "log-c" {
+		t.Errorf("newest log first: got %v", id)
+	}
+}
+
+func TestTokenHandler_ChildTokens(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	st := storetest.NewMemoryStore()
+	tokens := NewTokenHandler(jwt.NewManager("test-secret-test-secret-test-secret", "ccproxy"), st, 24*time.Hour)
+
+	// Stand-in for the JWT middleware: the caller is named by a header
+	asToken := func(c *gin.Context) {
+		c.Set(middleware.ContextKeyTokenID, c.GetHeader("X-Token-ID"))
+	}
+	router := gin.New()
+	router.POST("/tokens", tokens.Generate)
+	router.PUT("/tokens/:id/settings", tokens.UpdateSettings)
+	router.POST("/tokens/revoke", tokens.Revoke)
+	router.POST("/children", asToken, tokens.CreateChild)
+	router.GET("/children", asToken, tokens.ListChildren)
+	router.DELETE("/children/:id", asToken, tokens.RevokeChild)
+	as := func(method, path, tokenID, body string) (int, map[string]interface{}) {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Token-ID", tokenID)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		var resp map[string]interface{}
+		_ = json.Unmarshal(w.Body.Bytes(), &resp)
+		return w.Code, resp
+	}
+
+	_, created := doJSON(t, router, http.MethodPost, "/tokens",
+		`{"name":"team","mode":"api","expires_in":"2h","max_request_seconds":60,"is_issuer":true}`)
+	issuer := created["id"].(string)
+	_, created = doJSON(t, router, http.MethodPost, "/tokens", `{"name":"other"}`)
+	other := created["id"].(string)
+
+	if code, _ := as(http.MethodPost, "/children", other, `{"name":"x"}`); code != http.StatusForbidden {
+		t.Errorf("non-issuer: got %d", code)
+	}
+	if code, _ := as(http.MethodPost, "/children", issuer, `{"name":"x","mode":"both"}`); code != http.StatusBadRequest {
+		t.Errorf("wider mode: got %d", code)
+	}
+	if code, _ := as(http.MethodPost, "/children", issuer, `{"name":"x","max_request_seconds":120}`); code != http.StatusBadRequest {
+		t.Errorf("larger budget: got %d", code)
+	}
+
+	code, resp := as(http.MethodPost, "/children", issuer, `{"name":"ci-bot"}`)
+	if code != http.StatusOK {
+		t.Fatalf("create child: %d %v", code, resp)
+	}
+	childID := resp["id"].(string)
+	child, _ := st.GetToken(childID)
+	parent, _ := st.GetToken(issuer)
+	if child.ParentID != issuer || child.Mode != "api" || child.MaxRequestSeconds != 60 || child.ExpiresAt.After(parent.ExpiresAt) {
+		t.Errorf("child = %+v", child)
+	}
+
+	// Children cannot be made issuers, and other tokens cannot see or revoke them
+	if code, _ := doJSON(t, router, http.MethodPut, "/tokens/"+childID+"/settings", `{"is_issuer":true}`); code != http.StatusBadRequest {
+		t.Errorf("child issuer: got %d", code)
+	}
+	if _, list := as(http.MethodGet, "/children", other, ""); len(list["tokens"].([]interface{})) != 0 {
+		t.Errorf("other token sees children: %v", list)
+	}
+	if code, _ := as(http.MethodDelete, "/children/"+childID, other, ""); code != http.StatusNotFound {
+		t.Errorf("revoke by other token: got %d", code)
+	}
+	if _, list := as(http.MethodGet, "/children", issuer, ""); len(list["tokens"].([]interface{})) != 1 {
+		t.Errorf("children = %v", list)
+	}
+
+	// Revoking the issuer revokes its children
+	code, resp = as(http.MethodPost, "/children", issuer, `{"name":"second"}`)
+	if code != http.StatusOK {
+		t.Fatalf("create child: %d %v", code, resp)
+	}
+	secondID := resp["id"].(string)
+	if code, _ := as(http.MethodDelete, "/children/"+childID, issuer, ""); code != http.StatusOK {
+		t.Errorf("revoke child: got %d", code)
+	}
+	if valid, _ := st.ValidateToken(childID); valid != nil {
+		t.Error("revoked child still validates")
+	}
+	if code, _ := doJSON(t, router, http.MethodPost, "/tokens/revoke", `{"id":"`+issuer+`"}`); code != http.StatusOK {
+		t.Fatalf("revoke issuer: %d", code)
+	}
+	if valid, _ := st.ValidateToken(secondID); valid != nil {
+		t.Error("child of revoked issuer still validates")
+	}
+}
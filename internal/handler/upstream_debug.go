@@ -0,0 +1,25 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"ccproxy/internal/upstream"
+)
+
+// UpstreamSamplesHandler serves the sampled upstream exchanges of an account,
+// newest first. A nil sampler means sampling is disabled.
+func UpstreamSamplesHandler(sampler *upstream.Sampler) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if sampler == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "upstream sampling is disabled"})
+			return
+		}
+		accountID := c.Param("account_id")
+		c.JSON(http.StatusOK, gin.H{
+			"account_id": accountID,
+			"exchanges":  sampler.Exchanges(accountID),
+		})
+	}
+}
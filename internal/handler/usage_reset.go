@@ -0,0 +1,115 @@
+package handler
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+
+	"ccproxy/internal/store"
+)
+
+// UsageResetHandler zeroes token usage totals and account counters, recording
+// each reset with its reason in the audit log
+type UsageResetHandler struct {
+	store *store.Store
+}
+
+func NewUsageResetHandler(st *store.Store) *UsageResetHandler {
+	return &UsageResetHandler{store: st}
+}
+
+// UsageResetRequest explains a reset
+type UsageResetRequest struct {
+	Reason      string `json:"reason"`                 // Required, kept in the audit log
+	RequestedBy string `json:"requested_by,omitempty"` // Who asked for the reset, kept in the audit details
+}
+
+// ResetTokenUsage zeroes a token's total_requests and total_tokens_used.
+// Request logs and daily stats are kept.
+func (h *UsageResetHandler) ResetTokenUsage(c *gin.Context) {
+	req, ok := bindUsageReset(c)
+	if !ok {
+		return
+	}
+	id := c.Param("id")
+	prev, err := h.store.ResetTokenUsage(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "token not found"})
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Str("token_id", id).Msg("failed to reset token usage")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to reset token usage"})
+		return
+	}
+	h.recordReset(c, store.AuditActionTokenUsageReset, id, req, prev)
+}
+
+// ResetAccountCounters zeroes an account's error_count and success_count
+func (h *UsageResetHandler) ResetAccountCounters(c *gin.Context) {
+	req, ok := bindUsageReset(c)
+	if !ok {
+		return
+	}
+	id := c.Param("id")
+	prev, err := h.store.ResetAccountCounters(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "account not found"})
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Str("account_id", id).Msg("failed to reset account counters")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to reset account counters"})
+		return
+	}
+	h.recordReset(c, store.AuditActionAccountCountersReset, id, req, prev)
+}
+
+func bindUsageReset(c *gin.Context) (*UsageResetRequest, bool) {
+	var req UsageResetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	if req.Reason = strings.TrimSpace(req.Reason); req.Reason == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "reason is required"})
+		return nil, false
+	}
+	return &req, true
+}
+
+// recordReset writes the audit entry of a reset and returns it as the receipt
+func (h *UsageResetHandler) recordReset(c *gin.Context, action, subject string, req *UsageResetRequest, prev interface{}) {
+	actor := auditActor(c)
+	details := map[string]interface{}{
+		"reason":    req.Reason,
+		"previous":  prev,
+		"client_ip": c.ClientIP(),
+	}
+	if req.RequestedBy != "" {
+		details["requested_by"] = req.RequestedBy
+	}
+	entry := &store.AuditEntry{
+		ID:        "aud_" + uuid.New().String(),
+		CreatedAt: time.Now(),
+		Action:    action,
+		Actor:     actor,
+		Subject:   subject,
+		Details:   details,
+	}
+	if err := h.store.CreateAuditEntry(entry); err != nil {
+		// The counters are reset; report it even though the entry was lost
+		log.Error().Err(err).Str("action", action).Str("subject", subject).Msg("failed to record counter reset")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "counters reset but failed to record audit entry", "previous": prev})
+		return
+	}
+
+	log.Info().Str("action", action).Str("subject", subject).Str("actor", actor).Msg("counters reset")
+	c.JSON(http.StatusOK, entry)
+}
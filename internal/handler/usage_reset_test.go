@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"ccproxy/internal/middleware"
+	"ccproxy/internal/store"
+)
+
+func TestUsageResetHandler(t *testing.T) {
+	router, db := newAccountTestRouter(t)
+	h := NewUsageResetHandler(db)
+	signedIn := func(c *gin.Context) { c.Set(middleware.ContextKeyAdminSubject, "ops@example.com") }
+	router.POST("/token/:id/usage/reset", signedIn, h.ResetTokenUsage)
+	router.POST("/account/:id/counters/reset", h.ResetAccountCounters)
+
+	if err := db.CreateToken(&store.Token{ID: "tok-1", UserName: "alice", Mode: "both", CreatedAt: time.Now(), ExpiresAt: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := db.IncrementTokenUsage("tok-1", 100); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.CreateAccount(&store.Account{ID: "acc-1", Name: "acc-1", Type: store.AccountTypeSessionKey, CreatedAt: time.Now(), IsActive: true}); err != nil {
+		t.Fatal(err)
+	}
+	db.IncrementAccountError("acc-1")
+	db.IncrementAccountError("acc-1")
+	db.IncrementAccountSuccess("acc-1")
+
+	// A reason is required
+	if code, _ := doJSON(t, router, http.MethodPost, "/token/tok-1/usage/reset", `{"reason":"  "}`); code != http.StatusBadRequest {
+		t.Errorf("reset without reason = %d, want 400", code)
+	}
+	if code, _ := doJSON(t, router, http.MethodPost, "/token/nope/usage/reset", `{"reason":"x"}`); code != http.StatusNotFound {
+		t.Errorf("reset of unknown token = %d, want 404", code)
+	}
+	if code, _ := doJSON(t, router, http.MethodPost, "/account/nope/counters/reset", `{"reason":"x"}`); code != http.StatusNotFound {
+		t.Errorf("reset of unknown account = %d, want 404", code)
+	}
+
+	code, resp := doJSON(t, router, http.MethodPost, "/token/tok-1/usage/reset", `{"reason":"billing period rollover","requested_by":"bob"}`)
+	if code != http.StatusOK {
+		t.Fatalf("token reset: %d %v", code, resp)
+	}
+	prev := resp["details"].(map[string]interface{})["previous"].(map[string]interface{})
+	if prev["total_requests"] != float64(3) || prev["total_tokens_used"] != float64(300) {
+		t.Errorf("previous token usage = %v", prev)
+	}
+	token, _ := db.GetToken("tok-1")
+	if token.TotalRequests != 0 || token.TotalTokensUsed != 0 {
+		t.Errorf("token usage after reset = %d/%d", token.TotalRequests, token.TotalTokensUsed)
+	}
+
+	code, resp = doJSON(t, router, http.MethodPost, "/account/acc-1/counters/reset", `{"reason":"errors from a resolved outage"}`)
+	if code != http.StatusOK {
+		t.Fatalf("account reset: %d %v", code, resp)
+	}
+	account, _ := db.GetAccount("acc-1")
+	if account.ErrorCount != 0 || account.SuccessCount != 0 {
+		t.Errorf("account counters after reset = %d/%d", account.ErrorCount, account.SuccessCount)
+	}
+
+	entries, err := db.ListAuditEntries(store.AuditFilter{Action: store.AuditActionTokenUsageReset})
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("token reset audit entries = %v, %v", entries, err)
+	}
+	// requested_by is kept in the details; the actor is the signed-in admin
+	if e := entries[0]; e.Actor != "ops@example.com" || e.Details["requested_by"] != "bob" || e.Subject != "tok-1" || e.Details["reason"] != "billing period rollover" {
+		t.Errorf("audit entry = %+v", e)
+	}
+	entries, _ = db.ListAuditEntries(store.AuditFilter{Action: store.AuditActionAccountCountersReset})
+	if len(entries) != 1 || entries[0].Actor != "admin" {
+		t.Fatalf("account reset audit entries = %+v", entries)
+	}
+	if prev := entries[0].Details["previous"].(map[string]interface{}); prev["error_count"] != float64(2) || prev["success_count"] != float64(1) {
+		t.Errorf("previous account counters = %v", prev)
+	}
+}
@@ -0,0 +1,338 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"ccproxy/internal/store"
+)
+
+const (
+	// maxWebAttachments is the maximum number of files per request (claude.ai allows 20)
+	maxWebAttachments = 20
+	// maxWebAttachmentSize is the maximum decoded size of a single file
+	maxWebAttachmentSize = 30 << 20
+	// maxInlineTextSize is the largest text file sent inline as extracted content
+	maxInlineTextSize = 1 << 20
+)
+
+// WebAttachment is a client-supplied file forwarded to claude.ai
+type WebAttachment struct {
+	FileName string
+	MimeType string
+	Data     []byte
+}
+
+// isText reports whether the file can be sent inline as extracted content
+// instead of being uploaded
+func (a *WebAttachment) isText() bool {
+	if len(a.Data) > maxInlineTextSize {
+		return false
+	}
+	mt := strings.ToLower(a.MimeType)
+	switch {
+	case strings.HasPrefix(mt, "text/"):
+		return true
+	case mt == "application/json", mt == "application/xml", mt == "application/x-yaml", mt == "application/yaml":
+		return true
+	}
+	return false
+}
+
+// extractWebAttachments collects base64 files from OpenAI-style content blocks of user messages.
+// Supported blocks:
+//
+//	{"type": "image_url", "image_url": {"url": "data:image/png;base64,..."}}
+//	{"type": "file", "file": {"filename": "a.pdf", "file_data": "data:application/pdf;base64,..."}}
+//
+// Images linked by an http(s) URL are left out.
+func extractWebAttachments(messages []OpenAIMessage) ([]WebAttachment, error) {
+	var attachments []WebAttachment
+	for _, msg := range messages {
+		if msg.Role != "user" {
+			continue
+		}
+		blocks, ok := msg.Content.([]interface{})
+		if !ok {
+			continue
+		}
+
+		for _, block := range blocks {
+			blockMap, ok := block.(map[string]interface{})
+			if !ok {
+				continue
+			}
+
+			var dataURL, fileName string
+			switch blockMap["type"] {
+			case "image_url":
+				imageURL, _ := blockMap["image_url"].(map[string]interface{})
+				dataURL, _ = imageURL["url"].(string)
+				if dataURL != "" && !strings.HasPrefix(dataURL, "data:") {
+					continue
+				}
+			case "file":
+				file, _ := blockMap["file"].(map[string]interface{})
+				dataURL, _ = file["file_data"].(string)
+				fileName, _ = file["filename"].(string)
+				if dataURL == "" {
+					if _, hasID := file["file_id"]; hasID {
+						return nil, fmt.Errorf("file_id references are not supported, send file_data instead")
+					}
+				}
+			default:
+				continue
+			}
+
+			if dataURL == "" {
+				return nil, fmt.Errorf("%s block is missing its data", blockMap["type"])
+			}
+
+			mimeType, data, err := parseDataURL(dataURL)
+			if err != nil {
+				return nil, err
+			}
+
+			attachments = append(attachments, newWebAttachment(fileName, mimeType, data, len(attachments)))
+		}
+	}
+
+	if err := validateWebAttachments(attachments); err != nil {
+		return nil, err
+	}
+	return attachments, nil
+}
+
+// newWebAttachment fills in a file name from the MIME type when the client sent none
+func newWebAttachment(fileName, mimeType string, data []byte, index int) WebAttachment {
+	if mimeType == "" {
+		mimeType = http.DetectContentType(data)
+	}
+	if fileName == "" {
+		ext := ""
+		if exts, _ := mime.ExtensionsByType(mimeType); len(exts) > 0 {
+			ext = exts[0]
+		}
+		fileName = fmt.Sprintf("attachment-%d%s", index+1, ext)
+	}
+	return WebAttachment{FileName: filepath.Base(fileName), MimeType: mimeType, Data: data}
+}
+
+// validateWebAttachments enforces count and size limits
+func validateWebAttachments(attachments []WebAttachment) error {
+	if len(attachments) > maxWebAttachments {
+		return fmt.Errorf("too many attachments: %d (max %d)", len(attachments), maxWebAttachments)
+	}
+	for _, a := range attachments {
+		if len(a.Data) == 0 {
+			return fmt.Errorf("attachment %s is empty", a.FileName)
+		}
+		if len(a.Data) > maxWebAttachmentSize {
+			return fmt.Errorf("attachment %s exceeds %d MB", a.FileName, maxWebAttachmentSize>>20)
+		}
+	}
+	return nil
+}
+
+// parseDataURL decodes a base64 data URL ("data:<mime>;base64,<data>")
+func parseDataURL(dataURL string) (string, []byte, error) {
+	if !strings.HasPrefix(dataURL, "data:") {
+		return "", nil, fmt.Errorf("only base64 data URLs are supported for attachments")
+	}
+
+	header, payload, ok := strings.Cut(strings.TrimPrefix(dataURL, "data:"), ",")
+	if !ok || !strings.HasSuffix(header, ";base64") {
+		return "", nil, fmt.Errorf("attachment data URL must be base64 encoded")
+	}
+
+	data, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid base64 attachment data: %w", err)
+	}
+
+	mimeType := strings.TrimSuffix(header, ";base64")
+	if i := strings.Index(mimeType, ";"); i >= 0 {
+		mimeType = mimeType[:i]
+	}
+	return mimeType, data, nil
+}
+
+// hasFileAttachments reports whether a chat request carries files only web
+// mode can forward: "file" content blocks or multipart "files" parts. Images
+// can also be sent to the API, as image blocks.
+func hasFileAttachments(c *gin.Context, messages []OpenAIMessage) bool {
+	if form := c.Request.MultipartForm; form != nil && len(form.File["files"]) > 0 {
+		return true
+	}
+	for _, msg := range messages {
+		if msg.Role != "user" {
+			continue
+		}
+		blocks, _ := msg.Content.([]interface{})
+		for _, block := range blocks {
+			if blockMap, ok := block.(map[string]interface{}); ok && blockMap["type"] == "file" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// collectWebAttachments gathers the attachments of a web mode chat request
+// from its content blocks and multipart parts
+func collectWebAttachments(c *gin.Context, messages []OpenAIMessage) ([]WebAttachment, error) {
+	attachments, err := extractWebAttachments(messages)
+	if err != nil {
+		return nil, err
+	}
+	if form := c.Request.MultipartForm; form != nil {
+		files, err := readMultipartAttachments(form, len(attachments))
+		if err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, files...)
+	}
+	return attachments, validateWebAttachments(attachments)
+}
+
+// readMultipartAttachments reads files sent as multipart/form-data parts named "files"
+func readMultipartAttachments(form *multipart.Form, offset int) ([]WebAttachment, error) {
+	var attachments []WebAttachment
+	for _, fh := range form.File["files"] {
+		if fh.Size > maxWebAttachmentSize {
+			return nil, fmt.Errorf("attachment %s exceeds %d MB", fh.Filename, maxWebAttachmentSize>>20)
+		}
+
+		f, err := fh.Open()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read attachment %s: %w", fh.Filename, err)
+		}
+		data, err := io.ReadAll(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read attachment %s: %w", fh.Filename, err)
+		}
+
+		mimeType := fh.Header.Get("Content-Type")
+		if mimeType == "application/octet-stream" {
+			mimeType = ""
+		}
+		attachments = append(attachments, newWebAttachment(fh.Filename, mimeType, data, offset+len(attachments)))
+	}
+	return attachments, nil
+}
+
+// webUploadResponse is the relevant part of claude.ai's upload response
+type webUploadResponse struct {
+	FileUUID string `json:"file_uuid"`
+}
+
+// prepareWebAttachments turns attachments into the completion payload's
+// "attachments" (inline text) and "files" (uploaded file UUIDs) arrays
+func (h *EnhancedProxyHandler) prepareWebAttachments(ctx context.Context, account *store.Account, attachments []WebAttachment) ([]any, []any, error) {
+	inline := []any{}
+	files := []any{}
+
+	for i := range attachments {
+		a := &attachments[i]
+		if a.isText() {
+			inline = append(inline, map[string]interface{}{
+				"file_name":         a.FileName,
+				"file_type":         a.MimeType,
+				"file_size":         len(a.Data),
+				"extracted_content": string(a.Data),
+			})
+			continue
+		}
+
+		fileUUID, err := h.uploadWebFile(ctx, account, a)
+		if err != nil {
+			return nil, nil, err
+		}
+		files = append(files, fileUUID)
+	}
+
+	return inline, files, nil
+}
+
+// uploadWebFile uploads a file to the account's organization and returns its UUID
+func (h *EnhancedProxyHandler) uploadWebFile(ctx context.Context, account *store.Account, a *WebAttachment) (string, error) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+
+	partHeader := make(textproto.MIMEHeader)
+	partHeader.Set("Content-Disposition", fmt.Sprintf(`form-data; name="file"; filename="%s"`, strings.ReplaceAll(a.FileName, `"`, "")))
+	partHeader.Set("Content-Type", a.MimeType)
+	part, err := writer.CreatePart(partHeader)
+	if err != nil {
+		return "", fmt.Errorf("failed to build upload for %s: %w", a.FileName, err)
+	}
+	if _, err := part.Write(a.Data); err != nil {
+		return "", fmt.Errorf("failed to build upload for %s: %w", a.FileName, err)
+	}
+	if err := writer.Close(); err != nil {
+		return "", fmt.Errorf("failed to build upload for %s: %w", a.FileName, err)
+	}
+
+	uploadURL := fmt.Sprintf("%s/api/%s/upload", h.webURL, account.OrganizationID)
+	req, err := http.NewRequestWithContext(ctx, "POST", uploadURL, &body)
+	if err != nil {
+		return "", fmt.Errorf("failed to create upload request: %w", err)
+	}
+	h.setWebHeaders(req, account)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	var resp *http.Response
+	if h.pool != nil {
+		resp, err = h.pool.Do(req, account.ID)
+	} else {
+		client := &http.Client{Timeout: 30 * time.Second}
+		resp, err = client.Do(req)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to upload %s: %w", a.FileName, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return "", fmt.Errorf("failed to upload %s: status %d: %s", a.FileName, resp.StatusCode, string(respBody))
+	}
+
+	var uploaded webUploadResponse
+	if err := json.Unmarshal(respBody, &uploaded); err != nil || uploaded.FileUUID == "" {
+		return "", fmt.Errorf("failed to upload %s: unexpected response", a.FileName)
+	}
+
+	return uploaded.FileUUID, nil
+}
+
+// withWebAttachments adds prepared attachments and uploaded files to a
+// completion payload
+func withWebAttachments(payload []byte, inline, files []any) []byte {
+	var body map[string]interface{}
+	if err := json.Unmarshal(payload, &body); err != nil {
+		return payload
+	}
+	attachments, _ := body["attachments"].([]interface{})
+	body["attachments"] = append(attachments, inline...)
+	body["files"] = files
+	merged, err := json.Marshal(body)
+	if err != nil {
+		return payload
+	}
+	return merged
+}
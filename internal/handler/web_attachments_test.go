@@ -0,0 +1,242 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"ccproxy/internal/loadbalancer"
+	"ccproxy/internal/store"
+)
+
+func TestParseDataURL(t *testing.T) {
+	mimeType, data, err := parseDataURL("data:text/plain;charset=utf-8;base64," + base64.StdEncoding.EncodeToString([]byte("hello")))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if mimeType != "text/plain" || string(data) != "hello" {
+		t.Errorf("got mime=%q data=%q", mimeType, data)
+	}
+
+	if _, _, err := parseDataURL("https://example.com/cat.png"); err == nil {
+		t.Error("remote URLs should be rejected")
+	}
+	if _, _, err := parseDataURL("data:text/plain,hello"); err == nil {
+		t.Error("non-base64 data URLs should be rejected")
+	}
+}
+
+func TestExtractWebAttachments(t *testing.T) {
+	png := base64.StdEncoding.EncodeToString([]byte("\x89PNG\r\n\x1a\nfake"))
+	notes := base64.StdEncoding.EncodeToString([]byte("some notes"))
+
+	messages := []OpenAIMessage{
+		{Role: "system", Content: "be brief"},
+		{Role: "user", Content: []interface{}{
+			map[string]interface{}{"type": "text", "text": "What is in these files?"},
+			map[string]interface{}{"type": "image_url", "image_url": map[string]interface{}{"url": "data:image/png;base64," + png}},
+			map[string]interface{}{"type": "file", "file": map[string]interface{}{"filename": "notes.txt", "file_data": "data:text/plain;base64," + notes}},
+			// Linked images are not uploaded
+			map[string]interface{}{"type": "image_url", "image_url": map[string]interface{}{"url": "https://example.com/chart.png"}},
+		}},
+	}
+
+	attachments, err := extractWebAttachments(messages)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(attachments) != 2 {
+		t.Fatalf("got %d attachments, want 2", len(attachments))
+	}
+	if attachments[0].MimeType != "image/png" || attachments[0].FileName != "attachment-1.png" || attachments[0].isText() {
+		t.Errorf("unexpected image attachment: %+v", attachments[0])
+	}
+	if attachments[1].FileName != "notes.txt" || !attachments[1].isText() {
+		t.Errorf("unexpected text attachment: %+v", attachments[1])
+	}
+
+	h := &EnhancedProxyHandler{}
+	if parts := h.promptParts(messages); len(parts) != 2 || parts[1] != "What is in these files?" {
+		t.Errorf("prompt parts = %q", parts)
+	}
+}
+
+// newWebChatTestHandler serves chat completions in web mode through one
+// session key account of a claude.ai stand-in
+func newWebChatTestHandler(t *testing.T, webURL string) *gin.Engine {
+	t.Helper()
+	return newChatTestHandler(t, EnhancedProxyConfig{
+		KeyPool:  loadbalancer.NewKeyPool(nil, loadbalancer.StrategyRoundRobin),
+		WebURL:   webURL,
+		PollJobs: NewPollJobStore(),
+	})
+}
+
+// newChatTestHandler serves chat completions with cfg and a store holding one
+// session key account
+func newChatTestHandler(t *testing.T, cfg EnhancedProxyConfig) *gin.Engine {
+	t.Helper()
+	db, err := store.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := db.CreateAccount(&store.Account{
+		ID:             "web-1",
+		Name:           "web",
+		Type:           store.AccountTypeSessionKey,
+		Credentials:    store.Credentials{SessionKey: "sk-ant-sid01-web"},
+		OrganizationID: "org",
+		IsActive:       true,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg.Store = db
+	h := NewEnhancedProxyHandler(cfg)
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/v1/chat/completions", h.ChatCompletions)
+	router.GET("/v1/chat/completions/:id/poll", h.PollCompletion)
+	return router
+}
+
+func TestChatCompletionsWeb_Attachments(t *testing.T) {
+	var mu sync.Mutex
+	var uploads []string
+	var completion map[string]interface{}
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/upload"):
+			file, header, err := r.FormFile("file")
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			file.Close()
+			mu.Lock()
+			uploads = append(uploads, header.Filename)
+			mu.Unlock()
+			io.WriteString(w, `{"file_uuid":"file-1"}`)
+		case strings.HasSuffix(r.URL.Path, "/completion"):
+			mu.Lock()
+			json.NewDecoder(r.Body).Decode(&completion)
+			mu.Unlock()
+			w.Header().Set("Content-Type", "text/event-stream")
+			io.WriteString(w, "data: {\"completion\":\"a chart\"}\n\n")
+		default:
+			w.WriteHeader(http.StatusCreated)
+			io.WriteString(w, `{"uuid":"conv"}`)
+		}
+	}))
+	defer upstream.Close()
+	router := newWebChatTestHandler(t, upstream.URL)
+
+	// The JSON goes in a "request" field, the text file in a content block
+	// and the image in a multipart part
+	notes := base64.StdEncoding.EncodeToString([]byte("some notes"))
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("request", `{"model":"claude-sonnet-4","messages":[{"role":"user","content":[`+
+		`{"type":"text","text":"What is in these files?"},`+
+		`{"type":"image_url","image_url":{"url":"https://example.com/linked.png"}},`+
+		`{"type":"file","file":{"filename":"notes.txt","file_data":"data:text/plain;base64,`+notes+`"}}]}]}`)
+	part, _ := form.CreateFormFile("files", "chart.png")
+	part.Write([]byte("\x89PNG\r\n\x1a\nfake"))
+	form.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "a chart") {
+		t.Fatalf("got %d %s", w.Code, w.Body.String())
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(uploads) != 1 || uploads[0] != "chart.png" {
+		t.Errorf("uploads = %v, want only the image", uploads)
+	}
+	if files, _ := completion["files"].([]interface{}); len(files) != 1 || files[0] != "file-1" {
+		t.Errorf("completion files = %v", completion["files"])
+	}
+	attachments, _ := completion["attachments"].([]interface{})
+	if len(attachments) != 1 || attachments[0].(map[string]interface{})["extracted_content"] != "some notes" {
+		t.Errorf("completion attachments = %v", attachments)
+	}
+	if prompt, _ := completion["prompt"].(string); !strings.Contains(prompt, "What is in these files?") {
+		t.Errorf("completion prompt = %q", prompt)
+	}
+}
+
+func TestChatCompletions_FilesRequireWebMode(t *testing.T) {
+	router := newWebChatTestHandler(t, "http://127.0.0.1:0")
+	notes := base64.StdEncoding.EncodeToString([]byte("some notes"))
+	body := `{"model":"claude-sonnet-4","messages":[{"role":"user","content":[{"type":"file","file":{"filename":"notes.txt","file_data":"data:text/plain;base64,` + notes + `"}}]}]}`
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Proxy-Mode", "api")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "web mode") {
+		t.Errorf("got %d %s, want a 400 asking for web mode", w.Code, w.Body.String())
+	}
+}
+
+func TestChatCompletionsAPI_ImageBlocks(t *testing.T) {
+	var sent AnthropicRequest
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&sent)
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"id":"msg_1","type":"message","role":"assistant","content":[{"type":"text","text":"two charts"}],"stop_reason":"end_turn","usage":{"input_tokens":10,"output_tokens":2}}`)
+	}))
+	defer upstream.Close()
+	router := newChatTestHandler(t, EnhancedProxyConfig{
+		KeyPool: loadbalancer.NewKeyPool([]string{"sk-ant-api03-test"}, loadbalancer.StrategyRoundRobin),
+		APIURL:  upstream.URL,
+	})
+
+	png := base64.StdEncoding.EncodeToString([]byte("\x89PNG\r\n\x1a\nfake"))
+	body := `{"model":"claude-sonnet-4","messages":[{"role":"user","content":[` +
+		`{"type":"text","text":"Compare these"},` +
+		`{"type":"image_url","image_url":{"url":"data:image/png;base64,` + png + `"}},` +
+		`{"type":"image_url","image_url":{"url":"https://example.com/chart.png"}}]}]}`
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Proxy-Mode", "api")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "two charts") {
+		t.Fatalf("got %d %s", w.Code, w.Body.String())
+	}
+	blocks, _ := sent.Messages[0].Content.([]interface{})
+	if len(blocks) != 3 {
+		t.Fatalf("content = %v", sent.Messages[0].Content)
+	}
+	wantSources := []map[string]interface{}{
+		{"type": "base64", "media_type": "image/png", "data": png},
+		{"type": "url", "url": "https://example.com/chart.png"},
+	}
+	for i, want := range wantSources {
+		block := blocks[i+1].(map[string]interface{})
+		source, _ := block["source"].(map[string]interface{})
+		if block["type"] != "image" || fmt.Sprint(source) != fmt.Sprint(want) {
+			t.Errorf("block %d = %v, want an image with source %v", i+1, block, want)
+		}
+	}
+}
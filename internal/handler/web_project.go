@@ -0,0 +1,250 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"ccproxy/internal/store"
+)
+
+// webSystemText joins the system messages of a chat request the way they are
+// converted to an Anthropic system prompt
+func webSystemText(messages []OpenAIMessage) string {
+	var system string
+	for _, msg := range messages {
+		if msg.Role == "system" {
+			system = appendToSystem(system, extractTextFromContent(msg.Content))
+		}
+	}
+	return system
+}
+
+// withoutSystemMessages drops system messages that the account's project
+// instructions already carry
+func withoutSystemMessages(messages []OpenAIMessage) []OpenAIMessage {
+	kept := make([]OpenAIMessage, 0, len(messages))
+	for _, msg := range messages {
+		if msg.Role != "system" {
+			kept = append(kept, msg)
+		}
+	}
+	return kept
+}
+
+// webConversationPayload is the body creating a claude.ai conversation, in
+// the account's project if it has one
+func webConversationPayload(convUUID string, account *store.Account) []byte {
+	payload := map[string]interface{}{
+		"uuid": convUUID,
+		"name": "",
+	}
+	if account.Project != nil {
+		payload["project_uuid"] = account.Project.UUID
+	}
+	data, _ := json.Marshal(payload)
+	return data
+}
+
+// claudeProject is a project as returned by claude.ai
+type claudeProject struct {
+	UUID           string `json:"uuid"`
+	Name           string `json:"name"`
+	PromptTemplate string `json:"prompt_template"`
+	IsPrivate      bool   `json:"is_private"`
+	CreatedAt      string `json:"created_at"`
+}
+
+func (p *claudeProject) webProject() *store.WebProject {
+	return &store.WebProject{UUID: p.UUID, Name: p.Name, Instructions: p.PromptTemplate}
+}
+
+// GetAccountProject returns the claude.ai project an account's web mode
+// conversations are created in
+func (h *WebProxyHandler) GetAccountProject(c *gin.Context) {
+	account, ok := h.projectAccount(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"account_id": account.ID, "project": account.Project})
+}
+
+// ListAccountProjects lists the projects of an account's claude.ai organization
+func (h *WebProxyHandler) ListAccountProjects(c *gin.Context) {
+	account, ok := h.projectAccount(c)
+	if !ok {
+		return
+	}
+
+	var projects []claudeProject
+	if status, err := h.projectRequest(c, account, http.MethodGet, "", nil, &projects); err != nil {
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	if projects == nil {
+		projects = []claudeProject{}
+	}
+	c.JSON(http.StatusOK, gin.H{"projects": projects})
+}
+
+// CreateAccountProject creates a private claude.ai project with the given
+// instructions and makes it the account's project
+func (h *WebProxyHandler) CreateAccountProject(c *gin.Context) {
+	account, ok := h.projectAccount(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Name         string `json:"name" binding:"required"`
+		Instructions string `json:"instructions"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var project claudeProject
+	status, err := h.projectRequest(c, account, http.MethodPost, "", map[string]interface{}{
+		"name":        req.Name,
+		"description": "Created by ccproxy",
+		"is_private":  true,
+	}, &project)
+	if err != nil {
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	if project.UUID == "" {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "claude.ai returned no project uuid"})
+		return
+	}
+	if req.Instructions != "" {
+		if status, err := h.setProjectInstructions(c, account, project.UUID, req.Instructions); err != nil {
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+		project.PromptTemplate = req.Instructions
+	}
+
+	h.saveAccountProject(c, account, project.webProject())
+}
+
+// SelectAccountProject makes an existing claude.ai project the account's
+// project, optionally replacing its instructions
+func (h *WebProxyHandler) SelectAccountProject(c *gin.Context) {
+	account, ok := h.projectAccount(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		ProjectUUID string `json:"project_uuid" binding:"required"`
+		// Instructions replaces the project's custom instructions when set
+		Instructions *string `json:"instructions"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var project claudeProject
+	if status, err := h.projectRequest(c, account, http.MethodGet, req.ProjectUUID, nil, &project); err != nil {
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	if project.UUID == "" {
+		project.UUID = req.ProjectUUID
+	}
+	if req.Instructions != nil {
+		if status, err := h.setProjectInstructions(c, account, project.UUID, *req.Instructions); err != nil {
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+		project.PromptTemplate = *req.Instructions
+	}
+
+	h.saveAccountProject(c, account, project.webProject())
+}
+
+// ClearAccountProject stops creating the account's conversations in a
+// project; the project itself is kept on claude.ai
+func (h *WebProxyHandler) ClearAccountProject(c *gin.Context) {
+	account, ok := h.projectAccount(c)
+	if !ok {
+		return
+	}
+	h.saveAccountProject(c, account, nil)
+}
+
+func (h *WebProxyHandler) saveAccountProject(c *gin.Context, account *store.Account, project *store.WebProject) {
+	if err := h.store.SetAccountProject(account.ID, project); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update account project"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"account_id": account.ID, "project": project})
+}
+
+// projectAccount loads the web mode account named in the path for the project endpoints
+func (h *WebProxyHandler) projectAccount(c *gin.Context) (*store.Account, bool) {
+	account, err := h.store.GetAccount(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get account"})
+		return nil, false
+	}
+	if account == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "account not found"})
+		return nil, false
+	}
+	if account.Type == store.AccountTypeAPIKey {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "projects are only available to web mode accounts"})
+		return nil, false
+	}
+	if account.OrganizationID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "account has no organization"})
+		return nil, false
+	}
+	return account, true
+}
+
+func (h *WebProxyHandler) setProjectInstructions(c *gin.Context, account *store.Account, projectUUID, instructions string) (int, error) {
+	return h.projectRequest(c, account, http.MethodPut, projectUUID, map[string]interface{}{
+		"prompt_template": instructions,
+	}, nil)
+}
+
+// projectRequest calls the claude.ai projects API of the account's
+// organization. It returns the status to answer with when it fails.
+func (h *WebProxyHandler) projectRequest(c *gin.Context, account *store.Account, method, projectUUID string, body, result interface{}) (int, error) {
+	url := fmt.Sprintf("%s/api/organizations/%s/projects", h.webURL, account.OrganizationID)
+	if projectUUID != "" {
+		url += "/" + projectUUID
+	}
+
+	r := h.reqClient.R().SetContext(c.Request.Context())
+	h.setReqHeaders(r, account)
+	if body != nil {
+		payload, _ := json.Marshal(body)
+		r.SetBodyBytes(payload)
+		r.SetHeader("Content-Type", "application/json")
+	}
+
+	resp, err := r.Send(method, url)
+	if err != nil {
+		return http.StatusBadGateway, fmt.Errorf("failed to connect to claude.ai: %w", err)
+	}
+	if resp.StatusCode == http.StatusNotFound && projectUUID != "" {
+		return http.StatusNotFound, fmt.Errorf("project %s not found", projectUUID)
+	}
+	if !resp.IsSuccessState() {
+		return http.StatusBadGateway, fmt.Errorf("claude.ai returned status %d: %s", resp.StatusCode, strings.TrimSpace(resp.String()))
+	}
+	if result != nil {
+		if err := json.Unmarshal(resp.Bytes(), result); err != nil {
+			return http.StatusBadGateway, fmt.Errorf("invalid claude.ai response: %w", err)
+		}
+	}
+	return http.StatusOK, nil
+}
@@ -0,0 +1,139 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"ccproxy/internal/store"
+)
+
+// fakeProjectsAPI serves the claude.ai projects API of organization org-1
+type fakeProjectsAPI struct {
+	mu       sync.Mutex
+	projects map[string]*claudeProject
+}
+
+func (f *fakeProjectsAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	const base = "/api/organizations/org-1/projects"
+	body, _ := io.ReadAll(r.Body)
+	switch {
+	case r.URL.Path == base && r.Method == http.MethodPost:
+		var req claudeProject
+		json.Unmarshal(body, &req)
+		req.UUID = "proj-new"
+		f.projects[req.UUID] = &req
+		json.NewEncoder(w).Encode(req)
+	case r.URL.Path == base && r.Method == http.MethodGet:
+		list := []*claudeProject{}
+		for _, p := range f.projects {
+			list = append(list, p)
+		}
+		json.NewEncoder(w).Encode(list)
+	default:
+		p, ok := f.projects[r.URL.Path[len(base)+1:]]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.Method == http.MethodPut {
+			var req claudeProject
+			json.Unmarshal(body, &req)
+			p.PromptTemplate = req.PromptTemplate
+		}
+		json.NewEncoder(w).Encode(p)
+	}
+}
+
+func TestWebProxyHandler_AccountProject(t *testing.T) {
+	router, db := newAccountTestRouter(t)
+	upstream := &fakeProjectsAPI{projects: map[string]*claudeProject{
+		"proj-existing": {UUID: "proj-existing", Name: "Existing", PromptTemplate: "Be brief."},
+	}}
+	server := httptest.NewServer(upstream)
+	defer server.Close()
+
+	web := NewWebProxyHandler(db, server.URL)
+	router.GET("/account/:id/project", web.GetAccountProject)
+	router.POST("/account/:id/project", web.CreateAccountProject)
+	router.PUT("/account/:id/project", web.SelectAccountProject)
+	router.DELETE("/account/:id/project", web.ClearAccountProject)
+	router.GET("/account/:id/projects", web.ListAccountProjects)
+
+	if err := db.CreateAccount(&store.Account{
+		ID:             "acc-1",
+		Name:           "web",
+		Type:           store.AccountTypeSessionKey,
+		Credentials:    store.Credentials{SessionKey: "sk-ant-sid01-test"},
+		OrganizationID: "org-1",
+		CreatedAt:      time.Now(),
+		IsActive:       true,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	code, resp := doJSON(t, router, http.MethodPost, "/account/acc-1/project", `{"name":"ccproxy","instructions":"You are terse."}`)
+	if code != http.StatusOK {
+		t.Fatalf("create project: %d %v", code, resp)
+	}
+	if upstream.projects["proj-new"].PromptTemplate != "You are terse." {
+		t.Errorf("instructions not set upstream: %+v", upstream.projects["proj-new"])
+	}
+	account, _ := db.GetAccount("acc-1")
+	if account.Project == nil || account.Project.UUID != "proj-new" || account.Project.Instructions != "You are terse." {
+		t.Fatalf("stored project = %+v", account.Project)
+	}
+
+	// Conversations are created in the project, and matching system prompts
+	// are no longer inlined
+	var payload map[string]interface{}
+	json.Unmarshal(webConversationPayload("conv-1", account), &payload)
+	if payload["project_uuid"] != "proj-new" {
+		t.Errorf("conversation payload = %v", payload)
+	}
+	messages := []OpenAIMessage{
+		{Role: "system", Content: "You are terse."},
+		{Role: "user", Content: "hi"},
+	}
+	if !account.Project.CoversSystem(webSystemText(messages)) || len(withoutSystemMessages(messages)) != 1 {
+		t.Error("project instructions do not cover the matching system prompt")
+	}
+	if account.Project.CoversSystem("Something else") {
+		t.Error("project instructions cover a different system prompt")
+	}
+
+	// Select an existing project, keeping its instructions
+	code, resp = doJSON(t, router, http.MethodPut, "/account/acc-1/project", `{"project_uuid":"proj-existing"}`)
+	if code != http.StatusOK {
+		t.Fatalf("select project: %d %v", code, resp)
+	}
+	if project := resp["project"].(map[string]interface{}); project["instructions"] != "Be brief." || project["name"] != "Existing" {
+		t.Errorf("selected project = %v", project)
+	}
+	if code, _ := doJSON(t, router, http.MethodPut, "/account/acc-1/project", `{"project_uuid":"proj-missing"}`); code != http.StatusNotFound {
+		t.Errorf("unknown project: got %d", code)
+	}
+
+	code, resp = doJSON(t, router, http.MethodGet, "/account/acc-1/projects", "")
+	if code != http.StatusOK || len(resp["projects"].([]interface{})) != 2 {
+		t.Errorf("list projects: %d %v", code, resp)
+	}
+
+	if code, _ := doJSON(t, router, http.MethodDelete, "/account/acc-1/project", ""); code != http.StatusOK {
+		t.Errorf("clear project: got %d", code)
+	}
+	account, _ = db.GetAccount("acc-1")
+	if account.Project != nil {
+		t.Errorf("project not cleared: %+v", account.Project)
+	}
+	if _, ok := upstream.projects["proj-existing"]; !ok {
+		t.Error("clearing the selection deleted the upstream project")
+	}
+}
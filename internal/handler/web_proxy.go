@@ -14,6 +14,7 @@ import (
 	"github.com/rs/zerolog/log"
 
 	"ccproxy/internal/httpclient"
+	"ccproxy/internal/service"
 	"ccproxy/internal/store"
 )
 
@@ -21,6 +22,7 @@ type WebProxyHandler struct {
 	store     *store.Store
 	webURL    string
 	reqClient *req.Client
+	beta      *service.BetaHeaders
 }
 
 func NewWebProxyHandler(store *store.Store, webURL string) *WebProxyHandler {
@@ -31,6 +33,11 @@ func NewWebProxyHandler(store *store.Store, webURL string) *WebProxyHandler {
 	}
 }
 
+// SetBetaHeaders sets the anthropic-beta header profiles
+func (h *WebProxyHandler) SetBetaHeaders(beta *service.BetaHeaders) {
+	h.beta = beta
+}
+
 // Claude.ai conversation structures
 type WebConversation struct {
 	UUID      string `json:"uuid"`
@@ -288,12 +295,13 @@ func (h *WebProxyHandler) setReqHeaders(r *req.Request, account *store.Account)
 	if account.IsOAuth() {
 		// OAuth accounts use Bearer token
 		r.SetHeader("Authorization", "Bearer "+account.Credentials.AccessToken)
-		// Add complete OAuth beta flags (matches sub2api's DefaultBetaHeader)
-		// Includes: claude-code, oauth, interleaved-thinking, fine-grained-tool-streaming
-		r.SetHeader("anthropic-beta", "claude-code-20250219,oauth-2025-04-20,interleaved-thinking-2025-05-14,fine-grained-tool-streaming-2025-05-14")
-	} else {
-		// Session key accounts use Cookie
-		r.SetHeader("Cookie", fmt.Sprintf("sessionKey=%s", account.Credentials.SessionKey))
+		// Add the default OAuth beta profile
+		r.SetHeader("anthropic-beta", h.beta.Resolve(account, "", ""))
+	}
+	// Session key accounts authenticate with the Cookie, which also carries
+	// the account's extra cookies
+	if cookie := account.WebCookieHeader(); cookie != "" {
+		r.SetHeader("Cookie", cookie)
 	}
 }
 
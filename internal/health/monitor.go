@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/rs/zerolog/log"
@@ -19,6 +20,10 @@ type HealthConfig struct {
 	CheckInterval      time.Duration `mapstructure:"check_interval"`
 	TokenRefreshBefore time.Duration `mapstructure:"token_refresh_before"`
 	Timeout            time.Duration `mapstructure:"timeout"`
+	// PrewarmConcurrency bounds the refreshes run at once by the startup
+	// pre-warm pass, 0 disables the pass
+	PrewarmConcurrency int           `mapstructure:"prewarm_concurrency"`
+	PrewarmTimeout     time.Duration `mapstructure:"prewarm_timeout"`
 }
 
 // DefaultHealthConfig returns the default health configuration
@@ -28,6 +33,8 @@ func DefaultHealthConfig() HealthConfig {
 		CheckInterval:      5 * time.Minute,
 		TokenRefreshBefore: 30 * time.Minute,
 		Timeout:            30 * time.Second,
+		PrewarmConcurrency: 4,
+		PrewarmTimeout:     30 * time.Second,
 	}
 }
 
@@ -50,6 +57,8 @@ type Monitor interface {
 	CheckAccount(ctx context.Context, accountID string) (*CheckResult, error)
 	// CheckAll performs health checks on all accounts
 	CheckAll(ctx context.Context) ([]*CheckResult, error)
+	// HealthScore returns the last computed health score (0-100) for an account
+	HealthScore(accountID string) int
 	// Stats returns monitor statistics
 	Stats() MonitorStats
 }
@@ -60,6 +69,7 @@ type MonitorStats struct {
 	HealthyAccounts int   `json:"healthy_accounts"`
 	UnhealthyAccounts int `json:"unhealthy_accounts"`
 	LastCheckAt     time.Time `json:"last_check_at,omitempty"`
+	Scores          map[string]int `json:"scores"`
 }
 
 // AccountChecker defines the interface for checking account health
@@ -87,6 +97,7 @@ type monitor struct {
 
 	totalChecks       int64
 	healthyAccounts   map[string]bool
+	scores            map[string]int
 	lastCheckAt       time.Time
 	mu                sync.RWMutex
 
@@ -103,6 +114,7 @@ func NewMonitor(config HealthConfig, st *store.Store, circuitMgr circuit.Manager
 		circuitMgr:      circuitMgr,
 		refresher:       refresher,
 		healthyAccounts: make(map[string]bool),
+		scores:          make(map[string]int),
 		httpClient: &http.Client{
 			Timeout: config.Timeout,
 		},
@@ -118,6 +130,10 @@ func (m *monitor) Start(ctx context.Context) error {
 
 	m.ctx, m.cancel = context.WithCancel(ctx)
 
+	// Refresh expiring tokens before traffic arrives, so the first requests
+	// after a deploy do not wait for them
+	m.prewarm()
+
 	// Start background check goroutine
 	m.wg.Add(1)
 	go m.backgroundCheck()
@@ -198,12 +214,29 @@ func (m *monitor) Stats() MonitorStats {
 		}
 	}
 
+	scores := make(map[string]int, len(m.scores))
+	for id, score := range m.scores {
+		scores[id] = score
+	}
+
 	return MonitorStats{
 		TotalChecks:       m.totalChecks,
 		HealthyAccounts:   healthy,
 		UnhealthyAccounts: unhealthy,
 		LastCheckAt:       m.lastCheckAt,
+		Scores:            scores,
+	}
+}
+
+// HealthScore returns the last computed health score for an account
+func (m *monitor) HealthScore(accountID string) int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if score, ok := m.scores[accountID]; ok {
+		return score
 	}
+	return MaxHealthScore
 }
 
 // checkAccountHealth performs the actual health check
@@ -266,14 +299,62 @@ func (m *monitor) checkAccountHealth(ctx context.Context, account *store.Account
 		_ = m.store.IncrementAccountSuccess(account.ID)
 	}
 
+	if recordErr := m.store.RecordHealthCheck(&store.HealthCheckRecord{
+		AccountID: account.ID,
+		Healthy:   result.Healthy,
+		LatencyMs: result.Latency.Milliseconds(),
+		Error:     result.Error,
+		Source:    store.HealthCheckSourceMonitor,
+		CheckedAt: result.CheckedAt,
+	}); recordErr != nil {
+		log.Warn().Err(recordErr).Str("account_id", account.ID).Msg("failed to record health check")
+	}
+
+	score := m.computeScore(account, err != nil)
+	_ = m.store.UpdateAccountHealthScore(account.ID, score)
+
 	// Update local cache
 	m.mu.Lock()
 	m.healthyAccounts[account.ID] = result.Healthy
+	m.scores[account.ID] = score
 	m.mu.Unlock()
 
 	return result
 }
 
+// computeScore combines recent request outcomes, token expiry and circuit state into a health score
+func (m *monitor) computeScore(account *store.Account, checkFailed bool) int {
+	inputs := ScoreInputs{
+		ExpiresAt:     account.ExpiresAt,
+		RefreshBefore: m.config.TokenRefreshBefore,
+		CheckFailed:   checkFailed,
+		Now:           time.Now(),
+	}
+
+	signals, err := m.store.GetAccountHealthSignals(account.ID, inputs.Now.Add(-scoreWindow))
+	if err != nil {
+		log.Warn().Err(err).Str("account_id", account.ID).Msg("failed to load health signals")
+	} else {
+		inputs.TotalRequests = signals.TotalRequests
+		inputs.FailedRequests = signals.FailedRequests
+		inputs.RateLimited = signals.RateLimited
+		inputs.Overloaded = signals.Overloaded
+		inputs.P95Latency = time.Duration(signals.P95LatencyMs) * time.Millisecond
+	}
+
+	if m.circuitMgr != nil {
+		inputs.CircuitState = m.circuitMgr.GetBreaker(account.ID).State()
+	}
+
+	breakdown := ComputeScore(inputs)
+	log.Debug().
+		Str("account_id", account.ID).
+		Int("score", breakdown.Score).
+		Msg("account health score computed")
+
+	return breakdown.Score
+}
+
 // checkOAuthAccount checks an OAuth account
 func (m *monitor) checkOAuthAccount(ctx context.Context, account *store.Account) error {
 	if account.Credentials.AccessToken == "" {
@@ -323,7 +404,7 @@ func (m *monitor) checkSessionKeyAccount(ctx context.Context, account *store.Acc
 		return fmt.Errorf("failed to create request: %w", err)
 	}
 
-	req.Header.Set("Cookie", fmt.Sprintf("sessionKey=%s", account.Credentials.SessionKey))
+	req.Header.Set("Cookie", account.WebCookieHeader())
 	req.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36")
 
 	resp, err := m.httpClient.Do(req)
@@ -385,6 +466,13 @@ func (m *monitor) backgroundCheck() {
 			m.lastCheckAt = time.Now()
 			m.mu.Unlock()
 
+			if _, err := m.store.DeleteOldHealthHistory(healthHistoryDays); err != nil {
+				log.Warn().Err(err).Msg("failed to prune health score history")
+			}
+			if _, err := m.store.DeleteOldHealthChecks(healthHistoryDays); err != nil {
+				log.Warn().Err(err).Msg("failed to prune health check history")
+			}
+
 			log.Info().
 				Int("total", len(results)).
 				Int("healthy", healthy).
@@ -415,18 +503,15 @@ func (m *monitor) backgroundRefresh() {
 	}
 }
 
-// refreshExpiringSoon refreshes tokens that are about to expire
-func (m *monitor) refreshExpiringSoon() {
-	if m.refresher == nil {
-		return
-	}
-
+// expiringAccounts returns the active OAuth accounts whose tokens expire
+// within the refresh window
+func (m *monitor) expiringAccounts() ([]*store.Account, error) {
 	accounts, err := m.store.ListAccounts()
 	if err != nil {
-		log.Error().Err(err).Msg("failed to list accounts for refresh")
-		return
+		return nil, err
 	}
 
+	expiring := make([]*store.Account, 0, len(accounts))
 	for _, account := range accounts {
 		if !account.IsActive || !account.IsOAuth() {
 			continue
@@ -436,15 +521,30 @@ func (m *monitor) refreshExpiringSoon() {
 		if account.ExpiresAt == nil {
 			continue
 		}
-
-		expiresIn := time.Until(*account.ExpiresAt)
-		if expiresIn > m.config.TokenRefreshBefore {
+		if time.Until(*account.ExpiresAt) > m.config.TokenRefreshBefore {
 			continue
 		}
+		expiring = append(expiring, account)
+	}
+	return expiring, nil
+}
+
+// refreshExpiringSoon refreshes tokens that are about to expire
+func (m *monitor) refreshExpiringSoon() {
+	if m.refresher == nil {
+		return
+	}
+
+	accounts, err := m.expiringAccounts()
+	if err != nil {
+		log.Error().Err(err).Msg("failed to list accounts for refresh")
+		return
+	}
 
+	for _, account := range accounts {
 		log.Info().
 			Str("account_id", account.ID).
-			Dur("expires_in", expiresIn).
+			Dur("expires_in", time.Until(*account.ExpiresAt)).
 			Msg("refreshing expiring token")
 
 		if err := m.refresher.RefreshToken(m.ctx, account.ID); err != nil {
@@ -455,3 +555,78 @@ func (m *monitor) refreshExpiringSoon() {
 		}
 	}
 }
+
+// prewarm refreshes every token expiring within the refresh window, at most
+// PrewarmConcurrency at a time. It gives up waiting after PrewarmTimeout;
+// refreshes still running then finish in the background and accounts not yet
+// started are left to the periodic refresh.
+func (m *monitor) prewarm() {
+	if m.refresher == nil || m.config.PrewarmConcurrency <= 0 {
+		return
+	}
+
+	accounts, err := m.expiringAccounts()
+	if err != nil {
+		log.Error().Err(err).Msg("failed to list accounts for pre-warm")
+		return
+	}
+	if len(accounts) == 0 {
+		return
+	}
+
+	ctx := m.ctx
+	if m.config.PrewarmTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(m.ctx, m.config.PrewarmTimeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	var refreshed, failed atomic.Int64
+	sem := make(chan struct{}, m.config.PrewarmConcurrency)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		var wg sync.WaitGroup
+		for _, account := range accounts {
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+			}
+			if ctx.Err() != nil {
+				break
+			}
+			wg.Add(1)
+			go func(account *store.Account) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				if err := m.refresher.RefreshToken(m.ctx, account.ID); err != nil {
+					failed.Add(1)
+					log.Error().Str("account_id", account.ID).Err(err).Msg("failed to pre-warm token")
+					return
+				}
+				refreshed.Add(1)
+			}(account)
+		}
+		wg.Wait()
+	}()
+
+	timedOut := false
+	select {
+	case <-done:
+	case <-ctx.Done():
+		timedOut = true
+	}
+
+	event := log.Info()
+	if timedOut {
+		event = log.Warn()
+	}
+	event.
+		Int("expiring", len(accounts)).
+		Int64("refreshed", refreshed.Load()).
+		Int64("failed", failed.Load()).
+		Bool("timed_out", timedOut).
+		Dur("duration", time.Since(start)).
+		Msg("pre-warmed account tokens")
+}
@@ -0,0 +1,142 @@
+package health
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"ccproxy/internal/store"
+)
+
+// fakeRefresher records refreshes and the most that ran at once
+type fakeRefresher struct {
+	delay time.Duration
+
+	mu        sync.Mutex
+	refreshed []string
+	running   int
+	peak      int
+}
+
+func (r *fakeRefresher) RefreshToken(ctx context.Context, accountID string) error {
+	r.mu.Lock()
+	r.running++
+	if r.running > r.peak {
+		r.peak = r.running
+	}
+	r.mu.Unlock()
+
+	time.Sleep(r.delay)
+
+	r.mu.Lock()
+	r.running--
+	r.refreshed = append(r.refreshed, accountID)
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *fakeRefresher) NeedsRefresh(account *store.Account) bool {
+	return account.NeedsRefresh()
+}
+
+func newPrewarmStore(t *testing.T, expiresIn ...time.Duration) *store.Store {
+	t.Helper()
+	db, err := store.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	for i, d := range expiresIn {
+		expiresAt := time.Now().Add(d)
+		account := &store.Account{
+			ID:        "acc-" + string(rune('a'+i)),
+			Name:      "account",
+			Type:      store.AccountTypeOAuth,
+			ExpiresAt: &expiresAt,
+			Status:    store.AccountStatusActive,
+			IsActive:  true,
+		}
+		if err := db.CreateAccount(account); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db
+}
+
+func TestMonitor_Prewarm(t *testing.T) {
+	// Five accounts expire within the window, one does not
+	db := newPrewarmStore(t, time.Minute, 5*time.Minute, 10*time.Minute, 20*time.Minute, -time.Minute, 2*time.Hour)
+	refresher := &fakeRefresher{delay: 20 * time.Millisecond}
+	m := &monitor{
+		config: HealthConfig{
+			TokenRefreshBefore: 30 * time.Minute,
+			PrewarmConcurrency: 2,
+			PrewarmTimeout:     5 * time.Second,
+		},
+		store:     db,
+		refresher: refresher,
+		ctx:       context.Background(),
+	}
+
+	m.prewarm()
+
+	if len(refresher.refreshed) != 5 {
+		t.Errorf("refreshed %v, want the 5 expiring accounts", refresher.refreshed)
+	}
+	for _, id := range refresher.refreshed {
+		if id == "acc-f" {
+			t.Errorf("account outside the refresh window was refreshed")
+		}
+	}
+	if refresher.peak != 2 {
+		t.Errorf("peak concurrency = %d, want 2", refresher.peak)
+	}
+}
+
+func TestMonitor_PrewarmTimeout(t *testing.T) {
+	db := newPrewarmStore(t, time.Minute, time.Minute, time.Minute)
+	refresher := &fakeRefresher{delay: 200 * time.Millisecond}
+	m := &monitor{
+		config: HealthConfig{
+			TokenRefreshBefore: 30 * time.Minute,
+			PrewarmConcurrency: 1,
+			PrewarmTimeout:     50 * time.Millisecond,
+		},
+		store:     db,
+		refresher: refresher,
+		ctx:       context.Background(),
+	}
+
+	start := time.Now()
+	m.prewarm()
+	if elapsed := time.Since(start); elapsed > 150*time.Millisecond {
+		t.Errorf("pre-warm waited %v, want it to stop at the timeout", elapsed)
+	}
+
+	// The refresh already running finishes; the others are not started
+	time.Sleep(300 * time.Millisecond)
+	refresher.mu.Lock()
+	defer refresher.mu.Unlock()
+	if len(refresher.refreshed) != 1 {
+		t.Errorf("refreshed %v after the timeout, want only the running one", refresher.refreshed)
+	}
+}
+
+func TestMonitor_PrewarmDisabled(t *testing.T) {
+	db := newPrewarmStore(t, time.Minute)
+	refresher := &fakeRefresher{}
+	m := &monitor{
+		config:    HealthConfig{TokenRefreshBefore: 30 * time.Minute},
+		store:     db,
+		refresher: refresher,
+		ctx:       context.Background(),
+	}
+
+	m.prewarm()
+	if len(refresher.refreshed) != 0 {
+		t.Errorf("refreshed %v with pre-warm disabled", refresher.refreshed)
+	}
+}
@@ -0,0 +1,112 @@
+package health
+
+import (
+	"time"
+
+	"ccproxy/internal/circuit"
+)
+
+const (
+	// MaxHealthScore is the score of a fully healthy account
+	MaxHealthScore = 100
+
+	// scoreWindow is how far back request logs are considered for scoring
+	scoreWindow = 1 * time.Hour
+	// minScoreSamples is the request count at which the error rate is fully trusted
+	minScoreSamples = 5
+	// healthHistoryDays is how long health score history is retained
+	healthHistoryDays = 30
+)
+
+// ScoreInputs holds the signals combined into a health score
+type ScoreInputs struct {
+	TotalRequests  int
+	FailedRequests int
+	RateLimited    int // 429 responses
+	Overloaded     int // 529 responses
+	P95Latency     time.Duration
+	ExpiresAt      *time.Time // OAuth token expiry, nil if not applicable
+	RefreshBefore  time.Duration
+	CircuitState   circuit.State
+	CheckFailed    bool
+	Now            time.Time
+}
+
+// ScoreBreakdown is a health score with the penalty applied by each signal
+type ScoreBreakdown struct {
+	Score          int `json:"score"`
+	ErrorPenalty   int `json:"error_penalty"`
+	LatencyPenalty int `json:"latency_penalty"`
+	LimitPenalty   int `json:"limit_penalty"`
+	ExpiryPenalty  int `json:"expiry_penalty"`
+	CircuitPenalty int `json:"circuit_penalty"`
+	CheckPenalty   int `json:"check_penalty"`
+}
+
+// ComputeScore combines account signals into a 0-100 health score
+func ComputeScore(in ScoreInputs) ScoreBreakdown {
+	var b ScoreBreakdown
+
+	// Error rate: up to 35 points, scaled down when there are few samples
+	if in.TotalRequests > 0 {
+		rate := float64(in.FailedRequests) / float64(in.TotalRequests)
+		confidence := float64(in.TotalRequests) / minScoreSamples
+		if confidence > 1 {
+			confidence = 1
+		}
+		b.ErrorPenalty = int(rate*35*confidence + 0.5)
+	}
+
+	// p95 latency: free up to 10s, then linear up to 15 points at 60s
+	if in.P95Latency > 10*time.Second {
+		over := (in.P95Latency - 10*time.Second).Seconds() / 50
+		if over > 1 {
+			over = 1
+		}
+		b.LatencyPenalty = int(over*15 + 0.5)
+	}
+
+	// Recent 429s and 529s: up to 20 points
+	b.LimitPenalty = in.RateLimited*5 + in.Overloaded*3
+	if b.LimitPenalty > 20 {
+		b.LimitPenalty = 20
+	}
+
+	// Token expiry proximity
+	if in.ExpiresAt != nil {
+		now := in.Now
+		if now.IsZero() {
+			now = time.Now()
+		}
+		expiresIn := in.ExpiresAt.Sub(now)
+		switch {
+		case expiresIn <= 0:
+			b.ExpiryPenalty = 15
+		case expiresIn < 5*time.Minute:
+			b.ExpiryPenalty = 10
+		case expiresIn < in.RefreshBefore:
+			b.ExpiryPenalty = 5
+		}
+	}
+
+	// Circuit state
+	switch in.CircuitState {
+	case circuit.StateOpen:
+		b.CircuitPenalty = 30
+	case circuit.StateHalfOpen:
+		b.CircuitPenalty = 15
+	}
+
+	if in.CheckFailed {
+		b.CheckPenalty = 20
+	}
+
+	score := MaxHealthScore - b.ErrorPenalty - b.LatencyPenalty - b.LimitPenalty -
+		b.ExpiryPenalty - b.CircuitPenalty - b.CheckPenalty
+	if score < 0 {
+		score = 0
+	}
+	b.Score = score
+
+	return b
+}
@@ -0,0 +1,65 @@
+package health
+
+import (
+	"testing"
+	"time"
+
+	"ccproxy/internal/circuit"
+)
+
+func TestComputeScore_Healthy(t *testing.T) {
+	b := ComputeScore(ScoreInputs{TotalRequests: 100, P95Latency: 2 * time.Second})
+	if b.Score != MaxHealthScore {
+		t.Errorf("expected score %d, got %d", MaxHealthScore, b.Score)
+	}
+}
+
+func TestComputeScore_Penalties(t *testing.T) {
+	now := time.Now()
+	expiresAt := now.Add(2 * time.Minute)
+
+	b := ComputeScore(ScoreInputs{
+		TotalRequests:  10,
+		FailedRequests: 2,
+		RateLimited:    1,
+		Overloaded:     1,
+		P95Latency:     35 * time.Second,
+		ExpiresAt:      &expiresAt,
+		RefreshBefore:  30 * time.Minute,
+		CircuitState:   circuit.StateHalfOpen,
+		Now:            now,
+	})
+
+	if b.ErrorPenalty != 7 {
+		t.Errorf("error penalty = %d, want 7", b.ErrorPenalty)
+	}
+	if b.LatencyPenalty != 8 {
+		t.Errorf("latency penalty = %d, want 8", b.LatencyPenalty)
+	}
+	if b.LimitPenalty != 8 {
+		t.Errorf("limit penalty = %d, want 8", b.LimitPenalty)
+	}
+	if b.ExpiryPenalty != 10 {
+		t.Errorf("expiry penalty = %d, want 10", b.ExpiryPenalty)
+	}
+	if b.CircuitPenalty != 15 {
+		t.Errorf("circuit penalty = %d, want 15", b.CircuitPenalty)
+	}
+	if b.Score != 52 {
+		t.Errorf("score = %d, want 52", b.Score)
+	}
+}
+
+func TestComputeScore_ClampsAtZero(t *testing.T) {
+	b := ComputeScore(ScoreInputs{
+		TotalRequests:  10,
+		FailedRequests: 10,
+		RateLimited:    10,
+		P95Latency:     2 * time.Minute,
+		CircuitState:   circuit.StateOpen,
+		CheckFailed:    true,
+	})
+	if b.Score != 0 {
+		t.Errorf("expected score 0, got %d", b.Score)
+	}
+}
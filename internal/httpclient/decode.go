@@ -0,0 +1,118 @@
+package httpclient
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// DecodeResponseBody replaces resp.Body with a reader that undoes its
+// Content-Encoding, so SSE scanners see plain events whatever encoding the
+// upstream negotiated. gzip, deflate, br and zstd are supported; encodings
+// applied in sequence ("gzip, br") are undone in reverse order. Decoding
+// starts on the first Read, so an empty error body does not fail here.
+//
+// On success Content-Encoding and Content-Length are removed from the
+// response. An unsupported encoding returns an error and leaves resp as is.
+func DecodeResponseBody(resp *http.Response) error {
+	var encodings []string
+	for _, value := range resp.Header.Values("Content-Encoding") {
+		for _, enc := range strings.Split(value, ",") {
+			enc = strings.ToLower(strings.TrimSpace(enc))
+			if enc != "" && enc != "identity" {
+				encodings = append(encodings, enc)
+			}
+		}
+	}
+	if len(encodings) == 0 {
+		return nil
+	}
+
+	for _, enc := range encodings {
+		if _, ok := decoders[enc]; !ok {
+			return fmt.Errorf("unsupported content encoding %q", enc)
+		}
+	}
+
+	body := resp.Body
+	for i := len(encodings) - 1; i >= 0; i-- {
+		body = &decodingReader{src: body, open: decoders[encodings[i]]}
+	}
+
+	resp.Body = body
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	return nil
+}
+
+// decoders open a decompressing reader by Content-Encoding token
+var decoders = map[string]func(io.Reader) (io.ReadCloser, error){
+	"gzip":   openGzip,
+	"x-gzip": openGzip,
+	"deflate": func(r io.Reader) (io.ReadCloser, error) {
+		// "deflate" should be zlib-wrapped, but some servers send raw deflate
+		br := bufio.NewReader(r)
+		if header, err := br.Peek(2); err == nil && isZlibHeader(header) {
+			return zlib.NewReader(br)
+		}
+		return flate.NewReader(br), nil
+	},
+	"br": func(r io.Reader) (io.ReadCloser, error) {
+		return io.NopCloser(brotli.NewReader(r)), nil
+	},
+	"zstd": func(r io.Reader) (io.ReadCloser, error) {
+		// A single goroutine decodes block by block, so events are not held back
+		d, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		return d.IOReadCloser(), nil
+	},
+}
+
+func openGzip(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+// isZlibHeader reports whether b starts a zlib stream (RFC 1950): deflate
+// compression method and a header checksum divisible by 31
+func isZlibHeader(b []byte) bool {
+	return b[0]&0x0f == 8 && (uint16(b[0])<<8|uint16(b[1]))%31 == 0
+}
+
+// decodingReader opens its decoder on the first Read and closes both the
+// decoder and the underlying body on Close
+type decodingReader struct {
+	src  io.ReadCloser
+	open func(io.Reader) (io.ReadCloser, error)
+
+	dec io.ReadCloser
+	err error // sticky error from open
+}
+
+func (d *decodingReader) Read(p []byte) (int, error) {
+	if d.dec == nil && d.err == nil {
+		d.dec, d.err = d.open(d.src)
+	}
+	if d.err != nil {
+		return 0, d.err
+	}
+	return d.dec.Read(p)
+}
+
+func (d *decodingReader) Close() error {
+	if d.dec != nil {
+		d.dec.Close()
+	}
+	return d.src.Close()
+}
@@ -0,0 +1,191 @@
+package httpclient
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// flushWriter is a compressing writer that can emit everything written so far
+type flushWriter interface {
+	io.WriteCloser
+	Flush() error
+}
+
+var testEncoders = map[string]func(io.Writer) flushWriter{
+	"gzip": func(w io.Writer) flushWriter { return gzip.NewWriter(w) },
+	"br":   func(w io.Writer) flushWriter { return brotli.NewWriter(w) },
+	"zstd": func(w io.Writer) flushWriter {
+		enc, _ := zstd.NewWriter(w)
+		return enc
+	},
+	"deflate": func(w io.Writer) flushWriter { return zlib.NewWriter(w) },
+	"raw-deflate": func(w io.Writer) flushWriter {
+		fw, _ := flate.NewWriter(w, flate.DefaultCompression)
+		return fw
+	},
+}
+
+func compress(t *testing.T, encoding string, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := testEncoders[encoding](&buf)
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func newResponse(body []byte, encodings ...string) *http.Response {
+	resp := &http.Response{
+		Header:        http.Header{},
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+	}
+	for _, enc := range encodings {
+		resp.Header.Add("Content-Encoding", enc)
+	}
+	resp.Header.Set("Content-Length", "123")
+	return resp
+}
+
+const testEvents = "event: message_start\ndata: {\"type\":\"message_start\"}\n\n" +
+	"event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"delta\":{\"text\":\"hi\"}}\n\n"
+
+func TestDecodeResponseBody(t *testing.T) {
+	plain := []byte(testEvents)
+
+	tests := []struct {
+		name     string
+		header   []string
+		body     []byte
+		wantGone bool
+	}{
+		{"gzip", []string{"gzip"}, compress(t, "gzip", plain), true},
+		{"x-gzip uppercase", []string{"X-GZIP"}, compress(t, "gzip", plain), true},
+		{"br", []string{"br"}, compress(t, "br", plain), true},
+		{"zstd", []string{"zstd"}, compress(t, "zstd", plain), true},
+		{"zlib deflate", []string{"deflate"}, compress(t, "deflate", plain), true},
+		{"raw deflate", []string{"deflate"}, compress(t, "raw-deflate", plain), true},
+		{"stacked in one header", []string{"gzip, br"}, compress(t, "br", compress(t, "gzip", plain)), true},
+		{"stacked in two headers", []string{"br", "zstd"}, compress(t, "zstd", compress(t, "br", plain)), true},
+		{"identity", []string{"identity"}, plain, false},
+		{"no encoding", nil, plain, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := newResponse(tt.body, tt.header...)
+			if err := DecodeResponseBody(resp); err != nil {
+				t.Fatal(err)
+			}
+			got, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != testEvents {
+				t.Errorf("decoded body = %q", got)
+			}
+			if tt.wantGone {
+				if resp.Header.Get("Content-Encoding") != "" || resp.Header.Get("Content-Length") != "" || resp.ContentLength != -1 {
+					t.Errorf("encoding headers kept: %v, content length %d", resp.Header, resp.ContentLength)
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeResponseBody_Unsupported(t *testing.T) {
+	resp := newResponse([]byte("data"), "gzip, compress")
+	if err := DecodeResponseBody(resp); err == nil || !strings.Contains(err.Error(), `"compress"`) {
+		t.Fatalf("expected unsupported encoding error, got %v", err)
+	}
+	if resp.Header.Get("Content-Encoding") != "gzip, compress" {
+		t.Errorf("response changed on error: %v", resp.Header)
+	}
+}
+
+func TestDecodeResponseBody_EmptyBody(t *testing.T) {
+	// Error responses may declare an encoding without a body
+	resp := newResponse(nil, "gzip")
+	if err := DecodeResponseBody(resp); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := io.ReadAll(resp.Body); len(got) != 0 {
+		t.Errorf("body = %q", got)
+	}
+}
+
+// TestDecodeResponseBody_Streams checks that each event of a compressed SSE
+// stream can be scanned as soon as the upstream flushes it, not only when the
+// stream ends
+func TestDecodeResponseBody_Streams(t *testing.T) {
+	for _, encoding := range []string{"gzip", "br", "zstd", "deflate"} {
+		t.Run(encoding, func(t *testing.T) {
+			next := make(chan struct{})
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/event-stream")
+				w.Header().Set("Content-Encoding", encoding)
+				enc := testEncoders[encoding](w)
+				for i := 0; i < 3; i++ {
+					io.WriteString(enc, "data: {\"index\":"+string(rune('0'+i))+"}\n\n")
+					enc.Flush()
+					w.(http.Flusher).Flush()
+					<-next
+				}
+				enc.Close()
+			}))
+			defer upstream.Close()
+			defer close(next)
+
+			req, _ := http.NewRequest(http.MethodGet, upstream.URL, nil)
+			// An explicit Accept-Encoding turns off the transport's own gzip handling
+			req.Header.Set("Accept-Encoding", "gzip, deflate, br, zstd")
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if err := DecodeResponseBody(resp); err != nil {
+				t.Fatal(err)
+			}
+
+			lines := make(chan string)
+			go func() {
+				scanner := bufio.NewScanner(resp.Body)
+				for scanner.Scan() {
+					if line := scanner.Text(); line != "" {
+						lines <- line
+					}
+				}
+				close(lines)
+			}()
+
+			for i := 0; i < 3; i++ {
+				select {
+				case line := <-lines:
+					if want := "data: {\"index\":" + string(rune('0'+i)) + "}"; line != want {
+						t.Fatalf("line %d = %q, want %q", i, line, want)
+					}
+				case <-time.After(5 * time.Second):
+					t.Fatalf("event %d not delivered before the stream ended", i)
+				}
+				next <- struct{}{}
+			}
+		})
+	}
+}
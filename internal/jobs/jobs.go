@@ -0,0 +1,400 @@
+// Package jobs runs background tasks (OAuth onboarding, bulk imports,
+// exports) on a worker pool. Jobs are stored in the database, so they keep
+// their progress across requests and resume after a restart; failed attempts
+// are retried with exponential backoff and running jobs can be canceled.
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+
+	"ccproxy/internal/store"
+)
+
+var (
+	// ErrNotFound is returned for unknown job IDs
+	ErrNotFound = errors.New("job not found")
+	// ErrFinished is returned when canceling a job that already finished
+	ErrFinished = errors.New("job already finished")
+)
+
+// Store persists jobs
+type Store interface {
+	CreateJob(job *store.Job) error
+	GetJob(id string) (*store.Job, error)
+	ListJobs(filter store.JobFilter) ([]*store.Job, int, error)
+	UpdateJob(job *store.Job) error
+	ClaimJob(types []string, now time.Time) (*store.Job, error)
+	RequeueRunningJobs(now time.Time) (int64, error)
+	DeleteFinishedJobs(before time.Time) (int64, error)
+}
+
+// Config sizes the queue
+type Config struct {
+	Workers      int
+	PollInterval time.Duration // How often due jobs and retries are picked up
+	Retention    time.Duration // How long finished jobs are kept
+}
+
+// Handler runs one attempt of a job. ctx is canceled when the job is
+// canceled or the queue stops. Errors are retried unless wrapped with
+// Permanent or the job is out of attempts.
+type Handler func(ctx context.Context, task *Task) error
+
+// Options configure a job type
+type Options struct {
+	MaxAttempts int           // Attempts before the job fails, at least 1
+	RetryDelay  time.Duration // Wait before the second attempt, doubled for each further one
+	Steps       []string      // Named steps, reported in order as the job's progress
+}
+
+type permanentError struct{ err error }
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks an error that retrying cannot fix
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err}
+}
+
+// Queue stores jobs and runs them on a worker pool
+type Queue struct {
+	store  Store
+	config Config
+	now    func() time.Time
+
+	mu       sync.Mutex
+	types    map[string]Options
+	handlers map[string]Handler
+	running  map[string]context.CancelFunc // Cancels the running jobs
+	canceled map[string]bool               // Running jobs canceled through Cancel
+	wake     chan struct{}
+
+	started bool
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+// New creates a queue; job types are registered before Start
+func New(s Store, config Config) *Queue {
+	if config.Workers < 1 {
+		config.Workers = 1
+	}
+	if config.PollInterval <= 0 {
+		config.PollInterval = time.Second
+	}
+	return &Queue{
+		store:    s,
+		config:   config,
+		now:      time.Now,
+		types:    make(map[string]Options),
+		handlers: make(map[string]Handler),
+		running:  make(map[string]context.CancelFunc),
+		canceled: make(map[string]bool),
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// Register sets the handler of a job type
+func (q *Queue) Register(jobType string, handler Handler, opts Options) {
+	if opts.MaxAttempts < 1 {
+		opts.MaxAttempts = 1
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.types[jobType] = opts
+	q.handlers[jobType] = handler
+}
+
+// Start requeues the jobs interrupted by the last shutdown and starts the workers
+func (q *Queue) Start(ctx context.Context) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.started {
+		return nil
+	}
+
+	requeued, err := q.store.RequeueRunningJobs(q.now())
+	if err != nil {
+		return fmt.Errorf("failed to requeue interrupted jobs: %w", err)
+	}
+	if requeued > 0 {
+		log.Info().Int64("jobs", requeued).Msg("requeued jobs interrupted by shutdown")
+	}
+
+	q.ctx, q.cancel = context.WithCancel(ctx)
+	q.started = true
+
+	for i := 0; i < q.config.Workers; i++ {
+		q.wg.Add(1)
+		go q.worker()
+	}
+	if q.config.Retention > 0 {
+		q.wg.Add(1)
+		go q.pruneLoop()
+	}
+
+	log.Info().Int("workers", q.config.Workers).Msg("job queue started")
+	return nil
+}
+
+// Stop stops the workers. Jobs still running are attempted again after the
+// next Start.
+func (q *Queue) Stop() {
+	q.mu.Lock()
+	if !q.started {
+		q.mu.Unlock()
+		return
+	}
+	q.started = false
+	q.mu.Unlock()
+
+	q.cancel()
+	q.wg.Wait()
+}
+
+// Enqueue stores a job of a registered type; payload is encoded as JSON and
+// handed to the handler through Task.Decode
+func (q *Queue) Enqueue(jobType string, payload interface{}) (*store.Job, error) {
+	q.mu.Lock()
+	opts, ok := q.types[jobType]
+	q.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown job type %q", jobType)
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode job payload: %w", err)
+	}
+
+	now := q.now()
+	job := &store.Job{
+		ID:          "job_" + uuid.New().String(),
+		Type:        jobType,
+		Status:      store.JobPending,
+		Payload:     string(data),
+		Steps:       []store.JobStep{},
+		MaxAttempts: opts.MaxAttempts,
+		RunAt:       now,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	for _, name := range opts.Steps {
+		job.Steps = append(job.Steps, store.JobStep{Name: name, Status: store.JobPending})
+	}
+	if err := q.store.CreateJob(job); err != nil {
+		return nil, fmt.Errorf("failed to store job: %w", err)
+	}
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	log.Info().Str("job_id", job.ID).Str("type", jobType).Msg("job queued")
+	return job, nil
+}
+
+// Get returns a job, or ErrNotFound
+func (q *Queue) Get(id string) (*store.Job, error) {
+	job, err := q.store.GetJob(id)
+	if err != nil {
+		return nil, err
+	}
+	if job == nil {
+		return nil, ErrNotFound
+	}
+	return job, nil
+}
+
+// List returns jobs matching filter, newest first, and the total number of matches
+func (q *Queue) List(filter store.JobFilter) ([]*store.Job, int, error) {
+	return q.store.ListJobs(filter)
+}
+
+// Cancel cancels a pending or running job. A running job's handler sees its
+// context canceled; the job is canceled once the handler returns.
+func (q *Queue) Cancel(id string) (*store.Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job, err := q.store.GetJob(id)
+	if err != nil {
+		return nil, err
+	}
+	if job == nil {
+		return nil, ErrNotFound
+	}
+
+	if cancel, ok := q.running[id]; ok {
+		q.canceled[id] = true
+		cancel()
+		return job, nil
+	}
+	if job.Finished() {
+		return nil, ErrFinished
+	}
+
+	now := q.now()
+	job.Status = store.JobCanceled
+	job.UpdatedAt = now
+	job.FinishedAt = &now
+	if err := q.store.UpdateJob(job); err != nil {
+		return nil, err
+	}
+	log.Info().Str("job_id", id).Msg("job canceled")
+	return job, nil
+}
+
+func (q *Queue) worker() {
+	defer q.wg.Done()
+	ticker := time.NewTicker(q.config.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		// Run due jobs until none is left, then wait for a new one or a retry
+		for q.ctx.Err() == nil && q.runNext() {
+		}
+		select {
+		case <-q.ctx.Done():
+			return
+		case <-q.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// runNext claims and runs a due job, reporting whether there was one
+func (q *Queue) runNext() bool {
+	q.mu.Lock()
+	types := make([]string, 0, len(q.handlers))
+	for jobType := range q.handlers {
+		types = append(types, jobType)
+	}
+	job, err := q.store.ClaimJob(types, q.now())
+	if err != nil {
+		q.mu.Unlock()
+		log.Error().Err(err).Msg("failed to claim job")
+		return false
+	}
+	if job == nil {
+		q.mu.Unlock()
+		return false
+	}
+	handler := q.handlers[job.Type]
+	opts := q.types[job.Type]
+	ctx, cancel := context.WithCancel(q.ctx)
+	q.running[job.ID] = cancel
+	q.mu.Unlock()
+
+	// Let another worker pick up the next due job
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+
+	task := &Task{queue: q, job: job}
+	err = q.call(ctx, handler, task)
+
+	q.mu.Lock()
+	canceled := q.canceled[job.ID]
+	delete(q.running, job.ID)
+	delete(q.canceled, job.ID)
+	q.mu.Unlock()
+	cancel()
+
+	q.finish(job, opts, err, canceled)
+	return true
+}
+
+// call runs a handler, turning a panic into a permanent error
+func (q *Queue) call(ctx context.Context, handler Handler, task *Task) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Error().Interface("panic", r).Str("job_id", task.job.ID).Msg("job handler panicked")
+			err = Permanent(fmt.Errorf("job handler panicked: %v", r))
+		}
+	}()
+	return handler(ctx, task)
+}
+
+// finish records the outcome of an attempt
+func (q *Queue) finish(job *store.Job, opts Options, err error, canceled bool) {
+	now := q.now()
+	job.UpdatedAt = now
+
+	var permanent *permanentError
+	switch {
+	case canceled:
+		job.Status = store.JobCanceled
+		job.FinishedAt = &now
+		log.Info().Str("job_id", job.ID).Msg("job canceled")
+	case err == nil:
+		job.Status = store.JobSucceeded
+		job.Error = ""
+		job.Progress = 100
+		job.FinishedAt = &now
+		log.Info().Str("job_id", job.ID).Str("type", job.Type).Msg("job succeeded")
+	case q.ctx.Err() != nil:
+		// Shutting down; the job stays running and is requeued on the next Start
+		return
+	case job.Attempts < job.MaxAttempts && !errors.As(err, &permanent):
+		job.Status = store.JobPending
+		job.Error = err.Error()
+		job.RunAt = now.Add(opts.RetryDelay << (job.Attempts - 1))
+		log.Warn().Err(err).Str("job_id", job.ID).Int("attempt", job.Attempts).Time("retry_at", job.RunAt).Msg("job failed, retrying")
+	default:
+		job.Status = store.JobFailed
+		job.Error = err.Error()
+		job.FinishedAt = &now
+		log.Error().Err(err).Str("job_id", job.ID).Str("type", job.Type).Msg("job failed")
+	}
+
+	if err := q.store.UpdateJob(job); err != nil {
+		log.Error().Err(err).Str("job_id", job.ID).Msg("failed to save job")
+	}
+}
+
+func (q *Queue) pruneLoop() {
+	defer q.wg.Done()
+	interval := time.Hour
+	if q.config.Retention < interval {
+		interval = q.config.Retention
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		q.prune()
+		select {
+		case <-q.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// prune deletes jobs finished longer than the retention ago
+func (q *Queue) prune() {
+	deleted, err := q.store.DeleteFinishedJobs(q.now().Add(-q.config.Retention))
+	if err != nil {
+		log.Error().Err(err).Msg("failed to delete finished jobs")
+		return
+	}
+	if deleted > 0 {
+		log.Info().Int64("jobs", deleted).Msg("deleted finished jobs")
+	}
+}
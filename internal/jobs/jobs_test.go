@@ -0,0 +1,200 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"ccproxy/internal/store"
+)
+
+func newTestQueue(t *testing.T) (*Queue, *store.Store) {
+	t.Helper()
+	db, err := store.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return New(db, Config{Workers: 2, PollInterval: 5 * time.Millisecond, Retention: time.Hour}), db
+}
+
+func waitJob(t *testing.T, q *Queue, id string, status string) *store.Job {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		job, err := q.Get(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job.Status == status {
+			return job
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	job, _ := q.Get(id)
+	t.Fatalf("job %s is %s (%s), want %s", id, job.Status, job.Error, status)
+	return nil
+}
+
+func TestQueue_Outcomes(t *testing.T) {
+	errTransient := errors.New("upstream unavailable")
+	tests := []struct {
+		name         string
+		errs         []error // Error of each attempt; later attempts succeed
+		wantStatus   string
+		wantAttempts int
+	}{
+		{"succeeds", nil, store.JobSucceeded, 1},
+		{"retried until success", []error{errTransient, errTransient}, store.JobSucceeded, 3},
+		{"attempts bounded", []error{errTransient, errTransient, errTransient}, store.JobFailed, 3},
+		{"permanent error not retried", []error{Permanent(errTransient)}, store.JobFailed, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, _ := newTestQueue(t)
+			var calls int32
+			q.Register("test", func(ctx context.Context, task *Task) error {
+				var payload struct{ Name string }
+				if err := task.Decode(&payload); err != nil {
+					return err
+				}
+				attempt := int(atomic.AddInt32(&calls, 1))
+				if err := task.Step("fetch", func() error {
+					if attempt <= len(tt.errs) {
+						return tt.errs[attempt-1]
+					}
+					return nil
+				}); err != nil {
+					return err
+				}
+				if err := task.Step("store", func() error { return nil }); err != nil {
+					return err
+				}
+				return task.SetResult(map[string]string{"hello": payload.Name})
+			}, Options{MaxAttempts: 3, RetryDelay: time.Millisecond, Steps: []string{"fetch", "store"}})
+			if err := q.Start(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			defer q.Stop()
+
+			job, err := q.Enqueue("test", map[string]string{"Name": "world"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if job.Status != store.JobPending || len(job.Steps) != 2 {
+				t.Fatalf("queued job = %+v", job)
+			}
+
+			job = waitJob(t, q, job.ID, tt.wantStatus)
+			if job.Attempts != tt.wantAttempts || int(atomic.LoadInt32(&calls)) != tt.wantAttempts {
+				t.Errorf("attempts = %d, handler calls = %d, want %d", job.Attempts, calls, tt.wantAttempts)
+			}
+			// Retries still see the payload; a finished job no longer keeps it
+			if job.Payload != "{}" {
+				t.Errorf("payload of finished job = %s", job.Payload)
+			}
+			if job.Steps[0].Attempts != tt.wantAttempts {
+				t.Errorf("fetch step attempts = %d, want %d", job.Steps[0].Attempts, tt.wantAttempts)
+			}
+			if tt.wantStatus == store.JobSucceeded {
+				if job.Progress != 100 || string(job.Result) != `{"hello":"world"}` || job.Error != "" {
+					t.Errorf("succeeded job = %+v", job)
+				}
+			} else if job.Error == "" || job.FinishedAt == nil || job.Steps[0].Status != store.JobFailed {
+				t.Errorf("failed job = %+v", job)
+			}
+		})
+	}
+}
+
+func TestQueue_Cancel(t *testing.T) {
+	q, _ := newTestQueue(t)
+	started := make(chan struct{})
+	q.Register("block", func(ctx context.Context, task *Task) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	}, Options{MaxAttempts: 3})
+	q.Register("idle", func(ctx context.Context, task *Task) error { return nil }, Options{})
+
+	// A pending job is canceled before it runs
+	idle, err := q.Enqueue("idle", map[string]string{"secret": "sk-ant-sid01-x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job, err := q.Cancel(idle.ID); err != nil || job.Status != store.JobCanceled {
+		t.Fatalf("cancel pending = %+v, %v", job, err)
+	}
+	if _, err := q.Cancel(idle.ID); !errors.Is(err, ErrFinished) {
+		t.Errorf("cancel finished job: %v", err)
+	}
+	if _, err := q.Cancel("job_missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("cancel missing job: %v", err)
+	}
+
+	if err := q.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer q.Stop()
+
+	// A running job sees its context canceled and is not retried
+	block, err := q.Enqueue("block", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-started
+	if _, err := q.Cancel(block.ID); err != nil {
+		t.Fatal(err)
+	}
+	if job := waitJob(t, q, block.ID, store.JobCanceled); job.Attempts != 1 {
+		t.Errorf("canceled job attempts = %d", job.Attempts)
+	}
+	if job, _ := q.Get(idle.ID); job.Status != store.JobCanceled || job.Attempts != 0 || job.Payload != "{}" {
+		t.Errorf("canceled pending job ran: %+v", job)
+	}
+}
+
+func TestQueue_RequeueAndList(t *testing.T) {
+	q, db := newTestQueue(t)
+	var calls int32
+	q.Register("test", func(ctx context.Context, task *Task) error {
+		atomic.AddInt32(&calls, 1)
+		return nil
+	}, Options{})
+	if _, err := q.Enqueue("other", nil); err == nil {
+		t.Error("enqueued an unregistered job type")
+	}
+
+	// A job left running by a stopped process runs again on Start
+	now := time.Now()
+	interrupted := &store.Job{ID: "job_interrupted", Type: "test", Status: store.JobRunning, Payload: "{}",
+		Attempts: 1, MaxAttempts: 1, RunAt: now, CreatedAt: now, UpdatedAt: now}
+	if err := db.CreateJob(interrupted); err != nil {
+		t.Fatal(err)
+	}
+	queued, err := q.Enqueue("test", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := q.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer q.Stop()
+	waitJob(t, q, interrupted.ID, store.JobSucceeded)
+	waitJob(t, q, queued.ID, store.JobSucceeded)
+	if got := atomic.LoadInt32(&calls); got != 2 {
+		t.Errorf("handler calls = %d, want 2", got)
+	}
+
+	list, total, err := q.List(store.JobFilter{Type: "test", Status: store.JobSucceeded, Limit: 1})
+	if err != nil || total != 2 || len(list) != 1 {
+		t.Errorf("list = %d of %d, %v", len(list), total, err)
+	}
+	if list, total, _ := q.List(store.JobFilter{Status: store.JobFailed}); total != 0 || len(list) != 0 {
+		t.Errorf("failed jobs = %v", list)
+	}
+}
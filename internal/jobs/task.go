@@ -0,0 +1,123 @@
+package jobs
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+
+	"ccproxy/internal/store"
+)
+
+// Task is a job being run, as seen by its handler. Progress updates are
+// saved right away so /api/jobs/:id follows the job as it runs.
+type Task struct {
+	queue *Queue
+	job   *store.Job
+}
+
+// ID returns the job ID
+func (t *Task) ID() string {
+	return t.job.ID
+}
+
+// Attempt returns the number of the current attempt, starting at 1
+func (t *Task) Attempt() int {
+	return t.job.Attempts
+}
+
+// Decode decodes the job payload into v
+func (t *Task) Decode(v interface{}) error {
+	if err := json.Unmarshal([]byte(t.job.Payload), v); err != nil {
+		return Permanent(fmt.Errorf("invalid job payload: %w", err))
+	}
+	return nil
+}
+
+// SetProgress reports how far the job is, in percent, with an optional message
+func (t *Task) SetProgress(percent int, message string) {
+	if percent < 0 {
+		percent = 0
+	}
+	if percent > 100 {
+		percent = 100
+	}
+	t.job.Progress = percent
+	t.job.Message = message
+	t.save()
+}
+
+// SetResult stores v as the job result, reported once the job succeeds
+func (t *Task) SetResult(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to encode job result: %w", err)
+	}
+	t.job.Result = data
+	t.save()
+	return nil
+}
+
+// Step runs fn as the named step, recording its attempts, timing and error.
+// Progress advances with each succeeded step.
+func (t *Task) Step(name string, fn func() error) error {
+	start := t.queue.now()
+	t.updateStep(name, func(step *store.JobStep) {
+		step.Status = store.JobRunning
+		step.Attempts++
+		step.Error = ""
+		if step.StartedAt == nil {
+			step.StartedAt = &start
+		}
+	})
+
+	err := fn()
+	if err != nil {
+		err = fmt.Errorf("%s failed: %w", name, err)
+	}
+
+	end := t.queue.now()
+	t.updateStep(name, func(step *store.JobStep) {
+		if err != nil {
+			step.Status = store.JobFailed
+			step.Error = err.Error()
+			return
+		}
+		step.Status = store.JobSucceeded
+		step.FinishedAt = &end
+	})
+	return err
+}
+
+func (t *Task) updateStep(name string, fn func(step *store.JobStep)) {
+	found := false
+	done := 0
+	for i := range t.job.Steps {
+		if t.job.Steps[i].Name == name {
+			fn(&t.job.Steps[i])
+			found = true
+		}
+		if t.job.Steps[i].Status == store.JobSucceeded {
+			done++
+		}
+	}
+	if !found {
+		step := store.JobStep{Name: name}
+		fn(&step)
+		t.job.Steps = append(t.job.Steps, step)
+		if step.Status == store.JobSucceeded {
+			done++
+		}
+	}
+	if len(t.job.Steps) > 0 {
+		t.job.Progress = done * 100 / len(t.job.Steps)
+	}
+	t.save()
+}
+
+func (t *Task) save() {
+	t.job.UpdatedAt = t.queue.now()
+	if err := t.queue.store.UpdateJob(t.job); err != nil {
+		log.Error().Err(err).Str("job_id", t.job.ID).Msg("failed to save job progress")
+	}
+}
@@ -57,13 +57,13 @@ func NewKeyPool(keys []string, strategy Strategy) *KeyPool {
 }
 
 func (p *KeyPool) Get() string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
 	if len(p.keys) == 0 {
 		return ""
 	}
 
-	p.mu.RLock()
-	defer p.mu.RUnlock()
-
 	// Try to find a healthy key
 	healthyKeys := make([]*keyState, 0, len(p.keys))
 	for _, k := range p.keys {
@@ -178,9 +178,39 @@ func (p *KeyPool) GetStats() []KeyStats {
 }
 
 func (p *KeyPool) Size() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
 	return len(p.keys)
 }
 
+// Add adds a key to the pool; it returns false if the key is already present
+func (p *KeyPool) Add(key string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, k := range p.keys {
+		if k.key == key {
+			return false
+		}
+	}
+	p.keys = append(p.keys, &keyState{key: key, isHealthy: true})
+	return true
+}
+
+// Remove removes a key from the pool; it returns false if the key was not present
+func (p *KeyPool) Remove(key string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for i, k := range p.keys {
+		if k.key == key {
+			p.keys = append(p.keys[:i:i], p.keys[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
 func (p *KeyPool) HealthyCount() int {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
@@ -0,0 +1,85 @@
+package metrics
+
+import (
+	"os"
+	"runtime"
+	"sort"
+	"time"
+)
+
+// ProcessStats is a snapshot of the Go runtime and the process
+type ProcessStats struct {
+	Goroutines      int     `json:"goroutines"`
+	Threads         int     `json:"threads"` // OS threads created by the runtime
+	HeapAllocBytes  uint64  `json:"heap_alloc_bytes"`
+	HeapInuseBytes  uint64  `json:"heap_inuse_bytes"`
+	HeapSysBytes    uint64  `json:"heap_sys_bytes"`
+	HeapObjects     uint64  `json:"heap_objects"`
+	StackInuseBytes uint64  `json:"stack_inuse_bytes"`
+	SysBytes        uint64  `json:"sys_bytes"` // Memory obtained from the OS
+	GCCount         uint32  `json:"gc_count"`
+	GCPauseTotalS   float64 `json:"gc_pause_total_seconds"`
+	GCPauseLastMs   float64 `json:"gc_pause_last_ms"`
+	GCPauseMaxMs    float64 `json:"gc_pause_max_ms"` // Longest of the last 256 pauses
+	GCPauseP99Ms    float64 `json:"gc_pause_p99_ms"` // Over the last 256 pauses
+	GCCPUFraction   float64 `json:"gc_cpu_fraction"`
+	OpenFDs         int     `json:"open_fds"` // -1 where /proc is not available
+	UptimeSeconds   int64   `json:"uptime_seconds"`
+}
+
+var processStart = time.Now()
+
+// ReadProcessStats reads the runtime and process metrics. It briefly stops
+// the world to read the memory statistics.
+func ReadProcessStats() ProcessStats {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	threads, _ := runtime.ThreadCreateProfile(nil)
+
+	stats := ProcessStats{
+		Goroutines:      runtime.NumGoroutine(),
+		Threads:         threads,
+		HeapAllocBytes:  ms.HeapAlloc,
+		HeapInuseBytes:  ms.HeapInuse,
+		HeapSysBytes:    ms.HeapSys,
+		HeapObjects:     ms.HeapObjects,
+		StackInuseBytes: ms.StackInuse,
+		SysBytes:        ms.Sys,
+		GCCount:         ms.NumGC,
+		GCPauseTotalS:   float64(ms.PauseTotalNs) / float64(time.Second),
+		GCCPUFraction:   ms.GCCPUFraction,
+		OpenFDs:         openFDs(),
+		UptimeSeconds:   int64(time.Since(processStart).Seconds()),
+	}
+
+	// PauseNs is a ring buffer of the most recent pauses
+	recent := int(ms.NumGC)
+	if recent > len(ms.PauseNs) {
+		recent = len(ms.PauseNs)
+	}
+	if recent > 0 {
+		stats.GCPauseLastMs = nsToMs(ms.PauseNs[(ms.NumGC+255)%256])
+		pauses := make([]uint64, 0, recent)
+		for i := 0; i < recent; i++ {
+			pauses = append(pauses, ms.PauseNs[(int(ms.NumGC)-1-i+256)%256])
+		}
+		sort.Slice(pauses, func(i, j int) bool { return pauses[i] < pauses[j] })
+		stats.GCPauseMaxMs = nsToMs(pauses[len(pauses)-1])
+		stats.GCPauseP99Ms = nsToMs(pauses[(len(pauses)-1)*99/100])
+	}
+	return stats
+}
+
+// openFDs counts the process's open file descriptors, or -1 where /proc is
+// not available
+func openFDs() int {
+	entries, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		return -1
+	}
+	return len(entries)
+}
+
+func nsToMs(ns uint64) float64 {
+	return float64(ns) / float64(time.Millisecond)
+}
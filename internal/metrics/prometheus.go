@@ -40,7 +40,8 @@ type Metrics struct {
 	accountHealth   map[string]bool   // account_id -> healthy
 
 	// Rate limit metrics
-	rateLimitHits map[string]*int64 // type -> count
+	rateLimitHits     map[string]*int64 // type -> count
+	rateLimitBypasses map[string]*int64 // type -> checks skipped for exempt tokens
 
 	// Retry metrics
 	retryAttempts   int64
@@ -53,6 +54,12 @@ type Metrics struct {
 	// Concurrency metrics
 	waitDuration map[string]*durationMetric // type -> duration stats
 
+	// Feature flag metrics
+	flagVariants map[string]*flagMetric // flag:on|off -> request stats
+
+	// Load shedding metrics
+	loadShed map[string]*int64 // priority:reason -> count
+
 	mu sync.RWMutex
 }
 
@@ -63,6 +70,13 @@ type durationMetric struct {
 	maxMs   int64
 }
 
+// flagMetric compares requests served with a feature flag on or off
+type flagMetric struct {
+	requests int64
+	errors   int64
+	duration durationMetric
+}
+
 // NewMetrics creates a new metrics instance
 func NewMetrics(config MetricsConfig) *Metrics {
 	if !config.Enabled {
@@ -79,8 +93,11 @@ func NewMetrics(config MetricsConfig) *Metrics {
 		accountErrors:    make(map[string]*int64),
 		accountHealth:    make(map[string]bool),
 		rateLimitHits:    make(map[string]*int64),
+		rateLimitBypasses: make(map[string]*int64),
 		accountSwitches:  make(map[string]*int64),
 		waitDuration:     make(map[string]*durationMetric),
+		flagVariants:     make(map[string]*flagMetric),
+		loadShed:         make(map[string]*int64),
 	}
 }
 
@@ -173,6 +190,14 @@ func (m *Metrics) getStats() map[string]interface{} {
 	}
 	stats["rate_limit_hits"] = rateLimitStats
 
+	bypassStats := make(map[string]int64)
+	for k, v := range m.rateLimitBypasses {
+		if v != nil {
+			bypassStats[k] = atomic.LoadInt64(v)
+		}
+	}
+	stats["rate_limit_bypasses"] = bypassStats
+
 	// Retry stats
 	stats["retry"] = map[string]interface{}{
 		"attempts":  atomic.LoadInt64(&m.retryAttempts),
@@ -191,6 +216,30 @@ func (m *Metrics) getStats() map[string]interface{} {
 	// Pool stats
 	stats["pool_clients"] = atomic.LoadInt64(&m.poolClients)
 
+	// Feature flag variants
+	flagStats := make(map[string]interface{})
+	for k, v := range m.flagVariants {
+		flagStats[k] = map[string]interface{}{
+			"requests": v.requests,
+			"errors":   v.errors,
+			"avg_ms":   safeDivide(v.duration.sumMs, v.duration.count),
+			"max_ms":   v.duration.maxMs,
+		}
+	}
+	stats["feature_flags"] = flagStats
+
+	// Load shedding
+	shedStats := make(map[string]int64)
+	for k, v := range m.loadShed {
+		if v != nil {
+			shedStats[k] = atomic.LoadInt64(v)
+		}
+	}
+	stats["load_shed"] = shedStats
+
+	// Go runtime and process
+	stats["process"] = ReadProcessStats()
+
 	return stats
 }
 
@@ -348,6 +397,39 @@ func (m *Metrics) RecordRateLimitHit(limitType string) {
 	atomic.AddInt64(m.rateLimitHits[limitType], 1)
 }
 
+// RecordRateLimitBypass records a rate limit check skipped for an exempt token
+func (m *Metrics) RecordRateLimitBypass(limitType string) {
+	if m == nil {
+		return
+	}
+
+	m.mu.Lock()
+	if m.rateLimitBypasses[limitType] == nil {
+		var zero int64
+		m.rateLimitBypasses[limitType] = &zero
+	}
+	m.mu.Unlock()
+
+	atomic.AddInt64(m.rateLimitBypasses[limitType], 1)
+}
+
+// RecordLoadShed records a request rejected under resource pressure
+func (m *Metrics) RecordLoadShed(priority, reason string) {
+	if m == nil {
+		return
+	}
+
+	key := priority + ":" + reason
+	m.mu.Lock()
+	if m.loadShed[key] == nil {
+		var zero int64
+		m.loadShed[key] = &zero
+	}
+	m.mu.Unlock()
+
+	atomic.AddInt64(m.loadShed[key], 1)
+}
+
 // RecordRetry records a retry attempt
 func (m *Metrics) RecordRetry(success bool) {
 	if m == nil {
@@ -376,6 +458,38 @@ func (m *Metrics) RecordAccountSwitch(reason string) {
 	atomic.AddInt64(m.accountSwitches[reason], 1)
 }
 
+// RecordFeatureFlag records a request served with a feature flag on or off,
+// so both variants can be compared by error rate and latency
+func (m *Metrics) RecordFeatureFlag(flag string, enabled bool, status int, duration time.Duration) {
+	if m == nil {
+		return
+	}
+
+	key := flag + ":off"
+	if enabled {
+		key = flag + ":on"
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fm := m.flagVariants[key]
+	if fm == nil {
+		fm = &flagMetric{}
+		m.flagVariants[key] = fm
+	}
+	fm.requests++
+	if status >= 400 {
+		fm.errors++
+	}
+	ms := duration.Milliseconds()
+	fm.duration.count++
+	fm.duration.sumMs += ms
+	if ms > fm.duration.maxMs {
+		fm.duration.maxMs = ms
+	}
+}
+
 // SetPoolClients sets the number of clients in pool
 func (m *Metrics) SetPoolClients(count int) {
 	if m == nil {
@@ -0,0 +1,162 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// APIVersionHeader names the admin API version that served a response
+	APIVersionHeader = "API-Version"
+
+	// ContextKeyAPIVersion holds the admin API version of the request
+	ContextKeyAPIVersion = "api_version"
+
+	// APIVersionLegacy is the unversioned /api prefix, an alias of v1
+	APIVersionLegacy = "legacy"
+	APIVersion1      = "v1"
+	APIVersion2      = "v2"
+)
+
+// APIVersionInfo describes one admin API version
+type APIVersionInfo struct {
+	Version    string `json:"version"`
+	Prefix     string `json:"prefix"`
+	Deprecated bool   `json:"deprecated"`
+	Successor  string `json:"successor,omitempty"`
+	Changes    string `json:"changes"`
+}
+
+// APIVersions lists the admin API versions, oldest first
+var APIVersions = []APIVersionInfo{
+	{
+		Version:    APIVersionLegacy,
+		Prefix:     "/api",
+		Deprecated: true,
+		Successor:  APIVersion1,
+		Changes:    "alias of v1",
+	},
+	{
+		Version: APIVersion1,
+		Prefix:  "/api/v1",
+		Changes: "errors are {\"error\": \"message\"}",
+	},
+	{
+		Version: APIVersion2,
+		Prefix:  "/api/v2",
+		Changes: "errors are {\"error\": {\"type\": \"...\", \"message\": \"...\"}}",
+	},
+}
+
+// APIVersion tags admin API requests with their version. Legacy requests get
+// Deprecation and successor Link headers pointing at the same path under
+// /api/v1, and v2 responses go through the v2 shim.
+func APIVersion(version string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(ContextKeyAPIVersion, version)
+		c.Header(APIVersionHeader, version)
+
+		switch version {
+		case APIVersionLegacy:
+			successor := "/api/v1" + strings.TrimPrefix(c.Request.URL.Path, "/api")
+			c.Header("Deprecation", "true")
+			c.Header("Link", "<"+successor+">; rel=\"successor-version\"")
+			c.Next()
+		case APIVersion2:
+			shim := &v2ErrorShim{ResponseWriter: c.Writer}
+			c.Writer = shim
+			c.Next()
+			shim.flush()
+		default:
+			c.Next()
+		}
+	}
+}
+
+// GetAPIVersion returns the admin API version of the request, v1 when the
+// APIVersion middleware did not run
+func GetAPIVersion(c *gin.Context) string {
+	if version := c.GetString(ContextKeyAPIVersion); version != "" {
+		return version
+	}
+	return APIVersion1
+}
+
+// v2ErrorShim lets handlers written against v1 serve v2: error bodies of the
+// form {"error": "message"} are held back and rewritten as
+// {"error": {"type": "...", "message": "message"}}. Successful responses,
+// including streams, pass through untouched.
+type v2ErrorShim struct {
+	gin.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *v2ErrorShim) WriteHeader(code int) {
+	w.status = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *v2ErrorShim) Write(b []byte) (int, error) {
+	if w.status < http.StatusBadRequest {
+		return w.ResponseWriter.Write(b)
+	}
+	return w.body.Write(b)
+}
+
+func (w *v2ErrorShim) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *v2ErrorShim) flush() {
+	if w.body.Len() == 0 {
+		return
+	}
+	body := w.body.Bytes()
+	var v1 struct {
+		Error json.RawMessage `json:"error"`
+	}
+	var message string
+	if err := json.Unmarshal(body, &v1); err == nil && json.Unmarshal(v1.Error, &message) == nil {
+		var fields map[string]json.RawMessage
+		_ = json.Unmarshal(body, &fields)
+		fields["error"], _ = json.Marshal(gin.H{"type": ErrorType(w.status), "message": message})
+		body, _ = json.Marshal(fields)
+	}
+	if w.Header().Get("Content-Length") != "" {
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	}
+	_, _ = w.ResponseWriter.Write(body)
+}
+
+// ErrorType names the error type v2 reports for an HTTP status, following
+// the Anthropic API's error types
+func ErrorType(status int) string {
+	switch status {
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		return "invalid_request_error"
+	case http.StatusUnauthorized:
+		return "authentication_error"
+	case http.StatusForbidden:
+		return "permission_error"
+	case http.StatusNotFound:
+		return "not_found_error"
+	case http.StatusConflict:
+		return "conflict_error"
+	case http.StatusRequestEntityTooLarge:
+		return "request_too_large"
+	case http.StatusTooManyRequests:
+		return "rate_limit_error"
+	case http.StatusServiceUnavailable:
+		return "overloaded_error"
+	}
+	if status >= http.StatusInternalServerError {
+		return "api_error"
+	}
+	return "invalid_request_error"
+}
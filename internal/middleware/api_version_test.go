@@ -0,0 +1,91 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAPIVersion(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	newRouter := func(version string) *gin.Engine {
+		router := gin.New()
+		api := router.Group("/api", APIVersion(version))
+		api.GET("/ok", func(c *gin.Context) {
+			c.JSON(http.StatusOK, gin.H{"version": GetAPIVersion(c)})
+		})
+		api.GET("/missing", func(c *gin.Context) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "account not found", "id": "acc-1"})
+		})
+		api.GET("/typed", func(c *gin.Context) {
+			c.JSON(http.StatusForbidden, gin.H{"error": gin.H{"type": "permission_error", "message": "no"}})
+		})
+		return router
+	}
+	get := func(router *gin.Engine, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	legacy := get(newRouter(APIVersionLegacy), "/api/ok")
+	if legacy.Header().Get("Deprecation") != "true" || legacy.Header().Get("Link") != `</api/v1/ok>; rel="successor-version"` {
+		t.Errorf("legacy headers = %v", legacy.Header())
+	}
+
+	v1 := newRouter(APIVersion1)
+	if w := get(v1, "/api/ok"); w.Header().Get("Deprecation") != "" || w.Header().Get(APIVersionHeader) != APIVersion1 {
+		t.Errorf("v1 headers = %v", w.Header())
+	}
+	if w := get(v1, "/api/missing"); w.Body.String() != `{"error":"account not found","id":"acc-1"}` {
+		t.Errorf("v1 error = %s", w.Body.String())
+	}
+
+	v2 := newRouter(APIVersion2)
+	if w := get(v2, "/api/ok"); w.Code != http.StatusOK || w.Body.String() != `{"version":"v2"}` {
+		t.Errorf("v2 success = %d %s", w.Code, w.Body.String())
+	}
+
+	w := get(v2, "/api/missing")
+	var body struct {
+		Error struct {
+			Type    string `json:"type"`
+			Message string `json:"message"`
+		} `json:"error"`
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode v2 error %s: %v", w.Body.String(), err)
+	}
+	if w.Code != http.StatusNotFound || body.Error.Type != "not_found_error" || body.Error.Message != "account not found" || body.ID != "acc-1" {
+		t.Errorf("v2 error = %d %s", w.Code, w.Body.String())
+	}
+
+	if w := get(v2, "/api/typed"); w.Body.String() != `{"error":{"message":"no","type":"permission_error"}}` {
+		t.Errorf("v2 typed error = %s", w.Body.String())
+	}
+}
+
+func TestErrorType(t *testing.T) {
+	tests := []struct {
+		status int
+		want   string
+	}{
+		{http.StatusBadRequest, "invalid_request_error"},
+		{http.StatusUnauthorized, "authentication_error"},
+		{http.StatusNotFound, "not_found_error"},
+		{http.StatusTooManyRequests, "rate_limit_error"},
+		{http.StatusServiceUnavailable, "overloaded_error"},
+		{http.StatusBadGateway, "api_error"},
+		{http.StatusMethodNotAllowed, "invalid_request_error"},
+	}
+	for _, tt := range tests {
+		if got := ErrorType(tt.status); got != tt.want {
+			t.Errorf("ErrorType(%d) = %s, want %s", tt.status, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package middleware
+
+import (
+	"ccproxy/internal/ratelimit"
+	"ccproxy/internal/shedding"
+	"ccproxy/internal/store"
+)
+
+// priorityRank orders load shedding priorities; "" is normal
+var priorityRank = map[string]int{
+	shedding.PriorityLow:      0,
+	"":                        1,
+	shedding.PriorityNormal:   1,
+	shedding.PriorityCritical: 2,
+}
+
+// narrowToIssuer limits a child token to what its issuer is allowed now, so
+// tightening the issuer also tightens the children it minted earlier. It
+// returns the child's effective settings and mode, and false when no mode or
+// endpoint is left to it.
+func narrowToIssuer(child *store.Token, mode string, issuer *store.Token) (*store.Token, string, bool) {
+	switch {
+	case issuer.Mode == "both":
+	case mode == "both":
+		mode = issuer.Mode
+	case mode != issuer.Mode:
+		return nil, "", false
+	}
+
+	narrowed := *child
+	endpoints, ok := intersectEndpoints(child.AllowedEndpoints, issuer.AllowedEndpoints)
+	if !ok {
+		return nil, "", false
+	}
+	narrowed.AllowedEndpoints = endpoints
+
+	childBypass, issuerBypass := ratelimit.ParseBypass(child.RateLimitBypass), ratelimit.ParseBypass(issuer.RateLimitBypass)
+	narrowed.RateLimitBypass = ratelimit.Bypass{
+		IP:     childBypass.IP && issuerBypass.IP,
+		Global: childBypass.Global && issuerBypass.Global,
+	}.String()
+
+	narrowed.AllowFlagOverrides = child.AllowFlagOverrides && issuer.AllowFlagOverrides
+	if priorityRank[issuer.Priority] < priorityRank[child.Priority] {
+		narrowed.Priority = issuer.Priority
+	}
+	if issuer.MaxRequestSeconds > 0 && (child.MaxRequestSeconds <= 0 || issuer.MaxRequestSeconds < child.MaxRequestSeconds) {
+		narrowed.MaxRequestSeconds = issuer.MaxRequestSeconds
+	}
+	return &narrowed, mode, true
+}
+
+// intersectEndpoints returns the stored endpoint list allowing what both
+// lists allow; false when they share no endpoint
+func intersectEndpoints(a, b string) (string, bool) {
+	listA, listB := ParseEndpoints(a), ParseEndpoints(b)
+	if listA == nil {
+		return b, true
+	}
+	if listB == nil {
+		return a, true
+	}
+	inB := make(map[string]bool, len(listB))
+	for _, endpoint := range listB {
+		inB[endpoint] = true
+	}
+	var both []string
+	for _, endpoint := range listA {
+		if inB[endpoint] {
+			both = append(both, endpoint)
+		}
+	}
+	if len(both) == 0 {
+		return "", false
+	}
+	normalized, err := NormalizeEndpoints(both)
+	return normalized, err == nil
+}
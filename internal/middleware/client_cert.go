@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"crypto/x509"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// EnableClientCerts authenticates requests without a bearer token by their
+// TLS client certificate. The chain is verified during the handshake; the
+// certificate's identities are then looked up among the tokens' client
+// certificate identities.
+func (m *JWTMiddleware) EnableClientCerts() {
+	m.clientCerts = true
+}
+
+// clientCert returns the verified client certificate of the request, or nil
+func (m *JWTMiddleware) clientCert(c *gin.Context) *x509.Certificate {
+	if !m.clientCerts || c.Request.TLS == nil || len(c.Request.TLS.VerifiedChains) == 0 {
+		return nil
+	}
+	return c.Request.TLS.PeerCertificates[0]
+}
+
+// clientCertAuth authenticates as the token mapped to the first of the
+// certificate's identities that has one
+func (m *JWTMiddleware) clientCertAuth(c *gin.Context, cert *x509.Certificate) {
+	var tokenID string
+	for _, identity := range ClientCertIdentities(cert) {
+		id, err := m.store.TokenIDByClientCert(identity)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"error": "failed to validate token",
+			})
+			return
+		}
+		if id != "" {
+			tokenID = id
+			break
+		}
+	}
+	if tokenID == "" {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"error": "client certificate is not mapped to a token",
+		})
+		return
+	}
+
+	token, err := m.store.ValidateToken(tokenID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to validate token",
+		})
+		return
+	}
+	if token == nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"error": "token is revoked or expired",
+		})
+		return
+	}
+
+	m.authenticated(c, token.ID, token.UserName, token.Mode, token)
+}
+
+// ClientCertIdentities returns the identities a client certificate can be
+// mapped by, in lookup order: the subject CN, then the DNS, email, URI and IP
+// subject alternative names
+func ClientCertIdentities(cert *x509.Certificate) []string {
+	var identities []string
+	if cert.Subject.CommonName != "" {
+		identities = append(identities, cert.Subject.CommonName)
+	}
+	identities = append(identities, cert.DNSNames...)
+	identities = append(identities, cert.EmailAddresses...)
+	for _, uri := range cert.URIs {
+		identities = append(identities, uri.String())
+	}
+	for _, ip := range cert.IPAddresses {
+		identities = append(identities, ip.String())
+	}
+	return identities
+}
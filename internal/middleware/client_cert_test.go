@@ -0,0 +1,110 @@
+package middleware
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"ccproxy/internal/store"
+	"ccproxy/internal/store/storetest"
+	"ccproxy/pkg/jwt"
+)
+
+func TestClientCertIdentities(t *testing.T) {
+	spiffe, _ := url.Parse("spiffe://example.com/ci")
+	cert := &x509.Certificate{
+		Subject:        pkix.Name{CommonName: "ci-runner"},
+		DNSNames:       []string{"ci.internal"},
+		EmailAddresses: []string{"ci@example.com"},
+		URIs:           []*url.URL{spiffe},
+	}
+	got := ClientCertIdentities(cert)
+	want := []string{"ci-runner", "ci.internal", "ci@example.com", "spiffe://example.com/ci"}
+	if len(got) != len(want) {
+		t.Fatalf("identities = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("identities[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestAuth_ClientCert(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	st := storetest.NewMemoryStore()
+	manager := jwt.NewManager("test-secret-test-secret-test-secret", "ccproxy")
+	for _, token := range []*store.Token{
+		{ID: "by-san", UserName: "ci", Mode: "api", ClientCertIdentity: "ci.internal"},
+		{ID: "revoked", UserName: "old", Mode: "both", ClientCertIdentity: "old.internal"},
+	} {
+		token.CreatedAt = time.Now()
+		token.ExpiresAt = time.Now().Add(time.Hour)
+		if err := st.CreateToken(token); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_ = st.RevokeToken("revoked")
+	apiToken, info, err := manager.Generate("jwt-user", "web", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = st.CreateToken(&store.Token{ID: info.ID, UserName: info.UserName, Mode: "web", CreatedAt: info.IssuedAt, ExpiresAt: info.ExpiresAt})
+
+	m := NewJWTMiddleware(manager, st)
+	m.EnableClientCerts()
+	router := gin.New()
+	router.GET("/test", m.Auth(), func(c *gin.Context) {
+		c.String(http.StatusOK, c.GetString(ContextKeyTokenID)+"/"+c.GetString(ContextKeyTokenMode))
+	})
+
+	withCert := func(cn string, dns ...string) func(*http.Request) {
+		return func(r *http.Request) {
+			cert := &x509.Certificate{Subject: pkix.Name{CommonName: cn}, DNSNames: dns}
+			r.TLS = &tls.ConnectionState{
+				PeerCertificates: []*x509.Certificate{cert},
+				VerifiedChains:   [][]*x509.Certificate{{cert}},
+			}
+		}
+	}
+
+	tests := []struct {
+		name     string
+		setup    func(*http.Request)
+		wantCode int
+		wantBody string
+	}{
+		{"SAN mapped", withCert("unmapped-cn", "ci.internal"), http.StatusOK, "by-san/api"},
+		{"unmapped certificate", withCert("nobody"), http.StatusUnauthorized, ""},
+		{"revoked token", withCert("old.internal"), http.StatusUnauthorized, ""},
+		{"unverified certificate", func(r *http.Request) {
+			r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{{DNSNames: []string{"ci.internal"}}}}
+		}, http.StatusUnauthorized, ""},
+		{"bearer token wins", func(r *http.Request) {
+			withCert("ci.internal")(r)
+			r.Header.Set("Authorization", "Bearer "+apiToken)
+		}, http.StatusOK, info.ID + "/web"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			tt.setup(req)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantCode, w.Body.String())
+			}
+			if tt.wantBody != "" && w.Body.String() != tt.wantBody {
+				t.Errorf("body = %q, want %q", w.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
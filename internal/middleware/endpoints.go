@@ -0,0 +1,108 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Endpoint groups a token can be limited to
+const (
+	EndpointChatCompletions  = "chat_completions"  // /v1/chat/completions
+	EndpointMessages         = "messages"          // /v1/messages
+	EndpointCountTokens      = "count_tokens"      // /v1/messages/count_tokens
+	EndpointWebConversations = "web_conversations" // /web/conversations
+	EndpointModels           = "models"            // /v1/models
+)
+
+// Endpoints lists the endpoint groups in display order
+var Endpoints = []string{
+	EndpointChatCompletions,
+	EndpointMessages,
+	EndpointCountTokens,
+	EndpointWebConversations,
+	EndpointModels,
+}
+
+// ContextKeyAllowedEndpoints holds the endpoint groups the token is limited to, if any
+const ContextKeyAllowedEndpoints = "allowed_endpoints"
+
+// ParseEndpoints splits a stored endpoint list; nil means every endpoint
+func ParseEndpoints(endpoints string) []string {
+	if endpoints == "" {
+		return nil
+	}
+	var parsed []string
+	for _, endpoint := range strings.Split(endpoints, ",") {
+		if endpoint = strings.TrimSpace(endpoint); endpoint != "" {
+			parsed = append(parsed, endpoint)
+		}
+	}
+	return parsed
+}
+
+// NormalizeEndpoints validates a list of endpoint groups and returns it
+// deduplicated, in display order and comma-separated, as stored on tokens.
+// An empty list allows every endpoint.
+func NormalizeEndpoints(endpoints []string) (string, error) {
+	allowed := make(map[string]bool, len(endpoints))
+	for _, endpoint := range endpoints {
+		endpoint = strings.ToLower(strings.TrimSpace(endpoint))
+		if !validEndpoint(endpoint) {
+			return "", fmt.Errorf("unknown endpoint %q (valid: %s)", endpoint, strings.Join(Endpoints, ", "))
+		}
+		allowed[endpoint] = true
+	}
+
+	var normalized []string
+	for _, endpoint := range Endpoints {
+		if allowed[endpoint] {
+			normalized = append(normalized, endpoint)
+		}
+	}
+	return strings.Join(normalized, ","), nil
+}
+
+func validEndpoint(endpoint string) bool {
+	for _, e := range Endpoints {
+		if e == endpoint {
+			return true
+		}
+	}
+	return false
+}
+
+// EndpointAllowed reports whether the authenticated token may call an endpoint group
+func EndpointAllowed(c *gin.Context, endpoint string) bool {
+	allowed := ParseEndpoints(c.GetString(ContextKeyAllowedEndpoints))
+	if allowed == nil {
+		return true
+	}
+	for _, e := range allowed {
+		if e == endpoint {
+			return true
+		}
+	}
+	return false
+}
+
+// RequireEndpoint rejects tokens limited to other endpoint groups. It runs
+// after Auth.
+func RequireEndpoint(endpoint string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if EndpointAllowed(c, endpoint) {
+			c.Next()
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"error": gin.H{
+				"type":              "permission_error",
+				"message":           fmt.Sprintf("token is not allowed to call the %s endpoint", endpoint),
+				"endpoint":          endpoint,
+				"allowed_endpoints": ParseEndpoints(c.GetString(ContextKeyAllowedEndpoints)),
+			},
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"ccproxy/internal/store"
+	"ccproxy/internal/store/storetest"
+	"ccproxy/pkg/jwt"
+)
+
+func TestNormalizeEndpoints(t *testing.T) {
+	tests := []struct {
+		endpoints []string
+		want      string
+		wantErr   bool
+	}{
+		{nil, "", false},
+		{[]string{"models", " Messages", "messages"}, "messages,models", false},
+		{[]string{"web_conversations", "chat_completions"}, "chat_completions,web_conversations", false},
+		{[]string{"admin"}, "", true},
+	}
+	for _, tt := range tests {
+		got, err := NormalizeEndpoints(tt.endpoints)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("NormalizeEndpoints(%v) = %q, %v; want %q", tt.endpoints, got, err, tt.want)
+		}
+	}
+}
+
+func TestRequireEndpoint(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	st := storetest.NewMemoryStore()
+	manager := jwt.NewManager("test-secret-test-secret-test-secret", "ccproxy")
+
+	newToken := func(endpoints string) string {
+		tokenString, info, err := manager.Generate("tester", "both", time.Hour)
+		if err != nil {
+			t.Fatalf("Generate: %v", err)
+		}
+		if err := st.CreateToken(&store.Token{
+			ID:               info.ID,
+			UserName:         info.UserName,
+			Mode:             "both",
+			CreatedAt:        info.IssuedAt,
+			ExpiresAt:        info.ExpiresAt,
+			AllowedEndpoints: endpoints,
+		}); err != nil {
+			t.Fatalf("CreateToken: %v", err)
+		}
+		return tokenString
+	}
+	unrestricted := newToken("")
+	messagesOnly := newToken("messages,count_tokens")
+
+	ok := func(c *gin.Context) { c.Status(http.StatusNoContent) }
+	router := gin.New()
+	auth := NewJWTMiddleware(manager, st).Auth()
+	router.POST("/v1/messages", auth, RequireEndpoint(EndpointMessages), ok)
+	router.POST("/v1/chat/completions", auth, RequireEndpoint(EndpointChatCompletions), ok)
+	router.GET("/v1/models", auth, RequireEndpoint(EndpointModels), ok)
+
+	tests := []struct {
+		token  string
+		method string
+		path   string
+		want   int
+	}{
+		{unrestricted, http.MethodPost, "/v1/chat/completions", http.StatusNoContent},
+		{unrestricted, http.MethodGet, "/v1/models", http.StatusNoContent},
+		{messagesOnly, http.MethodPost, "/v1/messages", http.StatusNoContent},
+		{messagesOnly, http.MethodPost, "/v1/chat/completions", http.StatusForbidden},
+		{messagesOnly, http.MethodGet, "/v1/models", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		req.Header.Set("Authorization", "Bearer "+tt.token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Errorf("%s %s: status = %d, want %d (%s)", tt.method, tt.path, w.Code, tt.want, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+// ExternalTokenVerifier validates JWTs issued by external identity providers
+type ExternalTokenVerifier interface {
+	// Handles reports whether the token claims to come from an external issuer
+	Handles(tokenString string) bool
+	// Verify validates the token and returns its "<issuer name>:<sub>" subject
+	Verify(ctx context.Context, tokenString string) (string, error)
+}
+
+// EnableExternalJWTs authenticates bearer tokens issued by external
+// identity providers as the tokens mapped to their subjects. Tokens from
+// other issuers are still validated as ccproxy tokens.
+func (m *JWTMiddleware) EnableExternalJWTs(verifier ExternalTokenVerifier) {
+	m.external = verifier
+}
+
+// externalAuth authenticates as the token mapped to the subject of an
+// externally issued JWT
+func (m *JWTMiddleware) externalAuth(c *gin.Context, tokenString string) {
+	subject, err := m.external.Verify(c.Request.Context(), tokenString)
+	if err != nil {
+		log.Debug().Err(err).Msg("external token rejected")
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"error": "invalid token",
+		})
+		return
+	}
+
+	tokenID, err := m.store.TokenIDByExternalSubject(subject)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to validate token",
+		})
+		return
+	}
+	if tokenID == "" {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"error": "token subject is not mapped to a token",
+		})
+		return
+	}
+
+	token, err := m.store.ValidateToken(tokenID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to validate token",
+		})
+		return
+	}
+	if token == nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"error": "token is revoked or expired",
+		})
+		return
+	}
+
+	m.authenticated(c, token.ID, token.UserName, token.Mode, token)
+}
@@ -0,0 +1,90 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"ccproxy/internal/store"
+	"ccproxy/internal/store/storetest"
+	"ccproxy/pkg/jwt"
+)
+
+// fakeExternalVerifier treats "ext.<subject>" as a valid external token
+// and "ext-bad" as an invalid one
+type fakeExternalVerifier struct{}
+
+func (fakeExternalVerifier) Handles(tokenString string) bool {
+	return strings.HasPrefix(tokenString, "ext")
+}
+
+func (fakeExternalVerifier) Verify(ctx context.Context, tokenString string) (string, error) {
+	subject, ok := strings.CutPrefix(tokenString, "ext.")
+	if !ok {
+		return "", errors.New("bad signature")
+	}
+	return subject, nil
+}
+
+func TestAuth_ExternalJWT(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	st := storetest.NewMemoryStore()
+	manager := jwt.NewManager("test-secret-test-secret-test-secret", "ccproxy")
+	for _, token := range []*store.Token{
+		{ID: "billing", UserName: "billing", Mode: "api", ExternalSubject: "corp:svc-billing"},
+		{ID: "revoked", UserName: "old", Mode: "both", ExternalSubject: "corp:svc-old"},
+	} {
+		token.CreatedAt = time.Now()
+		token.ExpiresAt = time.Now().Add(time.Hour)
+		if err := st.CreateToken(token); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_ = st.RevokeToken("revoked")
+	apiToken, info, err := manager.Generate("jwt-user", "web", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = st.CreateToken(&store.Token{ID: info.ID, UserName: info.UserName, Mode: "web", CreatedAt: info.IssuedAt, ExpiresAt: info.ExpiresAt})
+
+	m := NewJWTMiddleware(manager, st)
+	m.EnableExternalJWTs(fakeExternalVerifier{})
+	router := gin.New()
+	router.GET("/test", m.Auth(), func(c *gin.Context) {
+		c.String(http.StatusOK, c.GetString(ContextKeyTokenID)+"/"+c.GetString(ContextKeyTokenMode))
+	})
+
+	tests := []struct {
+		name     string
+		token    string
+		wantCode int
+		wantBody string
+	}{
+		{"mapped subject", "ext.corp:svc-billing", http.StatusOK, "billing/api"},
+		{"unmapped subject", "ext.corp:svc-unknown", http.StatusUnauthorized, ""},
+		{"revoked token", "ext.corp:svc-old", http.StatusUnauthorized, ""},
+		{"invalid external token", "ext-bad", http.StatusUnauthorized, ""},
+		{"internal token", apiToken, http.StatusOK, info.ID + "/web"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantCode, w.Body.String())
+			}
+			if tt.wantBody != "" && w.Body.String() != tt.wantBody {
+				t.Errorf("body = %q, want %q", w.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HTTPCache makes successful GET responses cacheable for maxAge. See
+// HTTPCacheFunc.
+func HTTPCache(maxAge time.Duration) gin.HandlerFunc {
+	return HTTPCacheFunc(func(*gin.Context) time.Duration { return maxAge })
+}
+
+// HTTPCacheFunc tags successful GET and HEAD responses with an ETag of their
+// body and answers a matching If-None-Match with 304 Not Modified. Clients
+// may reuse a response for the max age returned for the request; with 0 they
+// must revalidate every time. Responses are private, as they depend on the
+// caller's credentials. Other methods and statuses pass through untouched.
+func HTTPCacheFunc(maxAge func(c *gin.Context) time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+			c.Next()
+			return
+		}
+
+		w := &cacheWriter{ResponseWriter: c.Writer, status: http.StatusOK}
+		c.Writer = w
+		c.Next()
+		c.Writer = w.ResponseWriter
+
+		if w.status != http.StatusOK {
+			w.flush()
+			return
+		}
+
+		etag := BodyETag(w.body.Bytes())
+		header := w.Header()
+		header.Set("ETag", etag)
+		cacheControl := "private, no-cache"
+		if age := maxAge(c); age > 0 {
+			cacheControl = "private, max-age=" + strconv.Itoa(int(age.Seconds()))
+		}
+		header.Set("Cache-Control", cacheControl)
+
+		if ETagMatches(c.GetHeader("If-None-Match"), etag) {
+			header.Del("Content-Length")
+			header.Del("Content-Type")
+			w.ResponseWriter.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.flush()
+	}
+}
+
+// BodyETag returns a strong ETag for a response body
+func BodyETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// ETagMatches reports whether an If-None-Match header matches etag. Weak
+// comparison is used, as RFC 9110 requires for If-None-Match.
+func ETagMatches(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// cacheWriter holds the response back until its ETag is known
+type cacheWriter struct {
+	gin.ResponseWriter
+	status  int
+	written bool
+	body    bytes.Buffer
+}
+
+func (w *cacheWriter) WriteHeader(code int) {
+	w.status = code
+}
+
+func (w *cacheWriter) WriteHeaderNow() {
+	w.written = true
+}
+
+func (w *cacheWriter) Write(b []byte) (int, error) {
+	w.written = true
+	return w.body.Write(b)
+}
+
+func (w *cacheWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *cacheWriter) Status() int {
+	return w.status
+}
+
+func (w *cacheWriter) Written() bool {
+	return w.written
+}
+
+func (w *cacheWriter) Size() int {
+	return w.body.Len()
+}
+
+// flush sends the held response unchanged
+func (w *cacheWriter) flush() {
+	w.ResponseWriter.WriteHeader(w.status)
+	_, _ = w.ResponseWriter.Write(w.body.Bytes())
+}
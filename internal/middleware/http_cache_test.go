@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestHTTPCache(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	body := "first"
+	router := gin.New()
+	router.GET("/data", HTTPCache(5*time.Minute), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"value": body})
+	})
+	router.GET("/live", HTTPCache(0), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"value": body})
+	})
+	router.GET("/missing", HTTPCache(time.Minute), func(c *gin.Context) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+	})
+
+	get := func(path, ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	first := get("/data", "")
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag == "" || first.Body.String() != `{"value":"first"}` {
+		t.Fatalf("first response = %d %q etag %q", first.Code, first.Body.String(), etag)
+	}
+	if cc := first.Header().Get("Cache-Control"); cc != "private, max-age=300" {
+		t.Errorf("Cache-Control = %q", cc)
+	}
+
+	tests := []struct {
+		name        string
+		path        string
+		ifNoneMatch string
+		wantCode    int
+	}{
+		{"matching etag", "/data", etag, http.StatusNotModified},
+		{"one of several", "/data", `"other", W/` + etag, http.StatusNotModified},
+		{"wildcard", "/data", "*", http.StatusNotModified},
+		{"stale etag", "/data", `"stale"`, http.StatusOK},
+		{"errors are not cached", "/missing", "*", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := get(tt.path, tt.ifNoneMatch)
+			if w.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantCode)
+			}
+			if tt.wantCode == http.StatusNotModified && w.Body.Len() != 0 {
+				t.Errorf("304 with body %q", w.Body.String())
+			}
+			if tt.wantCode == http.StatusNotFound && (w.Header().Get("ETag") != "" || w.Body.String() != `{"error":"not found"}`) {
+				t.Errorf("error response changed: %v %q", w.Header(), w.Body.String())
+			}
+		})
+	}
+
+	// A changed body gets a new ETag
+	body = "second"
+	if w := get("/data", etag); w.Code != http.StatusOK || w.Header().Get("ETag") == etag {
+		t.Errorf("changed body: status %d, etag %q", w.Code, w.Header().Get("ETag"))
+	}
+	if w := get("/live", ""); w.Header().Get("Cache-Control") != "private, no-cache" {
+		t.Errorf("Cache-Control without max age = %q", w.Header().Get("Cache-Control"))
+	}
+}
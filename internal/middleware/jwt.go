@@ -1,8 +1,12 @@
 package middleware
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
@@ -15,14 +19,36 @@ const (
 	ContextKeyUserName  = "user_name"
 	ContextKeyTokenMode = "token_mode"
 	ContextKeyClaims    = "claims"
+	// ContextKeyMaxRequestDuration holds the token's end-to-end request budget (time.Duration)
+	ContextKeyMaxRequestDuration = "max_request_duration"
+	// ContextKeyResponseFooter holds the token's response footer, if any
+	ContextKeyResponseFooter = "response_footer"
+	// ContextKeyAllowFlagOverrides is set when the token may override feature flags
+	ContextKeyAllowFlagOverrides = "allow_flag_overrides"
+	// ContextKeyParentTokenID holds the issuer token of a child token
+	ContextKeyParentTokenID = "parent_token_id"
+	// ContextKeyPriority holds the token's load shedding priority, if set
+	ContextKeyPriority = "priority"
+	// ContextKeyDefaultModel holds the token's default model, if set
+	ContextKeyDefaultModel = "default_model"
+	// ContextKeyRateLimitBypass holds the rate limit classes the token is exempt from, if any
+	ContextKeyRateLimitBypass = "rate_limit_bypass"
+	// ContextKeyStreamFlushInterval holds how long the token's stream chunks are coalesced (time.Duration), if set
+	ContextKeyStreamFlushInterval = "stream_flush_interval"
+	// ContextKeyStreamFlushBytes holds how many bytes of the token's stream chunks are coalesced, if set
+	ContextKeyStreamFlushBytes = "stream_flush_bytes"
+	// ContextKeyOutputFilters holds the comma-separated filters applied to the token's responses, if any
+	ContextKeyOutputFilters = "output_filters"
 )
 
 type JWTMiddleware struct {
-	jwtManager *jwt.Manager
-	store      *store.Store
+	jwtManager  *jwt.Manager
+	store       store.TokenStore
+	clientCerts bool
+	external    ExternalTokenVerifier
 }
 
-func NewJWTMiddleware(jwtManager *jwt.Manager, store *store.Store) *JWTMiddleware {
+func NewJWTMiddleware(jwtManager *jwt.Manager, store store.TokenStore) *JWTMiddleware {
 	return &JWTMiddleware{
 		jwtManager: jwtManager,
 		store:      store,
@@ -33,12 +59,21 @@ func (m *JWTMiddleware) Auth() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		tokenString := extractToken(c)
 		if tokenString == "" {
+			if cert := m.clientCert(c); cert != nil {
+				m.clientCertAuth(c, cert)
+				return
+			}
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
 				"error": "missing authorization token",
 			})
 			return
 		}
 
+		if m.external != nil && m.external.Handles(tokenString) {
+			m.externalAuth(c, tokenString)
+			return
+		}
+
 		claims, err := m.jwtManager.Validate(tokenString)
 		if err != nil {
 			status := http.StatusUnauthorized
@@ -68,19 +103,144 @@ func (m *JWTMiddleware) Auth() gin.HandlerFunc {
 			return
 		}
 
-		// Update last used time
-		go m.store.UpdateTokenLastUsed(claims.ID)
-
-		// Set context values
-		c.Set(ContextKeyTokenID, claims.ID)
-		c.Set(ContextKeyUserName, claims.UserName)
-		c.Set(ContextKeyTokenMode, claims.Mode)
 		c.Set(ContextKeyClaims, claims)
+		m.authenticated(c, claims.ID, claims.UserName, claims.Mode, token)
+	}
+}
+
+// authenticated sets the context of an authenticated token and serves the
+// request within the token's request budget
+func (m *JWTMiddleware) authenticated(c *gin.Context, tokenID, userName, mode string, token *store.Token) {
+	// A child token gets no more than its issuer currently has
+	if token.ParentID != "" {
+		issuer, err := m.store.ValidateToken(token.ParentID)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"error": "failed to validate token",
+			})
+			return
+		}
+		if issuer == nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": "issuing token is revoked or expired",
+			})
+			return
+		}
+		var ok bool
+		if token, mode, ok = narrowToIssuer(token, mode, issuer); !ok {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": "issuing token no longer allows this token's mode or endpoints",
+			})
+			return
+		}
+	}
+
+	// Update last used time
+	go m.store.UpdateTokenLastUsed(tokenID)
 
+	// Set context values
+	c.Set(ContextKeyTokenID, tokenID)
+	c.Set(ContextKeyUserName, userName)
+	c.Set(ContextKeyTokenMode, mode)
+	if token.ResponseFooter != "" {
+		c.Set(ContextKeyResponseFooter, token.ResponseFooter)
+	}
+	if token.AllowFlagOverrides {
+		c.Set(ContextKeyAllowFlagOverrides, true)
+	}
+	if token.ParentID != "" {
+		c.Set(ContextKeyParentTokenID, token.ParentID)
+	}
+	if token.Priority != "" {
+		c.Set(ContextKeyPriority, token.Priority)
+	}
+	if token.DefaultModel != "" {
+		c.Set(ContextKeyDefaultModel, token.DefaultModel)
+	}
+	if token.RateLimitBypass != "" {
+		c.Set(ContextKeyRateLimitBypass, token.RateLimitBypass)
+	}
+	if token.AllowedEndpoints != "" {
+		c.Set(ContextKeyAllowedEndpoints, token.AllowedEndpoints)
+	}
+	if token.StreamFlushMs > 0 {
+		c.Set(ContextKeyStreamFlushInterval, time.Duration(token.StreamFlushMs)*time.Millisecond)
+	}
+	if token.StreamFlushBytes > 0 {
+		c.Set(ContextKeyStreamFlushBytes, token.StreamFlushBytes)
+	}
+	if token.OutputFilters != "" {
+		c.Set(ContextKeyOutputFilters, token.OutputFilters)
+	}
+
+	if token.MaxRequestSeconds <= 0 {
 		c.Next()
+		return
+	}
+
+	// Enforce the token's request budget on everything downstream: slot waits,
+	// conversation creation, completion and retries all use the request context
+	budget := time.Duration(token.MaxRequestSeconds) * time.Second
+	ctx, cancel := context.WithTimeout(c.Request.Context(), budget)
+	defer cancel()
+	c.Request = c.Request.WithContext(ctx)
+	c.Set(ContextKeyMaxRequestDuration, budget)
+
+	c.Next()
+
+	if RequestTimedOut(c) && !c.Writer.Written() {
+		AbortWithRequestTimeout(c)
 	}
 }
 
+// MaxRequestDuration returns the token's request budget, or 0 when unlimited
+func MaxRequestDuration(c *gin.Context) time.Duration {
+	return c.GetDuration(ContextKeyMaxRequestDuration)
+}
+
+// ResponseFooter returns the text to append to the token's responses, or ""
+func ResponseFooter(c *gin.Context) string {
+	return c.GetString(ContextKeyResponseFooter)
+}
+
+// OutputFilters returns the comma-separated filters applied to the token's
+// responses, or ""
+func OutputFilters(c *gin.Context) string {
+	return c.GetString(ContextKeyOutputFilters)
+}
+
+// AllowFlagOverrides reports whether the token may override feature flags per request
+func AllowFlagOverrides(c *gin.Context) bool {
+	return c.GetBool(ContextKeyAllowFlagOverrides)
+}
+
+// QuotaSubject returns the id rate limits and concurrency slots are counted
+// against: the issuer for child tokens, so they share its limits, otherwise
+// tokenID
+func QuotaSubject(c *gin.Context, tokenID string) string {
+	if parent := c.GetString(ContextKeyParentTokenID); parent != "" {
+		return parent
+	}
+	return tokenID
+}
+
+// RequestTimedOut reports whether the token's request budget has run out
+func RequestTimedOut(c *gin.Context) bool {
+	return MaxRequestDuration(c) > 0 && errors.Is(c.Request.Context().Err(), context.DeadlineExceeded)
+}
+
+// AbortWithRequestTimeout responds with a structured timeout error
+func AbortWithRequestTimeout(c *gin.Context) {
+	budget := MaxRequestDuration(c)
+	c.AbortWithStatusJSON(http.StatusGatewayTimeout, gin.H{
+		"error": gin.H{
+			"type":                "request_timeout",
+			"message":             fmt.Sprintf("request exceeded the token's max duration of %s", budget),
+			"max_request_seconds": int(budget.Seconds()),
+		},
+	})
+}
+
 func (m *JWTMiddleware) RequireMode(modes ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		tokenMode, exists := c.Get(ContextKeyTokenMode)
@@ -110,14 +270,36 @@ func (m *JWTMiddleware) RequireMode(modes ...string) gin.HandlerFunc {
 	}
 }
 
+// Admin roles. Viewers may only read the admin API.
+const (
+	AdminRoleAdmin  = "admin"
+	AdminRoleViewer = "viewer"
+
+	// AdminSessionCookie carries an SSO admin session
+	AdminSessionCookie = "ccproxy_admin_session"
+
+	ContextKeyAdminRole    = "admin_role"
+	ContextKeyAdminSubject = "admin_subject"
+)
+
 type AdminMiddleware struct {
-	adminKey string
+	adminKey   string
+	jwtManager *jwt.Manager
+	sessions   store.AdminSessionStore
 }
 
 func NewAdminMiddleware(adminKey string) *AdminMiddleware {
 	return &AdminMiddleware{adminKey: adminKey}
 }
 
+// EnableSessions accepts SSO admin sessions signed by jwtManager in addition
+// to the static admin key. Only sessions recorded in sessions and not revoked
+// are accepted.
+func (m *AdminMiddleware) EnableSessions(jwtManager *jwt.Manager, sessions store.AdminSessionStore) {
+	m.jwtManager = jwtManager
+	m.sessions = sessions
+}
+
 func (m *AdminMiddleware) Auth() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		key := c.GetHeader("X-Admin-Key")
@@ -125,17 +307,84 @@ func (m *AdminMiddleware) Auth() gin.HandlerFunc {
 			key = c.Query("admin_key")
 		}
 
-		if key == "" || key != m.adminKey {
+		if key != "" && key == m.adminKey {
+			c.Set(ContextKeyAdminRole, AdminRoleAdmin)
+			c.Set(ContextKeyAdminSubject, "admin-key")
+			c.Next()
+			return
+		}
+
+		session := m.sessionClaims(c)
+		if key != "" || session == nil {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
 				"error": "invalid or missing admin key",
 			})
 			return
 		}
 
+		if session.Role != AdminRoleAdmin && !(session.Role == AdminRoleViewer && isReadOnlyMethod(c.Request.Method)) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": "admin role " + session.Role + " does not permit this request",
+			})
+			return
+		}
+
+		c.Set(ContextKeyAdminRole, session.Role)
+		c.Set(ContextKeyAdminSubject, session.Subject)
+		c.Next()
+	}
+}
+
+// sessionClaims returns the SSO session from the cookie or a bearer token,
+// unless it was revoked
+func (m *AdminMiddleware) sessionClaims(c *gin.Context) *jwt.AdminSessionClaims {
+	if m.jwtManager == nil {
+		return nil
+	}
+	tokenString := AdminSessionToken(c)
+	if tokenString == "" {
+		return nil
+	}
+	claims, err := m.jwtManager.ValidateAdminSession(tokenString)
+	if err != nil {
+		return nil
+	}
+	session, err := m.sessions.GetAdminSession(claims.ID)
+	if err != nil || session == nil || session.RevokedAt != nil {
+		return nil
+	}
+	return claims
+}
+
+// AdminSessionToken returns the SSO session JWT from the cookie or a bearer token
+func AdminSessionToken(c *gin.Context) string {
+	tokenString, _ := c.Cookie(AdminSessionCookie)
+	if tokenString == "" {
+		if parts := strings.SplitN(c.GetHeader("Authorization"), " ", 2); len(parts) == 2 && strings.ToLower(parts[0]) == "bearer" {
+			tokenString = parts[1]
+		}
+	}
+	return tokenString
+}
+
+// RequireAdminRole rejects viewers. It runs after AdminMiddleware.Auth, for
+// read-only routes that are still too costly or sensitive for viewers.
+func RequireAdminRole() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if role := c.GetString(ContextKeyAdminRole); role != AdminRoleAdmin {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": "admin role " + role + " does not permit this request",
+			})
+			return
+		}
 		c.Next()
 	}
 }
 
+func isReadOnlyMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
 func extractToken(c *gin.Context) string {
 	// Check Authorization header
 	authHeader := c.GetHeader("Authorization")
@@ -0,0 +1,227 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"ccproxy/internal/store"
+	"ccproxy/internal/store/storetest"
+	"ccproxy/pkg/jwt"
+)
+
+func newTestRouter(t *testing.T, maxRequestSeconds int, handler gin.HandlerFunc) (*gin.Engine, string) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	st := storetest.NewMemoryStore()
+	manager := jwt.NewManager("test-secret-test-secret-test-secret", "ccproxy")
+	tokenString, info, err := manager.Generate("tester", "both", time.Hour)
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	if err := st.CreateToken(&store.Token{
+		ID:                info.ID,
+		UserName:          info.UserName,
+		Mode:              "both",
+		CreatedAt:         info.IssuedAt,
+		ExpiresAt:         info.ExpiresAt,
+		MaxRequestSeconds: maxRequestSeconds,
+	}); err != nil {
+		t.Fatalf("CreateToken: %v", err)
+	}
+
+	router := gin.New()
+	router.GET("/test", NewJWTMiddleware(manager, st).Auth(), handler)
+	return router, tokenString
+}
+
+func TestAuth_RequestBudgetTimeout(t *testing.T) {
+	router, token := newTestRouter(t, 1, func(c *gin.Context) {
+		// A handler stuck upstream until the context gives up
+		<-c.Request.Context().Done()
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/test", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+
+	start := time.Now()
+	router.ServeHTTP(w, req)
+
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("request took %s, budget was 1s", elapsed)
+	}
+	if w.Code != http.StatusGatewayTimeout {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusGatewayTimeout)
+	}
+
+	var body struct {
+		Error struct {
+			Type              string `json:"type"`
+			MaxRequestSeconds int    `json:"max_request_seconds"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if body.Error.Type != "request_timeout" || body.Error.MaxRequestSeconds != 1 {
+		t.Errorf("unexpected error body: %s", w.Body.String())
+	}
+}
+
+func TestAuth_NoBudget(t *testing.T) {
+	router, token := newTestRouter(t, 0, func(c *gin.Context) {
+		if _, ok := c.Request.Context().Deadline(); ok {
+			t.Error("unexpected deadline without a budget")
+		}
+		if MaxRequestDuration(c) != 0 {
+			t.Error("unexpected budget")
+		}
+		c.Status(http.StatusNoContent)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/test", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNoContent {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusNoContent)
+	}
+}
+
+func TestAdminAuth_Sessions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	manager := jwt.NewManager("test-secret-test-secret-test-secret", "ccproxy")
+	st := storetest.NewMemoryStore()
+	admin := NewAdminMiddleware("admin-key-admin-key")
+	admin.EnableSessions(manager, st)
+
+	router := gin.New()
+	ok := func(c *gin.Context) { c.String(http.StatusOK, c.GetString(ContextKeyAdminRole)) }
+	router.GET("/api/test", admin.Auth(), ok)
+	router.POST("/api/test", admin.Auth(), ok)
+
+	session := func(subject, role string, record bool) (string, string) {
+		tokenString, claims, err := manager.GenerateAdminSession(subject, subject, subject+"@example.com", role, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if record {
+			st.CreateAdminSession(&store.AdminSession{ID: claims.ID, Subject: subject, CreatedAt: claims.IssuedAt.Time, ExpiresAt: claims.ExpiresAt.Time})
+		}
+		return tokenString, claims.ID
+	}
+	viewer, _ := session("user-1", AdminRoleViewer, true)
+	full, _ := session("user-2", AdminRoleAdmin, true)
+	revoked, revokedID := session("user-3", AdminRoleAdmin, true)
+	st.RevokeAdminSession(revokedID)
+	unrecorded, _ := session("user-4", AdminRoleAdmin, false)
+	apiToken, _, err := manager.Generate("tester", "both", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		method   string
+		setup    func(*http.Request)
+		wantCode int
+		wantRole string
+	}{
+		{"admin key", http.MethodPost, func(r *http.Request) { r.Header.Set("X-Admin-Key", "admin-key-admin-key") }, http.StatusOK, AdminRoleAdmin},
+		{"wrong key ignores session", http.MethodGet, func(r *http.Request) {
+			r.Header.Set("X-Admin-Key", "wrong")
+			r.AddCookie(&http.Cookie{Name: AdminSessionCookie, Value: full})
+		}, http.StatusUnauthorized, ""},
+		{"viewer reads", http.MethodGet, func(r *http.Request) { r.AddCookie(&http.Cookie{Name: AdminSessionCookie, Value: viewer}) }, http.StatusOK, AdminRoleViewer},
+		{"viewer writes", http.MethodPost, func(r *http.Request) { r.AddCookie(&http.Cookie{Name: AdminSessionCookie, Value: viewer}) }, http.StatusForbidden, ""},
+		{"admin session writes", http.MethodPost, func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+full) }, http.StatusOK, AdminRoleAdmin},
+		{"revoked session", http.MethodGet, func(r *http.Request) { r.AddCookie(&http.Cookie{Name: AdminSessionCookie, Value: revoked}) }, http.StatusUnauthorized, ""},
+		{"unrecorded session", http.MethodGet, func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+unrecorded) }, http.StatusUnauthorized, ""},
+		{"API token is not a session", http.MethodGet, func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+apiToken) }, http.StatusUnauthorized, ""},
+		{"no credentials", http.MethodGet, func(r *http.Request) {}, http.StatusUnauthorized, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/api/test", nil)
+			tt.setup(req)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantCode)
+			}
+			if tt.wantRole != "" && w.Body.String() != tt.wantRole {
+				t.Errorf("role = %q, want %q", w.Body.String(), tt.wantRole)
+			}
+		})
+	}
+}
+
+func TestAuth_ChildNarrowedToIssuer(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	st := storetest.NewMemoryStore()
+	manager := jwt.NewManager("test-secret-test-secret-test-secret", "ccproxy")
+
+	// The issuer was tightened after its children were minted
+	_, issuer, _ := manager.Generate("team", "api", time.Hour)
+	st.CreateToken(&store.Token{
+		ID: issuer.ID, UserName: "team", Mode: "api", CreatedAt: issuer.IssuedAt, ExpiresAt: issuer.ExpiresAt,
+		IsIssuer: true, AllowedEndpoints: "chat_completions,messages", Priority: "low", MaxRequestSeconds: 30,
+	})
+	child := func(name, mode, endpoints string) string {
+		tokenString, info, _ := manager.Generate(name, mode, time.Hour)
+		st.CreateToken(&store.Token{
+			ID: info.ID, UserName: name, Mode: mode, CreatedAt: info.IssuedAt, ExpiresAt: info.ExpiresAt,
+			ParentID: issuer.ID, AllowedEndpoints: endpoints, Priority: "critical",
+			RateLimitBypass: "ip,global", AllowFlagOverrides: true,
+		})
+		return tokenString
+	}
+
+	router := gin.New()
+	router.GET("/test", NewJWTMiddleware(manager, st).Auth(), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"mode":      c.GetString(ContextKeyTokenMode),
+			"endpoints": c.GetString(ContextKeyAllowedEndpoints),
+			"priority":  c.GetString(ContextKeyPriority),
+			"bypass":    c.GetString(ContextKeyRateLimitBypass),
+			"overrides": AllowFlagOverrides(c),
+			"budget":    MaxRequestDuration(c).String(),
+		})
+	})
+	get := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get(child("dev", "both", "messages,count_tokens"))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d %s", w.Code, w.Body.String())
+	}
+	var got map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &got)
+	want := map[string]interface{}{"mode": "api", "endpoints": "messages", "priority": "low", "bypass": "", "overrides": false, "budget": "30s"}
+	for key, value := range want {
+		if got[key] != value {
+			t.Errorf("%s = %v, want %v", key, got[key], value)
+		}
+	}
+
+	// Nothing left in common with the issuer
+	if w := get(child("web", "web", "")); w.Code != http.StatusForbidden {
+		t.Errorf("child outside the issuer's mode: status = %d", w.Code)
+	}
+	if w := get(child("tokens", "api", "count_tokens")); w.Code != http.StatusForbidden {
+		t.Errorf("child outside the issuer's endpoints: status = %d", w.Code)
+	}
+}
@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"crypto/rand"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// ContextKeyRequestID holds the proxy-assigned request ID
+	ContextKeyRequestID = "request_id"
+
+	// RequestIDHeader returns the proxy request ID to the client. Upstream
+	// request IDs are passed through separately in the request-id header.
+	RequestIDHeader = "X-Request-ID"
+)
+
+const requestIDAlphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// NewRequestID returns an ID in the Anthropic style: "req_" followed by 24
+// base62 characters
+func NewRequestID() string {
+	b := make([]byte, 24)
+	rand.Read(b)
+	for i := range b {
+		b[i] = requestIDAlphabet[int(b[i])%len(requestIDAlphabet)]
+	}
+	return "req_" + string(b)
+}
+
+// RequestID assigns every request an ID, available to handlers through
+// GetRequestID and returned to the client in the X-Request-ID header
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := NewRequestID()
+		c.Set(ContextKeyRequestID, id)
+		c.Header(RequestIDHeader, id)
+		c.Next()
+	}
+}
+
+// GetRequestID returns the request's ID, generating one if the RequestID
+// middleware did not run
+func GetRequestID(c *gin.Context) string {
+	if id := c.GetString(ContextKeyRequestID); id != "" {
+		return id
+	}
+	id := NewRequestID()
+	c.Set(ContextKeyRequestID, id)
+	return id
+}
@@ -0,0 +1,187 @@
+package notify
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/smtp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Summary is the one-line form of an event used by chat and email channels
+func (e Event) Summary() string {
+	summary := fmt.Sprintf("[%s] %s", e.Severity, e.Type)
+	if e.AccountID != "" {
+		summary += " (account " + e.AccountID + ")"
+	}
+	return summary
+}
+
+// Text is the plain text form of an event: summary, message and details
+func (e Event) Text() string {
+	var b strings.Builder
+	b.WriteString(e.Summary())
+	if e.Message != "" {
+		b.WriteString("\n" + e.Message)
+	}
+	keys := make([]string, 0, len(e.Details))
+	for k := range e.Details {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(&b, "\n%s: %v", k, e.Details[k])
+	}
+	return b.String()
+}
+
+// SlackChannel posts events to a Slack incoming webhook
+type SlackChannel struct {
+	url    string
+	client *http.Client
+}
+
+func NewSlackChannel(webhookURL string) *SlackChannel {
+	return &SlackChannel{url: webhookURL, client: &http.Client{}}
+}
+
+// Send posts the event as a message
+func (c *SlackChannel) Send(ctx context.Context, event Event) error {
+	body, err := json.Marshal(map[string]string{"text": event.Text()})
+	if err != nil {
+		return err
+	}
+	return postJSON(ctx, c.client, c.url, body, "slack webhook")
+}
+
+// DefaultTelegramAPIURL is the Telegram Bot API
+const DefaultTelegramAPIURL = "https://api.telegram.org"
+
+// TelegramChannel sends events to a chat through a Telegram bot
+type TelegramChannel struct {
+	apiURL string
+	token  string
+	chatID string
+	client *http.Client
+}
+
+// NewTelegramChannel creates a channel for the bot with the given token. An
+// empty apiURL uses the public Bot API.
+func NewTelegramChannel(apiURL, botToken, chatID string) *TelegramChannel {
+	if apiURL == "" {
+		apiURL = DefaultTelegramAPIURL
+	}
+	return &TelegramChannel{
+		apiURL: strings.TrimSuffix(apiURL, "/"),
+		token:  botToken,
+		chatID: chatID,
+		client: &http.Client{},
+	}
+}
+
+// Send sends the event as a message to the chat
+func (c *TelegramChannel) Send(ctx context.Context, event Event) error {
+	body, err := json.Marshal(map[string]string{"chat_id": c.chatID, "text": event.Text()})
+	if err != nil {
+		return err
+	}
+	return postJSON(ctx, c.client, c.apiURL+"/bot"+c.token+"/sendMessage", body, "telegram")
+}
+
+// SMTPConfig describes an SMTP relay and the recipients of its messages
+type SMTPConfig struct {
+	Host     string
+	Port     int // 465 uses implicit TLS, others upgrade with STARTTLS when offered
+	Username string
+	Password string
+	From     string
+	To       []string
+}
+
+// SMTPChannel emails events
+type SMTPChannel struct {
+	cfg SMTPConfig
+	// now stamps the Date header; replaced in tests
+	now func() time.Time
+}
+
+func NewSMTPChannel(cfg SMTPConfig) *SMTPChannel {
+	if cfg.Port == 0 {
+		cfg.Port = 587
+	}
+	return &SMTPChannel{cfg: cfg, now: time.Now}
+}
+
+// Send emails the event to every recipient
+func (c *SMTPChannel) Send(ctx context.Context, event Event) error {
+	addr := net.JoinHostPort(c.cfg.Host, strconv.Itoa(c.cfg.Port))
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	tlsConfig := &tls.Config{ServerName: c.cfg.Host, MinVersion: tls.VersionTLS12}
+	if c.cfg.Port == 465 {
+		conn = tls.Client(conn, tlsConfig)
+	}
+
+	client, err := smtp.NewClient(conn, c.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok && c.cfg.Port != 465 {
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("starttls: %w", err)
+		}
+	}
+	if c.cfg.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", c.cfg.Username, c.cfg.Password, c.cfg.Host)); err != nil {
+			return fmt.Errorf("auth: %w", err)
+		}
+	}
+	if err := client.Mail(c.cfg.From); err != nil {
+		return err
+	}
+	for _, to := range c.cfg.To {
+		if err := client.Rcpt(to); err != nil {
+			return fmt.Errorf("recipient %s: %w", to, err)
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(c.message(event)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// message renders the event as a plain text email
+func (c *SMTPChannel) message(event Event) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", c.cfg.From)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(c.cfg.To, ", "))
+	fmt.Fprintf(&b, "Subject: ccproxy %s\r\n", event.Summary())
+	fmt.Fprintf(&b, "Date: %s\r\n", c.now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(event.Text(), "\n", "\r\n"))
+	b.WriteString("\r\n")
+	return []byte(b.String())
+}
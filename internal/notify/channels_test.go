@@ -0,0 +1,169 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testEvent = Event{
+	Type:      EventAccountNeedsReauth,
+	Severity:  SeverityCritical,
+	AccountID: "acc-1",
+	Message:   "refresh token rejected",
+	Details:   map[string]interface{}{"status": 400, "error": "invalid_grant"},
+}
+
+func TestEvent_Text(t *testing.T) {
+	want := "[critical] account.needs_reauth (account acc-1)\nrefresh token rejected\nerror: invalid_grant\nstatus: 400"
+	if got := testEvent.Text(); got != want {
+		t.Errorf("Text() = %q, want %q", got, want)
+	}
+}
+
+func TestSlackChannel_Send(t *testing.T) {
+	var got map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+	}))
+	defer server.Close()
+
+	if err := NewSlackChannel(server.URL).Send(context.Background(), testEvent); err != nil {
+		t.Fatal(err)
+	}
+	if got["text"] != testEvent.Text() {
+		t.Errorf("text = %q", got["text"])
+	}
+}
+
+func TestTelegramChannel_Send(t *testing.T) {
+	var path string
+	var got map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		json.NewDecoder(r.Body).Decode(&got)
+		if got["chat_id"] == "bad" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer server.Close()
+
+	if err := NewTelegramChannel(server.URL, "123:abc", "-100").Send(context.Background(), testEvent); err != nil {
+		t.Fatal(err)
+	}
+	if path != "/bot123:abc/sendMessage" || got["chat_id"] != "-100" || got["text"] != testEvent.Text() {
+		t.Errorf("path = %s, body = %v", path, got)
+	}
+
+	err := NewTelegramChannel(server.URL, "123:abc", "bad").Send(context.Background(), testEvent)
+	if err == nil || !strings.Contains(err.Error(), "400") {
+		t.Errorf("err = %v, want the status", err)
+	}
+}
+
+func TestPostJSON_ErrorOmitsURL(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	server.Close()
+
+	err := NewTelegramChannel(server.URL, "123:secret", "-100").Send(context.Background(), testEvent)
+	if err == nil || strings.Contains(err.Error(), "secret") {
+		t.Errorf("err = %v, want a failure without the bot token", err)
+	}
+}
+
+// fakeSMTP accepts one message without authentication and returns the
+// envelope and data it received
+func fakeSMTP(t *testing.T) (addr string, received chan []string) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	received = make(chan []string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+		var lines []string
+		reply("220 fake ESMTP")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+			switch cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0]); cmd {
+			case "EHLO", "HELO":
+				reply("250 fake")
+			case "MAIL", "RCPT":
+				lines = append(lines, line)
+				reply("250 ok")
+			case "DATA":
+				reply("354 go ahead")
+				for {
+					data, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if data == ".\r\n" {
+						break
+					}
+					lines = append(lines, strings.TrimRight(data, "\r\n"))
+				}
+				reply("250 queued")
+			case "QUIT":
+				reply("221 bye")
+				received <- lines
+				return
+			default:
+				reply("502 unsupported")
+			}
+		}
+	}()
+	return ln.Addr().String(), received
+}
+
+func TestSMTPChannel_Send(t *testing.T) {
+	addr, received := fakeSMTP(t)
+	host, portStr, _ := net.SplitHostPort(addr)
+	port, _ := strconv.Atoi(portStr)
+
+	ch := NewSMTPChannel(SMTPConfig{
+		Host: host,
+		Port: port,
+		From: "ccproxy@example.com",
+		To:   []string{"ops@example.com", "oncall@example.com"},
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := ch.Send(ctx, testEvent); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Join(<-received, "\n")
+	for _, want := range []string{
+		"MAIL FROM:<ccproxy@example.com>",
+		"RCPT TO:<ops@example.com>",
+		"RCPT TO:<oncall@example.com>",
+		"To: ops@example.com, oncall@example.com",
+		"Subject: ccproxy [critical] account.needs_reauth (account acc-1)",
+		"refresh token rejected",
+	} {
+		if !strings.Contains(lines, want) {
+			t.Errorf("message missing %q:\n%s", want, lines)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Severity of an event
+type Severity string
+
+const (
+	SeverityInfo     Severity = "info"
+	SeverityWarning  Severity = "warning"
+	SeverityCritical Severity = "critical"
+)
+
+// Event types
+const (
+	EventAccountNeedsReauth     = "account.needs_reauth"
+	EventAccountReauthenticated = "account.reauthenticated"
+	EventAccountBudgetExceeded  = "account.budget_exceeded"
+	EventAccountUsageAnomaly    = "account.usage_anomaly"
+	EventCanaryFailed           = "canary.failed"
+	EventCanaryRecovered        = "canary.recovered"
+	EventSLOBurnRate            = "slo.burn_rate"
+	EventSLORecovered           = "slo.recovered"
+	EventTest                   = "notify.test"
+)
+
+// Event is an operational event delivered to notification channels
+type Event struct {
+	Type      string                 `json:"type"`
+	Severity  Severity               `json:"severity"`
+	AccountID string                 `json:"account_id,omitempty"`
+	Message   string                 `json:"message"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+	Time      time.Time              `json:"time"`
+}
+
+// Notifier delivers events. Implementations must not block the caller.
+type Notifier interface {
+	Notify(event Event)
+}
+
+// Channel delivers a single event and waits for the result
+type Channel interface {
+	Send(ctx context.Context, event Event) error
+}
+
+// Nop discards all events
+type Nop struct{}
+
+func (Nop) Notify(Event) {}
+
+// WebhookNotifier POSTs events as JSON to a URL
+type WebhookNotifier struct {
+	url    string
+	client *http.Client
+}
+
+func NewWebhookNotifier(url string, timeout time.Duration) *WebhookNotifier {
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	return &WebhookNotifier{
+		url:    url,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+// Notify sends the event in the background
+func (n *WebhookNotifier) Notify(event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), n.client.Timeout)
+		defer cancel()
+		if err := n.Send(ctx, event); err != nil {
+			log.Error().Err(err).Str("event", event.Type).Msg("failed to deliver webhook notification")
+		}
+	}()
+}
+
+// Send POSTs the event as JSON
+func (n *WebhookNotifier) Send(ctx context.Context, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return postJSON(ctx, n.client, n.url, body, "webhook")
+}
+
+// postJSON POSTs body to target, failing on non-2xx responses
+func postJSON(ctx context.Context, client *http.Client, target string, body []byte, what string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		// Webhook URLs and bot tokens are secrets, keep them out of errors
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			return fmt.Errorf("%s: %w", what, urlErr.Err)
+		}
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s returned status %d", what, resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWebhookNotifier_Send(t *testing.T) {
+	received := make(chan Event, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+			t.Errorf("Content-Type = %q", ct)
+		}
+		var event Event
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			t.Errorf("decode: %v", err)
+		}
+		received <- event
+	}))
+	defer server.Close()
+
+	n := NewWebhookNotifier(server.URL, time.Second)
+	n.Notify(Event{
+		Type:      EventAccountNeedsReauth,
+		Severity:  SeverityCritical,
+		AccountID: "acc-1",
+		Message:   "refresh token rejected",
+	})
+
+	select {
+	case event := <-received:
+		if event.Type != EventAccountNeedsReauth || event.AccountID != "acc-1" || event.Severity != SeverityCritical {
+			t.Errorf("unexpected event: %+v", event)
+		}
+		if event.Time.IsZero() {
+			t.Error("event time should be set")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("webhook not called")
+	}
+}
+
+func TestWebhookNotifier_SendError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	n := NewWebhookNotifier(server.URL, time.Second)
+	if err := n.Send(context.Background(), Event{Type: "test"}); err == nil {
+		t.Error("expected error for 500 response")
+	}
+}
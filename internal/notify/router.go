@@ -0,0 +1,112 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// ErrUnknownChannel is returned when testing a channel that is not configured
+var ErrUnknownChannel = errors.New("unknown notification channel")
+
+// Route sends the events matching its rules to a channel
+type Route struct {
+	Name    string
+	Type    string // Channel kind, reported by Routes
+	Channel Channel
+	// Events lists event types, or prefixes such as "account.*"; empty matches all
+	Events []string
+	// MinSeverity drops less severe events; empty matches all
+	MinSeverity Severity
+}
+
+// Matches reports whether the route delivers the event
+func (r Route) Matches(event Event) bool {
+	if severityRank(event.Severity) < severityRank(r.MinSeverity) {
+		return false
+	}
+	if len(r.Events) == 0 {
+		return true
+	}
+	for _, pattern := range r.Events {
+		if pattern == event.Type || pattern == "*" {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok && strings.HasPrefix(event.Type, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// severityRank orders severities; unknown ones rank as info
+func severityRank(s Severity) int {
+	switch s {
+	case SeverityWarning:
+		return 1
+	case SeverityCritical:
+		return 2
+	}
+	return 0
+}
+
+// Router is a Notifier delivering each event to the channels whose routing
+// rules match it, in the background
+type Router struct {
+	routes  []Route
+	timeout time.Duration
+}
+
+// NewRouter creates a router; each delivery is bounded by timeout
+func NewRouter(routes []Route, timeout time.Duration) *Router {
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	return &Router{routes: routes, timeout: timeout}
+}
+
+// Notify sends the event to every matching channel in the background
+func (r *Router) Notify(event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	for _, route := range r.routes {
+		if !route.Matches(event) {
+			continue
+		}
+		go func(route Route) {
+			ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+			defer cancel()
+			if err := route.Channel.Send(ctx, event); err != nil {
+				log.Error().Err(err).Str("channel", route.Name).Str("event", event.Type).Msg("failed to deliver notification")
+			}
+		}(route)
+	}
+}
+
+// Routes returns the configured routes
+func (r *Router) Routes() []Route {
+	return r.routes
+}
+
+// Test sends a test event to the named channel, ignoring its routing rules,
+// and waits for the result
+func (r *Router) Test(ctx context.Context, name string) error {
+	for _, route := range r.routes {
+		if route.Name != name {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(ctx, r.timeout)
+		defer cancel()
+		return route.Channel.Send(ctx, Event{
+			Type:     EventTest,
+			Severity: SeverityInfo,
+			Message:  "Test notification from ccproxy",
+			Time:     time.Now(),
+		})
+	}
+	return ErrUnknownChannel
+}
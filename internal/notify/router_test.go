@@ -0,0 +1,102 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRoute_Matches(t *testing.T) {
+	tests := []struct {
+		name  string
+		route Route
+		event Event
+		want  bool
+	}{
+		{"no rules", Route{}, Event{Type: EventCanaryFailed, Severity: SeverityInfo}, true},
+		{"exact type", Route{Events: []string{EventCanaryFailed}}, Event{Type: EventCanaryFailed}, true},
+		{"other type", Route{Events: []string{EventCanaryFailed}}, Event{Type: EventCanaryRecovered}, false},
+		{"prefix", Route{Events: []string{"account.*"}}, Event{Type: EventAccountUsageAnomaly}, true},
+		{"prefix mismatch", Route{Events: []string{"account.*"}}, Event{Type: EventSLOBurnRate}, false},
+		{"severity below", Route{MinSeverity: SeverityWarning}, Event{Type: EventSLORecovered, Severity: SeverityInfo}, false},
+		{"severity above", Route{MinSeverity: SeverityWarning}, Event{Type: EventSLOBurnRate, Severity: SeverityCritical}, true},
+		{"both rules", Route{Events: []string{"slo.*"}, MinSeverity: SeverityCritical}, Event{Type: EventSLOBurnRate, Severity: SeverityWarning}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.route.Matches(tt.event); got != tt.want {
+				t.Errorf("Matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// recordingChannel keeps the events sent to it
+type recordingChannel struct {
+	mu     sync.Mutex
+	events []Event
+	err    error
+}
+
+func (c *recordingChannel) Send(_ context.Context, event Event) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.events = append(c.events, event)
+	return c.err
+}
+
+func (c *recordingChannel) types() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var types []string
+	for _, e := range c.events {
+		types = append(types, e.Type)
+	}
+	return types
+}
+
+func TestRouter_Notify(t *testing.T) {
+	all, critical := &recordingChannel{}, &recordingChannel{}
+	r := NewRouter([]Route{
+		{Name: "all", Channel: all},
+		{Name: "critical", Channel: critical, MinSeverity: SeverityCritical},
+	}, time.Second)
+
+	r.Notify(Event{Type: EventCanaryRecovered, Severity: SeverityInfo})
+	r.Notify(Event{Type: EventCanaryFailed, Severity: SeverityCritical})
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(all.types()) < 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := all.types(); len(got) != 2 {
+		t.Errorf("all channel got %v", got)
+	}
+	if got := critical.types(); len(got) != 1 || got[0] != EventCanaryFailed {
+		t.Errorf("critical channel got %v", got)
+	}
+}
+
+func TestRouter_Test(t *testing.T) {
+	ok, failing := &recordingChannel{}, &recordingChannel{err: errors.New("rejected")}
+	r := NewRouter([]Route{
+		{Name: "ok", Channel: ok, Events: []string{"account.*"}},
+		{Name: "failing", Channel: failing},
+	}, time.Second)
+
+	// Test events ignore the routing rules
+	if err := r.Test(context.Background(), "ok"); err != nil {
+		t.Fatal(err)
+	}
+	if got := ok.types(); len(got) != 1 || got[0] != EventTest {
+		t.Errorf("ok channel got %v", got)
+	}
+	if err := r.Test(context.Background(), "failing"); err == nil || err.Error() != "rejected" {
+		t.Errorf("err = %v, want the channel error", err)
+	}
+	if err := r.Test(context.Background(), "missing"); !errors.Is(err, ErrUnknownChannel) {
+		t.Errorf("err = %v, want ErrUnknownChannel", err)
+	}
+}
@@ -0,0 +1,65 @@
+package pool
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// Egress pins an account's connections to a network path
+type Egress struct {
+	Hosts      map[string]string // Lower-case host name to static IP, skipping DNS
+	DNSServers []string          // "ip" or "ip:port" resolvers tried in order instead of the system resolver
+	LocalAddr  string            // Local IP connections are bound to
+}
+
+// EgressLookup returns the egress of an account, or nil for the default path
+type EgressLookup func(accountID string) *Egress
+
+// dialContext returns a dial function connecting through the egress path
+func (e *Egress) dialContext(dialer *net.Dialer) (func(ctx context.Context, network, addr string) (net.Conn, error), error) {
+	if e.LocalAddr != "" {
+		ip := net.ParseIP(e.LocalAddr)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid local address %q", e.LocalAddr)
+		}
+		dialer.LocalAddr = &net.TCPAddr{IP: ip}
+	}
+
+	if len(e.DNSServers) > 0 {
+		servers := make([]string, len(e.DNSServers))
+		for i, server := range e.DNSServers {
+			if net.ParseIP(server) != nil {
+				server = net.JoinHostPort(server, "53")
+			}
+			servers[i] = server
+		}
+		dnsDialer := &net.Dialer{Timeout: 5 * time.Second}
+		dialer.Resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				var lastErr error
+				for _, server := range servers {
+					conn, err := dnsDialer.DialContext(ctx, network, server)
+					if err == nil {
+						return conn, nil
+					}
+					lastErr = err
+				}
+				return nil, lastErr
+			},
+		}
+	}
+
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err == nil {
+			if ip, ok := e.Hosts[strings.ToLower(host)]; ok {
+				addr = net.JoinHostPort(ip, port)
+			}
+		}
+		return dialer.DialContext(ctx, network, addr)
+	}, nil
+}
@@ -0,0 +1,62 @@
+package pool
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHTTPPool_EgressStaticHost(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Host)
+	}))
+	defer upstream.Close()
+	_, port, _ := net.SplitHostPort(upstream.Listener.Addr().String())
+
+	p := NewHTTPPool(DefaultPoolConfig())
+	defer p.Close()
+	lookups := 0
+	p.SetEgressLookup(func(accountID string) *Egress {
+		lookups++
+		if accountID != "acc-pinned" {
+			return nil
+		}
+		return &Egress{Hosts: map[string]string{"claude.example": "127.0.0.1"}, LocalAddr: "127.0.0.1"}
+	})
+
+	get := func(accountID string) (string, error) {
+		req, _ := http.NewRequest(http.MethodGet, "http://claude.example:"+port+"/", nil)
+		resp, err := p.Do(req, accountID)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		return string(body), err
+	}
+
+	// The pinned account reaches the static IP, keeping the original Host
+	host, err := get("acc-pinned")
+	if err != nil {
+		t.Fatalf("pinned account: %v", err)
+	}
+	if host != "claude.example:"+port {
+		t.Errorf("Host = %q", host)
+	}
+	if _, err := get("acc-pinned"); err != nil || lookups != 1 {
+		t.Errorf("second request: %v, %d lookups", err, lookups)
+	}
+
+	// Others resolve the name normally, which fails for the made-up domain
+	if _, err := get("acc-default"); err == nil {
+		t.Error("unpinned account reached the static IP")
+	}
+
+	// Reset builds a new client with a fresh lookup
+	p.Reset("acc-pinned")
+	if _, err := get("acc-pinned"); err != nil || lookups != 3 {
+		t.Errorf("after reset: %v, %d lookups", err, lookups)
+	}
+}
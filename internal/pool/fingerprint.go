@@ -0,0 +1,150 @@
+package pool
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/imroc/req/v3"
+	utls "github.com/refraction-networking/utls"
+)
+
+// fingerprintProfile is a browser TLS ClientHello together with the HTTP/2
+// settings and header order of the same browser
+type fingerprintProfile struct {
+	hello       utls.ClientHelloID
+	impersonate func(c *req.Client) *req.Client
+}
+
+// fingerprintProfiles are the TLS fingerprints account clients can present
+var fingerprintProfiles = map[string]fingerprintProfile{
+	"chrome_120":  {utls.HelloChrome_120, (*req.Client).ImpersonateChrome},
+	"chrome_106":  {utls.HelloChrome_106_Shuffle, (*req.Client).ImpersonateChrome},
+	"chrome_102":  {utls.HelloChrome_102, (*req.Client).ImpersonateChrome},
+	"firefox_120": {utls.HelloFirefox_120, (*req.Client).ImpersonateFirefox},
+	"firefox_105": {utls.HelloFirefox_105, (*req.Client).ImpersonateFirefox},
+	"safari_16":   {utls.HelloSafari_16_0, (*req.Client).ImpersonateSafari},
+}
+
+// FingerprintProfiles returns the names of the available TLS fingerprints
+func FingerprintProfiles() []string {
+	names := make([]string, 0, len(fingerprintProfiles))
+	for name := range fingerprintProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// FingerprintConfig selects the TLS fingerprint of each account's client
+type FingerprintConfig struct {
+	Profiles       []string          // Profiles accounts rotate through; all when empty
+	RotateInterval time.Duration     // How long an account keeps a profile; 0 never rotates
+	Accounts       map[string]string // Account ID -> profile it always uses
+}
+
+// Fingerprints assigns TLS fingerprint profiles to accounts, so a pool of
+// accounts does not share a single fingerprint. Each account starts at a
+// profile picked from its ID and moves on to the next one every rotation
+// interval, at a time offset per account so the pool never switches at once.
+type Fingerprints struct {
+	profiles []string
+	rotate   time.Duration
+	accounts map[string]string
+	now      func() time.Time
+
+	// direct holds the transports handed out by Transport
+	mu     sync.Mutex
+	direct map[string]*fingerprintTransport
+}
+
+// fingerprintTransport is a transport built for one profile
+type fingerprintTransport struct {
+	profile   string
+	transport *req.Transport
+}
+
+// NewFingerprints creates the fingerprint assignment, rejecting unknown
+// profiles
+func NewFingerprints(cfg FingerprintConfig) (*Fingerprints, error) {
+	profiles := cfg.Profiles
+	if len(profiles) == 0 {
+		profiles = FingerprintProfiles()
+	}
+	for _, name := range profiles {
+		if _, ok := fingerprintProfiles[name]; !ok {
+			return nil, fmt.Errorf("unknown TLS fingerprint profile %q", name)
+		}
+	}
+	for accountID, name := range cfg.Accounts {
+		if _, ok := fingerprintProfiles[name]; !ok {
+			return nil, fmt.Errorf("unknown TLS fingerprint profile %q for account %s", name, accountID)
+		}
+	}
+	return &Fingerprints{
+		profiles: profiles,
+		rotate:   cfg.RotateInterval,
+		accounts: cfg.Accounts,
+		now:      time.Now,
+		direct:   make(map[string]*fingerprintTransport),
+	}, nil
+}
+
+// Profile returns the profile an account uses now
+func (f *Fingerprints) Profile(accountID string) string {
+	if name, ok := f.accounts[accountID]; ok {
+		return name
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(accountID))
+	sum := h.Sum64()
+
+	var slot uint64
+	if f.rotate > 0 {
+		interval := uint64(f.rotate)
+		slot = (uint64(f.now().UnixNano()) + sum%interval) / interval
+	}
+	return f.profiles[(sum+slot)%uint64(len(f.profiles))]
+}
+
+// Transport returns a transport presenting the account's current profile,
+// for callers that do not go through the pool. A nil Fingerprints returns
+// nil, the default transport.
+func (f *Fingerprints) Transport(accountID string) http.RoundTripper {
+	if f == nil {
+		return nil
+	}
+	profile := f.Profile(accountID)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if entry, ok := f.direct[accountID]; ok {
+		if entry.profile == profile {
+			return entry.transport
+		}
+		// Rotated; requests in flight finish on the old connections
+		entry.transport.CloseIdleConnections()
+	}
+	transport := newFingerprintTransport(profile, nil)
+	f.direct[accountID] = &fingerprintTransport{profile: profile, transport: transport}
+	return transport
+}
+
+// newFingerprintTransport builds a transport presenting a profile, dialing
+// through dial if given
+func newFingerprintTransport(profile string, dial func(ctx context.Context, network, addr string) (net.Conn, error)) *req.Transport {
+	p := fingerprintProfiles[profile]
+	c := p.impersonate(req.C()).SetTLSFingerprint(p.hello)
+	transport := c.GetTransport()
+	if dial != nil {
+		transport.SetDial(dial)
+	}
+	return transport
+}
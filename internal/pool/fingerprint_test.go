@@ -0,0 +1,175 @@
+package pool
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/imroc/req/v3"
+
+	"ccproxy/internal/config"
+)
+
+func TestFingerprintProfiles_MatchConfig(t *testing.T) {
+	got, want := FingerprintProfiles(), config.TLSFingerprintProfiles
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("pool profiles %v, config profiles %v", got, want)
+	}
+}
+
+func TestFingerprints_Profile(t *testing.T) {
+	profiles := []string{"chrome_120", "firefox_120", "safari_16"}
+	f, err := NewFingerprints(FingerprintConfig{
+		Profiles:       profiles,
+		RotateInterval: time.Hour,
+		Accounts:       map[string]string{"acc-pinned": "chrome_102"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	f.now = func() time.Time { return now }
+
+	if got := f.Profile("acc-pinned"); got != "chrome_102" {
+		t.Errorf("pinned profile = %s", got)
+	}
+
+	used := map[string]bool{}
+	for i := 0; i < 20; i++ {
+		used[f.Profile(fmt.Sprintf("acc-%d", i))] = true
+	}
+	if len(used) < 2 {
+		t.Errorf("20 accounts share profiles %v", used)
+	}
+
+	// Every interval an account moves on to the next profile
+	index := func(name string) int {
+		for i, p := range profiles {
+			if p == name {
+				return i
+			}
+		}
+		t.Fatalf("profile %s not configured", name)
+		return -1
+	}
+	before := index(f.Profile("acc-1"))
+	now = now.Add(time.Hour)
+	if after := index(f.Profile("acc-1")); after != (before+1)%len(profiles) {
+		t.Errorf("profile index after rotation = %d, want %d", after, (before+1)%len(profiles))
+	}
+
+	f.rotate = 0
+	first := f.Profile("acc-1")
+	now = now.Add(48 * time.Hour)
+	if got := f.Profile("acc-1"); got != first {
+		t.Errorf("profile changed without rotation: %s -> %s", first, got)
+	}
+}
+
+func TestNewFingerprints_UnknownProfile(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  FingerprintConfig
+	}{
+		{"profile", FingerprintConfig{Profiles: []string{"chrome_120", "netscape_4"}}},
+		{"account", FingerprintConfig{Accounts: map[string]string{"acc-1": "opera"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewFingerprints(tt.cfg); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestHTTPPool_Fingerprints(t *testing.T) {
+	var mu sync.Mutex
+	var hellos []*tls.ClientHelloInfo
+	upstream := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	upstream.EnableHTTP2 = true
+	upstream.TLS = &tls.Config{
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			mu.Lock()
+			hellos = append(hellos, hello)
+			mu.Unlock()
+			return nil, nil
+		},
+	}
+	upstream.StartTLS()
+	defer upstream.Close()
+	roots := x509.NewCertPool()
+	roots.AddCert(upstream.Certificate())
+
+	f, err := NewFingerprints(FingerprintConfig{
+		Profiles:       []string{"chrome_120", "chrome_106"},
+		RotateInterval: time.Hour,
+		Accounts:       map[string]string{"acc-firefox": "firefox_120"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := NewHTTPPool(DefaultPoolConfig())
+	defer p.Close()
+	p.SetFingerprints(f)
+
+	// hello sends a request for an account and returns the ClientHello of its
+	// new connection
+	hello := func(accountID string) *tls.ClientHelloInfo {
+		t.Helper()
+		client := p.GetClient(accountID)
+		client.Transport.(*req.Transport).TLSClientConfig.RootCAs = roots
+		resp, err := client.Get(upstream.URL)
+		if err != nil {
+			t.Fatalf("request for %s: %v", accountID, err)
+		}
+		resp.Body.Close()
+		client.CloseIdleConnections()
+
+		mu.Lock()
+		defer mu.Unlock()
+		if len(hellos) == 0 {
+			t.Fatalf("no handshake for %s", accountID)
+		}
+		h := hellos[len(hellos)-1]
+		hellos = nil
+		return h
+	}
+
+	chrome, firefox := hello("acc-chrome"), hello("acc-firefox")
+	if !hasGREASE(chrome.CipherSuites) {
+		t.Errorf("chrome profile cipher suites %x have no GREASE value", chrome.CipherSuites)
+	}
+	if hasGREASE(firefox.CipherSuites) {
+		t.Errorf("firefox profile cipher suites %x have a GREASE value", firefox.CipherSuites)
+	}
+
+	// A rotation rebuilds the client on its next use
+	before := p.GetClient("acc-chrome")
+	if p.GetClient("acc-chrome") != before {
+		t.Error("client rebuilt without rotation")
+	}
+	f.now = func() time.Time { return time.Now().Add(time.Hour) }
+	if p.GetClient("acc-chrome") == before {
+		t.Error("client kept after its fingerprint rotated")
+	}
+}
+
+// hasGREASE reports whether a cipher suite list holds a GREASE value, which
+// Chrome sends and Firefox does not
+func hasGREASE(suites []uint16) bool {
+	for _, s := range suites {
+		if s&0x0f0f == 0x0a0a {
+			return true
+		}
+	}
+	return false
+}
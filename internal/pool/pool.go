@@ -1,13 +1,17 @@
 package pool
 
 import (
+	"context"
 	"crypto/tls"
 	"net"
 	"net/http"
 	"sync"
 	"time"
 
+	"github.com/imroc/req/v3"
 	"github.com/rs/zerolog/log"
+
+	"ccproxy/internal/httpclient"
 )
 
 // PoolConfig holds configuration for the connection pool
@@ -40,6 +44,9 @@ type Pool interface {
 	Do(req *http.Request, accountID string) (*http.Response, error)
 	// Stats returns pool statistics
 	Stats() PoolStats
+	// Reset drops an account's client so the next request builds a new one,
+	// e.g. after its egress changed
+	Reset(accountID string)
 	// Close closes all clients in the pool
 	Close()
 }
@@ -51,13 +58,20 @@ type PoolStats struct {
 	IdleConns    int `json:"idle_conns"`
 }
 
+// idleTransport is a transport whose idle connections can be closed
+type idleTransport interface {
+	http.RoundTripper
+	CloseIdleConnections()
+}
+
 // clientEntry represents a cached client with metadata
 type clientEntry struct {
-	client     *http.Client
-	transport  *http.Transport
-	accountID  string
-	createdAt  time.Time
-	lastUsedAt time.Time
+	client      *http.Client
+	transport   idleTransport
+	fingerprint string // TLS fingerprint profile; "" for the Go default
+	accountID   string
+	createdAt   time.Time
+	lastUsedAt  time.Time
 }
 
 // HTTPPool implements Pool with LRU eviction
@@ -71,12 +85,24 @@ type HTTPPool struct {
 	// Shared transport for accounts without specific config
 	sharedTransport *http.Transport
 	sharedClient    *http.Client
+
+	// egress looks up the network path of accounts when their client is built
+	egress EgressLookup
+	// wrap decorates the transport of account clients when they are built
+	wrap TransportWrapper
+	// fingerprints picks the TLS fingerprint of account clients; nil keeps
+	// Go's default handshake
+	fingerprints *Fingerprints
 }
 
+// TransportWrapper decorates the transport of an account's client, e.g. to
+// sample its exchanges
+type TransportWrapper func(accountID string, rt http.RoundTripper) http.RoundTripper
+
 // NewHTTPPool creates a new HTTP connection pool
 func NewHTTPPool(config PoolConfig) *HTTPPool {
 	// Create shared transport with HTTP/2 support
-	sharedTransport := createTransport(config)
+	sharedTransport, _ := createTransport(config, nil)
 
 	pool := &HTTPPool{
 		config:          config,
@@ -95,14 +121,17 @@ func NewHTTPPool(config PoolConfig) *HTTPPool {
 	return pool
 }
 
-// createTransport creates an HTTP transport with HTTP/2 support
-func createTransport(config PoolConfig) *http.Transport {
+// createTransport creates an HTTP transport with HTTP/2 support, connecting
+// through the egress path if one is given
+func createTransport(config PoolConfig, egress *Egress) (*http.Transport, error) {
+	dial, err := egressDial(egress)
+	if err != nil {
+		return nil, err
+	}
+
 	transport := &http.Transport{
-		Proxy: http.ProxyFromEnvironment,
-		DialContext: (&net.Dialer{
-			Timeout:   30 * time.Second,
-			KeepAlive: 30 * time.Second,
-		}).DialContext,
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dial,
 		ForceAttemptHTTP2:     true, // Enables HTTP/2 automatically for HTTPS
 		MaxIdleConns:          config.MaxIdleConns,
 		MaxIdleConnsPerHost:   config.MaxIdleConnsPerHost,
@@ -114,9 +143,56 @@ func createTransport(config PoolConfig) *http.Transport {
 		},
 	}
 
+	return transport, nil
+}
+
+// createFingerprintTransport creates a transport presenting a TLS fingerprint
+// profile, connecting through the egress path if one is given
+func createFingerprintTransport(config PoolConfig, egress *Egress, profile string) (*req.Transport, error) {
+	dial, err := egressDial(egress)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := newFingerprintTransport(profile, dial)
+	transport.SetMaxIdleConns(config.MaxIdleConns)
+	transport.MaxIdleConnsPerHost = config.MaxIdleConnsPerHost
+	transport.SetIdleConnTimeout(config.IdleConnTimeout)
+	return transport, nil
+}
+
+// createAccountTransport creates the transport of an account's client,
+// falling back to the default path if its egress is invalid
+func createAccountTransport(config PoolConfig, egress *Egress, profile, accountID string) idleTransport {
+	if profile != "" {
+		transport, err := createFingerprintTransport(config, egress, profile)
+		if err != nil {
+			log.Error().Err(err).Str("account_id", accountID).Msg("invalid account egress, using the default path")
+			transport, _ = createFingerprintTransport(config, nil, profile)
+		}
+		return transport
+	}
+	transport, err := createTransport(config, egress)
+	if err != nil {
+		log.Error().Err(err).Str("account_id", accountID).Msg("invalid account egress, using the default path")
+		transport, _ = createTransport(config, nil)
+	}
 	return transport
 }
 
+// egressDial returns the dial function for an egress path, or the default
+// dialer for none
+func egressDial(egress *Egress) (func(ctx context.Context, network, addr string) (net.Conn, error), error) {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	if egress == nil {
+		return dialer.DialContext, nil
+	}
+	return egress.dialContext(dialer)
+}
+
 // GetClient returns an HTTP client for the given account
 func (p *HTTPPool) GetClient(accountID string) *http.Client {
 	if accountID == "" {
@@ -124,32 +200,48 @@ func (p *HTTPPool) GetClient(accountID string) *http.Client {
 	}
 
 	p.mu.Lock()
-	defer p.mu.Unlock()
+	if client, ok := p.cachedClient(accountID); ok {
+		p.mu.Unlock()
+		return client
+	}
+	lookup, wrap, fingerprints := p.egress, p.wrap, p.fingerprints
+	p.mu.Unlock()
 
-	if p.closed {
-		return p.sharedClient
+	// Look up the egress outside the lock; it may hit the database
+	var egress *Egress
+	if lookup != nil {
+		egress = lookup(accountID)
+	}
+	var profile string
+	if fingerprints != nil {
+		profile = fingerprints.Profile(accountID)
 	}
+	transport := createAccountTransport(p.config, egress, profile, accountID)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
 
-	// Check if client exists
-	if entry, ok := p.clients[accountID]; ok {
-		entry.lastUsedAt = time.Now()
-		p.moveToFront(accountID)
-		return entry.client
+	// Another request may have built the client meanwhile
+	if client, ok := p.cachedClient(accountID); ok {
+		transport.CloseIdleConnections()
+		return client
 	}
 
-	// Create new client
-	transport := createTransport(p.config)
 	client := &http.Client{
 		Transport: transport,
 		Timeout:   p.config.ResponseTimeout,
 	}
+	if wrap != nil {
+		client.Transport = wrap(accountID, transport)
+	}
 
 	entry := &clientEntry{
-		client:     client,
-		transport:  transport,
-		accountID:  accountID,
-		createdAt:  time.Now(),
-		lastUsedAt: time.Now(),
+		client:      client,
+		transport:   transport,
+		fingerprint: profile,
+		accountID:   accountID,
+		createdAt:   time.Now(),
+		lastUsedAt:  time.Now(),
 	}
 
 	// Evict if at capacity
@@ -160,15 +252,99 @@ func (p *HTTPPool) GetClient(accountID string) *http.Client {
 	p.clients[accountID] = entry
 	p.order = append([]string{accountID}, p.order...)
 
-	log.Debug().Str("account_id", accountID).Int("pool_size", len(p.clients)).Msg("created new client")
+	log.Debug().
+		Str("account_id", accountID).
+		Int("pool_size", len(p.clients)).
+		Bool("egress", egress != nil).
+		Str("fingerprint", profile).
+		Msg("created new client")
 
 	return client
 }
 
-// Do executes a request using the appropriate client
+// cachedClient returns the client of an account if it exists, or the shared
+// client once the pool is closed; the caller holds p.mu
+func (p *HTTPPool) cachedClient(accountID string) (*http.Client, bool) {
+	if p.closed {
+		return p.sharedClient, true
+	}
+	entry, ok := p.clients[accountID]
+	if !ok {
+		return nil, false
+	}
+	// A client whose fingerprint rotated out is rebuilt; requests in flight
+	// finish on its connections
+	if p.fingerprints != nil && entry.fingerprint != p.fingerprints.Profile(accountID) {
+		p.remove(accountID)
+		return nil, false
+	}
+	entry.lastUsedAt = time.Now()
+	p.moveToFront(accountID)
+	return entry.client, true
+}
+
+// SetEgressLookup sets how the network path of an account is found when its
+// client is built
+func (p *HTTPPool) SetEgressLookup(lookup EgressLookup) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.egress = lookup
+}
+
+// SetTransportWrapper sets how the transport of an account's client is
+// decorated when the client is built
+func (p *HTTPPool) SetTransportWrapper(wrap TransportWrapper) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.wrap = wrap
+}
+
+// SetFingerprints presents a TLS fingerprint profile per account; clients
+// built before are rebuilt on their next use
+func (p *HTTPPool) SetFingerprints(f *Fingerprints) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.fingerprints = f
+}
+
+// Reset drops an account's client so the next request builds a new one.
+// In-flight requests finish on the old connections.
+func (p *HTTPPool) Reset(accountID string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.remove(accountID)
+}
+
+// remove drops an account's client; the caller holds p.mu
+func (p *HTTPPool) remove(accountID string) {
+	entry, ok := p.clients[accountID]
+	if !ok {
+		return
+	}
+	entry.transport.CloseIdleConnections()
+	delete(p.clients, accountID)
+	for i, id := range p.order {
+		if id == accountID {
+			p.order = append(p.order[:i], p.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// Do executes a request using the appropriate client. The response body is
+// decoded if the upstream compressed it, which happens whenever the caller
+// set Accept-Encoding itself.
 func (p *HTTPPool) Do(req *http.Request, accountID string) (*http.Response, error) {
 	client := p.GetClient(accountID)
-	return client.Do(req)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := httpclient.DecodeResponseBody(resp); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return resp, nil
 }
 
 // Stats returns pool statistics
@@ -0,0 +1,56 @@
+package pool
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+func TestHTTPPool_TransportWrapper(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	defer upstream.Close()
+
+	p := NewHTTPPool(DefaultPoolConfig())
+	defer p.Close()
+	seen := map[string]int{}
+	p.SetTransportWrapper(func(accountID string, rt http.RoundTripper) http.RoundTripper {
+		return roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			seen[accountID]++
+			return rt.RoundTrip(r)
+		})
+	})
+
+	for _, accountID := range []string{"acc-1", "acc-1", ""} {
+		req, _ := http.NewRequest(http.MethodGet, upstream.URL, nil)
+		resp, err := p.Do(req, accountID)
+		if err != nil {
+			t.Fatalf("Do(%q): %v", accountID, err)
+		}
+		resp.Body.Close()
+	}
+	if seen["acc-1"] != 2 {
+		t.Errorf("acc-1 requests seen = %d, want 2", seen["acc-1"])
+	}
+	if seen[""] != 0 {
+		t.Error("the shared client was wrapped")
+	}
+
+	// Reset rebuilds the client, which still uses the transport of its account
+	p.Reset("acc-1")
+	req, _ := http.NewRequest(http.MethodGet, upstream.URL, nil)
+	resp, err := p.Do(req, "acc-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if seen["acc-1"] != 3 {
+		t.Errorf("acc-1 requests seen after reset = %d, want 3", seen["acc-1"])
+	}
+}
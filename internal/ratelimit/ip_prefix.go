@@ -0,0 +1,35 @@
+package ratelimit
+
+import (
+	"net/netip"
+)
+
+// Default prefix lengths client IPs are grouped by: a /24 is a typical
+// smallest IPv4 allocation, and a /64 is a single IPv6 subnet, which one
+// client can rotate through freely
+const (
+	DefaultIPv4Prefix = 24
+	DefaultIPv6Prefix = 64
+)
+
+// IPPrefix returns the network of ip with the given prefix length for its
+// family, e.g. "203.0.113.0/24" or "2001:db8:1:2::/64". IPv4-mapped IPv6
+// addresses count as IPv4. Values that are not IP addresses are returned
+// unchanged, so they still get a bucket of their own.
+func IPPrefix(ip string, ipv4Bits, ipv6Bits int) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ip
+	}
+	addr = addr.Unmap()
+
+	bits := ipv6Bits
+	if addr.Is4() {
+		bits = ipv4Bits
+	}
+	prefix, err := addr.WithZone("").Prefix(bits)
+	if err != nil {
+		return ip
+	}
+	return prefix.String()
+}
@@ -2,6 +2,8 @@ package ratelimit
 
 import (
 	"context"
+	"fmt"
+	"strings"
 	"time"
 )
 
@@ -12,6 +14,13 @@ type RateLimitConfig struct {
 	AccountLimit LimitRule   `mapstructure:"account_limit"`
 	IPLimit      LimitRule   `mapstructure:"ip_limit"`
 	GlobalLimit  LimitRule   `mapstructure:"global_limit"`
+	// EndUserLimit applies per end user (metadata.user_id) within a token; 0 requests = disabled
+	EndUserLimit LimitRule `mapstructure:"end_user_limit"`
+	// IPPrefixLimit applies per network of client IPs, so rotating addresses
+	// within a prefix shares one budget; 0 requests = disabled
+	IPPrefixLimit LimitRule `mapstructure:"ip_prefix_limit"`
+	IPv4Prefix    int       `mapstructure:"ipv4_prefix"` // Prefix length IPv4 clients are grouped by, default 24
+	IPv6Prefix    int       `mapstructure:"ipv6_prefix"` // Prefix length IPv6 clients are grouped by, default 64
 }
 
 // LimitRule defines a rate limit rule
@@ -40,6 +49,12 @@ func DefaultRateLimitConfig() RateLimitConfig {
 			Requests: 10000,
 			Window:   1 * time.Minute,
 		},
+		IPPrefixLimit: LimitRule{
+			Requests: 0, // Disabled until configured
+			Window:   1 * time.Minute,
+		},
+		IPv4Prefix: DefaultIPv4Prefix,
+		IPv6Prefix: DefaultIPv6Prefix,
 	}
 }
 
@@ -51,6 +66,79 @@ type Result struct {
 	RetryAt   *time.Time    `json:"retry_at,omitempty"`
 	Limit     int           `json:"limit"`
 	Window    time.Duration `json:"window"`
+	Bypassed  []string      `json:"bypassed,omitempty"` // Classes skipped by CheckAllExcept
+}
+
+// LimitStatus is the state of one rate limit for a key
+type LimitStatus struct {
+	Name string `json:"name"` // "global", "user", "ip", "ip_prefix" or "end_user"
+	Result
+}
+
+// Rate limit classes a token can be exempted from
+const (
+	ClassIP     = "ip"
+	ClassGlobal = "global"
+)
+
+// BypassClasses lists the rate limit classes a token can be exempted from
+var BypassClasses = []string{ClassIP, ClassGlobal}
+
+// Bypass selects the rate limit classes a request is exempt from, for trusted
+// internal services sharing an IP or running bulk jobs. Per-token limits
+// always apply.
+type Bypass struct {
+	IP     bool
+	Global bool
+}
+
+// ParseBypass parses a comma-separated list of classes; unknown classes are
+// ignored
+func ParseBypass(classes string) Bypass {
+	var b Bypass
+	for _, class := range strings.Split(classes, ",") {
+		switch strings.TrimSpace(class) {
+		case ClassIP:
+			b.IP = true
+		case ClassGlobal:
+			b.Global = true
+		}
+	}
+	return b
+}
+
+// NormalizeBypass validates a list of classes and returns it sorted and
+// comma-separated, as stored on tokens
+func NormalizeBypass(classes []string) (string, error) {
+	var b Bypass
+	for _, class := range classes {
+		switch strings.ToLower(strings.TrimSpace(class)) {
+		case ClassIP:
+			b.IP = true
+		case ClassGlobal:
+			b.Global = true
+		default:
+			return "", fmt.Errorf("unknown rate limit class %q (valid: %s)", class, strings.Join(BypassClasses, ", "))
+		}
+	}
+	return b.String(), nil
+}
+
+// Classes lists the bypassed classes
+func (b Bypass) Classes() []string {
+	var classes []string
+	if b.IP {
+		classes = append(classes, ClassIP)
+	}
+	if b.Global {
+		classes = append(classes, ClassGlobal)
+	}
+	return classes
+}
+
+// String is the comma-separated list of bypassed classes
+func (b Bypass) String() string {
+	return strings.Join(b.Classes(), ",")
 }
 
 // Limiter checks rate limits for a single key
@@ -65,14 +153,21 @@ type Limiter interface {
 type MultiLimiter interface {
 	// CheckAll checks all applicable limits
 	CheckAll(ctx context.Context, userID, accountID, ip string) (*Result, error)
+	// CheckAllExcept checks all applicable limits but the bypassed classes
+	CheckAllExcept(ctx context.Context, userID, accountID, ip string, bypass Bypass) (*Result, error)
 	// CheckUser checks user limit
 	CheckUser(ctx context.Context, userID string) (*Result, error)
 	// CheckAccount checks account limit
 	CheckAccount(ctx context.Context, accountID string) (*Result, error)
-	// CheckIP checks IP limit
+	// CheckIP checks the IP limit and the limit of the IP's network prefix
 	CheckIP(ctx context.Context, ip string) (*Result, error)
+	// CheckEndUser checks the limit of an end user of a token
+	CheckEndUser(ctx context.Context, userID, endUserID string) (*Result, error)
 	// CheckGlobal checks global limit
 	CheckGlobal(ctx context.Context) (*Result, error)
+	// PeekAll reports the limits a request would be checked against without
+	// counting it; endUserID and ip may be empty
+	PeekAll(ctx context.Context, userID, endUserID, ip string) []LimitStatus
 	// Stats returns rate limit statistics
 	Stats() LimiterStats
 	// Close closes the limiter
@@ -84,5 +179,6 @@ type LimiterStats struct {
 	TotalChecks   int64 `json:"total_checks"`
 	TotalAllowed  int64 `json:"total_allowed"`
 	TotalDenied   int64 `json:"total_denied"`
+	TotalBypassed int64 `json:"total_bypassed"` // Limit checks skipped for exempt tokens
 	ActiveBuckets int   `json:"active_buckets"`
 }
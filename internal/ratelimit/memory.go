@@ -92,6 +92,41 @@ func (l *memoryLimiter) Allow(ctx context.Context, key string) (*Result, error)
 	}, nil
 }
 
+// Peek reports whether a request would be allowed without counting it
+func (l *memoryLimiter) Peek(key string) *Result {
+	if l.rule.Requests <= 0 || l.rule.Window <= 0 {
+		return &Result{Allowed: true, Remaining: -1, Limit: -1}
+	}
+
+	windowID := time.Now().UnixNano() / int64(l.rule.Window)
+	resetAt := time.Unix(0, windowID*int64(l.rule.Window)).Add(l.rule.Window)
+
+	var count int64
+	l.mu.RLock()
+	b, ok := l.buckets[key]
+	l.mu.RUnlock()
+	if ok {
+		b.mu.Lock()
+		if b.windowID == windowID {
+			count = b.count
+		}
+		b.mu.Unlock()
+	}
+
+	result := &Result{
+		Allowed:   count < int64(l.rule.Requests),
+		Remaining: l.rule.Requests - int(count),
+		ResetAt:   resetAt,
+		Limit:     l.rule.Requests,
+		Window:    l.rule.Window,
+	}
+	if !result.Allowed {
+		result.Remaining = 0
+		result.RetryAt = &resetAt
+	}
+	return result
+}
+
 // Reset resets the limit for a key
 func (l *memoryLimiter) Reset(ctx context.Context, key string) error {
 	l.mu.Lock()
@@ -102,15 +137,18 @@ func (l *memoryLimiter) Reset(ctx context.Context, key string) error {
 
 // MultiMemoryLimiter implements MultiLimiter using memory
 type MultiMemoryLimiter struct {
-	config        RateLimitConfig
-	userLimiter   *memoryLimiter
-	acctLimiter   *memoryLimiter
-	ipLimiter     *memoryLimiter
-	globalLimiter *memoryLimiter
-
-	totalChecks  int64
-	totalAllowed int64
-	totalDenied  int64
+	config          RateLimitConfig
+	userLimiter     *memoryLimiter
+	acctLimiter     *memoryLimiter
+	ipLimiter       *memoryLimiter
+	ipPrefixLimiter *memoryLimiter
+	globalLimiter   *memoryLimiter
+	endUserLimiter  *memoryLimiter
+
+	totalChecks   int64
+	totalAllowed  int64
+	totalDenied   int64
+	totalBypassed int64
 
 	closed bool
 	mu     sync.RWMutex
@@ -118,12 +156,20 @@ type MultiMemoryLimiter struct {
 
 // NewMultiMemoryLimiter creates a new multi-level memory limiter
 func NewMultiMemoryLimiter(config RateLimitConfig) MultiLimiter {
+	if config.IPv4Prefix <= 0 || config.IPv4Prefix > 32 {
+		config.IPv4Prefix = DefaultIPv4Prefix
+	}
+	if config.IPv6Prefix <= 0 || config.IPv6Prefix > 128 {
+		config.IPv6Prefix = DefaultIPv6Prefix
+	}
 	m := &MultiMemoryLimiter{
-		config:        config,
-		userLimiter:   newMemoryLimiter(config.UserLimit),
-		acctLimiter:   newMemoryLimiter(config.AccountLimit),
-		ipLimiter:     newMemoryLimiter(config.IPLimit),
-		globalLimiter: newMemoryLimiter(config.GlobalLimit),
+		config:          config,
+		userLimiter:     newMemoryLimiter(config.UserLimit),
+		acctLimiter:     newMemoryLimiter(config.AccountLimit),
+		ipLimiter:       newMemoryLimiter(config.IPLimit),
+		ipPrefixLimiter: newMemoryLimiter(config.IPPrefixLimit),
+		globalLimiter:   newMemoryLimiter(config.GlobalLimit),
+		endUserLimiter:  newMemoryLimiter(config.EndUserLimit),
 	}
 
 	// Start cleanup goroutine
@@ -134,14 +180,24 @@ func NewMultiMemoryLimiter(config RateLimitConfig) MultiLimiter {
 
 // CheckAll checks all applicable limits
 func (m *MultiMemoryLimiter) CheckAll(ctx context.Context, userID, accountID, ip string) (*Result, error) {
+	return m.CheckAllExcept(ctx, userID, accountID, ip, Bypass{})
+}
+
+// CheckAllExcept checks all applicable limits but the bypassed classes
+func (m *MultiMemoryLimiter) CheckAllExcept(ctx context.Context, userID, accountID, ip string, bypass Bypass) (*Result, error) {
 	if !m.config.Enabled {
 		return &Result{Allowed: true, Remaining: -1}, nil
 	}
 
 	atomic.AddInt64(&m.totalChecks, 1)
 
+	var bypassed []string
+
 	// Check global first
-	if result, err := m.CheckGlobal(ctx); err != nil || !result.Allowed {
+	if bypass.Global {
+		atomic.AddInt64(&m.totalBypassed, 1)
+		bypassed = append(bypassed, ClassGlobal)
+	} else if result, err := m.CheckGlobal(ctx); err != nil || !result.Allowed {
 		if result != nil && !result.Allowed {
 			atomic.AddInt64(&m.totalDenied, 1)
 		}
@@ -169,7 +225,10 @@ func (m *MultiMemoryLimiter) CheckAll(ctx context.Context, userID, accountID, ip
 	}
 
 	// Check IP
-	if ip != "" {
+	if ip != "" && bypass.IP {
+		atomic.AddInt64(&m.totalBypassed, 1)
+		bypassed = append(bypassed, ClassIP)
+	} else if ip != "" {
 		if result, err := m.CheckIP(ctx, ip); err != nil || !result.Allowed {
 			if result != nil && !result.Allowed {
 				atomic.AddInt64(&m.totalDenied, 1)
@@ -179,7 +238,7 @@ func (m *MultiMemoryLimiter) CheckAll(ctx context.Context, userID, accountID, ip
 	}
 
 	atomic.AddInt64(&m.totalAllowed, 1)
-	return &Result{Allowed: true, Remaining: -1}, nil
+	return &Result{Allowed: true, Remaining: -1, Bypassed: bypassed}, nil
 }
 
 // CheckUser checks user limit
@@ -192,9 +251,28 @@ func (m *MultiMemoryLimiter) CheckAccount(ctx context.Context, accountID string)
 	return m.acctLimiter.Allow(ctx, "account:"+accountID)
 }
 
-// CheckIP checks IP limit
+// CheckIP checks the IP limit, then the limit of the IP's network prefix.
+// A request denied by the IP limit is not counted against the prefix.
 func (m *MultiMemoryLimiter) CheckIP(ctx context.Context, ip string) (*Result, error) {
-	return m.ipLimiter.Allow(ctx, "ip:"+ip)
+	result, err := m.ipLimiter.Allow(ctx, "ip:"+ip)
+	if err != nil || !result.Allowed {
+		return result, err
+	}
+	return m.ipPrefixLimiter.Allow(ctx, m.ipPrefixKey(ip))
+}
+
+// ipPrefixKey is the bucket key of the network prefix of ip
+func (m *MultiMemoryLimiter) ipPrefixKey(ip string) string {
+	return "ip_prefix:" + IPPrefix(ip, m.config.IPv4Prefix, m.config.IPv6Prefix)
+}
+
+// CheckEndUser checks the end user limit. End users are scoped to the token,
+// so the same identifier sent through two tokens is counted separately.
+func (m *MultiMemoryLimiter) CheckEndUser(ctx context.Context, userID, endUserID string) (*Result, error) {
+	if !m.config.Enabled {
+		return &Result{Allowed: true, Remaining: -1}, nil
+	}
+	return m.endUserLimiter.Allow(ctx, "end_user:"+userID+":"+endUserID)
 }
 
 // CheckGlobal checks global limit
@@ -202,6 +280,28 @@ func (m *MultiMemoryLimiter) CheckGlobal(ctx context.Context) (*Result, error) {
 	return m.globalLimiter.Allow(ctx, "global")
 }
 
+// PeekAll reports the global, user, IP, IP prefix and end user limits a
+// request would be checked against, in the order CheckAll and CheckEndUser
+// apply them, without counting it
+func (m *MultiMemoryLimiter) PeekAll(ctx context.Context, userID, endUserID, ip string) []LimitStatus {
+	if !m.config.Enabled {
+		return nil
+	}
+
+	statuses := []LimitStatus{{Name: "global", Result: *m.globalLimiter.Peek("global")}}
+	if userID != "" {
+		statuses = append(statuses, LimitStatus{Name: "user", Result: *m.userLimiter.Peek("user:" + userID)})
+	}
+	if ip != "" {
+		statuses = append(statuses, LimitStatus{Name: "ip", Result: *m.ipLimiter.Peek("ip:" + ip)})
+		statuses = append(statuses, LimitStatus{Name: "ip_prefix", Result: *m.ipPrefixLimiter.Peek(m.ipPrefixKey(ip))})
+	}
+	if userID != "" && endUserID != "" {
+		statuses = append(statuses, LimitStatus{Name: "end_user", Result: *m.endUserLimiter.Peek("end_user:" + userID + ":" + endUserID)})
+	}
+	return statuses
+}
+
 // Stats returns rate limiter statistics
 func (m *MultiMemoryLimiter) Stats() LimiterStats {
 	m.userLimiter.mu.RLock()
@@ -216,11 +316,20 @@ func (m *MultiMemoryLimiter) Stats() LimiterStats {
 	ipBuckets := len(m.ipLimiter.buckets)
 	m.ipLimiter.mu.RUnlock()
 
+	m.ipPrefixLimiter.mu.RLock()
+	ipPrefixBuckets := len(m.ipPrefixLimiter.buckets)
+	m.ipPrefixLimiter.mu.RUnlock()
+
+	m.endUserLimiter.mu.RLock()
+	endUserBuckets := len(m.endUserLimiter.buckets)
+	m.endUserLimiter.mu.RUnlock()
+
 	return LimiterStats{
 		TotalChecks:   atomic.LoadInt64(&m.totalChecks),
 		TotalAllowed:  atomic.LoadInt64(&m.totalAllowed),
 		TotalDenied:   atomic.LoadInt64(&m.totalDenied),
-		ActiveBuckets: userBuckets + acctBuckets + ipBuckets + 1, // +1 for global
+		TotalBypassed: atomic.LoadInt64(&m.totalBypassed),
+		ActiveBuckets: userBuckets + acctBuckets + ipBuckets + ipPrefixBuckets + endUserBuckets + 1, // +1 for global
 	}
 }
 
@@ -249,7 +358,9 @@ func (m *MultiMemoryLimiter) cleanup() {
 		m.cleanupLimiter(m.userLimiter)
 		m.cleanupLimiter(m.acctLimiter)
 		m.cleanupLimiter(m.ipLimiter)
+		m.cleanupLimiter(m.ipPrefixLimiter)
 		m.cleanupLimiter(m.globalLimiter)
+		m.cleanupLimiter(m.endUserLimiter)
 	}
 }
 
@@ -164,3 +164,208 @@ func TestLimiter_Stats(t *testing.T) {
 		t.Errorf("expected 5 total allowed, got %d", stats.TotalAllowed)
 	}
 }
+
+func TestMultiLimiter_CheckEndUser(t *testing.T) {
+	config := RateLimitConfig{
+		Enabled: true,
+		EndUserLimit: LimitRule{
+			Requests: 2,
+			Window:   1 * time.Second,
+		},
+	}
+	limiter := NewMultiMemoryLimiter(config)
+	defer limiter.Close()
+
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		result, err := limiter.CheckEndUser(ctx, "token1", "alice")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !result.Allowed {
+			t.Errorf("request %d should be allowed", i+1)
+		}
+	}
+
+	result, _ := limiter.CheckEndUser(ctx, "token1", "alice")
+	if result.Allowed {
+		t.Error("should be denied when end user limit reached")
+	}
+
+	// Other end users of the token, and the same end user under another token, have their own limit
+	result, _ = limiter.CheckEndUser(ctx, "token1", "bob")
+	if !result.Allowed {
+		t.Error("different end user should be allowed")
+	}
+	result, _ = limiter.CheckEndUser(ctx, "token2", "alice")
+	if !result.Allowed {
+		t.Error("same end user under another token should be allowed")
+	}
+
+	// No end user limit configured
+	unlimited := NewMultiMemoryLimiter(RateLimitConfig{Enabled: true})
+	defer unlimited.Close()
+	for i := 0; i < 10; i++ {
+		if result, _ := unlimited.CheckEndUser(ctx, "token1", "alice"); !result.Allowed {
+			t.Fatal("end user limit should be disabled by default")
+		}
+	}
+}
+
+func TestMemoryLimiter_PeekDoesNotCount(t *testing.T) {
+	limiter := NewMultiMemoryLimiter(RateLimitConfig{
+		Enabled:   true,
+		UserLimit: LimitRule{Requests: 2, Window: time.Minute},
+	})
+	defer limiter.Close()
+
+	ctx := context.Background()
+	for i := 0; i < 5; i++ {
+		limiter.PeekAll(ctx, "user1", "", "")
+	}
+
+	limiter.CheckUser(ctx, "user1")
+	statuses := limiter.PeekAll(ctx, "user1", "alice", "10.0.0.1")
+	if len(statuses) != 5 || statuses[1].Name != "user" {
+		t.Fatalf("unexpected statuses: %+v", statuses)
+	}
+	if user := statuses[1]; !user.Allowed || user.Remaining != 1 {
+		t.Errorf("user limit after one request: %+v", user)
+	}
+
+	limiter.CheckUser(ctx, "user1")
+	user := limiter.PeekAll(ctx, "user1", "", "")[1]
+	if user.Allowed || user.RetryAt == nil {
+		t.Errorf("user limit should be exhausted: %+v", user)
+	}
+
+	disabled := NewMultiMemoryLimiter(RateLimitConfig{})
+	defer disabled.Close()
+	if statuses := disabled.PeekAll(ctx, "user1", "", ""); statuses != nil {
+		t.Errorf("disabled limiter reported %+v", statuses)
+	}
+}
+
+func TestMultiLimiter_CheckAllExcept(t *testing.T) {
+	limiter := NewMultiMemoryLimiter(RateLimitConfig{
+		Enabled:     true,
+		UserLimit:   LimitRule{Requests: 10, Window: time.Minute},
+		IPLimit:     LimitRule{Requests: 1, Window: time.Minute},
+		GlobalLimit: LimitRule{Requests: 3, Window: time.Minute},
+	})
+	defer limiter.Close()
+	ctx := context.Background()
+
+	if result, _ := limiter.CheckAll(ctx, "user1", "", "10.0.0.1"); !result.Allowed || result.Bypassed != nil {
+		t.Fatalf("first request: %+v", result)
+	}
+	if result, _ := limiter.CheckAll(ctx, "user1", "", "10.0.0.1"); result.Allowed {
+		t.Fatal("second request from the IP should be denied")
+	}
+
+	result, _ := limiter.CheckAllExcept(ctx, "user2", "", "10.0.0.1", ParseBypass("ip"))
+	if !result.Allowed || len(result.Bypassed) != 1 || result.Bypassed[0] != ClassIP {
+		t.Fatalf("ip bypass: %+v", result)
+	}
+	if result, _ := limiter.CheckAllExcept(ctx, "user2", "", "10.0.0.2", ParseBypass("ip")); result.Allowed {
+		t.Error("global limit should still apply to an ip bypass")
+	}
+	result, _ = limiter.CheckAllExcept(ctx, "user2", "", "10.0.0.1", ParseBypass("global, ip"))
+	if !result.Allowed || len(result.Bypassed) != 2 {
+		t.Fatalf("full bypass: %+v", result)
+	}
+	if stats := limiter.Stats(); stats.TotalBypassed != 3 {
+		t.Errorf("TotalBypassed = %d, want 3", stats.TotalBypassed)
+	}
+}
+
+func TestNormalizeBypass(t *testing.T) {
+	tests := []struct {
+		classes []string
+		want    string
+		wantErr bool
+	}{
+		{nil, "", false},
+		{[]string{"Global", "ip", "ip"}, "ip,global", false},
+		{[]string{"user"}, "", true},
+	}
+	for _, tt := range tests {
+		got, err := NormalizeBypass(tt.classes)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("NormalizeBypass(%v) = %q, %v", tt.classes, got, err)
+		}
+	}
+}
+
+func TestIPPrefix(t *testing.T) {
+	tests := []struct {
+		ip   string
+		v4   int
+		v6   int
+		want string
+	}{
+		{"203.0.113.77", 24, 64, "203.0.113.0/24"},
+		{"203.0.113.77", 32, 64, "203.0.113.77/32"},
+		{"2001:db8:1:2:aaaa:bbbb:cccc:dddd", 24, 64, "2001:db8:1:2::/64"},
+		{"2001:db8:1:2:aaaa:bbbb:cccc:dddd", 24, 48, "2001:db8:1::/48"},
+		{"::ffff:198.51.100.9", 24, 64, "198.51.100.0/24"},
+		{"fe80::1%eth0", 24, 64, "fe80::/64"},
+		{"not-an-ip", 24, 64, "not-an-ip"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			if got := IPPrefix(tt.ip, tt.v4, tt.v6); got != tt.want {
+				t.Errorf("IPPrefix(%q, %d, %d) = %q, want %q", tt.ip, tt.v4, tt.v6, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMultiLimiter_IPPrefix(t *testing.T) {
+	limiter := NewMultiMemoryLimiter(RateLimitConfig{
+		Enabled:       true,
+		IPLimit:       LimitRule{Requests: 2, Window: time.Minute},
+		IPPrefixLimit: LimitRule{Requests: 3, Window: time.Minute},
+	})
+	defer limiter.Close()
+	ctx := context.Background()
+
+	// Rotating addresses within one /64 shares the prefix budget
+	for i, ip := range []string{"2001:db8::1", "2001:db8::2", "2001:db8::3"} {
+		if result, _ := limiter.CheckIP(ctx, ip); !result.Allowed {
+			t.Fatalf("request %d from %s denied", i+1, ip)
+		}
+	}
+	result, _ := limiter.CheckIP(ctx, "2001:db8::4")
+	if result.Allowed || result.Limit != 3 {
+		t.Errorf("fourth address in the /64: %+v", result)
+	}
+	if result, _ := limiter.CheckIP(ctx, "2001:db8:0:1::1"); !result.Allowed {
+		t.Error("another /64 was denied")
+	}
+
+	// The per-IP limit still applies first and does not use up the prefix
+	for i := 0; i < 2; i++ {
+		if result, _ := limiter.CheckIP(ctx, "192.0.2.1"); !result.Allowed {
+			t.Fatalf("request %d from 192.0.2.1 denied", i+1)
+		}
+	}
+	if result, _ := limiter.CheckIP(ctx, "192.0.2.1"); result.Allowed || result.Limit != 2 {
+		t.Errorf("third request from 192.0.2.1: %+v", result)
+	}
+	if result, _ := limiter.CheckIP(ctx, "192.0.2.200"); !result.Allowed {
+		t.Error("denied per-IP request counted against the /24")
+	}
+
+	var names []string
+	for _, status := range limiter.PeekAll(ctx, "", "", "2001:db8::9") {
+		names = append(names, status.Name)
+		if status.Name == "ip_prefix" && status.Allowed {
+			t.Error("exhausted /64 reported as allowed")
+		}
+	}
+	if len(names) != 3 || names[2] != "ip_prefix" {
+		t.Errorf("peeked limits = %v", names)
+	}
+}
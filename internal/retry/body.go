@@ -0,0 +1,65 @@
+package retry
+
+import (
+	"context"
+	"sync"
+)
+
+// BodyVariant derives a variant of a request body from the original, e.g. a
+// copy with thinking blocks filtered out
+type BodyVariant func(original []byte) []byte
+
+// PreparedBody holds the serialized upstream body of one request and variants
+// derived from it. Each variant is computed at most once, on first use, so
+// retry attempts reuse bodies instead of re-serializing and re-filtering them.
+// It is safe for concurrent use.
+type PreparedBody struct {
+	original []byte
+
+	mu       sync.Mutex
+	variants map[string]*bodyVariant
+}
+
+type bodyVariant struct {
+	once sync.Once
+	data []byte
+}
+
+// NewPreparedBody creates a prepared body around the original serialized body
+func NewPreparedBody(original []byte) *PreparedBody {
+	return &PreparedBody{original: original, variants: make(map[string]*bodyVariant)}
+}
+
+// Original returns the body as first serialized
+func (b *PreparedBody) Original() []byte {
+	return b.original
+}
+
+// Variant returns the named variant, deriving it from the original on the
+// first call. Later calls return the cached result whatever derive they pass.
+func (b *PreparedBody) Variant(name string, derive BodyVariant) []byte {
+	b.mu.Lock()
+	v, ok := b.variants[name]
+	if !ok {
+		v = &bodyVariant{}
+		b.variants[name] = v
+	}
+	b.mu.Unlock()
+
+	v.once.Do(func() { v.data = derive(b.original) })
+	return v.data
+}
+
+type bodyContextKey struct{}
+
+// WithBody attaches a prepared body to ctx. Executor passes ctx on to every
+// attempt, where BodyFromContext retrieves it.
+func WithBody(ctx context.Context, body *PreparedBody) context.Context {
+	return context.WithValue(ctx, bodyContextKey{}, body)
+}
+
+// BodyFromContext returns the prepared body attached with WithBody, or nil
+func BodyFromContext(ctx context.Context) *PreparedBody {
+	body, _ := ctx.Value(bodyContextKey{}).(*PreparedBody)
+	return body
+}
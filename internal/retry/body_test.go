@@ -0,0 +1,59 @@
+package retry
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestPreparedBody_VariantComputedOnce(t *testing.T) {
+	body := NewPreparedBody([]byte("original"))
+
+	var calls atomic.Int32
+	derive := func(original []byte) []byte {
+		calls.Add(1)
+		return append([]byte("filtered "), original...)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if got := body.Variant("filtered", derive); !bytes.Equal(got, []byte("filtered original")) {
+				t.Errorf("variant = %q", got)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := calls.Load(); n != 1 {
+		t.Errorf("derive called %d times, want 1", n)
+	}
+	if got := body.Original(); !bytes.Equal(got, []byte("original")) {
+		t.Errorf("original = %q", got)
+	}
+}
+
+func TestPreparedBody_PassedThroughExecutor(t *testing.T) {
+	body := NewPreparedBody([]byte("payload"))
+	ctx := WithBody(context.Background(), body)
+
+	exec := NewExecutor(NewPolicy(DefaultRetryConfig()))
+	selectFn := func(ctx context.Context, excludeIDs []string) (string, error) { return "acc", nil }
+
+	var seen *PreparedBody
+	_, _ = exec.Execute(ctx, selectFn, func(ctx context.Context, accountID string) (*http.Response, error) {
+		seen = BodyFromContext(ctx)
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+	})
+	if seen != body {
+		t.Error("attempt did not see the prepared body")
+	}
+	if BodyFromContext(context.Background()) != nil {
+		t.Error("expected no body in a bare context")
+	}
+}
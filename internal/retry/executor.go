@@ -13,7 +13,8 @@ import (
 // SelectAccountFunc selects an account, optionally excluding certain IDs
 type SelectAccountFunc func(ctx context.Context, excludeIDs []string) (string, error)
 
-// OperationFunc performs the actual operation
+// OperationFunc performs the actual operation. A body shared by all attempts
+// can be attached to ctx with WithBody and read back with BodyFromContext.
 type OperationFunc func(ctx context.Context, accountID string) (*http.Response, error)
 
 // ExecuteResult contains the result of execution
@@ -1,10 +1,16 @@
 package retry
 
 import (
+	"errors"
 	"net/http"
 	"time"
 )
 
+// ErrSwitchAccount marks an operation error as caused by the account itself,
+// e.g. a Cloudflare challenge. Wrapping errors are not retried on the same
+// account; the executor switches accounts right away.
+var ErrSwitchAccount = errors.New("account unusable, switching account")
+
 // RetryConfig holds retry configuration
 type RetryConfig struct {
 	MaxAttempts        int           `mapstructure:"max_attempts"`         // Max retry attempts per account
@@ -55,6 +61,11 @@ func (p *defaultPolicy) ShouldRetry(err error, resp *http.Response, attempt int)
 		return false
 	}
 
+	// Account-specific errors go straight to another account
+	if errors.Is(err, ErrSwitchAccount) {
+		return false
+	}
+
 	// Network errors are retryable
 	if err != nil {
 		return true
@@ -161,6 +172,9 @@ const (
 
 // ClassifyError classifies an error for retry handling
 func ClassifyError(err error, resp *http.Response) ErrorClassification {
+	if errors.Is(err, ErrSwitchAccount) {
+		return ErrorAccountIssue
+	}
 	if err != nil {
 		return ErrorRetryable
 	}
@@ -1,6 +1,7 @@
 package retry
 
 import (
+	"fmt"
 	"net/http"
 	"testing"
 )
@@ -125,3 +126,18 @@ func TestShouldSwitchAccount(t *testing.T) {
 		})
 	}
 }
+
+func TestErrSwitchAccount(t *testing.T) {
+	policy := NewPolicy(DefaultRetryConfig())
+	err := fmt.Errorf("blocked by Cloudflare challenge: %w", ErrSwitchAccount)
+
+	if policy.ShouldRetry(err, nil, 0) {
+		t.Error("account-specific errors should not be retried on the same account")
+	}
+	if !policy.ShouldSwitchAccount(err, nil) {
+		t.Error("account-specific errors should switch accounts")
+	}
+	if got := ClassifyError(err, nil); got != ErrorAccountIssue {
+		t.Errorf("ClassifyError() = %v, want ErrorAccountIssue", got)
+	}
+}
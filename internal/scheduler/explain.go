@@ -0,0 +1,111 @@
+package scheduler
+
+import (
+	"context"
+)
+
+// Reasons an account is not eligible for a new selection
+const (
+	FilterExcluded    = "excluded"
+	FilterCircuitOpen = "circuit_open"
+)
+
+// Explanation describes how a selection would be made, without making it
+type Explanation struct {
+	// Candidates are the accounts given to the scheduler, in order
+	Candidates []CandidateExplanation `json:"candidates"`
+	// Pin and Sticky are the accounts the user or session is bound to, if any
+	Pin    string `json:"pin,omitempty"`
+	Sticky string `json:"sticky,omitempty"`
+	// Selected is the account that would be picked; it is empty when no
+	// account is eligible or the strategy is random
+	Selected string `json:"selected,omitempty"`
+	// Reason is how Selected is picked: pin, sticky or the strategy, or why
+	// nothing can be
+	Reason    string `json:"reason"`
+	LoadScore int    `json:"load_score,omitempty"`
+}
+
+// CandidateExplanation is one account's standing in a selection
+type CandidateExplanation struct {
+	AccountID string `json:"account_id"`
+	// Draining accounts only serve the pins and sticky sessions bound to them
+	Draining bool `json:"draining,omitempty"`
+	// Filtered is why the account cannot be selected at all
+	Filtered string `json:"filtered,omitempty"`
+}
+
+// Explain reports how SelectAccountWithRetry would choose for opts, without
+// touching statistics, sticky sessions or the round-robin position
+func (s *scheduler) Explain(ctx context.Context, opts SelectOptions, excludeIDs []string) *Explanation {
+	explanation := &Explanation{Candidates: []CandidateExplanation{}}
+
+	availableIDs := s.explainCandidates(explanation, opts.AccountIDs, excludeIDs, false)
+	drainingIDs := s.explainCandidates(explanation, opts.DrainingIDs, excludeIDs, true)
+
+	if len(availableIDs) == 0 && len(drainingIDs) == 0 {
+		explanation.Reason = "no available accounts"
+		return explanation
+	}
+
+	if accountID, ok := s.getPinnedAccount(opts.UserID, opts.SessionHash); ok {
+		explanation.Pin = accountID
+		if s.contains(availableIDs, accountID) || s.contains(drainingIDs, accountID) {
+			explanation.Selected = accountID
+			explanation.Reason = "pin"
+			return explanation
+		}
+	}
+
+	if opts.SessionHash != "" {
+		if accountID, ok := s.GetStickyAccount(ctx, opts.SessionHash); ok {
+			explanation.Sticky = accountID
+			if s.contains(availableIDs, accountID) || s.contains(drainingIDs, accountID) {
+				explanation.Selected = accountID
+				explanation.Reason = "sticky"
+				return explanation
+			}
+		}
+	}
+
+	if len(availableIDs) == 0 {
+		explanation.Reason = "no available accounts; only draining accounts remain"
+		return explanation
+	}
+
+	switch {
+	case s.config.Strategy == StrategyRandom:
+		explanation.Reason = string(StrategyRandom)
+	case s.config.Strategy == StrategyRoundRobin || s.concurrency == nil:
+		// Least loaded falls back to round robin without load information
+		s.mu.RLock()
+		explanation.Selected = availableIDs[s.roundRobinIdx%len(availableIDs)]
+		s.mu.RUnlock()
+		explanation.Reason = string(StrategyRoundRobin)
+	default:
+		explanation.Selected, explanation.LoadScore = s.selectLeastLoaded(availableIDs)
+		explanation.Reason = string(StrategyLeastLoaded)
+	}
+	return explanation
+}
+
+// explainCandidates records why accountIDs are filtered and returns the
+// eligible ones
+func (s *scheduler) explainCandidates(explanation *Explanation, accountIDs, excludeIDs []string, draining bool) []string {
+	notExcluded := s.filterExcluded(accountIDs, excludeIDs)
+	available := notExcluded
+	if s.circuitMgr != nil && len(notExcluded) > 0 {
+		available = s.circuitMgr.GetAvailableAccounts(notExcluded)
+	}
+
+	for _, id := range accountIDs {
+		candidate := CandidateExplanation{AccountID: id, Draining: draining}
+		if !s.contains(notExcluded, id) {
+			candidate.Filtered = FilterExcluded
+		} else if !s.contains(available, id) {
+			candidate.Filtered = FilterCircuitOpen
+		}
+		explanation.Candidates = append(explanation.Candidates, candidate)
+	}
+	return available
+}
@@ -40,12 +40,16 @@ type SelectOptions struct {
 	AccountIDs  []string // Available account IDs
 	SessionHash string   // Session hash for sticky sessions
 	UserID      string   // User ID for load consideration
+	// DrainingIDs are accounts being decommissioned: they keep serving the
+	// pins and sticky sessions bound to them but get no new sessions
+	DrainingIDs []string
 }
 
 // SelectionResult contains the result of account selection
 type SelectionResult struct {
 	AccountID   string        // Selected account ID
 	FromSticky  bool          // Whether selected from sticky session
+	FromPin     bool          // Whether selected from an operator pin
 	LoadScore   int           // Load score of selected account
 	SelectTime  time.Duration // Time taken to select
 }
@@ -56,16 +60,34 @@ type Scheduler interface {
 	SelectAccount(ctx context.Context, opts SelectOptions) (*SelectionResult, error)
 	// SelectAccountWithRetry selects an account excluding certain IDs
 	SelectAccountWithRetry(ctx context.Context, opts SelectOptions, excludeIDs []string) (*SelectionResult, error)
+	// Explain reports how an account would be selected, without selecting it
+	Explain(ctx context.Context, opts SelectOptions, excludeIDs []string) *Explanation
 	// BindStickySession binds a session hash to an account
 	BindStickySession(ctx context.Context, sessionHash, accountID string) error
 	// GetStickyAccount returns the sticky account for a session hash
 	GetStickyAccount(ctx context.Context, sessionHash string) (string, bool)
+	// InvalidateAccount drops the sticky sessions bound to an account, so their
+	// next request is scheduled afresh, and returns how many were dropped
+	InvalidateAccount(accountID string) int
+	// PinAccount forces a user or session hash onto a specific account
+	PinAccount(ctx context.Context, opts PinOptions) (*PinInfo, error)
+	// UnpinAccount removes a pin, returning whether one existed
+	UnpinAccount(ctx context.Context, userID, sessionHash string) bool
+	// ListPins returns all active pins
+	ListPins() []PinInfo
+	// SetHealthScorer sets the source of account health scores used to break load ties
+	SetHealthScorer(scorer HealthScorer)
 	// Stats returns scheduler statistics
 	Stats() SchedulerStats
 	// Close closes the scheduler
 	Close()
 }
 
+// HealthScorer provides a 0-100 health score per account (higher = healthier)
+type HealthScorer interface {
+	HealthScore(accountID string) int
+}
+
 // SchedulerStats contains scheduler statistics
 type SchedulerStats struct {
 	TotalSelections    int64 `json:"total_selections"`
@@ -73,6 +95,32 @@ type SchedulerStats struct {
 	StickyMisses       int64 `json:"sticky_misses"`
 	NoAccountAvailable int64 `json:"no_account_available"`
 	ActiveStickySessions int `json:"active_sticky_sessions"`
+	StickyInvalidations  int64 `json:"sticky_invalidations"`
+	PinHits            int64     `json:"pin_hits"`
+	PinMisses          int64     `json:"pin_misses"`
+	Pins               []PinInfo `json:"pins"`
+}
+
+// PinOptions describes an operator pin; exactly one of UserID or SessionHash is set
+type PinOptions struct {
+	UserID      string
+	SessionHash string
+	AccountID   string
+	TTL         time.Duration // 0 means no expiry
+}
+
+// PinInfo describes an active pin
+type PinInfo struct {
+	UserID      string     `json:"user_id,omitempty"`
+	SessionHash string     `json:"session_hash,omitempty"`
+	AccountID   string     `json:"account_id"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+}
+
+// expired reports whether the pin has passed its expiry
+func (p *PinInfo) expired(now time.Time) bool {
+	return p.ExpiresAt != nil && now.After(*p.ExpiresAt)
 }
 
 // stickyEntry represents a sticky session binding
@@ -87,8 +135,10 @@ type scheduler struct {
 	config       SchedulerConfig
 	circuitMgr   circuit.Manager
 	concurrency  concurrency.Manager
+	healthScorer HealthScorer
 
 	stickySessions map[string]*stickyEntry
+	pins           map[string]*PinInfo // "user:<id>" or "session:<hash>" -> pin
 	roundRobinIdx  int
 	mu             sync.RWMutex
 
@@ -96,6 +146,9 @@ type scheduler struct {
 	stickyHits         int64
 	stickyMisses       int64
 	noAccountAvailable int64
+	pinHits            int64
+	pinMisses          int64
+	stickyInvalidations int64
 
 	closed bool
 }
@@ -107,6 +160,17 @@ func NewScheduler(config SchedulerConfig, circuitMgr circuit.Manager, concurrenc
 		circuitMgr:     circuitMgr,
 		concurrency:    concurrencyMgr,
 		stickySessions: make(map[string]*stickyEntry),
+		pins:           make(map[string]*PinInfo),
+	}
+
+	// Sessions leave an account as soon as its circuit opens, instead of
+	// returning to it when the breaker half-opens
+	if circuitMgr != nil {
+		circuitMgr.OnStateChange(func(accountID string, from, to circuit.State) {
+			if to == circuit.StateOpen {
+				s.InvalidateAccount(accountID)
+			}
+		})
 	}
 
 	// Start cleanup goroutine
@@ -135,18 +199,45 @@ func (s *scheduler) SelectAccountWithRetry(ctx context.Context, opts SelectOptio
 		availableIDs = s.circuitMgr.GetAvailableAccounts(availableIDs)
 	}
 
-	if len(availableIDs) == 0 {
+	drainingIDs := s.filterExcluded(opts.DrainingIDs, excludeIDs)
+	if s.circuitMgr != nil && len(drainingIDs) > 0 {
+		drainingIDs = s.circuitMgr.GetAvailableAccounts(drainingIDs)
+	}
+
+	if len(availableIDs) == 0 && len(drainingIDs) == 0 {
 		s.mu.Lock()
 		s.noAccountAvailable++
 		s.mu.Unlock()
 		return nil, fmt.Errorf("no available accounts")
 	}
 
+	// Check operator pins (user pin takes precedence over session pin)
+	if accountID, ok := s.getPinnedAccount(opts.UserID, opts.SessionHash); ok {
+		if s.contains(availableIDs, accountID) || s.contains(drainingIDs, accountID) {
+			s.mu.Lock()
+			s.pinHits++
+			s.mu.Unlock()
+
+			return &SelectionResult{
+				AccountID:  accountID,
+				FromPin:    true,
+				SelectTime: time.Since(start),
+			}, nil
+		}
+		s.mu.Lock()
+		s.pinMisses++
+		s.mu.Unlock()
+
+		log.Warn().
+			Str("account_id", accountID).
+			Msg("pinned account unavailable, falling back to normal selection")
+	}
+
 	// Check sticky session
 	if opts.SessionHash != "" {
 		if accountID, ok := s.GetStickyAccount(ctx, opts.SessionHash); ok {
-			// Verify account is still available
-			if s.contains(availableIDs, accountID) {
+			// Verify account is still available; draining accounts finish their sessions
+			if s.contains(availableIDs, accountID) || s.contains(drainingIDs, accountID) {
 				s.mu.Lock()
 				s.stickyHits++
 				s.mu.Unlock()
@@ -163,6 +254,14 @@ func (s *scheduler) SelectAccountWithRetry(ctx context.Context, opts SelectOptio
 		s.mu.Unlock()
 	}
 
+	// New sessions only go to accounts that are not draining
+	if len(availableIDs) == 0 {
+		s.mu.Lock()
+		s.noAccountAvailable++
+		s.mu.Unlock()
+		return nil, fmt.Errorf("no available accounts")
+	}
+
 	// Select based on strategy
 	var accountID string
 	var loadScore int
@@ -229,6 +328,137 @@ func (s *scheduler) GetStickyAccount(ctx context.Context, sessionHash string) (s
 	return entry.accountID, true
 }
 
+// InvalidateAccount drops the sticky sessions bound to an account; pins are
+// operator decisions and are kept
+func (s *scheduler) InvalidateAccount(accountID string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	removed := 0
+	for hash, entry := range s.stickySessions {
+		if entry.accountID == accountID {
+			delete(s.stickySessions, hash)
+			removed++
+		}
+	}
+	s.stickyInvalidations += int64(removed)
+
+	if removed > 0 {
+		log.Info().
+			Str("account_id", accountID).
+			Int("sessions", removed).
+			Msg("invalidated sticky sessions")
+	}
+	return removed
+}
+
+// PinAccount forces a user or session hash onto a specific account
+func (s *scheduler) PinAccount(ctx context.Context, opts PinOptions) (*PinInfo, error) {
+	key := pinKey(opts.UserID, opts.SessionHash)
+	if key == "" || (opts.UserID != "" && opts.SessionHash != "") {
+		return nil, fmt.Errorf("exactly one of user_id or session_hash is required")
+	}
+	if opts.AccountID == "" {
+		return nil, fmt.Errorf("account_id is required")
+	}
+
+	now := time.Now()
+	pin := &PinInfo{
+		UserID:      opts.UserID,
+		SessionHash: opts.SessionHash,
+		AccountID:   opts.AccountID,
+		CreatedAt:   now,
+	}
+	if opts.TTL > 0 {
+		expiresAt := now.Add(opts.TTL)
+		pin.ExpiresAt = &expiresAt
+	}
+
+	s.mu.Lock()
+	s.pins[key] = pin
+	s.mu.Unlock()
+
+	log.Info().
+		Str("pin", key).
+		Str("account_id", opts.AccountID).
+		Dur("ttl", opts.TTL).
+		Msg("pinned traffic to account")
+
+	result := *pin
+	return &result, nil
+}
+
+// UnpinAccount removes a pin, returning whether one existed
+func (s *scheduler) UnpinAccount(ctx context.Context, userID, sessionHash string) bool {
+	key := pinKey(userID, sessionHash)
+	if key == "" {
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.pins[key]; !ok {
+		return false
+	}
+	delete(s.pins, key)
+
+	log.Info().Str("pin", key).Msg("removed account pin")
+	return true
+}
+
+// ListPins returns all active pins
+func (s *scheduler) ListPins() []PinInfo {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.listPinsLocked()
+}
+
+// listPinsLocked returns unexpired pins; caller must hold s.mu
+func (s *scheduler) listPinsLocked() []PinInfo {
+	now := time.Now()
+	pins := make([]PinInfo, 0, len(s.pins))
+	for _, pin := range s.pins {
+		if !pin.expired(now) {
+			pins = append(pins, *pin)
+		}
+	}
+	return pins
+}
+
+// getPinnedAccount returns the pinned account for a user or session hash
+func (s *scheduler) getPinnedAccount(userID, sessionHash string) (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if len(s.pins) == 0 {
+		return "", false
+	}
+
+	now := time.Now()
+	for _, key := range []string{pinKey(userID, ""), pinKey("", sessionHash)} {
+		if key == "" {
+			continue
+		}
+		if pin, ok := s.pins[key]; ok && !pin.expired(now) {
+			return pin.AccountID, true
+		}
+	}
+	return "", false
+}
+
+// pinKey builds the pin map key, preferring the user ID
+func pinKey(userID, sessionHash string) string {
+	if userID != "" {
+		return "user:" + userID
+	}
+	if sessionHash != "" {
+		return "session:" + sessionHash
+	}
+	return ""
+}
+
 // Stats returns scheduler statistics
 func (s *scheduler) Stats() SchedulerStats {
 	s.mu.RLock()
@@ -240,6 +470,10 @@ func (s *scheduler) Stats() SchedulerStats {
 		StickyMisses:         s.stickyMisses,
 		NoAccountAvailable:   s.noAccountAvailable,
 		ActiveStickySessions: len(s.stickySessions),
+		StickyInvalidations:  s.stickyInvalidations,
+		PinHits:              s.pinHits,
+		PinMisses:            s.pinMisses,
+		Pins:                 s.listPinsLocked(),
 	}
 }
 
@@ -253,14 +487,48 @@ func (s *scheduler) Close() {
 	log.Info().Msg("scheduler closed")
 }
 
-// selectLeastLoaded selects the account with lowest load
+// SetHealthScorer sets the source of account health scores
+func (s *scheduler) SetHealthScorer(scorer HealthScorer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.healthScorer = scorer
+}
+
+// selectLeastLoaded selects the account with lowest load, using the
+// health score as a tiebreaker between equally loaded accounts
 func (s *scheduler) selectLeastLoaded(accountIDs []string) (string, int) {
 	if s.concurrency == nil {
 		// Fallback to round robin
 		return s.selectRoundRobin(accountIDs), 0
 	}
 
-	return s.concurrency.GetLowestLoadAccount(accountIDs), 0
+	s.mu.RLock()
+	scorer := s.healthScorer
+	s.mu.RUnlock()
+
+	if scorer == nil {
+		return s.concurrency.GetLowestLoadAccount(accountIDs), 0
+	}
+
+	loads := s.concurrency.GetAccountLoad(accountIDs)
+
+	var bestID string
+	bestLoad, bestScore := 0, 0
+	for _, id := range accountIDs {
+		info, ok := loads[id]
+		if !ok {
+			continue
+		}
+		load := info.Current + info.Waiting
+		score := scorer.HealthScore(id)
+		if bestID == "" || load < bestLoad || (load == bestLoad && score > bestScore) {
+			bestID = id
+			bestLoad = load
+			bestScore = score
+		}
+	}
+
+	return bestID, bestLoad
 }
 
 // selectRoundRobin selects the next account in round-robin order
@@ -349,6 +617,12 @@ func (s *scheduler) cleanup() {
 			delete(s.stickySessions, hash)
 		}
 
+		for key, pin := range s.pins {
+			if pin.expired(now) {
+				delete(s.pins, key)
+			}
+		}
+
 		if len(expired) > 0 {
 			log.Debug().Int("expired", len(expired)).Msg("cleaned up sticky sessions")
 		}
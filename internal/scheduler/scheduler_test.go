@@ -2,8 +2,12 @@ package scheduler
 
 import (
 	"context"
+	"fmt"
 	"testing"
 	"time"
+
+	"ccproxy/internal/circuit"
+	"ccproxy/internal/concurrency"
 )
 
 func TestScheduler_SelectAccount(t *testing.T) {
@@ -176,4 +180,289 @@ func TestGenerateStickyHash(t *testing.T) {
 	if hash4 != "" {
 		t.Error("expected empty hash with no inputs")
 	}
+
+	// End users of the same token get separate sessions
+	alice := GenerateStickyHash(StickyHashOptions{UserID: "user123", EndUserID: "alice"})
+	bob := GenerateStickyHash(StickyHashOptions{UserID: "user123", EndUserID: "bob"})
+	if alice == hash1 || alice == bob {
+		t.Error("end user ID should be part of the hash")
+	}
+	if GenerateStickyHash(StickyHashOptions{EndUserID: "alice", SystemPrompt: "You are a helpful assistant"}) == hash3 {
+		t.Error("end user ID should take priority over the system prompt")
+	}
+}
+
+func TestScheduler_PinAccount(t *testing.T) {
+	config := SchedulerConfig{
+		StickySessionTTL: 1 * time.Hour,
+		Strategy:         StrategyRoundRobin,
+	}
+	sched := NewScheduler(config, nil, nil)
+	defer sched.Close()
+
+	ctx := context.Background()
+	accounts := []string{"acc1", "acc2", "acc3"}
+
+	if _, err := sched.PinAccount(ctx, PinOptions{UserID: "user1", AccountID: "acc3"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Pinned user should always get the pinned account
+	for i := 0; i < 3; i++ {
+		result, err := sched.SelectAccount(ctx, SelectOptions{AccountIDs: accounts, UserID: "user1"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if result.AccountID != "acc3" || !result.FromPin {
+			t.Errorf("expected pinned acc3, got %s (from_pin=%v)", result.AccountID, result.FromPin)
+		}
+	}
+
+	// Excluded pinned account falls back to normal selection
+	result, err := sched.SelectAccountWithRetry(ctx, SelectOptions{AccountIDs: accounts, UserID: "user1"}, []string{"acc3"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.AccountID == "acc3" || result.FromPin {
+		t.Errorf("expected fallback away from excluded pin, got %s", result.AccountID)
+	}
+
+	stats := sched.Stats()
+	if stats.PinHits != 3 || stats.PinMisses != 1 || len(stats.Pins) != 1 {
+		t.Errorf("unexpected pin stats: hits=%d misses=%d pins=%d", stats.PinHits, stats.PinMisses, len(stats.Pins))
+	}
+
+	if !sched.UnpinAccount(ctx, "user1", "") {
+		t.Error("expected pin to be removed")
+	}
+	if len(sched.ListPins()) != 0 {
+		t.Error("expected no pins after unpin")
+	}
+
+	// Both or neither key is invalid
+	if _, err := sched.PinAccount(ctx, PinOptions{UserID: "u", SessionHash: "h", AccountID: "acc1"}); err == nil {
+		t.Error("expected error when both user_id and session_hash are set")
+	}
+	if _, err := sched.PinAccount(ctx, PinOptions{AccountID: "acc1"}); err == nil {
+		t.Error("expected error when neither user_id nor session_hash is set")
+	}
+}
+
+func TestScheduler_PinExpiry(t *testing.T) {
+	config := SchedulerConfig{
+		StickySessionTTL: 1 * time.Hour,
+		Strategy:         StrategyRoundRobin,
+	}
+	sched := NewScheduler(config, nil, nil)
+	defer sched.Close()
+
+	ctx := context.Background()
+	if _, err := sched.PinAccount(ctx, PinOptions{SessionHash: "session-hash-1", AccountID: "acc2", TTL: 50 * time.Millisecond}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	result, err := sched.SelectAccount(ctx, SelectOptions{AccountIDs: []string{"acc1", "acc2"}, SessionHash: "session-hash-1"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.FromPin {
+		t.Error("expired pin should not be used")
+	}
+}
+
+type staticScorer map[string]int
+
+func (s staticScorer) HealthScore(accountID string) int {
+	if score, ok := s[accountID]; ok {
+		return score
+	}
+	return 100
+}
+
+func TestScheduler_HealthScoreTiebreak(t *testing.T) {
+	concurrencyMgr := concurrency.NewManager(concurrency.DefaultConcurrencyConfig())
+	config := SchedulerConfig{
+		StickySessionTTL: 1 * time.Hour,
+		Strategy:         StrategyLeastLoaded,
+	}
+	sched := NewScheduler(config, nil, concurrencyMgr)
+	defer sched.Close()
+	sched.SetHealthScorer(staticScorer{"acc1": 40, "acc2": 90, "acc3": 70})
+
+	ctx := context.Background()
+	accounts := []string{"acc1", "acc2", "acc3"}
+
+	// Equal load: healthiest account wins
+	result, err := sched.SelectAccount(ctx, SelectOptions{AccountIDs: accounts})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.AccountID != "acc2" {
+		t.Errorf("expected acc2, got %s", result.AccountID)
+	}
+
+	// Load still takes precedence over health
+	if _, err := concurrencyMgr.AcquireAccountSlot(ctx, "acc2", "tok-1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer concurrencyMgr.ReleaseAccountSlot("acc2", "tok-1")
+
+	result, err = sched.SelectAccount(ctx, SelectOptions{AccountIDs: accounts})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.AccountID != "acc3" {
+		t.Errorf("expected acc3, got %s", result.AccountID)
+	}
+}
+
+func TestScheduler_DrainingAccount(t *testing.T) {
+	config := SchedulerConfig{
+		StickySessionTTL: 1 * time.Hour,
+		Strategy:         StrategyRoundRobin,
+	}
+	sched := NewScheduler(config, nil, nil)
+	defer sched.Close()
+
+	ctx := context.Background()
+	if err := sched.BindStickySession(ctx, "session-on-acc1", "acc1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// acc1 is draining: its sticky session keeps going to it
+	opts := SelectOptions{
+		AccountIDs:  []string{"acc2"},
+		DrainingIDs: []string{"acc1"},
+		SessionHash: "session-on-acc1",
+	}
+	result, err := sched.SelectAccount(ctx, opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.AccountID != "acc1" || !result.FromSticky {
+		t.Errorf("expected sticky session on draining acc1, got %+v", result)
+	}
+
+	// New sessions never land on it
+	for i := 0; i < 4; i++ {
+		opts.SessionHash = fmt.Sprintf("new-session-%d", i)
+		result, err := sched.SelectAccount(ctx, opts)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if result.AccountID != "acc2" {
+			t.Errorf("new session scheduled on %s", result.AccountID)
+		}
+	}
+
+	// With only draining accounts left, new sessions fail
+	opts = SelectOptions{DrainingIDs: []string{"acc1"}, SessionHash: "another-session"}
+	if _, err := sched.SelectAccount(ctx, opts); err == nil {
+		t.Error("expected error when only draining accounts are left")
+	}
+	opts.SessionHash = "session-on-acc1"
+	if result, err := sched.SelectAccount(ctx, opts); err != nil || result.AccountID != "acc1" {
+		t.Errorf("sticky session on the only draining account: %+v, %v", result, err)
+	}
+}
+
+func TestScheduler_InvalidateAccount(t *testing.T) {
+	circuitMgr := circuit.NewManager(circuit.BreakerConfig{
+		Enabled:          true,
+		FailureThreshold: 1,
+		SuccessThreshold: 1,
+		OpenTimeout:      time.Hour,
+	})
+	defer circuitMgr.Close()
+	sched := NewScheduler(SchedulerConfig{StickySessionTTL: time.Hour, Strategy: StrategyRoundRobin}, circuitMgr, nil)
+	defer sched.Close()
+
+	ctx := context.Background()
+	for i, accountID := range []string{"acc1", "acc1", "acc2"} {
+		_ = sched.BindStickySession(ctx, fmt.Sprintf("session-%d", i), accountID)
+	}
+	if _, err := sched.PinAccount(ctx, PinOptions{SessionHash: "pinned", AccountID: "acc1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Opening acc1's circuit drops its sessions but not its pins
+	circuitMgr.RecordFailure("acc1")
+	if _, ok := sched.GetStickyAccount(ctx, "session-0"); ok {
+		t.Error("session-0 still bound after acc1's circuit opened")
+	}
+	if accountID, ok := sched.GetStickyAccount(ctx, "session-2"); !ok || accountID != "acc2" {
+		t.Errorf("session-2 = %q, %v", accountID, ok)
+	}
+	if pins := sched.ListPins(); len(pins) != 1 {
+		t.Errorf("pins = %v", pins)
+	}
+
+	if n := sched.InvalidateAccount("acc2"); n != 1 {
+		t.Errorf("invalidated %d sessions of acc2", n)
+	}
+	if stats := sched.Stats(); stats.StickyInvalidations != 3 || stats.ActiveStickySessions != 0 {
+		t.Errorf("stats = %+v", stats)
+	}
+}
+
+func TestScheduler_Explain(t *testing.T) {
+	circuitMgr := circuit.NewManager(circuit.BreakerConfig{
+		Enabled:          true,
+		FailureThreshold: 1,
+		SuccessThreshold: 1,
+		OpenTimeout:      time.Hour,
+	})
+	defer circuitMgr.Close()
+	sched := NewScheduler(SchedulerConfig{StickySessionTTL: time.Hour, Strategy: StrategyRoundRobin}, circuitMgr, nil)
+	defer sched.Close()
+
+	ctx := context.Background()
+	circuitMgr.RecordFailure("acc3")
+	_ = sched.BindStickySession(ctx, "session-on-drain", "acc4")
+	if _, err := sched.PinAccount(ctx, PinOptions{UserID: "pinned-user", AccountID: "acc3"}); err != nil {
+		t.Fatal(err)
+	}
+
+	base := SelectOptions{AccountIDs: []string{"acc1", "acc2", "acc3"}, DrainingIDs: []string{"acc4"}}
+	tests := []struct {
+		name         string
+		userID       string
+		sessionHash  string
+		wantSelected string
+		wantReason   string
+	}{
+		{"new session", "", "fresh", "acc1", "round_robin"},
+		{"sticky on draining account", "", "session-on-drain", "acc4", "sticky"},
+		{"pin on open circuit falls through", "pinned-user", "", "acc1", "round_robin"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := base
+			opts.UserID = tt.userID
+			opts.SessionHash = tt.sessionHash
+			got := sched.Explain(ctx, opts, []string{"acc2"})
+			if got.Selected != tt.wantSelected || got.Reason != tt.wantReason {
+				t.Errorf("selected %q (%s), want %q (%s)", got.Selected, got.Reason, tt.wantSelected, tt.wantReason)
+			}
+
+			filtered := make(map[string]string)
+			for _, c := range got.Candidates {
+				filtered[c.AccountID] = c.Filtered
+			}
+			want := map[string]string{"acc1": "", "acc2": FilterExcluded, "acc3": FilterCircuitOpen, "acc4": ""}
+			if fmt.Sprint(filtered) != fmt.Sprint(want) {
+				t.Errorf("filtered = %v, want %v", filtered, want)
+			}
+		})
+	}
+
+	// Explaining leaves the scheduler untouched
+	if stats := sched.Stats(); stats.TotalSelections != 0 || stats.ActiveStickySessions != 1 {
+		t.Errorf("stats = %+v", stats)
+	}
+	if result, err := sched.SelectAccount(ctx, SelectOptions{AccountIDs: []string{"acc1", "acc2"}}); err != nil || result.AccountID != "acc1" {
+		t.Errorf("round robin moved by explain: %+v, %v", result, err)
+	}
 }
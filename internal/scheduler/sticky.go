@@ -9,18 +9,23 @@ import (
 // StickyHashOptions contains options for generating a sticky session hash
 type StickyHashOptions struct {
 	UserID        string   // Highest priority: user ID from metadata
+	EndUserID     string   // End user of the calling application (OpenAI user field)
 	SystemPrompt  string   // Second priority: system prompt
 	Messages      []string // Third priority: first user message
 }
 
 // GenerateStickyHash generates a sticky session hash from the given options
-// Priority: metadata.user_id > system prompt > first user message
+// Priority: metadata.user_id > system prompt > first user message.
+// An end user ID keeps each end user of a shared token on its own session.
 func GenerateStickyHash(opts StickyHashOptions) string {
 	var hashInput string
 
-	// Priority 1: User ID from metadata
-	if opts.UserID != "" {
+	// Priority 1: User ID from metadata, scoped to the end user if known
+	if opts.UserID != "" || opts.EndUserID != "" {
 		hashInput = "user:" + opts.UserID
+		if opts.EndUserID != "" {
+			hashInput += "|end_user:" + opts.EndUserID
+		}
 	} else if opts.SystemPrompt != "" {
 		// Priority 2: System prompt (truncated for consistency)
 		hashInput = "system:" + truncateForHash(opts.SystemPrompt, 512)
@@ -0,0 +1,118 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"ccproxy/internal/store"
+)
+
+// DefaultDrainCheckInterval is how often drains are checked for their deadline
+const DefaultDrainCheckInterval = 30 * time.Second
+
+// StickyInvalidator drops the sticky sessions bound to an account, e.g. the
+// scheduler
+type StickyInvalidator interface {
+	InvalidateAccount(accountID string) int
+}
+
+// AccountDrainer periodically deactivates accounts whose drain has ended, so a
+// drained account leaves rotation for good once its sticky sessions had time
+// to finish
+type AccountDrainer struct {
+	store    *store.Store
+	interval time.Duration
+	now      func() time.Time
+	sticky   StickyInvalidator
+
+	mu      sync.Mutex
+	running bool
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+// NewAccountDrainer creates an account drainer
+func NewAccountDrainer(store *store.Store, interval time.Duration) *AccountDrainer {
+	if interval <= 0 {
+		interval = DefaultDrainCheckInterval
+	}
+	return &AccountDrainer{
+		store:    store,
+		interval: interval,
+		now:      time.Now,
+	}
+}
+
+// SetStickyInvalidator drops the remaining sticky sessions of accounts once
+// their drain ends
+func (d *AccountDrainer) SetStickyInvalidator(inv StickyInvalidator) {
+	d.sticky = inv
+}
+
+// Start completes expired drains immediately and then periodically
+func (d *AccountDrainer) Start(ctx context.Context) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.running {
+		return nil
+	}
+
+	ctx, d.cancel = context.WithCancel(ctx)
+	d.running = true
+
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		d.CompleteExpired()
+
+		ticker := time.NewTicker(d.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				d.CompleteExpired()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	log.Info().Dur("interval", d.interval).Msg("Account drainer started")
+	return nil
+}
+
+// Stop stops the account drainer
+func (d *AccountDrainer) Stop() {
+	d.mu.Lock()
+	if !d.running {
+		d.mu.Unlock()
+		return
+	}
+	d.running = false
+	d.mu.Unlock()
+
+	d.cancel()
+	d.wg.Wait()
+}
+
+// CompleteExpired deactivates the accounts whose drain has ended and returns
+// their IDs
+func (d *AccountDrainer) CompleteExpired() []string {
+	ids, err := d.store.CompleteExpiredDrains(d.now())
+	if err != nil {
+		log.Error().Err(err).Msg("failed to complete account drains")
+		return nil
+	}
+	for _, id := range ids {
+		if d.sticky != nil {
+			d.sticky.InvalidateAccount(id)
+		}
+		log.Info().Str("account_id", id).Msg("account drained and deactivated")
+	}
+	return ids
+}
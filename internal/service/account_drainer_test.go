@@ -0,0 +1,71 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"ccproxy/internal/store"
+)
+
+func TestAccountDrainer_CompleteExpired(t *testing.T) {
+	db := newSpendTestStore(t)
+	for _, id := range []string{"acc-1", "acc-2"} {
+		if err := db.CreateAccount(&store.Account{
+			ID:          id,
+			Name:        id,
+			Type:        store.AccountTypeSessionKey,
+			Credentials: store.Credentials{SessionKey: "sk-ant-sid01-" + id},
+			CreatedAt:   time.Now(),
+			IsActive:    true,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	now := time.Now()
+	if _, err := db.StartAccountDrain("acc-1", now.Add(10*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.StartAccountDrain("acc-2", now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	d := NewAccountDrainer(db, time.Minute)
+	sticky := stickyRecorder{}
+	d.SetStickyInvalidator(sticky)
+	d.now = func() time.Time { return now.Add(5 * time.Minute) }
+	if ids := d.CompleteExpired(); len(ids) != 0 {
+		t.Errorf("completed before deadline: %v", ids)
+	}
+
+	d.now = func() time.Time { return now.Add(15 * time.Minute) }
+	if ids := d.CompleteExpired(); len(ids) != 1 || ids[0] != "acc-1" {
+		t.Fatalf("completed = %v", ids)
+	}
+	if sticky["acc-1"] != 1 || len(sticky) != 1 {
+		t.Errorf("sticky sessions invalidated for %v", sticky)
+	}
+	account, err := db.GetAccount("acc-1")
+	if err != nil || account.IsActive {
+		t.Errorf("acc-1 still active: %+v, %v", account, err)
+	}
+	if drain, _ := db.GetAccountDrain("acc-1"); drain != nil {
+		t.Errorf("acc-1 drain left behind: %+v", drain)
+	}
+
+	draining, err := db.GetDrainingAccounts()
+	if err != nil || len(draining) != 1 {
+		t.Errorf("draining = %v, %v", draining, err)
+	}
+	if account, _ := db.GetAccount("acc-2"); !account.IsActive {
+		t.Error("acc-2 deactivated before its drain ended")
+	}
+}
+
+// stickyRecorder counts sticky session invalidations per account
+type stickyRecorder map[string]int
+
+func (r stickyRecorder) InvalidateAccount(accountID string) int {
+	r[accountID]++
+	return 0
+}
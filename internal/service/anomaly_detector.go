@@ -0,0 +1,336 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"ccproxy/internal/notify"
+	"ccproxy/internal/store"
+)
+
+// Anomaly kinds flagged by the anomaly detector
+const (
+	AnomalyForbiddenSpike = "forbidden_spike" // Sudden rise in 401/403 responses
+	AnomalyErrorSpike     = "error_spike"     // Error rate well above the baseline
+	AnomalyUsageCliff     = "usage_cliff"     // Traffic dropped far below the baseline
+	AnomalyUsageSpike     = "usage_spike"     // Traffic far above the baseline
+)
+
+const (
+	// DefaultAnomalyCheckInterval is how often account usage is compared against its baseline
+	DefaultAnomalyCheckInterval = 15 * time.Minute
+	// anomalyBaselineHours is the history the last hour is compared against
+	anomalyBaselineHours = 7 * 24
+	// anomalyMinBaselineHours is the history an account needs before it is judged
+	anomalyMinBaselineHours = 24
+	// anomalyCooldown suppresses repeats of the same anomaly for an account
+	anomalyCooldown = 6 * time.Hour
+
+	// anomalyMinRequests is the traffic in the last hour needed to judge error rates and spikes
+	anomalyMinRequests = 10
+	// anomalyMinForbidden is the number of 401/403 responses needed for a forbidden spike
+	anomalyMinForbidden = 5
+	// anomalyMinBaselineRate is the mean hourly traffic needed to detect a usage cliff
+	anomalyMinBaselineRate = 10.0
+)
+
+// accountBaseline summarizes an account's hourly usage before the last hour
+type accountBaseline struct {
+	hours         int
+	meanRequests  float64
+	stdRequests   float64
+	errorRate     float64
+	forbiddenRate float64
+}
+
+// AnomalyDetector periodically compares each account's usage and error rates
+// in the last hour against its own baseline over the previous week, and
+// records and notifies anomalies such as 403 spikes and usage cliffs
+type AnomalyDetector struct {
+	store    *store.Store
+	notifier notify.Notifier
+	interval time.Duration
+	now      func() time.Time
+
+	mu      sync.Mutex
+	running bool
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+// NewAnomalyDetector creates an anomaly detector
+func NewAnomalyDetector(store *store.Store, interval time.Duration) *AnomalyDetector {
+	if interval <= 0 {
+		interval = DefaultAnomalyCheckInterval
+	}
+	return &AnomalyDetector{
+		store:    store,
+		notifier: notify.Nop{},
+		interval: interval,
+		now:      time.Now,
+	}
+}
+
+// SetNotifier sets the notifier used to report anomalies
+func (d *AnomalyDetector) SetNotifier(n notify.Notifier) {
+	if n == nil {
+		n = notify.Nop{}
+	}
+	d.notifier = n
+}
+
+// Start checks for anomalies immediately and then periodically
+func (d *AnomalyDetector) Start(ctx context.Context) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.running {
+		return nil
+	}
+
+	ctx, d.cancel = context.WithCancel(ctx)
+	d.running = true
+
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		d.Detect()
+
+		ticker := time.NewTicker(d.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				d.Detect()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	log.Info().Dur("interval", d.interval).Msg("Anomaly detector started")
+	return nil
+}
+
+// Stop stops the anomaly detector
+func (d *AnomalyDetector) Stop() {
+	d.mu.Lock()
+	if !d.running {
+		d.mu.Unlock()
+		return
+	}
+	d.running = false
+	d.mu.Unlock()
+
+	d.cancel()
+	d.wg.Wait()
+}
+
+// Detect compares the last hour of every account against its baseline and
+// returns the anomalies newly recorded
+func (d *AnomalyDetector) Detect() []*store.AccountAnomaly {
+	now := d.now()
+	usage, err := d.store.GetAccountHourlyUsage(now, anomalyBaselineHours+1)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to load hourly account usage")
+		return nil
+	}
+
+	accounts, err := d.store.ListAccountsWithStatus()
+	if err != nil {
+		log.Error().Err(err).Msg("failed to list accounts for anomaly detection")
+		return nil
+	}
+	byID := make(map[string]*store.Account, len(accounts))
+	for _, account := range accounts {
+		byID[account.ID] = account
+	}
+
+	hourly := make(map[string][]*store.AccountHourlyUsage)
+	var order []string
+	for _, u := range usage {
+		if _, ok := hourly[u.AccountID]; !ok {
+			order = append(order, u.AccountID)
+		}
+		hourly[u.AccountID] = append(hourly[u.AccountID], u)
+	}
+
+	var recorded []*store.AccountAnomaly
+	for _, accountID := range order {
+		account, ok := byID[accountID]
+		if !ok {
+			continue
+		}
+		current, baseline := splitBaseline(hourly[accountID])
+		if baseline.hours < anomalyMinBaselineHours {
+			continue
+		}
+		// A quiet account is expected while it cannot be scheduled, e.g. when
+		// disabled, rate limited or outside its scheduling window
+		for _, anomaly := range detectAnomalies(current, baseline, account.IsSchedulable()) {
+			anomaly.AccountID = accountID
+			anomaly.DetectedAt = now
+			if d.record(account, anomaly) {
+				recorded = append(recorded, anomaly)
+			}
+		}
+	}
+
+	if len(recorded) > 0 {
+		log.Info().Int("anomalies", len(recorded)).Msg("account usage anomalies detected")
+	}
+	return recorded
+}
+
+// record stores and notifies an anomaly unless the same kind was flagged for
+// the account within the cooldown
+func (d *AnomalyDetector) record(account *store.Account, anomaly *store.AccountAnomaly) bool {
+	last, err := d.store.GetLastAccountAnomaly(anomaly.AccountID, anomaly.Kind)
+	if err != nil {
+		log.Error().Err(err).Str("account_id", anomaly.AccountID).Msg("failed to load last anomaly")
+		return false
+	}
+	if last != nil && anomaly.DetectedAt.Sub(last.DetectedAt) < anomalyCooldown {
+		return false
+	}
+
+	anomaly.Message = fmt.Sprintf("Account %s: %s", account.Name, anomaly.Message)
+	if err := d.store.CreateAccountAnomaly(anomaly); err != nil {
+		log.Error().Err(err).Str("account_id", anomaly.AccountID).Msg("failed to record anomaly")
+		return false
+	}
+
+	log.Warn().
+		Str("account_id", anomaly.AccountID).
+		Str("kind", anomaly.Kind).
+		Float64("value", anomaly.Value).
+		Float64("baseline", anomaly.Baseline).
+		Msg("account usage anomaly")
+
+	d.notifier.Notify(notify.Event{
+		Type:      notify.EventAccountUsageAnomaly,
+		Severity:  notify.Severity(anomaly.Severity),
+		AccountID: anomaly.AccountID,
+		Message:   anomaly.Message,
+		Details: map[string]interface{}{
+			"kind":     anomaly.Kind,
+			"value":    anomaly.Value,
+			"baseline": anomaly.Baseline,
+		},
+		Time: anomaly.DetectedAt,
+	})
+	return true
+}
+
+// splitBaseline separates the last hour from the earlier hours and summarizes
+// the latter. The baseline starts at the account's first active hour, and
+// hours without requests in between count as zero traffic.
+func splitBaseline(hours []*store.AccountHourlyUsage) (current store.AccountHourlyUsage, baseline accountBaseline) {
+	var requests, failures, forbidden int
+	for _, h := range hours {
+		if h.HoursAgo == 0 {
+			current = *h
+			continue
+		}
+		if h.HoursAgo > baseline.hours {
+			baseline.hours = h.HoursAgo
+		}
+		requests += h.Requests
+		failures += h.Failures
+		forbidden += h.Forbidden
+	}
+	if baseline.hours == 0 {
+		return current, baseline
+	}
+
+	n := float64(baseline.hours)
+	baseline.meanRequests = float64(requests) / n
+	var variance float64
+	active := 0
+	for _, h := range hours {
+		if h.HoursAgo == 0 {
+			continue
+		}
+		diff := float64(h.Requests) - baseline.meanRequests
+		variance += diff * diff
+		active++
+	}
+	variance += float64(baseline.hours-active) * baseline.meanRequests * baseline.meanRequests
+	baseline.stdRequests = math.Sqrt(variance / n)
+
+	if requests > 0 {
+		baseline.errorRate = float64(failures) / float64(requests)
+		baseline.forbiddenRate = float64(forbidden) / float64(requests)
+	}
+	return current, baseline
+}
+
+// detectAnomalies applies the anomaly rules to the last hour. Usage cliffs are
+// only flagged for schedulable accounts, which are expected to take traffic.
+func detectAnomalies(current store.AccountHourlyUsage, baseline accountBaseline, schedulable bool) []*store.AccountAnomaly {
+	var anomalies []*store.AccountAnomaly
+
+	forbiddenSpike := false
+	if current.Forbidden >= anomalyMinForbidden {
+		rate := float64(current.Forbidden) / float64(current.Requests)
+		if rate >= math.Max(3*baseline.forbiddenRate, 0.2) {
+			forbiddenSpike = true
+			anomalies = append(anomalies, &store.AccountAnomaly{
+				Kind:     AnomalyForbiddenSpike,
+				Severity: string(notify.SeverityCritical),
+				Message: fmt.Sprintf("%d of %d requests in the last hour were rejected with 401/403 (%.0f%%, baseline %.1f%%)",
+					current.Forbidden, current.Requests, rate*100, baseline.forbiddenRate*100),
+				Value:    rate,
+				Baseline: baseline.forbiddenRate,
+			})
+		}
+	}
+
+	// A forbidden spike already explains the errors
+	if !forbiddenSpike && current.Requests >= anomalyMinRequests {
+		rate := float64(current.Failures) / float64(current.Requests)
+		if rate >= baseline.errorRate+0.25 && rate >= 2*baseline.errorRate {
+			anomalies = append(anomalies, &store.AccountAnomaly{
+				Kind:     AnomalyErrorSpike,
+				Severity: string(notify.SeverityWarning),
+				Message: fmt.Sprintf("error rate in the last hour is %.0f%% (baseline %.1f%%)",
+					rate*100, baseline.errorRate*100),
+				Value:    rate,
+				Baseline: baseline.errorRate,
+			})
+		}
+	}
+
+	requests := float64(current.Requests)
+	if schedulable && baseline.meanRequests >= anomalyMinBaselineRate && requests < 0.2*baseline.meanRequests {
+		anomalies = append(anomalies, &store.AccountAnomaly{
+			Kind:     AnomalyUsageCliff,
+			Severity: string(notify.SeverityWarning),
+			Message: fmt.Sprintf("%d requests in the last hour, down from a baseline of %.1f per hour",
+				current.Requests, baseline.meanRequests),
+			Value:    requests,
+			Baseline: baseline.meanRequests,
+		})
+	}
+
+	if current.Requests >= anomalyMinRequests &&
+		requests >= 3*baseline.meanRequests &&
+		requests >= baseline.meanRequests+4*baseline.stdRequests {
+		anomalies = append(anomalies, &store.AccountAnomaly{
+			Kind:     AnomalyUsageSpike,
+			Severity: string(notify.SeverityInfo),
+			Message: fmt.Sprintf("%d requests in the last hour, up from a baseline of %.1f per hour",
+				current.Requests, baseline.meanRequests),
+			Value:    requests,
+			Baseline: baseline.meanRequests,
+		})
+	}
+
+	return anomalies
+}
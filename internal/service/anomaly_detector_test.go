@@ -0,0 +1,131 @@
+package service
+
+import (
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	"ccproxy/internal/notify"
+	"ccproxy/internal/store"
+)
+
+// createHourlyLogs logs requests for an account in the hour hoursAgo before
+// now; the first failures of them fail with status
+func createHourlyLogs(t *testing.T, db *store.Store, accountID string, now time.Time, hoursAgo, requests, failures, status int) {
+	t.Helper()
+	for i := 0; i < requests; i++ {
+		l := &store.RequestLog{
+			ID:         fmt.Sprintf("%s-%d-%d", accountID, hoursAgo, i),
+			TokenID:    "tok",
+			AccountID:  sql.NullString{String: accountID, Valid: true},
+			UserName:   "user",
+			Mode:       "api",
+			Model:      "claude-sonnet-4",
+			RequestAt:  now.Add(-time.Duration(hoursAgo)*time.Hour - time.Duration(i+1)*time.Minute),
+			StatusCode: 200,
+			Success:    true,
+		}
+		if i < failures {
+			l.StatusCode = status
+			l.Success = false
+		}
+		if err := db.CreateRequestLog(l); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestAnomalyDetector_Detect(t *testing.T) {
+	db := newSpendTestStore(t)
+	now := time.Now()
+
+	for _, id := range []string{"steady", "cliff", "forbidden", "disabled"} {
+		createAPIKeyAccount(t, db, id, "sk-"+id, 0)
+		for h := 1; h <= 30; h++ {
+			createHourlyLogs(t, db, id, now, h, 12, 0, 0)
+		}
+	}
+	if err := db.UpdateAccountStatus("disabled", store.AccountStatusDisabled, ""); err != nil {
+		t.Fatal(err)
+	}
+	createHourlyLogs(t, db, "steady", now, 0, 11, 1, 500)
+	createHourlyLogs(t, db, "forbidden", now, 0, 12, 8, 403)
+
+	notifier := &recordingNotifier{}
+	detector := NewAnomalyDetector(db, time.Minute)
+	detector.SetNotifier(notifier)
+	detector.now = func() time.Time { return now }
+
+	got := map[string]string{}
+	for _, a := range detector.Detect() {
+		got[a.AccountID] = a.Kind
+	}
+	want := map[string]string{"cliff": AnomalyUsageCliff, "forbidden": AnomalyForbiddenSpike}
+	if len(got) != len(want) {
+		t.Fatalf("anomalies = %v, want %v", got, want)
+	}
+	for id, kind := range want {
+		if got[id] != kind {
+			t.Errorf("account %s anomaly = %q, want %q", id, got[id], kind)
+		}
+	}
+
+	if len(notifier.events) != 2 {
+		t.Fatalf("got %d events, want 2", len(notifier.events))
+	}
+	for _, e := range notifier.events {
+		if e.Type != notify.EventAccountUsageAnomaly {
+			t.Errorf("event type = %q", e.Type)
+		}
+		if e.AccountID == "forbidden" && e.Severity != notify.SeverityCritical {
+			t.Errorf("forbidden spike severity = %q", e.Severity)
+		}
+	}
+
+	// Repeats are suppressed within the cooldown
+	if again := detector.Detect(); len(again) != 0 {
+		t.Errorf("second run flagged %d anomalies, want 0", len(again))
+	}
+
+	listed, err := db.ListAccountAnomalies(now.Add(-time.Hour), "forbidden")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(listed) != 1 || listed[0].Kind != AnomalyForbiddenSpike || listed[0].Value < 0.6 {
+		t.Errorf("listed anomalies = %+v", listed)
+	}
+}
+
+func TestDetectAnomalies(t *testing.T) {
+	baseline := accountBaseline{hours: 48, meanRequests: 20, stdRequests: 3, errorRate: 0.02, forbiddenRate: 0.01}
+
+	tests := []struct {
+		name    string
+		current store.AccountHourlyUsage
+		want    []string
+	}{
+		{"normal hour", store.AccountHourlyUsage{Requests: 22, Failures: 1}, nil},
+		{"error spike", store.AccountHourlyUsage{Requests: 20, Failures: 8}, []string{AnomalyErrorSpike}},
+		{"forbidden spike", store.AccountHourlyUsage{Requests: 20, Failures: 9, Forbidden: 9}, []string{AnomalyForbiddenSpike}},
+		{"few forbidden", store.AccountHourlyUsage{Requests: 20, Failures: 2, Forbidden: 2}, nil},
+		{"usage cliff", store.AccountHourlyUsage{Requests: 2}, []string{AnomalyUsageCliff}},
+		{"usage spike", store.AccountHourlyUsage{Requests: 90}, []string{AnomalyUsageSpike}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var kinds []string
+			for _, a := range detectAnomalies(tt.current, baseline, true) {
+				kinds = append(kinds, a.Kind)
+			}
+			if fmt.Sprint(kinds) != fmt.Sprint(tt.want) {
+				t.Errorf("anomalies = %v, want %v", kinds, tt.want)
+			}
+		})
+	}
+
+	if got := detectAnomalies(store.AccountHourlyUsage{Requests: 2}, baseline, false); len(got) != 0 {
+		t.Errorf("unschedulable account flagged %d anomalies", len(got))
+	}
+}
@@ -0,0 +1,245 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"ccproxy/internal/store"
+)
+
+// APIKeyAccountRequest creates an account backed by an Anthropic API key
+type APIKeyAccountRequest struct {
+	Name             string  `json:"name" binding:"required"`
+	APIKey           string  `json:"api_key" binding:"required"`
+	MonthlyBudgetUSD float64 `json:"monthly_budget_usd"` // 0 means unlimited
+}
+
+// apiKeyMetadata is what the Anthropic API reveals about a key
+type apiKeyMetadata struct {
+	OrganizationID string
+	WorkspaceID    string
+	WorkspaceName  string
+	KeyName        string
+}
+
+// SetAdminAPIKey sets the Anthropic Admin API key used to look up the
+// workspace of api_key accounts. Without it only the organization is known.
+func (s *OAuthService) SetAdminAPIKey(key string) {
+	s.adminAPIKey = strings.TrimSpace(key)
+}
+
+// CreateAPIKeyAccount validates an API key, fetches its organization and
+// workspace metadata and stores it as an api_key account
+func (s *OAuthService) CreateAPIKeyAccount(req APIKeyAccountRequest) (*store.Account, *store.APIKeyAccountInfo, error) {
+	if req.MonthlyBudgetUSD < 0 {
+		return nil, nil, fmt.Errorf("monthly_budget_usd must not be negative")
+	}
+	apiKey := strings.TrimSpace(req.APIKey)
+
+	meta, err := s.fetchAPIKeyMetadata(apiKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	account := &store.Account{
+		ID:             generateAccountID(),
+		Name:           req.Name,
+		Type:           store.AccountTypeAPIKey,
+		OrganizationID: meta.OrganizationID,
+		Credentials: store.Credentials{
+			APIKey: apiKey,
+		},
+		CreatedAt:    now,
+		IsActive:     true,
+		Status:       store.AccountStatusActive,
+		HealthStatus: "healthy",
+	}
+	if err := s.store.CreateAccount(account); err != nil {
+		return nil, nil, fmt.Errorf("failed to save account: %w", err)
+	}
+
+	info := &store.APIKeyAccountInfo{
+		AccountID:         account.ID,
+		WorkspaceID:       meta.WorkspaceID,
+		WorkspaceName:     meta.WorkspaceName,
+		KeyName:           meta.KeyName,
+		MonthlyBudgetUSD:  req.MonthlyBudgetUSD,
+		MetadataFetchedAt: &now,
+	}
+	if err := s.store.UpsertAPIKeyAccountInfo(info); err != nil {
+		return nil, nil, fmt.Errorf("failed to save key metadata: %w", err)
+	}
+
+	log.Info().
+		Str("account_id", account.ID).
+		Str("organization_id", meta.OrganizationID).
+		Str("workspace_id", meta.WorkspaceID).
+		Float64("monthly_budget_usd", req.MonthlyBudgetUSD).
+		Msg("API key account created")
+	return account, info, nil
+}
+
+// RefreshAPIKeyMetadata re-fetches the organization and workspace of an api_key account
+func (s *OAuthService) RefreshAPIKeyMetadata(account *store.Account) (*store.APIKeyAccountInfo, error) {
+	if account.Type != store.AccountTypeAPIKey {
+		return nil, fmt.Errorf("account is not an API key account")
+	}
+
+	meta, err := s.fetchAPIKeyMetadata(account.Credentials.APIKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if meta.OrganizationID != "" && meta.OrganizationID != account.OrganizationID {
+		account.OrganizationID = meta.OrganizationID
+		if err := s.store.UpdateAccount(account); err != nil {
+			return nil, fmt.Errorf("failed to update account: %w", err)
+		}
+	}
+
+	info, err := s.store.GetAPIKeyAccountInfo(account.ID)
+	if err != nil {
+		return nil, err
+	}
+	if info == nil {
+		info = &store.APIKeyAccountInfo{AccountID: account.ID}
+	}
+	now := time.Now()
+	info.WorkspaceID = meta.WorkspaceID
+	info.WorkspaceName = meta.WorkspaceName
+	info.KeyName = meta.KeyName
+	info.MetadataFetchedAt = &now
+	if err := s.store.UpsertAPIKeyAccountInfo(info); err != nil {
+		return nil, fmt.Errorf("failed to save key metadata: %w", err)
+	}
+	return info, nil
+}
+
+// fetchAPIKeyMetadata validates the key with the free models endpoint, which
+// also reports the owning organization. The workspace is only visible via
+// the Admin API.
+func (s *OAuthService) fetchAPIKeyMetadata(apiKey string) (*apiKeyMetadata, error) {
+	client := createReqClient("")
+
+	resp, err := client.R().
+		SetHeader("anthropic-version", "2023-06-01").
+		SetHeader("x-api-key", apiKey).
+		Get(s.apiURL + "/v1/models")
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	if resp.StatusCode == 401 || resp.StatusCode == 403 {
+		return nil, fmt.Errorf("API key rejected (status %d)", resp.StatusCode)
+	}
+	if resp.StatusCode >= 300 && resp.StatusCode != 429 && resp.StatusCode != 529 {
+		return nil, fmt.Errorf("failed to validate API key: status %d: %s", resp.StatusCode, resp.String())
+	}
+
+	meta := &apiKeyMetadata{
+		OrganizationID: resp.Header.Get("anthropic-organization-id"),
+	}
+
+	if s.adminAPIKey != "" {
+		if err := s.lookupWorkspace(apiKey, meta); err != nil {
+			// Metadata is informational; the key itself was accepted
+			log.Warn().Err(err).Msg("failed to look up API key workspace")
+		}
+	}
+
+	return meta, nil
+}
+
+// adminAPIKeyEntry is an API key as listed by the Admin API
+type adminAPIKeyEntry struct {
+	ID             string  `json:"id"`
+	Name           string  `json:"name"`
+	WorkspaceID    *string `json:"workspace_id"`
+	PartialKeyHint string  `json:"partial_key_hint"`
+	Status         string  `json:"status"`
+}
+
+// lookupWorkspace finds the key in the organization's key list by its
+// partial hint and resolves the workspace name
+func (s *OAuthService) lookupWorkspace(apiKey string, meta *apiKeyMetadata) error {
+	client := createReqClient("")
+
+	afterID := ""
+	for page := 0; page < 20; page++ {
+		r := client.R().
+			SetHeader("anthropic-version", "2023-06-01").
+			SetHeader("x-api-key", s.adminAPIKey).
+			SetQueryParam("limit", "100")
+		if afterID != "" {
+			r.SetQueryParam("after_id", afterID)
+		}
+		resp, err := r.Get(s.apiURL + "/v1/organizations/api_keys")
+		if err != nil {
+			return fmt.Errorf("request failed: %w", err)
+		}
+		if resp.StatusCode != 200 {
+			return fmt.Errorf("list API keys: status %d: %s", resp.StatusCode, resp.String())
+		}
+
+		var list struct {
+			Data    []adminAPIKeyEntry `json:"data"`
+			HasMore bool               `json:"has_more"`
+			LastID  string             `json:"last_id"`
+		}
+		if err := json.Unmarshal(resp.Bytes(), &list); err != nil {
+			return fmt.Errorf("failed to parse API key list: %w", err)
+		}
+
+		for _, entry := range list.Data {
+			if !matchesKeyHint(apiKey, entry.PartialKeyHint) {
+				continue
+			}
+			meta.KeyName = entry.Name
+			if entry.WorkspaceID == nil || *entry.WorkspaceID == "" {
+				meta.WorkspaceName = "Default"
+				return nil
+			}
+			meta.WorkspaceID = *entry.WorkspaceID
+			meta.WorkspaceName = s.workspaceName(meta.WorkspaceID)
+			return nil
+		}
+
+		if !list.HasMore || list.LastID == "" {
+			break
+		}
+		afterID = list.LastID
+	}
+
+	return fmt.Errorf("API key not found in organization")
+}
+
+// workspaceName resolves a workspace ID to its name; errors yield an empty name
+func (s *OAuthService) workspaceName(workspaceID string) string {
+	resp, err := createReqClient("").R().
+		SetHeader("anthropic-version", "2023-06-01").
+		SetHeader("x-api-key", s.adminAPIKey).
+		Get(s.apiURL + "/v1/organizations/workspaces/" + workspaceID)
+	if err != nil || resp.StatusCode != 200 {
+		return ""
+	}
+
+	var workspace struct {
+		Name string `json:"name"`
+	}
+	_ = json.Unmarshal(resp.Bytes(), &workspace)
+	return workspace.Name
+}
+
+// matchesKeyHint reports whether a key matches an Admin API partial hint such
+// as "sk-ant-api03-R2D...igAA"
+func matchesKeyHint(apiKey, hint string) bool {
+	prefix, suffix, ok := strings.Cut(hint, "...")
+	if !ok || prefix == "" || suffix == "" {
+		return false
+	}
+	return strings.HasPrefix(apiKey, prefix) && strings.HasSuffix(apiKey, suffix)
+}
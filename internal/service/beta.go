@@ -0,0 +1,103 @@
+package service
+
+import (
+	"strings"
+
+	"ccproxy/internal/store"
+)
+
+// OAuthBetaFlag is the anthropic-beta flag OAuth access tokens require
+const OAuthBetaFlag = "oauth-2025-04-20"
+
+// BetaConfig holds the anthropic-beta header profiles sent upstream
+type BetaConfig struct {
+	Default  string            // OAuth requests for non-Haiku models
+	Haiku    string            // OAuth requests for Haiku models
+	APIKey   string            // API key requests when the client sent no header
+	OAuth    string            // Flag added to client headers on OAuth requests
+	Accounts map[string]string // Account ID -> header replacing the profile for that account
+}
+
+// DefaultBetaConfig returns the profiles Claude Code currently sends
+func DefaultBetaConfig() BetaConfig {
+	return BetaConfig{
+		Default: "claude-code-20250219,oauth-2025-04-20,interleaved-thinking-2025-05-14,fine-grained-tool-streaming-2025-05-14",
+		Haiku:   "oauth-2025-04-20,interleaved-thinking-2025-05-14",
+		APIKey:  "claude-code-20250219,interleaved-thinking-2025-05-14,fine-grained-tool-streaming-2025-05-14",
+		OAuth:   OAuthBetaFlag,
+	}
+}
+
+// BetaHeaders decides the anthropic-beta header of upstream requests. A nil
+// *BetaHeaders uses DefaultBetaConfig, so handlers work without one.
+type BetaHeaders struct {
+	cfg BetaConfig
+}
+
+// NewBetaHeaders creates a beta header policy
+func NewBetaHeaders(cfg BetaConfig) *BetaHeaders {
+	return &BetaHeaders{cfg: cfg}
+}
+
+func (b *BetaHeaders) config() BetaConfig {
+	if b == nil {
+		return DefaultBetaConfig()
+	}
+	return b.cfg
+}
+
+// Resolve returns the anthropic-beta header for a request to account for
+// model, given the client's own header. A nil account means a pooled API key.
+// Session key accounts get no header.
+//
+// Clients that send a header keep it; OAuth requests get the OAuth flag added
+// to it. Otherwise the account override applies, then the profile matching the
+// account type and model.
+func (b *BetaHeaders) Resolve(account *store.Account, model, clientHeader string) string {
+	cfg := b.config()
+
+	if account != nil && !account.IsOAuth() && account.Type != store.AccountTypeAPIKey {
+		return ""
+	}
+	oauth := account != nil && account.IsOAuth()
+
+	if clientHeader != "" {
+		if oauth {
+			return ensureBetaFlag(clientHeader, cfg.OAuth)
+		}
+		return clientHeader
+	}
+	if account != nil {
+		if override, ok := cfg.Accounts[account.ID]; ok {
+			return override
+		}
+	}
+	if !oauth {
+		return cfg.APIKey
+	}
+	if strings.Contains(strings.ToLower(model), "haiku") {
+		return cfg.Haiku
+	}
+	return cfg.Default
+}
+
+// ensureBetaFlag adds flag to header unless it is already present, right after
+// the claude-code flag if there is one and first otherwise
+func ensureBetaFlag(header, flag string) string {
+	if flag == "" {
+		return header
+	}
+	flags := strings.Split(header, ",")
+	for _, f := range flags {
+		if strings.TrimSpace(f) == flag {
+			return header
+		}
+	}
+	for i, f := range flags {
+		if strings.HasPrefix(strings.TrimSpace(f), "claude-code-") {
+			flags = append(flags[:i+1], append([]string{flag}, flags[i+1:]...)...)
+			return strings.Join(flags, ",")
+		}
+	}
+	return flag + "," + header
+}
@@ -0,0 +1,48 @@
+package service
+
+import (
+	"testing"
+
+	"ccproxy/internal/store"
+)
+
+func TestBetaHeaders_Resolve(t *testing.T) {
+	cfg := DefaultBetaConfig()
+	cfg.Accounts = map[string]string{"acc-override": "custom-2025-01-01"}
+	beta := NewBetaHeaders(cfg)
+
+	oauth := &store.Account{ID: "acc-oauth", Type: store.AccountTypeOAuth}
+	override := &store.Account{ID: "acc-override", Type: store.AccountTypeOAuth}
+	apiKey := &store.Account{ID: "acc-key", Type: store.AccountTypeAPIKey}
+	session := &store.Account{ID: "acc-session", Type: store.AccountTypeSessionKey}
+
+	tests := []struct {
+		name    string
+		account *store.Account
+		model   string
+		client  string
+		want    string
+	}{
+		{"oauth default", oauth, "claude-sonnet-4", "", cfg.Default},
+		{"oauth haiku", oauth, "claude-3-5-Haiku-latest", "", cfg.Haiku},
+		{"account override", override, "claude-3-5-haiku-latest", "", "custom-2025-01-01"},
+		{"pooled api key", nil, "claude-sonnet-4", "", cfg.APIKey},
+		{"api key account", apiKey, "", "", cfg.APIKey},
+		{"api key client header", nil, "", "context-1m-2025-08-07", "context-1m-2025-08-07"},
+		{"oauth flag after claude-code", oauth, "", "claude-code-20250219,context-1m-2025-08-07",
+			"claude-code-20250219,oauth-2025-04-20,context-1m-2025-08-07"},
+		{"oauth flag first", oauth, "", "context-1m-2025-08-07", "oauth-2025-04-20,context-1m-2025-08-07"},
+		{"oauth flag present", override, "", "oauth-2025-04-20,context-1m-2025-08-07", "oauth-2025-04-20,context-1m-2025-08-07"},
+		{"session key", session, "claude-sonnet-4", "", ""},
+	}
+	for _, tt := range tests {
+		if got := beta.Resolve(tt.account, tt.model, tt.client); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	var unset *BetaHeaders
+	if got := unset.Resolve(oauth, "claude-sonnet-4", ""); got != DefaultBetaConfig().Default {
+		t.Errorf("nil policy: got %q", got)
+	}
+}
@@ -0,0 +1,80 @@
+package service
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"ccproxy/internal/store"
+	"ccproxy/pkg/jwt"
+)
+
+// BootstrapToken is an API token declared in the configuration
+type BootstrapToken struct {
+	ID     string
+	Mode   string
+	Expiry time.Duration
+}
+
+// EnsureBootstrapTokens upserts the declared tokens into the store and
+// publishes their signed JWTs, as <dir>/<id>.token when dir is set or in the
+// log otherwise. A token keeps its creation time across restarts, so its
+// expiry and its JWT stay the same while the configuration does not change.
+// Tokens revoked through the admin API stay revoked.
+func EnsureBootstrapTokens(st *store.Store, jwtManager *jwt.Manager, tokens []BootstrapToken, dir string) error {
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return fmt.Errorf("failed to create bootstrap token directory: %w", err)
+		}
+	}
+	for _, t := range tokens {
+		createdAt := time.Now().UTC().Truncate(time.Second)
+		existing, err := st.GetToken(t.ID)
+		if err != nil {
+			return fmt.Errorf("failed to look up bootstrap token %s: %w", t.ID, err)
+		}
+		if existing != nil {
+			createdAt = existing.CreatedAt
+		}
+
+		tokenString, info, err := jwtManager.GenerateWithID(t.ID, t.ID, t.Mode, createdAt, createdAt.Add(t.Expiry))
+		if err != nil {
+			return fmt.Errorf("failed to sign bootstrap token %s: %w", t.ID, err)
+		}
+		if err := st.UpsertToken(&store.Token{
+			ID:        info.ID,
+			UserName:  info.UserName,
+			Mode:      info.Mode,
+			CreatedAt: info.IssuedAt,
+			ExpiresAt: info.ExpiresAt,
+		}); err != nil {
+			return fmt.Errorf("failed to store bootstrap token %s: %w", t.ID, err)
+		}
+
+		if existing != nil && existing.RevokedAt != nil {
+			log.Warn().Str("token_id", t.ID).Msg("bootstrap token was revoked and is not reissued")
+			continue
+		}
+		if !info.ExpiresAt.After(time.Now()) {
+			log.Warn().Str("token_id", t.ID).Time("expired_at", info.ExpiresAt).
+				Msg("bootstrap token has expired, raise its expiry to reissue it")
+			continue
+		}
+
+		if dir == "" {
+			log.Info().Str("token_id", t.ID).Str("mode", t.Mode).Time("expires_at", info.ExpiresAt).
+				Str("token", tokenString).Msg("bootstrap token ready")
+			continue
+		}
+		path := filepath.Join(dir, t.ID+".token")
+		if err := os.WriteFile(path, []byte(tokenString+"\n"), 0600); err != nil {
+			return fmt.Errorf("failed to write bootstrap token %s: %w", t.ID, err)
+		}
+		log.Info().Str("token_id", t.ID).Str("mode", t.Mode).Time("expires_at", info.ExpiresAt).
+			Str("path", path).Msg("bootstrap token written")
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"ccproxy/pkg/jwt"
+)
+
+func TestEnsureBootstrapTokens(t *testing.T) {
+	db := newSpendTestStore(t)
+	jwtManager := jwt.NewManager("bootstrap-test-secret-bootstrap-test", "ccproxy")
+	dir := t.TempDir()
+	tokens := []BootstrapToken{{ID: "ci", Mode: "api", Expiry: 24 * time.Hour}}
+
+	readToken := func() string {
+		t.Helper()
+		data, err := os.ReadFile(filepath.Join(dir, "ci.token"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.TrimSpace(string(data))
+	}
+
+	if err := EnsureBootstrapTokens(db, jwtManager, tokens, dir); err != nil {
+		t.Fatal(err)
+	}
+	first := readToken()
+	claims, err := jwtManager.Validate(first)
+	if err != nil || claims.ID != "ci" || claims.Mode != "api" {
+		t.Fatalf("token claims = %+v, %v", claims, err)
+	}
+	stored, err := db.ValidateToken("ci")
+	if err != nil || stored == nil || stored.Mode != "api" {
+		t.Fatalf("stored token = %+v, %v", stored, err)
+	}
+
+	// A restart reissues the same token and keeps usage counters
+	if err := db.IncrementTokenUsage("ci", 10); err != nil {
+		t.Fatal(err)
+	}
+	if err := EnsureBootstrapTokens(db, jwtManager, tokens, dir); err != nil {
+		t.Fatal(err)
+	}
+	if again := readToken(); again != first {
+		t.Error("restart changed the bootstrap token")
+	}
+	if stored, _ := db.GetToken("ci"); stored.TotalTokensUsed != 10 {
+		t.Errorf("usage was reset: %+v", stored)
+	}
+
+	// Mode and expiry changes are applied from the original creation time
+	tokens[0].Mode, tokens[0].Expiry = "both", 48*time.Hour
+	if err := EnsureBootstrapTokens(db, jwtManager, tokens, dir); err != nil {
+		t.Fatal(err)
+	}
+	updated, _ := db.GetToken("ci")
+	if updated.Mode != "both" || !updated.ExpiresAt.Equal(updated.CreatedAt.Add(48*time.Hour)) {
+		t.Errorf("updated token = %+v", updated)
+	}
+
+	// Revoked tokens stay revoked and are not written again
+	if err := db.RevokeToken("ci"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(dir, "ci.token")); err != nil {
+		t.Fatal(err)
+	}
+	if err := EnsureBootstrapTokens(db, jwtManager, tokens, dir); err != nil {
+		t.Fatal(err)
+	}
+	if stored, _ := db.ValidateToken("ci"); stored != nil {
+		t.Error("revoked bootstrap token was reactivated")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "ci.token")); !os.IsNotExist(err) {
+		t.Errorf("revoked token was written: %v", err)
+	}
+}
@@ -0,0 +1,481 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+
+	"ccproxy/internal/notify"
+	"ccproxy/internal/store"
+	"ccproxy/pkg/jwt"
+)
+
+const (
+	// DefaultCanaryInterval is how often canaries are sent
+	DefaultCanaryInterval = 5 * time.Minute
+	// canaryHistory is the number of results kept per mode
+	canaryHistory = 288
+	// canaryTokenName is the user name of the token canaries authenticate with
+	canaryTokenName = "ccproxy-canary"
+	// canaryTokenTTL is the lifetime of the canary token; it is replaced a day
+	// before it expires
+	canaryTokenTTL = 7 * 24 * time.Hour
+	// canaryPrompt is the known prompt sent by canaries
+	canaryPrompt = "Reply with the single word: pong"
+	// canaryMaxBody caps the response body kept for inspection
+	canaryMaxBody = 64 << 10
+)
+
+// CanaryConfig configures synthetic canary requests
+type CanaryConfig struct {
+	Interval         time.Duration
+	Modes            []string // Proxy modes checked, "api" and/or "web"
+	Model            string
+	Timeout          time.Duration
+	MaxLatency       time.Duration // Slower canaries count as failed, 0 = no limit
+	FailureThreshold int           // Consecutive failures before alerting
+}
+
+// CanaryResult is the outcome of one canary request
+type CanaryResult struct {
+	Mode       string    `json:"mode"`
+	At         time.Time `json:"at"`
+	OK         bool      `json:"ok"`
+	StatusCode int       `json:"status_code"`
+	LatencyMs  int64     `json:"latency_ms"`
+	RequestID  string    `json:"request_id,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// CanaryModeStats summarizes the recent canaries of one mode
+type CanaryModeStats struct {
+	Mode                string          `json:"mode"`
+	Alerting            bool            `json:"alerting"`
+	ConsecutiveFailures int             `json:"consecutive_failures"`
+	Checks              int             `json:"checks"`
+	Failures            int             `json:"failures"`
+	SuccessRate         float64         `json:"success_rate"`
+	LatencyP50Ms        int64           `json:"latency_p50_ms"`
+	LatencyP95Ms        int64           `json:"latency_p95_ms"`
+	Last                *CanaryResult   `json:"last,omitempty"`
+	Results             []*CanaryResult `json:"results"` // Newest first
+}
+
+type canaryMode struct {
+	results             []*CanaryResult // Oldest first
+	consecutiveFailures int
+	alerting            bool
+}
+
+// Canary periodically sends a tiny known prompt through the full proxy path
+// for each mode, and alerts when requests fail or are slower than allowed
+// for several checks in a row
+type Canary struct {
+	store      *store.Store
+	jwtManager *jwt.Manager
+	handler    http.Handler
+	notifier   notify.Notifier
+	cfg        CanaryConfig
+	now        func() time.Time
+
+	mu           sync.Mutex
+	token        string
+	tokenID      string
+	tokenExpires time.Time
+	modes        map[string]*canaryMode
+
+	runMu   sync.Mutex
+	running bool
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+// NewCanary creates a canary. Requests are sent to the handler set with
+// SetHandler, authenticated with a token it issues for itself.
+func NewCanary(store *store.Store, jwtManager *jwt.Manager, cfg CanaryConfig) *Canary {
+	if cfg.Interval <= 0 {
+		cfg.Interval = DefaultCanaryInterval
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = time.Minute
+	}
+	if cfg.FailureThreshold < 1 {
+		cfg.FailureThreshold = 1
+	}
+	modes := make(map[string]*canaryMode, len(cfg.Modes))
+	for _, mode := range cfg.Modes {
+		modes[mode] = &canaryMode{}
+	}
+	return &Canary{
+		store:      store,
+		jwtManager: jwtManager,
+		notifier:   notify.Nop{},
+		cfg:        cfg,
+		now:        time.Now,
+		modes:      modes,
+	}
+}
+
+// SetHandler sets the HTTP handler serving the proxy routes
+func (c *Canary) SetHandler(h http.Handler) {
+	c.handler = h
+}
+
+// SetNotifier sets the notifier used to report failing canaries
+func (c *Canary) SetNotifier(n notify.Notifier) {
+	if n == nil {
+		n = notify.Nop{}
+	}
+	c.notifier = n
+}
+
+// Start sends canaries immediately and then periodically
+func (c *Canary) Start(ctx context.Context) error {
+	c.runMu.Lock()
+	defer c.runMu.Unlock()
+
+	if c.running {
+		return nil
+	}
+	if c.handler == nil {
+		return fmt.Errorf("canary has no handler")
+	}
+
+	ctx, c.cancel = context.WithCancel(ctx)
+	c.running = true
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		c.Run(ctx)
+
+		ticker := time.NewTicker(c.cfg.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				c.Run(ctx)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	log.Info().Dur("interval", c.cfg.Interval).Strs("modes", c.cfg.Modes).Msg("Canary started")
+	return nil
+}
+
+// Stop stops sending canaries
+func (c *Canary) Stop() {
+	c.runMu.Lock()
+	if !c.running {
+		c.runMu.Unlock()
+		return
+	}
+	c.running = false
+	c.runMu.Unlock()
+
+	c.cancel()
+	c.wg.Wait()
+}
+
+// Run sends one canary per mode and returns the results
+func (c *Canary) Run(ctx context.Context) []*CanaryResult {
+	results := make([]*CanaryResult, 0, len(c.cfg.Modes))
+	for _, mode := range c.cfg.Modes {
+		if ctx.Err() != nil {
+			break
+		}
+		result := c.check(ctx, mode)
+		c.record(result)
+		results = append(results, result)
+	}
+	return results
+}
+
+// check sends a canary through the proxy in mode
+func (c *Canary) check(ctx context.Context, mode string) *CanaryResult {
+	result := &CanaryResult{Mode: mode, At: c.now()}
+
+	token, err := c.ensureToken()
+	if err != nil {
+		result.Error = "failed to issue canary token: " + err.Error()
+		return result
+	}
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"model":      c.cfg.Model,
+		"max_tokens": 16,
+		"messages":   []map[string]string{{"role": "user", "content": canaryPrompt}},
+	})
+
+	ctx, cancel := context.WithTimeout(ctx, c.cfg.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "/v1/messages", bytes.NewReader(body))
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	req.RemoteAddr = "127.0.0.1:0"
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("X-Proxy-Mode", mode)
+	req.Header.Set("User-Agent", "ccproxy-canary")
+	req.Header.Set("X-Request-ID", "canary-"+uuid.New().String())
+
+	resp := &canaryResponse{header: make(http.Header)}
+	start := time.Now()
+	c.handler.ServeHTTP(resp, req)
+	latency := time.Since(start)
+
+	result.StatusCode = resp.statusCode()
+	result.LatencyMs = latency.Milliseconds()
+	result.RequestID = resp.header.Get("X-Request-ID")
+
+	switch {
+	case result.StatusCode != http.StatusOK:
+		result.Error = fmt.Sprintf("status %d: %s", result.StatusCode, canaryErrorMessage(resp.body.Bytes()))
+		if result.StatusCode == http.StatusUnauthorized {
+			// The token was revoked or lost; issue a new one next time
+			c.resetToken()
+		}
+	case !canaryHasText(resp.body.Bytes()):
+		result.Error = "response has no text content"
+	case c.cfg.MaxLatency > 0 && latency > c.cfg.MaxLatency:
+		result.Error = fmt.Sprintf("latency %s exceeds %s", latency.Round(time.Millisecond), c.cfg.MaxLatency)
+	default:
+		result.OK = true
+	}
+	return result
+}
+
+// ensureToken returns the canary token, issuing a new one when there is none
+// or it expires within a day
+func (c *Canary) ensureToken() (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	if c.token != "" && c.tokenExpires.Sub(now) > 24*time.Hour {
+		return c.token, nil
+	}
+
+	tokenString, info, err := c.jwtManager.Generate(canaryTokenName, "both", canaryTokenTTL)
+	if err != nil {
+		return "", err
+	}
+	if err := c.store.CreateToken(&store.Token{
+		ID:        info.ID,
+		UserName:  info.UserName,
+		Mode:      "both",
+		CreatedAt: info.IssuedAt,
+		ExpiresAt: info.ExpiresAt,
+	}); err != nil {
+		return "", err
+	}
+	if c.tokenID != "" {
+		if err := c.store.RevokeToken(c.tokenID); err != nil {
+			log.Warn().Err(err).Str("token_id", c.tokenID).Msg("failed to revoke previous canary token")
+		}
+	}
+
+	c.token, c.tokenID, c.tokenExpires = tokenString, info.ID, info.ExpiresAt
+	return c.token, nil
+}
+
+func (c *Canary) resetToken() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.token = ""
+}
+
+// record keeps a result and alerts when a mode starts or stops failing
+func (c *Canary) record(result *CanaryResult) {
+	c.mu.Lock()
+	m, ok := c.modes[result.Mode]
+	if !ok {
+		m = &canaryMode{}
+		c.modes[result.Mode] = m
+	}
+	m.results = append(m.results, result)
+	if len(m.results) > canaryHistory {
+		m.results = m.results[len(m.results)-canaryHistory:]
+	}
+
+	var event *notify.Event
+	if result.OK {
+		if m.alerting {
+			event = &notify.Event{
+				Type:     notify.EventCanaryRecovered,
+				Severity: notify.SeverityInfo,
+				Message:  fmt.Sprintf("Canary for %s mode recovered after %d failures", result.Mode, m.consecutiveFailures),
+			}
+		}
+		m.consecutiveFailures = 0
+		m.alerting = false
+	} else {
+		m.consecutiveFailures++
+		if !m.alerting && m.consecutiveFailures >= c.cfg.FailureThreshold {
+			m.alerting = true
+			event = &notify.Event{
+				Type:     notify.EventCanaryFailed,
+				Severity: notify.SeverityCritical,
+				Message:  fmt.Sprintf("Canary for %s mode failed %d times in a row: %s", result.Mode, m.consecutiveFailures, result.Error),
+			}
+		}
+	}
+	failures := m.consecutiveFailures
+	c.mu.Unlock()
+
+	if !result.OK {
+		log.Warn().
+			Str("mode", result.Mode).
+			Int("status", result.StatusCode).
+			Int64("latency_ms", result.LatencyMs).
+			Int("consecutive_failures", failures).
+			Str("error", result.Error).
+			Msg("canary failed")
+	}
+	if event != nil {
+		event.Time = result.At
+		event.Details = map[string]interface{}{
+			"mode":        result.Mode,
+			"status_code": result.StatusCode,
+			"latency_ms":  result.LatencyMs,
+			"request_id":  result.RequestID,
+			"error":       result.Error,
+		}
+		c.notifier.Notify(*event)
+	}
+}
+
+// Stats summarizes the kept results of each mode
+func (c *Canary) Stats() []*CanaryModeStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := make([]*CanaryModeStats, 0, len(c.modes))
+	for mode, m := range c.modes {
+		s := &CanaryModeStats{
+			Mode:                mode,
+			Alerting:            m.alerting,
+			ConsecutiveFailures: m.consecutiveFailures,
+			Checks:              len(m.results),
+			Results:             make([]*CanaryResult, 0, len(m.results)),
+		}
+		var latencies []int64
+		for i := len(m.results) - 1; i >= 0; i-- {
+			r := m.results[i]
+			s.Results = append(s.Results, r)
+			if r.OK {
+				latencies = append(latencies, r.LatencyMs)
+			} else {
+				s.Failures++
+			}
+		}
+		if s.Checks > 0 {
+			s.Last = s.Results[0]
+			s.SuccessRate = float64(s.Checks-s.Failures) / float64(s.Checks) * 100
+		}
+		if len(latencies) > 0 {
+			sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+			s.LatencyP50Ms = latencies[(len(latencies)-1)*50/100]
+			s.LatencyP95Ms = latencies[(len(latencies)-1)*95/100]
+		}
+		stats = append(stats, s)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Mode < stats[j].Mode })
+	return stats
+}
+
+// canaryHasText reports whether an Anthropic messages response has text
+func canaryHasText(body []byte) bool {
+	var resp struct {
+		Content []struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		} `json:"content"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return false
+	}
+	for _, block := range resp.Content {
+		if block.Type == "text" && strings.TrimSpace(block.Text) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// canaryErrorMessage extracts the error message of a failed response
+func canaryErrorMessage(body []byte) string {
+	var resp struct {
+		Error json.RawMessage `json:"error"`
+	}
+	if err := json.Unmarshal(body, &resp); err == nil && len(resp.Error) > 0 {
+		var message string
+		if json.Unmarshal(resp.Error, &message) == nil {
+			return message
+		}
+		var detail struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(resp.Error, &detail) == nil && detail.Message != "" {
+			return detail.Message
+		}
+	}
+	text := strings.TrimSpace(string(body))
+	if len(text) > 200 {
+		text = text[:200]
+	}
+	return text
+}
+
+// canaryResponse captures the response to an in-process canary request
+type canaryResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (r *canaryResponse) Header() http.Header {
+	return r.header
+}
+
+func (r *canaryResponse) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+}
+
+func (r *canaryResponse) Write(b []byte) (int, error) {
+	r.WriteHeader(http.StatusOK)
+	if room := canaryMaxBody - r.body.Len(); room > 0 {
+		if len(b) > room {
+			r.body.Write(b[:room])
+		} else {
+			r.body.Write(b)
+		}
+	}
+	return len(b), nil
+}
+
+// Flush lets streaming handlers flush; the body is only read at the end
+func (r *canaryResponse) Flush() {}
+
+func (r *canaryResponse) statusCode() int {
+	if r.status == 0 {
+		return http.StatusOK
+	}
+	return r.status
+}
@@ -0,0 +1,132 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"ccproxy/internal/notify"
+	"ccproxy/pkg/jwt"
+)
+
+// fakeProxy answers canaries per mode, failing modes listed in failing
+type fakeProxy struct {
+	mu      sync.Mutex
+	failing map[string]bool
+	tokens  map[string]bool
+}
+
+func (p *fakeProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	p.tokens[strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")] = true
+	fail := p.failing[r.Header.Get("X-Proxy-Mode")]
+	p.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if fail {
+		w.WriteHeader(http.StatusBadGateway)
+		w.Write([]byte(`{"error":{"type":"api_error","message":"upstream unavailable"}}`))
+		return
+	}
+	w.Write([]byte(`{"content":[{"type":"text","text":"pong"}]}`))
+}
+
+func (p *fakeProxy) setFailing(mode string, fail bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.failing[mode] = fail
+}
+
+func TestCanary_AlertsAndRecovers(t *testing.T) {
+	db := newSpendTestStore(t)
+	proxy := &fakeProxy{failing: map[string]bool{}, tokens: map[string]bool{}}
+	notifier := &recordingNotifier{}
+
+	canary := NewCanary(db, jwt.NewManager("canary-test-secret-canary-test-secret", "ccproxy"), CanaryConfig{
+		Modes:            []string{"api", "web"},
+		Model:            "claude-3-5-haiku-20241022",
+		FailureThreshold: 2,
+	})
+	canary.SetHandler(proxy)
+	canary.SetNotifier(notifier)
+	ctx := context.Background()
+
+	results := canary.Run(ctx)
+	if len(results) != 2 || !results[0].OK || !results[1].OK {
+		t.Fatalf("results = %+v", results)
+	}
+
+	// The canary token is stored, so the real JWT middleware accepts it
+	for token := range proxy.tokens {
+		claims, err := canary.jwtManager.Validate(token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stored, err := db.GetToken(claims.ID)
+		if err != nil || stored == nil || stored.UserName != canaryTokenName {
+			t.Fatalf("stored token = %+v, %v", stored, err)
+		}
+	}
+
+	proxy.setFailing("web", true)
+	canary.Run(ctx)
+	if len(notifier.events) != 0 {
+		t.Fatalf("alerted after one failure: %+v", notifier.events)
+	}
+	canary.Run(ctx)
+	canary.Run(ctx)
+	if len(notifier.events) != 1 {
+		t.Fatalf("events = %+v, want one alert per failure streak", notifier.events)
+	}
+	alert := notifier.events[0]
+	if alert.Type != notify.EventCanaryFailed || alert.Severity != notify.SeverityCritical || alert.Details["mode"] != "web" {
+		t.Errorf("alert = %+v", alert)
+	}
+	if !strings.Contains(alert.Message, "upstream unavailable") {
+		t.Errorf("alert message %q lacks the upstream error", alert.Message)
+	}
+
+	proxy.setFailing("web", false)
+	canary.Run(ctx)
+	if len(notifier.events) != 2 || notifier.events[1].Type != notify.EventCanaryRecovered {
+		t.Fatalf("events = %+v, want recovery", notifier.events)
+	}
+
+	stats := canary.Stats()
+	if len(stats) != 2 || stats[0].Mode != "api" || stats[1].Mode != "web" {
+		t.Fatalf("stats = %+v", stats)
+	}
+	api, web := stats[0], stats[1]
+	if api.Checks != 5 || api.Failures != 0 || api.SuccessRate != 100 {
+		t.Errorf("api stats = %+v", api)
+	}
+	if web.Checks != 5 || web.Failures != 3 || web.Alerting || web.ConsecutiveFailures != 0 {
+		t.Errorf("web stats = %+v", web)
+	}
+	if web.Last == nil || !web.Last.OK || web.Results[1].StatusCode != http.StatusBadGateway {
+		t.Errorf("web results = %+v", web.Results)
+	}
+}
+
+func TestCanary_MaxLatency(t *testing.T) {
+	db := newSpendTestStore(t)
+	slow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		w.Write([]byte(`{"content":[{"type":"text","text":"pong"}]}`))
+	})
+
+	canary := NewCanary(db, jwt.NewManager("canary-test-secret-canary-test-secret", "ccproxy"), CanaryConfig{
+		Modes:      []string{"api"},
+		Model:      "claude-3-5-haiku-20241022",
+		MaxLatency: time.Millisecond,
+	})
+	canary.SetHandler(slow)
+
+	results := canary.Run(context.Background())
+	if len(results) != 1 || results[0].OK || !strings.Contains(results[0].Error, "latency") {
+		t.Errorf("results = %+v, want a latency failure", results)
+	}
+}
@@ -0,0 +1,409 @@
+package service
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"ccproxy/internal/store"
+)
+
+// Forecast methods
+const (
+	ForecastLinear      = "linear"       // Least-squares trend of daily peaks
+	ForecastHoltWinters = "holt_winters" // Additive Holt-Winters on hourly peaks with a daily season
+)
+
+const (
+	// capacitySeason is the Holt-Winters season length in hours
+	capacitySeason = 24
+	// Holt-Winters smoothing factors for level, trend and season
+	hwAlpha = 0.3
+	hwBeta  = 0.05
+	hwGamma = 0.3
+)
+
+// CapacityOptions controls a capacity report
+type CapacityOptions struct {
+	Now          time.Time
+	Hours        int    // History covered, ending with the current hour
+	HorizonHours int    // How far the forecast looks ahead
+	Method       string // ForecastLinear, ForecastHoltWinters or "" to pick by history length
+	AccountMax   int    // Concurrency slots per account
+	Accounts     int    // Schedulable accounts in the pool now
+}
+
+// WaitPercentiles summarizes slot wait times in milliseconds
+type WaitPercentiles struct {
+	Samples int   `json:"samples"`
+	P50     int64 `json:"p50"`
+	P95     int64 `json:"p95"`
+	P99     int64 `json:"p99"`
+	Max     int64 `json:"max"`
+}
+
+// CapacityHour is the load of the pool during one hour
+type CapacityHour struct {
+	Hour              time.Time       `json:"hour"`
+	Requests          int             `json:"requests"`
+	PeakConcurrency   int             `json:"peak_concurrency"`
+	ActiveAccounts    int             `json:"active_accounts"`
+	SaturatedAccounts int             `json:"saturated_accounts"` // Accounts that used all their slots
+	QueueWaitMs       WaitPercentiles `json:"queue_wait_ms"`
+}
+
+// ForecastPoint is the predicted peak concurrency of one day
+type ForecastPoint struct {
+	Day             time.Time `json:"day"`
+	PeakConcurrency float64   `json:"peak_concurrency"`
+}
+
+// CapacityForecast predicts when peak concurrency outgrows the pool
+type CapacityForecast struct {
+	Method       string          `json:"method,omitempty"`
+	Capacity     int             `json:"capacity"`
+	Insufficient bool            `json:"insufficient"` // Peaks in the last day already reached capacity
+	ExhaustedAt  *time.Time      `json:"exhausted_at,omitempty"`
+	Points       []ForecastPoint `json:"points"`
+	Note         string          `json:"note,omitempty"`
+}
+
+// CapacitySummary aggregates the whole history
+type CapacitySummary struct {
+	Requests        int             `json:"requests"`
+	PeakConcurrency int             `json:"peak_concurrency"`
+	PeakUtilization float64         `json:"peak_utilization"` // Peak concurrency / current capacity
+	SaturatedHours  int             `json:"saturated_hours"`  // Hours in which any account used all its slots
+	QueueWaitMs     WaitPercentiles `json:"queue_wait_ms"`
+}
+
+// CapacityReport describes historical pool load and forecasts when the
+// current pool will be insufficient. It holds aggregates only, no user,
+// token or account identifiers.
+type CapacityReport struct {
+	GeneratedAt time.Time        `json:"generated_at"`
+	Hours       int              `json:"hours"`
+	Accounts    int              `json:"accounts"`
+	AccountMax  int              `json:"account_max"`
+	Capacity    int              `json:"capacity"` // Accounts * AccountMax
+	Summary     CapacitySummary  `json:"summary"`
+	History     []CapacityHour   `json:"history"`
+	Forecast    CapacityForecast `json:"forecast"`
+}
+
+// BuildCapacityReport aggregates request timings into hourly load and
+// forecasts peak concurrency. Timings may start before the history window;
+// they only count toward the concurrency of the hours they overlap.
+func BuildCapacityReport(timings []*store.RequestTiming, opts CapacityOptions) *CapacityReport {
+	if opts.Hours <= 0 {
+		opts.Hours = 24
+	}
+	end := opts.Now.UTC().Truncate(time.Hour).Add(time.Hour)
+	start := end.Add(-time.Duration(opts.Hours) * time.Hour)
+	capacity := opts.Accounts * opts.AccountMax
+
+	report := &CapacityReport{
+		GeneratedAt: opts.Now,
+		Hours:       opts.Hours,
+		Accounts:    opts.Accounts,
+		AccountMax:  opts.AccountMax,
+		Capacity:    capacity,
+		History:     make([]CapacityHour, opts.Hours),
+	}
+	for i := range report.History {
+		report.History[i].Hour = start.Add(time.Duration(i) * time.Hour)
+	}
+
+	waits := make([][]int64, opts.Hours)
+	var allWaits []int64
+	active := make([]map[string]bool, opts.Hours)
+	byAccount := make(map[string][]*store.RequestTiming)
+	for _, t := range timings {
+		if t.AccountID != "" {
+			byAccount[t.AccountID] = append(byAccount[t.AccountID], t)
+		}
+		i := hourIndex(t.RequestAt, start, opts.Hours)
+		if i < 0 {
+			continue
+		}
+		report.History[i].Requests++
+		report.Summary.Requests++
+		if t.QueueWaitMs.Valid {
+			waits[i] = append(waits[i], t.QueueWaitMs.Int64)
+			allWaits = append(allWaits, t.QueueWaitMs.Int64)
+		}
+		if t.AccountID != "" {
+			if active[i] == nil {
+				active[i] = make(map[string]bool)
+			}
+			active[i][t.AccountID] = true
+		}
+	}
+
+	for i, peak := range hourlyPeaks(timings, start, opts.Hours) {
+		h := &report.History[i]
+		h.PeakConcurrency = peak
+		h.ActiveAccounts = len(active[i])
+		h.QueueWaitMs = waitPercentiles(waits[i])
+		if peak > report.Summary.PeakConcurrency {
+			report.Summary.PeakConcurrency = peak
+		}
+	}
+	if opts.AccountMax > 0 {
+		for _, accountTimings := range byAccount {
+			for i, peak := range hourlyPeaks(accountTimings, start, opts.Hours) {
+				if peak >= opts.AccountMax {
+					report.History[i].SaturatedAccounts++
+				}
+			}
+		}
+	}
+	for _, h := range report.History {
+		if h.SaturatedAccounts > 0 {
+			report.Summary.SaturatedHours++
+		}
+	}
+	if capacity > 0 {
+		report.Summary.PeakUtilization = float64(report.Summary.PeakConcurrency) / float64(capacity)
+	}
+	report.Summary.QueueWaitMs = waitPercentiles(allWaits)
+
+	peaks := make([]float64, len(report.History))
+	for i, h := range report.History {
+		peaks[i] = float64(h.PeakConcurrency)
+	}
+	report.Forecast = forecastCapacity(peaks, end, capacity, opts)
+	return report
+}
+
+// hourIndex returns the history hour t falls into, or -1 outside the window
+func hourIndex(t, start time.Time, hours int) int {
+	if t.Before(start) {
+		return -1
+	}
+	i := int(t.Sub(start) / time.Hour)
+	if i >= hours {
+		return -1
+	}
+	return i
+}
+
+// hourlyPeaks returns the highest number of requests in flight at once
+// during each hour. A request is in flight from its start for its duration
+// (at least a millisecond); one ending as another starts does not overlap it.
+func hourlyPeaks(timings []*store.RequestTiming, start time.Time, hours int) []int {
+	type event struct {
+		at    time.Time
+		delta int
+	}
+	events := make([]event, 0, 2*len(timings))
+	for _, t := range timings {
+		d := time.Duration(t.DurationMs) * time.Millisecond
+		if d < time.Millisecond {
+			d = time.Millisecond
+		}
+		events = append(events, event{t.RequestAt, 1}, event{t.RequestAt.Add(d), -1})
+	}
+	sort.Slice(events, func(i, j int) bool {
+		if !events[i].at.Equal(events[j].at) {
+			return events[i].at.Before(events[j].at)
+		}
+		return events[i].delta < events[j].delta
+	})
+
+	peaks := make([]int, hours)
+	level := 0
+	// hour is the last hour the current level has been applied to
+	hour := -1
+	carry := func(until int) {
+		for ; hour < until; hour++ {
+			if hour+1 >= 0 && hour+1 < hours && level > peaks[hour+1] {
+				peaks[hour+1] = level
+			}
+		}
+	}
+	for _, e := range events {
+		i := int(math.Floor(float64(e.at.Sub(start)) / float64(time.Hour)))
+		if i >= hours {
+			break
+		}
+		carry(i)
+		level += e.delta
+		if i >= 0 && level > peaks[i] {
+			peaks[i] = level
+		}
+	}
+	carry(hours - 1)
+	return peaks
+}
+
+// waitPercentiles computes nearest-rank percentiles of wait samples
+func waitPercentiles(samples []int64) WaitPercentiles {
+	if len(samples) == 0 {
+		return WaitPercentiles{}
+	}
+	sorted := append([]int64(nil), samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	rank := func(p float64) int64 {
+		i := int(math.Ceil(p*float64(len(sorted)))) - 1
+		if i < 0 {
+			i = 0
+		}
+		return sorted[i]
+	}
+	return WaitPercentiles{
+		Samples: len(sorted),
+		P50:     rank(0.50),
+		P95:     rank(0.95),
+		P99:     rank(0.99),
+		Max:     sorted[len(sorted)-1],
+	}
+}
+
+// forecastCapacity predicts hourly peaks after end and reports the first
+// hour they reach capacity
+func forecastCapacity(peaks []float64, end time.Time, capacity int, opts CapacityOptions) CapacityForecast {
+	forecast := CapacityForecast{Capacity: capacity, Points: []ForecastPoint{}}
+	horizon := opts.HorizonHours
+	if horizon <= 0 {
+		horizon = 30 * 24
+	}
+
+	recent := peaks
+	if len(recent) > capacitySeason {
+		recent = recent[len(recent)-capacitySeason:]
+	}
+	for _, p := range recent {
+		if capacity <= 0 || p >= float64(capacity) {
+			forecast.Insufficient = true
+		}
+	}
+	if forecast.Insufficient {
+		at := end.Add(-time.Hour)
+		forecast.ExhaustedAt = &at
+	}
+
+	method := opts.Method
+	if method == "" {
+		method = ForecastLinear
+		if len(peaks) >= 2*capacitySeason {
+			method = ForecastHoltWinters
+		}
+	}
+
+	var predicted []float64
+	switch method {
+	case ForecastHoltWinters:
+		if len(peaks) < 2*capacitySeason {
+			forecast.Note = "holt_winters needs at least 48 hours of history"
+			return forecast
+		}
+		predicted = holtWinters(peaks, capacitySeason, horizon)
+	case ForecastLinear:
+		if len(peaks) < 2 {
+			forecast.Note = "linear needs at least 2 hours of history"
+			return forecast
+		}
+		predicted = linearPeaks(peaks, horizon)
+	default:
+		forecast.Note = "unknown method " + method
+		return forecast
+	}
+	forecast.Method = method
+
+	for i, p := range predicted {
+		at := end.Add(time.Duration(i) * time.Hour)
+		if forecast.ExhaustedAt == nil && capacity > 0 && p >= float64(capacity) {
+			forecast.ExhaustedAt = &at
+		}
+		day := i / 24
+		if day == len(forecast.Points) {
+			forecast.Points = append(forecast.Points, ForecastPoint{Day: at})
+		}
+		if p > forecast.Points[day].PeakConcurrency {
+			forecast.Points[day].PeakConcurrency = p
+		}
+	}
+	for i := range forecast.Points {
+		forecast.Points[i].PeakConcurrency = math.Round(forecast.Points[i].PeakConcurrency*100) / 100
+	}
+	return forecast
+}
+
+// linearPeaks extrapolates the trend of peaks for horizon hours. With at
+// least two full days of history the trend is fitted to daily peaks, so the
+// forecast follows the busiest hours rather than the average.
+func linearPeaks(peaks []float64, horizon int) []float64 {
+	xs, ys := make([]float64, 0, len(peaks)), make([]float64, 0, len(peaks))
+	if days := len(peaks) / 24; days >= 2 {
+		// Days are counted back from the newest hour; x is the day's last hour
+		for d := 0; d < days; d++ {
+			last := len(peaks) - 1 - d*24
+			peak := 0.0
+			for _, p := range peaks[last-23 : last+1] {
+				peak = math.Max(peak, p)
+			}
+			xs = append(xs, float64(last))
+			ys = append(ys, peak)
+		}
+	} else {
+		for i, p := range peaks {
+			xs = append(xs, float64(i))
+			ys = append(ys, p)
+		}
+	}
+
+	var sumX, sumY, sumXY, sumXX float64
+	n := float64(len(xs))
+	for i := range xs {
+		sumX += xs[i]
+		sumY += ys[i]
+		sumXY += xs[i] * ys[i]
+		sumXX += xs[i] * xs[i]
+	}
+	slope := 0.0
+	if denom := n*sumXX - sumX*sumX; denom != 0 {
+		slope = (n*sumXY - sumX*sumY) / denom
+	}
+	intercept := (sumY - slope*sumX) / n
+
+	predicted := make([]float64, horizon)
+	for h := range predicted {
+		x := float64(len(peaks) + h)
+		predicted[h] = math.Max(0, intercept+slope*x)
+	}
+	return predicted
+}
+
+// holtWinters fits additive Holt-Winters with the given season length and
+// returns the next horizon values
+func holtWinters(series []float64, season, horizon int) []float64 {
+	mean := func(values []float64) float64 {
+		sum := 0.0
+		for _, v := range values {
+			sum += v
+		}
+		return sum / float64(len(values))
+	}
+	level := mean(series[:season])
+	trend := (mean(series[season:2*season]) - level) / float64(season)
+	seasonal := make([]float64, season)
+	for i := range seasonal {
+		seasonal[i] = series[i] - level
+	}
+
+	for t, y := range series {
+		s := seasonal[t%season]
+		prevLevel := level
+		level = hwAlpha*(y-s) + (1-hwAlpha)*(level+trend)
+		trend = hwBeta*(level-prevLevel) + (1-hwBeta)*trend
+		seasonal[t%season] = hwGamma*(y-level) + (1-hwGamma)*s
+	}
+
+	predicted := make([]float64, horizon)
+	for h := range predicted {
+		steps := float64(h + 1)
+		predicted[h] = math.Max(0, level+steps*trend+seasonal[(len(series)+h)%season])
+	}
+	return predicted
+}
@@ -0,0 +1,132 @@
+package service
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"ccproxy/internal/store"
+)
+
+func timing(account string, at time.Time, duration time.Duration, waitMs int64) *store.RequestTiming {
+	return &store.RequestTiming{
+		AccountID:   account,
+		RequestAt:   at,
+		DurationMs:  duration.Milliseconds(),
+		QueueWaitMs: sql.NullInt64{Int64: waitMs, Valid: true},
+	}
+}
+
+func TestBuildCapacityReport_History(t *testing.T) {
+	now := time.Date(2026, 3, 2, 10, 30, 0, 0, time.UTC)
+	hour9 := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+
+	timings := []*store.RequestTiming{
+		// Started before the window, still in flight during 08:00
+		timing("acc-a", hour9.Add(-2*time.Hour+50*time.Minute), 20*time.Minute, 0),
+		// Three overlapping requests on acc-a in 09:00
+		timing("acc-a", hour9.Add(10*time.Minute), 10*time.Minute, 0),
+		timing("acc-a", hour9.Add(12*time.Minute), 10*time.Minute, 100),
+		timing("acc-a", hour9.Add(14*time.Minute), 10*time.Minute, 900),
+		// Back to back on acc-b, never overlapping each other
+		timing("acc-b", hour9.Add(30*time.Minute), time.Minute, 0),
+		timing("acc-b", hour9.Add(31*time.Minute), time.Minute, 0),
+		// Spans 09:00 and 10:00
+		timing("acc-b", hour9.Add(59*time.Minute), 5*time.Minute, 0),
+	}
+
+	report := BuildCapacityReport(timings, CapacityOptions{
+		Now: now, Hours: 3, AccountMax: 3, Accounts: 2, Method: ForecastLinear,
+	})
+	if report.Capacity != 6 || len(report.History) != 3 {
+		t.Fatalf("capacity %d, %d hours", report.Capacity, len(report.History))
+	}
+
+	h8, h9, h10 := report.History[0], report.History[1], report.History[2]
+	if !h8.Hour.Equal(hour9.Add(-time.Hour)) {
+		t.Errorf("first hour = %s", h8.Hour)
+	}
+	if h8.Requests != 0 || h8.PeakConcurrency != 1 {
+		t.Errorf("08:00 = %+v, want carried-over concurrency 1", h8)
+	}
+	if h9.Requests != 6 || h9.PeakConcurrency != 3 || h9.ActiveAccounts != 2 || h9.SaturatedAccounts != 1 {
+		t.Errorf("09:00 = %+v", h9)
+	}
+	if w := h9.QueueWaitMs; w.Samples != 6 || w.P50 != 0 || w.P95 != 900 || w.Max != 900 {
+		t.Errorf("09:00 waits = %+v", w)
+	}
+	if h10.Requests != 0 || h10.PeakConcurrency != 1 {
+		t.Errorf("10:00 = %+v", h10)
+	}
+
+	if report.Summary.PeakConcurrency != 3 || report.Summary.SaturatedHours != 1 || report.Summary.PeakUtilization != 0.5 {
+		t.Errorf("summary = %+v", report.Summary)
+	}
+	if report.Forecast.Insufficient {
+		t.Error("pool reported insufficient below capacity")
+	}
+}
+
+// growingLoad produces one request per concurrency unit each hour, following
+// a daily cycle with busier office hours on top of load growing by one per day
+func growingLoad(start time.Time, days int) []*store.RequestTiming {
+	var timings []*store.RequestTiming
+	for h := 0; h < days*24; h++ {
+		at := start.Add(time.Duration(h) * time.Hour)
+		level := 1 + h/24
+		if at.Hour() >= 9 && at.Hour() <= 17 {
+			level += 3
+		}
+		for i := 0; i < level; i++ {
+			timings = append(timings, timing("acc", at.Add(time.Minute), 30*time.Minute, 0))
+		}
+	}
+	return timings
+}
+
+func TestBuildCapacityReport_Forecast(t *testing.T) {
+	start := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	timings := growingLoad(start, 7)
+	now := start.Add(7*24*time.Hour - time.Minute)
+
+	for _, method := range []string{ForecastLinear, ForecastHoltWinters} {
+		report := BuildCapacityReport(timings, CapacityOptions{
+			Now: now, Hours: 7 * 24, HorizonHours: 14 * 24, Method: method, AccountMax: 6, Accounts: 2,
+		})
+		f := report.Forecast
+		if f.Method != method || f.Insufficient || f.ExhaustedAt == nil {
+			t.Fatalf("%s: forecast = %+v", method, f)
+		}
+		// Peaks grow by one a day from 10: capacity 12 is reached around day 2
+		days := f.ExhaustedAt.Sub(now).Hours() / 24
+		if days < 1 || days > 5 {
+			t.Errorf("%s: exhausted in %.1f days", method, days)
+		}
+		if len(f.Points) != 14 || f.Points[13].PeakConcurrency <= f.Points[0].PeakConcurrency {
+			t.Errorf("%s: points = %+v", method, f.Points)
+		}
+	}
+
+	// Auto picks Holt-Winters with two days of history
+	report := BuildCapacityReport(timings, CapacityOptions{Now: now, Hours: 48, AccountMax: 6, Accounts: 2})
+	if report.Forecast.Method != ForecastHoltWinters {
+		t.Errorf("auto method = %q", report.Forecast.Method)
+	}
+
+	// Already at capacity
+	report = BuildCapacityReport(timings, CapacityOptions{Now: now, Hours: 48, AccountMax: 5, Accounts: 2})
+	if !report.Forecast.Insufficient || report.Forecast.ExhaustedAt == nil {
+		t.Errorf("forecast = %+v, want insufficient", report.Forecast)
+	}
+}
+
+func TestBuildCapacityReport_ShortHistory(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	report := BuildCapacityReport(nil, CapacityOptions{Now: now, Hours: 12, Method: ForecastHoltWinters, AccountMax: 5, Accounts: 1})
+	if report.Forecast.Method != "" || report.Forecast.Note == "" {
+		t.Errorf("forecast = %+v, want a note about missing history", report.Forecast)
+	}
+	if report.Forecast.Insufficient {
+		t.Error("idle pool reported insufficient")
+	}
+}
@@ -0,0 +1,192 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync/atomic"
+	"unicode/utf8"
+
+	"ccproxy/internal/store"
+)
+
+// ConversationCapPolicy bounds the stored size of a captured conversation.
+// Oversized contents keep their head and tail around a truncation marker.
+type ConversationCapPolicy struct {
+	MaxBytes    int     // Budget for system prompt, messages, prompt and completion; 0 disables
+	HeadPercent float64 // Share (0-100) of a truncated field kept from its start
+}
+
+// DefaultConversationCapPolicy returns a policy that stores conversations whole
+func DefaultConversationCapPolicy() ConversationCapPolicy {
+	return ConversationCapPolicy{HeadPercent: 50}
+}
+
+// ConversationCapStats contains conversation storage cap counters
+type ConversationCapStats struct {
+	MaxBytes       int   `json:"max_bytes"`
+	Truncated      int64 `json:"truncated"`
+	TruncatedBytes int64 `json:"truncated_bytes"`
+}
+
+// conversationCap applies a ConversationCapPolicy and tracks its truncations
+type conversationCap struct {
+	policy ConversationCapPolicy
+
+	truncated      int64
+	truncatedBytes int64
+}
+
+func newConversationCap(policy ConversationCapPolicy) *conversationCap {
+	if policy.HeadPercent < 0 {
+		policy.HeadPercent = 0
+	}
+	if policy.HeadPercent > 100 {
+		policy.HeadPercent = 100
+	}
+	return &conversationCap{policy: policy}
+}
+
+// apply truncates conv in place when it exceeds the budget. Each field gets
+// an equal share of the budget, and shares unused by small fields go to the
+// larger ones.
+func (c *conversationCap) apply(conv *store.ConversationContent) {
+	if conv == nil || c.policy.MaxBytes <= 0 {
+		return
+	}
+
+	fields := []*string{&conv.SystemPrompt.String, &conv.MessagesJSON, &conv.Prompt, &conv.Completion}
+	sizes := make([]int, len(fields))
+	total := 0
+	for i, f := range fields {
+		sizes[i] = len(*f)
+		total += sizes[i]
+	}
+	if total <= c.policy.MaxBytes {
+		return
+	}
+
+	limits := fairShares(sizes, c.policy.MaxBytes)
+	for i, f := range fields {
+		if sizes[i] <= limits[i] {
+			continue
+		}
+		if f == &conv.MessagesJSON {
+			*f = truncateMessagesJSON(*f, limits[i], c.policy.HeadPercent)
+		} else {
+			*f = truncateText(*f, limits[i], c.policy.HeadPercent)
+		}
+	}
+
+	removed := 0
+	for i, f := range fields {
+		removed += sizes[i] - len(*f)
+	}
+	conv.TruncatedBytes = int64(removed)
+	atomic.AddInt64(&c.truncated, 1)
+	atomic.AddInt64(&c.truncatedBytes, int64(removed))
+}
+
+func (c *conversationCap) stats() ConversationCapStats {
+	return ConversationCapStats{
+		MaxBytes:       c.policy.MaxBytes,
+		Truncated:      atomic.LoadInt64(&c.truncated),
+		TruncatedBytes: atomic.LoadInt64(&c.truncatedBytes),
+	}
+}
+
+// fairShares splits budget across sizes: fields below an equal share keep
+// their size and the remainder is split among the others
+func fairShares(sizes []int, budget int) []int {
+	order := make([]int, len(sizes))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(a, b int) bool { return sizes[order[a]] < sizes[order[b]] })
+
+	limits := make([]int, len(sizes))
+	for n, i := range order {
+		share := budget / (len(order) - n)
+		if sizes[i] < share {
+			share = sizes[i]
+		}
+		limits[i] = share
+		budget -= share
+	}
+	return limits
+}
+
+// truncationMarker replaces the middle of a truncated text
+func truncationMarker(removed int) string {
+	return fmt.Sprintf("\n\n[... %d bytes truncated by ccproxy ...]\n\n", removed)
+}
+
+// truncateText keeps the head and tail of s within limit bytes, splitting on
+// UTF-8 boundaries
+func truncateText(s string, limit int, headPercent float64) string {
+	if len(s) <= limit {
+		return s
+	}
+	keep := limit - len(truncationMarker(len(s)))
+	if keep < 0 {
+		keep = 0
+	}
+	head := int(float64(keep) * headPercent / 100)
+	tail := keep - head
+
+	for head > 0 && !utf8.RuneStart(s[head]) {
+		head--
+	}
+	start := len(s) - tail
+	for start < len(s) && !utf8.RuneStart(s[start]) {
+		start++
+	}
+	return s[:head] + truncationMarker(start-head) + s[start:]
+}
+
+// truncateMessagesJSON keeps whole messages from the start and end of a JSON
+// message array within limit bytes, replacing the dropped ones with a marker
+// message so the array stays valid. Values that are not arrays are
+// truncated as text.
+func truncateMessagesJSON(s string, limit int, headPercent float64) string {
+	var messages []json.RawMessage
+	if err := json.Unmarshal([]byte(s), &messages); err != nil {
+		return truncateText(s, limit, headPercent)
+	}
+
+	marker := func(dropped, bytes int) json.RawMessage {
+		raw, _ := json.Marshal(map[string]string{
+			"role":    "system",
+			"content": fmt.Sprintf("[... %d messages (%d bytes) truncated by ccproxy ...]", dropped, bytes),
+		})
+		return raw
+	}
+	// Brackets, separators and a marker of the largest possible size
+	keep := limit - len(marker(len(messages), len(s))) - 2 - len(messages)
+	headBudget := int(float64(keep) * headPercent / 100)
+	tailBudget := keep - headBudget
+
+	head, used := 0, 0
+	for head < len(messages) && used+len(messages[head]) <= headBudget {
+		used += len(messages[head])
+		head++
+	}
+	// The tail may use what the head left over
+	tailBudget += headBudget - used
+	tail, used := len(messages), 0
+	for tail > head && used+len(messages[tail-1]) <= tailBudget {
+		used += len(messages[tail-1])
+		tail--
+	}
+
+	dropped := 0
+	for _, m := range messages[head:tail] {
+		dropped += len(m)
+	}
+	kept := append(append(append([]json.RawMessage{}, messages[:head]...), marker(tail-head, dropped)), messages[tail:]...)
+	out, err := json.Marshal(kept)
+	if err != nil {
+		return truncateText(s, limit, headPercent)
+	}
+	return string(out)
+}
@@ -0,0 +1,115 @@
+package service
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"ccproxy/internal/store"
+)
+
+func TestConversationCap_TruncatesHeadAndTail(t *testing.T) {
+	c := newConversationCap(ConversationCapPolicy{MaxBytes: 8192, HeadPercent: 50})
+
+	var messages []map[string]string
+	for i := 0; i < 200; i++ {
+		messages = append(messages, map[string]string{"role": "user", "content": fmt.Sprintf("message %03d %s", i, strings.Repeat("x", 100))})
+	}
+	messagesJSON, _ := json.Marshal(messages)
+	conv := &store.ConversationContent{
+		SystemPrompt: sql.NullString{String: "be brief", Valid: true},
+		MessagesJSON: string(messagesJSON),
+		Prompt:       "START" + strings.Repeat("é", 10000) + "END",
+		Completion:   "short answer",
+	}
+	original := len(conv.MessagesJSON) + len(conv.Prompt) + len(conv.SystemPrompt.String) + len(conv.Completion)
+
+	c.apply(conv)
+
+	size := len(conv.MessagesJSON) + len(conv.Prompt) + len(conv.SystemPrompt.String) + len(conv.Completion)
+	if size > 8192 {
+		t.Errorf("stored %d bytes, cap is 8192", size)
+	}
+	if conv.TruncatedBytes != int64(original-size) {
+		t.Errorf("TruncatedBytes = %d, want %d", conv.TruncatedBytes, original-size)
+	}
+	if conv.SystemPrompt.String != "be brief" || conv.Completion != "short answer" {
+		t.Error("small fields should be kept whole")
+	}
+
+	if !strings.HasPrefix(conv.Prompt, "START") || !strings.HasSuffix(conv.Prompt, "END") ||
+		!strings.Contains(conv.Prompt, "bytes truncated by ccproxy") || !utf8.ValidString(conv.Prompt) {
+		t.Errorf("prompt not truncated around a marker: %q...", conv.Prompt[:40])
+	}
+
+	var kept []map[string]string
+	if err := json.Unmarshal([]byte(conv.MessagesJSON), &kept); err != nil {
+		t.Fatalf("truncated messages are not valid JSON: %v", err)
+	}
+	if !strings.HasPrefix(kept[0]["content"], "message 000") || !strings.HasPrefix(kept[len(kept)-1]["content"], "message 199") {
+		t.Errorf("first and last messages not kept: %v ... %v", kept[0], kept[len(kept)-1])
+	}
+	markers := 0
+	for _, m := range kept {
+		if strings.Contains(m["content"], "messages") && strings.Contains(m["content"], "truncated by ccproxy") {
+			markers++
+		}
+	}
+	if markers != 1 {
+		t.Errorf("got %d marker messages, want 1", markers)
+	}
+
+	stats := c.stats()
+	if stats.Truncated != 1 || stats.TruncatedBytes != conv.TruncatedBytes {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+
+	// Conversations within the cap are untouched
+	small := &store.ConversationContent{MessagesJSON: "[]", Prompt: "hi", Completion: "hello"}
+	c.apply(small)
+	if small.TruncatedBytes != 0 || c.stats().Truncated != 1 {
+		t.Error("small conversation truncated")
+	}
+}
+
+func TestConversationCap_Disabled(t *testing.T) {
+	c := newConversationCap(DefaultConversationCapPolicy())
+	conv := &store.ConversationContent{Prompt: strings.Repeat("x", 10<<20)}
+	c.apply(conv)
+	if len(conv.Prompt) != 10<<20 || conv.TruncatedBytes != 0 {
+		t.Error("disabled cap truncated a conversation")
+	}
+}
+
+func TestConversationCap_StorageStats(t *testing.T) {
+	db := newSpendTestStore(t)
+	c := newConversationCap(ConversationCapPolicy{MaxBytes: 4096, HeadPercent: 25})
+
+	for i, prompt := range []string{strings.Repeat("x", 20000), "small"} {
+		conv := &store.ConversationContent{
+			ID:           fmt.Sprintf("conv-%d", i),
+			RequestLogID: fmt.Sprintf("log-%d", i),
+			TokenID:      "tok-1",
+			MessagesJSON: "[]",
+			Prompt:       prompt,
+			Completion:   "ok",
+			CreatedAt:    time.Now(),
+		}
+		c.apply(conv)
+		if err := db.CreateConversation(conv); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats, err := db.GetConversationCompressionStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.TotalConversations != 2 || stats.TruncatedConversations != 1 || stats.TruncatedBytes != c.stats().TruncatedBytes {
+		t.Errorf("unexpected storage stats: %+v", stats)
+	}
+}
@@ -4,11 +4,14 @@ import (
 	"bytes"
 	"compress/gzip"
 	"context"
+	"database/sql"
 	"encoding/base64"
+	"fmt"
 	"io"
 	"sync"
 	"time"
 
+	"github.com/klauspost/compress/zstd"
 	"github.com/rs/zerolog/log"
 	"ccproxy/internal/store"
 )
@@ -19,11 +22,33 @@ const (
 	DefaultCompressBatchSize    = 100                // Compress 100 conversations per batch
 )
 
+// Compression algorithms for stored conversations. Compressed values are
+// self-describing, so changing the algorithm leaves older rows readable.
+const (
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+	// EncodeAll and DecodeAll are safe for concurrent use
+	zstdEncoder, _ = zstd.NewWriter(nil)
+	zstdDecoder, _ = zstd.NewReader(nil)
+)
+
+// ValidCompression reports whether algorithm is a supported compression algorithm
+func ValidCompression(algorithm string) bool {
+	return algorithm == CompressionGzip || algorithm == CompressionZstd
+}
+
 type ConversationCompressor struct {
 	store        *store.Store
 	compressAge  time.Duration
 	interval     time.Duration
 	batchSize    int
+	algorithm    string
 	ticker       *time.Ticker
 	ctx          context.Context
 	cancel       context.CancelFunc
@@ -46,9 +71,19 @@ func NewConversationCompressor(store *store.Store, compressAge, interval time.Du
 		compressAge: compressAge,
 		interval:    interval,
 		batchSize:   DefaultCompressBatchSize,
+		algorithm:   CompressionGzip,
 	}
 }
 
+// SetAlgorithm sets the algorithm used for newly compressed conversations
+func (cc *ConversationCompressor) SetAlgorithm(algorithm string) error {
+	if !ValidCompression(algorithm) {
+		return fmt.Errorf("unsupported compression algorithm %q", algorithm)
+	}
+	cc.algorithm = algorithm
+	return nil
+}
+
 // Start starts the conversation compressor background task
 func (cc *ConversationCompressor) Start(ctx context.Context) error {
 	cc.mu.Lock()
@@ -73,7 +108,7 @@ func (cc *ConversationCompressor) Start(ctx context.Context) error {
 	cc.wg.Add(1)
 	go cc.worker()
 
-	log.Info().Dur("compress_age", cc.compressAge).Dur("interval", cc.interval).Msg("Conversation compressor started")
+	log.Info().Dur("compress_age", cc.compressAge).Dur("interval", cc.interval).Str("algorithm", cc.algorithm).Msg("Conversation compressor started")
 	return nil
 }
 
@@ -155,28 +190,31 @@ func (cc *ConversationCompressor) runCompression() error {
 
 // compressConversation compresses a single conversation's text fields
 func (cc *ConversationCompressor) compressConversation(conv *store.ConversationContent) error {
+	originalSize := len(conv.Prompt) + len(conv.Completion) + len(conv.MessagesJSON) + len(conv.SystemPrompt.String)
+
 	// Compress prompt
-	compressedPrompt, err := compressString(conv.Prompt)
+	compressedPrompt, err := compressString(conv.Prompt, cc.algorithm)
 	if err != nil {
 		return err
 	}
 
 	// Compress completion
-	compressedCompletion, err := compressString(conv.Completion)
+	compressedCompletion, err := compressString(conv.Completion, cc.algorithm)
 	if err != nil {
 		return err
 	}
 
 	// Compress messages JSON
-	compressedMessages, err := compressString(conv.MessagesJSON)
+	compressedMessages, err := compressString(conv.MessagesJSON, cc.algorithm)
 	if err != nil {
 		return err
 	}
 
 	// Compress system prompt if present
-	var compressedSystemPrompt string
+	var compressedSystemPrompt sql.NullString
 	if conv.SystemPrompt.Valid {
-		compressedSystemPrompt, err = compressString(conv.SystemPrompt.String)
+		compressedSystemPrompt.Valid = true
+		compressedSystemPrompt.String, err = compressString(conv.SystemPrompt.String, cc.algorithm)
 		if err != nil {
 			return err
 		}
@@ -188,7 +226,9 @@ func (cc *ConversationCompressor) compressConversation(conv *store.ConversationC
 		    completion = ?,
 		    messages_json = ?,
 		    system_prompt = ?,
-		    is_compressed = 1
+		    is_compressed = 1,
+		    compression = ?,
+		    original_size = ?
 		WHERE id = ?`
 
 	_, err = cc.store.GetDB().Exec(query,
@@ -196,36 +236,45 @@ func (cc *ConversationCompressor) compressConversation(conv *store.ConversationC
 		compressedCompletion,
 		compressedMessages,
 		compressedSystemPrompt,
+		cc.algorithm,
+		originalSize,
 		conv.ID,
 	)
 
 	return err
 }
 
-// compressString compresses a string using gzip and returns base64 encoded result
-func compressString(s string) (string, error) {
+// compressString compresses a string with the given algorithm and returns base64 encoded result
+func compressString(s, algorithm string) (string, error) {
 	if s == "" {
 		return "", nil
 	}
 
-	var buf bytes.Buffer
-	writer := gzip.NewWriter(&buf)
+	var data []byte
+	switch algorithm {
+	case CompressionZstd:
+		data = zstdEncoder.EncodeAll([]byte(s), nil)
+	default:
+		var buf bytes.Buffer
+		writer := gzip.NewWriter(&buf)
 
-	_, err := writer.Write([]byte(s))
-	if err != nil {
-		return "", err
-	}
+		_, err := writer.Write([]byte(s))
+		if err != nil {
+			return "", err
+		}
 
-	if err := writer.Close(); err != nil {
-		return "", err
+		if err := writer.Close(); err != nil {
+			return "", err
+		}
+		data = buf.Bytes()
 	}
 
 	// Encode to base64 for safe storage
-	compressed := base64.StdEncoding.EncodeToString(buf.Bytes())
+	compressed := base64.StdEncoding.EncodeToString(data)
 	return compressed, nil
 }
 
-// DecompressString decompresses a base64 encoded gzip string
+// DecompressString decompresses a base64 encoded gzip or zstd string
 func DecompressString(compressed string) (string, error) {
 	if compressed == "" {
 		return "", nil
@@ -237,6 +286,17 @@ func DecompressString(compressed string) (string, error) {
 		return "", err
 	}
 
+	if bytes.HasPrefix(data, zstdMagic) {
+		decompressed, err := zstdDecoder.DecodeAll(data, nil)
+		if err != nil {
+			return "", err
+		}
+		return string(decompressed), nil
+	}
+	if !bytes.HasPrefix(data, gzipMagic) {
+		return "", fmt.Errorf("unknown compression format")
+	}
+
 	reader, err := gzip.NewReader(bytes.NewReader(data))
 	if err != nil {
 		return "", err
@@ -250,3 +310,30 @@ func DecompressString(compressed string) (string, error) {
 
 	return string(decompressed), nil
 }
+
+// DecompressConversation replaces the text fields of a compressed conversation
+// with their decompressed values. Uncompressed conversations are left as is.
+func DecompressConversation(conv *store.ConversationContent) error {
+	if !conv.IsCompressed {
+		return nil
+	}
+
+	fields := []*string{&conv.Prompt, &conv.Completion, &conv.MessagesJSON}
+	if conv.SystemPrompt.Valid {
+		fields = append(fields, &conv.SystemPrompt.String)
+	}
+
+	decompressed := make([]string, len(fields))
+	for i, field := range fields {
+		value, err := DecompressString(*field)
+		if err != nil {
+			return fmt.Errorf("decompress conversation %s: %w", conv.ID, err)
+		}
+		decompressed[i] = value
+	}
+	for i, field := range fields {
+		*field = decompressed[i]
+	}
+	conv.IsCompressed = false
+	return nil
+}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	"ccproxy/internal/store"
+)
+
+func TestCompressString_RoundTrip(t *testing.T) {
+	text := strings.Repeat("the quick brown fox jumps over the lazy dog ", 50)
+	for _, algorithm := range []string{CompressionGzip, CompressionZstd} {
+		compressed, err := compressString(text, algorithm)
+		if err != nil {
+			t.Fatalf("%s: %v", algorithm, err)
+		}
+		if len(compressed) >= len(text) {
+			t.Errorf("%s: compressed %d bytes to %d", algorithm, len(text), len(compressed))
+		}
+		decompressed, err := DecompressString(compressed)
+		if err != nil {
+			t.Fatalf("%s: %v", algorithm, err)
+		}
+		if decompressed != text {
+			t.Errorf("%s: round trip mismatch", algorithm)
+		}
+	}
+
+	if _, err := DecompressString("aGVsbG8="); err == nil {
+		t.Error("expected error for uncompressed data")
+	}
+}
+
+func TestConversationCompressor_DecompressAndStats(t *testing.T) {
+	db := newSpendTestStore(t)
+	old := time.Now().AddDate(0, 0, -30)
+	createRetentionToken(t, db, "tok-1", "alice", 0)
+
+	for _, id := range []string{"conv-gzip", "conv-zstd"} {
+		conv := &store.ConversationContent{
+			ID:           id,
+			RequestLogID: "log-" + id,
+			TokenID:      "tok-1",
+			SystemPrompt: sql.NullString{String: "You are terse", Valid: true},
+			MessagesJSON: `[{"role":"user","content":"` + strings.Repeat("hello ", 100) + `"}]`,
+			Prompt:       strings.Repeat("hello ", 100),
+			Completion:   strings.Repeat("world ", 100),
+			CreatedAt:    old,
+		}
+		if err := db.CreateConversation(conv); err != nil {
+			t.Fatal(err)
+		}
+	}
+	createTestConversation(t, db, "conv-plain", "tok-1", time.Now())
+
+	compressor := NewConversationCompressor(db, 7*24*time.Hour, time.Hour)
+	if err := compressor.SetAlgorithm("lz4"); err == nil {
+		t.Error("expected error for unsupported algorithm")
+	}
+	for id, algorithm := range map[string]string{"conv-gzip": CompressionGzip, "conv-zstd": CompressionZstd} {
+		conv, err := db.GetConversation(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := compressor.SetAlgorithm(algorithm); err != nil {
+			t.Fatal(err)
+		}
+		if err := compressor.compressConversation(conv); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, id := range []string{"conv-gzip", "conv-zstd"} {
+		conv, err := db.GetConversation(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !conv.IsCompressed || strings.HasPrefix(conv.Prompt, "hello") {
+			t.Fatalf("%s was not compressed", id)
+		}
+		if err := DecompressConversation(conv); err != nil {
+			t.Fatal(err)
+		}
+		if conv.IsCompressed || conv.Prompt != strings.Repeat("hello ", 100) || conv.SystemPrompt.String != "You are terse" {
+			t.Errorf("%s: unexpected decompressed conversation: %+v", id, conv)
+		}
+	}
+
+	stats, err := db.GetConversationCompressionStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.TotalConversations != 3 || stats.CompressedConversations != 2 {
+		t.Errorf("unexpected counts: %+v", stats)
+	}
+	if stats.ByAlgorithm[CompressionGzip] != 1 || stats.ByAlgorithm[CompressionZstd] != 1 {
+		t.Errorf("unexpected algorithms: %+v", stats.ByAlgorithm)
+	}
+	if stats.SavedBytes <= 0 || stats.SavedBytes != stats.OriginalBytes-stats.CompressedBytes {
+		t.Errorf("unexpected sizes: %+v", stats)
+	}
+}
@@ -0,0 +1,97 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestExternalJWTVerifier(t *testing.T) {
+	idp := newFakeIdP(t)
+	v := NewExternalJWTVerifier([]ExternalJWTIssuer{{
+		Name:      "corp",
+		Issuer:    idp.server.URL,
+		Audiences: []string{"ccproxy", "ccproxy-staging"},
+		JWKSURL:   idp.server.URL + "/jwks",
+	}, {
+		Name:         "ci",
+		Issuer:       "https://ci.example.com",
+		Audiences:    []string{"ccproxy"},
+		JWKSURL:      idp.server.URL + "/jwks",
+		SubjectClaim: "repository",
+	}}, time.Second)
+
+	sign := func(claims jwt.MapClaims, kid string) string {
+		base := jwt.MapClaims{
+			"iss": idp.server.URL,
+			"aud": "ccproxy",
+			"sub": "svc-billing",
+			"exp": time.Now().Add(time.Hour).Unix(),
+		}
+		for k, v := range claims {
+			if v == nil {
+				delete(base, k)
+			} else {
+				base[k] = v
+			}
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, base)
+		token.Header["kid"] = kid
+		signed, err := token.SignedString(idp.key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		handles bool
+		want    string
+		wantErr bool
+	}{
+		{"valid", sign(nil, "key-1"), true, "corp:svc-billing", false},
+		{"second audience", sign(jwt.MapClaims{"aud": []string{"other", "ccproxy-staging"}}, "key-1"), true, "corp:svc-billing", false},
+		{"custom subject claim", sign(jwt.MapClaims{"iss": "https://ci.example.com", "repository": "org/repo"}, "key-1"), true, "ci:org/repo", false},
+		{"wrong audience", sign(jwt.MapClaims{"aud": "someone-else"}, "key-1"), true, "", true},
+		{"expired", sign(jwt.MapClaims{"exp": time.Now().Add(-time.Hour).Unix()}, "key-1"), true, "", true},
+		{"no expiry", sign(jwt.MapClaims{"exp": nil}, "key-1"), true, "", true},
+		{"unknown key", sign(nil, "key-2"), true, "", true},
+		{"no subject", sign(jwt.MapClaims{"sub": nil}, "key-1"), true, "", true},
+		{"unknown issuer", sign(jwt.MapClaims{"iss": "https://evil.example.com"}, "key-1"), false, "", true},
+		{"not a jwt", "sk-not-a-jwt", false, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := v.Handles(tt.token); got != tt.handles {
+				t.Errorf("Handles = %v, want %v", got, tt.handles)
+			}
+			got, err := v.Verify(context.Background(), tt.token)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("Verify = %q, %v; want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestExternalJWTVerifier_RejectsHMAC(t *testing.T) {
+	idp := newFakeIdP(t)
+	v := NewExternalJWTVerifier([]ExternalJWTIssuer{{
+		Name: "corp", Issuer: idp.server.URL, Audiences: []string{"ccproxy"}, JWKSURL: idp.server.URL + "/jwks",
+	}}, time.Second)
+
+	// A token signed with a shared secret must not pass for the issuer's
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"iss": idp.server.URL, "aud": "ccproxy", "sub": "admin", "exp": time.Now().Add(time.Hour).Unix(),
+	})
+	signed, err := token.SignedString([]byte("guessed-secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.Verify(context.Background(), signed); err == nil {
+		t.Error("HS256 token accepted")
+	}
+}
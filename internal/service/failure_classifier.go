@@ -0,0 +1,218 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"ccproxy/internal/store"
+)
+
+// Failure categories stored on failed request logs
+const (
+	FailureAuth           = "auth"            // Credentials rejected or revoked
+	FailureRateLimit      = "rate_limit"      // Upstream or account rate limit
+	FailureContentPolicy  = "content_policy"  // Request or output refused by content filtering
+	FailureOverload       = "overload"        // Upstream overloaded or unavailable
+	FailureNetwork        = "network"         // Connection, TLS or timeout errors
+	FailureInvalidRequest = "invalid_request" // Malformed or unsupported request
+	FailureServerError    = "server_error"    // Other upstream 5xx errors
+	FailureOther          = "other"
+)
+
+const (
+	// DefaultFailureClassifyInterval is how often recent failures are classified
+	DefaultFailureClassifyInterval = 5 * time.Minute
+	// failureClassifyLookback limits classification to recent failures
+	failureClassifyLookback = 24 * time.Hour
+	failureClassifyBatch    = 500
+)
+
+// contentPolicyHints are message fragments of content filtering refusals
+var contentPolicyHints = []string{"content filtering", "content policy", "usage policy", "acceptable use", "violat"}
+
+// networkHints are fragments of Go network and timeout errors
+var networkHints = []string{
+	"connection refused", "connection reset", "broken pipe", "no such host",
+	"i/o timeout", "deadline exceeded", "tls handshake", "unexpected eof", "eof",
+}
+
+// ClassifyFailure sorts a failed request into a category from its status code
+// and stored error message, which is usually the upstream error body. The
+// Anthropic error type wins over the status code, which follows the same
+// mapping ErrorClassifier uses for account state.
+func ClassifyFailure(statusCode int, errorMessage string) string {
+	errType, message := parseErrorBody(errorMessage)
+	lower := strings.ToLower(message)
+
+	for _, hint := range contentPolicyHints {
+		if strings.Contains(lower, hint) {
+			return FailureContentPolicy
+		}
+	}
+
+	switch errType {
+	case "authentication_error", "permission_error":
+		return FailureAuth
+	case "rate_limit_error":
+		return FailureRateLimit
+	case "overloaded_error":
+		return FailureOverload
+	case "invalid_request_error", "not_found_error", "request_too_large":
+		return FailureInvalidRequest
+	case "api_error":
+		return FailureServerError
+	}
+
+	if errType == "" && (statusCode == 0 || statusCode >= 500) {
+		for _, hint := range networkHints {
+			if strings.Contains(lower, hint) {
+				return FailureNetwork
+			}
+		}
+	}
+
+	switch {
+	case statusCode == 401 || statusCode == 403:
+		return FailureAuth
+	case statusCode == 429:
+		return FailureRateLimit
+	case statusCode == 529 || statusCode == 503:
+		return FailureOverload
+	case statusCode == 502 || statusCode == 504:
+		return FailureNetwork
+	case statusCode >= 500:
+		return FailureServerError
+	case statusCode >= 400:
+		return FailureInvalidRequest
+	}
+	return FailureOther
+}
+
+// parseErrorBody extracts the error type and message from an Anthropic or
+// OpenAI style error body; other text is returned as the message
+func parseErrorBody(body string) (errType, message string) {
+	var parsed struct {
+		Error struct {
+			Type    string `json:"type"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal([]byte(body), &parsed); err == nil && (parsed.Error.Type != "" || parsed.Error.Message != "") {
+		return parsed.Error.Type, parsed.Error.Message
+	}
+	return "", body
+}
+
+// FailureClassifier periodically assigns a failure category to recent failed
+// requests so failures can be broken down by cause in stats
+type FailureClassifier struct {
+	store    *store.Store
+	interval time.Duration
+	now      func() time.Time
+
+	mu      sync.Mutex
+	running bool
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+// NewFailureClassifier creates a failure classifier
+func NewFailureClassifier(store *store.Store, interval time.Duration) *FailureClassifier {
+	if interval <= 0 {
+		interval = DefaultFailureClassifyInterval
+	}
+	return &FailureClassifier{
+		store:    store,
+		interval: interval,
+		now:      time.Now,
+	}
+}
+
+// Start classifies failures immediately and then periodically
+func (f *FailureClassifier) Start(ctx context.Context) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.running {
+		return nil
+	}
+
+	ctx, f.cancel = context.WithCancel(ctx)
+	f.running = true
+
+	f.wg.Add(1)
+	go func() {
+		defer f.wg.Done()
+		f.Classify()
+
+		ticker := time.NewTicker(f.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				f.Classify()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	log.Info().Dur("interval", f.interval).Msg("Failure classifier started")
+	return nil
+}
+
+// Stop stops the failure classifier
+func (f *FailureClassifier) Stop() {
+	f.mu.Lock()
+	if !f.running {
+		f.mu.Unlock()
+		return
+	}
+	f.running = false
+	f.mu.Unlock()
+
+	f.cancel()
+	f.wg.Wait()
+}
+
+// Classify categorizes unclassified failures from the lookback window and
+// returns the number classified
+func (f *FailureClassifier) Classify() int {
+	since := f.now().Add(-failureClassifyLookback)
+	total := 0
+	for {
+		failures, err := f.store.ListUnclassifiedFailures(since, failureClassifyBatch)
+		if err != nil {
+			log.Error().Err(err).Msg("failed to list unclassified failures")
+			return total
+		}
+		if len(failures) == 0 {
+			break
+		}
+
+		categories := make(map[string]string, len(failures))
+		for _, failure := range failures {
+			categories[failure.ID] = ClassifyFailure(failure.StatusCode, failure.ErrorMessage)
+		}
+		if err := f.store.SetFailureCategories(categories); err != nil {
+			log.Error().Err(err).Msg("failed to store failure categories")
+			return total
+		}
+		total += len(failures)
+
+		if len(failures) < failureClassifyBatch {
+			break
+		}
+	}
+
+	if total > 0 {
+		log.Debug().Int("failures", total).Msg("Failed requests classified")
+	}
+	return total
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"ccproxy/internal/store"
+)
+
+func TestClassifyFailure(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   string
+	}{
+		{"auth error type", 401, `{"type":"error","error":{"type":"authentication_error","message":"invalid x-api-key"}}`, FailureAuth},
+		{"forbidden status", 403, "forbidden", FailureAuth},
+		{"rate limit", 429, `{"type":"error","error":{"type":"rate_limit_error","message":"Number of requests has exceeded your rate limit"}}`, FailureRateLimit},
+		{"overloaded", 529, `{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`, FailureOverload},
+		{"unavailable", 503, "", FailureOverload},
+		{"content policy", 400, `{"type":"error","error":{"type":"invalid_request_error","message":"Output blocked by content filtering policy"}}`, FailureContentPolicy},
+		{"invalid request", 400, `{"type":"error","error":{"type":"invalid_request_error","message":"max_tokens: field required"}}`, FailureInvalidRequest},
+		{"connection refused", 500, `Post "https://api.anthropic.com/v1/messages": dial tcp: connect: connection refused`, FailureNetwork},
+		{"timeout", 0, "context deadline exceeded", FailureNetwork},
+		{"bad gateway", 502, "<html>Bad Gateway</html>", FailureNetwork},
+		{"api error", 500, `{"type":"error","error":{"type":"api_error","message":"Internal server error"}}`, FailureServerError},
+		{"openai style", 401, `{"error":{"message":"Incorrect API key provided","type":"invalid_request_error"}}`, FailureInvalidRequest},
+		{"unknown", 200, "stream ended without message_stop", FailureOther},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ClassifyFailure(tt.status, tt.body); got != tt.want {
+				t.Errorf("ClassifyFailure(%d, %q) = %q, want %q", tt.status, tt.body, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFailureClassifier_ClassifiesRecentFailures(t *testing.T) {
+	db := newSpendTestStore(t)
+	now := time.Now()
+
+	logs := []*store.RequestLog{
+		{ID: "rate", StatusCode: 429, ErrorMessage: sql.NullString{String: `{"type":"error","error":{"type":"rate_limit_error","message":"slow down"}}`, Valid: true}, RequestAt: now.Add(-time.Hour)},
+		{ID: "auth", StatusCode: 401, RequestAt: now.Add(-2 * time.Hour)},
+		{ID: "ok", StatusCode: 200, Success: true, RequestAt: now.Add(-time.Hour)},
+		{ID: "old", StatusCode: 429, RequestAt: now.Add(-48 * time.Hour)},
+	}
+	for _, l := range logs {
+		l.TokenID = "tok"
+		l.UserName = "user"
+		l.Mode = "api"
+		l.Model = "claude-sonnet-4"
+		if err := db.CreateRequestLog(l); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	classifier := NewFailureClassifier(db, time.Minute)
+	if n := classifier.Classify(); n != 2 {
+		t.Fatalf("classified %d failures, want 2", n)
+	}
+	if n := classifier.Classify(); n != 0 {
+		t.Fatalf("second run classified %d failures, want 0", n)
+	}
+
+	for id, want := range map[string]string{"rate": FailureRateLimit, "auth": FailureAuth} {
+		l, err := db.GetRequestLog(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if l.FailureCategory.String != want {
+			t.Errorf("log %s category = %q, want %q", id, l.FailureCategory.String, want)
+		}
+	}
+
+	counts, err := db.GetFailureCategoryCounts(now.Add(-72*time.Hour), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]int{}
+	for _, c := range counts {
+		got[c.Category] = c.Count
+	}
+	if got[FailureRateLimit] != 1 || got[FailureAuth] != 1 || got["unclassified"] != 1 {
+		t.Errorf("unexpected category counts: %v", got)
+	}
+}
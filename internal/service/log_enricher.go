@@ -0,0 +1,240 @@
+package service
+
+import (
+	"database/sql"
+	"net"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Enricher names accepted in configuration
+const (
+	EnricherCost   = "cost"
+	EnricherGeo    = "geo"
+	EnricherClient = "client"
+)
+
+// LogEnricher adds computed fields to a log entry before it is persisted.
+// Enrichers run on the request logger workers, off the request path.
+type LogEnricher interface {
+	Name() string
+	Enrich(entry *LogEntry)
+}
+
+// ModelPrice is the price of a model family in USD per million tokens
+type ModelPrice struct {
+	Model  string  `mapstructure:"model"` // Model name prefix, e.g. "claude-sonnet-4"
+	Input  float64 `mapstructure:"input"`
+	Output float64 `mapstructure:"output"`
+}
+
+// GeoIPRange maps a CIDR block to a country code
+type GeoIPRange struct {
+	CIDR    string `mapstructure:"cidr"`
+	Country string `mapstructure:"country"`
+}
+
+// EnricherConfig selects and configures log enrichers
+type EnricherConfig struct {
+	Enrichers   []string     // Enabled enrichers: "cost", "geo", "client"
+	Pricing     []ModelPrice // Overrides/extends DefaultModelPricing
+	GeoIPRanges []GeoIPRange
+}
+
+// DefaultModelPricing returns the built-in price table (USD per million tokens)
+func DefaultModelPricing() []ModelPrice {
+	return []ModelPrice{
+		{Model: "claude-opus-4-5", Input: 5, Output: 25},
+		{Model: "claude-opus-4", Input: 15, Output: 75},
+		{Model: "claude-sonnet-4", Input: 3, Output: 15},
+		{Model: "claude-haiku-4", Input: 1, Output: 5},
+		{Model: "claude-3-7-sonnet", Input: 3, Output: 15},
+		{Model: "claude-3-5-sonnet", Input: 3, Output: 15},
+		{Model: "claude-3-5-haiku", Input: 0.8, Output: 4},
+		{Model: "claude-3-opus", Input: 15, Output: 75},
+		{Model: "claude-3-haiku", Input: 0.25, Output: 1.25},
+	}
+}
+
+// NewLogEnrichers builds the enrichers enabled in the config, in order
+func NewLogEnrichers(config EnricherConfig) []LogEnricher {
+	var enrichers []LogEnricher
+	for _, name := range config.Enrichers {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case EnricherCost:
+			enrichers = append(enrichers, NewCostEnricher(config.Pricing))
+		case EnricherGeo:
+			enrichers = append(enrichers, NewGeoEnricher(config.GeoIPRanges))
+		case EnricherClient:
+			enrichers = append(enrichers, NewClientEnricher())
+		default:
+			log.Warn().Str("enricher", name).Msg("Unknown log enricher, ignoring")
+		}
+	}
+	return enrichers
+}
+
+// CostEnricher computes request cost from token usage and model pricing
+type CostEnricher struct {
+	prices []ModelPrice
+}
+
+// NewCostEnricher creates a cost enricher; custom prices take precedence over defaults
+func NewCostEnricher(custom []ModelPrice) *CostEnricher {
+	prices := append([]ModelPrice{}, custom...)
+	prices = append(prices, DefaultModelPricing()...)
+	return &CostEnricher{prices: prices}
+}
+
+func (e *CostEnricher) Name() string { return EnricherCost }
+
+func (e *CostEnricher) Enrich(entry *LogEntry) {
+	if entry.Log == nil || (entry.Log.PromptTokens == 0 && entry.Log.CompletionTokens == 0) {
+		return
+	}
+
+	cost, ok := e.Estimate(entry.Log.Model, entry.Log.PromptTokens, entry.Log.CompletionTokens)
+	if !ok {
+		return
+	}
+	entry.Log.CostUSD = sql.NullFloat64{Float64: cost, Valid: true}
+}
+
+// Estimate returns the cost in USD of a request; ok is false for unpriced models
+func (e *CostEnricher) Estimate(model string, inputTokens, outputTokens int) (float64, bool) {
+	price, ok := e.lookup(model)
+	if !ok {
+		return 0, false
+	}
+	return (float64(inputTokens)*price.Input + float64(outputTokens)*price.Output) / 1e6, true
+}
+
+// Price returns the price of a model; ok is false for unpriced models
+func (e *CostEnricher) Price(model string) (ModelPrice, bool) {
+	return e.lookup(model)
+}
+
+// lookup finds the longest matching model prefix
+func (e *CostEnricher) lookup(model string) (ModelPrice, bool) {
+	model = strings.ToLower(model)
+	var best ModelPrice
+	found := false
+	for _, p := range e.prices {
+		prefix := strings.ToLower(p.Model)
+		if strings.HasPrefix(model, prefix) && (!found || len(prefix) > len(best.Model)) {
+			best = p
+			found = true
+		}
+	}
+	return best, found
+}
+
+// GeoEnricher resolves the client country from configured CIDR ranges
+type GeoEnricher struct {
+	ranges []geoNet
+}
+
+type geoNet struct {
+	network *net.IPNet
+	country string
+}
+
+// NewGeoEnricher creates a geo enricher; invalid CIDRs are skipped
+func NewGeoEnricher(ranges []GeoIPRange) *GeoEnricher {
+	e := &GeoEnricher{}
+	for _, r := range ranges {
+		_, network, err := net.ParseCIDR(strings.TrimSpace(r.CIDR))
+		if err != nil {
+			log.Warn().Err(err).Str("cidr", r.CIDR).Msg("Invalid geo-IP range, skipping")
+			continue
+		}
+		e.ranges = append(e.ranges, geoNet{network: network, country: strings.ToUpper(r.Country)})
+	}
+	return e
+}
+
+func (e *GeoEnricher) Name() string { return EnricherGeo }
+
+func (e *GeoEnricher) Enrich(entry *LogEntry) {
+	if entry.Log == nil || !entry.Log.ClientIP.Valid {
+		return
+	}
+
+	ip := net.ParseIP(entry.Log.ClientIP.String)
+	if ip == nil {
+		return
+	}
+
+	// Most specific range wins
+	country := ""
+	bestBits := -1
+	for _, r := range e.ranges {
+		if r.network.Contains(ip) {
+			if bits, _ := r.network.Mask.Size(); bits > bestBits {
+				bestBits = bits
+				country = r.country
+			}
+		}
+	}
+
+	if country == "" && (ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast()) {
+		country = "private"
+	}
+
+	if country != "" {
+		entry.Log.ClientCountry = sql.NullString{String: country, Valid: true}
+	}
+}
+
+// ClientEnricher derives a normalized client name from the User-Agent
+type ClientEnricher struct{}
+
+// NewClientEnricher creates a client name enricher
+func NewClientEnricher() *ClientEnricher {
+	return &ClientEnricher{}
+}
+
+func (e *ClientEnricher) Name() string { return EnricherClient }
+
+func (e *ClientEnricher) Enrich(entry *LogEntry) {
+	if entry.Log == nil || !entry.Log.UserAgent.Valid || entry.Log.UserAgent.String == "" {
+		return
+	}
+	entry.Log.ClientName = sql.NullString{String: ParseClientName(entry.Log.UserAgent.String), Valid: true}
+}
+
+// clientPatterns maps User-Agent substrings (lowercase) to client names, first match wins
+var clientPatterns = []struct {
+	pattern string
+	name    string
+}{
+	{"claude-cli", "claude-code"},
+	{"cursor", "cursor"},
+	{"cline", "cline"},
+	{"anthropic/", "anthropic-sdk"},
+	{"anthropic-sdk", "anthropic-sdk"},
+	{"openai/", "openai-sdk"},
+	{"langchain", "langchain"},
+	{"python-httpx", "python"},
+	{"python-requests", "python"},
+	{"aiohttp", "python"},
+	{"node-fetch", "node"},
+	{"axios", "node"},
+	{"undici", "node"},
+	{"go-http-client", "go"},
+	{"curl/", "curl"},
+	{"postmanruntime", "postman"},
+	{"mozilla/", "browser"},
+}
+
+// ParseClientName returns a normalized client name for a User-Agent string
+func ParseClientName(userAgent string) string {
+	ua := strings.ToLower(userAgent)
+	for _, p := range clientPatterns {
+		if strings.Contains(ua, p.pattern) {
+			return p.name
+		}
+	}
+	return "other"
+}
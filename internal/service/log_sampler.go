@@ -0,0 +1,108 @@
+package service
+
+import (
+	"math/rand"
+	"sync/atomic"
+	"time"
+)
+
+// SamplingPolicy decides which request logs are persisted under high load.
+// Errors and slow requests are always kept; successes are sampled, and each
+// kept sampled success is weighted to stand for the ones dropped.
+type SamplingPolicy struct {
+	Enabled        bool
+	SuccessPercent float64       // Percentage (0-100) of successful requests to keep
+	SlowThreshold  time.Duration // Requests at or above this duration are always kept; 0 disables
+}
+
+// DefaultSamplingPolicy returns a policy that keeps every log
+func DefaultSamplingPolicy() SamplingPolicy {
+	return SamplingPolicy{
+		Enabled:        false,
+		SuccessPercent: 100,
+		SlowThreshold:  10 * time.Second,
+	}
+}
+
+// SamplingStats contains request log sampling counters
+type SamplingStats struct {
+	Enabled           bool    `json:"enabled"`
+	SuccessPercent    float64 `json:"success_percent"`
+	SlowThresholdMs   int64   `json:"slow_threshold_ms"`
+	Kept              int64   `json:"kept"`
+	KeptErrors        int64   `json:"kept_errors"`
+	KeptSlow          int64   `json:"kept_slow"`
+	DroppedBySampling int64   `json:"dropped_by_sampling"`
+}
+
+// logSampler applies a SamplingPolicy and tracks its decisions
+type logSampler struct {
+	policy SamplingPolicy
+	random func() float64 // returns [0, 1)
+
+	kept       int64
+	keptErrors int64
+	keptSlow   int64
+	dropped    int64
+}
+
+func newLogSampler(policy SamplingPolicy) *logSampler {
+	if policy.SuccessPercent < 0 {
+		policy.SuccessPercent = 0
+	}
+	if policy.SuccessPercent > 100 {
+		policy.SuccessPercent = 100
+	}
+	return &logSampler{
+		policy: policy,
+		random: rand.Float64,
+	}
+}
+
+// keep reports whether an entry should be persisted
+func (s *logSampler) keep(entry *LogEntry) bool {
+	if !s.policy.Enabled || entry.Log == nil {
+		atomic.AddInt64(&s.kept, 1)
+		return true
+	}
+
+	// Captured conversations are explicitly requested per token and reference the log
+	if entry.Conversation != nil {
+		atomic.AddInt64(&s.kept, 1)
+		return true
+	}
+
+	if !entry.Log.Success {
+		atomic.AddInt64(&s.kept, 1)
+		atomic.AddInt64(&s.keptErrors, 1)
+		return true
+	}
+
+	if s.policy.SlowThreshold > 0 && entry.Log.DurationMs.Valid &&
+		time.Duration(entry.Log.DurationMs.Int64)*time.Millisecond >= s.policy.SlowThreshold {
+		atomic.AddInt64(&s.kept, 1)
+		atomic.AddInt64(&s.keptSlow, 1)
+		return true
+	}
+
+	if s.random()*100 < s.policy.SuccessPercent {
+		entry.Log.SampleWeight = 100 / s.policy.SuccessPercent
+		atomic.AddInt64(&s.kept, 1)
+		return true
+	}
+
+	atomic.AddInt64(&s.dropped, 1)
+	return false
+}
+
+func (s *logSampler) stats() SamplingStats {
+	return SamplingStats{
+		Enabled:           s.policy.Enabled,
+		SuccessPercent:    s.policy.SuccessPercent,
+		SlowThresholdMs:   s.policy.SlowThreshold.Milliseconds(),
+		Kept:              atomic.LoadInt64(&s.kept),
+		KeptErrors:        atomic.LoadInt64(&s.keptErrors),
+		KeptSlow:          atomic.LoadInt64(&s.keptSlow),
+		DroppedBySampling: atomic.LoadInt64(&s.dropped),
+	}
+}
@@ -0,0 +1,68 @@
+package service
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"ccproxy/internal/store"
+)
+
+func sampledEntry(success bool, durationMs int64) *LogEntry {
+	return &LogEntry{Log: &store.RequestLog{
+		Success:    success,
+		DurationMs: sql.NullInt64{Int64: durationMs, Valid: true},
+	}}
+}
+
+func TestLogSampler_KeepsErrorsAndSlowRequests(t *testing.T) {
+	s := newLogSampler(SamplingPolicy{Enabled: true, SuccessPercent: 0, SlowThreshold: 5 * time.Second})
+
+	if !s.keep(sampledEntry(false, 100)) {
+		t.Error("errors should always be kept")
+	}
+	if !s.keep(sampledEntry(true, 6000)) {
+		t.Error("slow requests should always be kept")
+	}
+	if s.keep(sampledEntry(true, 100)) {
+		t.Error("fast successes should be dropped at 0%")
+	}
+
+	stats := s.stats()
+	if stats.KeptErrors != 1 || stats.KeptSlow != 1 || stats.DroppedBySampling != 1 || stats.Kept != 2 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestLogSampler_SuccessPercent(t *testing.T) {
+	s := newLogSampler(SamplingPolicy{Enabled: true, SuccessPercent: 25})
+	values := []float64{0.1, 0.3, 0.2, 0.9}
+	i := 0
+	s.random = func() float64 {
+		v := values[i%len(values)]
+		i++
+		return v
+	}
+
+	kept := 0
+	for range values {
+		entry := sampledEntry(true, 100)
+		if s.keep(entry) {
+			kept++
+			// Each kept success stands for the three dropped with it
+			if entry.Log.SampleWeight != 4 {
+				t.Errorf("sample weight = %v, want 4", entry.Log.SampleWeight)
+			}
+		}
+	}
+	if kept != 2 {
+		t.Errorf("kept = %d, want 2", kept)
+	}
+}
+
+func TestLogSampler_Disabled(t *testing.T) {
+	s := newLogSampler(SamplingPolicy{Enabled: false, SuccessPercent: 0})
+	if !s.keep(sampledEntry(true, 100)) {
+		t.Error("disabled sampler should keep everything")
+	}
+}
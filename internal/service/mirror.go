@@ -0,0 +1,327 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"ccproxy/internal/store"
+)
+
+const (
+	DefaultMirrorTimeout      = 120 * time.Second
+	DefaultMirrorWorkers      = 2
+	DefaultMirrorQueueSize    = 100
+	DefaultMirrorMaxBodyBytes = 64 * 1024
+)
+
+// MirrorConfig configures request mirroring to a secondary upstream
+type MirrorConfig struct {
+	Percent      float64 // Share of requests mirrored, 0-100
+	UpstreamURL  string  // Anthropic-compatible base URL
+	APIKey       string
+	Model        string // Overrides the request model when set
+	Timeout      time.Duration
+	Workers      int
+	QueueSize    int
+	MaxBodyBytes int
+}
+
+// MirrorJob is a completed primary request waiting to be replayed
+type MirrorJob struct {
+	Path            string
+	TokenID         string
+	Body            []byte
+	PrimaryStatus   int
+	PrimaryLatency  time.Duration
+	PrimaryResponse []byte
+	CreatedAt       time.Time
+}
+
+// MirrorStats reports mirroring activity since start
+type MirrorStats struct {
+	Enabled   bool    `json:"enabled"`
+	Percent   float64 `json:"percent"`
+	Upstream  string  `json:"upstream"`
+	Model     string  `json:"model,omitempty"`
+	Sampled   int64   `json:"sampled"`
+	Dropped   int64   `json:"dropped"`
+	Sent      int64   `json:"sent"`
+	Failed    int64   `json:"failed"`
+	QueueSize int     `json:"queue_size"`
+}
+
+// Mirror duplicates a sample of requests to a secondary upstream in the
+// background and stores both responses. It never blocks or alters the
+// primary request: jobs are dropped when the queue is full.
+type Mirror struct {
+	store  *store.Store
+	config MirrorConfig
+	client *http.Client
+	queue  chan *MirrorJob
+	random func() float64 // returns [0, 1)
+
+	sampled atomic.Int64
+	dropped atomic.Int64
+	sent    atomic.Int64
+	failed  atomic.Int64
+
+	mu      sync.Mutex
+	running bool
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+// NewMirror creates a request mirror; call Start to begin processing
+func NewMirror(store *store.Store, config MirrorConfig) *Mirror {
+	if config.Timeout <= 0 {
+		config.Timeout = DefaultMirrorTimeout
+	}
+	if config.Workers <= 0 {
+		config.Workers = DefaultMirrorWorkers
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = DefaultMirrorQueueSize
+	}
+	if config.MaxBodyBytes <= 0 {
+		config.MaxBodyBytes = DefaultMirrorMaxBodyBytes
+	}
+	config.UpstreamURL = strings.TrimRight(config.UpstreamURL, "/")
+
+	return &Mirror{
+		store:  store,
+		config: config,
+		client: &http.Client{Timeout: config.Timeout},
+		queue:  make(chan *MirrorJob, config.QueueSize),
+		random: rand.Float64,
+	}
+}
+
+// ShouldMirror reports whether the current request is sampled for mirroring
+func (m *Mirror) ShouldMirror() bool {
+	if m.config.Percent <= 0 {
+		return false
+	}
+	return m.config.Percent >= 100 || m.random()*100 < m.config.Percent
+}
+
+// MaxBodyBytes returns the size limit applied to stored bodies
+func (m *Mirror) MaxBodyBytes() int {
+	return m.config.MaxBodyBytes
+}
+
+// Start starts the mirror workers
+func (m *Mirror) Start(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.running {
+		return nil
+	}
+
+	ctx, m.cancel = context.WithCancel(ctx)
+	m.running = true
+
+	for i := 0; i < m.config.Workers; i++ {
+		m.wg.Add(1)
+		go m.worker(ctx)
+	}
+
+	log.Info().
+		Float64("percent", m.config.Percent).
+		Str("upstream", m.config.UpstreamURL).
+		Int("workers", m.config.Workers).
+		Msg("Request mirror started")
+
+	return nil
+}
+
+// Stop stops the workers; queued jobs are discarded
+func (m *Mirror) Stop() {
+	m.mu.Lock()
+	if !m.running {
+		m.mu.Unlock()
+		return
+	}
+	m.running = false
+	m.mu.Unlock()
+
+	m.cancel()
+	m.wg.Wait()
+	log.Info().Msg("Request mirror stopped")
+}
+
+// Submit queues a job without blocking. It returns false when the job was
+// dropped because the mirror is stopped or its queue is full.
+func (m *Mirror) Submit(job *MirrorJob) bool {
+	m.sampled.Add(1)
+
+	m.mu.Lock()
+	running := m.running
+	m.mu.Unlock()
+
+	if running {
+		select {
+		case m.queue <- job:
+			return true
+		default:
+		}
+	}
+
+	m.dropped.Add(1)
+	return false
+}
+
+// Stats returns mirroring counters
+func (m *Mirror) Stats() MirrorStats {
+	m.mu.Lock()
+	running := m.running
+	m.mu.Unlock()
+
+	return MirrorStats{
+		Enabled:   running,
+		Percent:   m.config.Percent,
+		Upstream:  m.config.UpstreamURL,
+		Model:     m.config.Model,
+		Sampled:   m.sampled.Load(),
+		Dropped:   m.dropped.Load(),
+		Sent:      m.sent.Load(),
+		Failed:    m.failed.Load(),
+		QueueSize: len(m.queue),
+	}
+}
+
+func (m *Mirror) worker(ctx context.Context) {
+	defer m.wg.Done()
+
+	for {
+		select {
+		case job := <-m.queue:
+			m.process(ctx, job)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// process replays a job against the secondary upstream and stores the result
+func (m *Mirror) process(ctx context.Context, job *MirrorJob) {
+	result := &store.MirrorResult{
+		CreatedAt:        job.CreatedAt,
+		Path:             job.Path,
+		TokenID:          job.TokenID,
+		RequestBody:      truncateBody(job.Body, m.config.MaxBodyBytes),
+		PrimaryModel:     requestModel(job.Body),
+		PrimaryStatus:    job.PrimaryStatus,
+		PrimaryLatencyMs: job.PrimaryLatency.Milliseconds(),
+		PrimaryResponse:  truncateBody(job.PrimaryResponse, m.config.MaxBodyBytes),
+	}
+	if result.CreatedAt.IsZero() {
+		result.CreatedAt = time.Now()
+	}
+
+	body, model, err := m.rewriteBody(job.Body)
+	result.MirrorModel = model
+	if err == nil {
+		start := time.Now()
+		var status int
+		var response []byte
+		status, response, err = m.send(ctx, body)
+		result.MirrorLatencyMs = time.Since(start).Milliseconds()
+		result.MirrorStatus = status
+		result.MirrorResponse = truncateBody(response, m.config.MaxBodyBytes)
+	}
+
+	if err != nil || result.MirrorStatus >= 400 {
+		m.failed.Add(1)
+	} else {
+		m.sent.Add(1)
+	}
+	if err != nil {
+		result.MirrorError = err.Error()
+		log.Debug().Err(err).Str("path", job.Path).Msg("mirror request failed")
+	}
+
+	if ctx.Err() != nil {
+		return
+	}
+	if err := m.store.CreateMirrorResult(result); err != nil {
+		log.Error().Err(err).Msg("failed to store mirror result")
+	}
+}
+
+// rewriteBody applies the model override and disables streaming so the
+// mirrored response can be stored as a single JSON document
+func (m *Mirror) rewriteBody(body []byte) ([]byte, string, error) {
+	var payload map[string]json.RawMessage
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, "", fmt.Errorf("invalid request body: %w", err)
+	}
+
+	if m.config.Model != "" {
+		model, _ := json.Marshal(m.config.Model)
+		payload["model"] = model
+	}
+	payload["stream"] = json.RawMessage("false")
+
+	var model string
+	_ = json.Unmarshal(payload["model"], &model)
+
+	rewritten, err := json.Marshal(payload)
+	if err != nil {
+		return nil, model, err
+	}
+	return rewritten, model, nil
+}
+
+func (m *Mirror) send(ctx context.Context, body []byte) (int, []byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.config.UpstreamURL+"/v1/messages", bytes.NewReader(body))
+	if err != nil {
+		return 0, nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("anthropic-version", "2023-06-01")
+	if m.config.APIKey != "" {
+		req.Header.Set("x-api-key", m.config.APIKey)
+	}
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+
+	// Read one byte past the limit so truncation is visible in the stored body
+	response, err := io.ReadAll(io.LimitReader(resp.Body, int64(m.config.MaxBodyBytes)+1))
+	if err != nil {
+		return resp.StatusCode, response, fmt.Errorf("failed to read response: %w", err)
+	}
+	return resp.StatusCode, response, nil
+}
+
+// requestModel extracts the model field from a request body
+func requestModel(body []byte) string {
+	var payload struct {
+		Model string `json:"model"`
+	}
+	_ = json.Unmarshal(body, &payload)
+	return payload.Model
+}
+
+// truncateBody converts a body to a string of at most max bytes
+func truncateBody(body []byte, max int) string {
+	if max > 0 && len(body) > max {
+		return string(body[:max]) + "...[truncated]"
+	}
+	return string(body)
+}
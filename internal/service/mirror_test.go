@@ -0,0 +1,142 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"ccproxy/internal/store"
+)
+
+func TestMirror_ShouldMirror(t *testing.T) {
+	m := NewMirror(nil, MirrorConfig{Percent: 10})
+
+	m.random = func() float64 { return 0.05 }
+	if !m.ShouldMirror() {
+		t.Error("5 < 10 should be mirrored")
+	}
+	m.random = func() float64 { return 0.5 }
+	if m.ShouldMirror() {
+		t.Error("50 >= 10 should not be mirrored")
+	}
+
+	if NewMirror(nil, MirrorConfig{Percent: 0}).ShouldMirror() {
+		t.Error("0% should never mirror")
+	}
+	if !NewMirror(nil, MirrorConfig{Percent: 100}).ShouldMirror() {
+		t.Error("100% should always mirror")
+	}
+}
+
+func TestMirror_RewriteBody(t *testing.T) {
+	m := NewMirror(nil, MirrorConfig{Model: "claude-haiku"})
+
+	body, model, err := m.rewriteBody([]byte(`{"model":"claude-opus","stream":true,"max_tokens":10}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if model != "claude-haiku" {
+		t.Errorf("model = %q", model)
+	}
+
+	var payload map[string]interface{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload["model"] != "claude-haiku" || payload["stream"] != false || payload["max_tokens"] != float64(10) {
+		t.Errorf("unexpected body: %s", body)
+	}
+
+	// Without an override the original model is kept
+	_, model, _ = NewMirror(nil, MirrorConfig{}).rewriteBody([]byte(`{"model":"claude-opus"}`))
+	if model != "claude-opus" {
+		t.Errorf("model = %q, want original", model)
+	}
+
+	if _, _, err := m.rewriteBody([]byte(`not json`)); err == nil {
+		t.Error("expected error for invalid body")
+	}
+}
+
+func TestMirror_SubmitDropsWhenStoppedOrFull(t *testing.T) {
+	m := NewMirror(nil, MirrorConfig{QueueSize: 1})
+	if m.Submit(&MirrorJob{}) {
+		t.Error("submit before Start should be dropped")
+	}
+
+	// Mark running without workers so the queue fills up
+	m.running = true
+	if !m.Submit(&MirrorJob{}) {
+		t.Error("first job should be queued")
+	}
+	if m.Submit(&MirrorJob{}) {
+		t.Error("job should be dropped when the queue is full")
+	}
+
+	stats := m.Stats()
+	if stats.Sampled != 3 || stats.Dropped != 2 || stats.QueueSize != 1 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestMirror_ProcessStoresResult(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/messages" || r.Header.Get("x-api-key") != "sk-test" {
+			t.Errorf("unexpected request %s key=%q", r.URL.Path, r.Header.Get("x-api-key"))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"content":[{"type":"text","text":"mirrored"}]}`))
+	}))
+	defer upstream.Close()
+
+	db, err := store.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	m := NewMirror(db, MirrorConfig{Percent: 100, UpstreamURL: upstream.URL + "/", APIKey: "sk-test", Model: "claude-haiku"})
+	m.process(context.Background(), &MirrorJob{
+		Path:            "/v1/messages",
+		TokenID:         "tok-1",
+		Body:            []byte(`{"model":"claude-opus","stream":true}`),
+		PrimaryStatus:   200,
+		PrimaryLatency:  150 * time.Millisecond,
+		PrimaryResponse: []byte(`{"content":[{"type":"text","text":"primary"}]}`),
+		CreatedAt:       time.Now(),
+	})
+
+	results, err := db.ListMirrorResults(10, 0, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("got %d results, want 1", len(results))
+	}
+	r := results[0]
+	if r.PrimaryModel != "claude-opus" || r.MirrorModel != "claude-haiku" {
+		t.Errorf("models = %q / %q", r.PrimaryModel, r.MirrorModel)
+	}
+	if r.PrimaryStatus != 200 || r.MirrorStatus != 200 || r.PrimaryLatencyMs != 150 {
+		t.Errorf("unexpected result: %+v", r)
+	}
+	if r.MirrorResponse == "" || r.MirrorError != "" {
+		t.Errorf("mirror response = %q, error = %q", r.MirrorResponse, r.MirrorError)
+	}
+	if stats := m.Stats(); stats.Sent != 1 || stats.Failed != 0 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestTruncateBody(t *testing.T) {
+	if got := truncateBody([]byte("abcdef"), 3); got != "abc...[truncated]" {
+		t.Errorf("got %q", got)
+	}
+	if got := truncateBody([]byte("abc"), 3); got != "abc" {
+		t.Errorf("got %q", got)
+	}
+}
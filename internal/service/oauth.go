@@ -6,6 +6,7 @@ import (
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
@@ -16,6 +17,7 @@ import (
 	"github.com/imroc/req/v3"
 	"github.com/rs/zerolog/log"
 
+	"ccproxy/internal/notify"
 	"ccproxy/internal/store"
 )
 
@@ -31,18 +33,42 @@ const (
 	codeVerifierCharset = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-._~"
 )
 
+// ErrInvalidGrant means the refresh token was rejected and cannot be used again
+var ErrInvalidGrant = errors.New("refresh token rejected (invalid_grant)")
+
 type OAuthService struct {
-	webURL string
-	apiURL string
-	store  *store.Store
+	webURL    string
+	apiURL    string
+	store     *store.Store
+	refreshes *refreshGroup
+	notifier  notify.Notifier
+	sticky    StickyInvalidator
+	// adminAPIKey is the Anthropic Admin API key used for workspace lookups
+	adminAPIKey string
 }
 
 func NewOAuthService(webURL, apiURL string, s *store.Store) *OAuthService {
 	return &OAuthService{
-		webURL: webURL,
-		apiURL: apiURL,
-		store:  s,
+		webURL:    webURL,
+		apiURL:    apiURL,
+		store:     s,
+		refreshes: newRefreshGroup(),
+		notifier:  notify.Nop{},
+	}
+}
+
+// SetNotifier sets where account re-auth events are sent
+func (s *OAuthService) SetNotifier(n notify.Notifier) {
+	if n == nil {
+		n = notify.Nop{}
 	}
+	s.notifier = n
+}
+
+// SetStickyInvalidator drops the sticky sessions of accounts that need a
+// manual re-login
+func (s *OAuthService) SetStickyInvalidator(inv StickyInvalidator) {
+	s.sticky = inv
 }
 
 // LoginRequest represents the OAuth login request
@@ -131,7 +157,7 @@ func (s *OAuthService) getOrganizationUUID(sessionKey, proxyURL string) (string,
 			log.Error().Msg("[OAuth] Cloudflare challenge detected - try using a proxy_url or check if sessionKey is valid")
 			return "", fmt.Errorf("blocked by Cloudflare - use proxy_url parameter or verify sessionKey is fresh from browser")
 		}
-		return "", fmt.Errorf("failed to get organizations: status %d, body: %s", resp.StatusCode, resp.String())
+		return "", fmt.Errorf("failed to get organizations: %w", &oauthStatusError{resp.StatusCode, resp.String()})
 	}
 
 	if len(orgs) == 0 {
@@ -202,7 +228,7 @@ func (s *OAuthService) getAuthorizationCode(sessionKey, orgUUID, proxyURL string
 	log.Info().Int("status", resp.StatusCode).Msg("[OAuth] Step 2 Response")
 
 	if !resp.IsSuccessState() {
-		return "", "", "", fmt.Errorf("failed to get authorization code: status %d, body: %s", resp.StatusCode, resp.String())
+		return "", "", "", fmt.Errorf("failed to get authorization code: %w", &oauthStatusError{resp.StatusCode, resp.String()})
 	}
 
 	if result.RedirectURI == "" {
@@ -282,7 +308,7 @@ func (s *OAuthService) exchangeToken(code, verifier, state, proxyURL string) (*L
 	log.Info().Int("status", resp.StatusCode).Msg("[OAuth] Step 3 Response")
 
 	if !resp.IsSuccessState() {
-		return nil, fmt.Errorf("token exchange failed: status %d, body: %s", resp.StatusCode, resp.String())
+		return nil, fmt.Errorf("token exchange failed: %w", &oauthStatusError{resp.StatusCode, resp.String()})
 	}
 
 	expiresAt := time.Now().Add(time.Duration(tokenResp.ExpiresIn) * time.Second)
@@ -296,45 +322,45 @@ func (s *OAuthService) exchangeToken(code, verifier, state, proxyURL string) (*L
 	}, nil
 }
 
+// oauthStatusError is an unsuccessful response from an OAuth step
+type oauthStatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *oauthStatusError) Error() string {
+	return fmt.Sprintf("status %d, body: %s", e.StatusCode, e.Body)
+}
+
 // Login performs the complete OAuth login flow
 func (s *OAuthService) Login(req LoginRequest) (*LoginResult, error) {
 	log.Info().Str("name", req.Name).Msg("starting OAuth login")
 
-	proxyURL := req.ProxyURL
-
-	// Step 1: Get organization UUID
-	orgUUID, err := s.getOrganizationUUID(req.SessionKey, proxyURL)
+	result, err := s.authorize(req.SessionKey, req.ProxyURL)
 	if err != nil {
-		return nil, fmt.Errorf("step 1 failed: %w", err)
-	}
-
-	// Step 2: Get authorization code
-	code, verifier, state, err := s.getAuthorizationCode(req.SessionKey, orgUUID, proxyURL)
-	if err != nil {
-		return nil, fmt.Errorf("step 2 failed: %w", err)
+		return nil, err
 	}
-
-	// Step 3: Exchange for access token
-	result, err := s.exchangeToken(code, verifier, state, proxyURL)
-	if err != nil {
-		return nil, fmt.Errorf("step 3 failed: %w", err)
+	if err := s.saveLoginAccount(req, result); err != nil {
+		return nil, err
 	}
+	return result, nil
+}
 
-	result.OrganizationID = orgUUID
-
-	// Generate account ID
+// saveLoginAccount stores the account authorized by a login and sets the
+// result's account ID
+func (s *OAuthService) saveLoginAccount(req LoginRequest, result *LoginResult) error {
 	accountID := generateAccountID()
 	result.AccountID = accountID
 
-	// Save to database
 	account := &store.Account{
 		ID:             accountID,
 		Name:           req.Name,
 		Type:           store.AccountTypeOAuth,
-		OrganizationID: orgUUID,
+		OrganizationID: result.OrganizationID,
 		Credentials: store.Credentials{
 			AccessToken:  result.AccessToken,
 			RefreshToken: result.RefreshToken,
+			SessionKey:   req.SessionKey, // Kept for automatic re-login when the refresh token is revoked
 		},
 		CreatedAt:    time.Now(),
 		ExpiresAt:    &result.ExpiresAt,
@@ -343,24 +369,111 @@ func (s *OAuthService) Login(req LoginRequest) (*LoginResult, error) {
 	}
 
 	if err := s.store.CreateAccount(account); err != nil {
-		return nil, fmt.Errorf("failed to save account: %w", err)
+		return fmt.Errorf("failed to save account: %w", err)
 	}
 
 	log.Info().Str("account_id", accountID).Msg("OAuth login completed")
+	return nil
+}
+
+// authorize runs the three-step OAuth flow for a session key
+func (s *OAuthService) authorize(sessionKey, proxyURL string) (*LoginResult, error) {
+	// Step 1: Get organization UUID
+	orgUUID, err := s.getOrganizationUUID(sessionKey, proxyURL)
+	if err != nil {
+		return nil, fmt.Errorf("step 1 failed: %w", err)
+	}
+
+	// Step 2: Get authorization code
+	code, verifier, state, err := s.getAuthorizationCode(sessionKey, orgUUID, proxyURL)
+	if err != nil {
+		return nil, fmt.Errorf("step 2 failed: %w", err)
+	}
+
+	// Step 3: Exchange for access token
+	result, err := s.exchangeToken(code, verifier, state, proxyURL)
+	if err != nil {
+		return nil, fmt.Errorf("step 3 failed: %w", err)
+	}
+
+	result.OrganizationID = orgUUID
 	return result, nil
 }
 
-// RefreshAccountToken refreshes an expired OAuth token for a specific account
+// RefreshAccountToken refreshes an expired OAuth token for a specific account.
+// Concurrent refreshes of the same account are collapsed into one upstream
+// call and every caller's account is updated with the shared result.
 func (s *OAuthService) RefreshAccountToken(account *store.Account) error {
 	if !account.IsOAuth() {
 		return fmt.Errorf("account is not an OAuth account")
 	}
 
+	token, shared, err := s.refreshes.do(account.ID, func() (*refreshedToken, error) {
+		return s.refreshAccountToken(account)
+	})
+	if err != nil {
+		return err
+	}
+
+	account.Credentials.AccessToken = token.AccessToken
+	account.Credentials.RefreshToken = token.RefreshToken
+	expiresAt := token.ExpiresAt
+	account.ExpiresAt = &expiresAt
+
+	if shared {
+		log.Debug().Str("account_id", account.ID).Msg("reused token from concurrent refresh")
+	}
+	return nil
+}
+
+// refreshAccountToken exchanges the account's refresh token and persists the result.
+// It must only be called through the refresh group.
+func (s *OAuthService) refreshAccountToken(account *store.Account) (*refreshedToken, error) {
+	// The caller's copy may predate a refresh that just finished; refresh tokens
+	// are single-use, so start from the stored credentials.
+	latest, err := s.store.GetAccount(account.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load account: %w", err)
+	}
+	if latest == nil {
+		latest = account
+	}
+	if latest.Credentials.RefreshToken != account.Credentials.RefreshToken &&
+		latest.ExpiresAt != nil && !latest.NeedsRefresh() {
+		return &refreshedToken{
+			AccessToken:  latest.Credentials.AccessToken,
+			RefreshToken: latest.Credentials.RefreshToken,
+			ExpiresAt:    *latest.ExpiresAt,
+		}, nil
+	}
+
+	token, err := s.exchangeRefreshToken(latest.Credentials.RefreshToken)
+	if errors.Is(err, ErrInvalidGrant) {
+		return s.recoverInvalidGrant(latest)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	latest.Credentials.AccessToken = token.AccessToken
+	latest.Credentials.RefreshToken = token.RefreshToken
+	latest.ExpiresAt = &token.ExpiresAt
+	if err := s.store.UpdateAccount(latest); err != nil {
+		return nil, fmt.Errorf("failed to update account: %w", err)
+	}
+
+	log.Info().Str("account_id", account.ID).Time("expires_at", token.ExpiresAt).Msg("token refreshed successfully")
+	return token, nil
+}
+
+// exchangeRefreshToken trades a refresh token for a new access token. The
+// returned error wraps ErrInvalidGrant when the refresh token is dead.
+func (s *OAuthService) exchangeRefreshToken(refreshToken string) (*refreshedToken, error) {
 	client := createReqClient("")
 
 	reqBody := map[string]interface{}{
 		"grant_type":    "refresh_token",
-		"refresh_token": account.Credentials.RefreshToken,
+		"refresh_token": refreshToken,
 		"client_id":     OAuthClientID,
 	}
 
@@ -379,27 +492,98 @@ func (s *OAuthService) RefreshAccountToken(account *store.Account) error {
 		Post(OAuthTokenURL)
 
 	if err != nil {
-		return fmt.Errorf("request failed: %w", err)
+		return nil, fmt.Errorf("request failed: %w", err)
 	}
 
 	if !resp.IsSuccessState() {
-		return fmt.Errorf("token refresh failed: status %d, body: %s", resp.StatusCode, resp.String())
+		if isInvalidGrant(resp.StatusCode, resp.String()) {
+			return nil, ErrInvalidGrant
+		}
+		return nil, fmt.Errorf("token refresh failed: status %d, body: %s", resp.StatusCode, resp.String())
 	}
 
-	// Update account credentials
-	account.Credentials.AccessToken = tokenResp.AccessToken
+	token := &refreshedToken{
+		AccessToken:  tokenResp.AccessToken,
+		RefreshToken: refreshToken,
+		ExpiresAt:    time.Now().Add(time.Duration(tokenResp.ExpiresIn) * time.Second),
+	}
+	// Refresh tokens rotate; keep the old one only if no new one was issued
 	if tokenResp.RefreshToken != "" {
-		account.Credentials.RefreshToken = tokenResp.RefreshToken
+		token.RefreshToken = tokenResp.RefreshToken
 	}
-	expiresAt := time.Now().Add(time.Duration(tokenResp.ExpiresIn) * time.Second)
-	account.ExpiresAt = &expiresAt
+	return token, nil
+}
+
+// invalidateSessions drops the sticky sessions bound to an account
+func (s *OAuthService) invalidateSessions(accountID string) {
+	if s.sticky != nil {
+		s.sticky.InvalidateAccount(accountID)
+	}
+}
 
+// isInvalidGrant reports whether a token endpoint error means the refresh token is dead
+func isInvalidGrant(statusCode int, body string) bool {
+	return (statusCode == http.StatusBadRequest || statusCode == http.StatusUnauthorized) &&
+		strings.Contains(body, "invalid_grant")
+}
+
+// recoverInvalidGrant quarantines an account whose refresh token was rejected and
+// tries to mint new tokens from its stored session key
+func (s *OAuthService) recoverInvalidGrant(account *store.Account) (*refreshedToken, error) {
+	log.Warn().Str("account_id", account.ID).Msg("refresh token rejected, account needs re-auth")
+	if err := s.store.UpdateAccountStatus(account.ID, store.AccountStatusNeedsReauth, ErrInvalidGrant.Error()); err != nil {
+		log.Error().Err(err).Str("account_id", account.ID).Msg("failed to mark account as needs_reauth")
+	}
+
+	if account.Credentials.SessionKey == "" {
+		s.invalidateSessions(account.ID)
+		s.notifier.Notify(notify.Event{
+			Type:      notify.EventAccountNeedsReauth,
+			Severity:  notify.SeverityCritical,
+			AccountID: account.ID,
+			Message:   fmt.Sprintf("account %s: refresh token rejected and no session key stored, manual re-login required", account.Name),
+		})
+		return nil, ErrInvalidGrant
+	}
+
+	result, err := s.authorize(account.Credentials.SessionKey, "")
+	if err != nil {
+		log.Error().Err(err).Str("account_id", account.ID).Msg("automatic re-login failed")
+		s.invalidateSessions(account.ID)
+		s.notifier.Notify(notify.Event{
+			Type:      notify.EventAccountNeedsReauth,
+			Severity:  notify.SeverityCritical,
+			AccountID: account.ID,
+			Message:   fmt.Sprintf("account %s: refresh token rejected and automatic re-login failed, manual re-login required", account.Name),
+			Details:   map[string]interface{}{"error": err.Error()},
+		})
+		return nil, fmt.Errorf("%w; re-login failed: %v", ErrInvalidGrant, err)
+	}
+
+	account.OrganizationID = result.OrganizationID
+	account.Credentials.AccessToken = result.AccessToken
+	account.Credentials.RefreshToken = result.RefreshToken
+	account.ExpiresAt = &result.ExpiresAt
 	if err := s.store.UpdateAccount(account); err != nil {
-		return fmt.Errorf("failed to update account: %w", err)
+		return nil, fmt.Errorf("failed to update account: %w", err)
+	}
+	if err := s.store.UpdateAccountStatus(account.ID, store.AccountStatusActive, ""); err != nil {
+		log.Error().Err(err).Str("account_id", account.ID).Msg("failed to reactivate account")
 	}
 
-	log.Info().Str("account_id", account.ID).Time("expires_at", expiresAt).Msg("token refreshed successfully")
-	return nil
+	log.Info().Str("account_id", account.ID).Time("expires_at", result.ExpiresAt).Msg("account re-authenticated from stored session key")
+	s.notifier.Notify(notify.Event{
+		Type:      notify.EventAccountReauthenticated,
+		Severity:  notify.SeverityInfo,
+		AccountID: account.ID,
+		Message:   fmt.Sprintf("account %s: refresh token was rejected, re-authenticated from stored session key", account.Name),
+	})
+
+	return &refreshedToken{
+		AccessToken:  result.AccessToken,
+		RefreshToken: result.RefreshToken,
+		ExpiresAt:    result.ExpiresAt,
+	}, nil
 }
 
 // RefreshToken refreshes an OAuth token by account ID (implements health.TokenRefresher)
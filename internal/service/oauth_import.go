@@ -0,0 +1,128 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"ccproxy/internal/store"
+)
+
+// ImportRequest imports existing OAuth credentials without a session key
+type ImportRequest struct {
+	Name           string          `json:"name" binding:"required"`
+	AccessToken    string          `json:"access_token"`
+	RefreshToken   string          `json:"refresh_token" binding:"required"`
+	ExpiresAt      json.RawMessage `json:"expires_at,omitempty"` // RFC3339 string or unix seconds/milliseconds
+	OrganizationID string          `json:"org_id"`
+	SkipValidation bool            `json:"skip_validation"` // Skip the test call to the API
+}
+
+// ImportAccount creates an OAuth account from credentials issued elsewhere.
+// Tokens that are missing, expiring or of unknown lifetime are refreshed first,
+// then the access token is validated with a minimal API call.
+func (s *OAuthService) ImportAccount(req ImportRequest) (*store.Account, error) {
+	expiresAt, err := parseImportExpiresAt(req.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	account := &store.Account{
+		ID:             generateAccountID(),
+		Name:           req.Name,
+		Type:           store.AccountTypeOAuth,
+		OrganizationID: strings.TrimSpace(req.OrganizationID),
+		Credentials: store.Credentials{
+			AccessToken:  strings.TrimSpace(req.AccessToken),
+			RefreshToken: strings.TrimSpace(req.RefreshToken),
+		},
+		ExpiresAt:    expiresAt,
+		CreatedAt:    time.Now(),
+		IsActive:     true,
+		HealthStatus: "healthy",
+	}
+
+	if account.Credentials.AccessToken == "" || account.ExpiresAt == nil || account.NeedsRefresh() {
+		token, err := s.exchangeRefreshToken(account.Credentials.RefreshToken)
+		if err != nil {
+			return nil, fmt.Errorf("failed to refresh imported token: %w", err)
+		}
+		account.Credentials.AccessToken = token.AccessToken
+		account.Credentials.RefreshToken = token.RefreshToken
+		account.ExpiresAt = &token.ExpiresAt
+	}
+
+	if !req.SkipValidation {
+		if err := s.validateAccessToken(account.Credentials.AccessToken); err != nil {
+			return nil, fmt.Errorf("imported token failed validation: %w", err)
+		}
+	}
+
+	if err := s.store.CreateAccount(account); err != nil {
+		return nil, fmt.Errorf("failed to save account: %w", err)
+	}
+
+	log.Info().Str("account_id", account.ID).Time("expires_at", *account.ExpiresAt).Msg("OAuth credentials imported")
+	return account, nil
+}
+
+// validateAccessToken sends a minimal request to check the token is accepted.
+// Rate limited or overloaded responses still prove the token is valid.
+func (s *OAuthService) validateAccessToken(accessToken string) error {
+	client := createReqClient("")
+
+	payload := map[string]interface{}{
+		"model":      "claude-3-5-haiku-20241022",
+		"max_tokens": 1,
+		"messages": []map[string]string{
+			{"role": "user", "content": "hi"},
+		},
+	}
+
+	resp, err := client.R().
+		SetHeader("Content-Type", "application/json").
+		SetHeader("anthropic-version", "2023-06-01").
+		SetHeader("anthropic-beta", OAuthBetaFlag).
+		SetHeader("Authorization", "Bearer "+accessToken).
+		SetBody(payload).
+		Post(s.apiURL + "/v1/messages")
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300, resp.StatusCode == 429, resp.StatusCode == 529:
+		return nil
+	default:
+		return fmt.Errorf("status %d: %s", resp.StatusCode, resp.String())
+	}
+}
+
+// parseImportExpiresAt accepts an RFC3339 string or a unix timestamp in
+// seconds or milliseconds (as stored by Claude Code's credentials file)
+func parseImportExpiresAt(raw json.RawMessage) (*time.Time, error) {
+	value := strings.Trim(strings.TrimSpace(string(raw)), `"`)
+	if value == "" || value == "null" {
+		return nil, nil
+	}
+
+	if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+		var t time.Time
+		if n > 1e12 {
+			t = time.UnixMilli(n)
+		} else {
+			t = time.Unix(n, 0)
+		}
+		return &t, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid expires_at %q: use RFC3339 or a unix timestamp", value)
+	}
+	return &t, nil
+}
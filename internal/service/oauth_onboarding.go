@@ -0,0 +1,166 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"ccproxy/internal/jobs"
+)
+
+// OnboardingJobType is the job type of OAuth account logins
+const OnboardingJobType = "oauth_onboarding"
+
+const (
+	// onboardingMaxAttempts bounds the attempts of a login
+	onboardingMaxAttempts = 3
+	// onboardingRetryDelay is the wait before the second attempt of a login,
+	// doubled for each further attempt
+	onboardingRetryDelay = 2 * time.Second
+)
+
+// OAuth onboarding steps, in order
+const (
+	StepOrganization  = "organization"   // Look up the session's organization
+	StepAuthorize     = "authorize"      // Get an authorization code
+	StepTokenExchange = "token_exchange" // Exchange the code for tokens
+	StepSaveAccount   = "save_account"   // Store the account
+)
+
+// OnboardingRequest is the payload of an OAuth onboarding job
+type OnboardingRequest struct {
+	LoginRequest
+	TemplateID string `json:"template_id,omitempty"` // Account template applied to the new account
+}
+
+// OnboardingResult is the result of a succeeded OAuth onboarding job
+type OnboardingResult struct {
+	AccountID      string    `json:"account_id"`
+	OrganizationID string    `json:"organization_id"`
+	ExpiresAt      time.Time `json:"expires_at"` // Access token expiry
+}
+
+// onboardingFlow runs the OAuth login steps; tests replace it
+type onboardingFlow struct {
+	organization  func(sessionKey, proxyURL string) (string, error)
+	authorize     func(sessionKey, orgUUID, proxyURL string) (code, verifier, state string, err error)
+	exchange      func(code, verifier, state, proxyURL string) (*LoginResult, error)
+	save          func(req LoginRequest, result *LoginResult) error
+	applyTemplate func(accountID, templateID string) error
+}
+
+// RegisterOnboarding registers the OAuth onboarding job, which logs in
+// with a session key in the background so slow proxies do not time out the
+// admin request. A login failing with a network error, 429 or 5xx response
+// is attempted again from the start, which also gets a fresh single-use
+// authorization code.
+func (s *OAuthService) RegisterOnboarding(queue *jobs.Queue) {
+	queue.Register(OnboardingJobType, onboardingFlow{
+		organization:  s.getOrganizationUUID,
+		authorize:     s.getAuthorizationCode,
+		exchange:      s.exchangeToken,
+		save:          s.saveLoginAccount,
+		applyTemplate: s.applyAccountTemplate,
+	}.run, onboardingOptions())
+}
+
+func onboardingOptions() jobs.Options {
+	return jobs.Options{
+		MaxAttempts: onboardingMaxAttempts,
+		RetryDelay:  onboardingRetryDelay,
+		Steps:       []string{StepOrganization, StepAuthorize, StepTokenExchange, StepSaveAccount},
+	}
+}
+
+// run performs the login steps of an onboarding job
+func (f onboardingFlow) run(ctx context.Context, task *jobs.Task) error {
+	var req OnboardingRequest
+	if err := task.Decode(&req); err != nil {
+		return err
+	}
+
+	var orgUUID string
+	if err := task.Step(StepOrganization, func() (err error) {
+		orgUUID, err = f.organization(req.SessionKey, req.ProxyURL)
+		return err
+	}); err != nil {
+		return onboardingError(ctx, err)
+	}
+
+	var code, verifier, state string
+	if err := task.Step(StepAuthorize, func() (err error) {
+		code, verifier, state, err = f.authorize(req.SessionKey, orgUUID, req.ProxyURL)
+		return err
+	}); err != nil {
+		return onboardingError(ctx, err)
+	}
+
+	var result *LoginResult
+	if err := task.Step(StepTokenExchange, func() (err error) {
+		result, err = f.exchange(code, verifier, state, req.ProxyURL)
+		return err
+	}); err != nil {
+		return onboardingError(ctx, err)
+	}
+	result.OrganizationID = orgUUID
+
+	// Storing is local, and the tokens are spent; a failure is not retried
+	if err := task.Step(StepSaveAccount, func() error {
+		if err := f.save(req.LoginRequest, result); err != nil {
+			return err
+		}
+		if req.TemplateID != "" {
+			if err := f.applyTemplate(result.AccountID, req.TemplateID); err != nil {
+				log.Error().Err(err).Str("account_id", result.AccountID).Str("template", req.TemplateID).Msg("failed to apply account template")
+			}
+		}
+		return nil
+	}); err != nil {
+		return jobs.Permanent(err)
+	}
+
+	return task.SetResult(OnboardingResult{
+		AccountID:      result.AccountID,
+		OrganizationID: result.OrganizationID,
+		ExpiresAt:      result.ExpiresAt,
+	})
+}
+
+// onboardingError marks errors that another attempt cannot fix
+func onboardingError(ctx context.Context, err error) error {
+	if ctx.Err() != nil || retryableOAuthError(err) {
+		return err
+	}
+	return jobs.Permanent(err)
+}
+
+// retryableOAuthError reports whether an OAuth step failed transiently: a
+// network error or timeout, or a 429 or 5xx response
+func retryableOAuthError(err error) bool {
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var statusErr *oauthStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == http.StatusTooManyRequests || statusErr.StatusCode >= 500
+	}
+	return false
+}
+
+// applyAccountTemplate copies a template's settings to an account
+func (s *OAuthService) applyAccountTemplate(accountID, templateID string) error {
+	template, err := s.store.GetAccountTemplate(templateID)
+	if err != nil {
+		return err
+	}
+	if template == nil {
+		return errors.New("account template not found")
+	}
+	settings := template.AccountSettings
+	return s.store.UpdateAccountSettings(accountID, &settings)
+}
@@ -0,0 +1,213 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"ccproxy/internal/jobs"
+	"ccproxy/internal/store"
+)
+
+// fakeOnboarding scripts the errors of each login step; a step succeeds
+// once its errors run out
+type fakeOnboarding struct {
+	mu        sync.Mutex
+	errs      map[string][]error
+	calls     map[string]int
+	codes     []string
+	templates []string
+}
+
+func (f *fakeOnboarding) next(step string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls[step]++
+	if errs := f.errs[step]; len(errs) > 0 {
+		f.errs[step] = errs[1:]
+		return errs[0]
+	}
+	return nil
+}
+
+func (f *fakeOnboarding) flow() onboardingFlow {
+	return onboardingFlow{
+		organization: func(sessionKey, proxyURL string) (string, error) {
+			return "org-1", f.next(StepOrganization)
+		},
+		authorize: func(sessionKey, orgUUID, proxyURL string) (string, string, string, error) {
+			err := f.next(StepAuthorize)
+			f.mu.Lock()
+			code := fmt.Sprintf("code-%d", f.calls[StepAuthorize])
+			f.mu.Unlock()
+			return code, "verifier", "state", err
+		},
+		exchange: func(code, verifier, state, proxyURL string) (*LoginResult, error) {
+			f.mu.Lock()
+			f.codes = append(f.codes, code)
+			f.mu.Unlock()
+			if err := f.next(StepTokenExchange); err != nil {
+				return nil, err
+			}
+			return &LoginResult{AccessToken: "access", ExpiresAt: time.Now().Add(time.Hour)}, nil
+		},
+		save: func(req LoginRequest, result *LoginResult) error {
+			if err := f.next(StepSaveAccount); err != nil {
+				return err
+			}
+			result.AccountID = "acc-" + req.Name
+			return nil
+		},
+		applyTemplate: func(accountID, templateID string) error {
+			f.mu.Lock()
+			defer f.mu.Unlock()
+			f.templates = append(f.templates, accountID+":"+templateID)
+			return nil
+		},
+	}
+}
+
+func TestOnboardingJob(t *testing.T) {
+	unavailable := &oauthStatusError{StatusCode: 503, Body: "overloaded"}
+	forbidden := &oauthStatusError{StatusCode: 403, Body: "invalid session"}
+
+	tests := []struct {
+		name       string
+		errs       map[string][]error
+		wantStatus string
+		wantCalls  map[string]int
+		wantCodes  []string
+	}{
+		{
+			name:       "success",
+			wantStatus: store.JobSucceeded,
+			wantCalls:  map[string]int{StepOrganization: 1, StepAuthorize: 1, StepTokenExchange: 1, StepSaveAccount: 1},
+			wantCodes:  []string{"code-1"},
+		},
+		{
+			name:       "server errors retried",
+			errs:       map[string][]error{StepOrganization: {unavailable, unavailable}},
+			wantStatus: store.JobSucceeded,
+			wantCalls:  map[string]int{StepOrganization: 3, StepAuthorize: 1},
+		},
+		{
+			name:       "client error not retried",
+			errs:       map[string][]error{StepAuthorize: {forbidden}},
+			wantStatus: store.JobFailed,
+			wantCalls:  map[string]int{StepAuthorize: 1, StepTokenExchange: 0},
+		},
+		{
+			name:       "attempts bounded",
+			errs:       map[string][]error{StepOrganization: {unavailable, unavailable, unavailable, unavailable}},
+			wantStatus: store.JobFailed,
+			wantCalls:  map[string]int{StepOrganization: onboardingMaxAttempts},
+		},
+		{
+			name:       "failed exchange gets a fresh code",
+			errs:       map[string][]error{StepTokenExchange: {unavailable}},
+			wantStatus: store.JobSucceeded,
+			wantCalls:  map[string]int{StepAuthorize: 2, StepTokenExchange: 2},
+			wantCodes:  []string{"code-1", "code-2"},
+		},
+		{
+			name:       "save failure not retried",
+			errs:       map[string][]error{StepSaveAccount: {unavailable}},
+			wantStatus: store.JobFailed,
+			wantCalls:  map[string]int{StepSaveAccount: 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, err := store.New(filepath.Join(t.TempDir(), "test.db"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			fake := &fakeOnboarding{errs: tt.errs, calls: map[string]int{}}
+			q := jobs.New(db, jobs.Config{Workers: 1, PollInterval: 5 * time.Millisecond})
+			opts := onboardingOptions()
+			opts.RetryDelay = time.Millisecond
+			q.Register(OnboardingJobType, fake.flow().run, opts)
+			if err := q.Start(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			defer q.Stop()
+
+			job, err := q.Enqueue(OnboardingJobType, OnboardingRequest{
+				LoginRequest: LoginRequest{Name: "alice", SessionKey: "sk-ant-sid01-x"},
+				TemplateID:   "tpl-1",
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(job.Steps) != 4 {
+				t.Fatalf("queued steps = %+v", job.Steps)
+			}
+
+			deadline := time.Now().Add(5 * time.Second)
+			for !job.Finished() && time.Now().Before(deadline) {
+				time.Sleep(5 * time.Millisecond)
+				if job, err = q.Get(job.ID); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if job.Status != tt.wantStatus {
+				t.Fatalf("status = %s (%s), want %s", job.Status, job.Error, tt.wantStatus)
+			}
+
+			fake.mu.Lock()
+			defer fake.mu.Unlock()
+			for step, want := range tt.wantCalls {
+				if got := fake.calls[step]; got != want {
+					t.Errorf("%s calls = %d, want %d", step, got, want)
+				}
+			}
+			if tt.wantCodes != nil && fmt.Sprint(fake.codes) != fmt.Sprint(tt.wantCodes) {
+				t.Errorf("exchanged codes = %v, want %v", fake.codes, tt.wantCodes)
+			}
+
+			if tt.wantStatus == store.JobSucceeded {
+				var result OnboardingResult
+				if err := json.Unmarshal(job.Result, &result); err != nil {
+					t.Fatal(err)
+				}
+				if result.AccountID != "acc-alice" || result.OrganizationID != "org-1" {
+					t.Errorf("result = %+v", result)
+				}
+				if len(fake.templates) != 1 || fake.templates[0] != "acc-alice:tpl-1" {
+					t.Errorf("templates applied = %v", fake.templates)
+				}
+				for _, step := range job.Steps {
+					if step.Status != store.JobSucceeded {
+						t.Errorf("step %s = %s", step.Name, step.Status)
+					}
+				}
+			} else if job.Error == "" || len(job.Result) != 0 {
+				t.Errorf("failed job = %+v", job)
+			}
+		})
+	}
+}
+
+func TestRetryableOAuthError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{fmt.Errorf("wrapped: %w", &oauthStatusError{StatusCode: 429}), true},
+		{&oauthStatusError{StatusCode: 502}, true},
+		{&oauthStatusError{StatusCode: 401}, false},
+		{fmt.Errorf("timeout: %w", context.DeadlineExceeded), true},
+		{fmt.Errorf("no organizations found"), false},
+	}
+	for _, tt := range tests {
+		if got := retryableOAuthError(tt.err); got != tt.want {
+			t.Errorf("retryableOAuthError(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package service
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestIsInvalidGrant(t *testing.T) {
+	tests := []struct {
+		status int
+		body   string
+		want   bool
+	}{
+		{400, `{"error":"invalid_grant","error_description":"Refresh token not found or invalid"}`, true},
+		{401, `{"error":"invalid_grant"}`, true},
+		{400, `{"error":"invalid_request"}`, false},
+		{500, `invalid_grant`, false},
+		{429, `{"error":"rate_limited"}`, false},
+	}
+	for _, tt := range tests {
+		if got := isInvalidGrant(tt.status, tt.body); got != tt.want {
+			t.Errorf("isInvalidGrant(%d, %q) = %v, want %v", tt.status, tt.body, got, tt.want)
+		}
+	}
+}
+
+func TestParseImportExpiresAt(t *testing.T) {
+	want := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		raw  string
+		want *time.Time
+	}{
+		{`"2025-06-01T12:00:00Z"`, &want},
+		{`1748779200`, &want},
+		{`1748779200000`, &want},
+		{`"1748779200000"`, &want},
+		{``, nil},
+		{`null`, nil},
+	}
+	for _, tt := range tests {
+		got, err := parseImportExpiresAt(json.RawMessage(tt.raw))
+		if err != nil {
+			t.Errorf("parseImportExpiresAt(%s): %v", tt.raw, err)
+			continue
+		}
+		if (got == nil) != (tt.want == nil) || (got != nil && !got.Equal(*tt.want)) {
+			t.Errorf("parseImportExpiresAt(%s) = %v, want %v", tt.raw, got, tt.want)
+		}
+	}
+
+	if _, err := parseImportExpiresAt(json.RawMessage(`"tomorrow"`)); err == nil {
+		t.Error("expected error for invalid expires_at")
+	}
+}
@@ -0,0 +1,316 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// oidcLoginTTL bounds how long a started login may take to come back
+	oidcLoginTTL = 10 * time.Minute
+)
+
+var (
+	ErrOIDCInvalidState = errors.New("unknown or expired login state")
+	ErrOIDCNoRole       = errors.New("identity is not mapped to an admin role")
+)
+
+// OIDCRoleMapping grants Role to members of Group
+type OIDCRoleMapping struct {
+	Group string
+	Role  string
+}
+
+// OIDCConfig configures admin sign-in through an OpenID Connect provider
+type OIDCConfig struct {
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	GroupsClaim  string // Claim holding group names; dotted paths such as "realm_access.roles" are supported
+	RoleMappings []OIDCRoleMapping
+	DefaultRole  string // Role for identities matching no mapping; empty denies access
+	Timeout      time.Duration
+}
+
+// OIDCIdentity is an administrator authenticated by the provider
+type OIDCIdentity struct {
+	Subject string   `json:"sub"`
+	Email   string   `json:"email,omitempty"`
+	Name    string   `json:"name,omitempty"`
+	Groups  []string `json:"groups,omitempty"`
+	Role    string   `json:"role"`
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type oidcPendingLogin struct {
+	nonce     string
+	verifier  string
+	expiresAt time.Time
+}
+
+// OIDCProvider runs the authorization code flow (with PKCE) against an
+// OpenID Connect provider and maps the resulting identity to an admin role
+type OIDCProvider struct {
+	cfg    OIDCConfig
+	client *http.Client
+	now    func() time.Time
+
+	keys *jwksCache
+
+	mu        sync.Mutex
+	discovery *oidcDiscovery
+	pending   map[string]oidcPendingLogin
+}
+
+// NewOIDCProvider creates a provider; discovery happens on first use
+func NewOIDCProvider(cfg OIDCConfig) *OIDCProvider {
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid", "profile", "email"}
+	}
+	if cfg.GroupsClaim == "" {
+		cfg.GroupsClaim = "groups"
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	cfg.IssuerURL = strings.TrimSuffix(cfg.IssuerURL, "/")
+
+	client := &http.Client{Timeout: cfg.Timeout}
+	return &OIDCProvider{
+		cfg:     cfg,
+		client:  client,
+		now:     time.Now,
+		keys:    newJWKSCache(client),
+		pending: make(map[string]oidcPendingLogin),
+	}
+}
+
+// AuthURL starts a login and returns the provider URL to redirect the browser to
+func (p *OIDCProvider) AuthURL(ctx context.Context) (string, error) {
+	disc, err := p.getDiscovery(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	state, err := generateState()
+	if err != nil {
+		return "", err
+	}
+	nonce, err := generateState()
+	if err != nil {
+		return "", err
+	}
+	verifier, err := generateCodeVerifier()
+	if err != nil {
+		return "", err
+	}
+
+	p.mu.Lock()
+	now := p.now()
+	for s, login := range p.pending {
+		if now.After(login.expiresAt) {
+			delete(p.pending, s)
+		}
+	}
+	p.pending[state] = oidcPendingLogin{nonce: nonce, verifier: verifier, expiresAt: now.Add(oidcLoginTTL)}
+	p.mu.Unlock()
+
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.cfg.ClientID},
+		"redirect_uri":          {p.cfg.RedirectURL},
+		"scope":                 {strings.Join(p.cfg.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {generateCodeChallenge(verifier)},
+		"code_challenge_method": {"S256"},
+	}
+	sep := "?"
+	if strings.Contains(disc.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return disc.AuthorizationEndpoint + sep + params.Encode(), nil
+}
+
+// Exchange completes a login: it redeems the authorization code, verifies the
+// ID token and maps the identity to a role
+func (p *OIDCProvider) Exchange(ctx context.Context, code, state string) (*OIDCIdentity, error) {
+	p.mu.Lock()
+	login, ok := p.pending[state]
+	delete(p.pending, state)
+	p.mu.Unlock()
+	if !ok || p.now().After(login.expiresAt) {
+		return nil, ErrOIDCInvalidState
+	}
+
+	disc, err := p.getDiscovery(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"client_id":     {p.cfg.ClientID},
+		"code_verifier": {login.verifier},
+	}
+	if p.cfg.ClientSecret != "" {
+		form.Set("client_secret", p.cfg.ClientSecret)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, disc.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token endpoint returned status %d: %s", resp.StatusCode, truncateBody(body, 200))
+	}
+
+	var tokens struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.Unmarshal(body, &tokens); err != nil {
+		return nil, fmt.Errorf("failed to parse token response: %w", err)
+	}
+	if tokens.IDToken == "" {
+		return nil, errors.New("token response has no id_token")
+	}
+
+	claims, err := p.verifyIDToken(ctx, disc, tokens.IDToken)
+	if err != nil {
+		return nil, err
+	}
+	if nonce, _ := claims["nonce"].(string); nonce != login.nonce {
+		return nil, errors.New("id_token nonce mismatch")
+	}
+
+	identity := &OIDCIdentity{
+		Subject: stringClaim(claims, "sub"),
+		Email:   stringClaim(claims, "email"),
+		Name:    stringClaim(claims, "name"),
+		Groups:  groupsClaim(claims, p.cfg.GroupsClaim),
+	}
+	identity.Role = p.mapRole(identity.Groups)
+	if identity.Role == "" {
+		return identity, ErrOIDCNoRole
+	}
+	return identity, nil
+}
+
+// mapRole returns the role of the first mapping matching one of groups
+func (p *OIDCProvider) mapRole(groups []string) string {
+	for _, m := range p.cfg.RoleMappings {
+		for _, g := range groups {
+			if g == m.Group {
+				return m.Role
+			}
+		}
+	}
+	return p.cfg.DefaultRole
+}
+
+func (p *OIDCProvider) verifyIDToken(ctx context.Context, disc *oidcDiscovery, idToken string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(idToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.keys.key(ctx, disc.JWKSURI, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}),
+		jwt.WithIssuer(disc.Issuer),
+		jwt.WithAudience(p.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid id_token: %w", err)
+	}
+	return claims, nil
+}
+
+func (p *OIDCProvider) getDiscovery(ctx context.Context) (*oidcDiscovery, error) {
+	p.mu.Lock()
+	disc := p.discovery
+	p.mu.Unlock()
+	if disc != nil {
+		return disc, nil
+	}
+
+	disc = &oidcDiscovery{}
+	if err := p.getJSON(ctx, p.cfg.IssuerURL+"/.well-known/openid-configuration", disc); err != nil {
+		return nil, fmt.Errorf("oidc discovery failed: %w", err)
+	}
+	if strings.TrimSuffix(disc.Issuer, "/") != p.cfg.IssuerURL {
+		return nil, fmt.Errorf("oidc discovery issuer %q does not match %q", disc.Issuer, p.cfg.IssuerURL)
+	}
+	if disc.AuthorizationEndpoint == "" || disc.TokenEndpoint == "" || disc.JWKSURI == "" {
+		return nil, errors.New("oidc discovery document is incomplete")
+	}
+
+	p.mu.Lock()
+	p.discovery = disc
+	p.mu.Unlock()
+	return disc, nil
+}
+
+func (p *OIDCProvider) getJSON(ctx context.Context, endpoint string, v interface{}) error {
+	return getJSON(ctx, p.client, endpoint, v)
+}
+
+func stringClaim(claims jwt.MapClaims, name string) string {
+	s, _ := claims[name].(string)
+	return s
+}
+
+// groupsClaim reads a list of group names; path may descend into nested
+// objects with dots, and a single string is treated as one group
+func groupsClaim(claims jwt.MapClaims, path string) []string {
+	var value interface{} = map[string]interface{}(claims)
+	for _, part := range strings.Split(path, ".") {
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = obj[part]
+	}
+
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		groups := make([]string, 0, len(v))
+		for _, g := range v {
+			if s, ok := g.(string); ok {
+				groups = append(groups, s)
+			}
+		}
+		return groups
+	}
+	return nil
+}
@@ -0,0 +1,207 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// fakeIdP is a minimal OpenID Connect provider
+type fakeIdP struct {
+	t      *testing.T
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	claims jwt.MapClaims // extra ID token claims
+	nonce  string
+}
+
+func newFakeIdP(t *testing.T) *fakeIdP {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &fakeIdP{t: t, key: key, claims: jwt.MapClaims{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.server.URL,
+			"authorization_endpoint": idp.server.URL + "/authorize",
+			"token_endpoint":         idp.server.URL + "/token",
+			"jwks_uri":               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "key-1",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("code") != "good-code" || r.Form.Get("code_verifier") == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+		claims := jwt.MapClaims{
+			"iss":   idp.server.URL,
+			"aud":   "ccproxy",
+			"sub":   "user-1",
+			"email": "alice@example.com",
+			"nonce": idp.nonce,
+			"exp":   time.Now().Add(time.Hour).Unix(),
+			"iat":   time.Now().Unix(),
+		}
+		for k, v := range idp.claims {
+			claims[k] = v
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = "key-1"
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Error(err)
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": signed, "token_type": "Bearer"})
+	})
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+// start begins a login and returns its state, remembering the nonce
+func (idp *fakeIdP) start(p *OIDCProvider) string {
+	idp.t.Helper()
+	authURL, err := p.AuthURL(context.Background())
+	if err != nil {
+		idp.t.Fatal(err)
+	}
+	u, err := url.Parse(authURL)
+	if err != nil {
+		idp.t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("code_challenge_method") != "S256" || q.Get("client_id") != "ccproxy" {
+		idp.t.Fatalf("unexpected auth URL %s", authURL)
+	}
+	idp.nonce = q.Get("nonce")
+	return q.Get("state")
+}
+
+func newTestOIDCProvider(idp *fakeIdP, groupsClaim, defaultRole string) *OIDCProvider {
+	return NewOIDCProvider(OIDCConfig{
+		IssuerURL:   idp.server.URL,
+		ClientID:    "ccproxy",
+		RedirectURL: "https://ccproxy.example.com/api/auth/oidc/callback",
+		GroupsClaim: groupsClaim,
+		RoleMappings: []OIDCRoleMapping{
+			{Group: "ccproxy-admins", Role: "admin"},
+			{Group: "ccproxy-viewers", Role: "viewer"},
+		},
+		DefaultRole: defaultRole,
+	})
+}
+
+func TestOIDCProvider_MapsGroupsToRole(t *testing.T) {
+	idp := newFakeIdP(t)
+	idp.claims["groups"] = []string{"engineering", "ccproxy-viewers"}
+	p := newTestOIDCProvider(idp, "", "")
+
+	state := idp.start(p)
+	identity, err := p.Exchange(context.Background(), "good-code", state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.Subject != "user-1" || identity.Email != "alice@example.com" || identity.Role != "viewer" {
+		t.Errorf("unexpected identity: %+v", identity)
+	}
+
+	// State is single use
+	if _, err := p.Exchange(context.Background(), "good-code", state); !errors.Is(err, ErrOIDCInvalidState) {
+		t.Errorf("replayed state: err = %v", err)
+	}
+}
+
+func TestOIDCProvider_NestedGroupsClaim(t *testing.T) {
+	idp := newFakeIdP(t)
+	idp.claims["realm_access"] = map[string]interface{}{"roles": []string{"ccproxy-admins"}}
+	p := newTestOIDCProvider(idp, "realm_access.roles", "")
+
+	identity, err := p.Exchange(context.Background(), "good-code", idp.start(p))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.Role != "admin" {
+		t.Errorf("role = %q, want admin", identity.Role)
+	}
+}
+
+func TestOIDCProvider_DeniesUnmappedUsers(t *testing.T) {
+	idp := newFakeIdP(t)
+	idp.claims["groups"] = []string{"engineering"}
+
+	p := newTestOIDCProvider(idp, "", "")
+	if _, err := p.Exchange(context.Background(), "good-code", idp.start(p)); !errors.Is(err, ErrOIDCNoRole) {
+		t.Errorf("err = %v, want ErrOIDCNoRole", err)
+	}
+
+	p = newTestOIDCProvider(idp, "", "viewer")
+	identity, err := p.Exchange(context.Background(), "good-code", idp.start(p))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.Role != "viewer" {
+		t.Errorf("role = %q, want default viewer", identity.Role)
+	}
+}
+
+func TestOIDCProvider_RejectsBadTokens(t *testing.T) {
+	idp := newFakeIdP(t)
+	idp.claims["groups"] = "ccproxy-admins"
+	p := newTestOIDCProvider(idp, "", "")
+
+	// Wrong audience
+	idp.claims["aud"] = "someone-else"
+	if _, err := p.Exchange(context.Background(), "good-code", idp.start(p)); err == nil {
+		t.Error("expected audience mismatch to fail")
+	}
+	delete(idp.claims, "aud")
+
+	// Nonce from another login
+	state := idp.start(p)
+	idp.nonce = "other-nonce"
+	if _, err := p.Exchange(context.Background(), "good-code", state); err == nil {
+		t.Error("expected nonce mismatch to fail")
+	}
+
+	// Rejected code
+	if _, err := p.Exchange(context.Background(), "bad-code", idp.start(p)); err == nil {
+		t.Error("expected token endpoint error")
+	}
+
+	// A single string groups claim still maps
+	identity, err := p.Exchange(context.Background(), "good-code", idp.start(p))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.Role != "admin" {
+		t.Errorf("role = %q, want admin", identity.Role)
+	}
+}
@@ -0,0 +1,119 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"ccproxy/internal/store"
+)
+
+// DefaultRateWindowResetInterval is how often accounts are checked for a
+// passed reset time
+const DefaultRateWindowResetInterval = time.Minute
+
+// RateWindowResetter lifts the rate limits of accounts with a known reset
+// schedule once their window resets, instead of waiting for the next request
+// to find out the account works again
+type RateWindowResetter struct {
+	store    *store.Store
+	interval time.Duration
+	now      func() time.Time
+
+	mu      sync.Mutex
+	running bool
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+// NewRateWindowResetter creates a rate window resetter
+func NewRateWindowResetter(store *store.Store, interval time.Duration) *RateWindowResetter {
+	if interval <= 0 {
+		interval = DefaultRateWindowResetInterval
+	}
+	return &RateWindowResetter{
+		store:    store,
+		interval: interval,
+		now:      time.Now,
+	}
+}
+
+// Start lifts rate limits whose window already reset immediately and then
+// periodically
+func (r *RateWindowResetter) Start(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.running {
+		return nil
+	}
+
+	ctx, r.cancel = context.WithCancel(ctx)
+	r.running = true
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		r.ResetDue()
+
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				r.ResetDue()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	log.Info().Dur("interval", r.interval).Msg("Rate window resetter started")
+	return nil
+}
+
+// Stop stops the rate window resetter
+func (r *RateWindowResetter) Stop() {
+	r.mu.Lock()
+	if !r.running {
+		r.mu.Unlock()
+		return
+	}
+	r.running = false
+	r.mu.Unlock()
+
+	r.cancel()
+	r.wg.Wait()
+}
+
+// ResetDue lifts the rate limits that started before their account's most
+// recent reset and returns the IDs of those accounts
+func (r *RateWindowResetter) ResetDue() []string {
+	schedules, err := r.store.GetAccountResetSchedules()
+	if err != nil {
+		log.Error().Err(err).Msg("failed to load account reset schedules")
+		return nil
+	}
+
+	now := r.now()
+	var ids []string
+	for accountID, schedule := range schedules {
+		lastReset := schedule.LastReset(now)
+		if lastReset.IsZero() {
+			continue
+		}
+		cleared, err := r.store.ClearAccountRateLimit(accountID, lastReset)
+		if err != nil {
+			log.Error().Err(err).Str("account_id", accountID).Msg("failed to clear account rate limit")
+			continue
+		}
+		if cleared {
+			log.Info().Str("account_id", accountID).Time("reset_at", lastReset).Msg("account rate window reset, rate limit cleared")
+			ids = append(ids, accountID)
+		}
+	}
+	return ids
+}
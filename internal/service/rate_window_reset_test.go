@@ -0,0 +1,125 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"ccproxy/internal/store"
+)
+
+func TestResetSchedule_LastReset(t *testing.T) {
+	// Wednesday 2026-10-14 10:30 in New York
+	ny, _ := time.LoadLocation("America/New_York")
+	now := time.Date(2026, 10, 14, 10, 30, 0, 0, ny)
+
+	tests := []struct {
+		name   string
+		resets []string
+		want   time.Time
+	}{
+		{"midnight today", []string{"00:00"}, time.Date(2026, 10, 14, 0, 0, 0, 0, ny)},
+		{"later today is yesterday", []string{"11:00"}, time.Date(2026, 10, 13, 11, 0, 0, 0, ny)},
+		{"exactly now", []string{"10:30"}, now},
+		{"most recent of several", []string{"04:00", "09:00", "14:00"}, time.Date(2026, 10, 14, 9, 0, 0, 0, ny)},
+		{"weekly", []string{"Mon 00:00"}, time.Date(2026, 10, 12, 0, 0, 0, 0, ny)},
+		{"weekly later today is last week", []string{"wed 12:00"}, time.Date(2026, 10, 7, 12, 0, 0, 0, ny)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule := store.ResetSchedule{TimeZone: "America/New_York", Resets: tt.resets}
+			if err := schedule.Validate(); err != nil {
+				t.Fatal(err)
+			}
+			if got := schedule.LastReset(now); !got.Equal(tt.want) {
+				t.Errorf("LastReset = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResetSchedule_Validate(t *testing.T) {
+	tests := []struct {
+		name     string
+		schedule store.ResetSchedule
+		wantErr  bool
+	}{
+		{"daily", store.ResetSchedule{Resets: []string{"00:00"}}, false},
+		{"weekly", store.ResetSchedule{TimeZone: "Asia/Tokyo", Resets: []string{"Fri 09:00"}}, false},
+		{"no resets", store.ResetSchedule{}, true},
+		{"bad zone", store.ResetSchedule{TimeZone: "Mars/Olympus", Resets: []string{"00:00"}}, true},
+		{"bad clock", store.ResetSchedule{Resets: []string{"25:00"}}, true},
+		{"bad weekday", store.ResetSchedule{Resets: []string{"Someday 00:00"}}, true},
+		{"extra fields", store.ResetSchedule{Resets: []string{"Mon 00:00 UTC"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.schedule.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRateWindowResetter_ResetDue(t *testing.T) {
+	db := newSpendTestStore(t)
+	for _, id := range []string{"acc-1", "acc-2", "acc-3"} {
+		if err := db.CreateAccount(&store.Account{
+			ID:          id,
+			Name:        id,
+			Type:        store.AccountTypeSessionKey,
+			Credentials: store.Credentials{SessionKey: "sk-ant-sid01-" + id},
+			CreatedAt:   time.Now(),
+			IsActive:    true,
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.SetAccountRateLimit(id, time.Now().Add(5*time.Hour), "rate_limited"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// acc-1 resets soon, acc-2 has no schedule, acc-3 has a cf_challenge too
+	if err := db.SetAccountResetSchedule("acc-1", &store.ResetSchedule{Resets: []string{"00:00"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetAccountResetSchedule("acc-3", &store.ResetSchedule{Resets: []string{"00:00"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewRateWindowResetter(db, time.Minute)
+	if ids := r.ResetDue(); len(ids) != 0 {
+		t.Errorf("cleared before the reset: %v", ids)
+	}
+
+	if err := db.SetAccountTempUnschedulable("acc-3", time.Now().Add(time.Hour), "cf_challenge"); err != nil {
+		t.Fatal(err)
+	}
+
+	r.now = func() time.Time { return time.Now().UTC().Truncate(24 * time.Hour).Add(24*time.Hour + time.Minute) }
+	ids := r.ResetDue()
+	if len(ids) != 2 {
+		t.Fatalf("cleared = %v", ids)
+	}
+
+	accounts, err := db.ListAccountsWithStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	byID := make(map[string]*store.Account)
+	for _, a := range accounts {
+		byID[a.ID] = a
+	}
+	if a := byID["acc-1"]; a.RateLimitedAt != nil || a.TempUnschedulableUntil != nil || !a.IsSchedulable() {
+		t.Errorf("acc-1 still rate limited: %+v", a)
+	}
+	if a := byID["acc-2"]; a.RateLimitedAt == nil {
+		t.Error("acc-2 cleared without a reset schedule")
+	}
+	if a := byID["acc-3"]; a.RateLimitedAt != nil || a.TempUnschedulableReason != "cf_challenge" || a.IsSchedulable() {
+		t.Errorf("acc-3 lost its cf_challenge: %+v", a)
+	}
+
+	if ids := r.ResetDue(); len(ids) != 0 {
+		t.Errorf("cleared twice: %v", ids)
+	}
+}
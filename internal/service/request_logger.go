@@ -27,6 +27,9 @@ type RequestLogger struct {
 	cancel     context.CancelFunc
 	mu         sync.Mutex
 	running    bool
+	enrichers  []LogEnricher
+	sampler    *logSampler
+	convCap    *conversationCap
 }
 
 type LogEntry struct {
@@ -50,9 +53,35 @@ func NewRequestLogger(store *store.Store, bufferSize, workers int) *RequestLogge
 		workers:    workers,
 		batchSize:  DefaultBatchSize,
 		running:    false,
+		sampler:    newLogSampler(DefaultSamplingPolicy()),
+		convCap:    newConversationCap(DefaultConversationCapPolicy()),
 	}
 }
 
+// SetEnrichers sets the enrichers applied to entries before persistence.
+// Must be called before Start.
+func (rl *RequestLogger) SetEnrichers(enrichers []LogEnricher) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.enrichers = enrichers
+}
+
+// SetSamplingPolicy sets the policy deciding which entries are persisted.
+// Must be called before Start.
+func (rl *RequestLogger) SetSamplingPolicy(policy SamplingPolicy) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.sampler = newLogSampler(policy)
+}
+
+// SetConversationCap sets the policy bounding stored conversation sizes.
+// Must be called before Start.
+func (rl *RequestLogger) SetConversationCap(policy ConversationCapPolicy) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.convCap = newConversationCap(policy)
+}
+
 // Start starts the request logger workers
 func (rl *RequestLogger) Start(ctx context.Context) error {
 	rl.mu.Lock()
@@ -75,6 +104,8 @@ func (rl *RequestLogger) Start(ctx context.Context) error {
 		Int("buffer_size", rl.bufferSize).
 		Int("workers", rl.workers).
 		Int("batch_size", rl.batchSize).
+		Int("enrichers", len(rl.enrichers)).
+		Bool("sampling", rl.sampler.policy.Enabled).
 		Msg("Request logger started")
 
 	return nil
@@ -116,6 +147,10 @@ func (rl *RequestLogger) LogRequest(entry *LogEntry) error {
 		return nil
 	}
 
+	if !rl.sampler.keep(entry) {
+		return nil
+	}
+
 	select {
 	case rl.queue <- entry:
 		return nil
@@ -151,6 +186,8 @@ func (rl *RequestLogger) processQueue(workerID int) {
 				return
 			}
 
+			rl.enrich(entry)
+			rl.convCap.apply(entry.Conversation)
 			batch = append(batch, entry)
 
 			// Write batch when it reaches batch size
@@ -177,6 +214,20 @@ func (rl *RequestLogger) processQueue(workerID int) {
 	}
 }
 
+// enrich runs all configured enrichers on an entry, isolating enricher panics
+func (rl *RequestLogger) enrich(entry *LogEntry) {
+	for _, enricher := range rl.enrichers {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					log.Error().Interface("panic", r).Str("enricher", enricher.Name()).Msg("Log enricher panicked")
+				}
+			}()
+			enricher.Enrich(entry)
+		}()
+	}
+}
+
 // writeBatch writes a batch of log entries to the database
 func (rl *RequestLogger) writeBatch(entries []*LogEntry) {
 	if len(entries) == 0 {
@@ -229,8 +280,11 @@ func (rl *RequestLogger) batchInsertRequestLogs(logs []*store.RequestLog) error
 		id, token_id, account_id, user_name, mode, model, stream,
 		request_at, response_at, duration_ms, ttft_ms,
 		prompt_tokens, completion_tokens, total_tokens,
-		status_code, success, error_message, conversation_id
-	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+		status_code, success, error_message, conversation_id,
+		client_ip, user_agent, cost_usd, client_country, client_name,
+		upstream_request_id, trace_id, end_user_id, queue_wait_ms,
+		request_bytes, response_bytes, model_defaulted, truncated, sample_weight
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
 	if err != nil {
 		return err
 	}
@@ -242,6 +296,9 @@ func (rl *RequestLogger) batchInsertRequestLogs(logs []*store.RequestLog) error
 			reqLog.RequestAt, reqLog.ResponseAt, reqLog.DurationMs, reqLog.TTFTMs,
 			reqLog.PromptTokens, reqLog.CompletionTokens, reqLog.TotalTokens,
 			reqLog.StatusCode, reqLog.Success, reqLog.ErrorMessage, reqLog.ConversationID,
+			reqLog.ClientIP, reqLog.UserAgent, reqLog.CostUSD, reqLog.ClientCountry, reqLog.ClientName,
+			reqLog.UpstreamRequestID, reqLog.TraceID, reqLog.EndUserID, reqLog.QueueWaitMs,
+			reqLog.RequestBytes, reqLog.ResponseBytes, reqLog.ModelDefaulted, reqLog.Truncated, reqLog.Weight(),
 		)
 		if err != nil {
 			log.Error().Err(err).Str("log_id", reqLog.ID).Msg("Failed to insert request log")
@@ -262,8 +319,8 @@ func (rl *RequestLogger) batchInsertConversations(conversations []*store.Convers
 
 	stmt, err := tx.Prepare(`INSERT INTO conversation_contents (
 		id, request_log_id, token_id, system_prompt, messages_json,
-		prompt, completion, created_at, is_compressed
-	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+		prompt, completion, created_at, is_compressed, title, truncated_bytes, truncated
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
 	if err != nil {
 		return err
 	}
@@ -278,7 +335,7 @@ func (rl *RequestLogger) batchInsertConversations(conversations []*store.Convers
 	for _, conv := range conversations {
 		_, err = stmt.Exec(
 			conv.ID, conv.RequestLogID, conv.TokenID, conv.SystemPrompt, conv.MessagesJSON,
-			conv.Prompt, conv.Completion, conv.CreatedAt, conv.IsCompressed,
+			conv.Prompt, conv.Completion, conv.CreatedAt, conv.IsCompressed, conv.Title, conv.TruncatedBytes, conv.Truncated,
 		)
 		if err != nil {
 			log.Error().Err(err).Str("conv_id", conv.ID).Msg("Failed to insert conversation")
@@ -299,3 +356,13 @@ func (rl *RequestLogger) batchInsertConversations(conversations []*store.Convers
 func (rl *RequestLogger) GetQueueStatus() (size, capacity int) {
 	return len(rl.queue), rl.bufferSize
 }
+
+// GetSamplingStats returns request log sampling counters
+func (rl *RequestLogger) GetSamplingStats() SamplingStats {
+	return rl.sampler.stats()
+}
+
+// GetConversationCapStats returns conversation storage cap counters
+func (rl *RequestLogger) GetConversationCapStats() ConversationCapStats {
+	return rl.convCap.stats()
+}
@@ -0,0 +1,51 @@
+package service
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"ccproxy/internal/store"
+)
+
+func TestRequestLogger_WriteBatchKeepsAllColumns(t *testing.T) {
+	db := newSpendTestStore(t)
+	rl := NewRequestLogger(db, 10, 1)
+
+	now := time.Now()
+	rl.writeBatch([]*LogEntry{{Log: &store.RequestLog{
+		ID:                "log-1",
+		TokenID:           "tok-1",
+		Mode:              "api",
+		Model:             "claude-sonnet-4",
+		RequestAt:         now,
+		StatusCode:        200,
+		Success:           true,
+		UpstreamRequestID: sql.NullString{String: "req_123", Valid: true},
+		EndUserID:         sql.NullString{String: "user-7", Valid: true},
+		RequestBytes:      sql.NullInt64{Int64: 1200, Valid: true},
+		ResponseBytes:     sql.NullInt64{Int64: 3400, Valid: true},
+		SampleWeight:      4,
+	}}})
+
+	got, err := db.GetRequestLog("log-1")
+	if err != nil || got == nil {
+		t.Fatalf("GetRequestLog: %v, %v", got, err)
+	}
+	if got.UpstreamRequestID.String != "req_123" || got.EndUserID.String != "user-7" {
+		t.Errorf("tracing columns were dropped: %+v", got)
+	}
+
+	summary, err := db.GetRequestSummary(now.Add(-time.Minute))
+	if err != nil || summary.TotalRequests != 4 {
+		t.Errorf("sampled log counts for %+v requests (%v), want 4", summary, err)
+	}
+
+	sizes, err := db.ListRequestSizes("tok-1", now.Add(-time.Minute), now.Add(time.Minute))
+	if err != nil || len(sizes) != 1 {
+		t.Fatalf("ListRequestSizes: %v, %v", sizes, err)
+	}
+	if sizes[0].RequestBytes.Int64 != 1200 || sizes[0].ResponseBytes.Int64 != 3400 {
+		t.Errorf("sizes = %+v", sizes[0])
+	}
+}
@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+
+	"ccproxy/internal/store"
+)
+
+// DefaultRetentionInterval is how often per-token retention policies are enforced
+const DefaultRetentionInterval = time.Hour
+
+// RetentionEnforcer deletes logged conversations once they are older than
+// their token's retention period. Every deletion is recorded in the audit log.
+type RetentionEnforcer struct {
+	store    *store.Store
+	interval time.Duration
+	now      func() time.Time
+
+	mu      sync.Mutex
+	running bool
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+// NewRetentionEnforcer creates a retention enforcer
+func NewRetentionEnforcer(store *store.Store, interval time.Duration) *RetentionEnforcer {
+	if interval <= 0 {
+		interval = DefaultRetentionInterval
+	}
+	return &RetentionEnforcer{
+		store:    store,
+		interval: interval,
+		now:      time.Now,
+	}
+}
+
+// Start enforces retention immediately and then periodically
+func (r *RetentionEnforcer) Start(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.running {
+		return nil
+	}
+
+	ctx, r.cancel = context.WithCancel(ctx)
+	r.running = true
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		r.Enforce()
+
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				r.Enforce()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	log.Info().Dur("interval", r.interval).Msg("Retention enforcer started")
+	return nil
+}
+
+// Stop stops the retention enforcer
+func (r *RetentionEnforcer) Stop() {
+	r.mu.Lock()
+	if !r.running {
+		r.mu.Unlock()
+		return
+	}
+	r.running = false
+	r.mu.Unlock()
+
+	r.cancel()
+	r.wg.Wait()
+}
+
+// Enforce deletes expired conversations and returns the number removed
+func (r *RetentionEnforcer) Enforce() int64 {
+	now := r.now()
+	deleted, err := r.store.DeleteExpiredTokenConversations(now)
+	if err != nil {
+		// Tokens handled before the error are still audited below
+		log.Error().Err(err).Msg("failed to enforce conversation retention")
+	}
+
+	var total int64
+	for tokenID, n := range deleted {
+		total += n
+		entry := &store.AuditEntry{
+			ID:        "aud_" + uuid.New().String(),
+			CreatedAt: now,
+			Action:    store.AuditActionRetentionPurge,
+			Actor:     "system",
+			Subject:   tokenID,
+			Details: map[string]interface{}{
+				"token_id":      tokenID,
+				"conversations": n,
+			},
+		}
+		if err := r.store.CreateAuditEntry(entry); err != nil {
+			log.Error().Err(err).Str("token_id", tokenID).Msg("failed to record retention purge")
+		}
+	}
+
+	if total > 0 {
+		log.Info().Int64("conversations", total).Int("tokens", len(deleted)).Msg("Expired conversations deleted")
+	}
+	return total
+}
@@ -0,0 +1,132 @@
+package service
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"ccproxy/internal/store"
+)
+
+func createRetentionToken(t *testing.T, db *store.Store, id, userName string, days int) {
+	t.Helper()
+	token := &store.Token{
+		ID:                        id,
+		UserName:                  userName,
+		Mode:                      "both",
+		CreatedAt:                 time.Now(),
+		ExpiresAt:                 time.Now().Add(24 * time.Hour),
+		ConversationRetentionDays: days,
+	}
+	if err := db.CreateToken(token); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func createTestConversation(t *testing.T, db *store.Store, id, tokenID string, createdAt time.Time) {
+	t.Helper()
+	conv := &store.ConversationContent{
+		ID:           id,
+		RequestLogID: "log-" + id,
+		TokenID:      tokenID,
+		MessagesJSON: "[]",
+		Prompt:       "hello " + id,
+		Completion:   "world",
+		CreatedAt:    createdAt,
+	}
+	if err := db.CreateConversation(conv); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRetentionEnforcer_DeletesExpiredConversations(t *testing.T) {
+	db := newSpendTestStore(t)
+	now := time.Now()
+	createRetentionToken(t, db, "tok-short", "alice", 7)
+	createRetentionToken(t, db, "tok-forever", "bob", 0)
+
+	createTestConversation(t, db, "old", "tok-short", now.AddDate(0, 0, -10))
+	createTestConversation(t, db, "recent", "tok-short", now.AddDate(0, 0, -1))
+	createTestConversation(t, db, "kept", "tok-forever", now.AddDate(0, 0, -100))
+
+	enforcer := NewRetentionEnforcer(db, 0)
+	enforcer.now = func() time.Time { return now }
+	if n := enforcer.Enforce(); n != 1 {
+		t.Fatalf("deleted = %d, want 1", n)
+	}
+
+	for id, want := range map[string]bool{"old": false, "recent": true, "kept": true} {
+		conv, err := db.GetConversation(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (conv != nil) != want {
+			t.Errorf("conversation %s present = %v, want %v", id, conv != nil, want)
+		}
+	}
+
+	entries, err := db.ListAuditEntries(store.AuditFilter{Action: store.AuditActionRetentionPurge})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Subject != "tok-short" || entries[0].Actor != "system" {
+		t.Fatalf("unexpected audit entries: %+v", entries)
+	}
+
+	// Nothing left to delete: no further audit entries
+	if n := enforcer.Enforce(); n != 0 {
+		t.Errorf("second run deleted %d", n)
+	}
+	entries, _ = db.ListAuditEntries(store.AuditFilter{Action: store.AuditActionRetentionPurge})
+	if len(entries) != 1 {
+		t.Errorf("audit entries = %d, want 1", len(entries))
+	}
+}
+
+func TestPurgeTokenData(t *testing.T) {
+	db := newSpendTestStore(t)
+	now := time.Now()
+	createRetentionToken(t, db, "tok-1", "alice", 0)
+	createRetentionToken(t, db, "tok-2", "alice", 0)
+	createRetentionToken(t, db, "tok-3", "bob", 0)
+
+	for i, tokenID := range []string{"tok-1", "tok-2", "tok-3"} {
+		id := fmt.Sprintf("conv-%d", i)
+		createTestConversation(t, db, id, tokenID, now)
+		userName := "alice"
+		if tokenID == "tok-3" {
+			userName = "bob"
+		}
+		if err := db.CreateRequestLog(&store.RequestLog{
+			ID:        "log-" + id,
+			TokenID:   tokenID,
+			UserName:  userName,
+			Mode:      "api",
+			RequestAt: now,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ids, err := db.ListTokenIDsByUserName("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts, err := db.PurgeTokenData(ids, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counts.Conversations != 2 || counts.RequestLogs != 2 {
+		t.Errorf("unexpected counts: %+v", counts)
+	}
+
+	if conv, _ := db.GetConversation("conv-2"); conv == nil {
+		t.Error("other user's conversation was deleted")
+	}
+	if entry, _ := db.GetRequestLog("log-conv-2"); entry == nil {
+		t.Error("other user's request log was deleted")
+	}
+	if entry, _ := db.GetRequestLog("log-conv-0"); entry != nil {
+		t.Error("request log not purged")
+	}
+}
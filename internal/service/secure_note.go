@@ -0,0 +1,52 @@
+package service
+
+import (
+	"encoding/base64"
+	"errors"
+)
+
+// Secure notes are sealed like state bundles, under their own magic
+var secureNoteMagic = []byte("CCPNOTE1")
+
+// MinSecureNotePassphrase is the shortest passphrase notes are sealed with
+const MinSecureNotePassphrase = 8
+
+var (
+	// ErrSecureNotePassphrase is returned for a missing or too short passphrase
+	ErrSecureNotePassphrase = errors.New("secure notes passphrase must be at least 8 characters")
+	// ErrSecureNoteInvalid is returned when notes cannot be opened with the passphrase
+	ErrSecureNoteInvalid = errors.New("wrong passphrase or corrupted notes")
+)
+
+// SealSecureNote seals account notes under a passphrase, returning base64
+// ciphertext to store. The passphrase is not kept anywhere, so notes sealed
+// under a lost passphrase cannot be recovered.
+func SealSecureNote(notes, passphrase string) (string, error) {
+	if len(passphrase) < MinSecureNotePassphrase {
+		return "", ErrSecureNotePassphrase
+	}
+	sealed, err := sealWithPassphrase(secureNoteMagic, []byte(notes), passphrase)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// OpenSecureNote opens notes sealed by SealSecureNote
+func OpenSecureNote(ciphertext, passphrase string) (string, error) {
+	if passphrase == "" {
+		return "", ErrSecureNotePassphrase
+	}
+	sealed, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return "", ErrSecureNoteInvalid
+	}
+	notes, err := openWithPassphrase(secureNoteMagic, sealed, passphrase)
+	if err == errSealedInvalid {
+		return "", ErrSecureNoteInvalid
+	}
+	if err != nil {
+		return "", err
+	}
+	return string(notes), nil
+}
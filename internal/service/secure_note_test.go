@@ -0,0 +1,44 @@
+package service
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSecureNote(t *testing.T) {
+	sealed, err := SealSecureNote("recovery: 1111-2222\n3333-4444", "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := SealSecureNote("recovery: 1111-2222\n3333-4444", "correct horse"); again == sealed {
+		t.Error("sealing twice gave the same ciphertext")
+	}
+
+	tests := []struct {
+		name       string
+		ciphertext string
+		passphrase string
+		wantErr    error
+	}{
+		{"right passphrase", sealed, "correct horse", nil},
+		{"wrong passphrase", sealed, "wrong horse", ErrSecureNoteInvalid},
+		{"no passphrase", sealed, "", ErrSecureNotePassphrase},
+		{"not base64", "%%%", "correct horse", ErrSecureNoteInvalid},
+		{"truncated", sealed[:20], "correct horse", ErrSecureNoteInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			notes, err := OpenSecureNote(tt.ciphertext, tt.passphrase)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && notes != "recovery: 1111-2222\n3333-4444" {
+				t.Errorf("notes = %q", notes)
+			}
+		})
+	}
+
+	if _, err := SealSecureNote("codes", "short"); !errors.Is(err, ErrSecureNotePassphrase) {
+		t.Errorf("short passphrase: %v", err)
+	}
+}
@@ -0,0 +1,194 @@
+package service
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"ccproxy/internal/store"
+)
+
+// Size distribution metrics tokens can be ranked by
+const (
+	SizeMetricPromptTokens      = "prompt_tokens"
+	SizeMetricCompletionTokens  = "completion_tokens"
+	SizeMetricRequestBytes      = "request_bytes"
+	SizeMetricResponseBytes     = "response_bytes"
+	SizeMetricRequestsPerMinute = "requests_per_minute"
+)
+
+// Histogram bucket upper bounds of each kind of metric
+var (
+	tokenBuckets = []int64{256, 1024, 4096, 16384, 65536, 262144}
+	byteBuckets  = []int64{1 << 10, 4 << 10, 16 << 10, 64 << 10, 256 << 10, 1 << 20, 4 << 20}
+	rateBuckets  = []int64{1, 5, 10, 30, 60, 120}
+)
+
+// HistogramBucket counts the samples up to an upper bound that are above the
+// previous bucket's bound
+type HistogramBucket struct {
+	Le    *int64 `json:"le"` // Inclusive upper bound, null for the overflow bucket
+	Count int    `json:"count"`
+}
+
+// Distribution summarizes the samples of one metric
+type Distribution struct {
+	Samples   int               `json:"samples"`
+	Avg       float64           `json:"avg"`
+	P50       int64             `json:"p50"`
+	P90       int64             `json:"p90"`
+	P99       int64             `json:"p99"`
+	Max       int64             `json:"max"`
+	Histogram []HistogramBucket `json:"histogram"`
+}
+
+// TokenSizeDistribution describes the payloads and request rate of one token
+type TokenSizeDistribution struct {
+	TokenID          string       `json:"token_id"`
+	UserName         string       `json:"user_name"`
+	Requests         int          `json:"requests"`
+	PromptTokens     Distribution `json:"prompt_tokens"`
+	CompletionTokens Distribution `json:"completion_tokens"`
+	RequestBytes     Distribution `json:"request_bytes"`  // Requests logged before sizes were recorded are left out
+	ResponseBytes    Distribution `json:"response_bytes"` // Same
+	// RequestsPerMinute covers the minutes in which the token sent requests
+	RequestsPerMinute    Distribution `json:"requests_per_minute"`
+	AvgRequestsPerMinute float64      `json:"avg_requests_per_minute"` // Over the whole window
+	PeakMinute           *time.Time   `json:"peak_minute,omitempty"`
+}
+
+// ValidSizeMetric reports whether metric is one of the SizeMetric constants
+func ValidSizeMetric(metric string) bool {
+	switch metric {
+	case SizeMetricPromptTokens, SizeMetricCompletionTokens, SizeMetricRequestBytes,
+		SizeMetricResponseBytes, SizeMetricRequestsPerMinute:
+		return true
+	}
+	return false
+}
+
+// BuildSizeDistributions groups request sizes by token and summarizes each
+// token's payload sizes and per-minute request rate over a window of the
+// given length. The result is ordered by token id.
+func BuildSizeDistributions(sizes []*store.RequestSize, window time.Duration) []*TokenSizeDistribution {
+	type samples struct {
+		dist             *TokenSizeDistribution
+		prompt, complete []int64
+		reqBytes, resp   []int64
+		minutes          map[time.Time]int64
+	}
+	byToken := make(map[string]*samples)
+	for _, r := range sizes {
+		s, ok := byToken[r.TokenID]
+		if !ok {
+			s = &samples{
+				dist:    &TokenSizeDistribution{TokenID: r.TokenID},
+				minutes: make(map[time.Time]int64),
+			}
+			byToken[r.TokenID] = s
+		}
+		if r.UserName != "" {
+			s.dist.UserName = r.UserName
+		}
+		s.dist.Requests++
+		s.prompt = append(s.prompt, r.PromptTokens)
+		s.complete = append(s.complete, r.CompletionTokens)
+		if r.RequestBytes.Valid {
+			s.reqBytes = append(s.reqBytes, r.RequestBytes.Int64)
+		}
+		if r.ResponseBytes.Valid {
+			s.resp = append(s.resp, r.ResponseBytes.Int64)
+		}
+		s.minutes[r.RequestAt.UTC().Truncate(time.Minute)]++
+	}
+
+	windowMinutes := window.Minutes()
+	dists := make([]*TokenSizeDistribution, 0, len(byToken))
+	for _, s := range byToken {
+		d := s.dist
+		d.PromptTokens = distribution(s.prompt, tokenBuckets)
+		d.CompletionTokens = distribution(s.complete, tokenBuckets)
+		d.RequestBytes = distribution(s.reqBytes, byteBuckets)
+		d.ResponseBytes = distribution(s.resp, byteBuckets)
+
+		rates := make([]int64, 0, len(s.minutes))
+		var peak time.Time
+		var peakCount int64
+		for minute, count := range s.minutes {
+			rates = append(rates, count)
+			if count > peakCount || (count == peakCount && minute.Before(peak)) {
+				peak, peakCount = minute, count
+			}
+		}
+		d.RequestsPerMinute = distribution(rates, rateBuckets)
+		if windowMinutes > 0 {
+			d.AvgRequestsPerMinute = math.Round(float64(d.Requests)/windowMinutes*100) / 100
+		}
+		if peakCount > 0 {
+			d.PeakMinute = &peak
+		}
+		dists = append(dists, d)
+	}
+	sort.Slice(dists, func(i, j int) bool { return dists[i].TokenID < dists[j].TokenID })
+	return dists
+}
+
+// SortSizeDistributions orders tokens by the p99 of metric, largest first,
+// then by request count
+func SortSizeDistributions(dists []*TokenSizeDistribution, metric string) {
+	p99 := func(d *TokenSizeDistribution) int64 {
+		switch metric {
+		case SizeMetricCompletionTokens:
+			return d.CompletionTokens.P99
+		case SizeMetricRequestBytes:
+			return d.RequestBytes.P99
+		case SizeMetricResponseBytes:
+			return d.ResponseBytes.P99
+		case SizeMetricRequestsPerMinute:
+			return d.RequestsPerMinute.P99
+		default:
+			return d.PromptTokens.P99
+		}
+	}
+	sort.SliceStable(dists, func(i, j int) bool {
+		if a, b := p99(dists[i]), p99(dists[j]); a != b {
+			return a > b
+		}
+		return dists[i].Requests > dists[j].Requests
+	})
+}
+
+// distribution summarizes samples with nearest-rank percentiles and a
+// histogram over the given bucket bounds
+func distribution(samples []int64, bounds []int64) Distribution {
+	d := Distribution{Histogram: make([]HistogramBucket, len(bounds)+1)}
+	for i := range bounds {
+		d.Histogram[i].Le = &bounds[i]
+	}
+	if len(samples) == 0 {
+		return d
+	}
+
+	sorted := append([]int64(nil), samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	rank := func(p float64) int64 {
+		i := int(math.Ceil(p*float64(len(sorted)))) - 1
+		if i < 0 {
+			i = 0
+		}
+		return sorted[i]
+	}
+
+	var sum int64
+	for _, v := range sorted {
+		sum += v
+		d.Histogram[sort.Search(len(bounds), func(i int) bool { return v <= bounds[i] })].Count++
+	}
+	d.Samples = len(sorted)
+	d.Avg = math.Round(float64(sum)/float64(len(sorted))*100) / 100
+	d.P50 = rank(0.50)
+	d.P90 = rank(0.90)
+	d.P99 = rank(0.99)
+	d.Max = sorted[len(sorted)-1]
+	return d
+}
@@ -0,0 +1,88 @@
+package service
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"ccproxy/internal/store"
+)
+
+func TestBuildSizeDistributions(t *testing.T) {
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	var sizes []*store.RequestSize
+	// tok-a: 100 requests over ten minutes, one of them huge
+	for i := 0; i < 100; i++ {
+		prompt := int64(500)
+		if i == 99 {
+			prompt = 300000
+		}
+		sizes = append(sizes, &store.RequestSize{
+			TokenID:          "tok-a",
+			UserName:         "alice",
+			RequestAt:        start.Add(time.Duration(i) * 6 * time.Second),
+			PromptTokens:     prompt,
+			CompletionTokens: 200,
+			RequestBytes:     sql.NullInt64{Int64: prompt * 4, Valid: true},
+			ResponseBytes:    sql.NullInt64{Int64: 900, Valid: true},
+		})
+	}
+	// tok-b: a burst of 30 requests in one minute, logged before sizes were recorded
+	for i := 0; i < 30; i++ {
+		sizes = append(sizes, &store.RequestSize{
+			TokenID:          "tok-b",
+			RequestAt:        start.Add(30*time.Minute + time.Duration(i)*time.Second),
+			PromptTokens:     2000,
+			CompletionTokens: 50,
+		})
+	}
+
+	dists := BuildSizeDistributions(sizes, time.Hour)
+	if len(dists) != 2 || dists[0].TokenID != "tok-a" || dists[1].TokenID != "tok-b" {
+		t.Fatalf("dists = %+v", dists)
+	}
+
+	a := dists[0]
+	if a.UserName != "alice" || a.Requests != 100 {
+		t.Errorf("tok-a = %+v", a)
+	}
+	if p := a.PromptTokens; p.Samples != 100 || p.P50 != 500 || p.P99 != 500 || p.Max != 300000 {
+		t.Errorf("tok-a prompt tokens = %+v", p)
+	}
+	// 256 < 500 <= 1024, 300000 overflows the last bound
+	hist := a.PromptTokens.Histogram
+	if hist[1].Count != 99 || hist[len(hist)-1].Count != 1 || hist[len(hist)-1].Le != nil {
+		t.Errorf("tok-a prompt histogram = %+v", hist)
+	}
+	if a.ResponseBytes.Samples != 100 || a.ResponseBytes.P90 != 900 {
+		t.Errorf("tok-a response bytes = %+v", a.ResponseBytes)
+	}
+	if r := a.RequestsPerMinute; r.Samples != 10 || r.Max != 10 {
+		t.Errorf("tok-a rate = %+v", r)
+	}
+
+	b := dists[1]
+	if b.RequestBytes.Samples != 0 || b.ResponseBytes.Samples != 0 {
+		t.Errorf("tok-b sizes without samples = %+v %+v", b.RequestBytes, b.ResponseBytes)
+	}
+	if b.RequestsPerMinute.Max != 30 || b.AvgRequestsPerMinute != 0.5 {
+		t.Errorf("tok-b rate = %+v, avg %v", b.RequestsPerMinute, b.AvgRequestsPerMinute)
+	}
+	if b.PeakMinute == nil || !b.PeakMinute.Equal(start.Add(30*time.Minute)) {
+		t.Errorf("tok-b peak minute = %v", b.PeakMinute)
+	}
+
+	// Ranking by rate puts the bursty token first, by prompt size the other
+	SortSizeDistributions(dists, SizeMetricRequestsPerMinute)
+	if dists[0].TokenID != "tok-b" {
+		t.Errorf("by rate: first = %s", dists[0].TokenID)
+	}
+	SortSizeDistributions(dists, SizeMetricPromptTokens)
+	if dists[0].TokenID != "tok-b" {
+		t.Errorf("by prompt p99: first = %s", dists[0].TokenID)
+	}
+	SortSizeDistributions(dists, SizeMetricResponseBytes)
+	if dists[0].TokenID != "tok-a" {
+		t.Errorf("by response bytes: first = %s", dists[0].TokenID)
+	}
+}
@@ -0,0 +1,397 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"ccproxy/internal/notify"
+	"ccproxy/internal/store"
+)
+
+// SLO objectives
+const (
+	SLOAvailability = "availability"
+	SLOLatency      = "latency"
+)
+
+const (
+	// DefaultSLOCheckInterval is how often burn rates are checked against the alert thresholds
+	DefaultSLOCheckInterval = 5 * time.Minute
+	// sloMinAlertRequests is the traffic in an alert window needed to judge its burn rate
+	sloMinAlertRequests = 20
+)
+
+// SLOConfig defines the service level objectives and burn rate alerts
+type SLOConfig struct {
+	Window         time.Duration // Rolling window the error budget covers
+	Availability   float64       // Percent of requests that must not fail with a server-side error
+	LatencyTarget  time.Duration // Requests slower than this count against the latency objective
+	LatencyPercent float64       // Percent of successful requests that must meet LatencyTarget, 0 = no latency objective
+	CheckInterval  time.Duration
+	FastBurnWindow time.Duration // Critical alert when the burn rate over this window
+	FastBurnRate   float64       // reaches this rate, 0 = disabled
+	SlowBurnWindow time.Duration // Warning alert when the burn rate over this window
+	SlowBurnRate   float64       // reaches this rate, 0 = disabled
+}
+
+// SLOObjective is the compliance and error budget of one objective
+type SLOObjective struct {
+	Target          float64            `json:"target"` // Percent
+	Requests        int64              `json:"requests"`
+	Bad             int64              `json:"bad"`
+	Compliance      float64            `json:"compliance"`       // Percent of good requests over the window
+	BudgetConsumed  float64            `json:"budget_consumed"`  // Share of the error budget used; above 1 when exhausted
+	BudgetRemaining float64            `json:"budget_remaining"` // 1 - budget_consumed, at least 0
+	BurnRates       map[string]float64 `json:"burn_rates"`       // Alert window -> budget burn rate, 1 = on pace to use exactly the budget
+}
+
+// SLOStatus holds the objectives of one token, or of all traffic
+type SLOStatus struct {
+	TokenID      string        `json:"token_id,omitempty"`
+	UserName     string        `json:"user_name,omitempty"`
+	Availability *SLOObjective `json:"availability"`
+	Latency      *SLOObjective `json:"latency,omitempty"`
+}
+
+// SLOReport is the error budget of all traffic and of each token over the
+// rolling window
+type SLOReport struct {
+	Window        string       `json:"window"`
+	Since         time.Time    `json:"since"`
+	Until         time.Time    `json:"until"`
+	LatencyTarget string       `json:"latency_target,omitempty"`
+	Overall       *SLOStatus   `json:"overall"`
+	Tokens        []*SLOStatus `json:"tokens"` // Most budget consumed first
+	Alerting      []string     `json:"alerting"`
+}
+
+// sloAlert is a burn rate alert level
+type sloAlert struct {
+	window   time.Duration
+	rate     float64
+	severity notify.Severity
+}
+
+// SLOTracker computes rolling error budget consumption from request logs and
+// notifies when the budget burns faster than the configured rates
+type SLOTracker struct {
+	store    *store.Store
+	notifier notify.Notifier
+	cfg      SLOConfig
+	alerts   []sloAlert
+	now      func() time.Time
+
+	mu       sync.Mutex
+	alerting map[string]bool // scope/objective/window -> firing
+
+	runMu   sync.Mutex
+	running bool
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+// NewSLOTracker creates an SLO tracker
+func NewSLOTracker(store *store.Store, cfg SLOConfig) *SLOTracker {
+	if cfg.Window <= 0 {
+		cfg.Window = 30 * 24 * time.Hour
+	}
+	if cfg.CheckInterval <= 0 {
+		cfg.CheckInterval = DefaultSLOCheckInterval
+	}
+	var alerts []sloAlert
+	if cfg.FastBurnRate > 0 && cfg.FastBurnWindow > 0 {
+		alerts = append(alerts, sloAlert{window: cfg.FastBurnWindow, rate: cfg.FastBurnRate, severity: notify.SeverityCritical})
+	}
+	if cfg.SlowBurnRate > 0 && cfg.SlowBurnWindow > 0 {
+		alerts = append(alerts, sloAlert{window: cfg.SlowBurnWindow, rate: cfg.SlowBurnRate, severity: notify.SeverityWarning})
+	}
+	return &SLOTracker{
+		store:    store,
+		notifier: notify.Nop{},
+		cfg:      cfg,
+		alerts:   alerts,
+		now:      time.Now,
+		alerting: make(map[string]bool),
+	}
+}
+
+// SetNotifier sets the notifier used to report burn rate alerts
+func (t *SLOTracker) SetNotifier(n notify.Notifier) {
+	if n == nil {
+		n = notify.Nop{}
+	}
+	t.notifier = n
+}
+
+// Start checks burn rates immediately and then periodically. Without alert
+// thresholds there is nothing to check, and reports are computed on demand.
+func (t *SLOTracker) Start(ctx context.Context) error {
+	t.runMu.Lock()
+	defer t.runMu.Unlock()
+
+	if t.running || len(t.alerts) == 0 {
+		return nil
+	}
+
+	ctx, t.cancel = context.WithCancel(ctx)
+	t.running = true
+
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+		t.Check()
+
+		ticker := time.NewTicker(t.cfg.CheckInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				t.Check()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	log.Info().Dur("interval", t.cfg.CheckInterval).Msg("SLO burn rate alerts started")
+	return nil
+}
+
+// Stop stops the periodic burn rate checks
+func (t *SLOTracker) Stop() {
+	t.runMu.Lock()
+	if !t.running {
+		t.runMu.Unlock()
+		return
+	}
+	t.running = false
+	t.runMu.Unlock()
+
+	t.cancel()
+	t.wg.Wait()
+}
+
+// Report computes the error budget of all traffic and of every token with
+// requests in the window. A non-empty tokenID limits the tokens reported.
+func (t *SLOTracker) Report(tokenID string) (*SLOReport, error) {
+	now := t.now()
+	latencyMs := int64(0)
+	if t.cfg.LatencyPercent > 0 {
+		latencyMs = t.cfg.LatencyTarget.Milliseconds()
+	}
+
+	window, err := t.store.GetSLOCounts(now.Add(-t.cfg.Window), now, latencyMs)
+	if err != nil {
+		return nil, err
+	}
+	burn := make([]map[string]*store.SLOCounts, len(t.alerts))
+	for i, alert := range t.alerts {
+		counts, err := t.store.GetSLOCounts(now.Add(-alert.window), now, latencyMs)
+		if err != nil {
+			return nil, err
+		}
+		burn[i] = make(map[string]*store.SLOCounts, len(counts))
+		for _, c := range counts {
+			burn[i][c.TokenID] = c
+			overall := burn[i][""]
+			if overall == nil {
+				overall = &store.SLOCounts{}
+				burn[i][""] = overall
+			}
+			overall.Requests += c.Requests
+			overall.Errors += c.Errors
+			overall.Slow += c.Slow
+		}
+	}
+
+	report := &SLOReport{
+		Window:   t.cfg.Window.String(),
+		Since:    now.Add(-t.cfg.Window),
+		Until:    now,
+		Tokens:   []*SLOStatus{},
+		Alerting: t.firing(),
+	}
+	if latencyMs > 0 {
+		report.LatencyTarget = t.cfg.LatencyTarget.String()
+	}
+
+	total := &store.SLOCounts{}
+	for _, c := range window {
+		total.Requests += c.Requests
+		total.Errors += c.Errors
+		total.Slow += c.Slow
+		if tokenID == "" || c.TokenID == tokenID {
+			report.Tokens = append(report.Tokens, t.status(c, burn))
+		}
+	}
+	report.Overall = t.status(total, burn)
+
+	sort.SliceStable(report.Tokens, func(i, j int) bool {
+		return report.Tokens[i].Availability.BudgetConsumed > report.Tokens[j].Availability.BudgetConsumed
+	})
+	return report, nil
+}
+
+// Check compares burn rates against the alert thresholds, notifies alerts
+// that start or stop firing, and returns the keys of firing alerts
+func (t *SLOTracker) Check() []string {
+	report, err := t.Report("")
+	if err != nil {
+		log.Error().Err(err).Msg("failed to compute SLO report")
+		return nil
+	}
+
+	now := t.now()
+	statuses := append([]*SLOStatus{report.Overall}, report.Tokens...)
+	for _, status := range statuses {
+		t.checkObjective(status, SLOAvailability, status.Availability, now)
+		if status.Latency != nil {
+			t.checkObjective(status, SLOLatency, status.Latency, now)
+		}
+	}
+	return t.firing()
+}
+
+func (t *SLOTracker) checkObjective(status *SLOStatus, objective string, o *SLOObjective, now time.Time) {
+	scope := "overall"
+	if status.TokenID != "" {
+		scope = "token " + status.TokenID
+		if status.UserName != "" {
+			scope = fmt.Sprintf("token %s (%s)", status.TokenID, status.UserName)
+		}
+	}
+
+	for _, alert := range t.alerts {
+		window := alert.window.String()
+		rate, ok := o.BurnRates[window]
+		key := status.TokenID + "/" + objective + "/" + window
+
+		t.mu.Lock()
+		was := t.alerting[key]
+		firing := ok && rate >= alert.rate
+		// Keep quiet traffic's last state rather than flapping on a handful of requests
+		if !ok {
+			firing = was
+		}
+		if firing {
+			t.alerting[key] = true
+		} else {
+			delete(t.alerting, key)
+		}
+		t.mu.Unlock()
+
+		if firing == was {
+			continue
+		}
+
+		event := notify.Event{
+			Type:     notify.EventSLOBurnRate,
+			Severity: alert.severity,
+			Message: fmt.Sprintf("%s SLO %s is burning error budget at %.1fx over %s (threshold %.1fx, %.0f%% of budget left)",
+				objective, scope, rate, window, alert.rate, o.BudgetRemaining*100),
+			Details: map[string]interface{}{
+				"objective":        objective,
+				"token_id":         status.TokenID,
+				"window":           window,
+				"burn_rate":        rate,
+				"threshold":        alert.rate,
+				"budget_remaining": o.BudgetRemaining,
+			},
+			Time: now,
+		}
+		if !firing {
+			event.Type = notify.EventSLORecovered
+			event.Severity = notify.SeverityInfo
+			event.Message = fmt.Sprintf("%s SLO %s burn rate over %s is back to %.1fx (threshold %.1fx)",
+				objective, scope, window, rate, alert.rate)
+		}
+		log.Warn().
+			Str("objective", objective).
+			Str("token_id", status.TokenID).
+			Str("window", window).
+			Float64("burn_rate", rate).
+			Bool("firing", firing).
+			Msg("SLO burn rate alert")
+		t.notifier.Notify(event)
+	}
+}
+
+// firing returns the keys of firing alerts, sorted
+func (t *SLOTracker) firing() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	keys := make([]string, 0, len(t.alerting))
+	for key := range t.alerting {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// status builds the objectives of one scope from its counts over the SLO
+// window and over each alert window
+func (t *SLOTracker) status(c *store.SLOCounts, burn []map[string]*store.SLOCounts) *SLOStatus {
+	status := &SLOStatus{TokenID: c.TokenID, UserName: c.UserName}
+
+	status.Availability = newSLOObjective(t.cfg.Availability, c.Requests, c.Errors)
+	for i, alert := range t.alerts {
+		if w := burn[i][c.TokenID]; w != nil && w.Requests >= sloMinAlertRequests {
+			status.Availability.BurnRates[alert.window.String()] = burnRate(t.cfg.Availability, w.Requests, w.Errors)
+		}
+	}
+
+	if t.cfg.LatencyPercent > 0 {
+		// Failed requests are judged by availability alone
+		status.Latency = newSLOObjective(t.cfg.LatencyPercent, c.Requests-c.Errors, c.Slow)
+		for i, alert := range t.alerts {
+			if w := burn[i][c.TokenID]; w != nil && w.Requests-w.Errors >= sloMinAlertRequests {
+				status.Latency.BurnRates[alert.window.String()] = burnRate(t.cfg.LatencyPercent, w.Requests-w.Errors, w.Slow)
+			}
+		}
+	}
+	return status
+}
+
+func newSLOObjective(target float64, requests, bad int64) *SLOObjective {
+	o := &SLOObjective{
+		Target:          target,
+		Requests:        requests,
+		Bad:             bad,
+		Compliance:      100,
+		BudgetRemaining: 1,
+		BurnRates:       map[string]float64{},
+	}
+	if requests > 0 {
+		o.Compliance = 100 * float64(requests-bad) / float64(requests)
+		o.BudgetConsumed = burnRate(target, requests, bad)
+		if o.BudgetConsumed < 1 {
+			o.BudgetRemaining = 1 - o.BudgetConsumed
+		} else {
+			o.BudgetRemaining = 0
+		}
+	}
+	return o
+}
+
+// burnRate is the rate of bad requests relative to the error budget of the
+// target percentage. Over the whole SLO window it is the share of the budget
+// consumed.
+func burnRate(target float64, requests, bad int64) float64 {
+	if requests <= 0 {
+		return 0
+	}
+	budget := 1 - target/100
+	if budget <= 0 {
+		if bad > 0 {
+			return float64(bad)
+		}
+		return 0
+	}
+	return float64(bad) / float64(requests) / budget
+}
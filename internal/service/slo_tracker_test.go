@@ -0,0 +1,192 @@
+package service
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"ccproxy/internal/notify"
+	"ccproxy/internal/store"
+)
+
+// createSLOLogs logs requests of a token ago before now; the first errors of
+// them fail with status and the next slow ones take 40s
+func createSLOLogs(t *testing.T, db *store.Store, tokenID string, now time.Time, ago time.Duration, requests, errors, slow, status int) {
+	t.Helper()
+	for i := 0; i < requests; i++ {
+		l := &store.RequestLog{
+			ID:         fmt.Sprintf("%s-%s-%d", tokenID, ago, i),
+			TokenID:    tokenID,
+			UserName:   "user-" + tokenID,
+			Mode:       "api",
+			Model:      "claude-sonnet-4",
+			RequestAt:  now.Add(-ago - time.Duration(i)*time.Second),
+			DurationMs: sql.NullInt64{Int64: 2000, Valid: true},
+			StatusCode: 200,
+			Success:    true,
+		}
+		switch {
+		case i < errors:
+			l.StatusCode = status
+			l.Success = false
+		case i < errors+slow:
+			l.DurationMs.Int64 = 40000
+		}
+		if err := db.CreateRequestLog(l); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func newTestSLOTracker(db *store.Store, now time.Time) *SLOTracker {
+	tracker := NewSLOTracker(db, SLOConfig{
+		Window:         24 * time.Hour,
+		Availability:   99,
+		LatencyTarget:  30 * time.Second,
+		LatencyPercent: 90,
+		FastBurnWindow: time.Hour,
+		FastBurnRate:   10,
+		SlowBurnWindow: 6 * time.Hour,
+		SlowBurnRate:   5,
+	})
+	tracker.now = func() time.Time { return now }
+	return tracker
+}
+
+func TestSLOTracker_Report(t *testing.T) {
+	db := newSpendTestStore(t)
+	now := time.Now()
+
+	// tok-a: 100 requests earlier in the day, 1 server error and 5 slow
+	createSLOLogs(t, db, "tok-a", now, 12*time.Hour, 100, 1, 5, 502)
+	// tok-b: 100 requests, 3 rejected as invalid (not counted) and 2 rate limited
+	createSLOLogs(t, db, "tok-b", now, 12*time.Hour, 97, 2, 0, 429)
+	createSLOLogs(t, db, "tok-b", now, 11*time.Hour, 3, 3, 0, 400)
+	// Outside the window
+	createSLOLogs(t, db, "tok-a", now, 30*time.Hour, 50, 50, 0, 500)
+
+	report, err := newTestSLOTracker(db, now).Report("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	overall := report.Overall.Availability
+	if overall.Requests != 200 || overall.Bad != 3 {
+		t.Fatalf("overall availability = %+v", overall)
+	}
+	if math.Abs(overall.BudgetConsumed-1.5) > 1e-9 || overall.BudgetRemaining != 0 {
+		t.Errorf("overall budget consumed = %v, remaining %v", overall.BudgetConsumed, overall.BudgetRemaining)
+	}
+	if latency := report.Overall.Latency; latency.Requests != 197 || latency.Bad != 5 {
+		t.Errorf("overall latency = %+v", latency)
+	}
+	// No traffic in the alert windows
+	if len(overall.BurnRates) != 0 {
+		t.Errorf("burn rates = %v", overall.BurnRates)
+	}
+
+	if len(report.Tokens) != 2 || report.Tokens[0].TokenID != "tok-b" {
+		t.Fatalf("tokens = %+v", report.Tokens)
+	}
+	if a := report.Tokens[1].Availability; math.Abs(a.BudgetConsumed-1) > 1e-9 || a.Compliance != 99 {
+		t.Errorf("tok-a availability = %+v", a)
+	}
+	if l := report.Tokens[1].Latency; math.Abs(l.BudgetConsumed-5.0/99/0.1) > 1e-9 {
+		t.Errorf("tok-a latency = %+v", l)
+	}
+
+	single, err := newTestSLOTracker(db, now).Report("tok-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(single.Tokens) != 1 || single.Overall.Availability.Requests != 200 {
+		t.Errorf("filtered report = %+v", single)
+	}
+}
+
+func TestSLOTracker_CountsSampledOutSuccesses(t *testing.T) {
+	db := newSpendTestStore(t)
+	now := time.Now()
+
+	// 10% of successes logged: 9 rows standing for 90 requests, plus 10 errors
+	createSLOLogs(t, db, "tok-a", now, time.Hour, 10, 10, 0, 502)
+	for i := 0; i < 9; i++ {
+		l := &store.RequestLog{
+			ID: fmt.Sprintf("sampled-%d", i), TokenID: "tok-a", UserName: "user-tok-a", Mode: "api", Model: "claude-sonnet-4",
+			RequestAt: now.Add(-time.Hour), DurationMs: sql.NullInt64{Int64: 2000, Valid: true},
+			StatusCode: 200, Success: true, SampleWeight: 10,
+		}
+		if err := db.CreateRequestLog(l); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	report, err := newTestSLOTracker(db, now).Report("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := report.Overall.Availability; got.Requests != 100 || got.Bad != 10 {
+		t.Errorf("availability = %+v, want 10 bad of 100 requests", got)
+	}
+	summary, err := db.GetRequestSummary(now.Add(-2 * time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.TotalRequests != 100 || summary.FailedRequests != 10 {
+		t.Errorf("request summary = %+v, want 10 failed of 100", summary)
+	}
+}
+
+func TestSLOTracker_Check(t *testing.T) {
+	db := newSpendTestStore(t)
+	now := time.Now()
+
+	// 20% errors in the last hour burns a 1% budget at 20x
+	createSLOLogs(t, db, "tok-a", now, time.Minute, 50, 10, 0, 500)
+
+	notifier := &recordingNotifier{}
+	tracker := newTestSLOTracker(db, now)
+	tracker.SetNotifier(notifier)
+
+	firing := tracker.Check()
+	want := []string{"/availability/1h0m0s", "/availability/6h0m0s", "tok-a/availability/1h0m0s", "tok-a/availability/6h0m0s"}
+	if fmt.Sprint(firing) != fmt.Sprint(want) {
+		t.Fatalf("firing = %v, want %v", firing, want)
+	}
+	if len(notifier.events) != 4 {
+		t.Fatalf("events = %+v", notifier.events)
+	}
+	for _, event := range notifier.events {
+		if event.Type != notify.EventSLOBurnRate {
+			t.Errorf("event = %+v", event)
+		}
+	}
+	if notifier.events[0].Severity != notify.SeverityCritical || notifier.events[1].Severity != notify.SeverityWarning {
+		t.Errorf("severities = %s, %s", notifier.events[0].Severity, notifier.events[1].Severity)
+	}
+
+	// Still firing: nothing new is sent
+	tracker.Check()
+	if len(notifier.events) != 4 {
+		t.Fatalf("repeated events: %+v", notifier.events[4:])
+	}
+
+	// Healthy traffic brings the fast burn rate below its threshold
+	createSLOLogs(t, db, "tok-a", now, 2*time.Minute, 100, 0, 0, 0)
+	firing = tracker.Check()
+	want = []string{"/availability/6h0m0s", "tok-a/availability/6h0m0s"}
+	if fmt.Sprint(firing) != fmt.Sprint(want) {
+		t.Fatalf("firing = %v, want %v", firing, want)
+	}
+	recovered := 0
+	for _, event := range notifier.events[4:] {
+		if event.Type == notify.EventSLORecovered {
+			recovered++
+		}
+	}
+	if recovered != 2 {
+		t.Errorf("recovered events = %+v", notifier.events[4:])
+	}
+}
@@ -0,0 +1,378 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"ccproxy/internal/notify"
+	"ccproxy/internal/store"
+)
+
+const (
+	// DefaultBudgetCheckInterval is how often budget-disabled keys are
+	// re-checked so they return to the pool when a new month starts
+	DefaultBudgetCheckInterval = time.Hour
+
+	// budgetExceededReason prefixes the error message of budget-disabled accounts
+	budgetExceededReason = "monthly budget exceeded"
+)
+
+// KeyRegistry is the API key pool that api_key accounts are served from
+type KeyRegistry interface {
+	Add(key string) bool
+	Remove(key string) bool
+}
+
+// AccountBudget summarizes an api_key account's spend against its budget
+type AccountBudget struct {
+	AccountID        string                   `json:"account_id"`
+	Month            string                   `json:"month"`
+	SpendUSD         float64                  `json:"spend_usd"`
+	MonthlyBudgetUSD float64                  `json:"monthly_budget_usd"`
+	RemainingUSD     *float64                 `json:"remaining_usd,omitempty"` // nil when unlimited
+	Exceeded         bool                     `json:"exceeded"`
+	Requests         int64                    `json:"requests"`
+	InputTokens      int64                    `json:"input_tokens"`
+	OutputTokens     int64                    `json:"output_tokens"`
+	Info             *store.APIKeyAccountInfo `json:"info,omitempty"`
+	History          []*store.AccountSpend    `json:"history,omitempty"`
+}
+
+// SpendTracker estimates the spend of api_key accounts from response usage,
+// keeps their keys in the API key pool while they are within their monthly
+// budget, and disables and alerts on keys that exceed it
+type SpendTracker struct {
+	store    *store.Store
+	keys     KeyRegistry
+	costs    *CostEnricher
+	notifier notify.Notifier
+	interval time.Duration
+	now      func() time.Time
+
+	mu       sync.RWMutex
+	accounts map[string]string // API key -> account ID
+
+	running bool
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+// NewSpendTracker creates a spend tracker; custom prices take precedence over defaults
+func NewSpendTracker(store *store.Store, keys KeyRegistry, pricing []ModelPrice) *SpendTracker {
+	return &SpendTracker{
+		store:    store,
+		keys:     keys,
+		costs:    NewCostEnricher(pricing),
+		notifier: notify.Nop{},
+		interval: DefaultBudgetCheckInterval,
+		now:      time.Now,
+		accounts: make(map[string]string),
+	}
+}
+
+// SetNotifier sets where budget alerts are sent
+func (t *SpendTracker) SetNotifier(n notify.Notifier) {
+	if n == nil {
+		n = notify.Nop{}
+	}
+	t.notifier = n
+}
+
+// Load registers all api_key accounts and adds the usable ones to the key pool
+func (t *SpendTracker) Load() error {
+	accounts, err := t.store.ListAccountsWithStatus()
+	if err != nil {
+		return err
+	}
+
+	added := 0
+	for _, account := range accounts {
+		if account.Type != store.AccountTypeAPIKey || account.Credentials.APIKey == "" {
+			continue
+		}
+		t.mu.Lock()
+		t.accounts[account.Credentials.APIKey] = account.ID
+		t.mu.Unlock()
+
+		if isBudgetDisabled(account) {
+			t.restore(account)
+			continue
+		}
+		if account.Status == store.AccountStatusActive && account.IsActive && t.keys.Add(account.Credentials.APIKey) {
+			added++
+		}
+	}
+
+	if added > 0 {
+		log.Info().Int("keys", added).Msg("added API key accounts to key pool")
+	}
+	return nil
+}
+
+// Register tracks a new api_key account and adds its key to the pool
+func (t *SpendTracker) Register(account *store.Account) {
+	if account.Type != store.AccountTypeAPIKey || account.Credentials.APIKey == "" {
+		return
+	}
+	t.mu.Lock()
+	t.accounts[account.Credentials.APIKey] = account.ID
+	t.mu.Unlock()
+	t.keys.Add(account.Credentials.APIKey)
+}
+
+// Unregister removes an api_key account's key from the pool, e.g. when it is
+// deactivated or deleted
+func (t *SpendTracker) Unregister(account *store.Account) {
+	if account.Type != store.AccountTypeAPIKey || account.Credentials.APIKey == "" {
+		return
+	}
+	t.mu.Lock()
+	delete(t.accounts, account.Credentials.APIKey)
+	t.mu.Unlock()
+	t.keys.Remove(account.Credentials.APIKey)
+}
+
+// AccountID returns the api_key account a pooled key belongs to
+func (t *SpendTracker) AccountID(apiKey string) (string, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	accountID, ok := t.accounts[apiKey]
+	return accountID, ok
+}
+
+// Record adds the estimated cost of a response to the key's account. Keys
+// that do not belong to an api_key account (e.g. configured keys) are ignored.
+func (t *SpendTracker) Record(apiKey, model string, inputTokens, outputTokens int) {
+	if inputTokens == 0 && outputTokens == 0 {
+		return
+	}
+
+	t.mu.RLock()
+	accountID, ok := t.accounts[apiKey]
+	t.mu.RUnlock()
+	if !ok {
+		return
+	}
+
+	cost, priced := t.costs.Estimate(model, inputTokens, outputTokens)
+	if !priced {
+		log.Debug().Str("model", model).Msg("no price for model, spend not estimated")
+	}
+
+	month := store.SpendMonth(t.now())
+	spend, err := t.store.AddAccountSpend(accountID, month, cost, inputTokens, outputTokens)
+	if err != nil {
+		log.Error().Err(err).Str("account_id", accountID).Msg("failed to record account spend")
+		return
+	}
+
+	info, err := t.store.GetAPIKeyAccountInfo(accountID)
+	if err != nil || info == nil || info.MonthlyBudgetUSD <= 0 || spend.SpendUSD < info.MonthlyBudgetUSD {
+		return
+	}
+	t.exceedBudget(accountID, apiKey, spend, info.MonthlyBudgetUSD)
+}
+
+// exceedBudget takes the key out of the pool, disables the account and alerts once
+func (t *SpendTracker) exceedBudget(accountID, apiKey string, spend *store.AccountSpend, budget float64) {
+	if !t.keys.Remove(apiKey) {
+		// Already removed by a concurrent request or by an admin
+		return
+	}
+
+	message := fmt.Sprintf("%s: $%.2f of $%.2f in %s", budgetExceededReason, spend.SpendUSD, budget, spend.Month)
+	if err := t.store.UpdateAccountStatus(accountID, store.AccountStatusDisabled, message); err != nil {
+		log.Error().Err(err).Str("account_id", accountID).Msg("failed to disable account over budget")
+	}
+
+	log.Warn().
+		Str("account_id", accountID).
+		Float64("spend_usd", spend.SpendUSD).
+		Float64("budget_usd", budget).
+		Msg("API key account exceeded monthly budget, disabled")
+	t.notifier.Notify(notify.Event{
+		Type:      notify.EventAccountBudgetExceeded,
+		Severity:  notify.SeverityWarning,
+		AccountID: accountID,
+		Message:   fmt.Sprintf("API key account %s exceeded its monthly budget and was disabled until next month", accountID),
+		Details: map[string]interface{}{
+			"month":      spend.Month,
+			"spend_usd":  spend.SpendUSD,
+			"budget_usd": budget,
+		},
+	})
+}
+
+// Budget returns the current month's spend of an account against its budget
+func (t *SpendTracker) Budget(accountID string) (*AccountBudget, error) {
+	month := store.SpendMonth(t.now())
+	budget := &AccountBudget{AccountID: accountID, Month: month}
+
+	info, err := t.store.GetAPIKeyAccountInfo(accountID)
+	if err != nil {
+		return nil, err
+	}
+	if info != nil {
+		budget.Info = info
+		budget.MonthlyBudgetUSD = info.MonthlyBudgetUSD
+	}
+
+	spend, err := t.store.GetAccountSpend(accountID, month)
+	if err != nil {
+		return nil, err
+	}
+	if spend != nil {
+		budget.SpendUSD = spend.SpendUSD
+		budget.Requests = spend.Requests
+		budget.InputTokens = spend.InputTokens
+		budget.OutputTokens = spend.OutputTokens
+	}
+
+	if budget.MonthlyBudgetUSD > 0 {
+		remaining := budget.MonthlyBudgetUSD - budget.SpendUSD
+		if remaining < 0 {
+			remaining = 0
+		}
+		budget.RemainingUSD = &remaining
+		budget.Exceeded = budget.SpendUSD >= budget.MonthlyBudgetUSD
+	}
+
+	budget.History, err = t.store.ListAccountSpendHistory(accountID, 12)
+	if err != nil {
+		return nil, err
+	}
+	return budget, nil
+}
+
+// SetBudget changes an account's monthly budget. A key disabled for budget
+// is restored if the new budget allows it; an active key already over the
+// new budget is disabled right away.
+func (t *SpendTracker) SetBudget(accountID string, budgetUSD float64) error {
+	if budgetUSD < 0 {
+		return fmt.Errorf("monthly_budget_usd must not be negative")
+	}
+	if err := t.store.SetAccountMonthlyBudget(accountID, budgetUSD); err != nil {
+		return err
+	}
+
+	accounts, err := t.store.ListAccountsWithStatus()
+	if err != nil {
+		return err
+	}
+	for _, account := range accounts {
+		if account.ID != accountID || account.Type != store.AccountTypeAPIKey {
+			continue
+		}
+		if isBudgetDisabled(account) {
+			t.restore(account)
+			break
+		}
+		if budgetUSD > 0 && account.Status == store.AccountStatusActive {
+			spend, err := t.store.GetAccountSpend(accountID, store.SpendMonth(t.now()))
+			if err != nil {
+				return err
+			}
+			if spend != nil && spend.SpendUSD >= budgetUSD {
+				t.exceedBudget(accountID, account.Credentials.APIKey, spend, budgetUSD)
+			}
+		}
+		break
+	}
+	return nil
+}
+
+// Start periodically returns budget-disabled keys to the pool once their
+// monthly spend is back under budget (i.e. a new month started)
+func (t *SpendTracker) Start(ctx context.Context) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.running {
+		return nil
+	}
+
+	ctx, t.cancel = context.WithCancel(ctx)
+	t.running = true
+
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+		ticker := time.NewTicker(t.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				t.restoreAll()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Stop stops the periodic budget check
+func (t *SpendTracker) Stop() {
+	t.mu.Lock()
+	if !t.running {
+		t.mu.Unlock()
+		return
+	}
+	t.running = false
+	t.mu.Unlock()
+
+	t.cancel()
+	t.wg.Wait()
+}
+
+func (t *SpendTracker) restoreAll() {
+	accounts, err := t.store.ListAccountsWithStatus()
+	if err != nil {
+		log.Error().Err(err).Msg("failed to list accounts for budget check")
+		return
+	}
+	for _, account := range accounts {
+		if account.Type == store.AccountTypeAPIKey && isBudgetDisabled(account) {
+			t.restore(account)
+		}
+	}
+}
+
+// restore re-enables a budget-disabled account whose spend is under budget
+func (t *SpendTracker) restore(account *store.Account) {
+	info, err := t.store.GetAPIKeyAccountInfo(account.ID)
+	if err != nil {
+		return
+	}
+	spend, err := t.store.GetAccountSpend(account.ID, store.SpendMonth(t.now()))
+	if err != nil {
+		return
+	}
+	if info != nil && info.MonthlyBudgetUSD > 0 && spend != nil && spend.SpendUSD >= info.MonthlyBudgetUSD {
+		return
+	}
+
+	if err := t.store.UpdateAccountStatus(account.ID, store.AccountStatusActive, ""); err != nil {
+		log.Error().Err(err).Str("account_id", account.ID).Msg("failed to re-enable account")
+		return
+	}
+	t.mu.Lock()
+	t.accounts[account.Credentials.APIKey] = account.ID
+	t.mu.Unlock()
+	if account.IsActive {
+		t.keys.Add(account.Credentials.APIKey)
+	}
+	log.Info().Str("account_id", account.ID).Msg("API key account back under budget, re-enabled")
+}
+
+// isBudgetDisabled reports whether an account was disabled by the spend tracker
+func isBudgetDisabled(account *store.Account) bool {
+	return account.Status == store.AccountStatusDisabled && strings.HasPrefix(account.ErrorMessage, budgetExceededReason)
+}
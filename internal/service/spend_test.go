@@ -0,0 +1,235 @@
+package service
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"ccproxy/internal/notify"
+	"ccproxy/internal/store"
+)
+
+type fakeKeyRegistry struct {
+	keys map[string]bool
+}
+
+func (r *fakeKeyRegistry) Add(key string) bool {
+	if r.keys[key] {
+		return false
+	}
+	r.keys[key] = true
+	return true
+}
+
+func (r *fakeKeyRegistry) Remove(key string) bool {
+	if !r.keys[key] {
+		return false
+	}
+	delete(r.keys, key)
+	return true
+}
+
+type recordingNotifier struct {
+	mu     sync.Mutex
+	events []notify.Event
+}
+
+func (n *recordingNotifier) Notify(event notify.Event) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.events = append(n.events, event)
+}
+
+func newSpendTestStore(t *testing.T) *store.Store {
+	t.Helper()
+	db, err := store.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func createAPIKeyAccount(t *testing.T, db *store.Store, id, key string, budget float64) {
+	t.Helper()
+	account := &store.Account{
+		ID:          id,
+		Name:        id,
+		Type:        store.AccountTypeAPIKey,
+		Credentials: store.Credentials{APIKey: key},
+		CreatedAt:   time.Now(),
+		IsActive:    true,
+	}
+	if err := db.CreateAccount(account); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetAccountMonthlyBudget(id, budget); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func accountStatus(t *testing.T, db *store.Store, id string) store.AccountStatus {
+	t.Helper()
+	accounts, err := db.ListAccountsWithStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, a := range accounts {
+		if a.ID == id {
+			return a.Status
+		}
+	}
+	t.Fatalf("account %s not found", id)
+	return ""
+}
+
+func TestSpendTracker_DisablesKeyOverBudget(t *testing.T) {
+	db := newSpendTestStore(t)
+	createAPIKeyAccount(t, db, "acc-1", "sk-ant-key-1", 1.0)
+
+	keys := &fakeKeyRegistry{keys: map[string]bool{}}
+	notifier := &recordingNotifier{}
+	tracker := NewSpendTracker(db, keys, nil)
+	tracker.SetNotifier(notifier)
+	if err := tracker.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if !keys.keys["sk-ant-key-1"] {
+		t.Fatal("key should be added to the pool on load")
+	}
+
+	// claude-sonnet-4: $3/M input, $15/M output -> $0.60 per call
+	tracker.Record("sk-ant-key-1", "claude-sonnet-4-20250514", 100000, 20000)
+	if !keys.keys["sk-ant-key-1"] {
+		t.Fatal("key should stay in the pool under budget")
+	}
+
+	tracker.Record("sk-ant-key-1", "claude-sonnet-4-20250514", 100000, 20000)
+	if keys.keys["sk-ant-key-1"] {
+		t.Error("key should be removed from the pool over budget")
+	}
+	if status := accountStatus(t, db, "acc-1"); status != store.AccountStatusDisabled {
+		t.Errorf("status = %s, want disabled", status)
+	}
+	if len(notifier.events) != 1 || notifier.events[0].Type != notify.EventAccountBudgetExceeded {
+		t.Fatalf("events = %+v", notifier.events)
+	}
+
+	// Further usage does not alert again
+	tracker.Record("sk-ant-key-1", "claude-sonnet-4-20250514", 1000, 1000)
+	if len(notifier.events) != 1 {
+		t.Errorf("expected a single alert, got %d", len(notifier.events))
+	}
+
+	budget, err := tracker.Budget("acc-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !budget.Exceeded || budget.Requests != 3 || budget.SpendUSD < 1.2 {
+		t.Errorf("unexpected budget: %+v", budget)
+	}
+}
+
+func TestSpendTracker_RestoresInNewMonth(t *testing.T) {
+	db := newSpendTestStore(t)
+	createAPIKeyAccount(t, db, "acc-1", "sk-ant-key-1", 0.5)
+
+	keys := &fakeKeyRegistry{keys: map[string]bool{}}
+	tracker := NewSpendTracker(db, keys, nil)
+	october := time.Date(2026, 10, 20, 12, 0, 0, 0, time.UTC)
+	tracker.now = func() time.Time { return october }
+	if err := tracker.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	tracker.Record("sk-ant-key-1", "claude-sonnet-4", 100000, 20000)
+	if keys.keys["sk-ant-key-1"] {
+		t.Fatal("key should be removed over budget")
+	}
+
+	// Same month: stays disabled
+	tracker.restoreAll()
+	if keys.keys["sk-ant-key-1"] {
+		t.Fatal("key should stay disabled within the month")
+	}
+
+	tracker.now = func() time.Time { return october.AddDate(0, 1, 0) }
+	tracker.restoreAll()
+	if !keys.keys["sk-ant-key-1"] {
+		t.Error("key should return to the pool in a new month")
+	}
+	if status := accountStatus(t, db, "acc-1"); status != store.AccountStatusActive {
+		t.Errorf("status = %s, want active", status)
+	}
+}
+
+func TestSpendTracker_SetBudget(t *testing.T) {
+	db := newSpendTestStore(t)
+	createAPIKeyAccount(t, db, "acc-1", "sk-ant-key-1", 0)
+
+	keys := &fakeKeyRegistry{keys: map[string]bool{}}
+	tracker := NewSpendTracker(db, keys, nil)
+	if err := tracker.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Unlimited budget never disables
+	tracker.Record("sk-ant-key-1", "claude-sonnet-4", 100000, 20000)
+	if !keys.keys["sk-ant-key-1"] {
+		t.Fatal("unlimited key should stay in the pool")
+	}
+
+	// Lowering the budget below current spend disables immediately
+	if err := tracker.SetBudget("acc-1", 0.1); err != nil {
+		t.Fatal(err)
+	}
+	if keys.keys["sk-ant-key-1"] {
+		t.Fatal("key should be removed when budget drops below spend")
+	}
+
+	// Raising it again restores the key
+	if err := tracker.SetBudget("acc-1", 10); err != nil {
+		t.Fatal(err)
+	}
+	if !keys.keys["sk-ant-key-1"] {
+		t.Error("key should be restored when budget is raised")
+	}
+
+	if err := tracker.SetBudget("acc-1", -1); err == nil {
+		t.Error("expected error for negative budget")
+	}
+}
+
+func TestSpendTracker_IgnoresUnknownKeys(t *testing.T) {
+	db := newSpendTestStore(t)
+	tracker := NewSpendTracker(db, &fakeKeyRegistry{keys: map[string]bool{}}, nil)
+
+	tracker.Record("sk-config-key", "claude-sonnet-4", 1000, 1000)
+	spend, err := db.GetAccountSpend("sk-config-key", store.SpendMonth(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spend != nil {
+		t.Errorf("spend recorded for unknown key: %+v", spend)
+	}
+}
+
+func TestMatchesKeyHint(t *testing.T) {
+	key := "sk-ant-REDACTED"
+	tests := []struct {
+		hint string
+		want bool
+	}{
+		{"sk-ant-api03-R2D...igAA", true},
+		{"sk-ant-api03-XYZ...igAA", false},
+		{"sk-ant-api03-R2D...abcd", false},
+		{"sk-ant-api03-R2D", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := matchesKeyHint(key, tt.hint); got != tt.want {
+			t.Errorf("matchesKeyHint(%q) = %v, want %v", tt.hint, got, tt.want)
+		}
+	}
+}
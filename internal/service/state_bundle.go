@@ -0,0 +1,145 @@
+package service
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/scrypt"
+
+	"ccproxy/internal/store"
+)
+
+// State bundles are the state dump as JSON, sealed with AES-256-GCM under a key
+// derived from a passphrase:
+//
+//	magic (8) | scrypt salt (16) | GCM nonce (12) | ciphertext
+//
+// The header is authenticated as additional data.
+var stateBundleMagic = []byte("CCPSTAT1")
+
+const (
+	stateSaltSize = 16
+	// scrypt parameters recommended for interactive use
+	stateScryptN = 1 << 15
+	stateScryptR = 8
+	stateScryptP = 1
+)
+
+// MinStatePassphrase is the shortest passphrase bundles are sealed with; they
+// hold every credential of the instance
+const MinStatePassphrase = 12
+
+var (
+	// ErrStatePassphraseRequired is returned when no passphrase is given
+	ErrStatePassphraseRequired = errors.New("state bundle passphrase is required")
+	// ErrStatePassphraseTooShort is returned when sealing a bundle under a
+	// passphrase shorter than MinStatePassphrase
+	ErrStatePassphraseTooShort = fmt.Errorf("state bundle passphrase must be at least %d characters", MinStatePassphrase)
+	// ErrStateBundleInvalid is returned for data that is not a state bundle, or
+	// that cannot be opened with the passphrase
+	ErrStateBundleInvalid = errors.New("not a state bundle or wrong passphrase")
+)
+
+// EncryptState seals a state dump into a bundle
+func EncryptState(dump *store.StateDump, passphrase string) ([]byte, error) {
+	if passphrase == "" {
+		return nil, ErrStatePassphraseRequired
+	}
+	if len(passphrase) < MinStatePassphrase {
+		return nil, ErrStatePassphraseTooShort
+	}
+	plaintext, err := json.Marshal(dump)
+	if err != nil {
+		return nil, err
+	}
+	return sealWithPassphrase(stateBundleMagic, plaintext, passphrase)
+}
+
+// DecryptState opens a bundle made by EncryptState
+func DecryptState(bundle []byte, passphrase string) (*store.StateDump, error) {
+	if passphrase == "" {
+		return nil, ErrStatePassphraseRequired
+	}
+	plaintext, err := openWithPassphrase(stateBundleMagic, bundle, passphrase)
+	if err == errSealedInvalid {
+		return nil, ErrStateBundleInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep integers exact, e.g. token counters
+	dec := json.NewDecoder(bytes.NewReader(plaintext))
+	dec.UseNumber()
+	var dump store.StateDump
+	if err := dec.Decode(&dump); err != nil {
+		return nil, fmt.Errorf("decode state bundle: %w", err)
+	}
+	return &dump, nil
+}
+
+// errSealedInvalid is returned by openWithPassphrase for data it did not
+// seal, or that cannot be opened with the passphrase
+var errSealedInvalid = errors.New("sealed data invalid")
+
+// sealWithPassphrase seals plaintext in the state bundle layout under magic
+func sealWithPassphrase(magic, plaintext []byte, passphrase string) ([]byte, error) {
+	salt := make([]byte, stateSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	aead, err := stateCipher(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 0, len(magic)+len(salt)+len(nonce))
+	header = append(header, magic...)
+	header = append(header, salt...)
+	header = append(header, nonce...)
+	return aead.Seal(header, nonce, plaintext, header), nil
+}
+
+// openWithPassphrase opens data made by sealWithPassphrase with the same magic
+func openWithPassphrase(magic, sealed []byte, passphrase string) ([]byte, error) {
+	if len(sealed) < len(magic)+stateSaltSize || !bytes.HasPrefix(sealed, magic) {
+		return nil, errSealedInvalid
+	}
+	salt := sealed[len(magic) : len(magic)+stateSaltSize]
+	aead, err := stateCipher(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	headerSize := len(magic) + stateSaltSize + aead.NonceSize()
+	if len(sealed) < headerSize+aead.Overhead() {
+		return nil, errSealedInvalid
+	}
+	header := sealed[:headerSize]
+	nonce := header[len(magic)+stateSaltSize:]
+	plaintext, err := aead.Open(nil, nonce, sealed[headerSize:], header)
+	if err != nil {
+		return nil, errSealedInvalid
+	}
+	return plaintext, nil
+}
+
+func stateCipher(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(passphrase), salt, stateScryptN, stateScryptR, stateScryptP, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
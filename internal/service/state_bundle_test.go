@@ -0,0 +1,142 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"ccproxy/internal/store"
+)
+
+func TestStateBundle_RoundTrip(t *testing.T) {
+	src := newSpendTestStore(t)
+	now := time.Now().Truncate(time.Second)
+
+	createAPIKeyAccount(t, src, "acc-api", "sk-ant-1", 50)
+	if err := src.CreateAccount(&store.Account{
+		ID:          "acc-web",
+		Name:        "web",
+		Type:        store.AccountTypeSessionKey,
+		Credentials: store.Credentials{SessionKey: "sk-ant-sid01-x"},
+		CreatedAt:   now,
+		IsActive:    true,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := src.SetAccountNetwork("acc-web", &store.AccountNetwork{LocalAddr: "10.0.0.5"}); err != nil {
+		t.Fatal(err)
+	}
+	drainUntil := now.Add(time.Hour)
+	if _, err := src.StartAccountDrain("acc-web", drainUntil); err != nil {
+		t.Fatal(err)
+	}
+	if err := src.CreateToken(&store.Token{
+		ID:        "tok-1",
+		UserName:  "alice",
+		Mode:      "api",
+		CreatedAt: now,
+		ExpiresAt: now.Add(24 * time.Hour),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := src.CreateJWTKey(&store.JWTKey{ID: "key-1", Secret: "s3cret", Active: true, CreatedAt: now}); err != nil {
+		t.Fatal(err)
+	}
+
+	dump, err := src.ExportState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundle, err := EncryptState(dump, "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := DecryptState(bundle, "wrong horse"); !errors.Is(err, ErrStateBundleInvalid) {
+		t.Errorf("wrong passphrase: err = %v", err)
+	}
+	tampered := append([]byte(nil), bundle...)
+	tampered[len(tampered)-1] ^= 1
+	if _, err := DecryptState(tampered, "correct horse"); !errors.Is(err, ErrStateBundleInvalid) {
+		t.Errorf("tampered bundle: err = %v", err)
+	}
+	if _, err := EncryptState(dump, "short"); !errors.Is(err, ErrStatePassphraseTooShort) {
+		t.Errorf("short passphrase: err = %v", err)
+	}
+	if _, err := EncryptState(dump, ""); !errors.Is(err, ErrStatePassphraseRequired) {
+		t.Errorf("empty passphrase: err = %v", err)
+	}
+
+	restored, err := DecryptState(bundle, "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst := newSpendTestStore(t)
+	result, err := dst.ImportState(restored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Rows["accounts"] != 2 || result.Rows["tokens"] != 1 || result.Rows["jwt_keys"] != 1 {
+		t.Errorf("rows = %v", result.Rows)
+	}
+
+	web, err := dst.GetAccount("acc-web")
+	if err != nil || web == nil {
+		t.Fatalf("GetAccount: %v, %v", web, err)
+	}
+	if web.Credentials.SessionKey != "sk-ant-sid01-x" || web.Network == nil || web.Network.LocalAddr != "10.0.0.5" {
+		t.Errorf("restored account = %+v", web)
+	}
+	if budget, err := dst.GetAPIKeyAccountInfo("acc-api"); err != nil || budget == nil || budget.MonthlyBudgetUSD != 50 {
+		t.Errorf("restored api key account = %+v, %v", budget, err)
+	}
+	tok, err := dst.GetToken("tok-1")
+	if err != nil || tok == nil || tok.UserName != "alice" || !tok.ExpiresAt.Equal(now.Add(24*time.Hour)) {
+		t.Errorf("restored token = %+v, %v", tok, err)
+	}
+	keys, err := dst.ListJWTKeys()
+	if err != nil || len(keys) != 1 || !keys[0].Active || keys[0].Secret != "s3cret" {
+		t.Errorf("restored keys = %+v, %v", keys, err)
+	}
+
+	// Restored timestamps still compare correctly in SQL
+	if ids, err := dst.CompleteExpiredDrains(now); err != nil || len(ids) != 0 {
+		t.Errorf("drain completed early: %v, %v", ids, err)
+	}
+	if ids, err := dst.CompleteExpiredDrains(drainUntil.Add(time.Second)); err != nil || len(ids) != 1 {
+		t.Errorf("drain not completed: %v, %v", ids, err)
+	}
+
+	// Importing again updates rows in place
+	if _, err := dst.ImportState(restored); err != nil {
+		t.Fatalf("re-import: %v", err)
+	}
+	if web, _ := dst.GetAccount("acc-web"); web == nil || !web.IsActive {
+		t.Errorf("re-import did not restore the account: %+v", web)
+	}
+}
+
+func TestStateBundle_ImportSkipsUnknownColumns(t *testing.T) {
+	db := newSpendTestStore(t)
+	dump := &store.StateDump{
+		Version: store.StateDumpVersion,
+		Tables: map[string]*store.TableState{
+			"account_templates": {
+				Columns: []string{"id", "name", "created_at", "updated_at", "color"},
+				Rows:    [][]interface{}{{"tpl-1", "default", "2026-01-02T03:04:05Z", "2026-01-02T03:04:05Z", "blue"}},
+			},
+		},
+	}
+	result, err := db.ImportState(dump)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cols := result.SkippedColumns["account_templates"]; len(cols) != 1 || cols[0] != "color" {
+		t.Errorf("skipped = %v", result.SkippedColumns)
+	}
+
+	dump.Version = 99
+	if _, err := db.ImportState(dump); err == nil {
+		t.Error("unsupported version was imported")
+	}
+}
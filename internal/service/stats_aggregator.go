@@ -13,6 +13,37 @@ const (
 	DefaultAggregationInterval = 24 * time.Hour
 )
 
+// dailyAggregationQuery rolls up one day of request logs into usage_stats_daily,
+// including latency histograms for percentiles
+var dailyAggregationQuery = `
+		INSERT OR REPLACE INTO usage_stats_daily (
+			stat_date, token_id, account_id, mode, model,
+			request_count, success_count, error_count,
+			total_prompt_tokens, total_completion_tokens, total_tokens,
+			avg_duration_ms, avg_ttft_ms, duration_histogram, ttft_histogram, created_at
+		)
+		SELECT
+			DATE(request_at) as stat_date,
+			token_id,
+			account_id,
+			mode,
+			model,
+			COUNT(*) as request_count,
+			SUM(CASE WHEN success = 1 THEN 1 ELSE 0 END) as success_count,
+			SUM(CASE WHEN success = 0 THEN 1 ELSE 0 END) as error_count,
+			SUM(prompt_tokens) as total_prompt_tokens,
+			SUM(completion_tokens) as total_completion_tokens,
+			SUM(total_tokens) as total_tokens,
+			AVG(duration_ms) as avg_duration_ms,
+			AVG(ttft_ms) as avg_ttft_ms,
+			` + store.LatencyHistogramSQL("duration_ms") + ` as duration_histogram,
+			` + store.LatencyHistogramSQL("ttft_ms") + ` as ttft_histogram,
+			datetime('now') as created_at
+		FROM request_logs
+		WHERE DATE(request_at) = ?
+		GROUP BY DATE(request_at), token_id, account_id, mode, model
+	`
+
 type StatsAggregator struct {
 	store    *store.Store
 	interval time.Duration
@@ -113,35 +144,7 @@ func (sa *StatsAggregator) runAggregation() error {
 
 	log.Info().Str("date", yesterdayStr).Msg("Running stats aggregation")
 
-	// Aggregation query
-	query := `
-		INSERT OR REPLACE INTO usage_stats_daily (
-			stat_date, token_id, account_id, mode, model,
-			request_count, success_count, error_count,
-			total_prompt_tokens, total_completion_tokens, total_tokens,
-			avg_duration_ms, avg_ttft_ms, created_at
-		)
-		SELECT
-			DATE(request_at) as stat_date,
-			token_id,
-			account_id,
-			mode,
-			model,
-			COUNT(*) as request_count,
-			SUM(CASE WHEN success = 1 THEN 1 ELSE 0 END) as success_count,
-			SUM(CASE WHEN success = 0 THEN 1 ELSE 0 END) as error_count,
-			SUM(prompt_tokens) as total_prompt_tokens,
-			SUM(completion_tokens) as total_completion_tokens,
-			SUM(total_tokens) as total_tokens,
-			AVG(duration_ms) as avg_duration_ms,
-			AVG(ttft_ms) as avg_ttft_ms,
-			datetime('now') as created_at
-		FROM request_logs
-		WHERE DATE(request_at) = ?
-		GROUP BY DATE(request_at), token_id, account_id, mode, model
-	`
-
-	result, err := sa.store.GetDB().Exec(query, yesterdayStr)
+	result, err := sa.store.GetDB().Exec(dailyAggregationQuery, yesterdayStr)
 	if err != nil {
 		return err
 	}
@@ -163,34 +166,7 @@ func (sa *StatsAggregator) AggregateDate(date time.Time) error {
 	dateStr := date.Format("2006-01-02")
 	log.Info().Str("date", dateStr).Msg("Running manual stats aggregation")
 
-	query := `
-		INSERT OR REPLACE INTO usage_stats_daily (
-			stat_date, token_id, account_id, mode, model,
-			request_count, success_count, error_count,
-			total_prompt_tokens, total_completion_tokens, total_tokens,
-			avg_duration_ms, avg_ttft_ms, created_at
-		)
-		SELECT
-			DATE(request_at) as stat_date,
-			token_id,
-			account_id,
-			mode,
-			model,
-			COUNT(*) as request_count,
-			SUM(CASE WHEN success = 1 THEN 1 ELSE 0 END) as success_count,
-			SUM(CASE WHEN success = 0 THEN 1 ELSE 0 END) as error_count,
-			SUM(prompt_tokens) as total_prompt_tokens,
-			SUM(completion_tokens) as total_completion_tokens,
-			SUM(total_tokens) as total_tokens,
-			AVG(duration_ms) as avg_duration_ms,
-			AVG(ttft_ms) as avg_ttft_ms,
-			datetime('now') as created_at
-		FROM request_logs
-		WHERE DATE(request_at) = ?
-		GROUP BY DATE(request_at), token_id, account_id, mode, model
-	`
-
-	result, err := sa.store.GetDB().Exec(query, dateStr)
+	result, err := sa.store.GetDB().Exec(dailyAggregationQuery, dateStr)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,83 @@
+package service
+
+import (
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	"ccproxy/internal/store"
+)
+
+func TestStatsAggregator_LatencyPercentiles(t *testing.T) {
+	db := newSpendTestStore(t)
+	day := time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)
+
+	// 100 sonnet requests on acc-a taking 1..100 ms, and a slow tail of five
+	// 40 s opus requests on acc-b
+	logRequest := func(i int, account, model string, duration time.Duration) {
+		t.Helper()
+		if err := db.CreateRequestLog(&store.RequestLog{
+			ID:         fmt.Sprintf("log-%d", i),
+			TokenID:    "tok-1",
+			AccountID:  sql.NullString{String: account, Valid: true},
+			Mode:       "api",
+			Model:      model,
+			RequestAt:  day.Add(time.Duration(i) * time.Minute),
+			DurationMs: sql.NullInt64{Int64: duration.Milliseconds(), Valid: true},
+			TTFTMs:     sql.NullInt64{Int64: 80, Valid: true},
+			Success:    true,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 1; i <= 100; i++ {
+		logRequest(i, "acc-a", "claude-sonnet-4", time.Duration(i)*time.Millisecond)
+	}
+	for i := 101; i <= 105; i++ {
+		logRequest(i, "acc-b", "claude-opus-4", 40*time.Second)
+	}
+
+	if err := NewStatsAggregator(db, time.Hour).AggregateDate(day); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := db.GetAccountStats("acc-a", day, day)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := stats.DurationPercentiles
+	if p == nil || p.Samples != 100 {
+		t.Fatalf("duration percentiles = %+v", p)
+	}
+	// Exact values are 50 and 95 ms; buckets are [25, 50), [50, 100)
+	if p.P50 < 45 || p.P50 > 55 || p.P95 < 90 || p.P95 > 100 {
+		t.Errorf("acc-a percentiles = %+v", p)
+	}
+	if stats.TTFTPercentiles == nil || stats.TTFTPercentiles.P99 < 50 || stats.TTFTPercentiles.P99 >= 100 {
+		t.Errorf("ttft percentiles = %+v", stats.TTFTPercentiles)
+	}
+
+	// The token sees the opus tail in p99 and per model
+	stats, err = db.GetTokenStats("tok-1", day, day)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := stats.DurationPercentiles; p.Samples != 105 || p.P50 > 100 || p.P99 < 30000 {
+		t.Errorf("token percentiles = %+v", p)
+	}
+	if opus := stats.LatencyByModel["claude-opus-4"]; opus == nil || opus.P50 < 30000 || opus.P50 > 45000 {
+		t.Errorf("opus percentiles = %+v", opus)
+	}
+
+	overview, err := db.GetGlobalOverview(day, day)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m := overview.ByModel["claude-sonnet-4"]; m == nil || m.DurationPercentiles == nil || m.DurationPercentiles.P95 > 100 {
+		t.Errorf("overview sonnet = %+v", m)
+	}
+	if m := overview.ByMode["api"]; m == nil || m.DurationPercentiles == nil || m.DurationPercentiles.Samples != 105 {
+		t.Errorf("overview api = %+v", m)
+	}
+}
@@ -0,0 +1,127 @@
+package service
+
+import "strings"
+
+// Diff operations
+const (
+	DiffEqual  = "equal"  // Lines in both inputs
+	DiffDelete = "delete" // Lines only in the first input
+	DiffInsert = "insert" // Lines only in the second input
+)
+
+// maxDiffCells bounds the LCS table of a diff. Larger inputs, after removing
+// their common prefix and suffix, are diffed as a whole replacement.
+const maxDiffCells = 4 << 20
+
+// DiffOp is a run of consecutive items with the same operation
+type DiffOp struct {
+	Op    string   `json:"op"`
+	Lines []string `json:"lines"`
+}
+
+// DiffLines returns the line diff turning a into b
+func DiffLines(a, b string) []DiffOp {
+	return DiffSequences(splitLines(a), splitLines(b))
+}
+
+// DiffSequences returns a minimal diff turning a into b, as runs of equal,
+// deleted and inserted items in order
+func DiffSequences(a, b []string) []DiffOp {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var ops []DiffOp
+	add := func(op, line string) {
+		if n := len(ops); n > 0 && ops[n-1].Op == op {
+			ops[n-1].Lines = append(ops[n-1].Lines, line)
+			return
+		}
+		ops = append(ops, DiffOp{Op: op, Lines: []string{line}})
+	}
+
+	for _, line := range a[:prefix] {
+		add(DiffEqual, line)
+	}
+	midA, midB := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	if (len(midA)+1)*(len(midB)+1) > maxDiffCells {
+		for _, line := range midA {
+			add(DiffDelete, line)
+		}
+		for _, line := range midB {
+			add(DiffInsert, line)
+		}
+	} else {
+		// lcs[i][j] is the longest common subsequence of midA[i:] and midB[j:]
+		lcs := make([][]int, len(midA)+1)
+		for i := range lcs {
+			lcs[i] = make([]int, len(midB)+1)
+		}
+		for i := len(midA) - 1; i >= 0; i-- {
+			for j := len(midB) - 1; j >= 0; j-- {
+				if midA[i] == midB[j] {
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				} else if lcs[i+1][j] >= lcs[i][j+1] {
+					lcs[i][j] = lcs[i+1][j]
+				} else {
+					lcs[i][j] = lcs[i][j+1]
+				}
+			}
+		}
+		i, j := 0, 0
+		for i < len(midA) && j < len(midB) {
+			switch {
+			case midA[i] == midB[j]:
+				add(DiffEqual, midA[i])
+				i++
+				j++
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				add(DiffDelete, midA[i])
+				i++
+			default:
+				add(DiffInsert, midB[j])
+				j++
+			}
+		}
+		for ; i < len(midA); i++ {
+			add(DiffDelete, midA[i])
+		}
+		for ; j < len(midB); j++ {
+			add(DiffInsert, midB[j])
+		}
+	}
+	for _, line := range a[len(a)-suffix:] {
+		add(DiffEqual, line)
+	}
+	return ops
+}
+
+// DiffSimilarity is the share of items a diff keeps equal, from 0 for
+// nothing in common to 1 for identical inputs. Two empty inputs are identical.
+func DiffSimilarity(ops []DiffOp) float64 {
+	var equal, total int
+	for _, op := range ops {
+		if op.Op == DiffEqual {
+			equal += 2 * len(op.Lines)
+			total += 2 * len(op.Lines)
+		} else {
+			total += len(op.Lines)
+		}
+	}
+	if total == 0 {
+		return 1
+	}
+	return float64(equal) / float64(total)
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
@@ -0,0 +1,48 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestDiffLines(t *testing.T) {
+	ops := DiffLines("a\nb\nc\nd\n", "a\nx\nc\nd\ne")
+	want := "equal[a] delete[b] insert[x] equal[c d] insert[e]"
+	if got := formatDiff(ops); got != want {
+		t.Errorf("diff = %s, want %s", got, want)
+	}
+	if s := DiffSimilarity(ops); s != 6.0/9 {
+		t.Errorf("similarity = %v", s)
+	}
+
+	if ops := DiffLines("", ""); len(ops) != 0 || DiffSimilarity(ops) != 1 {
+		t.Errorf("empty diff = %v", ops)
+	}
+	if got := formatDiff(DiffLines("", "new")); got != "insert[new]" {
+		t.Errorf("insert only = %s", got)
+	}
+}
+
+func TestDiffSequences_LargeInputs(t *testing.T) {
+	// Past the LCS size bound, the differing middle is replaced as a whole
+	n := 3000
+	a, b := make([]string, n), make([]string, n)
+	for i := range a {
+		a[i] = fmt.Sprint("a", i)
+		b[i] = fmt.Sprint("b", i)
+	}
+	a[0], b[0] = "same", "same"
+	ops := DiffSequences(a, b)
+	if len(ops) != 3 || ops[0].Op != DiffEqual || len(ops[1].Lines) != n-1 || ops[2].Op != DiffInsert {
+		t.Errorf("ops = %d runs", len(ops))
+	}
+}
+
+func formatDiff(ops []DiffOp) string {
+	parts := make([]string, len(ops))
+	for i, op := range ops {
+		parts[i] = op.Op + "[" + strings.Join(op.Lines, " ") + "]"
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,36 @@
+package service
+
+import "unicode/utf8"
+
+// estimateMessageOverhead approximates the tokens a message adds around its
+// content (role and turn markers)
+const estimateMessageOverhead = 4
+
+// EstimateTokens approximates the token count of text without a tokenizer:
+// about four bytes per token for ASCII text and a token per character for
+// other scripts, which tokenize much less densely. It is meant for previews
+// when count_tokens is unavailable, not for billing.
+func EstimateTokens(text string) int {
+	if text == "" {
+		return 0
+	}
+	ascii, other := 0, 0
+	for _, r := range text {
+		if r < utf8.RuneSelf {
+			ascii++
+		} else {
+			other++
+		}
+	}
+	return (ascii+3)/4 + other
+}
+
+// EstimateMessageTokens approximates the input tokens of a request from its
+// system prompt, message texts and the JSON of its tool definitions
+func EstimateMessageTokens(system string, messages []string, tools string) int {
+	total := EstimateTokens(system) + EstimateTokens(tools)
+	for _, m := range messages {
+		total += EstimateTokens(m) + estimateMessageOverhead
+	}
+	return total
+}
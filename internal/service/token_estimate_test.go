@@ -0,0 +1,25 @@
+package service
+
+import "testing"
+
+func TestEstimateTokens(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"", 0},
+		{"abc", 1},
+		{"Hello, world!", 4},
+		{"你好世界", 4},
+		{"hi 你好", 3},
+	}
+	for _, tt := range tests {
+		if got := EstimateTokens(tt.text); got != tt.want {
+			t.Errorf("EstimateTokens(%q) = %d, want %d", tt.text, got, tt.want)
+		}
+	}
+
+	if got := EstimateMessageTokens("be brief", []string{"Hello, world!", ""}, ""); got != 2+4+2*estimateMessageOverhead {
+		t.Errorf("EstimateMessageTokens = %d, want %d", got, 2+4+2*estimateMessageOverhead)
+	}
+}
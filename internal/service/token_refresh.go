@@ -0,0 +1,60 @@
+package service
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var errRefreshAborted = errors.New("token refresh aborted")
+
+// refreshedToken is the outcome of a token refresh shared with waiting callers
+type refreshedToken struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresAt    time.Time
+}
+
+// refreshCall is an in-flight refresh for one account
+type refreshCall struct {
+	done   chan struct{}
+	result *refreshedToken
+	err    error
+}
+
+// refreshGroup ensures only one token refresh runs per account at a time.
+// Concurrent callers for the same account wait for the in-flight refresh and
+// share its result instead of spending the (single-use) refresh token again.
+type refreshGroup struct {
+	mu    sync.Mutex
+	calls map[string]*refreshCall
+}
+
+func newRefreshGroup() *refreshGroup {
+	return &refreshGroup{calls: make(map[string]*refreshCall)}
+}
+
+// do runs fn for accountID unless a refresh is already in flight, in which
+// case it waits for that one. shared reports whether the result came from
+// another caller's refresh.
+func (g *refreshGroup) do(accountID string, fn func() (*refreshedToken, error)) (result *refreshedToken, shared bool, err error) {
+	g.mu.Lock()
+	if call, ok := g.calls[accountID]; ok {
+		g.mu.Unlock()
+		<-call.done
+		return call.result, true, call.err
+	}
+	call := &refreshCall{done: make(chan struct{}), err: errRefreshAborted}
+	g.calls[accountID] = call
+	g.mu.Unlock()
+
+	defer func() {
+		g.mu.Lock()
+		delete(g.calls, accountID)
+		g.mu.Unlock()
+		close(call.done)
+	}()
+
+	call.result, call.err = fn()
+	return call.result, false, call.err
+}
@@ -0,0 +1,116 @@
+package service
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRefreshGroup_CollapsesConcurrentCalls(t *testing.T) {
+	g := newRefreshGroup()
+	release := make(chan struct{})
+	var calls int32
+
+	fn := func() (*refreshedToken, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return &refreshedToken{AccessToken: "new-token"}, nil
+	}
+
+	const callers = 10
+	var wg sync.WaitGroup
+	var sharedCount int32
+	tokens := make([]string, callers)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		token, _, err := g.do("acc-1", fn)
+		if err == nil {
+			tokens[0] = token.AccessToken
+		}
+	}()
+
+	// Wait until the first refresh is in flight
+	for atomic.LoadInt32(&calls) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	for i := 1; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			token, shared, err := g.do("acc-1", fn)
+			if err == nil {
+				tokens[i] = token.AccessToken
+			}
+			if shared {
+				atomic.AddInt32(&sharedCount, 1)
+			}
+		}(i)
+	}
+
+	// Give waiters time to join before releasing the refresh
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if calls != 1 {
+		t.Errorf("refresh ran %d times, want 1", calls)
+	}
+	if sharedCount != callers-1 {
+		t.Errorf("shared = %d, want %d", sharedCount, callers-1)
+	}
+	for i, token := range tokens {
+		if token != "new-token" {
+			t.Errorf("caller %d got token %q", i, token)
+		}
+	}
+}
+
+func TestRefreshGroup_SharesErrorAndAllowsRetry(t *testing.T) {
+	g := newRefreshGroup()
+	wantErr := errors.New("invalid_grant")
+
+	if _, _, err := g.do("acc-1", func() (*refreshedToken, error) { return nil, wantErr }); err != wantErr {
+		t.Fatalf("err = %v, want %v", err, wantErr)
+	}
+
+	// A finished refresh must not block or be reused by the next one
+	token, shared, err := g.do("acc-1", func() (*refreshedToken, error) {
+		return &refreshedToken{AccessToken: "retry"}, nil
+	})
+	if err != nil || shared || token.AccessToken != "retry" {
+		t.Errorf("retry: token=%v shared=%v err=%v", token, shared, err)
+	}
+}
+
+func TestRefreshGroup_IndependentAccounts(t *testing.T) {
+	g := newRefreshGroup()
+	release := make(chan struct{})
+	started := make(chan struct{})
+
+	go func() {
+		_, _, _ = g.do("acc-1", func() (*refreshedToken, error) {
+			close(started)
+			<-release
+			return &refreshedToken{}, nil
+		})
+	}()
+	<-started
+
+	done := make(chan struct{})
+	go func() {
+		_, _, _ = g.do("acc-2", func() (*refreshedToken, error) { return &refreshedToken{}, nil })
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("refresh of another account was blocked")
+	}
+	close(release)
+}
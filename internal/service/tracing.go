@@ -0,0 +1,158 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	mathrand "math/rand"
+	"strings"
+	"sync"
+
+	"ccproxy/internal/store"
+)
+
+// TracingConfig controls the W3C trace context sent to the Anthropic API
+type TracingConfig struct {
+	Propagate     bool    // Forward the client's traceparent/tracestate upstream
+	SamplePercent float64 // Share of requests without a client trace that start a new sampled trace, 0-100
+}
+
+// TraceContext holds the trace headers for one upstream request
+type TraceContext struct {
+	Traceparent string
+	Tracestate  string
+	TraceID     string
+}
+
+// Tracer decides which trace headers accompany upstream Anthropic API
+// requests. Accounts may override the global sampling rate; an override of 0
+// sends no trace headers for that account at all.
+type Tracer struct {
+	store  *store.Store
+	cfg    TracingConfig
+	random func() float64 // returns [0, 100)
+
+	mu        sync.RWMutex
+	overrides map[string]float64 // account ID -> sample percent
+}
+
+// NewTracer creates a tracer; call Load to read per-account overrides
+func NewTracer(store *store.Store, cfg TracingConfig) *Tracer {
+	return &Tracer{
+		store:     store,
+		cfg:       cfg,
+		random:    func() float64 { return mathrand.Float64() * 100 },
+		overrides: make(map[string]float64),
+	}
+}
+
+// Load reads per-account sampling overrides from the store
+func (t *Tracer) Load() error {
+	overrides, err := t.store.ListAccountTraceSampling()
+	if err != nil {
+		return err
+	}
+	t.mu.Lock()
+	t.overrides = overrides
+	t.mu.Unlock()
+	return nil
+}
+
+// SetAccountSampling sets an account's sampling override; nil restores the global rate
+func (t *Tracer) SetAccountSampling(accountID string, percent *float64) error {
+	if percent != nil && (*percent < 0 || *percent > 100) {
+		return fmt.Errorf("sample percent must be between 0 and 100")
+	}
+	if err := t.store.SetAccountTraceSampling(accountID, percent); err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if percent == nil {
+		delete(t.overrides, accountID)
+	} else {
+		t.overrides[accountID] = *percent
+	}
+	return nil
+}
+
+// AccountSampling returns the effective sampling percentage for an account and
+// whether it is overridden
+func (t *Tracer) AccountSampling(accountID string) (float64, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if percent, ok := t.overrides[accountID]; ok {
+		return percent, true
+	}
+	return t.cfg.SamplePercent, false
+}
+
+// Context returns the trace headers for an upstream request made on behalf of
+// accountID ("" for pooled config keys). A valid client traceparent is
+// continued with a new parent ID when propagation is enabled; otherwise a new
+// sampled trace is started for the configured share of requests.
+func (t *Tracer) Context(accountID, traceparent, tracestate string) TraceContext {
+	percent, overridden := t.AccountSampling(accountID)
+	if overridden && percent <= 0 {
+		return TraceContext{}
+	}
+
+	if t.cfg.Propagate {
+		if traceID, flags, ok := parseTraceparent(traceparent); ok {
+			return TraceContext{
+				Traceparent: formatTraceparent(traceID, flags),
+				Tracestate:  tracestate,
+				TraceID:     traceID,
+			}
+		}
+	}
+
+	if percent <= 0 || t.random() >= percent {
+		return TraceContext{}
+	}
+	traceID := randomHex(16)
+	return TraceContext{
+		Traceparent: formatTraceparent(traceID, "01"),
+		TraceID:     traceID,
+	}
+}
+
+// parseTraceparent validates a version 00 W3C traceparent header
+func parseTraceparent(header string) (traceID, flags string, ok bool) {
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) != 4 || parts[0] != "00" {
+		return "", "", false
+	}
+	traceID, parentID, flags := parts[1], parts[2], parts[3]
+	if len(traceID) != 32 || len(parentID) != 16 || len(flags) != 2 {
+		return "", "", false
+	}
+	if !isLowerHex(traceID) || !isLowerHex(parentID) || !isLowerHex(flags) {
+		return "", "", false
+	}
+	if strings.Trim(traceID, "0") == "" || strings.Trim(parentID, "0") == "" {
+		return "", "", false
+	}
+	return traceID, flags, true
+}
+
+// formatTraceparent builds a traceparent with a fresh parent ID for the proxy hop
+func formatTraceparent(traceID, flags string) string {
+	return "00-" + traceID + "-" + randomHex(8) + "-" + flags
+}
+
+func isLowerHex(s string) bool {
+	for _, r := range s {
+		if !(r >= '0' && r <= '9' || r >= 'a' && r <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
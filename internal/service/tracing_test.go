@@ -0,0 +1,109 @@
+package service
+
+import (
+	"strings"
+	"testing"
+)
+
+const clientTraceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func newTestTracer(t *testing.T, cfg TracingConfig, roll float64) *Tracer {
+	t.Helper()
+	tracer := NewTracer(newSpendTestStore(t), cfg)
+	tracer.random = func() float64 { return roll }
+	return tracer
+}
+
+func TestTracer_PropagatesClientTrace(t *testing.T) {
+	tracer := newTestTracer(t, TracingConfig{Propagate: true}, 99)
+
+	tc := tracer.Context("", clientTraceparent, "vendor=abc")
+	if tc.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || tc.Tracestate != "vendor=abc" {
+		t.Fatalf("unexpected trace context: %+v", tc)
+	}
+	if !strings.HasPrefix(tc.Traceparent, "00-4bf92f3577b34da6a3ce929d0e0e4736-") || !strings.HasSuffix(tc.Traceparent, "-01") {
+		t.Errorf("traceparent = %q", tc.Traceparent)
+	}
+	if strings.Contains(tc.Traceparent, "00f067aa0ba902b7") {
+		t.Error("expected a new parent ID for the proxy hop")
+	}
+
+	// Malformed headers are not forwarded
+	for _, header := range []string{
+		"garbage",
+		"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+	} {
+		if tc := tracer.Context("", header, ""); tc.Traceparent != "" {
+			t.Errorf("header %q: got traceparent %q", header, tc.Traceparent)
+		}
+	}
+
+	// Propagation disabled ignores the client trace
+	tracer = newTestTracer(t, TracingConfig{}, 99)
+	if tc := tracer.Context("", clientTraceparent, ""); tc.Traceparent != "" {
+		t.Errorf("propagation disabled: got %q", tc.Traceparent)
+	}
+}
+
+func TestTracer_Sampling(t *testing.T) {
+	sampled := newTestTracer(t, TracingConfig{SamplePercent: 10}, 5)
+	tc := sampled.Context("", "", "")
+	if len(tc.TraceID) != 32 || !strings.HasSuffix(tc.Traceparent, "-01") {
+		t.Errorf("expected a sampled trace, got %+v", tc)
+	}
+
+	unsampled := newTestTracer(t, TracingConfig{SamplePercent: 10}, 50)
+	if tc := unsampled.Context("", "", ""); tc.Traceparent != "" {
+		t.Errorf("expected no trace, got %+v", tc)
+	}
+}
+
+func TestTracer_AccountOverride(t *testing.T) {
+	db := newSpendTestStore(t)
+	createAPIKeyAccount(t, db, "acc-1", "sk-ant-api03-trace", 0)
+
+	tracer := NewTracer(db, TracingConfig{Propagate: true, SamplePercent: 0})
+	tracer.random = func() float64 { return 50 }
+
+	full := 100.0
+	if err := tracer.SetAccountSampling("acc-1", &full); err != nil {
+		t.Fatal(err)
+	}
+	if tc := tracer.Context("acc-1", "", ""); tc.Traceparent == "" {
+		t.Error("expected override to sample the account")
+	}
+	if tc := tracer.Context("", "", ""); tc.Traceparent != "" {
+		t.Error("expected global rate for other accounts")
+	}
+
+	// Zero disables trace headers for the account, even client traces
+	zero := 0.0
+	if err := tracer.SetAccountSampling("acc-1", &zero); err != nil {
+		t.Fatal(err)
+	}
+	if tc := tracer.Context("acc-1", clientTraceparent, ""); tc.Traceparent != "" {
+		t.Errorf("expected no trace headers, got %q", tc.Traceparent)
+	}
+
+	// Overrides survive a reload and can be cleared
+	reloaded := NewTracer(db, TracingConfig{SamplePercent: 0})
+	if err := reloaded.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if percent, ok := reloaded.AccountSampling("acc-1"); !ok || percent != 0 {
+		t.Errorf("reloaded override = %v, %v", percent, ok)
+	}
+	if err := reloaded.SetAccountSampling("acc-1", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := reloaded.AccountSampling("acc-1"); ok {
+		t.Error("expected override to be cleared")
+	}
+
+	invalid := 101.0
+	if err := tracer.SetAccountSampling("acc-1", &invalid); err == nil {
+		t.Error("expected out of range percent to fail")
+	}
+}
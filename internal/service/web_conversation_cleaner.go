@@ -0,0 +1,285 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"ccproxy/internal/store"
+)
+
+// Defaults for deleting proxy-created claude.ai conversations
+const (
+	DefaultWebConversationRetention   = time.Hour
+	DefaultWebConversationInterval    = time.Minute
+	DefaultWebConversationBatchSize   = 50
+	DefaultWebConversationMaxAttempts = 5
+)
+
+// AccountDoer sends a request through an account's egress, e.g. the
+// connection pool
+type AccountDoer interface {
+	Do(req *http.Request, accountID string) (*http.Response, error)
+}
+
+// TokenRefresher refreshes the access token of an OAuth account in place
+type TokenRefresher interface {
+	RefreshAccountToken(account *store.Account) error
+}
+
+// WebConversationCleanerConfig configures the deletion of the claude.ai
+// conversations created for web mode requests
+type WebConversationCleanerConfig struct {
+	WebURL      string
+	Retention   time.Duration // How long after its creation a conversation is deleted
+	Interval    time.Duration // How often due conversations are deleted
+	BatchSize   int           // Conversations deleted per run
+	MaxAttempts int           // Failed deletions after which a conversation is no longer tracked
+}
+
+// WebConversationCleaner deletes the claude.ai conversations the proxy created
+// once their retention has passed. Web mode creates a conversation per request,
+// which would otherwise pile up in the account's history.
+type WebConversationCleaner struct {
+	store       *store.Store
+	cfg         WebConversationCleanerConfig
+	now         func() time.Time
+	doer        AccountDoer
+	betaHeaders *BetaHeaders
+	refresher   TokenRefresher
+
+	mu      sync.Mutex
+	running bool
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+// NewWebConversationCleaner creates a web conversation cleaner
+func NewWebConversationCleaner(store *store.Store, cfg WebConversationCleanerConfig) *WebConversationCleaner {
+	if cfg.Retention <= 0 {
+		cfg.Retention = DefaultWebConversationRetention
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = DefaultWebConversationInterval
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = DefaultWebConversationBatchSize
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = DefaultWebConversationMaxAttempts
+	}
+	return &WebConversationCleaner{
+		store: store,
+		cfg:   cfg,
+		now:   time.Now,
+		doer:  defaultAccountDoer{client: &http.Client{Timeout: 30 * time.Second}},
+	}
+}
+
+// SetAccountDoer sends deletions through d instead of a plain HTTP client
+func (w *WebConversationCleaner) SetAccountDoer(d AccountDoer) {
+	w.doer = d
+}
+
+// SetBetaHeaders sets the anthropic-beta profiles of OAuth deletions
+func (w *WebConversationCleaner) SetBetaHeaders(b *BetaHeaders) {
+	w.betaHeaders = b
+}
+
+// SetTokenRefresher refreshes expiring OAuth tokens before a deletion
+func (w *WebConversationCleaner) SetTokenRefresher(r TokenRefresher) {
+	w.refresher = r
+}
+
+// Track records a conversation created on an account for later deletion. A
+// nil cleaner tracks nothing.
+func (w *WebConversationCleaner) Track(account *store.Account, conversationID string) {
+	if w == nil || account == nil {
+		return
+	}
+	err := w.store.RecordWebConversation(&store.WebConversation{
+		ID:             conversationID,
+		AccountID:      account.ID,
+		OrganizationID: account.OrganizationID,
+		CreatedAt:      w.now(),
+	})
+	if err != nil {
+		log.Error().Err(err).Str("account_id", account.ID).Str("conversation_id", conversationID).
+			Msg("failed to track web conversation")
+	}
+}
+
+// Start deletes due conversations immediately and then periodically
+func (w *WebConversationCleaner) Start(ctx context.Context) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.running {
+		return nil
+	}
+
+	ctx, w.cancel = context.WithCancel(ctx)
+	w.running = true
+
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		w.Cleanup(ctx)
+
+		ticker := time.NewTicker(w.cfg.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				w.Cleanup(ctx)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	log.Info().
+		Dur("retention", w.cfg.Retention).
+		Dur("interval", w.cfg.Interval).
+		Msg("Web conversation cleaner started")
+	return nil
+}
+
+// Stop stops the web conversation cleaner
+func (w *WebConversationCleaner) Stop() {
+	w.mu.Lock()
+	if !w.running {
+		w.mu.Unlock()
+		return
+	}
+	w.running = false
+	w.mu.Unlock()
+
+	w.cancel()
+	w.wg.Wait()
+}
+
+// Cleanup deletes one batch of conversations past their retention and returns
+// how many were deleted upstream
+func (w *WebConversationCleaner) Cleanup(ctx context.Context) int {
+	due, err := w.store.DueWebConversations(w.now().Add(-w.cfg.Retention), w.cfg.BatchSize)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to list web conversations to delete")
+		return 0
+	}
+
+	deleted := 0
+	accounts := make(map[string]*store.Account)
+	for _, conv := range due {
+		if ctx.Err() != nil {
+			break
+		}
+
+		account, ok := accounts[conv.AccountID]
+		if !ok {
+			account, err = w.store.GetAccount(conv.AccountID)
+			if err != nil {
+				log.Error().Err(err).Str("account_id", conv.AccountID).Msg("failed to load account for conversation cleanup")
+				continue
+			}
+			accounts[conv.AccountID] = account
+		}
+
+		// Conversations of removed accounts cannot be deleted any more
+		if account == nil {
+			w.forget(conv)
+			continue
+		}
+
+		if err := w.deleteConversation(ctx, account, conv); err != nil {
+			w.fail(conv, err)
+			continue
+		}
+		w.forget(conv)
+		deleted++
+	}
+
+	if deleted > 0 {
+		log.Info().Int("deleted", deleted).Msg("deleted web conversations")
+	}
+	return deleted
+}
+
+// deleteConversation deletes a conversation on claude.ai; one that is already
+// gone counts as deleted
+func (w *WebConversationCleaner) deleteConversation(ctx context.Context, account *store.Account, conv *store.WebConversation) error {
+	if account.IsOAuth() && w.refresher != nil && account.NeedsRefresh() {
+		if err := w.refresher.RefreshAccountToken(account); err != nil {
+			log.Warn().Err(err).Str("account_id", account.ID).Msg("failed to refresh token for conversation cleanup")
+		}
+	}
+
+	url := fmt.Sprintf("%s/api/organizations/%s/chat_conversations/%s", w.cfg.WebURL, conv.OrganizationID, conv.ID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/131.0.0.0 Safari/537.36")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Origin", w.cfg.WebURL)
+	req.Header.Set("Referer", w.cfg.WebURL+"/")
+	if account.IsOAuth() {
+		req.Header.Set("Authorization", "Bearer "+account.Credentials.AccessToken)
+		req.Header.Set("anthropic-beta", w.betaHeaders.Resolve(account, "", ""))
+	}
+	if cookie := account.WebCookieHeader(); cookie != "" {
+		req.Header.Set("Cookie", cookie)
+	}
+
+	resp, err := w.doer.Do(req, account.ID)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound || (resp.StatusCode >= 200 && resp.StatusCode < 300) {
+		return nil
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("status %d: %s", resp.StatusCode, body)
+}
+
+// forget stops tracking a conversation
+func (w *WebConversationCleaner) forget(conv *store.WebConversation) {
+	if err := w.store.DeleteWebConversation(conv.ID); err != nil {
+		log.Error().Err(err).Str("conversation_id", conv.ID).Msg("failed to untrack web conversation")
+	}
+}
+
+// fail records a failed deletion, giving up on the conversation after the
+// configured number of attempts
+func (w *WebConversationCleaner) fail(conv *store.WebConversation, err error) {
+	if conv.Attempts+1 >= w.cfg.MaxAttempts {
+		log.Warn().Err(err).
+			Str("account_id", conv.AccountID).
+			Str("conversation_id", conv.ID).
+			Int("attempts", conv.Attempts+1).
+			Msg("giving up deleting web conversation")
+		w.forget(conv)
+		return
+	}
+	log.Debug().Err(err).Str("conversation_id", conv.ID).Msg("failed to delete web conversation, will retry")
+	if err := w.store.MarkWebConversationFailed(conv.ID, err.Error()); err != nil {
+		log.Error().Err(err).Str("conversation_id", conv.ID).Msg("failed to record web conversation deletion failure")
+	}
+}
+
+// defaultAccountDoer sends requests with a plain HTTP client
+type defaultAccountDoer struct {
+	client *http.Client
+}
+
+func (d defaultAccountDoer) Do(req *http.Request, _ string) (*http.Response, error) {
+	return d.client.Do(req)
+}
@@ -0,0 +1,98 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"ccproxy/internal/store"
+)
+
+func TestWebConversationCleaner_Cleanup(t *testing.T) {
+	db := newSpendTestStore(t)
+	account := &store.Account{
+		ID:             "acc-1",
+		Name:           "acc-1",
+		Type:           store.AccountTypeSessionKey,
+		Credentials:    store.Credentials{SessionKey: "sk-ant-sid01-test"},
+		OrganizationID: "org-1",
+		CreatedAt:      time.Now(),
+		IsActive:       true,
+	}
+	if err := db.CreateAccount(account); err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	var deleted []string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete || !strings.HasPrefix(r.URL.Path, "/api/organizations/org-1/chat_conversations/") {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		if !strings.Contains(r.Header.Get("Cookie"), "sessionKey=sk-ant-sid01-test") {
+			t.Errorf("cookie = %q", r.Header.Get("Cookie"))
+		}
+		id := strings.TrimPrefix(r.URL.Path, "/api/organizations/org-1/chat_conversations/")
+		mu.Lock()
+		deleted = append(deleted, id)
+		mu.Unlock()
+		switch id {
+		case "conv-gone":
+			w.WriteHeader(http.StatusNotFound)
+		case "conv-flaky":
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer upstream.Close()
+
+	now := time.Now()
+	w := NewWebConversationCleaner(db, WebConversationCleanerConfig{
+		WebURL:      upstream.URL,
+		Retention:   time.Hour,
+		MaxAttempts: 2,
+	})
+	w.now = func() time.Time { return now.Add(-2 * time.Hour) }
+	for _, id := range []string{"conv-old", "conv-gone", "conv-flaky"} {
+		w.Track(account, id)
+	}
+	w.Track(&store.Account{ID: "acc-removed", OrganizationID: "org-2"}, "conv-orphan")
+	w.now = func() time.Time { return now }
+	w.Track(account, "conv-new")
+
+	if n := w.Cleanup(context.Background()); n != 2 {
+		t.Errorf("deleted = %d, want 2", n)
+	}
+	if len(deleted) != 3 {
+		t.Errorf("upstream deletions = %v", deleted)
+	}
+
+	// Only the failed and the recent conversation are still tracked
+	remaining, err := db.DueWebConversations(now.Add(time.Hour), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(remaining) != 2 || remaining[0].ID != "conv-flaky" || remaining[1].ID != "conv-new" {
+		t.Fatalf("remaining = %+v", remaining)
+	}
+	if remaining[0].Attempts != 1 || !strings.Contains(remaining[0].LastError, "502") {
+		t.Errorf("failed conversation = %+v", remaining[0])
+	}
+
+	// The second failure gives up on the conversation
+	w.Cleanup(context.Background())
+	remaining, _ = db.DueWebConversations(now.Add(time.Hour), 10)
+	if len(remaining) != 1 || remaining[0].ID != "conv-new" {
+		t.Errorf("remaining after retry = %+v", remaining)
+	}
+}
+
+func TestWebConversationCleaner_NilTracksNothing(t *testing.T) {
+	var w *WebConversationCleaner
+	w.Track(&store.Account{ID: "acc-1"}, "conv-1")
+}
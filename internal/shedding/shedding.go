@@ -0,0 +1,244 @@
+// Package shedding rejects low-priority requests while the process is under
+// memory or goroutine pressure, before streaming-heavy load drives it out of
+// memory.
+package shedding
+
+import (
+	"context"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Request priorities. Low priority requests are shed first; critical ones
+// never are.
+const (
+	PriorityLow      = "low"
+	PriorityNormal   = "normal"
+	PriorityCritical = "critical"
+)
+
+// ValidPriority reports whether p is a known priority; "" means normal
+func ValidPriority(p string) bool {
+	switch p {
+	case "", PriorityLow, PriorityNormal, PriorityCritical:
+		return true
+	}
+	return false
+}
+
+// Pressure levels
+const (
+	LevelNone = iota // Everything is admitted
+	LevelSoft        // Low priority requests are shed
+	LevelHard        // Low and normal priority requests are shed
+)
+
+// Config sets the pressure thresholds. A zero limit disables that signal.
+type Config struct {
+	CheckInterval   time.Duration
+	MemorySoftBytes uint64 // Resident set size
+	MemoryHardBytes uint64
+	GoroutinesSoft  int
+	GoroutinesHard  int
+	RetryAfter      time.Duration // Suggested to shed clients
+}
+
+// Sample is one reading of the process resources
+type Sample struct {
+	RSSBytes   uint64 `json:"rss_bytes"`
+	Goroutines int    `json:"goroutines"`
+}
+
+// Stats reports the current pressure and the requests shed so far
+type Stats struct {
+	Level      string           `json:"level"`
+	Reason     string           `json:"reason,omitempty"`
+	Sample     Sample           `json:"sample"`
+	SampledAt  time.Time        `json:"sampled_at"`
+	Shed       map[string]int64 `json:"shed"` // By priority
+	ShedTotal  int64            `json:"shed_total"`
+	RetryAfter int              `json:"retry_after_seconds"`
+}
+
+// Controller samples the process periodically and decides which requests to admit
+type Controller struct {
+	config  Config
+	sampler func() Sample
+
+	mu        sync.RWMutex
+	level     int
+	reason    string
+	sample    Sample
+	sampledAt time.Time
+
+	shedLow    int64
+	shedNormal int64
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewController creates a controller reading the process's own resources
+func NewController(config Config) *Controller {
+	if config.CheckInterval <= 0 {
+		config.CheckInterval = time.Second
+	}
+	if config.RetryAfter <= 0 {
+		config.RetryAfter = 5 * time.Second
+	}
+	return &Controller{
+		config:  config,
+		sampler: ProcessSample,
+		stopCh:  make(chan struct{}),
+	}
+}
+
+// SetSampler replaces the resource reader, for tests
+func (c *Controller) SetSampler(sampler func() Sample) {
+	c.sampler = sampler
+}
+
+// Start samples once and then every check interval until Stop or ctx ends
+func (c *Controller) Start(ctx context.Context) error {
+	c.Check()
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		ticker := time.NewTicker(c.config.CheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-c.stopCh:
+				return
+			case <-ticker.C:
+				c.Check()
+			}
+		}
+	}()
+	log.Info().
+		Uint64("memory_soft_bytes", c.config.MemorySoftBytes).
+		Uint64("memory_hard_bytes", c.config.MemoryHardBytes).
+		Int("goroutines_soft", c.config.GoroutinesSoft).
+		Int("goroutines_hard", c.config.GoroutinesHard).
+		Msg("initialized load shedding")
+	return nil
+}
+
+// Stop ends sampling
+func (c *Controller) Stop() {
+	close(c.stopCh)
+	c.wg.Wait()
+}
+
+// Check samples the process and updates the pressure level
+func (c *Controller) Check() {
+	sample := c.sampler()
+	level, reason := LevelNone, ""
+	raise := func(l int, r string) {
+		if l > level {
+			level, reason = l, r
+		}
+	}
+	if hard := c.config.MemoryHardBytes; hard > 0 && sample.RSSBytes >= hard {
+		raise(LevelHard, "memory")
+	} else if soft := c.config.MemorySoftBytes; soft > 0 && sample.RSSBytes >= soft {
+		raise(LevelSoft, "memory")
+	}
+	if hard := c.config.GoroutinesHard; hard > 0 && sample.Goroutines >= hard {
+		raise(LevelHard, "goroutines")
+	} else if soft := c.config.GoroutinesSoft; soft > 0 && sample.Goroutines >= soft {
+		raise(LevelSoft, "goroutines")
+	}
+
+	c.mu.Lock()
+	previous := c.level
+	c.level, c.reason = level, reason
+	c.sample, c.sampledAt = sample, time.Now()
+	c.mu.Unlock()
+
+	if level != previous {
+		log.Warn().
+			Str("level", levelName(level)).
+			Str("reason", reason).
+			Uint64("rss_bytes", sample.RSSBytes).
+			Int("goroutines", sample.Goroutines).
+			Msg("load shedding level changed")
+	}
+}
+
+// Admit reports whether a request of the given priority may proceed. Shed
+// requests are counted; reason names the resource under pressure.
+func (c *Controller) Admit(priority string) (ok bool, reason string) {
+	c.mu.RLock()
+	level, reason := c.level, c.reason
+	c.mu.RUnlock()
+
+	switch {
+	case level >= LevelSoft && priority == PriorityLow:
+		atomic.AddInt64(&c.shedLow, 1)
+		return false, reason
+	case level >= LevelHard && (priority == PriorityNormal || priority == ""):
+		atomic.AddInt64(&c.shedNormal, 1)
+		return false, reason
+	}
+	return true, ""
+}
+
+// RetryAfter is how long shed clients are asked to wait
+func (c *Controller) RetryAfter() time.Duration {
+	return c.config.RetryAfter
+}
+
+// Stats returns the current pressure and shed counters
+func (c *Controller) Stats() Stats {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	low, normal := atomic.LoadInt64(&c.shedLow), atomic.LoadInt64(&c.shedNormal)
+	return Stats{
+		Level:      levelName(c.level),
+		Reason:     c.reason,
+		Sample:     c.sample,
+		SampledAt:  c.sampledAt,
+		Shed:       map[string]int64{PriorityLow: low, PriorityNormal: normal},
+		ShedTotal:  low + normal,
+		RetryAfter: int(c.config.RetryAfter.Seconds()),
+	}
+}
+
+func levelName(level int) string {
+	switch level {
+	case LevelSoft:
+		return "soft"
+	case LevelHard:
+		return "hard"
+	}
+	return "none"
+}
+
+// ProcessSample reads the resident set size from /proc where available,
+// falling back to the memory obtained by the Go runtime
+func ProcessSample() Sample {
+	sample := Sample{Goroutines: runtime.NumGoroutine()}
+	if data, err := os.ReadFile("/proc/self/statm"); err == nil {
+		if fields := strings.Fields(string(data)); len(fields) > 1 {
+			if pages, err := strconv.ParseUint(fields[1], 10, 64); err == nil {
+				sample.RSSBytes = pages * uint64(os.Getpagesize())
+				return sample
+			}
+		}
+	}
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	sample.RSSBytes = ms.Sys
+	return sample
+}
@@ -0,0 +1,62 @@
+package shedding
+
+import "testing"
+
+func TestController_Admit(t *testing.T) {
+	var sample Sample
+	c := NewController(Config{
+		MemorySoftBytes: 100,
+		MemoryHardBytes: 200,
+		GoroutinesSoft:  10,
+		GoroutinesHard:  20,
+	})
+	c.SetSampler(func() Sample { return sample })
+
+	tests := []struct {
+		name       string
+		sample     Sample
+		wantLevel  string
+		wantReason string
+		admitted   map[string]bool
+	}{
+		{"idle", Sample{RSSBytes: 50, Goroutines: 5}, "none", "",
+			map[string]bool{PriorityLow: true, "": true, PriorityNormal: true, PriorityCritical: true}},
+		{"soft memory", Sample{RSSBytes: 150, Goroutines: 5}, "soft", "memory",
+			map[string]bool{PriorityLow: false, "": true, PriorityNormal: true, PriorityCritical: true}},
+		{"hard goroutines", Sample{RSSBytes: 150, Goroutines: 25}, "hard", "goroutines",
+			map[string]bool{PriorityLow: false, "": false, PriorityNormal: false, PriorityCritical: true}},
+		{"hard memory", Sample{RSSBytes: 250, Goroutines: 5}, "hard", "memory",
+			map[string]bool{PriorityLow: false, "": false, PriorityNormal: false, PriorityCritical: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sample = tt.sample
+			c.Check()
+			stats := c.Stats()
+			if stats.Level != tt.wantLevel || stats.Reason != tt.wantReason {
+				t.Fatalf("level = %s/%s, want %s/%s", stats.Level, stats.Reason, tt.wantLevel, tt.wantReason)
+			}
+			for priority, want := range tt.admitted {
+				if ok, reason := c.Admit(priority); ok != want {
+					t.Errorf("Admit(%q) = %v (%s), want %v", priority, ok, reason, want)
+				}
+			}
+		})
+	}
+
+	stats := c.Stats()
+	if stats.Shed[PriorityLow] != 3 || stats.Shed[PriorityNormal] != 4 || stats.ShedTotal != 7 {
+		t.Errorf("shed = %v (total %d), want low 3, normal 4", stats.Shed, stats.ShedTotal)
+	}
+}
+
+func TestValidPriority(t *testing.T) {
+	for _, p := range []string{"", PriorityLow, PriorityNormal, PriorityCritical} {
+		if !ValidPriority(p) {
+			t.Errorf("ValidPriority(%q) = false", p)
+		}
+	}
+	if ValidPriority("urgent") {
+		t.Error("ValidPriority(\"urgent\") = true")
+	}
+}
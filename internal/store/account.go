@@ -12,7 +12,7 @@ type AccountType string
 const (
 	AccountTypeOAuth      AccountType = "oauth"       // OAuth account from claude.ai
 	AccountTypeSessionKey AccountType = "session_key" // Legacy session key
-	AccountTypeAPIKey     AccountType = "api_key"     // Direct API key (for future use)
+	AccountTypeAPIKey     AccountType = "api_key"     // Anthropic API key, served from the API key pool
 )
 
 // AccountStatus represents the account status
@@ -23,6 +23,8 @@ const (
 	AccountStatusError    AccountStatus = "error"    // Account has authentication or config errors
 	AccountStatusDisabled AccountStatus = "disabled" // Account is manually disabled
 	AccountStatusPaused   AccountStatus = "paused"   // Account is temporarily paused
+	// AccountStatusNeedsReauth means the refresh token was revoked and a new login is required
+	AccountStatusNeedsReauth AccountStatus = "needs_reauth"
 )
 
 // Account represents a Claude account with credentials
@@ -64,6 +66,16 @@ type Account struct {
 	// Enhanced features
 	MaxConcurrency int `json:"max_concurrency"` // Max concurrent requests for this account
 	Priority       int `json:"priority"`        // Priority for scheduling (lower = higher priority)
+	HealthScore    int `json:"health_score"`    // Composite health score 0-100 (higher = healthier)
+
+	// Optional daily windows outside which the account is not scheduled
+	Schedule *AccountSchedule `json:"schedule,omitempty"`
+
+	// Optional claude.ai project web mode conversations are created in
+	Project *WebProject `json:"project,omitempty"`
+
+	// Optional egress path (static hosts, DNS, local address) of upstream connections
+	Network *AccountNetwork `json:"network,omitempty"`
 }
 
 // Credentials holds account authentication data
@@ -73,6 +85,8 @@ type Credentials struct {
 	RefreshToken string `json:"refresh_token,omitempty"`
 	// For session key accounts
 	SessionKey string `json:"session_key,omitempty"`
+	// Additional claude.ai cookies (e.g. cf_clearance) sent in web mode
+	ExtraCookies map[string]string `json:"extra_cookies,omitempty"`
 	// For API key accounts
 	APIKey string `json:"api_key,omitempty"`
 }
@@ -128,6 +142,11 @@ func (a *Account) IsSchedulable() bool {
 		return false
 	}
 
+	// 6. Scheduling window check - only within the account's allowed hours
+	if !a.InScheduleWindow(now) {
+		return false
+	}
+
 	return true
 }
 
@@ -182,12 +201,13 @@ func (s *Store) CreateAccount(account *Account) error {
 }
 
 func (s *Store) GetAccount(id string) (*Account, error) {
-	query := `SELECT id, name, type, credentials, organization_id, expires_at, created_at, last_used_at, is_active, last_check_at, health_status, error_count, success_count
+	query := `SELECT id, name, type, credentials, organization_id, expires_at, created_at, last_used_at, is_active, last_check_at, health_status, error_count, success_count, COALESCE(health_score, 100), schedule_windows, web_project, network
 		FROM accounts WHERE id = ?`
 	row := s.db.QueryRow(query, id)
 
 	var account Account
 	var credBytes []byte
+	var schedule, project, network sql.NullString
 	err := row.Scan(
 		&account.ID,
 		&account.Name,
@@ -202,6 +222,10 @@ func (s *Store) GetAccount(id string) (*Account, error) {
 		&account.HealthStatus,
 		&account.ErrorCount,
 		&account.SuccessCount,
+		&account.HealthScore,
+		&schedule,
+		&project,
+		&network,
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -214,11 +238,15 @@ func (s *Store) GetAccount(id string) (*Account, error) {
 		return nil, err
 	}
 
+	account.Schedule = unmarshalSchedule(schedule)
+	account.Project = unmarshalProject(project)
+	account.Network = unmarshalNetwork(network)
+
 	return &account, nil
 }
 
 func (s *Store) GetActiveAccount() (*Account, error) {
-	query := `SELECT id, name, type, credentials, organization_id, expires_at, created_at, last_used_at, is_active, last_check_at, health_status, error_count, success_count
+	query := `SELECT id, name, type, credentials, organization_id, expires_at, created_at, last_used_at, is_active, last_check_at, health_status, error_count, success_count, COALESCE(health_score, 100)
 		FROM accounts
 		WHERE is_active = 1 AND (expires_at IS NULL OR expires_at > datetime('now'))
 		ORDER BY last_used_at DESC, created_at DESC
@@ -241,6 +269,7 @@ func (s *Store) GetActiveAccount() (*Account, error) {
 		&account.HealthStatus,
 		&account.ErrorCount,
 		&account.SuccessCount,
+		&account.HealthScore,
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -257,7 +286,7 @@ func (s *Store) GetActiveAccount() (*Account, error) {
 }
 
 func (s *Store) ListAccounts() ([]*Account, error) {
-	query := `SELECT id, name, type, credentials, organization_id, expires_at, created_at, last_used_at, is_active, last_check_at, health_status, error_count, success_count
+	query := `SELECT id, name, type, credentials, organization_id, expires_at, created_at, last_used_at, is_active, last_check_at, health_status, error_count, success_count, COALESCE(health_score, 100)
 		FROM accounts ORDER BY created_at DESC`
 	rows, err := s.db.Query(query)
 	if err != nil {
@@ -283,6 +312,7 @@ func (s *Store) ListAccounts() ([]*Account, error) {
 			&account.HealthStatus,
 			&account.ErrorCount,
 			&account.SuccessCount,
+			&account.HealthScore,
 		); err != nil {
 			return nil, err
 		}
@@ -376,7 +406,7 @@ func (s *Store) GetSchedulableAccounts() ([]*Account, error) {
 		last_check_at, health_status, error_count, success_count,
 		rate_limited_at, rate_limit_reset_at, overload_until,
 		temp_unschedulable_until, temp_unschedulable_reason,
-		max_concurrency, priority
+		max_concurrency, priority, COALESCE(health_score, 100), schedule_windows, web_project, network
 		FROM accounts
 		WHERE status = 'active'
 		AND schedulable = 1
@@ -405,10 +435,40 @@ func (s *Store) GetSchedulableAccounts() ([]*Account, error) {
 	return accounts, rows.Err()
 }
 
+// ListAccountsWithStatus returns all accounts including scheduling state fields
+func (s *Store) ListAccountsWithStatus() ([]*Account, error) {
+	query := `SELECT id, name, type, credentials, organization_id, expires_at, created_at, last_used_at,
+		status, is_active, schedulable, error_message,
+		last_check_at, health_status, error_count, success_count,
+		rate_limited_at, rate_limit_reset_at, overload_until,
+		temp_unschedulable_until, temp_unschedulable_reason,
+		max_concurrency, priority, COALESCE(health_score, 100), schedule_windows, web_project, network
+		FROM accounts
+		ORDER BY priority ASC, created_at DESC`
+
+	rows, err := s.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var accounts []*Account
+	for rows.Next() {
+		account, err := scanAccountRow(rows)
+		if err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, account)
+	}
+
+	return accounts, rows.Err()
+}
+
 // scanAccountRow scans a database row into an Account struct
 func scanAccountRow(rows *sql.Rows) (*Account, error) {
 	var account Account
 	var credBytes []byte
+	var schedule, project, network sql.NullString
 
 	err := rows.Scan(
 		&account.ID,
@@ -434,6 +494,10 @@ func scanAccountRow(rows *sql.Rows) (*Account, error) {
 		&account.TempUnschedulableReason,
 		&account.MaxConcurrency,
 		&account.Priority,
+		&account.HealthScore,
+		&schedule,
+		&project,
+		&network,
 	)
 	if err != nil {
 		return nil, err
@@ -443,6 +507,10 @@ func scanAccountRow(rows *sql.Rows) (*Account, error) {
 		return nil, err
 	}
 
+	account.Schedule = unmarshalSchedule(schedule)
+	account.Project = unmarshalProject(project)
+	account.Network = unmarshalNetwork(network)
+
 	return &account, nil
 }
 
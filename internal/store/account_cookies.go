@@ -0,0 +1,52 @@
+package store
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// sessionKeyCookie carries the session key of session key accounts
+const sessionKeyCookie = "sessionKey"
+
+// ValidateExtraCookies checks that extra cookies have valid names and values
+// and do not override the session key cookie
+func ValidateExtraCookies(cookies map[string]string) error {
+	for name, value := range cookies {
+		if name == sessionKeyCookie {
+			return fmt.Errorf("cookie %q is managed by the session key", name)
+		}
+		if err := (&http.Cookie{Name: name, Value: value}).Valid(); err != nil {
+			return fmt.Errorf("cookie %q: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// ExtraCookieNames returns the names of the account's extra cookies, sorted
+func (a *Account) ExtraCookieNames() []string {
+	names := make([]string, 0, len(a.Credentials.ExtraCookies))
+	for name := range a.Credentials.ExtraCookies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// WebCookieHeader returns the Cookie header for claude.ai web requests: the
+// session key of session key accounts followed by the account's extra
+// cookies. It is empty for an OAuth account without extra cookies.
+func (a *Account) WebCookieHeader() string {
+	var cookies []string
+	if !a.IsOAuth() {
+		cookies = append(cookies, sessionKeyCookie+"="+a.Credentials.SessionKey)
+	}
+	for _, name := range a.ExtraCookieNames() {
+		if name == sessionKeyCookie {
+			continue
+		}
+		cookies = append(cookies, name+"="+a.Credentials.ExtraCookies[name])
+	}
+	return strings.Join(cookies, "; ")
+}
@@ -0,0 +1,121 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+)
+
+// AccountUsageSummary is the recorded usage of an account, shown before it
+// is deleted and kept in the deletion's audit entry
+type AccountUsageSummary struct {
+	RequestLogs    int64      `json:"request_logs"`
+	RecentRequests int64      `json:"recent_requests"` // Requests since the recent traffic cutoff
+	LastRequestAt  *time.Time `json:"last_request_at,omitempty"`
+	StatsRows      int64      `json:"stats_rows"`
+	Requests       int64      `json:"requests"` // From daily usage stats
+	TotalTokens    int64      `json:"total_tokens"`
+	FirstDay       string     `json:"first_day,omitempty"`
+	LastDay        string     `json:"last_day,omitempty"`
+}
+
+// AccountDeletionCounts reports the rows touched by an account deletion
+type AccountDeletionCounts struct {
+	RequestLogs int64 `json:"request_logs"` // Reassigned to the archive ID
+	UsageStats  int64 `json:"usage_stats"`  // Reassigned to the archive ID
+	SpendMonths int64 `json:"spend_months"` // Reassigned to the archive ID
+	StateRows   int64 `json:"state_rows"`   // Health history and checks, overloads, anomalies and settings removed
+}
+
+// GetAccountUsageSummary summarizes an account's request logs and daily usage
+// stats; requests started at or after since count as recent
+func (s *Store) GetAccountUsageSummary(accountID string, since time.Time) (*AccountUsageSummary, error) {
+	summary := &AccountUsageSummary{}
+
+	err := s.read.QueryRow(`SELECT COUNT(*), COALESCE(SUM(CASE WHEN request_at >= ? THEN 1 ELSE 0 END), 0)
+		FROM request_logs WHERE account_id = ?`, since, accountID).Scan(&summary.RequestLogs, &summary.RecentRequests)
+	if err != nil {
+		return nil, err
+	}
+
+	var last time.Time
+	err = s.read.QueryRow(`SELECT request_at FROM request_logs WHERE account_id = ?
+		ORDER BY request_at DESC LIMIT 1`, accountID).Scan(&last)
+	if err == nil {
+		summary.LastRequestAt = &last
+	} else if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	var firstDay, lastDay sql.NullString
+	err = s.read.QueryRow(`SELECT COUNT(*), COALESCE(SUM(request_count), 0), COALESCE(SUM(total_tokens), 0),
+		MIN(DATE(stat_date)), MAX(DATE(stat_date))
+		FROM usage_stats_daily WHERE account_id = ?`, accountID).Scan(
+		&summary.StatsRows, &summary.Requests, &summary.TotalTokens, &firstDay, &lastDay)
+	if err != nil {
+		return nil, err
+	}
+	summary.FirstDay, summary.LastDay = firstDay.String, lastDay.String
+
+	return summary, nil
+}
+
+// ArchiveAndDeleteAccount deletes an account in one transaction. Its request
+// logs, daily usage stats and monthly spend are reassigned to archiveID, so
+// totals stay intact without pointing at the deleted account; its health
+// history and checks, model overloads, drains, anomalies and settings are removed.
+func (s *Store) ArchiveAndDeleteAccount(accountID, archiveID string) (*AccountDeletionCounts, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	counts := &AccountDeletionCounts{}
+	exec := func(dst *int64, query string, args ...interface{}) error {
+		result, err := tx.Exec(query, args...)
+		if err != nil {
+			return err
+		}
+		n, _ := result.RowsAffected()
+		*dst += n
+		return nil
+	}
+
+	if err := exec(&counts.RequestLogs, `UPDATE request_logs SET account_id = ? WHERE account_id = ?`, archiveID, accountID); err != nil {
+		return nil, err
+	}
+	if err := exec(&counts.UsageStats, `UPDATE usage_stats_daily SET account_id = ? WHERE account_id = ?`, archiveID, accountID); err != nil {
+		return nil, err
+	}
+	if err := exec(&counts.SpendMonths, `UPDATE account_spend_monthly SET account_id = ? WHERE account_id = ?`, archiveID, accountID); err != nil {
+		return nil, err
+	}
+	for _, table := range []string{
+		"account_health_history",
+		"account_health_checks",
+		"account_model_overloads",
+		"account_drains",
+		"account_secure_notes",
+		"account_reset_schedules",
+		"account_anomalies",
+		"account_trace_sampling",
+		"api_key_accounts",
+	} {
+		if err := exec(&counts.StateRows, `DELETE FROM `+table+` WHERE account_id = ?`, accountID); err != nil {
+			return nil, err
+		}
+	}
+
+	var deleted int64
+	if err := exec(&deleted, `DELETE FROM accounts WHERE id = ?`, accountID); err != nil {
+		return nil, err
+	}
+	if deleted == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
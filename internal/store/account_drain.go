@@ -0,0 +1,114 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+)
+
+// AccountDrain is an account being taken out of rotation: the scheduler no
+// longer picks it for new sessions, but its sticky sessions keep being served
+// until DrainUntil, after which the account is deactivated
+type AccountDrain struct {
+	AccountID  string    `json:"account_id"`
+	StartedAt  time.Time `json:"started_at"`
+	DrainUntil time.Time `json:"drain_until"`
+}
+
+// StartAccountDrain starts draining an account until the given time. Draining
+// an account again moves its deadline but keeps the original start time.
+func (s *Store) StartAccountDrain(accountID string, until time.Time) (*AccountDrain, error) {
+	now := time.Now()
+	_, err := s.db.Exec(`INSERT INTO account_drains (account_id, started_at, drain_until)
+		VALUES (?, ?, ?)
+		ON CONFLICT(account_id) DO UPDATE SET drain_until = excluded.drain_until`,
+		accountID, now, until)
+	if err != nil {
+		return nil, err
+	}
+	return s.GetAccountDrain(accountID)
+}
+
+// GetAccountDrain returns an account's drain, or nil if it is not draining
+func (s *Store) GetAccountDrain(accountID string) (*AccountDrain, error) {
+	var d AccountDrain
+	err := s.db.QueryRow(`SELECT account_id, started_at, drain_until FROM account_drains WHERE account_id = ?`,
+		accountID).Scan(&d.AccountID, &d.StartedAt, &d.DrainUntil)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// CancelAccountDrain stops draining an account without deactivating it,
+// reporting whether it was draining
+func (s *Store) CancelAccountDrain(accountID string) (bool, error) {
+	result, err := s.db.Exec(`DELETE FROM account_drains WHERE account_id = ?`, accountID)
+	if err != nil {
+		return false, err
+	}
+	n, _ := result.RowsAffected()
+	return n > 0, nil
+}
+
+// GetDrainingAccounts returns the accounts being drained, mapped to when their
+// drain ends
+func (s *Store) GetDrainingAccounts() (map[string]time.Time, error) {
+	rows, err := s.db.Query(`SELECT account_id, drain_until FROM account_drains`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	draining := make(map[string]time.Time)
+	for rows.Next() {
+		var accountID string
+		var until time.Time
+		if err := rows.Scan(&accountID, &until); err != nil {
+			return nil, err
+		}
+		draining[accountID] = until
+	}
+
+	return draining, rows.Err()
+}
+
+// CompleteExpiredDrains deactivates the accounts whose drain ended by now and
+// removes their drains, returning the deactivated account IDs
+func (s *Store) CompleteExpiredDrains(now time.Time) ([]string, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`SELECT account_id FROM account_drains WHERE drain_until <= ? ORDER BY account_id`, now)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, id := range ids {
+		if _, err := tx.Exec(`UPDATE accounts SET is_active = 0 WHERE id = ?`, id); err != nil {
+			return nil, err
+		}
+		if _, err := tx.Exec(`DELETE FROM account_drains WHERE account_id = ?`, id); err != nil {
+			return nil, err
+		}
+	}
+	return ids, tx.Commit()
+}
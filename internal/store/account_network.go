@@ -0,0 +1,83 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// AccountNetwork pins an account's upstream connections to an egress path,
+// so accounts sharing a host do not share a network fingerprint and can work
+// around poisoned DNS
+type AccountNetwork struct {
+	// Hosts maps upstream host names to static IPs, skipping DNS for them,
+	// e.g. {"claude.ai": "160.79.104.10"}
+	Hosts map[string]string `json:"hosts,omitempty"`
+	// DNSServers are resolvers ("ip" or "ip:port") used instead of the
+	// system resolver, tried in order
+	DNSServers []string `json:"dns_servers,omitempty"`
+	// LocalAddr is the local IP connections are bound to, selecting the
+	// egress interface on hosts with several addresses
+	LocalAddr string `json:"local_addr,omitempty"`
+}
+
+// Validate checks the host names and addresses and lower-cases host names
+func (n *AccountNetwork) Validate() error {
+	hosts := make(map[string]string, len(n.Hosts))
+	for host, ip := range n.Hosts {
+		name := strings.ToLower(strings.TrimSpace(host))
+		if name == "" || strings.ContainsAny(name, ":/ ") {
+			return fmt.Errorf("hosts: %q is not a host name", host)
+		}
+		if net.ParseIP(ip) == nil {
+			return fmt.Errorf("hosts[%s]: %q is not an IP address", host, ip)
+		}
+		hosts[name] = ip
+	}
+	for i, server := range n.DNSServers {
+		if net.ParseIP(server) != nil {
+			continue
+		}
+		host, port, err := net.SplitHostPort(server)
+		if err != nil || net.ParseIP(host) == nil || port == "" {
+			return fmt.Errorf("dns_servers[%d]: %q is not an ip or ip:port", i, server)
+		}
+	}
+	if n.LocalAddr != "" && net.ParseIP(n.LocalAddr) == nil {
+		return fmt.Errorf("local_addr: %q is not an IP address", n.LocalAddr)
+	}
+	if len(hosts) == 0 && len(n.DNSServers) == 0 && n.LocalAddr == "" {
+		return fmt.Errorf("at least one of hosts, dns_servers or local_addr is required")
+	}
+	n.Hosts = hosts
+	return nil
+}
+
+// SetAccountNetwork sets an account's egress configuration; nil removes it
+func (s *Store) SetAccountNetwork(accountID string, network *AccountNetwork) error {
+	var value sql.NullString
+	if network != nil {
+		data, err := json.Marshal(network)
+		if err != nil {
+			return err
+		}
+		value = sql.NullString{String: string(data), Valid: true}
+	}
+	_, err := s.db.Exec(`UPDATE accounts SET network = ? WHERE id = ?`, value, accountID)
+	return err
+}
+
+// unmarshalNetwork parses a stored egress configuration; invalid ones are
+// ignored so the account falls back to the default path
+func unmarshalNetwork(value sql.NullString) *AccountNetwork {
+	if !value.Valid || value.String == "" {
+		return nil
+	}
+	var network AccountNetwork
+	if err := json.Unmarshal([]byte(value.String), &network); err != nil || network.Validate() != nil {
+		return nil
+	}
+	return &network
+}
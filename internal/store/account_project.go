@@ -0,0 +1,51 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strings"
+)
+
+// WebProject is a claude.ai project of a web mode account. Conversations are
+// created in the project, so its instructions act as the system prompt.
+type WebProject struct {
+	UUID         string `json:"uuid"`
+	Name         string `json:"name,omitempty"`
+	Instructions string `json:"instructions,omitempty"` // Last known custom instructions of the project
+}
+
+// CoversSystem reports whether the project's instructions already carry the
+// given system prompt, so it need not be inlined into the conversation
+func (p *WebProject) CoversSystem(system string) bool {
+	if p == nil || system == "" {
+		return false
+	}
+	return strings.TrimSpace(p.Instructions) == strings.TrimSpace(system)
+}
+
+// SetAccountProject sets an account's claude.ai project; nil removes it
+func (s *Store) SetAccountProject(accountID string, project *WebProject) error {
+	var value sql.NullString
+	if project != nil {
+		data, err := json.Marshal(project)
+		if err != nil {
+			return err
+		}
+		value = sql.NullString{String: string(data), Valid: true}
+	}
+	_, err := s.db.Exec(`UPDATE accounts SET web_project = ? WHERE id = ?`, value, accountID)
+	return err
+}
+
+// unmarshalProject parses a stored project; invalid values are ignored so
+// the account keeps working without one
+func unmarshalProject(value sql.NullString) *WebProject {
+	if !value.Valid || value.String == "" {
+		return nil
+	}
+	var project WebProject
+	if err := json.Unmarshal([]byte(value.String), &project); err != nil || project.UUID == "" {
+		return nil
+	}
+	return &project
+}
@@ -0,0 +1,201 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ResetSchedule is when an account's subscription rate window resets in its
+// own time zone. Each reset is a daily "HH:MM" or a weekly "Mon HH:MM".
+type ResetSchedule struct {
+	TimeZone string   `json:"time_zone"` // IANA name such as "America/New_York"; empty means UTC
+	Resets   []string `json:"resets"`
+
+	loc *time.Location
+}
+
+// resetTime is a parsed reset; weekday is -1 for daily resets
+type resetTime struct {
+	weekday time.Weekday
+	minute  int
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// Validate checks the time zone and resets and prepares the schedule for LastReset
+func (r *ResetSchedule) Validate() error {
+	loc, err := time.LoadLocation(r.TimeZone)
+	if err != nil {
+		return fmt.Errorf("unknown time_zone %q", r.TimeZone)
+	}
+	if len(r.Resets) == 0 {
+		return fmt.Errorf("at least one reset is required")
+	}
+	for i, value := range r.Resets {
+		if _, err := parseReset(value); err != nil {
+			return fmt.Errorf("resets[%d]: %w", i, err)
+		}
+	}
+	r.loc = loc
+	return nil
+}
+
+// parseReset parses "HH:MM" or "Mon HH:MM"
+func parseReset(value string) (resetTime, error) {
+	fields := strings.Fields(value)
+	switch len(fields) {
+	case 1:
+		minute, err := parseClock(fields[0])
+		return resetTime{weekday: -1, minute: minute}, err
+	case 2:
+		weekday, ok := weekdays[strings.ToLower(fields[0])]
+		if !ok {
+			return resetTime{}, fmt.Errorf("%q is not a weekday such as Mon", fields[0])
+		}
+		minute, err := parseClock(fields[1])
+		return resetTime{weekday: weekday, minute: minute}, err
+	}
+	return resetTime{}, fmt.Errorf("%q is not an HH:MM or Mon HH:MM reset", value)
+}
+
+// LastReset returns the most recent reset at or before t
+func (r *ResetSchedule) LastReset(t time.Time) time.Time {
+	loc := r.loc
+	if loc == nil {
+		loc = time.UTC
+	}
+	local := t.In(loc)
+
+	var last time.Time
+	for _, value := range r.Resets {
+		reset, err := parseReset(value)
+		if err != nil {
+			continue
+		}
+		// The latest reset is within the past week, so walk back day by day
+		for days := 0; days <= 7; days++ {
+			day := local.AddDate(0, 0, -days)
+			if reset.weekday >= 0 && day.Weekday() != reset.weekday {
+				continue
+			}
+			at := time.Date(day.Year(), day.Month(), day.Day(), reset.minute/60, reset.minute%60, 0, 0, loc)
+			if !at.After(t) {
+				if at.After(last) {
+					last = at
+				}
+				break
+			}
+		}
+	}
+	return last
+}
+
+// SetAccountResetSchedule sets when an account's rate window resets; nil
+// removes the schedule
+func (s *Store) SetAccountResetSchedule(accountID string, schedule *ResetSchedule) error {
+	if schedule == nil {
+		_, err := s.db.Exec(`DELETE FROM account_reset_schedules WHERE account_id = ?`, accountID)
+		return err
+	}
+	data, err := json.Marshal(schedule)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`INSERT INTO account_reset_schedules (account_id, schedule, updated_at)
+		VALUES (?, ?, ?)
+		ON CONFLICT(account_id) DO UPDATE SET schedule = excluded.schedule, updated_at = excluded.updated_at`,
+		accountID, string(data), time.Now())
+	return err
+}
+
+// GetAccountResetSchedule returns an account's reset schedule, or nil if it
+// has none
+func (s *Store) GetAccountResetSchedule(accountID string) (*ResetSchedule, error) {
+	var value sql.NullString
+	err := s.db.QueryRow(`SELECT schedule FROM account_reset_schedules WHERE account_id = ?`, accountID).Scan(&value)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return unmarshalResetSchedule(value), nil
+}
+
+// GetAccountResetSchedules returns all reset schedules by account ID
+func (s *Store) GetAccountResetSchedules() (map[string]*ResetSchedule, error) {
+	rows, err := s.db.Query(`SELECT account_id, schedule FROM account_reset_schedules`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	schedules := make(map[string]*ResetSchedule)
+	for rows.Next() {
+		var accountID string
+		var value sql.NullString
+		if err := rows.Scan(&accountID, &value); err != nil {
+			return nil, err
+		}
+		if schedule := unmarshalResetSchedule(value); schedule != nil {
+			schedules[accountID] = schedule
+		}
+	}
+	return schedules, rows.Err()
+}
+
+// ClearAccountRateLimit lifts an account's rate limit if it started before
+// the given time, reporting whether it was lifted. Overloads and other
+// reasons for being unschedulable are left alone.
+func (s *Store) ClearAccountRateLimit(id string, limitedBefore time.Time) (bool, error) {
+	account, err := s.getAccountRateLimit(id)
+	if err != nil || account == nil || account.RateLimitedAt == nil || !account.RateLimitedAt.Before(limitedBefore) {
+		return false, err
+	}
+
+	result, err := s.db.Exec(`UPDATE accounts SET
+		rate_limited_at = NULL,
+		rate_limit_reset_at = NULL,
+		temp_unschedulable_until = CASE WHEN temp_unschedulable_reason = 'rate_limited' THEN NULL ELSE temp_unschedulable_until END,
+		temp_unschedulable_reason = CASE WHEN temp_unschedulable_reason = 'rate_limited' THEN '' ELSE temp_unschedulable_reason END,
+		schedulable = CASE WHEN status = 'active' THEN 1 ELSE schedulable END
+		WHERE id = ? AND rate_limited_at IS NOT NULL`, id)
+	if err != nil {
+		return false, err
+	}
+	n, _ := result.RowsAffected()
+	return n > 0, nil
+}
+
+// getAccountRateLimit loads only the rate limit start of an account
+func (s *Store) getAccountRateLimit(id string) (*Account, error) {
+	var account Account
+	err := s.db.QueryRow(`SELECT id, rate_limited_at FROM accounts WHERE id = ?`, id).
+		Scan(&account.ID, &account.RateLimitedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+// unmarshalResetSchedule parses a stored reset schedule; invalid schedules
+// are ignored
+func unmarshalResetSchedule(value sql.NullString) *ResetSchedule {
+	if !value.Valid || value.String == "" {
+		return nil
+	}
+	var schedule ResetSchedule
+	if err := json.Unmarshal([]byte(value.String), &schedule); err != nil || schedule.Validate() != nil {
+		return nil
+	}
+	return &schedule
+}
@@ -0,0 +1,118 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// AccountSchedule limits an account to daily scheduling windows in its own
+// time zone, e.g. 00:00-08:00 for an owner who only uses the account by day
+type AccountSchedule struct {
+	TimeZone string           `json:"time_zone"` // IANA name such as "Asia/Shanghai"; empty means UTC
+	Windows  []ScheduleWindow `json:"windows"`
+
+	loc *time.Location
+}
+
+// ScheduleWindow is a daily "HH:MM" range; the end is exclusive and a window
+// ending before it starts runs past midnight
+type ScheduleWindow struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+// Validate checks the time zone and windows and prepares the schedule for Allows
+func (s *AccountSchedule) Validate() error {
+	loc, err := time.LoadLocation(s.TimeZone)
+	if err != nil {
+		return fmt.Errorf("unknown time_zone %q", s.TimeZone)
+	}
+	if len(s.Windows) == 0 {
+		return fmt.Errorf("at least one window is required")
+	}
+	for i, w := range s.Windows {
+		start, err := parseClock(w.Start)
+		if err != nil {
+			return fmt.Errorf("windows[%d].start: %w", i, err)
+		}
+		end, err := parseClock(w.End)
+		if err != nil {
+			return fmt.Errorf("windows[%d].end: %w", i, err)
+		}
+		if start == end {
+			return fmt.Errorf("windows[%d]: start and end must differ", i)
+		}
+	}
+	s.loc = loc
+	return nil
+}
+
+// Allows reports whether t falls inside one of the windows
+func (s *AccountSchedule) Allows(t time.Time) bool {
+	loc := s.loc
+	if loc == nil {
+		loc = time.UTC
+	}
+	local := t.In(loc)
+	minute := local.Hour()*60 + local.Minute()
+
+	for _, w := range s.Windows {
+		start, err1 := parseClock(w.Start)
+		end, err2 := parseClock(w.End)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		if start < end {
+			if minute >= start && minute < end {
+				return true
+			}
+		} else if minute >= start || minute < end {
+			return true
+		}
+	}
+	return false
+}
+
+// parseClock parses "HH:MM" into minutes since midnight
+func parseClock(value string) (int, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not an HH:MM time", value)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// InScheduleWindow reports whether the account's schedule, if any, allows
+// scheduling at t
+func (a *Account) InScheduleWindow(t time.Time) bool {
+	return a.Schedule == nil || a.Schedule.Allows(t)
+}
+
+// SetAccountSchedule sets an account's scheduling windows; nil removes them
+func (s *Store) SetAccountSchedule(accountID string, schedule *AccountSchedule) error {
+	var value sql.NullString
+	if schedule != nil {
+		data, err := json.Marshal(schedule)
+		if err != nil {
+			return err
+		}
+		value = sql.NullString{String: string(data), Valid: true}
+	}
+	_, err := s.db.Exec(`UPDATE accounts SET schedule_windows = ? WHERE id = ?`, value, accountID)
+	return err
+}
+
+// unmarshalSchedule parses a stored schedule; invalid schedules are ignored
+// so a bad row cannot take an account out of rotation
+func unmarshalSchedule(value sql.NullString) *AccountSchedule {
+	if !value.Valid || value.String == "" {
+		return nil
+	}
+	var schedule AccountSchedule
+	if err := json.Unmarshal([]byte(value.String), &schedule); err != nil || schedule.Validate() != nil {
+		return nil
+	}
+	return &schedule
+}
@@ -0,0 +1,50 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+)
+
+// AccountSecureNote is an account's sealed notes, e.g. recovery codes. It is
+// kept apart from the account so it never appears in account listings, and
+// the store only ever sees the ciphertext.
+type AccountSecureNote struct {
+	AccountID  string    `json:"account_id"`
+	Ciphertext string    `json:"-"` // Base64 sealed notes
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// SetAccountSecureNote stores an account's sealed notes, replacing any
+func (s *Store) SetAccountSecureNote(accountID, ciphertext string) error {
+	now := time.Now()
+	_, err := s.db.Exec(`INSERT INTO account_secure_notes (account_id, ciphertext, created_at, updated_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(account_id) DO UPDATE SET ciphertext = excluded.ciphertext, updated_at = excluded.updated_at`,
+		accountID, ciphertext, now, now)
+	return err
+}
+
+// GetAccountSecureNote returns an account's sealed notes, or nil if it has none
+func (s *Store) GetAccountSecureNote(accountID string) (*AccountSecureNote, error) {
+	var n AccountSecureNote
+	err := s.db.QueryRow(`SELECT account_id, ciphertext, created_at, updated_at FROM account_secure_notes WHERE account_id = ?`,
+		accountID).Scan(&n.AccountID, &n.Ciphertext, &n.CreatedAt, &n.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &n, nil
+}
+
+// DeleteAccountSecureNote removes an account's notes, reporting whether it had any
+func (s *Store) DeleteAccountSecureNote(accountID string) (bool, error) {
+	result, err := s.db.Exec(`DELETE FROM account_secure_notes WHERE account_id = ?`, accountID)
+	if err != nil {
+		return false, err
+	}
+	n, _ := result.RowsAffected()
+	return n > 0, nil
+}
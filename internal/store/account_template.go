@@ -0,0 +1,163 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// DefaultMaxConcurrency is the max_concurrency of accounts created without a template
+const DefaultMaxConcurrency = 5
+
+// AccountSettings are the scheduling settings shared by accounts and templates
+type AccountSettings struct {
+	Priority       int               `json:"priority"` // Lower = higher priority
+	MaxConcurrency int               `json:"max_concurrency"`
+	Groups         []string          `json:"groups"`
+	Labels         map[string]string `json:"labels"`
+}
+
+// AccountTemplate holds default settings applied to new accounts
+type AccountTemplate struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	AccountSettings
+}
+
+// GetAccountSettings returns an account's scheduling settings, or nil if the account does not exist
+func (s *Store) GetAccountSettings(accountID string) (*AccountSettings, error) {
+	var settings AccountSettings
+	var groups, labels sql.NullString
+	err := s.db.QueryRow(`SELECT COALESCE(priority, 0), COALESCE(max_concurrency, ?), group_names, labels
+		FROM accounts WHERE id = ?`, DefaultMaxConcurrency, accountID).Scan(
+		&settings.Priority, &settings.MaxConcurrency, &groups, &labels)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := unmarshalSettings(&settings, groups, labels); err != nil {
+		return nil, err
+	}
+	return &settings, nil
+}
+
+// UpdateAccountSettings replaces an account's scheduling settings
+func (s *Store) UpdateAccountSettings(accountID string, settings *AccountSettings) error {
+	groups, labels, err := marshalSettings(settings)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`UPDATE accounts SET priority = ?, max_concurrency = ?, group_names = ?, labels = ? WHERE id = ?`,
+		settings.Priority, settings.MaxConcurrency, groups, labels, accountID)
+	return err
+}
+
+// CreateAccountTemplate stores a new account template
+func (s *Store) CreateAccountTemplate(template *AccountTemplate) error {
+	groups, labels, err := marshalSettings(&template.AccountSettings)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`INSERT INTO account_templates (id, name, description, priority, max_concurrency, group_names, labels, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		template.ID, template.Name, template.Description, template.Priority, template.MaxConcurrency,
+		groups, labels, template.CreatedAt, template.UpdatedAt)
+	return err
+}
+
+// GetAccountTemplate returns a template by ID or name, or nil if none matches
+func (s *Store) GetAccountTemplate(idOrName string) (*AccountTemplate, error) {
+	row := s.db.QueryRow(`SELECT id, name, COALESCE(description, ''), priority, max_concurrency, group_names, labels, created_at, updated_at
+		FROM account_templates WHERE id = ? OR name = ?`, idOrName, idOrName)
+	template, err := scanAccountTemplate(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return template, err
+}
+
+// ListAccountTemplates returns all account templates ordered by name
+func (s *Store) ListAccountTemplates() ([]*AccountTemplate, error) {
+	rows, err := s.db.Query(`SELECT id, name, COALESCE(description, ''), priority, max_concurrency, group_names, labels, created_at, updated_at
+		FROM account_templates ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var templates []*AccountTemplate
+	for rows.Next() {
+		template, err := scanAccountTemplate(rows)
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, template)
+	}
+	return templates, rows.Err()
+}
+
+// UpdateAccountTemplate saves a template's name, description and settings
+func (s *Store) UpdateAccountTemplate(template *AccountTemplate) error {
+	groups, labels, err := marshalSettings(&template.AccountSettings)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`UPDATE account_templates SET name = ?, description = ?, priority = ?, max_concurrency = ?,
+			group_names = ?, labels = ?, updated_at = ?
+		WHERE id = ?`,
+		template.Name, template.Description, template.Priority, template.MaxConcurrency,
+		groups, labels, template.UpdatedAt, template.ID)
+	return err
+}
+
+// DeleteAccountTemplate deletes a template; accounts created from it keep their settings
+func (s *Store) DeleteAccountTemplate(id string) error {
+	_, err := s.db.Exec(`DELETE FROM account_templates WHERE id = ?`, id)
+	return err
+}
+
+func scanAccountTemplate(row interface{ Scan(...interface{}) error }) (*AccountTemplate, error) {
+	var template AccountTemplate
+	var groups, labels sql.NullString
+	if err := row.Scan(&template.ID, &template.Name, &template.Description, &template.Priority, &template.MaxConcurrency,
+		&groups, &labels, &template.CreatedAt, &template.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if err := unmarshalSettings(&template.AccountSettings, groups, labels); err != nil {
+		return nil, err
+	}
+	return &template, nil
+}
+
+func marshalSettings(settings *AccountSettings) (groups, labels string, err error) {
+	groupBytes, err := json.Marshal(settings.Groups)
+	if err != nil {
+		return "", "", err
+	}
+	labelBytes, err := json.Marshal(settings.Labels)
+	if err != nil {
+		return "", "", err
+	}
+	return string(groupBytes), string(labelBytes), nil
+}
+
+func unmarshalSettings(settings *AccountSettings, groups, labels sql.NullString) error {
+	settings.Groups = []string{}
+	settings.Labels = map[string]string{}
+	if groups.Valid && groups.String != "" && groups.String != "null" {
+		if err := json.Unmarshal([]byte(groups.String), &settings.Groups); err != nil {
+			return err
+		}
+	}
+	if labels.Valid && labels.String != "" && labels.String != "null" {
+		if err := json.Unmarshal([]byte(labels.String), &settings.Labels); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+)
+
+// AdminSession is an SSO admin session. Sessions are kept so they can be
+// revoked before their JWT expires.
+type AdminSession struct {
+	ID        string     `json:"id"` // The session JWT's jti
+	Subject   string     `json:"subject"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// CreateAdminSession records a new admin session and prunes expired ones
+func (s *Store) CreateAdminSession(session *AdminSession) error {
+	if _, err := s.db.Exec(`DELETE FROM admin_sessions WHERE expires_at <= ?`, time.Now()); err != nil {
+		return err
+	}
+	_, err := s.db.Exec(`INSERT INTO admin_sessions (id, subject, created_at, expires_at) VALUES (?, ?, ?, ?)`,
+		session.ID, session.Subject, session.CreatedAt, session.ExpiresAt)
+	return err
+}
+
+// GetAdminSession returns an admin session, or nil if it was never recorded
+func (s *Store) GetAdminSession(id string) (*AdminSession, error) {
+	var session AdminSession
+	err := s.db.QueryRow(`SELECT id, subject, created_at, expires_at, revoked_at FROM admin_sessions WHERE id = ?`, id).
+		Scan(&session.ID, &session.Subject, &session.CreatedAt, &session.ExpiresAt, &session.RevokedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// RevokeAdminSession marks an admin session revoked; it is rejected from then on
+func (s *Store) RevokeAdminSession(id string) error {
+	_, err := s.db.Exec(`UPDATE admin_sessions SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL`, time.Now(), id)
+	return err
+}
@@ -0,0 +1,130 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+)
+
+// AccountHourlyUsage aggregates one account's requests over one hour. HoursAgo
+// counts back from the reference time: 0 is the last hour, 1 the hour before.
+type AccountHourlyUsage struct {
+	AccountID string `json:"account_id"`
+	HoursAgo  int    `json:"hours_ago"`
+	Requests  int    `json:"requests"`
+	Failures  int    `json:"failures"`
+	Forbidden int    `json:"forbidden"` // 401 and 403 responses
+	Tokens    int64  `json:"tokens"`
+}
+
+// AccountAnomaly is a usage anomaly flagged for an account
+type AccountAnomaly struct {
+	ID         int64     `json:"id"`
+	AccountID  string    `json:"account_id"`
+	Kind       string    `json:"kind"`
+	Severity   string    `json:"severity"`
+	Message    string    `json:"message"`
+	Value      float64   `json:"value"`
+	Baseline   float64   `json:"baseline"`
+	DetectedAt time.Time `json:"detected_at"`
+}
+
+// GetAccountHourlyUsage returns per-account request counts in hourly windows
+// ending at now, covering the given number of hours. Hours without requests
+// are omitted.
+func (s *Store) GetAccountHourlyUsage(now time.Time, hours int) ([]*AccountHourlyUsage, error) {
+	query := `SELECT account_id,
+		CAST((julianday(?) - julianday(request_at)) * 24 AS INTEGER) AS hours_ago,
+		COUNT(*),
+		COALESCE(SUM(CASE WHEN success = 0 THEN 1 ELSE 0 END), 0),
+		COALESCE(SUM(CASE WHEN status_code IN (401, 403) THEN 1 ELSE 0 END), 0),
+		COALESCE(SUM(total_tokens), 0)
+		FROM request_logs
+		WHERE account_id IS NOT NULL AND account_id != '' AND request_at >= ? AND request_at < ?
+		GROUP BY account_id, hours_ago
+		ORDER BY account_id, hours_ago`
+
+	since := now.Add(-time.Duration(hours) * time.Hour)
+	rows, err := s.read.Query(query, now, since, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var usage []*AccountHourlyUsage
+	for rows.Next() {
+		var u AccountHourlyUsage
+		if err := rows.Scan(&u.AccountID, &u.HoursAgo, &u.Requests, &u.Failures, &u.Forbidden, &u.Tokens); err != nil {
+			return nil, err
+		}
+		// Guard against rounding at the window edge
+		if u.HoursAgo < 0 || u.HoursAgo >= hours {
+			continue
+		}
+		usage = append(usage, &u)
+	}
+	return usage, rows.Err()
+}
+
+// CreateAccountAnomaly records a flagged anomaly
+func (s *Store) CreateAccountAnomaly(a *AccountAnomaly) error {
+	result, err := s.db.Exec(`INSERT INTO account_anomalies
+		(account_id, kind, severity, message, value, baseline, detected_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		a.AccountID, a.Kind, a.Severity, a.Message, a.Value, a.Baseline, a.DetectedAt)
+	if err != nil {
+		return err
+	}
+	a.ID, _ = result.LastInsertId()
+	return nil
+}
+
+// GetLastAccountAnomaly returns the most recent anomaly of a kind for an
+// account, or nil if none was recorded
+func (s *Store) GetLastAccountAnomaly(accountID, kind string) (*AccountAnomaly, error) {
+	rows, err := s.db.Query(`SELECT id, account_id, kind, severity, message, value, baseline, detected_at
+		FROM account_anomalies
+		WHERE account_id = ? AND kind = ?
+		ORDER BY detected_at DESC LIMIT 1`, accountID, kind)
+	if err != nil {
+		return nil, err
+	}
+	anomalies, err := scanAccountAnomalies(rows)
+	if err != nil || len(anomalies) == 0 {
+		return nil, err
+	}
+	return anomalies[0], nil
+}
+
+// ListAccountAnomalies returns anomalies detected since the given time, newest
+// first. accountID limits the list to one account.
+func (s *Store) ListAccountAnomalies(since time.Time, accountID string) ([]*AccountAnomaly, error) {
+	query := `SELECT id, account_id, kind, severity, message, value, baseline, detected_at
+		FROM account_anomalies
+		WHERE detected_at >= ?`
+	args := []interface{}{since}
+	if accountID != "" {
+		query += ` AND account_id = ?`
+		args = append(args, accountID)
+	}
+	query += ` ORDER BY detected_at DESC, id DESC`
+
+	rows, err := s.read.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanAccountAnomalies(rows)
+}
+
+func scanAccountAnomalies(rows *sql.Rows) ([]*AccountAnomaly, error) {
+	defer rows.Close()
+
+	var anomalies []*AccountAnomaly
+	for rows.Next() {
+		var a AccountAnomaly
+		if err := rows.Scan(&a.ID, &a.AccountID, &a.Kind, &a.Severity, &a.Message, &a.Value, &a.Baseline, &a.DetectedAt); err != nil {
+			return nil, err
+		}
+		anomalies = append(anomalies, &a)
+	}
+	return anomalies, rows.Err()
+}
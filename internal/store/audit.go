@@ -0,0 +1,111 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// Audit actions
+const (
+	AuditActionPrivacyPurge         = "privacy.purge"
+	AuditActionRetentionPurge       = "retention.purge"
+	AuditActionAdminLogin           = "admin.login"
+	AuditActionAccountDelete        = "account.delete"
+	AuditActionStateExport          = "state.export"
+	AuditActionStateImport          = "state.import"
+	AuditActionNotesReveal          = "account.notes_reveal"
+	AuditActionNotesUpdate          = "account.notes_update"
+	AuditActionTokenUsageReset      = "token.usage_reset"
+	AuditActionAccountCountersReset = "account.counters_reset"
+)
+
+// AuditEntry is an immutable record of an administrative action
+type AuditEntry struct {
+	ID        string                 `json:"id"`
+	CreatedAt time.Time              `json:"created_at"`
+	Action    string                 `json:"action"`
+	Actor     string                 `json:"actor"`
+	Subject   string                 `json:"subject,omitempty"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+}
+
+// AuditFilter selects audit entries
+type AuditFilter struct {
+	Action  string
+	Subject string
+	Limit   int
+	Offset  int
+}
+
+// CreateAuditEntry appends an entry to the audit log
+func (s *Store) CreateAuditEntry(entry *AuditEntry) error {
+	details, err := json.Marshal(entry.Details)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`INSERT INTO audit_log (id, created_at, action, actor, subject, details) VALUES (?, ?, ?, ?, ?, ?)`,
+		entry.ID, entry.CreatedAt, entry.Action, entry.Actor, entry.Subject, string(details))
+	return err
+}
+
+// GetAuditEntry returns an audit entry, or nil if it does not exist
+func (s *Store) GetAuditEntry(id string) (*AuditEntry, error) {
+	row := s.read.QueryRow(`SELECT id, created_at, action, actor, COALESCE(subject, ''), COALESCE(details, '')
+		FROM audit_log WHERE id = ?`, id)
+	entry, err := scanAuditEntry(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return entry, err
+}
+
+// ListAuditEntries returns audit entries, newest first
+func (s *Store) ListAuditEntries(filter AuditFilter) ([]*AuditEntry, error) {
+	query := `SELECT id, created_at, action, actor, COALESCE(subject, ''), COALESCE(details, '')
+		FROM audit_log WHERE 1 = 1`
+	var args []interface{}
+	if filter.Action != "" {
+		query += ` AND action = ?`
+		args = append(args, filter.Action)
+	}
+	if filter.Subject != "" {
+		query += ` AND subject = ?`
+		args = append(args, filter.Subject)
+	}
+	if filter.Limit <= 0 {
+		filter.Limit = 50
+	}
+	query += ` ORDER BY created_at DESC LIMIT ? OFFSET ?`
+	args = append(args, filter.Limit, filter.Offset)
+
+	rows, err := s.read.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []*AuditEntry
+	for rows.Next() {
+		entry, err := scanAuditEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+func scanAuditEntry(row interface{ Scan(...interface{}) error }) (*AuditEntry, error) {
+	var entry AuditEntry
+	var details string
+	if err := row.Scan(&entry.ID, &entry.CreatedAt, &entry.Action, &entry.Actor, &entry.Subject, &details); err != nil {
+		return nil, err
+	}
+	if details != "" && details != "null" {
+		if err := json.Unmarshal([]byte(details), &entry.Details); err != nil {
+			return nil, err
+		}
+	}
+	return &entry, nil
+}
@@ -0,0 +1,15 @@
+package store
+
+// UpsertToken creates a token, or updates the user name, mode and expiry of
+// an existing token with the same id. Usage counters, settings and revocation
+// of an existing token are kept.
+func (s *Store) UpsertToken(token *Token) error {
+	_, err := s.db.Exec(`INSERT INTO tokens (id, user_name, mode, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET
+			user_name = excluded.user_name,
+			mode = excluded.mode,
+			expires_at = excluded.expires_at`,
+		token.ID, token.UserName, token.Mode, token.CreatedAt, token.ExpiresAt)
+	return err
+}
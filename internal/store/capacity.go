@@ -0,0 +1,40 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+)
+
+// RequestTiming is the timing of one logged request, without user or
+// content details
+type RequestTiming struct {
+	AccountID   string
+	RequestAt   time.Time
+	DurationMs  int64
+	QueueWaitMs sql.NullInt64 // NULL for requests logged before slot waits were recorded
+}
+
+// ListRequestTimings returns the timing of requests started in [since, until),
+// oldest first
+func (s *Store) ListRequestTimings(since, until time.Time) ([]*RequestTiming, error) {
+	query := `SELECT COALESCE(account_id, ''), request_at, COALESCE(duration_ms, 0), queue_wait_ms
+		FROM request_logs
+		WHERE request_at >= ? AND request_at < ?
+		ORDER BY request_at`
+
+	rows, err := s.read.Query(query, since, until)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var timings []*RequestTiming
+	for rows.Next() {
+		var t RequestTiming
+		if err := rows.Scan(&t.AccountID, &t.RequestAt, &t.DurationMs, &t.QueueWaitMs); err != nil {
+			return nil, err
+		}
+		timings = append(timings, &t)
+	}
+	return timings, rows.Err()
+}
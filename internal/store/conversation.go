@@ -2,6 +2,7 @@ package store
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"strings"
 	"time"
@@ -17,12 +18,19 @@ type ConversationContent struct {
 	Completion    string
 	CreatedAt     time.Time
 	IsCompressed  bool
+	Title         string // Short label for listings; stored uncompressed
+	TruncatedBytes int64 // Bytes removed by the storage cap when written
+	Tags          []string // Operator labels for curating transcripts
+	Starred       bool
+	Truncated     bool // Stream was interrupted; the completion is partial
 }
 
 type ConversationFilter struct {
 	TokenID  string
 	FromDate *time.Time
 	ToDate   *time.Time
+	Tag      string
+	Starred  *bool
 	Page     int
 	Limit    int
 }
@@ -31,12 +39,12 @@ type ConversationFilter struct {
 func (s *Store) CreateConversation(conv *ConversationContent) error {
 	query := `INSERT INTO conversation_contents (
 		id, request_log_id, token_id, system_prompt, messages_json,
-		prompt, completion, created_at, is_compressed
-	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+		prompt, completion, created_at, is_compressed, title, truncated_bytes, truncated
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
 
 	_, err := s.db.Exec(query,
 		conv.ID, conv.RequestLogID, conv.TokenID, conv.SystemPrompt, conv.MessagesJSON,
-		conv.Prompt, conv.Completion, conv.CreatedAt, conv.IsCompressed,
+		conv.Prompt, conv.Completion, conv.CreatedAt, conv.IsCompressed, conv.Title, conv.TruncatedBytes, conv.Truncated,
 	)
 
 	// Also update FTS index
@@ -52,15 +60,16 @@ func (s *Store) CreateConversation(conv *ConversationContent) error {
 func (s *Store) GetConversation(id string) (*ConversationContent, error) {
 	query := `SELECT
 		id, request_log_id, token_id, system_prompt, messages_json,
-		prompt, completion, created_at, is_compressed
+		prompt, completion, created_at, is_compressed, title, tags, starred, truncated
 		FROM conversation_contents WHERE id = ?`
 
-	row := s.db.QueryRow(query, id)
+	row := s.read.QueryRow(query, id)
 
 	var conv ConversationContent
+	var tags string
 	err := row.Scan(
 		&conv.ID, &conv.RequestLogID, &conv.TokenID, &conv.SystemPrompt, &conv.MessagesJSON,
-		&conv.Prompt, &conv.Completion, &conv.CreatedAt, &conv.IsCompressed,
+		&conv.Prompt, &conv.Completion, &conv.CreatedAt, &conv.IsCompressed, &conv.Title, &tags, &conv.Starred, &conv.Truncated,
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -68,6 +77,7 @@ func (s *Store) GetConversation(id string) (*ConversationContent, error) {
 		}
 		return nil, err
 	}
+	conv.Tags = unmarshalConversationTags(tags)
 
 	return &conv, nil
 }
@@ -90,6 +100,14 @@ func (s *Store) ListConversations(filter ConversationFilter) ([]*ConversationCon
 		conditions = append(conditions, "created_at <= ?")
 		args = append(args, *filter.ToDate)
 	}
+	if filter.Tag != "" {
+		conditions = append(conditions, "EXISTS (SELECT 1 FROM json_each(tags) WHERE value = ?)")
+		args = append(args, filter.Tag)
+	}
+	if filter.Starred != nil {
+		conditions = append(conditions, "starred = ?")
+		args = append(args, *filter.Starred)
+	}
 
 	whereClause := ""
 	if len(conditions) > 0 {
@@ -99,7 +117,7 @@ func (s *Store) ListConversations(filter ConversationFilter) ([]*ConversationCon
 	// Get total count
 	countQuery := fmt.Sprintf("SELECT COUNT(*) FROM conversation_contents %s", whereClause)
 	var total int
-	err := s.db.QueryRow(countQuery, args...).Scan(&total)
+	err := s.read.QueryRow(countQuery, args...).Scan(&total)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -116,13 +134,13 @@ func (s *Store) ListConversations(filter ConversationFilter) ([]*ConversationCon
 	// Get conversations
 	query := fmt.Sprintf(`SELECT
 		id, request_log_id, token_id, system_prompt, messages_json,
-		prompt, completion, created_at, is_compressed
+		prompt, completion, created_at, is_compressed, title, tags, starred, truncated
 		FROM conversation_contents %s
 		ORDER BY created_at DESC
 		LIMIT ? OFFSET ?`, whereClause)
 
 	args = append(args, filter.Limit, offset)
-	rows, err := s.db.Query(query, args...)
+	rows, err := s.read.Query(query, args...)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -131,13 +149,15 @@ func (s *Store) ListConversations(filter ConversationFilter) ([]*ConversationCon
 	var conversations []*ConversationContent
 	for rows.Next() {
 		var conv ConversationContent
+		var tags string
 		err := rows.Scan(
 			&conv.ID, &conv.RequestLogID, &conv.TokenID, &conv.SystemPrompt, &conv.MessagesJSON,
-			&conv.Prompt, &conv.Completion, &conv.CreatedAt, &conv.IsCompressed,
+			&conv.Prompt, &conv.Completion, &conv.CreatedAt, &conv.IsCompressed, &conv.Title, &tags, &conv.Starred, &conv.Truncated,
 		)
 		if err != nil {
 			return nil, 0, err
 		}
+		conv.Tags = unmarshalConversationTags(tags)
 		conversations = append(conversations, &conv)
 	}
 
@@ -152,14 +172,14 @@ func (s *Store) SearchConversations(tokenID string, query string, limit int) ([]
 
 	// Use FTS5 for full-text search
 	searchQuery := `SELECT c.id, c.request_log_id, c.token_id, c.system_prompt, c.messages_json,
-		c.prompt, c.completion, c.created_at, c.is_compressed
+		c.prompt, c.completion, c.created_at, c.is_compressed, c.title, c.tags, c.starred, c.truncated
 		FROM conversation_contents c
 		INNER JOIN conversation_search s ON c.rowid = s.rowid
 		WHERE c.token_id = ? AND conversation_search MATCH ?
 		ORDER BY rank
 		LIMIT ?`
 
-	rows, err := s.db.Query(searchQuery, tokenID, query, limit)
+	rows, err := s.read.Query(searchQuery, tokenID, query, limit)
 	if err != nil {
 		return nil, err
 	}
@@ -168,19 +188,84 @@ func (s *Store) SearchConversations(tokenID string, query string, limit int) ([]
 	var conversations []*ConversationContent
 	for rows.Next() {
 		var conv ConversationContent
+		var tags string
 		err := rows.Scan(
 			&conv.ID, &conv.RequestLogID, &conv.TokenID, &conv.SystemPrompt, &conv.MessagesJSON,
-			&conv.Prompt, &conv.Completion, &conv.CreatedAt, &conv.IsCompressed,
+			&conv.Prompt, &conv.Completion, &conv.CreatedAt, &conv.IsCompressed, &conv.Title, &tags, &conv.Starred, &conv.Truncated,
 		)
 		if err != nil {
 			return nil, err
 		}
+		conv.Tags = unmarshalConversationTags(tags)
 		conversations = append(conversations, &conv)
 	}
 
 	return conversations, rows.Err()
 }
 
+// SetConversationStarred stars or unstars a conversation, reporting whether
+// it exists
+func (s *Store) SetConversationStarred(id string, starred bool) (bool, error) {
+	result, err := s.db.Exec(`UPDATE conversation_contents SET starred = ? WHERE id = ?`, starred, id)
+	if err != nil {
+		return false, err
+	}
+	n, _ := result.RowsAffected()
+	return n > 0, nil
+}
+
+// SetConversationTags replaces the tags of a conversation, reporting whether
+// it exists
+func (s *Store) SetConversationTags(id string, tags []string) (bool, error) {
+	if tags == nil {
+		tags = []string{}
+	}
+	data, err := json.Marshal(tags)
+	if err != nil {
+		return false, err
+	}
+	result, err := s.db.Exec(`UPDATE conversation_contents SET tags = ? WHERE id = ?`, string(data), id)
+	if err != nil {
+		return false, err
+	}
+	n, _ := result.RowsAffected()
+	return n > 0, nil
+}
+
+// ListConversationTags returns the number of conversations with each tag
+func (s *Store) ListConversationTags() (map[string]int, error) {
+	rows, err := s.read.Query(`SELECT t.value, COUNT(*)
+		FROM conversation_contents c, json_each(c.tags) t
+		GROUP BY t.value`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := map[string]int{}
+	for rows.Next() {
+		var tag string
+		var count int
+		if err := rows.Scan(&tag, &count); err != nil {
+			return nil, err
+		}
+		counts[tag] = count
+	}
+	return counts, rows.Err()
+}
+
+// unmarshalConversationTags decodes the tags column, nil when it holds none
+func unmarshalConversationTags(data string) []string {
+	var tags []string
+	if data != "" {
+		_ = json.Unmarshal([]byte(data), &tags)
+	}
+	if len(tags) == 0 {
+		return nil
+	}
+	return tags
+}
+
 // DeleteConversation deletes a conversation by ID
 func (s *Store) DeleteConversation(id string) error {
 	// Delete from FTS index first
@@ -202,6 +287,67 @@ func (s *Store) DeleteOldConversations(daysToKeep int) (int64, error) {
 	return result.RowsAffected()
 }
 
+// ConversationCompressionStats summarizes conversation storage and the space
+// saved by compression. Sizes only cover compressed conversations whose
+// original size was recorded.
+type ConversationCompressionStats struct {
+	TotalConversations      int            `json:"total_conversations"`
+	CompressedConversations int            `json:"compressed_conversations"`
+	ByAlgorithm             map[string]int `json:"by_algorithm"`
+	OriginalBytes           int64          `json:"original_bytes"`
+	CompressedBytes         int64          `json:"compressed_bytes"`
+	SavedBytes              int64          `json:"saved_bytes"`
+	SavedPercent            float64        `json:"saved_percent"`
+	TruncatedConversations  int            `json:"truncated_conversations"` // Cut down by the storage cap
+	TruncatedBytes          int64          `json:"truncated_bytes"`
+}
+
+// GetConversationCompressionStats returns conversation compression statistics
+func (s *Store) GetConversationCompressionStats() (*ConversationCompressionStats, error) {
+	stats := &ConversationCompressionStats{ByAlgorithm: map[string]int{}}
+	if err := s.read.QueryRow(`SELECT COUNT(*), COALESCE(SUM(CASE WHEN truncated_bytes > 0 THEN 1 ELSE 0 END), 0),
+		COALESCE(SUM(truncated_bytes), 0) FROM conversation_contents`).Scan(
+		&stats.TotalConversations, &stats.TruncatedConversations, &stats.TruncatedBytes); err != nil {
+		return nil, err
+	}
+
+	// Conversations compressed before the algorithm was recorded used gzip
+	rows, err := s.read.Query(`SELECT COALESCE(compression, 'gzip'), COUNT(*),
+		COALESCE(SUM(original_size), 0),
+		COALESCE(SUM(CASE WHEN original_size IS NOT NULL THEN
+			LENGTH(prompt) + LENGTH(completion) + LENGTH(messages_json) + COALESCE(LENGTH(system_prompt), 0)
+		END), 0)
+		FROM conversation_contents
+		WHERE is_compressed = 1
+		GROUP BY 1`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var algorithm string
+		var count int
+		var original, compressed int64
+		if err := rows.Scan(&algorithm, &count, &original, &compressed); err != nil {
+			return nil, err
+		}
+		stats.ByAlgorithm[algorithm] = count
+		stats.CompressedConversations += count
+		stats.OriginalBytes += original
+		stats.CompressedBytes += compressed
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	stats.SavedBytes = stats.OriginalBytes - stats.CompressedBytes
+	if stats.OriginalBytes > 0 {
+		stats.SavedPercent = float64(stats.SavedBytes) / float64(stats.OriginalBytes) * 100
+	}
+	return stats, nil
+}
+
 // MarkConversationAsCompressed marks a conversation as compressed
 func (s *Store) MarkConversationAsCompressed(id string) error {
 	query := `UPDATE conversation_contents SET is_compressed = 1 WHERE id = ?`
@@ -213,7 +359,7 @@ func (s *Store) MarkConversationAsCompressed(id string) error {
 func (s *Store) GetUncompressedConversations(olderThanDays int, limit int) ([]*ConversationContent, error) {
 	query := `SELECT
 		id, request_log_id, token_id, system_prompt, messages_json,
-		prompt, completion, created_at, is_compressed
+		prompt, completion, created_at, is_compressed, title, tags, starred, truncated
 		FROM conversation_contents
 		WHERE is_compressed = 0 AND created_at < datetime('now', '-' || ? || ' days')
 		LIMIT ?`
@@ -227,13 +373,15 @@ func (s *Store) GetUncompressedConversations(olderThanDays int, limit int) ([]*C
 	var conversations []*ConversationContent
 	for rows.Next() {
 		var conv ConversationContent
+		var tags string
 		err := rows.Scan(
 			&conv.ID, &conv.RequestLogID, &conv.TokenID, &conv.SystemPrompt, &conv.MessagesJSON,
-			&conv.Prompt, &conv.Completion, &conv.CreatedAt, &conv.IsCompressed,
+			&conv.Prompt, &conv.Completion, &conv.CreatedAt, &conv.IsCompressed, &conv.Title, &tags, &conv.Starred, &conv.Truncated,
 		)
 		if err != nil {
 			return nil, err
 		}
+		conv.Tags = unmarshalConversationTags(tags)
 		conversations = append(conversations, &conv)
 	}
 
@@ -0,0 +1,57 @@
+package store
+
+// TokenUsageCounters are the running usage totals of a token
+type TokenUsageCounters struct {
+	TotalRequests   int `json:"total_requests"`
+	TotalTokensUsed int `json:"total_tokens_used"`
+}
+
+// AccountCounters are the running request outcome counts of an account
+type AccountCounters struct {
+	ErrorCount   int `json:"error_count"`
+	SuccessCount int `json:"success_count"`
+}
+
+// ResetTokenUsage zeroes a token's usage totals and returns their previous
+// values, or sql.ErrNoRows if the token does not exist. Request logs and
+// daily stats are kept.
+func (s *Store) ResetTokenUsage(id string) (*TokenUsageCounters, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var prev TokenUsageCounters
+	err = tx.QueryRow(`SELECT COALESCE(total_requests, 0), COALESCE(total_tokens_used, 0) FROM tokens WHERE id = ?`, id).
+		Scan(&prev.TotalRequests, &prev.TotalTokensUsed)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(`UPDATE tokens SET total_requests = 0, total_tokens_used = 0 WHERE id = ?`, id); err != nil {
+		return nil, err
+	}
+	return &prev, tx.Commit()
+}
+
+// ResetAccountCounters zeroes an account's error and success counts and
+// returns their previous values, or sql.ErrNoRows if the account does not
+// exist
+func (s *Store) ResetAccountCounters(id string) (*AccountCounters, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var prev AccountCounters
+	err = tx.QueryRow(`SELECT COALESCE(error_count, 0), COALESCE(success_count, 0) FROM accounts WHERE id = ?`, id).
+		Scan(&prev.ErrorCount, &prev.SuccessCount)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(`UPDATE accounts SET error_count = 0, success_count = 0 WHERE id = ?`, id); err != nil {
+		return nil, err
+	}
+	return &prev, tx.Commit()
+}
@@ -0,0 +1,93 @@
+package store
+
+import "time"
+
+// UnclassifiedFailure is a failed request waiting for a failure category
+type UnclassifiedFailure struct {
+	ID           string
+	StatusCode   int
+	ErrorMessage string
+}
+
+// ListUnclassifiedFailures returns failed requests since the given time that
+// have no failure category yet, oldest first
+func (s *Store) ListUnclassifiedFailures(since time.Time, limit int) ([]*UnclassifiedFailure, error) {
+	rows, err := s.db.Query(`SELECT id, status_code, COALESCE(error_message, '')
+		FROM request_logs
+		WHERE success = 0 AND failure_category IS NULL AND request_at >= ?
+		ORDER BY request_at ASC
+		LIMIT ?`, since, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var failures []*UnclassifiedFailure
+	for rows.Next() {
+		var f UnclassifiedFailure
+		if err := rows.Scan(&f.ID, &f.StatusCode, &f.ErrorMessage); err != nil {
+			return nil, err
+		}
+		failures = append(failures, &f)
+	}
+	return failures, rows.Err()
+}
+
+// SetFailureCategories stores the failure category of request logs by ID
+func (s *Store) SetFailureCategories(categories map[string]string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`UPDATE request_logs SET failure_category = ? WHERE id = ?`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for id, category := range categories {
+		if _, err := stmt.Exec(category, id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// FailureCategoryCount is the number of failed requests in one category
+type FailureCategoryCount struct {
+	Category string `json:"category"`
+	Count    int    `json:"count"`
+}
+
+// GetFailureCategoryCounts counts failed requests since the given time by
+// category, largest first. Failures the classifier has not reached yet are
+// counted as "unclassified". accountID limits the counts to one account.
+func (s *Store) GetFailureCategoryCounts(since time.Time, accountID string) ([]*FailureCategoryCount, error) {
+	query := `SELECT COALESCE(failure_category, 'unclassified'), COUNT(*)
+		FROM request_logs
+		WHERE success = 0 AND request_at >= ?`
+	args := []interface{}{since}
+	if accountID != "" {
+		query += ` AND account_id = ?`
+		args = append(args, accountID)
+	}
+	query += ` GROUP BY 1 ORDER BY COUNT(*) DESC`
+
+	rows, err := s.read.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var counts []*FailureCategoryCount
+	for rows.Next() {
+		var c FailureCategoryCount
+		if err := rows.Scan(&c.Category, &c.Count); err != nil {
+			return nil, err
+		}
+		counts = append(counts, &c)
+	}
+	return counts, rows.Err()
+}
@@ -0,0 +1,108 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Health check sources
+const (
+	HealthCheckSourceMonitor = "monitor" // Periodic health monitor check
+	HealthCheckSourceManual  = "manual"  // Admin-triggered check
+)
+
+// HealthCheckRecord is the result of one account health check
+type HealthCheckRecord struct {
+	ID        int64     `json:"id"`
+	AccountID string    `json:"account_id"`
+	Healthy   bool      `json:"healthy"`
+	Status    string    `json:"status"` // "healthy" or "unhealthy"
+	LatencyMs int64     `json:"latency_ms"`
+	Error     string    `json:"error,omitempty"`
+	Source    string    `json:"source"` // One of the HealthCheckSource constants
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// HealthUptime summarizes the health checks of an account over a period
+type HealthUptime struct {
+	Checks        int      `json:"checks"`
+	Healthy       int      `json:"healthy"`
+	UptimePercent *float64 `json:"uptime_percent"` // nil without checks
+	AvgLatencyMs  int64    `json:"avg_latency_ms"`
+}
+
+// RecordHealthCheck appends a health check result to the account's history
+func (s *Store) RecordHealthCheck(record *HealthCheckRecord) error {
+	record.Status = "unhealthy"
+	if record.Healthy {
+		record.Status = "healthy"
+	}
+	result, err := s.db.Exec(`INSERT INTO account_health_checks
+		(account_id, healthy, latency_ms, error, source, checked_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		record.AccountID, record.Healthy, record.LatencyMs, record.Error, record.Source, record.CheckedAt)
+	if err != nil {
+		return err
+	}
+	record.ID, _ = result.LastInsertId()
+	return nil
+}
+
+// ListHealthChecks returns an account's health checks since the given time,
+// newest first, at most limit of them
+func (s *Store) ListHealthChecks(accountID string, since time.Time, limit int) ([]*HealthCheckRecord, error) {
+	rows, err := s.read.Query(`SELECT id, account_id, healthy, latency_ms, error, source, checked_at
+		FROM account_health_checks
+		WHERE account_id = ? AND checked_at >= ?
+		ORDER BY checked_at DESC, id DESC
+		LIMIT ?`, accountID, since, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := []*HealthCheckRecord{}
+	for rows.Next() {
+		var record HealthCheckRecord
+		var checkErr sql.NullString
+		if err := rows.Scan(&record.ID, &record.AccountID, &record.Healthy, &record.LatencyMs,
+			&checkErr, &record.Source, &record.CheckedAt); err != nil {
+			return nil, err
+		}
+		record.Error = checkErr.String
+		record.Status = "unhealthy"
+		if record.Healthy {
+			record.Status = "healthy"
+		}
+		records = append(records, &record)
+	}
+	return records, rows.Err()
+}
+
+// GetHealthUptime returns the share of an account's health checks since the
+// given time that passed
+func (s *Store) GetHealthUptime(accountID string, since time.Time) (*HealthUptime, error) {
+	uptime := &HealthUptime{}
+	var avgLatency sql.NullFloat64
+	err := s.read.QueryRow(`SELECT COUNT(*), COALESCE(SUM(CASE WHEN healthy THEN 1 ELSE 0 END), 0), AVG(latency_ms)
+		FROM account_health_checks
+		WHERE account_id = ? AND checked_at >= ?`, accountID, since).Scan(&uptime.Checks, &uptime.Healthy, &avgLatency)
+	if err != nil {
+		return nil, err
+	}
+	if uptime.Checks > 0 {
+		percent := float64(uptime.Healthy) / float64(uptime.Checks) * 100
+		uptime.UptimePercent = &percent
+	}
+	uptime.AvgLatencyMs = int64(avgLatency.Float64)
+	return uptime, nil
+}
+
+// DeleteOldHealthChecks removes health checks older than the given number of days
+func (s *Store) DeleteOldHealthChecks(daysToKeep int) (int64, error) {
+	result, err := s.db.Exec(`DELETE FROM account_health_checks WHERE checked_at < ?`,
+		time.Now().AddDate(0, 0, -daysToKeep))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,133 @@
+package store
+
+import (
+	"time"
+)
+
+// AccountHealthSignals aggregates recent request outcomes for health scoring
+type AccountHealthSignals struct {
+	TotalRequests  int   `json:"total_requests"`
+	FailedRequests int   `json:"failed_requests"`
+	RateLimited    int   `json:"rate_limited"` // 429 responses
+	Overloaded     int   `json:"overloaded"`   // 529 responses
+	P95LatencyMs   int64 `json:"p95_latency_ms"`
+}
+
+// HealthScorePoint is a recorded health score sample
+type HealthScorePoint struct {
+	Score      int       `json:"score"`
+	RecordedAt time.Time `json:"recorded_at"`
+}
+
+// GetAccountHealthSignals returns request outcome signals for an account since
+// the given time. Rows are weighted by sampleWeightSQL, so log sampling does
+// not inflate the error share or the p95 latency.
+func (s *Store) GetAccountHealthSignals(accountID string, since time.Time) (*AccountHealthSignals, error) {
+	query := `SELECT
+		CAST(ROUND(COALESCE(SUM(` + sampleWeightSQL + `), 0)) AS INTEGER),
+		CAST(ROUND(COALESCE(SUM(CASE WHEN success = 0 THEN ` + sampleWeightSQL + ` ELSE 0 END), 0)) AS INTEGER),
+		CAST(ROUND(COALESCE(SUM(CASE WHEN status_code = 429 THEN ` + sampleWeightSQL + ` ELSE 0 END), 0)) AS INTEGER),
+		CAST(ROUND(COALESCE(SUM(CASE WHEN status_code = 529 THEN ` + sampleWeightSQL + ` ELSE 0 END), 0)) AS INTEGER),
+		COUNT(duration_ms)
+		FROM request_logs
+		WHERE account_id = ? AND request_at >= ?`
+
+	var signals AccountHealthSignals
+	var latencySamples int
+	err := s.db.QueryRow(query, accountID, since).Scan(
+		&signals.TotalRequests, &signals.FailedRequests,
+		&signals.RateLimited, &signals.Overloaded, &latencySamples,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if latencySamples > 0 {
+		// First latency past 95% of the weighted requests
+		p95Query := `SELECT duration_ms FROM (
+				SELECT duration_ms,
+					SUM(` + sampleWeightSQL + `) OVER (ORDER BY duration_ms ROWS UNBOUNDED PRECEDING) AS cumulative,
+					SUM(` + sampleWeightSQL + `) OVER () AS total
+				FROM request_logs
+				WHERE account_id = ? AND request_at >= ? AND duration_ms IS NOT NULL
+			)
+			WHERE cumulative > total * 0.95
+			ORDER BY duration_ms ASC
+			LIMIT 1`
+		if err := s.db.QueryRow(p95Query, accountID, since).Scan(&signals.P95LatencyMs); err != nil {
+			return nil, err
+		}
+	}
+
+	return &signals, nil
+}
+
+// UpdateAccountHealthScore stores the current health score and appends it to the history
+func (s *Store) UpdateAccountHealthScore(id string, score int) error {
+	if _, err := s.db.Exec(`UPDATE accounts SET health_score = ? WHERE id = ?`, score, id); err != nil {
+		return err
+	}
+
+	_, err := s.db.Exec(`INSERT INTO account_health_history (account_id, score, recorded_at) VALUES (?, ?, ?)`,
+		id, score, time.Now())
+	return err
+}
+
+// GetAccountHealthHistory returns health score samples for an account since the given time
+func (s *Store) GetAccountHealthHistory(accountID string, since time.Time) ([]*HealthScorePoint, error) {
+	query := `SELECT score, recorded_at FROM account_health_history
+		WHERE account_id = ? AND recorded_at >= ?
+		ORDER BY recorded_at ASC`
+
+	rows, err := s.read.Query(query, accountID, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var points []*HealthScorePoint
+	for rows.Next() {
+		var point HealthScorePoint
+		if err := rows.Scan(&point.Score, &point.RecordedAt); err != nil {
+			return nil, err
+		}
+		points = append(points, &point)
+	}
+
+	return points, rows.Err()
+}
+
+// getDailyHealthScores returns the average health score per day for an account
+func (s *Store) getDailyHealthScores(accountID string, days int) (map[string]float64, error) {
+	query := `SELECT date(recorded_at), AVG(score)
+		FROM account_health_history
+		WHERE account_id = ? AND recorded_at >= date('now', '-' || ? || ' days')
+		GROUP BY date(recorded_at)`
+
+	rows, err := s.read.Query(query, accountID, days)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	scores := make(map[string]float64)
+	for rows.Next() {
+		var date string
+		var avg float64
+		if err := rows.Scan(&date, &avg); err != nil {
+			return nil, err
+		}
+		scores[date] = avg
+	}
+
+	return scores, rows.Err()
+}
+
+// DeleteOldHealthHistory removes health score samples older than the given number of days
+func (s *Store) DeleteOldHealthHistory(daysToKeep int) (int64, error) {
+	result, err := s.db.Exec(`DELETE FROM account_health_history WHERE recorded_at < datetime('now', '-' || ? || ' days')`, daysToKeep)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
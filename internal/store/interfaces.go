@@ -0,0 +1,66 @@
+package store
+
+// The interfaces below are narrow views of Store for handlers, services and
+// middleware that only need part of it, so they can be tested against the
+// in-memory fake in store/storetest instead of a SQLite file.
+
+// AccountStore reads and writes accounts
+type AccountStore interface {
+	CreateAccount(account *Account) error
+	GetAccount(id string) (*Account, error)
+	ListAccounts() ([]*Account, error)
+	ListAccountsWithStatus() ([]*Account, error)
+	UpdateAccount(account *Account) error
+	UpdateAccountLastUsed(id string) error
+	DeactivateAccount(id string) error
+	DeleteAccount(id string) error
+}
+
+// TokenStore reads and writes API tokens
+type TokenStore interface {
+	CreateToken(token *Token) error
+	GetToken(id string) (*Token, error)
+	ValidateToken(id string) (*Token, error)
+	ListTokens() ([]*Token, error)
+	RevokeToken(id string) error
+	UpdateTokenLastUsed(id string) error
+	UpdateTokenSettings(id string, enableConvLogging bool) error
+	UpdateTokenMaxRequestSeconds(id string, seconds int) error
+	UpdateTokenRetentionDays(id string, days int) error
+	UpdateTokenResponseFooter(id string, footer string) error
+	UpdateTokenFlagOverrides(id string, allow bool) error
+	UpdateTokenIssuer(id string, issuer bool) error
+	UpdateTokenClientCertIdentity(id string, identity string) error
+	TokenIDByClientCert(identity string) (string, error)
+	UpdateTokenExternalSubject(id string, subject string) error
+	TokenIDByExternalSubject(subject string) (string, error)
+	UpdateTokenPriority(id string, priority string) error
+	UpdateTokenDefaultModel(id string, model string) error
+	UpdateTokenRateLimitBypass(id string, classes string) error
+	UpdateTokenAllowedEndpoints(id string, endpoints string) error
+	UpdateTokenStreamFlush(id string, flushMs, flushBytes int) error
+	UpdateTokenOutputFilters(id string, filters string) error
+	IncrementTokenUsage(id string, tokensUsed int) error
+}
+
+// LogStore reads and writes request logs
+type LogStore interface {
+	CreateRequestLog(log *RequestLog) error
+	GetRequestLog(id string) (*RequestLog, error)
+	ListRequestLogs(filter RequestLogFilter) ([]*RequestLog, int, error)
+	DeleteOldRequestLogs(daysToKeep int) (int64, error)
+}
+
+// AdminSessionStore records SSO admin sessions and their revocation
+type AdminSessionStore interface {
+	CreateAdminSession(session *AdminSession) error
+	GetAdminSession(id string) (*AdminSession, error)
+	RevokeAdminSession(id string) error
+}
+
+var (
+	_ AccountStore      = (*Store)(nil)
+	_ TokenStore        = (*Store)(nil)
+	_ LogStore          = (*Store)(nil)
+	_ AdminSessionStore = (*Store)(nil)
+)
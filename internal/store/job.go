@@ -0,0 +1,252 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// Job statuses
+const (
+	JobPending   = "pending"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+	JobCanceled  = "canceled"
+)
+
+// JobStep is the progress of one named step of a job
+type JobStep struct {
+	Name       string     `json:"name"`
+	Status     string     `json:"status"`
+	Attempts   int        `json:"attempts"`
+	Error      string     `json:"error,omitempty"` // Error of the last failed attempt
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// Job is a background task run by internal/jobs. The payload can hold
+// secrets, such as the session key of an OAuth onboarding; it is never
+// exposed and is cleared once the job finishes.
+type Job struct {
+	ID          string          `json:"id"`
+	Type        string          `json:"type"`
+	Status      string          `json:"status"`
+	Payload     string          `json:"-"`
+	Result      json.RawMessage `json:"result,omitempty"`
+	Error       string          `json:"error,omitempty"`
+	Progress    int             `json:"progress"` // Percent done
+	Message     string          `json:"message,omitempty"`
+	Steps       []JobStep       `json:"steps"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"max_attempts"`
+	RunAt       time.Time       `json:"run_at"` // Earliest start of the next attempt
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+	StartedAt   *time.Time      `json:"started_at,omitempty"`
+	FinishedAt  *time.Time      `json:"finished_at,omitempty"`
+}
+
+// Finished reports whether a job will not run again
+func (j *Job) Finished() bool {
+	return j.Status == JobSucceeded || j.Status == JobFailed || j.Status == JobCanceled
+}
+
+// JobFilter selects jobs to list
+type JobFilter struct {
+	Type   string
+	Status string
+	Limit  int
+	Offset int
+}
+
+// clearedJobPayload replaces the payload of finished jobs
+const clearedJobPayload = "{}"
+
+const jobColumns = `id, type, status, payload, result, COALESCE(error, ''), progress, COALESCE(message, ''), steps,
+	attempts, max_attempts, run_at, created_at, updated_at, started_at, finished_at`
+
+// CreateJob stores a new job
+func (s *Store) CreateJob(job *Job) error {
+	steps, err := marshalJobSteps(job.Steps)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`INSERT INTO jobs (id, type, status, payload, result, error, progress, message, steps,
+			attempts, max_attempts, run_at, created_at, updated_at, started_at, finished_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		job.ID, job.Type, job.Status, job.Payload, nullJobResult(job.Result), job.Error, job.Progress, job.Message, steps,
+		job.Attempts, job.MaxAttempts, job.RunAt.UTC(), job.CreatedAt, job.UpdatedAt, job.StartedAt, job.FinishedAt)
+	return err
+}
+
+// GetJob returns a job, or nil if it does not exist
+func (s *Store) GetJob(id string) (*Job, error) {
+	job, err := scanJob(s.db.QueryRow(`SELECT `+jobColumns+` FROM jobs WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return job, err
+}
+
+// ListJobs returns jobs matching filter, newest first, and the total number of matches
+func (s *Store) ListJobs(filter JobFilter) ([]*Job, int, error) {
+	var where []string
+	var args []interface{}
+	if filter.Type != "" {
+		where = append(where, "type = ?")
+		args = append(args, filter.Type)
+	}
+	if filter.Status != "" {
+		where = append(where, "status = ?")
+		args = append(args, filter.Status)
+	}
+	clause := ""
+	if len(where) > 0 {
+		clause = " WHERE " + strings.Join(where, " AND ")
+	}
+
+	var total int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM jobs`+clause, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = 50
+	}
+	rows, err := s.db.Query(`SELECT `+jobColumns+` FROM jobs`+clause+` ORDER BY created_at DESC LIMIT ? OFFSET ?`,
+		append(args, limit, filter.Offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	jobs := []*Job{}
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, total, rows.Err()
+}
+
+// UpdateJob saves a job's status, outcome and progress. The payload of a
+// finished job is cleared, as it is no longer needed.
+func (s *Store) UpdateJob(job *Job) error {
+	steps, err := marshalJobSteps(job.Steps)
+	if err != nil {
+		return err
+	}
+	if job.Finished() {
+		job.Payload = clearedJobPayload
+	}
+	_, err = s.db.Exec(`UPDATE jobs SET status = ?, payload = CASE WHEN ? THEN ? ELSE payload END, result = ?, error = ?,
+			progress = ?, message = ?, steps = ?, attempts = ?, run_at = ?, updated_at = ?, started_at = ?, finished_at = ?
+		WHERE id = ?`,
+		job.Status, job.Finished(), clearedJobPayload, nullJobResult(job.Result), job.Error, job.Progress, job.Message, steps,
+		job.Attempts, job.RunAt.UTC(), job.UpdatedAt, job.StartedAt, job.FinishedAt, job.ID)
+	return err
+}
+
+// ClaimJob marks the oldest pending job of the given types that is due by
+// now as running and returns it, or nil if none is due
+func (s *Store) ClaimJob(types []string, now time.Time) (*Job, error) {
+	if len(types) == 0 {
+		return nil, nil
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	args := []interface{}{JobPending, now.UTC()}
+	for _, jobType := range types {
+		args = append(args, jobType)
+	}
+	var id string
+	err = tx.QueryRow(`SELECT id FROM jobs WHERE status = ? AND run_at <= ?
+		AND type IN (?`+strings.Repeat(", ?", len(types)-1)+`)
+		ORDER BY run_at, created_at LIMIT 1`, args...).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(`UPDATE jobs SET status = ?, attempts = attempts + 1, started_at = COALESCE(started_at, ?), updated_at = ?
+		WHERE id = ?`, JobRunning, now, now, id); err != nil {
+		return nil, err
+	}
+	job, err := scanJob(tx.QueryRow(`SELECT `+jobColumns+` FROM jobs WHERE id = ?`, id))
+	if err != nil {
+		return nil, err
+	}
+	return job, tx.Commit()
+}
+
+// RequeueRunningJobs returns jobs left running by a stopped process to the
+// queue, so they are attempted again
+func (s *Store) RequeueRunningJobs(now time.Time) (int64, error) {
+	result, err := s.db.Exec(`UPDATE jobs SET status = ?, run_at = ?, updated_at = ? WHERE status = ?`,
+		JobPending, now.UTC(), now, JobRunning)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// DeleteFinishedJobs deletes jobs finished before cutoff
+func (s *Store) DeleteFinishedJobs(before time.Time) (int64, error) {
+	result, err := s.db.Exec(`DELETE FROM jobs WHERE status IN (?, ?, ?) AND finished_at < ?`,
+		JobSucceeded, JobFailed, JobCanceled, before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func scanJob(row interface{ Scan(...interface{}) error }) (*Job, error) {
+	var job Job
+	var result sql.NullString
+	var steps string
+	var startedAt, finishedAt sql.NullTime
+	if err := row.Scan(&job.ID, &job.Type, &job.Status, &job.Payload, &result, &job.Error, &job.Progress, &job.Message, &steps,
+		&job.Attempts, &job.MaxAttempts, &job.RunAt, &job.CreatedAt, &job.UpdatedAt, &startedAt, &finishedAt); err != nil {
+		return nil, err
+	}
+	if result.Valid && result.String != "" {
+		job.Result = json.RawMessage(result.String)
+	}
+	job.Steps = []JobStep{}
+	if err := json.Unmarshal([]byte(steps), &job.Steps); err != nil {
+		return nil, err
+	}
+	if startedAt.Valid {
+		job.StartedAt = &startedAt.Time
+	}
+	if finishedAt.Valid {
+		job.FinishedAt = &finishedAt.Time
+	}
+	return &job, nil
+}
+
+func marshalJobSteps(steps []JobStep) (string, error) {
+	if steps == nil {
+		steps = []JobStep{}
+	}
+	data, err := json.Marshal(steps)
+	return string(data), err
+}
+
+func nullJobResult(result json.RawMessage) interface{} {
+	if len(result) == 0 {
+		return nil
+	}
+	return string(result)
+}
@@ -0,0 +1,50 @@
+package store
+
+import "time"
+
+// JWTKey is a JWT signing key added through the admin API
+type JWTKey struct {
+	ID        string
+	Secret    string
+	Active    bool // Signs new tokens instead of jwt.secret
+	CreatedAt time.Time
+}
+
+// CreateJWTKey stores a new key
+func (s *Store) CreateJWTKey(key *JWTKey) error {
+	_, err := s.db.Exec(`INSERT INTO jwt_keys (id, secret, active, created_at) VALUES (?, ?, ?, ?)`,
+		key.ID, key.Secret, key.Active, key.CreatedAt)
+	return err
+}
+
+// ListJWTKeys returns all stored keys, oldest first
+func (s *Store) ListJWTKeys() ([]*JWTKey, error) {
+	rows, err := s.db.Query(`SELECT id, secret, COALESCE(active, 0), created_at FROM jwt_keys ORDER BY created_at, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []*JWTKey
+	for rows.Next() {
+		var k JWTKey
+		if err := rows.Scan(&k.ID, &k.Secret, &k.Active, &k.CreatedAt); err != nil {
+			return nil, err
+		}
+		keys = append(keys, &k)
+	}
+	return keys, rows.Err()
+}
+
+// SetActiveJWTKey marks key id as the signing key; an empty id (or the id of
+// a configured secret) clears the mark, so jwt.secret signs again
+func (s *Store) SetActiveJWTKey(id string) error {
+	_, err := s.db.Exec(`UPDATE jwt_keys SET active = (id = ?)`, id)
+	return err
+}
+
+// DeleteJWTKey removes a key
+func (s *Store) DeleteJWTKey(id string) error {
+	_, err := s.db.Exec(`DELETE FROM jwt_keys WHERE id = ?`, id)
+	return err
+}
@@ -0,0 +1,165 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// LatencyBucketsMs are the upper bounds of the latency histogram buckets
+// stored with daily usage stats; a final bucket holds everything slower.
+// Buckets are roughly log-spaced, so percentiles are accurate to about 25%.
+var LatencyBucketsMs = []int64{
+	25, 50, 100, 200, 300, 500, 750, 1000, 1500, 2000, 3000, 5000, 7500,
+	10000, 15000, 20000, 30000, 45000, 60000, 90000, 120000, 180000, 300000, 600000,
+}
+
+// LatencyHistogram counts requests per latency bucket. Histograms of
+// different rows merge by adding counts, unlike averages.
+type LatencyHistogram []int64
+
+// LatencyPercentiles summarize a latency histogram
+type LatencyPercentiles struct {
+	Samples int64 `json:"samples"`
+	P50     int64 `json:"p50_ms"`
+	P95     int64 `json:"p95_ms"`
+	P99     int64 `json:"p99_ms"`
+}
+
+// LatencyHistogramSQL returns an aggregate SQL expression building the JSON
+// histogram of column over a group of request_logs rows; NULLs are skipped
+func LatencyHistogramSQL(column string) string {
+	parts := make([]string, 0, len(LatencyBucketsMs)+1)
+	lower := "0"
+	for _, upper := range LatencyBucketsMs {
+		parts = append(parts, fmt.Sprintf("SUM(CASE WHEN %s >= %s AND %s < %d THEN 1 ELSE 0 END)", column, lower, column, upper))
+		lower = fmt.Sprint(upper)
+	}
+	parts = append(parts, fmt.Sprintf("SUM(CASE WHEN %s >= %s THEN 1 ELSE 0 END)", column, lower))
+	return "json_array(" + strings.Join(parts, ", ") + ")"
+}
+
+// merge adds the histogram stored in raw; rows written before histograms
+// were recorded, or with other bucket layouts, are skipped
+func (h LatencyHistogram) merge(raw sql.NullString) {
+	if !raw.Valid || raw.String == "" {
+		return
+	}
+	var counts []int64
+	if err := json.Unmarshal([]byte(raw.String), &counts); err != nil || len(counts) != len(h) {
+		return
+	}
+	for i, n := range counts {
+		h[i] += n
+	}
+}
+
+// add adds the counts of other
+func (h LatencyHistogram) add(other LatencyHistogram) {
+	for i := range h {
+		h[i] += other[i]
+	}
+}
+
+func newLatencyHistogram() LatencyHistogram {
+	return make(LatencyHistogram, len(LatencyBucketsMs)+1)
+}
+
+// Percentiles estimates p50, p95 and p99 by interpolating within buckets,
+// or returns nil for an empty histogram
+func (h LatencyHistogram) Percentiles() *LatencyPercentiles {
+	var total int64
+	for _, n := range h {
+		total += n
+	}
+	if total == 0 {
+		return nil
+	}
+	return &LatencyPercentiles{
+		Samples: total,
+		P50:     h.percentile(0.50, total),
+		P95:     h.percentile(0.95, total),
+		P99:     h.percentile(0.99, total),
+	}
+}
+
+func (h LatencyHistogram) percentile(q float64, total int64) int64 {
+	rank := q * float64(total)
+	var seen int64
+	for i, n := range h {
+		if n == 0 || float64(seen+n) < rank {
+			seen += n
+			continue
+		}
+		var lower int64
+		if i > 0 {
+			lower = LatencyBucketsMs[i-1]
+		}
+		if i == len(LatencyBucketsMs) {
+			// Slower than the last bound; report the bound
+			return lower
+		}
+		upper := LatencyBucketsMs[i]
+		return lower + int64(float64(upper-lower)*(rank-float64(seen))/float64(n))
+	}
+	return LatencyBucketsMs[len(LatencyBucketsMs)-1]
+}
+
+// latencyStats are the duration and TTFT histograms of one group of rows
+type latencyStats struct {
+	duration LatencyHistogram
+	ttft     LatencyHistogram
+}
+
+// queryLatency merges the histograms of usage_stats_daily rows matching
+// where, grouped by groupBy ("" for a single group under "")
+func (s *Store) queryLatency(groupBy, where string, args ...interface{}) (map[string]*latencyStats, error) {
+	group := "''"
+	if groupBy != "" {
+		group = "COALESCE(" + groupBy + ", '')"
+	}
+	rows, err := s.read.Query(`SELECT `+group+`, duration_histogram, ttft_histogram
+		FROM usage_stats_daily WHERE `+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	groups := make(map[string]*latencyStats)
+	for rows.Next() {
+		var key string
+		var duration, ttft sql.NullString
+		if err := rows.Scan(&key, &duration, &ttft); err != nil {
+			return nil, err
+		}
+		g, ok := groups[key]
+		if !ok {
+			g = &latencyStats{duration: newLatencyHistogram(), ttft: newLatencyHistogram()}
+			groups[key] = g
+		}
+		g.duration.merge(duration)
+		g.ttft.merge(ttft)
+	}
+	return groups, rows.Err()
+}
+
+// apply sets the percentiles of stats
+func (l *latencyStats) apply(stats *AggregatedStats) {
+	if l == nil || stats == nil {
+		return
+	}
+	stats.DurationPercentiles = l.duration.Percentiles()
+	stats.TTFTPercentiles = l.ttft.Percentiles()
+}
+
+// latencyByModel returns the duration percentiles of each model
+func latencyByModel(groups map[string]*latencyStats) map[string]*LatencyPercentiles {
+	byModel := make(map[string]*LatencyPercentiles, len(groups))
+	for model, g := range groups {
+		if p := g.duration.Percentiles(); p != nil {
+			byModel[model] = p
+		}
+	}
+	return byModel
+}
@@ -0,0 +1,104 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+)
+
+// MirrorResult pairs a primary response with the response of its mirrored copy
+type MirrorResult struct {
+	ID               int64     `json:"id"`
+	CreatedAt        time.Time `json:"created_at"`
+	Path             string    `json:"path"`
+	TokenID          string    `json:"token_id,omitempty"`
+	RequestBody      string    `json:"request_body,omitempty"`
+	PrimaryModel     string    `json:"primary_model"`
+	PrimaryStatus    int       `json:"primary_status"`
+	PrimaryLatencyMs int64     `json:"primary_latency_ms"`
+	PrimaryResponse  string    `json:"primary_response,omitempty"`
+	MirrorModel      string    `json:"mirror_model"`
+	MirrorStatus     int       `json:"mirror_status"`
+	MirrorLatencyMs  int64     `json:"mirror_latency_ms"`
+	MirrorResponse   string    `json:"mirror_response,omitempty"`
+	MirrorError      string    `json:"mirror_error,omitempty"`
+}
+
+// CreateMirrorResult stores a mirrored request outcome
+func (s *Store) CreateMirrorResult(r *MirrorResult) error {
+	result, err := s.db.Exec(`INSERT INTO mirror_results (
+			created_at, path, token_id, request_body,
+			primary_model, primary_status, primary_latency_ms, primary_response,
+			mirror_model, mirror_status, mirror_latency_ms, mirror_response, mirror_error)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		r.CreatedAt, r.Path, r.TokenID, r.RequestBody,
+		r.PrimaryModel, r.PrimaryStatus, r.PrimaryLatencyMs, r.PrimaryResponse,
+		r.MirrorModel, r.MirrorStatus, r.MirrorLatencyMs, r.MirrorResponse, r.MirrorError)
+	if err != nil {
+		return err
+	}
+	r.ID, _ = result.LastInsertId()
+	return nil
+}
+
+// ListMirrorResults returns mirror results, newest first. Request and response
+// bodies are only included when withBodies is set.
+func (s *Store) ListMirrorResults(limit, offset int, withBodies bool) ([]*MirrorResult, error) {
+	bodies := `'', '', ''`
+	if withBodies {
+		bodies = `COALESCE(request_body, ''), COALESCE(primary_response, ''), COALESCE(mirror_response, '')`
+	}
+	rows, err := s.read.Query(`SELECT id, created_at, path, COALESCE(token_id, ''),
+			COALESCE(primary_model, ''), COALESCE(primary_status, 0), COALESCE(primary_latency_ms, 0),
+			COALESCE(mirror_model, ''), COALESCE(mirror_status, 0), COALESCE(mirror_latency_ms, 0),
+			COALESCE(mirror_error, ''), `+bodies+`
+		FROM mirror_results
+		ORDER BY id DESC
+		LIMIT ? OFFSET ?`, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []*MirrorResult
+	for rows.Next() {
+		var r MirrorResult
+		if err := rows.Scan(&r.ID, &r.CreatedAt, &r.Path, &r.TokenID,
+			&r.PrimaryModel, &r.PrimaryStatus, &r.PrimaryLatencyMs,
+			&r.MirrorModel, &r.MirrorStatus, &r.MirrorLatencyMs,
+			&r.MirrorError, &r.RequestBody, &r.PrimaryResponse, &r.MirrorResponse); err != nil {
+			return nil, err
+		}
+		results = append(results, &r)
+	}
+	return results, rows.Err()
+}
+
+// GetMirrorResult returns a single mirror result with bodies
+func (s *Store) GetMirrorResult(id int64) (*MirrorResult, error) {
+	var r MirrorResult
+	err := s.read.QueryRow(`SELECT id, created_at, path, COALESCE(token_id, ''), COALESCE(request_body, ''),
+			COALESCE(primary_model, ''), COALESCE(primary_status, 0), COALESCE(primary_latency_ms, 0), COALESCE(primary_response, ''),
+			COALESCE(mirror_model, ''), COALESCE(mirror_status, 0), COALESCE(mirror_latency_ms, 0), COALESCE(mirror_response, ''),
+			COALESCE(mirror_error, '')
+		FROM mirror_results WHERE id = ?`, id).Scan(
+		&r.ID, &r.CreatedAt, &r.Path, &r.TokenID, &r.RequestBody,
+		&r.PrimaryModel, &r.PrimaryStatus, &r.PrimaryLatencyMs, &r.PrimaryResponse,
+		&r.MirrorModel, &r.MirrorStatus, &r.MirrorLatencyMs, &r.MirrorResponse,
+		&r.MirrorError)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// DeleteOldMirrorResults removes mirror results older than the given time
+func (s *Store) DeleteOldMirrorResults(before time.Time) (int64, error) {
+	result, err := s.db.Exec(`DELETE FROM mirror_results WHERE created_at < ?`, before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,86 @@
+package store
+
+import (
+	"strings"
+	"time"
+)
+
+// ModelOverload is an overload cooldown for a single (account, model) pair
+type ModelOverload struct {
+	AccountID     string    `json:"account_id"`
+	Model         string    `json:"model"`
+	OverloadUntil time.Time `json:"overload_until"`
+	Reason        string    `json:"reason,omitempty"`
+	Count         int       `json:"count"` // Overloads recorded for this pair
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// normalizeOverloadModel keys overloads case-insensitively
+func normalizeOverloadModel(model string) string {
+	return strings.ToLower(strings.TrimSpace(model))
+}
+
+// SetAccountModelOverload puts an account into overload cooldown for one model
+func (s *Store) SetAccountModelOverload(accountID, model string, until time.Time, reason string) error {
+	now := time.Now()
+	_, err := s.db.Exec(`INSERT INTO account_model_overloads (account_id, model, overload_until, reason, overload_count, updated_at)
+		VALUES (?, ?, ?, ?, 1, ?)
+		ON CONFLICT(account_id, model) DO UPDATE SET
+			overload_until = excluded.overload_until,
+			reason = excluded.reason,
+			overload_count = overload_count + 1,
+			updated_at = excluded.updated_at`,
+		accountID, normalizeOverloadModel(model), until, reason, now)
+	return err
+}
+
+// ClearAccountModelOverloads removes all model cooldowns of an account
+func (s *Store) ClearAccountModelOverloads(accountID string) error {
+	_, err := s.db.Exec(`DELETE FROM account_model_overloads WHERE account_id = ?`, accountID)
+	return err
+}
+
+// GetAccountModelOverloads returns the active model cooldowns of an account
+func (s *Store) GetAccountModelOverloads(accountID string) ([]*ModelOverload, error) {
+	rows, err := s.db.Query(`SELECT account_id, model, overload_until, COALESCE(reason, ''), overload_count, updated_at
+		FROM account_model_overloads
+		WHERE account_id = ? AND overload_until > ?
+		ORDER BY model`, accountID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var overloads []*ModelOverload
+	for rows.Next() {
+		var o ModelOverload
+		if err := rows.Scan(&o.AccountID, &o.Model, &o.OverloadUntil, &o.Reason, &o.Count, &o.UpdatedAt); err != nil {
+			return nil, err
+		}
+		overloads = append(overloads, &o)
+	}
+
+	return overloads, rows.Err()
+}
+
+// GetModelOverloadedAccounts returns accounts in cooldown for a model, mapped to when the cooldown ends
+func (s *Store) GetModelOverloadedAccounts(model string) (map[string]time.Time, error) {
+	rows, err := s.db.Query(`SELECT account_id, overload_until FROM account_model_overloads
+		WHERE model = ? AND overload_until > ?`, normalizeOverloadModel(model), time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	overloaded := make(map[string]time.Time)
+	for rows.Next() {
+		var accountID string
+		var until time.Time
+		if err := rows.Scan(&accountID, &until); err != nil {
+			return nil, err
+		}
+		overloaded[accountID] = until
+	}
+
+	return overloaded, rows.Err()
+}
@@ -0,0 +1,92 @@
+package store
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newModelOverloadTestStore(t *testing.T) *Store {
+	t.Helper()
+	s, err := New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	for _, id := range []string{"acc-1", "acc-2"} {
+		if err := s.CreateAccount(&Account{
+			ID: id, Name: id, Type: AccountTypeSessionKey,
+			Credentials: Credentials{SessionKey: "sk-ant-sid01-" + id},
+			CreatedAt:   time.Now(), IsActive: true,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return s
+}
+
+func TestModelOverload_RoundTrip(t *testing.T) {
+	s := newModelOverloadTestStore(t)
+	until := time.Now().Add(time.Minute).Truncate(time.Second)
+
+	if err := s.SetAccountModelOverload("acc-1", " Claude-Opus-4 ", until.Add(-30*time.Second), "overloaded_error"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetAccountModelOverload("acc-1", "claude-opus-4", until, "overloaded_error"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetAccountModelOverload("acc-2", "claude-haiku-4", until, "overloaded_error"); err != nil {
+		t.Fatal(err)
+	}
+
+	overloads, err := s.GetAccountModelOverloads("acc-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(overloads) != 1 {
+		t.Fatalf("overloads = %d, want 1 pair keyed case-insensitively", len(overloads))
+	}
+	o := overloads[0]
+	if o.Model != "claude-opus-4" || o.Count != 2 || o.Reason != "overloaded_error" || !o.OverloadUntil.Equal(until) {
+		t.Errorf("overload = %+v, want claude-opus-4 until %v counted twice", o, until)
+	}
+
+	accounts, err := s.GetModelOverloadedAccounts("CLAUDE-OPUS-4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := accounts["acc-1"]; len(accounts) != 1 || !ok {
+		t.Errorf("overloaded accounts for opus = %v, want only acc-1", accounts)
+	}
+
+	if err := s.ClearAccountModelOverloads("acc-1"); err != nil {
+		t.Fatal(err)
+	}
+	if overloads, _ := s.GetAccountModelOverloads("acc-1"); len(overloads) != 0 {
+		t.Errorf("overloads after clear = %v", overloads)
+	}
+	if overloads, _ := s.GetAccountModelOverloads("acc-2"); len(overloads) != 1 {
+		t.Errorf("clearing acc-1 removed acc-2's overloads: %v", overloads)
+	}
+}
+
+func TestModelOverload_Expiry(t *testing.T) {
+	s := newModelOverloadTestStore(t)
+	if err := s.SetAccountModelOverload("acc-1", "claude-opus-4", time.Now().Add(-time.Second), "overloaded_error"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetAccountModelOverload("acc-2", "claude-opus-4", time.Now().Add(time.Minute), "overloaded_error"); err != nil {
+		t.Fatal(err)
+	}
+
+	if overloads, err := s.GetAccountModelOverloads("acc-1"); err != nil || len(overloads) != 0 {
+		t.Errorf("expired overloads = %v, %v, want none", overloads, err)
+	}
+	accounts, err := s.GetModelOverloadedAccounts("claude-opus-4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := accounts["acc-1"]; ok || len(accounts) != 1 {
+		t.Errorf("overloaded accounts = %v, want only acc-2", accounts)
+	}
+}
@@ -0,0 +1,45 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// EnableReadPool moves stats, log and conversation queries to a separate pool
+// of read-only connections, so heavy admin queries do not hold up the request
+// path's writes. path is a read replica of the database, e.g. one restored by
+// a replication tool; "" reads the primary database, which WAL mode lets
+// readers share with the writer.
+func (s *Store) EnableReadPool(path string, maxConns int) error {
+	if path == "" {
+		path = s.path
+	}
+	if maxConns <= 0 {
+		maxConns = 1
+	}
+
+	read, err := sql.Open("sqlite3", "file:"+path+"?mode=ro&_query_only=true&_busy_timeout=5000")
+	if err != nil {
+		return err
+	}
+	read.SetMaxOpenConns(maxConns)
+	read.SetMaxIdleConns(maxConns)
+
+	// Fail now on a missing replica or one without the schema
+	if _, err := read.Exec(`SELECT 1 FROM request_logs LIMIT 1`); err != nil {
+		read.Close()
+		return fmt.Errorf("read pool %s: %w", path, err)
+	}
+
+	if s.read != s.db {
+		s.read.Close()
+	}
+	s.read = read
+	return nil
+}
+
+// GetReadDB returns the handle for reporting queries: the read pool when
+// enabled, the primary database otherwise. Writes through it fail.
+func (s *Store) GetReadDB() *sql.DB {
+	return s.read
+}
@@ -8,26 +8,54 @@ import (
 )
 
 type RequestLog struct {
-	ID               string
-	TokenID          string
-	AccountID        sql.NullString
-	UserName         string
-	Mode             string
-	Model            string
-	Stream           bool
-	RequestAt        time.Time
-	ResponseAt       sql.NullTime
-	DurationMs       sql.NullInt64
-	TTFTMs           sql.NullInt64
-	PromptTokens     int
-	CompletionTokens int
-	TotalTokens      int
-	StatusCode       int
-	Success          bool
-	ErrorMessage     sql.NullString
-	ConversationID   sql.NullString
+	ID                string
+	TokenID           string
+	AccountID         sql.NullString
+	UserName          string
+	Mode              string
+	Model             string
+	Stream            bool
+	RequestAt         time.Time
+	ResponseAt        sql.NullTime
+	DurationMs        sql.NullInt64
+	TTFTMs            sql.NullInt64
+	PromptTokens      int
+	CompletionTokens  int
+	TotalTokens       int
+	StatusCode        int
+	Success           bool
+	ErrorMessage      sql.NullString
+	ConversationID    sql.NullString
+	ClientIP          sql.NullString
+	UserAgent         sql.NullString
+	CostUSD           sql.NullFloat64 // Set by the cost enricher
+	ClientCountry     sql.NullString  // Set by the geo enricher
+	ClientName        sql.NullString  // Set by the client enricher
+	UpstreamRequestID sql.NullString  // request-id returned by the Anthropic API
+	TraceID           sql.NullString  // W3C trace ID sent upstream, if any
+	EndUserID         sql.NullString  // Client's end user (OpenAI user / Anthropic metadata.user_id)
+	FailureCategory   sql.NullString  // Set on failures by the failure classifier
+	QueueWaitMs       sql.NullInt64   // Time spent waiting for concurrency slots
+	RequestBytes      sql.NullInt64   // Size of the request payload
+	ResponseBytes     sql.NullInt64   // Size of the upstream response body
+	ModelDefaulted    bool            // Model was filled in from the token or config default
+	Truncated         bool            // Stream was interrupted; the logged completion is partial
+	SampleWeight      float64         // Requests this row stands for under log sampling; 0 counts as 1
 }
 
+// Weight returns the number of requests the log stands for
+func (l *RequestLog) Weight() float64 {
+	if l.SampleWeight <= 0 {
+		return 1
+	}
+	return l.SampleWeight
+}
+
+// sampleWeightSQL is the number of requests a request_logs row stands for.
+// Sampled-out successes are not stored, so each kept sampled success counts
+// for 100/success_percent requests in aggregates that must reflect traffic.
+const sampleWeightSQL = `COALESCE(sample_weight, 1)`
+
 type RequestLogFilter struct {
 	TokenID   string
 	AccountID string
@@ -39,6 +67,10 @@ type RequestLogFilter struct {
 	ToDate    *time.Time
 	Page      int
 	Limit     int
+	// UpstreamRequestID finds the log of a request referenced by an Anthropic support ticket
+	UpstreamRequestID string
+	EndUserID         string
+	FailureCategory   string
 }
 
 // CreateRequestLog creates a new request log entry
@@ -47,14 +79,20 @@ func (s *Store) CreateRequestLog(log *RequestLog) error {
 		id, token_id, account_id, user_name, mode, model, stream,
 		request_at, response_at, duration_ms, ttft_ms,
 		prompt_tokens, completion_tokens, total_tokens,
-		status_code, success, error_message, conversation_id
-	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+		status_code, success, error_message, conversation_id,
+		client_ip, user_agent, cost_usd, client_country, client_name,
+		upstream_request_id, trace_id, end_user_id, queue_wait_ms,
+		request_bytes, response_bytes, model_defaulted, truncated, sample_weight
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
 
 	_, err := s.db.Exec(query,
 		log.ID, log.TokenID, log.AccountID, log.UserName, log.Mode, log.Model, log.Stream,
 		log.RequestAt, log.ResponseAt, log.DurationMs, log.TTFTMs,
 		log.PromptTokens, log.CompletionTokens, log.TotalTokens,
 		log.StatusCode, log.Success, log.ErrorMessage, log.ConversationID,
+		log.ClientIP, log.UserAgent, log.CostUSD, log.ClientCountry, log.ClientName,
+		log.UpstreamRequestID, log.TraceID, log.EndUserID, log.QueueWaitMs,
+		log.RequestBytes, log.ResponseBytes, log.ModelDefaulted, log.Truncated, log.Weight(),
 	)
 	return err
 }
@@ -65,10 +103,12 @@ func (s *Store) GetRequestLog(id string) (*RequestLog, error) {
 		id, token_id, account_id, user_name, mode, model, stream,
 		request_at, response_at, duration_ms, ttft_ms,
 		prompt_tokens, completion_tokens, total_tokens,
-		status_code, success, error_message, conversation_id
+		status_code, success, error_message, conversation_id,
+		client_ip, user_agent, cost_usd, client_country, client_name,
+		upstream_request_id, trace_id, end_user_id, failure_category, model_defaulted, truncated
 		FROM request_logs WHERE id = ?`
 
-	row := s.db.QueryRow(query, id)
+	row := s.read.QueryRow(query, id)
 
 	var log RequestLog
 	err := row.Scan(
@@ -76,6 +116,8 @@ func (s *Store) GetRequestLog(id string) (*RequestLog, error) {
 		&log.RequestAt, &log.ResponseAt, &log.DurationMs, &log.TTFTMs,
 		&log.PromptTokens, &log.CompletionTokens, &log.TotalTokens,
 		&log.StatusCode, &log.Success, &log.ErrorMessage, &log.ConversationID,
+		&log.ClientIP, &log.UserAgent, &log.CostUSD, &log.ClientCountry, &log.ClientName,
+		&log.UpstreamRequestID, &log.TraceID, &log.EndUserID, &log.FailureCategory, &log.ModelDefaulted, &log.Truncated,
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -117,6 +159,18 @@ func (s *Store) ListRequestLogs(filter RequestLogFilter) ([]*RequestLog, int, er
 		conditions = append(conditions, "success = ?")
 		args = append(args, *filter.Success)
 	}
+	if filter.UpstreamRequestID != "" {
+		conditions = append(conditions, "upstream_request_id = ?")
+		args = append(args, filter.UpstreamRequestID)
+	}
+	if filter.EndUserID != "" {
+		conditions = append(conditions, "end_user_id = ?")
+		args = append(args, filter.EndUserID)
+	}
+	if filter.FailureCategory != "" {
+		conditions = append(conditions, "failure_category = ?")
+		args = append(args, filter.FailureCategory)
+	}
 	if filter.FromDate != nil {
 		conditions = append(conditions, "request_at >= ?")
 		args = append(args, *filter.FromDate)
@@ -134,7 +188,7 @@ func (s *Store) ListRequestLogs(filter RequestLogFilter) ([]*RequestLog, int, er
 	// Get total count
 	countQuery := fmt.Sprintf("SELECT COUNT(*) FROM request_logs %s", whereClause)
 	var total int
-	err := s.db.QueryRow(countQuery, args...).Scan(&total)
+	err := s.read.QueryRow(countQuery, args...).Scan(&total)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -153,13 +207,15 @@ func (s *Store) ListRequestLogs(filter RequestLogFilter) ([]*RequestLog, int, er
 		id, token_id, account_id, user_name, mode, model, stream,
 		request_at, response_at, duration_ms, ttft_ms,
 		prompt_tokens, completion_tokens, total_tokens,
-		status_code, success, error_message, conversation_id
+		status_code, success, error_message, conversation_id,
+		client_ip, user_agent, cost_usd, client_country, client_name,
+		upstream_request_id, trace_id, end_user_id, failure_category, model_defaulted, truncated
 		FROM request_logs %s
 		ORDER BY request_at DESC
 		LIMIT ? OFFSET ?`, whereClause)
 
 	args = append(args, filter.Limit, offset)
-	rows, err := s.db.Query(query, args...)
+	rows, err := s.read.Query(query, args...)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -173,6 +229,8 @@ func (s *Store) ListRequestLogs(filter RequestLogFilter) ([]*RequestLog, int, er
 			&log.RequestAt, &log.ResponseAt, &log.DurationMs, &log.TTFTMs,
 			&log.PromptTokens, &log.CompletionTokens, &log.TotalTokens,
 			&log.StatusCode, &log.Success, &log.ErrorMessage, &log.ConversationID,
+			&log.ClientIP, &log.UserAgent, &log.CostUSD, &log.ClientCountry, &log.ClientName,
+			&log.UpstreamRequestID, &log.TraceID, &log.EndUserID, &log.FailureCategory, &log.ModelDefaulted, &log.Truncated,
 		)
 		if err != nil {
 			return nil, 0, err
@@ -183,6 +241,26 @@ func (s *Store) ListRequestLogs(filter RequestLogFilter) ([]*RequestLog, int, er
 	return logs, total, rows.Err()
 }
 
+// RequestSummary holds request counts over a time window
+type RequestSummary struct {
+	TotalRequests  int `json:"total_requests"`
+	FailedRequests int `json:"failed_requests"`
+}
+
+// GetRequestSummary counts requests and failures since the given time,
+// including successes left out by log sampling
+func (s *Store) GetRequestSummary(since time.Time) (*RequestSummary, error) {
+	query := `SELECT CAST(ROUND(COALESCE(SUM(` + sampleWeightSQL + `), 0)) AS INTEGER),
+		CAST(ROUND(COALESCE(SUM(CASE WHEN success = 0 THEN ` + sampleWeightSQL + ` ELSE 0 END), 0)) AS INTEGER)
+		FROM request_logs WHERE request_at >= ?`
+
+	var summary RequestSummary
+	if err := s.read.QueryRow(query, since).Scan(&summary.TotalRequests, &summary.FailedRequests); err != nil {
+		return nil, err
+	}
+	return &summary, nil
+}
+
 // DeleteOldRequestLogs deletes request logs older than the specified number of days
 func (s *Store) DeleteOldRequestLogs(daysToKeep int) (int64, error) {
 	query := `DELETE FROM request_logs WHERE request_at < datetime('now', '-' || ? || ' days')`
@@ -192,3 +270,45 @@ func (s *Store) DeleteOldRequestLogs(daysToKeep int) (int64, error) {
 	}
 	return result.RowsAffected()
 }
+
+// EndUserStats is the usage of one of a client's end users
+type EndUserStats struct {
+	EndUserID   string  `json:"end_user_id"`
+	TokenID     string  `json:"token_id"`
+	Requests    int     `json:"requests"`
+	Errors      int     `json:"errors"`
+	TotalTokens int     `json:"total_tokens"`
+	CostUSD     float64 `json:"cost_usd"`
+}
+
+// ListEndUserStats aggregates request logs by token and end user since from,
+// busiest end users first. tokenID limits the result to one token.
+func (s *Store) ListEndUserStats(tokenID string, from time.Time, limit int) ([]*EndUserStats, error) {
+	query := `SELECT end_user_id, token_id, COUNT(*), SUM(CASE WHEN success THEN 0 ELSE 1 END),
+		COALESCE(SUM(total_tokens), 0), COALESCE(SUM(cost_usd), 0)
+		FROM request_logs
+		WHERE end_user_id IS NOT NULL AND end_user_id != '' AND request_at >= ?`
+	args := []interface{}{from}
+	if tokenID != "" {
+		query += ` AND token_id = ?`
+		args = append(args, tokenID)
+	}
+	query += ` GROUP BY token_id, end_user_id ORDER BY COUNT(*) DESC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := s.read.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stats []*EndUserStats
+	for rows.Next() {
+		var st EndUserStats
+		if err := rows.Scan(&st.EndUserID, &st.TokenID, &st.Requests, &st.Errors, &st.TotalTokens, &st.CostUSD); err != nil {
+			return nil, err
+		}
+		stats = append(stats, &st)
+	}
+	return stats, rows.Err()
+}
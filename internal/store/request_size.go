@@ -0,0 +1,49 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+)
+
+// RequestSize is the payload size of one logged request, without content
+type RequestSize struct {
+	TokenID          string
+	UserName         string
+	RequestAt        time.Time
+	PromptTokens     int64
+	CompletionTokens int64
+	RequestBytes     sql.NullInt64 // NULL for requests logged before sizes were recorded
+	ResponseBytes    sql.NullInt64
+}
+
+// ListRequestSizes returns the sizes of requests started in [since, until),
+// oldest first. An empty tokenID returns the requests of every token.
+func (s *Store) ListRequestSizes(tokenID string, since, until time.Time) ([]*RequestSize, error) {
+	query := `SELECT token_id, COALESCE(user_name, ''), request_at,
+		COALESCE(prompt_tokens, 0), COALESCE(completion_tokens, 0), request_bytes, response_bytes
+		FROM request_logs
+		WHERE request_at >= ? AND request_at < ?`
+	args := []interface{}{since, until}
+	if tokenID != "" {
+		query += ` AND token_id = ?`
+		args = append(args, tokenID)
+	}
+	query += ` ORDER BY request_at`
+
+	rows, err := s.read.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sizes []*RequestSize
+	for rows.Next() {
+		var r RequestSize
+		if err := rows.Scan(&r.TokenID, &r.UserName, &r.RequestAt, &r.PromptTokens, &r.CompletionTokens,
+			&r.RequestBytes, &r.ResponseBytes); err != nil {
+			return nil, err
+		}
+		sizes = append(sizes, &r)
+	}
+	return sizes, rows.Err()
+}
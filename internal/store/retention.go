@@ -0,0 +1,181 @@
+package store
+
+import (
+	"strings"
+	"time"
+)
+
+// PurgeCounts reports the rows removed by a data purge
+type PurgeCounts struct {
+	Conversations int64 `json:"conversations"`
+	SearchRows    int64 `json:"search_rows"`
+	RequestLogs   int64 `json:"request_logs"`
+	UsageStats    int64 `json:"usage_stats"`
+	MirrorResults int64 `json:"mirror_results"`
+}
+
+// Total returns the number of rows removed
+func (c *PurgeCounts) Total() int64 {
+	return c.Conversations + c.SearchRows + c.RequestLogs + c.UsageStats + c.MirrorResults
+}
+
+// UpdateTokenRetentionDays sets how long a token's conversation contents are kept (0 = no limit)
+func (s *Store) UpdateTokenRetentionDays(id string, days int) error {
+	_, err := s.db.Exec(`UPDATE tokens SET conversation_retention_days = ? WHERE id = ?`, days, id)
+	return err
+}
+
+// ListTokenIDsByUserName returns the IDs of all tokens issued to a user, including revoked ones
+func (s *Store) ListTokenIDsByUserName(userName string) ([]string, error) {
+	rows, err := s.db.Query(`SELECT id FROM tokens WHERE user_name = ?`, userName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// PurgeTokenData deletes everything recorded for the given tokens in one
+// transaction: conversation contents and their search rows, request logs,
+// daily usage stats and mirror results. Request logs carrying userName are
+// removed as well, even if their token no longer exists. Tokens themselves
+// are kept.
+func (s *Store) PurgeTokenData(tokenIDs []string, userName string) (*PurgeCounts, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	counts := &PurgeCounts{}
+	exec := func(dst *int64, query string, args ...interface{}) error {
+		result, err := tx.Exec(query, args...)
+		if err != nil {
+			return err
+		}
+		n, _ := result.RowsAffected()
+		*dst += n
+		return nil
+	}
+
+	if len(tokenIDs) > 0 {
+		in, args := inClause(tokenIDs)
+
+		// Search rows first: they are looked up through the content table
+		if s.hasSearchIndex() {
+			if err := exec(&counts.SearchRows, `DELETE FROM conversation_search WHERE id IN (SELECT id FROM conversation_contents WHERE token_id IN `+in+`)`, args...); err != nil {
+				return nil, err
+			}
+		}
+		if err := exec(&counts.Conversations, `DELETE FROM conversation_contents WHERE token_id IN `+in, args...); err != nil {
+			return nil, err
+		}
+		if err := exec(&counts.RequestLogs, `DELETE FROM request_logs WHERE token_id IN `+in, args...); err != nil {
+			return nil, err
+		}
+		if err := exec(&counts.UsageStats, `DELETE FROM usage_stats_daily WHERE token_id IN `+in, args...); err != nil {
+			return nil, err
+		}
+		if err := exec(&counts.MirrorResults, `DELETE FROM mirror_results WHERE token_id IN `+in, args...); err != nil {
+			return nil, err
+		}
+	}
+
+	if userName != "" {
+		if err := exec(&counts.RequestLogs, `DELETE FROM request_logs WHERE user_name = ?`, userName); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+// DeleteExpiredTokenConversations enforces per-token retention: conversation
+// contents older than their token's retention period are deleted. It returns
+// the number of conversations removed per token.
+func (s *Store) DeleteExpiredTokenConversations(now time.Time) (map[string]int64, error) {
+	rows, err := s.db.Query(`SELECT id, conversation_retention_days FROM tokens WHERE conversation_retention_days > 0`)
+	if err != nil {
+		return nil, err
+	}
+	policies := make(map[string]int)
+	for rows.Next() {
+		var id string
+		var days int
+		if err := rows.Scan(&id, &days); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		policies[id] = days
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	deleted := make(map[string]int64)
+	for tokenID, days := range policies {
+		cutoff := now.AddDate(0, 0, -days)
+		n, err := s.deleteTokenConversationsBefore(tokenID, cutoff)
+		if err != nil {
+			return deleted, err
+		}
+		if n > 0 {
+			deleted[tokenID] = n
+		}
+	}
+	return deleted, nil
+}
+
+func (s *Store) deleteTokenConversationsBefore(tokenID string, cutoff time.Time) (int64, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if s.hasSearchIndex() {
+		if _, err := tx.Exec(`DELETE FROM conversation_search WHERE id IN (SELECT id FROM conversation_contents WHERE token_id = ? AND created_at < ?)`, tokenID, cutoff); err != nil {
+			return 0, err
+		}
+	}
+	result, err := tx.Exec(`DELETE FROM conversation_contents WHERE token_id = ? AND created_at < ?`, tokenID, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	n, _ := result.RowsAffected()
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// hasSearchIndex reports whether the FTS5 search table exists; it is missing
+// when SQLite was built without FTS5
+func (s *Store) hasSearchIndex() bool {
+	var n int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE name = 'conversation_search'`).Scan(&n)
+	return err == nil && n > 0
+}
+
+// inClause builds "(?, ?, ...)" and its arguments for a list of values
+func inClause(values []string) (string, []interface{}) {
+	args := make([]interface{}, len(values))
+	for i, v := range values {
+		args[i] = v
+	}
+	return "(" + strings.TrimSuffix(strings.Repeat("?, ", len(values)), ", ") + ")", args
+}
@@ -0,0 +1,54 @@
+package store
+
+import "time"
+
+// SLOCounts aggregates one token's requests against the service level
+// objectives over a window
+type SLOCounts struct {
+	TokenID  string
+	UserName string
+	Requests int64
+	Errors   int64 // Failed with a server-side error, see sloErrorSQL
+	Slow     int64 // Successful requests slower than the latency target
+}
+
+// sloErrorSQL matches requests that count against availability: upstream and
+// proxy errors, rate limiting, and requests that never got a response.
+// Other client errors such as invalid requests or bad tokens do not.
+const sloErrorSQL = `success = 0 AND (status_code >= 500 OR status_code = 429 OR status_code = 0)`
+
+// sloLatencySQL is the latency judged against the latency target: time to
+// first token for streams, which keep the connection open while generating,
+// and total duration otherwise
+const sloLatencySQL = `COALESCE(CASE WHEN stream THEN ttft_ms END, duration_ms)`
+
+// GetSLOCounts returns per-token request counts for requests started in
+// [since, until). Successful requests slower than latencyMs count as slow;
+// latencyMs <= 0 counts none. Successes left out by log sampling are counted
+// through sampleWeightSQL.
+func (s *Store) GetSLOCounts(since, until time.Time, latencyMs int64) ([]*SLOCounts, error) {
+	query := `SELECT token_id, COALESCE(MAX(user_name), ''),
+		CAST(ROUND(SUM(` + sampleWeightSQL + `)) AS INTEGER),
+		CAST(ROUND(COALESCE(SUM(CASE WHEN ` + sloErrorSQL + ` THEN ` + sampleWeightSQL + ` ELSE 0 END), 0)) AS INTEGER),
+		CAST(ROUND(COALESCE(SUM(CASE WHEN ? > 0 AND success = 1 AND ` + sloLatencySQL + ` > ? THEN ` + sampleWeightSQL + ` ELSE 0 END), 0)) AS INTEGER)
+		FROM request_logs
+		WHERE request_at >= ? AND request_at < ?
+		GROUP BY token_id
+		ORDER BY token_id`
+
+	rows, err := s.read.Query(query, latencyMs, latencyMs, since, until)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var counts []*SLOCounts
+	for rows.Next() {
+		var c SLOCounts
+		if err := rows.Scan(&c.TokenID, &c.UserName, &c.Requests, &c.Errors, &c.Slow); err != nil {
+			return nil, err
+		}
+		counts = append(counts, &c)
+	}
+	return counts, rows.Err()
+}
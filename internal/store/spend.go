@@ -0,0 +1,136 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+)
+
+// APIKeyAccountInfo holds workspace metadata and the spend budget of an api_key account
+type APIKeyAccountInfo struct {
+	AccountID         string     `json:"account_id"`
+	WorkspaceID       string     `json:"workspace_id,omitempty"`
+	WorkspaceName     string     `json:"workspace_name,omitempty"`
+	KeyName           string     `json:"key_name,omitempty"` // Key name in the Anthropic console
+	MonthlyBudgetUSD  float64    `json:"monthly_budget_usd"` // 0 means unlimited
+	MetadataFetchedAt *time.Time `json:"metadata_fetched_at,omitempty"`
+}
+
+// AccountSpend is the estimated spend of an account in one calendar month
+type AccountSpend struct {
+	AccountID    string    `json:"account_id"`
+	Month        string    `json:"month"` // YYYY-MM (UTC)
+	SpendUSD     float64   `json:"spend_usd"`
+	InputTokens  int64     `json:"input_tokens"`
+	OutputTokens int64     `json:"output_tokens"`
+	Requests     int64     `json:"requests"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// SpendMonth returns the spend bucket (YYYY-MM, UTC) for a time
+func SpendMonth(t time.Time) string {
+	return t.UTC().Format("2006-01")
+}
+
+// UpsertAPIKeyAccountInfo creates or replaces the metadata of an api_key account
+func (s *Store) UpsertAPIKeyAccountInfo(info *APIKeyAccountInfo) error {
+	_, err := s.db.Exec(`INSERT INTO api_key_accounts (account_id, workspace_id, workspace_name, key_name, monthly_budget_usd, metadata_fetched_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(account_id) DO UPDATE SET
+			workspace_id = excluded.workspace_id,
+			workspace_name = excluded.workspace_name,
+			key_name = excluded.key_name,
+			monthly_budget_usd = excluded.monthly_budget_usd,
+			metadata_fetched_at = excluded.metadata_fetched_at`,
+		info.AccountID, info.WorkspaceID, info.WorkspaceName, info.KeyName,
+		info.MonthlyBudgetUSD, info.MetadataFetchedAt)
+	return err
+}
+
+// GetAPIKeyAccountInfo returns the metadata of an api_key account, or nil if none is stored
+func (s *Store) GetAPIKeyAccountInfo(accountID string) (*APIKeyAccountInfo, error) {
+	var info APIKeyAccountInfo
+	err := s.db.QueryRow(`SELECT account_id, COALESCE(workspace_id, ''), COALESCE(workspace_name, ''), COALESCE(key_name, ''),
+			COALESCE(monthly_budget_usd, 0), metadata_fetched_at
+		FROM api_key_accounts WHERE account_id = ?`, accountID).Scan(
+		&info.AccountID, &info.WorkspaceID, &info.WorkspaceName, &info.KeyName,
+		&info.MonthlyBudgetUSD, &info.MetadataFetchedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// SetAccountMonthlyBudget sets the monthly spend budget of an api_key account (0 = unlimited)
+func (s *Store) SetAccountMonthlyBudget(accountID string, budgetUSD float64) error {
+	_, err := s.db.Exec(`INSERT INTO api_key_accounts (account_id, monthly_budget_usd)
+		VALUES (?, ?)
+		ON CONFLICT(account_id) DO UPDATE SET monthly_budget_usd = excluded.monthly_budget_usd`,
+		accountID, budgetUSD)
+	return err
+}
+
+// AddAccountSpend adds a request's estimated cost to the account's monthly
+// total and returns the updated total
+func (s *Store) AddAccountSpend(accountID, month string, costUSD float64, inputTokens, outputTokens int) (*AccountSpend, error) {
+	now := time.Now()
+	_, err := s.db.Exec(`INSERT INTO account_spend_monthly (account_id, month, spend_usd, input_tokens, output_tokens, requests, updated_at)
+		VALUES (?, ?, ?, ?, ?, 1, ?)
+		ON CONFLICT(account_id, month) DO UPDATE SET
+			spend_usd = spend_usd + excluded.spend_usd,
+			input_tokens = input_tokens + excluded.input_tokens,
+			output_tokens = output_tokens + excluded.output_tokens,
+			requests = requests + 1,
+			updated_at = excluded.updated_at`,
+		accountID, month, costUSD, inputTokens, outputTokens, now)
+	if err != nil {
+		return nil, err
+	}
+
+	spend, err := s.GetAccountSpend(accountID, month)
+	if err != nil {
+		return nil, err
+	}
+	if spend == nil {
+		return &AccountSpend{AccountID: accountID, Month: month}, nil
+	}
+	return spend, nil
+}
+
+// GetAccountSpend returns an account's spend for a month, or nil if nothing was recorded
+func (s *Store) GetAccountSpend(accountID, month string) (*AccountSpend, error) {
+	var spend AccountSpend
+	err := s.db.QueryRow(`SELECT account_id, month, spend_usd, input_tokens, output_tokens, requests, updated_at
+		FROM account_spend_monthly WHERE account_id = ? AND month = ?`, accountID, month).Scan(
+		&spend.AccountID, &spend.Month, &spend.SpendUSD, &spend.InputTokens, &spend.OutputTokens, &spend.Requests, &spend.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &spend, nil
+}
+
+// ListAccountSpendHistory returns an account's monthly spend, newest month first
+func (s *Store) ListAccountSpendHistory(accountID string, months int) ([]*AccountSpend, error) {
+	rows, err := s.read.Query(`SELECT account_id, month, spend_usd, input_tokens, output_tokens, requests, updated_at
+		FROM account_spend_monthly WHERE account_id = ?
+		ORDER BY month DESC LIMIT ?`, accountID, months)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var history []*AccountSpend
+	for rows.Next() {
+		var spend AccountSpend
+		if err := rows.Scan(&spend.AccountID, &spend.Month, &spend.SpendUSD, &spend.InputTokens, &spend.OutputTokens, &spend.Requests, &spend.UpdatedAt); err != nil {
+			return nil, err
+		}
+		history = append(history, &spend)
+	}
+	return history, rows.Err()
+}
@@ -8,7 +8,11 @@ import (
 )
 
 type Store struct {
-	db *sql.DB
+	db   *sql.DB
+	path string
+	// read serves stats, log and conversation queries; it is db unless a
+	// read pool is enabled
+	read *sql.DB
 }
 
 type Token struct {
@@ -22,6 +26,21 @@ type Token struct {
 	EnableConversationLogging  bool       `json:"enable_conversation_logging"`
 	TotalRequests              int        `json:"total_requests"`
 	TotalTokensUsed            int        `json:"total_tokens_used"`
+	MaxRequestSeconds          int        `json:"max_request_seconds"` // End-to-end request budget, 0 = unlimited
+	ConversationRetentionDays  int        `json:"conversation_retention_days"` // Conversation contents older than this are deleted, 0 = no limit
+	ResponseFooter             string     `json:"response_footer,omitempty"`   // Text appended to successful responses, "" = disabled
+	AllowFlagOverrides         bool       `json:"allow_flag_overrides"`        // Honor X-CCProxy-Flags feature flag overrides
+	IsIssuer                   bool       `json:"is_issuer"`                   // May mint and revoke child tokens
+	ParentID                   string     `json:"parent_id,omitempty"`         // Issuer token that minted this one, "" = issued by an admin
+	ClientCertIdentity         string     `json:"client_cert_identity,omitempty"` // Client certificate CN or SAN authenticating as this token, "" = none
+	Priority                   string     `json:"priority,omitempty"`             // Load shedding priority: "low", "normal" or "critical", "" = normal
+	DefaultModel               string     `json:"default_model,omitempty"`        // Model used when a request names none, "" = claude.default_model
+	RateLimitBypass            string     `json:"rate_limit_bypass,omitempty"`    // Comma-separated rate limit classes the token is exempt from ("ip", "global")
+	AllowedEndpoints           string     `json:"allowed_endpoints,omitempty"`    // Comma-separated endpoint groups the token may call, "" = all
+	StreamFlushMs              int        `json:"stream_flush_ms"`                // Coalesce stream chunks for this long, 0 = server.sse.flush_interval
+	StreamFlushBytes           int        `json:"stream_flush_bytes"`             // Flush coalesced chunks at this many bytes, 0 = server.sse.write_buffer_size
+	OutputFilters              string     `json:"output_filters,omitempty"`       // Comma-separated filters applied to responses, "" = none
+	ExternalSubject            string     `json:"external_subject,omitempty"`     // "<issuer name>:<sub>" of external JWTs authenticating as this token, "" = none
 }
 
 type Session struct {
@@ -42,7 +61,7 @@ func New(dbPath string) (*Store, error) {
 		return nil, err
 	}
 
-	store := &Store{db: db}
+	store := &Store{db: db, path: dbPath, read: db}
 	if err := store.migrate(); err != nil {
 		db.Close()
 		return nil, err
@@ -179,6 +198,275 @@ func (s *Store) migrate() error {
 	_ = s.addColumnIfNotExists("tokens", "enable_conversation_logging", "BOOLEAN DEFAULT 0")
 	_ = s.addColumnIfNotExists("tokens", "total_requests", "INTEGER DEFAULT 0")
 	_ = s.addColumnIfNotExists("tokens", "total_tokens_used", "INTEGER DEFAULT 0")
+	_ = s.addColumnIfNotExists("tokens", "max_request_seconds", "INTEGER DEFAULT 0")
+	_ = s.addColumnIfNotExists("tokens", "conversation_retention_days", "INTEGER DEFAULT 0")
+	_ = s.addColumnIfNotExists("tokens", "response_footer", "TEXT")
+	_ = s.addColumnIfNotExists("tokens", "allow_flag_overrides", "BOOLEAN DEFAULT 0")
+	_ = s.addColumnIfNotExists("tokens", "is_issuer", "BOOLEAN DEFAULT 0")
+	_ = s.addColumnIfNotExists("tokens", "parent_id", "TEXT")
+	_, _ = s.db.Exec(`CREATE INDEX IF NOT EXISTS idx_tokens_parent ON tokens(parent_id)`)
+	_ = s.addColumnIfNotExists("tokens", "client_cert_identity", "TEXT")
+	_ = s.addColumnIfNotExists("tokens", "priority", "TEXT")
+	_ = s.addColumnIfNotExists("tokens", "default_model", "TEXT")
+	_ = s.addColumnIfNotExists("tokens", "rate_limit_bypass", "TEXT")
+	_ = s.addColumnIfNotExists("tokens", "allowed_endpoints", "TEXT")
+	_ = s.addColumnIfNotExists("tokens", "stream_flush_ms", "INTEGER DEFAULT 0")
+	_ = s.addColumnIfNotExists("tokens", "stream_flush_bytes", "INTEGER DEFAULT 0")
+	_ = s.addColumnIfNotExists("tokens", "output_filters", "TEXT")
+	_ = s.addColumnIfNotExists("tokens", "external_subject", "TEXT")
+	_, _ = s.db.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_tokens_client_cert ON tokens(client_cert_identity) WHERE client_cert_identity IS NOT NULL AND client_cert_identity != ''`)
+	_, _ = s.db.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_tokens_external_subject ON tokens(external_subject) WHERE external_subject IS NOT NULL AND external_subject != ''`)
+
+	// Latency histograms of daily usage stats, for percentiles
+	_ = s.addColumnIfNotExists("usage_stats_daily", "duration_histogram", "TEXT")
+	_ = s.addColumnIfNotExists("usage_stats_daily", "ttft_histogram", "TEXT")
+
+	// Add enrichment columns to request_logs table
+	_ = s.addColumnIfNotExists("request_logs", "client_ip", "TEXT")
+	_ = s.addColumnIfNotExists("request_logs", "user_agent", "TEXT")
+	_ = s.addColumnIfNotExists("request_logs", "cost_usd", "REAL")
+	_ = s.addColumnIfNotExists("request_logs", "client_country", "TEXT")
+	_ = s.addColumnIfNotExists("request_logs", "client_name", "TEXT")
+
+	// Add upstream tracing columns to request_logs table
+	_ = s.addColumnIfNotExists("request_logs", "upstream_request_id", "TEXT")
+	_ = s.addColumnIfNotExists("request_logs", "trace_id", "TEXT")
+	_, _ = s.db.Exec(`CREATE INDEX IF NOT EXISTS idx_request_logs_upstream_request_id ON request_logs(upstream_request_id)`)
+	_ = s.addColumnIfNotExists("request_logs", "end_user_id", "TEXT")
+	_ = s.addColumnIfNotExists("request_logs", "model_defaulted", "BOOLEAN DEFAULT 0")
+	_, _ = s.db.Exec(`CREATE INDEX IF NOT EXISTS idx_request_logs_end_user_id ON request_logs(token_id, end_user_id)`)
+	_ = s.addColumnIfNotExists("request_logs", "failure_category", "TEXT")
+	_, _ = s.db.Exec(`CREATE INDEX IF NOT EXISTS idx_request_logs_failure_category ON request_logs(success, failure_category, request_at)`)
+	_ = s.addColumnIfNotExists("request_logs", "queue_wait_ms", "INTEGER")
+	// Payload sizes for per-token size distributions
+	_ = s.addColumnIfNotExists("request_logs", "request_bytes", "INTEGER")
+	_ = s.addColumnIfNotExists("request_logs", "response_bytes", "INTEGER")
+	// Streams interrupted midway, logged with their partial completion
+	_ = s.addColumnIfNotExists("request_logs", "truncated", "BOOLEAN DEFAULT 0")
+	// Requests each row stands for when successes are sampled
+	_ = s.addColumnIfNotExists("request_logs", "sample_weight", "REAL DEFAULT 1")
+
+	// Compression algorithm and uncompressed size of compressed conversations
+	_ = s.addColumnIfNotExists("conversation_contents", "compression", "TEXT")
+	_ = s.addColumnIfNotExists("conversation_contents", "original_size", "INTEGER")
+	_ = s.addColumnIfNotExists("conversation_contents", "title", "TEXT NOT NULL DEFAULT ''")
+	_ = s.addColumnIfNotExists("conversation_contents", "truncated_bytes", "INTEGER NOT NULL DEFAULT 0")
+	// Operator curation: JSON array of tags and a starred flag
+	_ = s.addColumnIfNotExists("conversation_contents", "tags", "TEXT NOT NULL DEFAULT '[]'")
+	_ = s.addColumnIfNotExists("conversation_contents", "starred", "BOOLEAN NOT NULL DEFAULT 0")
+	_ = s.addColumnIfNotExists("conversation_contents", "truncated", "BOOLEAN NOT NULL DEFAULT 0")
+	_, _ = s.db.Exec(`CREATE INDEX IF NOT EXISTS idx_conversation_starred ON conversation_contents(starred, created_at DESC)`)
+
+	// Per-account scheduling windows (JSON AccountSchedule)
+	_ = s.addColumnIfNotExists("accounts", "schedule_windows", "TEXT")
+
+	// claude.ai project of web mode accounts (JSON WebProject)
+	_ = s.addColumnIfNotExists("accounts", "web_project", "TEXT")
+
+	// Egress path of upstream connections (JSON AccountNetwork)
+	_ = s.addColumnIfNotExists("accounts", "network", "TEXT")
+
+	// Add health score column to accounts table and its history table
+	_ = s.addColumnIfNotExists("accounts", "health_score", "INTEGER DEFAULT 100")
+	_, _ = s.db.Exec(`CREATE TABLE IF NOT EXISTS account_health_history (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		account_id TEXT NOT NULL,
+		score INTEGER NOT NULL,
+		recorded_at DATETIME NOT NULL,
+		FOREIGN KEY (account_id) REFERENCES accounts(id) ON DELETE CASCADE
+	)`)
+	_, _ = s.db.Exec(`CREATE INDEX IF NOT EXISTS idx_account_health_history ON account_health_history(account_id, recorded_at)`)
+
+	// Results of individual account health checks
+	_, _ = s.db.Exec(`CREATE TABLE IF NOT EXISTS account_health_checks (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		account_id TEXT NOT NULL,
+		healthy BOOLEAN NOT NULL,
+		latency_ms INTEGER NOT NULL DEFAULT 0,
+		error TEXT,
+		source TEXT NOT NULL DEFAULT 'monitor',
+		checked_at DATETIME NOT NULL
+	)`)
+	_, _ = s.db.Exec(`CREATE INDEX IF NOT EXISTS idx_account_health_checks ON account_health_checks(account_id, checked_at)`)
+
+	// SSO admin sessions, so they can be revoked on logout
+	_, _ = s.db.Exec(`CREATE TABLE IF NOT EXISTS admin_sessions (
+		id TEXT PRIMARY KEY,
+		subject TEXT NOT NULL,
+		created_at DATETIME NOT NULL,
+		expires_at DATETIME NOT NULL,
+		revoked_at DATETIME
+	)`)
+
+	// Per-model overload cooldowns (e.g. Opus overloaded while Haiku still serves)
+	_, _ = s.db.Exec(`CREATE TABLE IF NOT EXISTS account_model_overloads (
+		account_id TEXT NOT NULL,
+		model TEXT NOT NULL,
+		overload_until DATETIME NOT NULL,
+		reason TEXT,
+		overload_count INTEGER DEFAULT 1,
+		updated_at DATETIME NOT NULL,
+		PRIMARY KEY (account_id, model),
+		FOREIGN KEY (account_id) REFERENCES accounts(id) ON DELETE CASCADE
+	)`)
+
+	// Accounts being drained: they keep serving sticky sessions until drain_until,
+	// then get deactivated
+	_, _ = s.db.Exec(`CREATE TABLE IF NOT EXISTS account_drains (
+		account_id TEXT PRIMARY KEY,
+		started_at DATETIME NOT NULL,
+		drain_until DATETIME NOT NULL,
+		FOREIGN KEY (account_id) REFERENCES accounts(id) ON DELETE CASCADE
+	)`)
+
+	// Passphrase-sealed account notes (recovery codes), separate from credentials
+	_, _ = s.db.Exec(`CREATE TABLE IF NOT EXISTS account_secure_notes (
+		account_id TEXT PRIMARY KEY,
+		ciphertext TEXT NOT NULL,
+		created_at DATETIME NOT NULL,
+		updated_at DATETIME NOT NULL,
+		FOREIGN KEY (account_id) REFERENCES accounts(id) ON DELETE CASCADE
+	)`)
+
+	// When accounts' subscription rate windows reset, in their own time zones
+	_, _ = s.db.Exec(`CREATE TABLE IF NOT EXISTS account_reset_schedules (
+		account_id TEXT PRIMARY KEY,
+		schedule TEXT NOT NULL,
+		updated_at DATETIME NOT NULL,
+		FOREIGN KEY (account_id) REFERENCES accounts(id) ON DELETE CASCADE
+	)`)
+
+	// Workspace metadata and monthly spend of api_key accounts
+	_, _ = s.db.Exec(`CREATE TABLE IF NOT EXISTS api_key_accounts (
+		account_id TEXT PRIMARY KEY,
+		workspace_id TEXT,
+		workspace_name TEXT,
+		key_name TEXT,
+		monthly_budget_usd REAL DEFAULT 0,
+		metadata_fetched_at DATETIME,
+		FOREIGN KEY (account_id) REFERENCES accounts(id) ON DELETE CASCADE
+	)`)
+	_, _ = s.db.Exec(`CREATE TABLE IF NOT EXISTS account_spend_monthly (
+		account_id TEXT NOT NULL,
+		month TEXT NOT NULL,
+		spend_usd REAL DEFAULT 0,
+		input_tokens INTEGER DEFAULT 0,
+		output_tokens INTEGER DEFAULT 0,
+		requests INTEGER DEFAULT 0,
+		updated_at DATETIME NOT NULL,
+		PRIMARY KEY (account_id, month),
+		FOREIGN KEY (account_id) REFERENCES accounts(id) ON DELETE CASCADE
+	)`)
+
+	// Append-only audit log (e.g. data deletion receipts)
+	_, _ = s.db.Exec(`CREATE TABLE IF NOT EXISTS audit_log (
+		id TEXT PRIMARY KEY,
+		created_at DATETIME NOT NULL,
+		action TEXT NOT NULL,
+		actor TEXT NOT NULL,
+		subject TEXT,
+		details TEXT
+	)`)
+	_, _ = s.db.Exec(`CREATE INDEX IF NOT EXISTS idx_audit_log_action ON audit_log(action, created_at)`)
+
+	// Per-account overrides of the global trace sampling rate
+	_, _ = s.db.Exec(`CREATE TABLE IF NOT EXISTS account_trace_sampling (
+		account_id TEXT PRIMARY KEY,
+		sample_percent REAL NOT NULL,
+		FOREIGN KEY (account_id) REFERENCES accounts(id) ON DELETE CASCADE
+	)`)
+
+	// Account groups and labels, and templates of default account settings
+	_ = s.addColumnIfNotExists("accounts", "group_names", "TEXT")
+	_ = s.addColumnIfNotExists("accounts", "labels", "TEXT")
+	_, _ = s.db.Exec(`CREATE TABLE IF NOT EXISTS account_templates (
+		id TEXT PRIMARY KEY,
+		name TEXT NOT NULL UNIQUE,
+		description TEXT,
+		priority INTEGER DEFAULT 0,
+		max_concurrency INTEGER DEFAULT 5,
+		group_names TEXT,
+		labels TEXT,
+		created_at DATETIME NOT NULL,
+		updated_at DATETIME NOT NULL
+	)`)
+
+	// Mirrored requests sent to a secondary upstream for offline comparison
+	_, _ = s.db.Exec(`CREATE TABLE IF NOT EXISTS mirror_results (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		created_at DATETIME NOT NULL,
+		path TEXT NOT NULL,
+		token_id TEXT,
+		request_body TEXT,
+		primary_model TEXT,
+		primary_status INTEGER,
+		primary_latency_ms INTEGER,
+		primary_response TEXT,
+		mirror_model TEXT,
+		mirror_status INTEGER,
+		mirror_latency_ms INTEGER,
+		mirror_response TEXT,
+		mirror_error TEXT
+	)`)
+	_, _ = s.db.Exec(`CREATE INDEX IF NOT EXISTS idx_mirror_results_created ON mirror_results(created_at)`)
+
+	// Usage anomalies flagged by the anomaly detector
+	_, _ = s.db.Exec(`CREATE TABLE IF NOT EXISTS account_anomalies (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		account_id TEXT NOT NULL,
+		kind TEXT NOT NULL,
+		severity TEXT NOT NULL,
+		message TEXT NOT NULL,
+		value REAL NOT NULL,
+		baseline REAL NOT NULL,
+		detected_at DATETIME NOT NULL,
+		FOREIGN KEY (account_id) REFERENCES accounts(id) ON DELETE CASCADE
+	)`)
+	_, _ = s.db.Exec(`CREATE INDEX IF NOT EXISTS idx_account_anomalies ON account_anomalies(account_id, kind, detected_at)`)
+	_, _ = s.db.Exec(`CREATE INDEX IF NOT EXISTS idx_account_anomalies_detected ON account_anomalies(detected_at)`)
+
+	// JWT signing keys added through the admin API; configured secrets are not stored
+	_, _ = s.db.Exec(`CREATE TABLE IF NOT EXISTS jwt_keys (
+		id TEXT PRIMARY KEY,
+		secret TEXT NOT NULL,
+		active INTEGER DEFAULT 0,
+		created_at DATETIME NOT NULL
+	)`)
+
+	// Background jobs run by internal/jobs
+	_, _ = s.db.Exec(`CREATE TABLE IF NOT EXISTS jobs (
+		id TEXT PRIMARY KEY,
+		type TEXT NOT NULL,
+		status TEXT NOT NULL,
+		payload TEXT NOT NULL DEFAULT '{}',
+		result TEXT,
+		error TEXT,
+		progress INTEGER NOT NULL DEFAULT 0,
+		message TEXT,
+		steps TEXT NOT NULL DEFAULT '[]',
+		attempts INTEGER NOT NULL DEFAULT 0,
+		max_attempts INTEGER NOT NULL DEFAULT 1,
+		run_at DATETIME NOT NULL,
+		created_at DATETIME NOT NULL,
+		updated_at DATETIME NOT NULL,
+		started_at DATETIME,
+		finished_at DATETIME
+	)`)
+	_, _ = s.db.Exec(`CREATE INDEX IF NOT EXISTS idx_jobs_status_run_at ON jobs(status, run_at)`)
+	_, _ = s.db.Exec(`CREATE INDEX IF NOT EXISTS idx_jobs_type_created ON jobs(type, created_at)`)
+	// Payloads of jobs finished before they were cleared on completion
+	_, _ = s.db.Exec(`UPDATE jobs SET payload = '{}' WHERE status IN ('succeeded', 'failed', 'canceled') AND payload != '{}'`)
+
+	// claude.ai conversations created by the proxy, deleted after their retention
+	_, _ = s.db.Exec(`CREATE TABLE IF NOT EXISTS web_conversations (
+		id TEXT PRIMARY KEY,
+		account_id TEXT NOT NULL,
+		organization_id TEXT NOT NULL,
+		created_at DATETIME NOT NULL,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		last_error TEXT
+	)`)
+	_, _ = s.db.Exec(`CREATE INDEX IF NOT EXISTS idx_web_conversations_created ON web_conversations(created_at)`)
 
 	// Create FTS5 virtual table for conversation search
 	_, _ = s.db.Exec(`CREATE VIRTUAL TABLE IF NOT EXISTS conversation_search USING fts5(
@@ -272,8 +560,8 @@ func (s *Store) migrateSessionsToAccounts() error {
 // Token operations
 
 func (s *Store) CreateToken(token *Token) error {
-	query := `INSERT INTO tokens (id, user_name, mode, created_at, expires_at) VALUES (?, ?, ?, ?, ?)`
-	_, err := s.db.Exec(query, token.ID, token.UserName, token.Mode, token.CreatedAt, token.ExpiresAt)
+	query := `INSERT INTO tokens (id, user_name, mode, created_at, expires_at, enable_conversation_logging, max_request_seconds, conversation_retention_days, response_footer, allow_flag_overrides, is_issuer, parent_id, client_cert_identity, priority, default_model, rate_limit_bypass, allowed_endpoints, stream_flush_ms, stream_flush_bytes, output_filters, external_subject) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, NULLIF(?, ''), ?, ?, ?, ?, ?, ?, ?, NULLIF(?, ''))`
+	_, err := s.db.Exec(query, token.ID, token.UserName, token.Mode, token.CreatedAt, token.ExpiresAt, token.EnableConversationLogging, token.MaxRequestSeconds, token.ConversationRetentionDays, token.ResponseFooter, token.AllowFlagOverrides, token.IsIssuer, token.ParentID, token.ClientCertIdentity, token.Priority, token.DefaultModel, token.RateLimitBypass, token.AllowedEndpoints, token.StreamFlushMs, token.StreamFlushBytes, token.OutputFilters, token.ExternalSubject)
 	return err
 }
 
@@ -281,14 +569,26 @@ func (s *Store) GetToken(id string) (*Token, error) {
 	query := `SELECT id, user_name, mode, created_at, expires_at, revoked_at, last_used_at,
 		COALESCE(enable_conversation_logging, 0),
 		COALESCE(total_requests, 0),
-		COALESCE(total_tokens_used, 0)
+		COALESCE(total_tokens_used, 0),
+		COALESCE(max_request_seconds, 0),
+		COALESCE(conversation_retention_days, 0),
+		COALESCE(response_footer, ''),
+		COALESCE(allow_flag_overrides, 0),
+		COALESCE(is_issuer, 0),
+		COALESCE(parent_id, ''),
+		COALESCE(client_cert_identity, ''),
+		COALESCE(priority, ''), COALESCE(default_model, ''), COALESCE(rate_limit_bypass, ''), COALESCE(allowed_endpoints, ''),
+		COALESCE(stream_flush_ms, 0), COALESCE(stream_flush_bytes, 0), COALESCE(output_filters, ''),
+		COALESCE(external_subject, '')
 		FROM tokens WHERE id = ?`
 	row := s.db.QueryRow(query, id)
 
 	var token Token
 	err := row.Scan(&token.ID, &token.UserName, &token.Mode, &token.CreatedAt, &token.ExpiresAt,
 		&token.RevokedAt, &token.LastUsedAt, &token.EnableConversationLogging,
-		&token.TotalRequests, &token.TotalTokensUsed)
+		&token.TotalRequests, &token.TotalTokensUsed, &token.MaxRequestSeconds, &token.ConversationRetentionDays, &token.ResponseFooter, &token.AllowFlagOverrides,
+		&token.IsIssuer, &token.ParentID, &token.ClientCertIdentity, &token.Priority, &token.DefaultModel, &token.RateLimitBypass, &token.AllowedEndpoints,
+		&token.StreamFlushMs, &token.StreamFlushBytes, &token.OutputFilters, &token.ExternalSubject)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
@@ -303,7 +603,17 @@ func (s *Store) ValidateToken(id string) (*Token, error) {
 	query := `SELECT id, user_name, mode, created_at, expires_at, revoked_at, last_used_at,
 		COALESCE(enable_conversation_logging, 0),
 		COALESCE(total_requests, 0),
-		COALESCE(total_tokens_used, 0)
+		COALESCE(total_tokens_used, 0),
+		COALESCE(max_request_seconds, 0),
+		COALESCE(conversation_retention_days, 0),
+		COALESCE(response_footer, ''),
+		COALESCE(allow_flag_overrides, 0),
+		COALESCE(is_issuer, 0),
+		COALESCE(parent_id, ''),
+		COALESCE(client_cert_identity, ''),
+		COALESCE(priority, ''), COALESCE(default_model, ''), COALESCE(rate_limit_bypass, ''), COALESCE(allowed_endpoints, ''),
+		COALESCE(stream_flush_ms, 0), COALESCE(stream_flush_bytes, 0), COALESCE(output_filters, ''),
+		COALESCE(external_subject, '')
 		FROM tokens
 		WHERE id = ? AND revoked_at IS NULL AND expires_at > datetime('now')`
 	row := s.db.QueryRow(query, id)
@@ -311,7 +621,9 @@ func (s *Store) ValidateToken(id string) (*Token, error) {
 	var token Token
 	err := row.Scan(&token.ID, &token.UserName, &token.Mode, &token.CreatedAt, &token.ExpiresAt,
 		&token.RevokedAt, &token.LastUsedAt, &token.EnableConversationLogging,
-		&token.TotalRequests, &token.TotalTokensUsed)
+		&token.TotalRequests, &token.TotalTokensUsed, &token.MaxRequestSeconds, &token.ConversationRetentionDays, &token.ResponseFooter, &token.AllowFlagOverrides,
+		&token.IsIssuer, &token.ParentID, &token.ClientCertIdentity, &token.Priority, &token.DefaultModel, &token.RateLimitBypass, &token.AllowedEndpoints,
+		&token.StreamFlushMs, &token.StreamFlushBytes, &token.OutputFilters, &token.ExternalSubject)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
@@ -328,9 +640,10 @@ func (s *Store) UpdateTokenLastUsed(id string) error {
 	return err
 }
 
+// RevokeToken revokes a token together with the child tokens it minted
 func (s *Store) RevokeToken(id string) error {
-	query := `UPDATE tokens SET revoked_at = datetime('now') WHERE id = ?`
-	_, err := s.db.Exec(query, id)
+	query := `UPDATE tokens SET revoked_at = datetime('now') WHERE id = ? OR (parent_id = ? AND revoked_at IS NULL)`
+	_, err := s.db.Exec(query, id, id)
 	return err
 }
 
@@ -338,7 +651,17 @@ func (s *Store) ListTokens() ([]*Token, error) {
 	query := `SELECT id, user_name, mode, created_at, expires_at, revoked_at, last_used_at,
 		COALESCE(enable_conversation_logging, 0),
 		COALESCE(total_requests, 0),
-		COALESCE(total_tokens_used, 0)
+		COALESCE(total_tokens_used, 0),
+		COALESCE(max_request_seconds, 0),
+		COALESCE(conversation_retention_days, 0),
+		COALESCE(response_footer, ''),
+		COALESCE(allow_flag_overrides, 0),
+		COALESCE(is_issuer, 0),
+		COALESCE(parent_id, ''),
+		COALESCE(client_cert_identity, ''),
+		COALESCE(priority, ''), COALESCE(default_model, ''), COALESCE(rate_limit_bypass, ''), COALESCE(allowed_endpoints, ''),
+		COALESCE(stream_flush_ms, 0), COALESCE(stream_flush_bytes, 0), COALESCE(output_filters, ''),
+		COALESCE(external_subject, '')
 		FROM tokens ORDER BY created_at DESC`
 	rows, err := s.db.Query(query)
 	if err != nil {
@@ -351,7 +674,10 @@ func (s *Store) ListTokens() ([]*Token, error) {
 		var token Token
 		if err := rows.Scan(&token.ID, &token.UserName, &token.Mode, &token.CreatedAt,
 			&token.ExpiresAt, &token.RevokedAt, &token.LastUsedAt,
-			&token.EnableConversationLogging, &token.TotalRequests, &token.TotalTokensUsed); err != nil {
+			&token.EnableConversationLogging, &token.TotalRequests, &token.TotalTokensUsed,
+			&token.MaxRequestSeconds, &token.ConversationRetentionDays, &token.ResponseFooter, &token.AllowFlagOverrides,
+			&token.IsIssuer, &token.ParentID, &token.ClientCertIdentity, &token.Priority, &token.DefaultModel, &token.RateLimitBypass, &token.AllowedEndpoints,
+		&token.StreamFlushMs, &token.StreamFlushBytes, &token.OutputFilters, &token.ExternalSubject); err != nil {
 			return nil, err
 		}
 		tokens = append(tokens, &token)
@@ -371,10 +697,123 @@ func (s *Store) CleanupExpiredTokens() (int64, error) {
 
 func (s *Store) UpdateTokenSettings(id string, enableConvLogging bool) error {
 	query := `UPDATE tokens SET enable_conversation_logging = ? WHERE id = ?`
-	_, err := s.db.Exec(query, enableConvLogging)
+	_, err := s.db.Exec(query, enableConvLogging, id)
 	return err
 }
 
+// UpdateTokenMaxRequestSeconds sets the token's end-to-end request budget (0 = unlimited)
+func (s *Store) UpdateTokenMaxRequestSeconds(id string, seconds int) error {
+	query := `UPDATE tokens SET max_request_seconds = ? WHERE id = ?`
+	_, err := s.db.Exec(query, seconds, id)
+	return err
+}
+
+// UpdateTokenResponseFooter sets the text appended to the token's responses ("" = disabled)
+func (s *Store) UpdateTokenResponseFooter(id string, footer string) error {
+	query := `UPDATE tokens SET response_footer = ? WHERE id = ?`
+	_, err := s.db.Exec(query, footer, id)
+	return err
+}
+
+// UpdateTokenFlagOverrides sets whether the token may override feature flags per request
+func (s *Store) UpdateTokenFlagOverrides(id string, allow bool) error {
+	query := `UPDATE tokens SET allow_flag_overrides = ? WHERE id = ?`
+	_, err := s.db.Exec(query, allow, id)
+	return err
+}
+
+// UpdateTokenIssuer sets whether the token may mint child tokens
+func (s *Store) UpdateTokenIssuer(id string, issuer bool) error {
+	query := `UPDATE tokens SET is_issuer = ? WHERE id = ?`
+	_, err := s.db.Exec(query, issuer, id)
+	return err
+}
+
+// UpdateTokenClientCertIdentity sets the client certificate CN or SAN that
+// authenticates as the token ("" = none). Identities are unique across tokens.
+func (s *Store) UpdateTokenClientCertIdentity(id string, identity string) error {
+	query := `UPDATE tokens SET client_cert_identity = NULLIF(?, '') WHERE id = ?`
+	_, err := s.db.Exec(query, identity, id)
+	return err
+}
+
+// UpdateTokenExternalSubject sets the "<issuer name>:<sub>" of the external
+// JWTs that authenticate as the token ("" = none). Subjects are unique across
+// tokens.
+func (s *Store) UpdateTokenExternalSubject(id string, subject string) error {
+	query := `UPDATE tokens SET external_subject = NULLIF(?, '') WHERE id = ?`
+	_, err := s.db.Exec(query, subject, id)
+	return err
+}
+
+// UpdateTokenPriority sets the token's load shedding priority ("" = normal)
+func (s *Store) UpdateTokenPriority(id string, priority string) error {
+	query := `UPDATE tokens SET priority = ? WHERE id = ?`
+	_, err := s.db.Exec(query, priority, id)
+	return err
+}
+
+// UpdateTokenDefaultModel sets the model used when the token's requests name none
+func (s *Store) UpdateTokenDefaultModel(id string, model string) error {
+	query := `UPDATE tokens SET default_model = ? WHERE id = ?`
+	_, err := s.db.Exec(query, model, id)
+	return err
+}
+
+// UpdateTokenRateLimitBypass sets the rate limit classes the token is exempt
+// from, comma-separated ("" = none)
+func (s *Store) UpdateTokenRateLimitBypass(id string, classes string) error {
+	query := `UPDATE tokens SET rate_limit_bypass = ? WHERE id = ?`
+	_, err := s.db.Exec(query, classes, id)
+	return err
+}
+
+// UpdateTokenAllowedEndpoints sets the endpoint groups the token may call,
+// comma-separated ("" = all)
+func (s *Store) UpdateTokenAllowedEndpoints(id string, endpoints string) error {
+	query := `UPDATE tokens SET allowed_endpoints = ? WHERE id = ?`
+	_, err := s.db.Exec(query, endpoints, id)
+	return err
+}
+
+// UpdateTokenStreamFlush sets how long and up to how many bytes the token's
+// stream chunks are coalesced before a flush (0 = the server defaults)
+func (s *Store) UpdateTokenStreamFlush(id string, flushMs, flushBytes int) error {
+	query := `UPDATE tokens SET stream_flush_ms = ?, stream_flush_bytes = ? WHERE id = ?`
+	_, err := s.db.Exec(query, flushMs, flushBytes, id)
+	return err
+}
+
+// UpdateTokenOutputFilters sets the filters applied to the token's
+// responses, comma-separated ("" = none)
+func (s *Store) UpdateTokenOutputFilters(id string, filters string) error {
+	query := `UPDATE tokens SET output_filters = ? WHERE id = ?`
+	_, err := s.db.Exec(query, filters, id)
+	return err
+}
+
+// TokenIDByClientCert returns the token mapped to a client certificate
+// identity, or "" when there is none
+func (s *Store) TokenIDByClientCert(identity string) (string, error) {
+	var id string
+	err := s.db.QueryRow(`SELECT id FROM tokens WHERE client_cert_identity = ?`, identity).Scan(&id)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return id, err
+}
+
+// TokenIDByExternalSubject returns the token mapped to an external JWT
+// subject, or "" when there is none
+func (s *Store) TokenIDByExternalSubject(subject string) (string, error) {
+	var id string
+	err := s.db.QueryRow(`SELECT id FROM tokens WHERE external_subject = ?`, subject).Scan(&id)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return id, err
+}
+
 func (s *Store) IncrementTokenUsage(id string, tokensUsed int) error {
 	query := `UPDATE tokens SET
 		total_requests = total_requests + 1,
@@ -468,6 +907,9 @@ func (s *Store) DeleteSession(id string) error {
 }
 
 func (s *Store) Close() error {
+	if s.read != s.db {
+		s.read.Close()
+	}
 	return s.db.Close()
 }
 
@@ -0,0 +1,267 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// StateTables are the tables holding instance state rather than history, in an
+// order where accounts are restored before the tables that reference them
+var StateTables = []string{
+	"accounts",
+	"api_key_accounts",
+	"account_trace_sampling",
+	"account_spend_monthly",
+	"account_drains",
+	"account_secure_notes",
+	"account_reset_schedules",
+	"account_templates",
+	"tokens",
+	"jwt_keys",
+}
+
+// StateDump is a copy of the state tables. Rows hold column values in the order
+// of Columns; DATETIME values are RFC 3339 strings.
+type StateDump struct {
+	Version    int                    `json:"version"`
+	ExportedAt time.Time              `json:"exported_at"`
+	Tables     map[string]*TableState `json:"tables"`
+}
+
+// TableState is the content of one table in a state dump
+type TableState struct {
+	Columns []string        `json:"columns"`
+	Rows    [][]interface{} `json:"rows"`
+}
+
+// StateImportResult reports what an import restored
+type StateImportResult struct {
+	Rows map[string]int `json:"rows"`
+	// SkippedColumns lists dumped columns this database does not have
+	SkippedColumns map[string][]string `json:"skipped_columns,omitempty"`
+}
+
+// StateDumpVersion is the version of the state dump format
+const StateDumpVersion = 1
+
+// tableColumn is a column as reported by PRAGMA table_info
+type tableColumn struct {
+	name     string
+	declType string
+	pk       int
+}
+
+// tableColumns returns a table's columns in declaration order
+func (s *Store) tableColumns(table string) ([]tableColumn, error) {
+	rows, err := s.db.Query(`PRAGMA table_info(` + table + `)`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var cols []tableColumn
+	for rows.Next() {
+		var (
+			cid     int
+			col     tableColumn
+			notNull int
+			dflt    interface{}
+		)
+		if err := rows.Scan(&cid, &col.name, &col.declType, &notNull, &dflt, &col.pk); err != nil {
+			return nil, err
+		}
+		cols = append(cols, col)
+	}
+	return cols, rows.Err()
+}
+
+// ExportState copies every state table
+func (s *Store) ExportState() (*StateDump, error) {
+	dump := &StateDump{
+		Version:    StateDumpVersion,
+		ExportedAt: time.Now().UTC(),
+		Tables:     make(map[string]*TableState, len(StateTables)),
+	}
+	for _, table := range StateTables {
+		state, err := s.exportTable(table)
+		if err != nil {
+			return nil, fmt.Errorf("export %s: %w", table, err)
+		}
+		dump.Tables[table] = state
+	}
+	return dump, nil
+}
+
+func (s *Store) exportTable(table string) (*TableState, error) {
+	cols, err := s.tableColumns(table)
+	if err != nil {
+		return nil, err
+	}
+	state := &TableState{Rows: [][]interface{}{}}
+	for _, col := range cols {
+		state.Columns = append(state.Columns, col.name)
+	}
+
+	rows, err := s.db.Query(`SELECT ` + strings.Join(state.Columns, ", ") + ` FROM ` + table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		values := make([]interface{}, len(cols))
+		dest := make([]interface{}, len(cols))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		for i, v := range values {
+			switch v := v.(type) {
+			case []byte:
+				values[i] = string(v)
+			case time.Time:
+				values[i] = v.Format(time.RFC3339Nano)
+			}
+		}
+		state.Rows = append(state.Rows, values)
+	}
+	return state, rows.Err()
+}
+
+// ImportState restores a state dump in one transaction. Rows are upserted by
+// primary key, so existing rows not in the dump are kept; columns the database
+// does not have are skipped so dumps from other versions can be restored.
+func (s *Store) ImportState(dump *StateDump) (*StateImportResult, error) {
+	if dump.Version != StateDumpVersion {
+		return nil, fmt.Errorf("unsupported state dump version %d", dump.Version)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	result := &StateImportResult{Rows: make(map[string]int)}
+	for _, table := range StateTables {
+		state := dump.Tables[table]
+		if state == nil {
+			continue
+		}
+		cols, err := s.tableColumns(table)
+		if err != nil {
+			return nil, fmt.Errorf("import %s: %w", table, err)
+		}
+		byName := make(map[string]tableColumn, len(cols))
+		for _, col := range cols {
+			byName[col.name] = col
+		}
+
+		// Restore the columns both sides have
+		var (
+			names   []string
+			indexes []int
+			keys    []string
+			updates []string
+		)
+		for i, name := range state.Columns {
+			col, ok := byName[name]
+			if !ok {
+				if result.SkippedColumns == nil {
+					result.SkippedColumns = make(map[string][]string)
+				}
+				result.SkippedColumns[table] = append(result.SkippedColumns[table], name)
+				continue
+			}
+			names = append(names, name)
+			indexes = append(indexes, i)
+			if col.pk > 0 {
+				keys = append(keys, name)
+			} else {
+				updates = append(updates, name+" = excluded."+name)
+			}
+		}
+		if len(names) == 0 {
+			continue
+		}
+		var missingKey []string
+		for _, col := range cols {
+			if col.pk > 0 && !contains(keys, col.name) {
+				missingKey = append(missingKey, col.name)
+			}
+		}
+		if len(missingKey) > 0 {
+			return nil, fmt.Errorf("import %s: dump lacks primary key columns %s", table, strings.Join(missingKey, ", "))
+		}
+
+		// Upsert instead of INSERT OR REPLACE, which would delete the row and
+		// cascade to the tables referencing it
+		query := `INSERT INTO ` + table + ` (` + strings.Join(names, ", ") + `) VALUES (?` +
+			strings.Repeat(", ?", len(names)-1) + `)`
+		if len(updates) > 0 {
+			query += ` ON CONFLICT(` + strings.Join(keys, ", ") + `) DO UPDATE SET ` + strings.Join(updates, ", ")
+		} else {
+			query += ` ON CONFLICT DO NOTHING`
+		}
+		stmt, err := tx.Prepare(query)
+		if err != nil {
+			return nil, fmt.Errorf("import %s: %w", table, err)
+		}
+
+		for n, row := range state.Rows {
+			if len(row) != len(state.Columns) {
+				stmt.Close()
+				return nil, fmt.Errorf("import %s: row %d has %d values, want %d", table, n, len(row), len(state.Columns))
+			}
+			args := make([]interface{}, len(names))
+			for i, idx := range indexes {
+				args[i] = importValue(row[idx], byName[names[i]].declType)
+			}
+			if _, err := stmt.Exec(args...); err != nil {
+				stmt.Close()
+				return nil, fmt.Errorf("import %s row %d: %w", table, n, err)
+			}
+		}
+		stmt.Close()
+		result.Rows[table] = len(state.Rows)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// importValue converts a decoded JSON value back to what the driver stores for
+// the column type, so timestamps compare the same as before the export
+func importValue(v interface{}, declType string) interface{} {
+	switch v := v.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case string:
+		switch strings.ToUpper(declType) {
+		case "DATETIME", "TIMESTAMP", "DATE":
+			if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+				return t
+			}
+		}
+	}
+	return v
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
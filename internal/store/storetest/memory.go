@@ -0,0 +1,474 @@
+// Package storetest provides an in-memory fake of the narrow store interfaces
+// for unit tests that should not need a SQLite file.
+package storetest
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"ccproxy/internal/store"
+)
+
+// MemoryStore implements store.AccountStore, store.TokenStore,
+// store.LogStore and store.AdminSessionStore in memory. Values are copied in and out, so callers cannot
+// change stored records without going through the store.
+type MemoryStore struct {
+	mu       sync.Mutex
+	accounts map[string]*store.Account
+	tokens   map[string]*store.Token
+	logs     map[string]*store.RequestLog
+	sessions map[string]*store.AdminSession
+}
+
+var (
+	_ store.AccountStore      = (*MemoryStore)(nil)
+	_ store.TokenStore        = (*MemoryStore)(nil)
+	_ store.LogStore          = (*MemoryStore)(nil)
+	_ store.AdminSessionStore = (*MemoryStore)(nil)
+)
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		accounts: make(map[string]*store.Account),
+		tokens:   make(map[string]*store.Token),
+		logs:     make(map[string]*store.RequestLog),
+		sessions: make(map[string]*store.AdminSession),
+	}
+}
+
+// Account operations
+
+func (m *MemoryStore) CreateAccount(account *store.Account) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.accounts[account.ID]; ok {
+		return fmt.Errorf("account %s already exists", account.ID)
+	}
+	stored := *account
+	m.accounts[account.ID] = &stored
+	return nil
+}
+
+func (m *MemoryStore) GetAccount(id string) (*store.Account, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	account, ok := m.accounts[id]
+	if !ok {
+		return nil, nil
+	}
+	copied := *account
+	return &copied, nil
+}
+
+// ListAccounts returns accounts newest first
+func (m *MemoryStore) ListAccounts() ([]*store.Account, error) {
+	accounts := m.listAccounts()
+	sort.SliceStable(accounts, func(i, j int) bool {
+		return accounts[i].CreatedAt.After(accounts[j].CreatedAt)
+	})
+	return accounts, nil
+}
+
+// ListAccountsWithStatus returns accounts by priority, then newest first
+func (m *MemoryStore) ListAccountsWithStatus() ([]*store.Account, error) {
+	accounts := m.listAccounts()
+	sort.SliceStable(accounts, func(i, j int) bool {
+		if accounts[i].Priority != accounts[j].Priority {
+			return accounts[i].Priority < accounts[j].Priority
+		}
+		return accounts[i].CreatedAt.After(accounts[j].CreatedAt)
+	})
+	return accounts, nil
+}
+
+func (m *MemoryStore) listAccounts() []*store.Account {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	accounts := make([]*store.Account, 0, len(m.accounts))
+	for _, account := range m.accounts {
+		copied := *account
+		accounts = append(accounts, &copied)
+	}
+	return accounts
+}
+
+func (m *MemoryStore) UpdateAccount(account *store.Account) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.accounts[account.ID]; ok {
+		stored := *account
+		m.accounts[account.ID] = &stored
+	}
+	return nil
+}
+
+func (m *MemoryStore) UpdateAccountLastUsed(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if account, ok := m.accounts[id]; ok {
+		now := time.Now()
+		account.LastUsedAt = &now
+	}
+	return nil
+}
+
+func (m *MemoryStore) DeactivateAccount(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if account, ok := m.accounts[id]; ok {
+		account.IsActive = false
+	}
+	return nil
+}
+
+func (m *MemoryStore) DeleteAccount(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.accounts, id)
+	return nil
+}
+
+// Token operations
+
+func (m *MemoryStore) CreateToken(token *store.Token) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.tokens[token.ID]; ok {
+		return fmt.Errorf("token %s already exists", token.ID)
+	}
+	stored := *token
+	m.tokens[token.ID] = &stored
+	return nil
+}
+
+func (m *MemoryStore) GetToken(id string) (*store.Token, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	token, ok := m.tokens[id]
+	if !ok {
+		return nil, nil
+	}
+	copied := *token
+	return &copied, nil
+}
+
+// ValidateToken returns the token if it exists, is not revoked and has not expired
+func (m *MemoryStore) ValidateToken(id string) (*store.Token, error) {
+	token, err := m.GetToken(id)
+	if err != nil || token == nil {
+		return nil, err
+	}
+	if token.RevokedAt != nil || !token.ExpiresAt.After(time.Now()) {
+		return nil, nil
+	}
+	return token, nil
+}
+
+// ListTokens returns tokens newest first
+func (m *MemoryStore) ListTokens() ([]*store.Token, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tokens := make([]*store.Token, 0, len(m.tokens))
+	for _, token := range m.tokens {
+		copied := *token
+		tokens = append(tokens, &copied)
+	}
+	sort.SliceStable(tokens, func(i, j int) bool {
+		return tokens[i].CreatedAt.After(tokens[j].CreatedAt)
+	})
+	return tokens, nil
+}
+
+func (m *MemoryStore) RevokeToken(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for _, token := range m.tokens {
+		if token.ID == id || (token.ParentID == id && token.RevokedAt == nil) {
+			revokedAt := now
+			token.RevokedAt = &revokedAt
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) UpdateTokenLastUsed(id string) error {
+	return m.updateToken(id, func(token *store.Token) {
+		now := time.Now()
+		token.LastUsedAt = &now
+	})
+}
+
+func (m *MemoryStore) UpdateTokenSettings(id string, enableConvLogging bool) error {
+	return m.updateToken(id, func(token *store.Token) {
+		token.EnableConversationLogging = enableConvLogging
+	})
+}
+
+func (m *MemoryStore) UpdateTokenMaxRequestSeconds(id string, seconds int) error {
+	return m.updateToken(id, func(token *store.Token) {
+		token.MaxRequestSeconds = seconds
+	})
+}
+
+func (m *MemoryStore) UpdateTokenRetentionDays(id string, days int) error {
+	return m.updateToken(id, func(token *store.Token) {
+		token.ConversationRetentionDays = days
+	})
+}
+
+func (m *MemoryStore) UpdateTokenResponseFooter(id string, footer string) error {
+	return m.updateToken(id, func(token *store.Token) {
+		token.ResponseFooter = footer
+	})
+}
+
+func (m *MemoryStore) UpdateTokenFlagOverrides(id string, allow bool) error {
+	return m.updateToken(id, func(token *store.Token) {
+		token.AllowFlagOverrides = allow
+	})
+}
+
+func (m *MemoryStore) UpdateTokenIssuer(id string, issuer bool) error {
+	return m.updateToken(id, func(token *store.Token) {
+		token.IsIssuer = issuer
+	})
+}
+
+func (m *MemoryStore) UpdateTokenClientCertIdentity(id string, identity string) error {
+	return m.updateToken(id, func(token *store.Token) {
+		token.ClientCertIdentity = identity
+	})
+}
+
+func (m *MemoryStore) UpdateTokenExternalSubject(id string, subject string) error {
+	return m.updateToken(id, func(token *store.Token) {
+		token.ExternalSubject = subject
+	})
+}
+
+func (m *MemoryStore) UpdateTokenPriority(id string, priority string) error {
+	return m.updateToken(id, func(token *store.Token) {
+		token.Priority = priority
+	})
+}
+
+func (m *MemoryStore) UpdateTokenDefaultModel(id string, model string) error {
+	return m.updateToken(id, func(token *store.Token) {
+		token.DefaultModel = model
+	})
+}
+
+func (m *MemoryStore) UpdateTokenRateLimitBypass(id string, classes string) error {
+	return m.updateToken(id, func(token *store.Token) {
+		token.RateLimitBypass = classes
+	})
+}
+
+func (m *MemoryStore) UpdateTokenAllowedEndpoints(id string, endpoints string) error {
+	return m.updateToken(id, func(token *store.Token) {
+		token.AllowedEndpoints = endpoints
+	})
+}
+
+func (m *MemoryStore) UpdateTokenStreamFlush(id string, flushMs, flushBytes int) error {
+	return m.updateToken(id, func(token *store.Token) {
+		token.StreamFlushMs = flushMs
+		token.StreamFlushBytes = flushBytes
+	})
+}
+
+func (m *MemoryStore) UpdateTokenOutputFilters(id string, filters string) error {
+	return m.updateToken(id, func(token *store.Token) {
+		token.OutputFilters = filters
+	})
+}
+
+func (m *MemoryStore) TokenIDByClientCert(identity string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, token := range m.tokens {
+		if identity != "" && token.ClientCertIdentity == identity {
+			return token.ID, nil
+		}
+	}
+	return "", nil
+}
+
+func (m *MemoryStore) TokenIDByExternalSubject(subject string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, token := range m.tokens {
+		if subject != "" && token.ExternalSubject == subject {
+			return token.ID, nil
+		}
+	}
+	return "", nil
+}
+
+func (m *MemoryStore) IncrementTokenUsage(id string, tokensUsed int) error {
+	return m.updateToken(id, func(token *store.Token) {
+		now := time.Now()
+		token.TotalRequests++
+		token.TotalTokensUsed += tokensUsed
+		token.LastUsedAt = &now
+	})
+}
+
+// updateToken applies fn to a stored token; like an UPDATE, missing tokens are ignored
+func (m *MemoryStore) updateToken(id string, fn func(token *store.Token)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if token, ok := m.tokens[id]; ok {
+		fn(token)
+	}
+	return nil
+}
+
+// Request log operations
+
+func (m *MemoryStore) CreateRequestLog(log *store.RequestLog) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.logs[log.ID]; ok {
+		return fmt.Errorf("request log %s already exists", log.ID)
+	}
+	stored := *log
+	m.logs[log.ID] = &stored
+	return nil
+}
+
+func (m *MemoryStore) GetRequestLog(id string) (*store.RequestLog, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	log, ok := m.logs[id]
+	if !ok {
+		return nil, nil
+	}
+	copied := *log
+	return &copied, nil
+}
+
+// ListRequestLogs applies the filter like Store.ListRequestLogs: newest first,
+// 50 per page by default, with the total number of matching logs
+func (m *MemoryStore) ListRequestLogs(filter store.RequestLogFilter) ([]*store.RequestLog, int, error) {
+	m.mu.Lock()
+	var logs []*store.RequestLog
+	for _, log := range m.logs {
+		if matchesFilter(log, filter) {
+			copied := *log
+			logs = append(logs, &copied)
+		}
+	}
+	m.mu.Unlock()
+
+	sort.SliceStable(logs, func(i, j int) bool {
+		return logs[i].RequestAt.After(logs[j].RequestAt)
+	})
+
+	total := len(logs)
+	if filter.Limit <= 0 {
+		filter.Limit = 50
+	}
+	if filter.Page < 0 {
+		filter.Page = 0
+	}
+	start := filter.Page * filter.Limit
+	if start >= total {
+		return nil, total, nil
+	}
+	end := start + filter.Limit
+	if end > total {
+		end = total
+	}
+	return logs[start:end], total, nil
+}
+
+func matchesFilter(log *store.RequestLog, filter store.RequestLogFilter) bool {
+	switch {
+	case filter.TokenID != "" && log.TokenID != filter.TokenID,
+		filter.AccountID != "" && log.AccountID.String != filter.AccountID,
+		filter.UserName != "" && log.UserName != filter.UserName,
+		filter.Mode != "" && log.Mode != filter.Mode,
+		filter.Model != "" && log.Model != filter.Model,
+		filter.Success != nil && log.Success != *filter.Success,
+		filter.UpstreamRequestID != "" && log.UpstreamRequestID.String != filter.UpstreamRequestID,
+		filter.EndUserID != "" && log.EndUserID.String != filter.EndUserID,
+		filter.FailureCategory != "" && log.FailureCategory.String != filter.FailureCategory,
+		filter.FromDate != nil && log.RequestAt.Before(*filter.FromDate),
+		filter.ToDate != nil && log.RequestAt.After(*filter.ToDate):
+		return false
+	}
+	return true
+}
+
+func (m *MemoryStore) DeleteOldRequestLogs(daysToKeep int) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cutoff := time.Now().AddDate(0, 0, -daysToKeep)
+	var deleted int64
+	for id, log := range m.logs {
+		if log.RequestAt.Before(cutoff) {
+			delete(m.logs, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// Admin session operations
+
+func (m *MemoryStore) CreateAdminSession(session *store.AdminSession) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.sessions[session.ID]; ok {
+		return fmt.Errorf("admin session %s already exists", session.ID)
+	}
+	stored := *session
+	m.sessions[session.ID] = &stored
+	return nil
+}
+
+func (m *MemoryStore) GetAdminSession(id string) (*store.AdminSession, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session, ok := m.sessions[id]
+	if !ok {
+		return nil, nil
+	}
+	copied := *session
+	return &copied, nil
+}
+
+func (m *MemoryStore) RevokeAdminSession(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if session, ok := m.sessions[id]; ok && session.RevokedAt == nil {
+		now := time.Now()
+		session.RevokedAt = &now
+	}
+	return nil
+}
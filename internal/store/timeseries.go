@@ -0,0 +1,242 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Timeseries groupings
+const (
+	TimeseriesGroupNone    = ""
+	TimeseriesGroupToken   = "token"
+	TimeseriesGroupAccount = "account"
+	TimeseriesGroupModel   = "model"
+)
+
+// timeseriesGroupColumns maps groupings to the column shared by request_logs
+// and usage_stats_daily
+var timeseriesGroupColumns = map[string]string{
+	TimeseriesGroupNone:    "''",
+	TimeseriesGroupToken:   "COALESCE(token_id, '')",
+	TimeseriesGroupAccount: "COALESCE(account_id, '')",
+	TimeseriesGroupModel:   "COALESCE(model, '')",
+}
+
+// ValidTimeseriesGroup reports whether group is a supported grouping
+func ValidTimeseriesGroup(group string) bool {
+	_, ok := timeseriesGroupColumns[group]
+	return ok
+}
+
+// TimeseriesQuery selects the buckets of a time series. Buckets are aligned
+// to multiples of Granularity since the Unix epoch, in UTC.
+type TimeseriesQuery struct {
+	From        time.Time
+	To          time.Time
+	Granularity time.Duration // At least a minute
+	GroupBy     string        // One of the TimeseriesGroup constants
+	TokenID     string        // Optional filters
+	AccountID   string
+	Model       string
+}
+
+// TimeseriesPoint holds the usage of one bucket and group
+type TimeseriesPoint struct {
+	Time             time.Time           `json:"time"`
+	Requests         int64               `json:"requests"`
+	Successes        int64               `json:"successes"`
+	Errors           int64               `json:"errors"`
+	PromptTokens     int64               `json:"prompt_tokens"`
+	CompletionTokens int64               `json:"completion_tokens"`
+	TotalTokens      int64               `json:"total_tokens"`
+	AvgDurationMs    int64               `json:"avg_duration_ms"`
+	AvgTTFTMs        int64               `json:"avg_ttft_ms"`
+	Duration         *LatencyPercentiles `json:"duration_percentiles,omitempty"`
+
+	durationSum, durationCount int64
+	ttftSum, ttftCount         int64
+	histogram                  LatencyHistogram
+}
+
+// TimeseriesSeries is the points of one group, oldest first, with a point
+// for every bucket in the range
+type TimeseriesSeries struct {
+	Group  string             `json:"group"`
+	Points []*TimeseriesPoint `json:"points"`
+}
+
+// GetTimeseries returns usage per bucket and group. Whole days before today
+// (UTC) come from daily usage stats when the granularity is a whole number
+// of days, so they outlive request log retention; everything else is
+// computed from request logs.
+func (s *Store) GetTimeseries(q TimeseriesQuery) ([]*TimeseriesSeries, error) {
+	group, ok := timeseriesGroupColumns[q.GroupBy]
+	if !ok {
+		return nil, fmt.Errorf("unknown grouping %q", q.GroupBy)
+	}
+	step := int64(q.Granularity / time.Second)
+	if step < 60 {
+		return nil, fmt.Errorf("granularity must be at least a minute")
+	}
+
+	from := bucketStart(q.From, step)
+	points := make(map[string]map[int64]*TimeseriesPoint)
+
+	logsFrom := from
+	if step%86400 == 0 {
+		today := time.Now().UTC().Truncate(24 * time.Hour)
+		if today.After(from) {
+			dailyTo := today
+			if q.To.Before(dailyTo) {
+				dailyTo = q.To
+			}
+			if err := s.timeseriesFromDaily(points, q, group, step, from, dailyTo); err != nil {
+				return nil, err
+			}
+			logsFrom = dailyTo
+		}
+	}
+	if q.To.After(logsFrom) {
+		if err := s.timeseriesFromLogs(points, q, group, step, logsFrom, q.To); err != nil {
+			return nil, err
+		}
+	}
+
+	groups := make([]string, 0, len(points))
+	for g := range points {
+		groups = append(groups, g)
+	}
+	if q.GroupBy == TimeseriesGroupNone && len(groups) == 0 {
+		groups = append(groups, "")
+	}
+	sort.Strings(groups)
+
+	series := make([]*TimeseriesSeries, 0, len(groups))
+	for _, g := range groups {
+		s := &TimeseriesSeries{Group: g}
+		for bucket := from.Unix(); bucket < q.To.Unix(); bucket += step {
+			p, ok := points[g][bucket]
+			if !ok {
+				p = &TimeseriesPoint{}
+			}
+			p.finish(bucket)
+			s.Points = append(s.Points, p)
+		}
+		series = append(series, s)
+	}
+	return series, nil
+}
+
+// timeseriesFromLogs adds the buckets of request logs started in [from, to)
+func (s *Store) timeseriesFromLogs(points map[string]map[int64]*TimeseriesPoint, q TimeseriesQuery, group string, step int64, from, to time.Time) error {
+	// Compare in the caller's zone, like request times are stored
+	loc := q.From.Location()
+	where, args := timeseriesFilters(q, "request_at >= ? AND request_at < ?", from.In(loc), to.In(loc))
+	query := `SELECT (CAST(strftime('%s', request_at) AS INTEGER) / ?) * ? AS bucket, ` + group + ` AS grp,
+		COUNT(*), COALESCE(SUM(CASE WHEN success THEN 1 ELSE 0 END), 0),
+		COALESCE(SUM(prompt_tokens), 0), COALESCE(SUM(completion_tokens), 0), COALESCE(SUM(total_tokens), 0),
+		COALESCE(SUM(duration_ms), 0), COUNT(duration_ms), COALESCE(SUM(ttft_ms), 0), COUNT(ttft_ms),
+		` + LatencyHistogramSQL("duration_ms") + `
+		FROM request_logs WHERE ` + where + `
+		GROUP BY bucket, grp`
+
+	return s.scanTimeseries(points, query, append([]interface{}{step, step}, args...)...)
+}
+
+// timeseriesFromDaily adds the buckets of daily usage stats of days in [from, to)
+func (s *Store) timeseriesFromDaily(points map[string]map[int64]*TimeseriesPoint, q TimeseriesQuery, group string, step int64, from, to time.Time) error {
+	where, args := timeseriesFilters(q, "DATE(stat_date) >= ? AND DATE(stat_date) < ?",
+		from.UTC().Format("2006-01-02"), to.UTC().Format("2006-01-02"))
+	// Averages are weighted by request count to merge days
+	query := `SELECT (CAST(strftime('%s', DATE(stat_date)) AS INTEGER) / ?) * ?, ` + group + `,
+		request_count, success_count, total_prompt_tokens, total_completion_tokens, total_tokens,
+		COALESCE(avg_duration_ms, 0) * request_count, request_count,
+		COALESCE(avg_ttft_ms, 0) * request_count, CASE WHEN avg_ttft_ms > 0 THEN request_count ELSE 0 END,
+		duration_histogram
+		FROM usage_stats_daily WHERE ` + where
+
+	return s.scanTimeseries(points, query, append([]interface{}{step, step}, args...)...)
+}
+
+func (s *Store) scanTimeseries(points map[string]map[int64]*TimeseriesPoint, query string, args ...interface{}) error {
+	rows, err := s.read.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var bucket int64
+		var group string
+		var row TimeseriesPoint
+		var histogram sql.NullString
+		if err := rows.Scan(&bucket, &group, &row.Requests, &row.Successes,
+			&row.PromptTokens, &row.CompletionTokens, &row.TotalTokens,
+			&row.durationSum, &row.durationCount, &row.ttftSum, &row.ttftCount, &histogram); err != nil {
+			return err
+		}
+
+		byBucket, ok := points[group]
+		if !ok {
+			byBucket = make(map[int64]*TimeseriesPoint)
+			points[group] = byBucket
+		}
+		p, ok := byBucket[bucket]
+		if !ok {
+			p = &TimeseriesPoint{histogram: newLatencyHistogram()}
+			byBucket[bucket] = p
+		}
+		p.Requests += row.Requests
+		p.Successes += row.Successes
+		p.PromptTokens += row.PromptTokens
+		p.CompletionTokens += row.CompletionTokens
+		p.TotalTokens += row.TotalTokens
+		p.durationSum += row.durationSum
+		p.durationCount += row.durationCount
+		p.ttftSum += row.ttftSum
+		p.ttftCount += row.ttftCount
+		p.histogram.merge(histogram)
+	}
+	return rows.Err()
+}
+
+// finish sets the bucket time and the derived fields of a point
+func (p *TimeseriesPoint) finish(bucket int64) {
+	p.Time = time.Unix(bucket, 0).UTC()
+	p.Errors = p.Requests - p.Successes
+	if p.durationCount > 0 {
+		p.AvgDurationMs = p.durationSum / p.durationCount
+	}
+	if p.ttftCount > 0 {
+		p.AvgTTFTMs = p.ttftSum / p.ttftCount
+	}
+	if p.histogram != nil {
+		p.Duration = p.histogram.Percentiles()
+	}
+}
+
+// timeseriesFilters appends the query's filters to a time range condition
+func timeseriesFilters(q TimeseriesQuery, where string, from, to interface{}) (string, []interface{}) {
+	args := []interface{}{from, to}
+	if q.TokenID != "" {
+		where += ` AND token_id = ?`
+		args = append(args, q.TokenID)
+	}
+	if q.AccountID != "" {
+		where += ` AND account_id = ?`
+		args = append(args, q.AccountID)
+	}
+	if q.Model != "" {
+		where += ` AND model = ?`
+		args = append(args, q.Model)
+	}
+	return where, args
+}
+
+// bucketStart aligns t down to a multiple of step seconds since the epoch
+func bucketStart(t time.Time, step int64) time.Time {
+	unix := t.Unix()
+	return time.Unix(unix-unix%step, 0).UTC()
+}
@@ -0,0 +1,33 @@
+package store
+
+// SetAccountTraceSampling overrides the trace sampling percentage for an
+// account; nil removes the override so the global setting applies
+func (s *Store) SetAccountTraceSampling(accountID string, percent *float64) error {
+	if percent == nil {
+		_, err := s.db.Exec(`DELETE FROM account_trace_sampling WHERE account_id = ?`, accountID)
+		return err
+	}
+	_, err := s.db.Exec(`INSERT INTO account_trace_sampling (account_id, sample_percent) VALUES (?, ?)
+		ON CONFLICT(account_id) DO UPDATE SET sample_percent = excluded.sample_percent`, accountID, *percent)
+	return err
+}
+
+// ListAccountTraceSampling returns all per-account trace sampling overrides
+func (s *Store) ListAccountTraceSampling() (map[string]float64, error) {
+	rows, err := s.db.Query(`SELECT account_id, sample_percent FROM account_trace_sampling`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	overrides := make(map[string]float64)
+	for rows.Next() {
+		var id string
+		var percent float64
+		if err := rows.Scan(&id, &percent); err != nil {
+			return nil, err
+		}
+		overrides[id] = percent
+	}
+	return overrides, rows.Err()
+}
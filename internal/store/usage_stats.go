@@ -31,13 +31,19 @@ type AggregatedStats struct {
 	AvgDurationMs         int     `json:"avg_duration_ms"`
 	AvgTTFTMs             int     `json:"avg_ttft_ms"`
 	SuccessRate           float64 `json:"success_rate"`
+	// Percentiles from the daily latency histograms; nil without samples
+	DurationPercentiles *LatencyPercentiles `json:"duration_percentiles,omitempty"`
+	TTFTPercentiles     *LatencyPercentiles `json:"ttft_percentiles,omitempty"`
+	// LatencyByModel holds duration percentiles per model, token and account stats only
+	LatencyByModel map[string]*LatencyPercentiles `json:"latency_by_model,omitempty"`
 }
 
 type DailyStats struct {
-	Date         string `json:"date"`
-	RequestCount int    `json:"request_count"`
-	SuccessCount int    `json:"success_count"`
-	TotalTokens  int    `json:"total_tokens"`
+	Date         string   `json:"date"`
+	RequestCount int      `json:"request_count"`
+	SuccessCount int      `json:"success_count"`
+	TotalTokens  int      `json:"total_tokens"`
+	HealthScore  *float64 `json:"health_score,omitempty"` // Daily average, account trends only
 }
 
 type GlobalStats struct {
@@ -58,12 +64,12 @@ func (s *Store) GetTokenStats(tokenID string, from, to time.Time) (*AggregatedSt
 		COALESCE(SUM(total_prompt_tokens), 0) as total_prompt_tokens,
 		COALESCE(SUM(total_completion_tokens), 0) as total_completion_tokens,
 		COALESCE(SUM(total_tokens), 0) as total_tokens,
-		COALESCE(AVG(avg_duration_ms), 0) as avg_duration_ms,
-		COALESCE(AVG(avg_ttft_ms), 0) as avg_ttft_ms
+		COALESCE(CAST(AVG(avg_duration_ms) AS INTEGER), 0) as avg_duration_ms,
+		COALESCE(CAST(AVG(avg_ttft_ms) AS INTEGER), 0) as avg_ttft_ms
 		FROM usage_stats_daily
 		WHERE token_id = ? AND stat_date >= ? AND stat_date <= ?`
 
-	row := s.db.QueryRow(query, tokenID, from.Format("2006-01-02"), to.Format("2006-01-02"))
+	row := s.read.QueryRow(query, tokenID, from.Format("2006-01-02"), to.Format("2006-01-02"))
 
 	var stats AggregatedStats
 	err := row.Scan(
@@ -80,6 +86,11 @@ func (s *Store) GetTokenStats(tokenID string, from, to time.Time) (*AggregatedSt
 		stats.SuccessRate = float64(stats.SuccessCount) / float64(stats.RequestCount) * 100
 	}
 
+	if err := s.applyLatency(&stats, "token_id = ? AND stat_date >= ? AND stat_date <= ?",
+		tokenID, from.Format("2006-01-02"), to.Format("2006-01-02")); err != nil {
+		return nil, err
+	}
+
 	return &stats, nil
 }
 
@@ -95,7 +106,7 @@ func (s *Store) GetTokenTrend(tokenID string, days int) ([]*DailyStats, error) {
 		GROUP BY stat_date
 		ORDER BY stat_date ASC`
 
-	rows, err := s.db.Query(query, tokenID, days)
+	rows, err := s.read.Query(query, tokenID, days)
 	if err != nil {
 		return nil, err
 	}
@@ -123,12 +134,12 @@ func (s *Store) GetAccountStats(accountID string, from, to time.Time) (*Aggregat
 		COALESCE(SUM(total_prompt_tokens), 0) as total_prompt_tokens,
 		COALESCE(SUM(total_completion_tokens), 0) as total_completion_tokens,
 		COALESCE(SUM(total_tokens), 0) as total_tokens,
-		COALESCE(AVG(avg_duration_ms), 0) as avg_duration_ms,
-		COALESCE(AVG(avg_ttft_ms), 0) as avg_ttft_ms
+		COALESCE(CAST(AVG(avg_duration_ms) AS INTEGER), 0) as avg_duration_ms,
+		COALESCE(CAST(AVG(avg_ttft_ms) AS INTEGER), 0) as avg_ttft_ms
 		FROM usage_stats_daily
 		WHERE account_id = ? AND stat_date >= ? AND stat_date <= ?`
 
-	row := s.db.QueryRow(query, accountID, from.Format("2006-01-02"), to.Format("2006-01-02"))
+	row := s.read.QueryRow(query, accountID, from.Format("2006-01-02"), to.Format("2006-01-02"))
 
 	var stats AggregatedStats
 	err := row.Scan(
@@ -144,6 +155,11 @@ func (s *Store) GetAccountStats(accountID string, from, to time.Time) (*Aggregat
 		stats.SuccessRate = float64(stats.SuccessCount) / float64(stats.RequestCount) * 100
 	}
 
+	if err := s.applyLatency(&stats, "account_id = ? AND stat_date >= ? AND stat_date <= ?",
+		accountID, from.Format("2006-01-02"), to.Format("2006-01-02")); err != nil {
+		return nil, err
+	}
+
 	return &stats, nil
 }
 
@@ -159,7 +175,7 @@ func (s *Store) GetAccountTrend(accountID string, days int) ([]*DailyStats, erro
 		GROUP BY stat_date
 		ORDER BY stat_date ASC`
 
-	rows, err := s.db.Query(query, accountID, days)
+	rows, err := s.read.Query(query, accountID, days)
 	if err != nil {
 		return nil, err
 	}
@@ -174,8 +190,23 @@ func (s *Store) GetAccountTrend(accountID string, days int) ([]*DailyStats, erro
 		}
 		trends = append(trends, &trend)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 
-	return trends, rows.Err()
+	// Attach daily average health scores
+	scores, err := s.getDailyHealthScores(accountID, days)
+	if err != nil {
+		return nil, err
+	}
+	for _, trend := range trends {
+		if score, ok := scores[trend.Date]; ok {
+			score := score
+			trend.HealthScore = &score
+		}
+	}
+
+	return trends, nil
 }
 
 // GetGlobalOverview retrieves global statistics
@@ -193,7 +224,7 @@ func (s *Store) GetGlobalOverview(from, to time.Time) (*GlobalStats, error) {
 		FROM usage_stats_daily
 		WHERE stat_date >= ? AND stat_date <= ?`
 
-	err := s.db.QueryRow(query, from.Format("2006-01-02"), to.Format("2006-01-02")).Scan(
+	err := s.read.QueryRow(query, from.Format("2006-01-02"), to.Format("2006-01-02")).Scan(
 		&stats.TotalTokens, &stats.TotalRequests, &stats.TotalUsers,
 	)
 	if err != nil {
@@ -202,7 +233,7 @@ func (s *Store) GetGlobalOverview(from, to time.Time) (*GlobalStats, error) {
 
 	// Get active tokens count
 	activeQuery := `SELECT COUNT(*) FROM tokens WHERE revoked_at IS NULL AND expires_at > datetime('now')`
-	err = s.db.QueryRow(activeQuery).Scan(&stats.ActiveTokens)
+	err = s.read.QueryRow(activeQuery).Scan(&stats.ActiveTokens)
 	if err != nil {
 		return nil, err
 	}
@@ -216,13 +247,13 @@ func (s *Store) GetGlobalOverview(from, to time.Time) (*GlobalStats, error) {
 		SUM(total_prompt_tokens) as total_prompt_tokens,
 		SUM(total_completion_tokens) as total_completion_tokens,
 		SUM(total_tokens) as total_tokens,
-		AVG(avg_duration_ms) as avg_duration_ms,
-		AVG(avg_ttft_ms) as avg_ttft_ms
+		COALESCE(CAST(AVG(avg_duration_ms) AS INTEGER), 0) as avg_duration_ms,
+		COALESCE(CAST(AVG(avg_ttft_ms) AS INTEGER), 0) as avg_ttft_ms
 		FROM usage_stats_daily
 		WHERE stat_date >= ? AND stat_date <= ?
 		GROUP BY mode`
 
-	rows, err := s.db.Query(modeQuery, from.Format("2006-01-02"), to.Format("2006-01-02"))
+	rows, err := s.read.Query(modeQuery, from.Format("2006-01-02"), to.Format("2006-01-02"))
 	if err != nil {
 		return nil, err
 	}
@@ -252,13 +283,13 @@ func (s *Store) GetGlobalOverview(from, to time.Time) (*GlobalStats, error) {
 		SUM(total_prompt_tokens) as total_prompt_tokens,
 		SUM(total_completion_tokens) as total_completion_tokens,
 		SUM(total_tokens) as total_tokens,
-		AVG(avg_duration_ms) as avg_duration_ms,
-		AVG(avg_ttft_ms) as avg_ttft_ms
+		COALESCE(CAST(AVG(avg_duration_ms) AS INTEGER), 0) as avg_duration_ms,
+		COALESCE(CAST(AVG(avg_ttft_ms) AS INTEGER), 0) as avg_ttft_ms
 		FROM usage_stats_daily
 		WHERE stat_date >= ? AND stat_date <= ?
 		GROUP BY model`
 
-	rows2, err := s.db.Query(modelQuery, from.Format("2006-01-02"), to.Format("2006-01-02"))
+	rows2, err := s.read.Query(modelQuery, from.Format("2006-01-02"), to.Format("2006-01-02"))
 	if err != nil {
 		return nil, err
 	}
@@ -279,5 +310,36 @@ func (s *Store) GetGlobalOverview(from, to time.Time) (*GlobalStats, error) {
 		stats.ByModel[model] = &modelStats
 	}
 
+	// Latency percentiles per mode and model
+	for groupBy, byGroup := range map[string]map[string]*AggregatedStats{"mode": stats.ByMode, "model": stats.ByModel} {
+		groups, err := s.queryLatency(groupBy, "stat_date >= ? AND stat_date <= ?",
+			from.Format("2006-01-02"), to.Format("2006-01-02"))
+		if err != nil {
+			return nil, err
+		}
+		for key, g := range groups {
+			g.apply(byGroup[key])
+		}
+	}
+
 	return stats, nil
 }
+
+// applyLatency sets the latency percentiles of stats, overall and per model,
+// from the daily rows matching where
+func (s *Store) applyLatency(stats *AggregatedStats, where string, args ...interface{}) error {
+	groups, err := s.queryLatency("model", where, args...)
+	if err != nil {
+		return err
+	}
+	total := &latencyStats{duration: newLatencyHistogram(), ttft: newLatencyHistogram()}
+	for _, g := range groups {
+		total.duration.add(g.duration)
+		total.ttft.add(g.ttft)
+	}
+	total.apply(stats)
+	if byModel := latencyByModel(groups); len(byModel) > 0 {
+		stats.LatencyByModel = byModel
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package store
+
+import "time"
+
+// WebConversation is a claude.ai conversation the proxy created for a web mode
+// request, kept until it is deleted upstream
+type WebConversation struct {
+	ID             string    `json:"id"` // Conversation UUID on claude.ai
+	AccountID      string    `json:"account_id"`
+	OrganizationID string    `json:"organization_id"`
+	CreatedAt      time.Time `json:"created_at"`
+	Attempts       int       `json:"attempts"` // Failed deletions so far
+	LastError      string    `json:"last_error,omitempty"`
+}
+
+// RecordWebConversation tracks a conversation created upstream so it can be
+// deleted later
+func (s *Store) RecordWebConversation(conv *WebConversation) error {
+	_, err := s.db.Exec(`INSERT OR IGNORE INTO web_conversations (id, account_id, organization_id, created_at)
+		VALUES (?, ?, ?, ?)`,
+		conv.ID, conv.AccountID, conv.OrganizationID, conv.CreatedAt.UTC())
+	return err
+}
+
+// DueWebConversations returns up to limit tracked conversations created before
+// the given time, oldest first
+func (s *Store) DueWebConversations(before time.Time, limit int) ([]*WebConversation, error) {
+	rows, err := s.db.Query(`SELECT id, account_id, organization_id, created_at, attempts, COALESCE(last_error, '')
+		FROM web_conversations WHERE created_at <= ? ORDER BY created_at LIMIT ?`, before.UTC(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var convs []*WebConversation
+	for rows.Next() {
+		var c WebConversation
+		if err := rows.Scan(&c.ID, &c.AccountID, &c.OrganizationID, &c.CreatedAt, &c.Attempts, &c.LastError); err != nil {
+			return nil, err
+		}
+		convs = append(convs, &c)
+	}
+	return convs, rows.Err()
+}
+
+// MarkWebConversationFailed records a failed deletion of a conversation
+func (s *Store) MarkWebConversationFailed(id, lastError string) error {
+	_, err := s.db.Exec(`UPDATE web_conversations SET attempts = attempts + 1, last_error = ? WHERE id = ?`,
+		lastError, id)
+	return err
+}
+
+// DeleteWebConversation stops tracking a conversation
+func (s *Store) DeleteWebConversation(id string) error {
+	_, err := s.db.Exec(`DELETE FROM web_conversations WHERE id = ?`, id)
+	return err
+}
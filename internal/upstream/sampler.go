@@ -0,0 +1,255 @@
+// Package upstream keeps recent upstream exchanges per account for debugging
+package upstream
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Config sizes the per-account ring buffers
+type Config struct {
+	PerAccount   int // Exchanges kept per account
+	MaxBodyBytes int // Bytes of each request and response body kept
+}
+
+// Redacted replaces secrets in sampled headers and bodies
+const Redacted = "[REDACTED]"
+
+// Exchange is one sampled upstream request and its response
+type Exchange struct {
+	Time                  time.Time   `json:"time"`
+	Method                string      `json:"method"`
+	URL                   string      `json:"url"`
+	RequestHeaders        http.Header `json:"request_headers"`
+	RequestBody           string      `json:"request_body,omitempty"`
+	RequestBodyTruncated  bool        `json:"request_body_truncated,omitempty"`
+	Status                int         `json:"status,omitempty"`
+	ResponseHeaders       http.Header `json:"response_headers,omitempty"`
+	ResponseBody          string      `json:"response_body,omitempty"`
+	ResponseBodyTruncated bool        `json:"response_body_truncated,omitempty"`
+	// ResponseBodyOmitted says why the response body was not kept, e.g. it was compressed
+	ResponseBodyOmitted string `json:"response_body_omitted,omitempty"`
+	// HeadersMs is the time until the response headers arrived
+	HeadersMs int64 `json:"headers_ms"`
+	// DurationMs is the time until the response body was closed
+	DurationMs int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+}
+
+// ring holds the latest exchanges of one account
+type ring struct {
+	exchanges []Exchange
+	next      int
+	full      bool
+}
+
+// Sampler records the upstream exchanges of each account in a ring buffer.
+// Secrets in headers and JSON bodies are redacted before they are kept. A
+// nil Sampler records nothing.
+type Sampler struct {
+	cfg Config
+
+	mu    sync.Mutex
+	rings map[string]*ring
+}
+
+// NewSampler creates a sampler keeping cfg.PerAccount exchanges per account
+func NewSampler(cfg Config) *Sampler {
+	if cfg.PerAccount <= 0 {
+		cfg.PerAccount = 20
+	}
+	if cfg.MaxBodyBytes < 0 {
+		cfg.MaxBodyBytes = 0
+	}
+	return &Sampler{cfg: cfg, rings: make(map[string]*ring)}
+}
+
+// Transport wraps base so the exchanges it carries are recorded for
+// accountID. A nil base uses http.DefaultTransport; a nil Sampler returns
+// base unchanged.
+func (s *Sampler) Transport(accountID string, base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if s == nil || accountID == "" {
+		return base
+	}
+	return &transport{sampler: s, accountID: accountID, base: base}
+}
+
+// Exchanges returns the exchanges kept for accountID, newest first
+func (s *Sampler) Exchanges(accountID string) []Exchange {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.rings[accountID]
+	if !ok {
+		return []Exchange{}
+	}
+	n := r.next
+	if r.full {
+		n = len(r.exchanges)
+	}
+	exchanges := make([]Exchange, 0, n)
+	for i := 1; i <= n; i++ {
+		exchanges = append(exchanges, r.exchanges[(r.next-i+len(r.exchanges))%len(r.exchanges)])
+	}
+	return exchanges
+}
+
+func (s *Sampler) add(accountID string, exchange Exchange) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.rings[accountID]
+	if !ok {
+		r = &ring{exchanges: make([]Exchange, s.cfg.PerAccount)}
+		s.rings[accountID] = r
+	}
+	r.exchanges[r.next] = exchange
+	r.next++
+	if r.next == len(r.exchanges) {
+		r.next = 0
+		r.full = true
+	}
+}
+
+// transport records the exchanges of one account
+type transport struct {
+	sampler   *Sampler
+	accountID string
+	base      http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	exchange := Exchange{
+		Time:           start,
+		Method:         req.Method,
+		URL:            redactURL(req.URL.String()),
+		RequestHeaders: redactHeaders(req.Header),
+	}
+	// Read a copy of the body; the original is left for the base transport
+	if req.GetBody != nil && req.Body != nil && req.Body != http.NoBody {
+		if body, err := req.GetBody(); err == nil {
+			exchange.RequestBody, exchange.RequestBodyTruncated = t.readBody(body)
+			body.Close()
+		}
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	exchange.HeadersMs = time.Since(start).Milliseconds()
+	if err != nil {
+		exchange.Error = err.Error()
+		exchange.DurationMs = exchange.HeadersMs
+		t.sampler.add(t.accountID, exchange)
+		return nil, err
+	}
+
+	exchange.Status = resp.StatusCode
+	exchange.ResponseHeaders = redactHeaders(resp.Header)
+	if encoding := resp.Header.Get("Content-Encoding"); encoding != "" && encoding != "identity" {
+		exchange.ResponseBodyOmitted = encoding + " encoded"
+	}
+	resp.Body = &sampledBody{ReadCloser: resp.Body, transport: t, exchange: exchange, start: start}
+	return resp, nil
+}
+
+// readBody reads up to MaxBodyBytes of body and redacts it
+func (t *transport) readBody(body io.Reader) (string, bool) {
+	limit := t.sampler.cfg.MaxBodyBytes
+	data, _ := io.ReadAll(io.LimitReader(body, int64(limit)+1))
+	truncated := len(data) > limit
+	if truncated {
+		data = data[:limit]
+	}
+	return redactBody(data), truncated
+}
+
+// sampledBody keeps the start of a response body and records the exchange
+// when the body is closed
+type sampledBody struct {
+	io.ReadCloser
+	transport *transport
+	exchange  Exchange
+	start     time.Time
+	buf       bytes.Buffer
+	truncated bool
+	done      sync.Once
+}
+
+func (b *sampledBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if b.exchange.ResponseBodyOmitted == "" && n > 0 {
+		room := b.transport.sampler.cfg.MaxBodyBytes - b.buf.Len()
+		if room >= n {
+			b.buf.Write(p[:n])
+		} else {
+			if room > 0 {
+				b.buf.Write(p[:room])
+			}
+			b.truncated = true
+		}
+	}
+	return n, err
+}
+
+func (b *sampledBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.done.Do(func() {
+		b.exchange.DurationMs = time.Since(b.start).Milliseconds()
+		b.exchange.ResponseBody = redactBody(b.buf.Bytes())
+		b.exchange.ResponseBodyTruncated = b.truncated
+		b.transport.sampler.add(b.transport.accountID, b.exchange)
+	})
+	return err
+}
+
+// sensitiveHeaders carry credentials; headers whose name mentions a key,
+// token, secret or session are redacted too
+var sensitiveHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+	"Set-Cookie":          true,
+}
+
+func redactHeaders(header http.Header) http.Header {
+	redacted := make(http.Header, len(header))
+	for name, values := range header {
+		lower := strings.ToLower(name)
+		if sensitiveHeaders[http.CanonicalHeaderKey(name)] ||
+			strings.Contains(lower, "key") || strings.Contains(lower, "token") ||
+			strings.Contains(lower, "secret") || strings.Contains(lower, "session") {
+			redacted[name] = []string{Redacted}
+			continue
+		}
+		redacted[name] = append([]string(nil), values...)
+	}
+	return redacted
+}
+
+// sensitiveField matches JSON string fields holding credentials
+var sensitiveField = regexp.MustCompile(`("(?i:[a-z_]*(?:token|secret|password|api_key|apikey|session_key|sessionkey))"\s*:\s*)"(?:[^"\\]|\\.)*"`)
+
+// sensitiveValue matches credentials wherever they appear in a body
+var sensitiveValue = regexp.MustCompile(`sk-ant-[A-Za-z0-9_-]+`)
+
+func redactBody(body []byte) string {
+	body = sensitiveField.ReplaceAll(body, []byte(`$1"`+Redacted+`"`))
+	body = sensitiveValue.ReplaceAll(body, []byte(Redacted))
+	return string(body)
+}
+
+// sensitiveQuery matches query parameters holding credentials
+var sensitiveQuery = regexp.MustCompile(`((?i:key|token|secret|session)[a-z_]*=)[^&]*`)
+
+func redactURL(u string) string {
+	if i := strings.IndexByte(u, '?'); i >= 0 {
+		return u[:i] + sensitiveQuery.ReplaceAllString(u[i:], "${1}"+Redacted)
+	}
+	return u
+}
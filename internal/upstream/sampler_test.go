@@ -0,0 +1,175 @@
+package upstream
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSampler_RingKeepsNewest(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.URL.Path)
+	}))
+	defer srv.Close()
+
+	s := NewSampler(Config{PerAccount: 3, MaxBodyBytes: 1024})
+	client := &http.Client{Transport: s.Transport("acc-1", nil)}
+	for i := 0; i < 5; i++ {
+		resp, err := client.Get(fmt.Sprintf("%s/%d", srv.URL, i))
+		if err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+		io.ReadAll(resp.Body)
+		resp.Body.Close()
+	}
+
+	exchanges := s.Exchanges("acc-1")
+	if len(exchanges) != 3 {
+		t.Fatalf("kept %d exchanges, want 3", len(exchanges))
+	}
+	for i, want := range []string{"/4", "/3", "/2"} {
+		if got := exchanges[i].ResponseBody; got != want {
+			t.Errorf("exchange %d body = %q, want %q", i, got, want)
+		}
+		if exchanges[i].Status != http.StatusOK {
+			t.Errorf("exchange %d status = %d", i, exchanges[i].Status)
+		}
+	}
+	if got := s.Exchanges("acc-2"); len(got) != 0 {
+		t.Errorf("other account has %d exchanges", len(got))
+	}
+}
+
+func TestSampler_Redaction(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "sessionKey", Value: "sk-ant-sid01-abc"})
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"access_token": "at-123", "refresh_token":"rt-456", "expires_in": 3600}`)
+	}))
+	defer srv.Close()
+
+	s := NewSampler(Config{PerAccount: 1, MaxBodyBytes: 1024})
+	client := &http.Client{Transport: s.Transport("acc-1", nil)}
+	req, _ := http.NewRequest(http.MethodPost, srv.URL+"/token?api_key=k1&model=x",
+		strings.NewReader(`{"session_key":"sk-ant-sid01-abc","prompt":"uses sk-ant-api03-xyz"}`))
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("X-Api-Key", "key")
+	req.Header.Set("Anthropic-Beta", "oauth-2025-04-20")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	e := s.Exchanges("acc-1")[0]
+	for _, name := range []string{"Authorization", "X-Api-Key"} {
+		if got := e.RequestHeaders.Get(name); got != Redacted {
+			t.Errorf("request header %s = %q", name, got)
+		}
+	}
+	if got := e.RequestHeaders.Get("Anthropic-Beta"); got != "oauth-2025-04-20" {
+		t.Errorf("Anthropic-Beta = %q, want it kept", got)
+	}
+	if got := e.ResponseHeaders.Get("Set-Cookie"); got != Redacted {
+		t.Errorf("Set-Cookie = %q", got)
+	}
+	if strings.Contains(e.URL, "k1") || !strings.Contains(e.URL, "model=x") {
+		t.Errorf("URL = %q", e.URL)
+	}
+	if want := `{"session_key":"[REDACTED]","prompt":"uses [REDACTED]"}`; e.RequestBody != want {
+		t.Errorf("request body = %s, want %s", e.RequestBody, want)
+	}
+	if want := `{"access_token": "[REDACTED]", "refresh_token":"[REDACTED]", "expires_in": 3600}`; e.ResponseBody != want {
+		t.Errorf("response body = %s, want %s", e.ResponseBody, want)
+	}
+}
+
+func TestSampler_TruncatesAndPassesBodiesThrough(t *testing.T) {
+	long := strings.Repeat("a", 100)
+	var received string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received = string(body)
+		fmt.Fprint(w, long)
+	}))
+	defer srv.Close()
+
+	s := NewSampler(Config{PerAccount: 1, MaxBodyBytes: 10})
+	client := &http.Client{Transport: s.Transport("acc-1", nil)}
+	resp, err := client.Post(srv.URL, "text/plain", strings.NewReader(long))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if string(body) != long || received != long {
+		t.Fatalf("bodies were not passed through whole: sent %d, received %d bytes", len(received), len(body))
+	}
+	e := s.Exchanges("acc-1")[0]
+	if e.RequestBody != long[:10] || !e.RequestBodyTruncated {
+		t.Errorf("request body = %q truncated=%v", e.RequestBody, e.RequestBodyTruncated)
+	}
+	if e.ResponseBody != long[:10] || !e.ResponseBodyTruncated {
+		t.Errorf("response body = %q truncated=%v", e.ResponseBody, e.ResponseBodyTruncated)
+	}
+}
+
+func TestSampler_RecordsOnClose(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "event: ping\n\n")
+	}))
+	defer srv.Close()
+
+	s := NewSampler(Config{PerAccount: 5, MaxBodyBytes: 1024})
+	client := &http.Client{Transport: s.Transport("acc-1", nil)}
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Exchanges("acc-1"); len(got) != 0 {
+		t.Fatalf("exchange recorded before the body was closed")
+	}
+	io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body.Close()
+
+	exchanges := s.Exchanges("acc-1")
+	if len(exchanges) != 1 {
+		t.Fatalf("recorded %d exchanges, want 1", len(exchanges))
+	}
+	if exchanges[0].ResponseBody != "event: ping\n\n" {
+		t.Errorf("response body = %q", exchanges[0].ResponseBody)
+	}
+}
+
+type failingTransport struct{}
+
+func (failingTransport) RoundTrip(*http.Request) (*http.Response, error) {
+	return nil, errors.New("connection refused")
+}
+
+func TestSampler_RecordsTransportErrors(t *testing.T) {
+	s := NewSampler(Config{PerAccount: 5, MaxBodyBytes: 1024})
+	client := &http.Client{Transport: s.Transport("acc-1", failingTransport{})}
+	if _, err := client.Get("http://upstream.invalid/"); err == nil {
+		t.Fatal("expected an error")
+	}
+	exchanges := s.Exchanges("acc-1")
+	if len(exchanges) != 1 || !strings.Contains(exchanges[0].Error, "connection refused") {
+		t.Fatalf("exchanges = %+v", exchanges)
+	}
+}
+
+func TestSampler_NilIsPassthrough(t *testing.T) {
+	var s *Sampler
+	if got := s.Transport("acc-1", failingTransport{}); got != (failingTransport{}) {
+		t.Errorf("nil sampler wrapped the transport: %T", got)
+	}
+}
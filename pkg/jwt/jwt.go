@@ -1,7 +1,11 @@
 package jwt
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -11,6 +15,9 @@ import (
 var (
 	ErrInvalidToken = errors.New("invalid token")
 	ErrExpiredToken = errors.New("token has expired")
+	ErrKeyExists    = errors.New("signing key already exists")
+	ErrKeyNotFound  = errors.New("signing key not found")
+	ErrKeyActive    = errors.New("cannot retire the active signing key")
 )
 
 type Claims struct {
@@ -27,23 +34,176 @@ type TokenInfo struct {
 	ExpiresAt time.Time `json:"expires_at"`
 }
 
+// Manager issues and validates HS256 tokens. Tokens are signed with the
+// active key and carry its id in the kid header; every key the manager holds
+// is accepted for verification, so the signing key can be rotated without
+// invalidating tokens signed with the previous one.
 type Manager struct {
-	secret []byte
-	issuer string
+	mu         sync.RWMutex
+	keys       map[string]*key
+	signingKID string
+	issuer     string
+}
+
+type key struct {
+	secret     []byte
+	configured bool
+	addedAt    time.Time
+}
+
+// KeyInfo describes a key without its secret
+type KeyInfo struct {
+	ID         string    `json:"id"`
+	Active     bool      `json:"active"`     // Signs new tokens
+	Configured bool      `json:"configured"` // From the config file rather than the admin API
+	AddedAt    time.Time `json:"added_at"`
 }
 
 func NewManager(secret string, issuer string) *Manager {
-	return &Manager{
-		secret: []byte(secret),
+	m := &Manager{
+		keys:   make(map[string]*key),
 		issuer: issuer,
 	}
+	m.signingKID = m.AddSecret(secret)
+	return m
+}
+
+// ConfiguredKeyID derives the key id of a configured secret, so it is stable
+// across restarts without being stored
+func ConfiguredKeyID(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return "cfg-" + hex.EncodeToString(sum[:4])
+}
+
+// AddSecret adds a configured secret accepted for verification and returns
+// its key id
+func (m *Manager) AddSecret(secret string) string {
+	kid := ConfiguredKeyID(secret)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.keys[kid]; !ok {
+		m.keys[kid] = &key{secret: []byte(secret), configured: true, addedAt: time.Now()}
+	}
+	return kid
+}
+
+// RotateSecret replaces the configured signing secret. The previous secret
+// stays accepted; if a key added with AddKey is active, it keeps signing.
+func (m *Manager) RotateSecret(previous, secret string) {
+	kid := m.AddSecret(secret)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.signingKID == ConfiguredKeyID(previous) {
+		m.signingKID = kid
+	}
+}
+
+// AddKey adds a key accepted for verification under id
+func (m *Manager) AddKey(id, secret string, addedAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.keys[id]; ok {
+		return ErrKeyExists
+	}
+	m.keys[id] = &key{secret: []byte(secret), addedAt: addedAt}
+	return nil
+}
+
+// Activate makes key id sign new tokens
+func (m *Manager) Activate(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.keys[id]; !ok {
+		return ErrKeyNotFound
+	}
+	m.signingKID = id
+	return nil
+}
+
+// Retire removes key id; tokens signed with it no longer validate
+func (m *Manager) Retire(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.keys[id]; !ok {
+		return ErrKeyNotFound
+	}
+	if id == m.signingKID {
+		return ErrKeyActive
+	}
+	delete(m.keys, id)
+	return nil
+}
+
+// Key describes key id
+func (m *Manager) Key(id string) (KeyInfo, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	k, ok := m.keys[id]
+	if !ok {
+		return KeyInfo{}, false
+	}
+	return KeyInfo{ID: id, Active: id == m.signingKID, Configured: k.configured, AddedAt: k.addedAt}, true
+}
+
+// Keys lists all keys, oldest first
+func (m *Manager) Keys() []KeyInfo {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	keys := make([]KeyInfo, 0, len(m.keys))
+	for id, k := range m.keys {
+		keys = append(keys, KeyInfo{ID: id, Active: id == m.signingKID, Configured: k.configured, AddedAt: k.addedAt})
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if !keys[i].AddedAt.Equal(keys[j].AddedAt) {
+			return keys[i].AddedAt.Before(keys[j].AddedAt)
+		}
+		return keys[i].ID < keys[j].ID
+	})
+	return keys
+}
+
+// sign signs claims with the active key
+func (m *Manager) sign(claims jwt.Claims) (string, error) {
+	m.mu.RLock()
+	kid, secret := m.signingKID, m.keys[m.signingKID].secret
+	m.mu.RUnlock()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = kid
+	return token.SignedString(secret)
+}
+
+// keyFunc selects the verification key by kid. Tokens issued before key ids
+// were added have no kid and are checked against every key.
+func (m *Manager) keyFunc(token *jwt.Token) (interface{}, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		return nil, ErrInvalidToken
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if kid, ok := token.Header["kid"].(string); ok {
+		k, found := m.keys[kid]
+		if !found {
+			return nil, ErrInvalidToken
+		}
+		return k.secret, nil
+	}
+	set := jwt.VerificationKeySet{Keys: make([]jwt.VerificationKey, 0, len(m.keys))}
+	for _, k := range m.keys {
+		set.Keys = append(set.Keys, k.secret)
+	}
+	return set, nil
 }
 
 func (m *Manager) Generate(userName string, mode string, expiry time.Duration) (string, *TokenInfo, error) {
-	tokenID := uuid.New().String()
 	now := time.Now()
-	expiresAt := now.Add(expiry)
+	return m.GenerateWithID(uuid.New().String(), userName, mode, now, now.Add(expiry))
+}
 
+// GenerateWithID signs a token with a fixed id and lifetime. The same inputs
+// and signing key give the same token, so a token can be reissued unchanged.
+func (m *Manager) GenerateWithID(tokenID, userName, mode string, issuedAt, expiresAt time.Time) (string, *TokenInfo, error) {
 	claims := Claims{
 		UserName: userName,
 		Mode:     mode,
@@ -51,13 +211,12 @@ func (m *Manager) Generate(userName string, mode string, expiry time.Duration) (
 			ID:        tokenID,
 			Subject:   userName,
 			Issuer:    m.issuer,
-			IssuedAt:  jwt.NewNumericDate(now),
+			IssuedAt:  jwt.NewNumericDate(issuedAt),
 			ExpiresAt: jwt.NewNumericDate(expiresAt),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(m.secret)
+	tokenString, err := m.sign(claims)
 	if err != nil {
 		return "", nil, err
 	}
@@ -66,7 +225,7 @@ func (m *Manager) Generate(userName string, mode string, expiry time.Duration) (
 		ID:        tokenID,
 		UserName:  userName,
 		Mode:      mode,
-		IssuedAt:  now,
+		IssuedAt:  issuedAt,
 		ExpiresAt: expiresAt,
 	}
 
@@ -74,12 +233,7 @@ func (m *Manager) Generate(userName string, mode string, expiry time.Duration) (
 }
 
 func (m *Manager) Validate(tokenString string) (*Claims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, ErrInvalidToken
-		}
-		return m.secret, nil
-	})
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, m.keyFunc)
 
 	if err != nil {
 		if errors.Is(err, jwt.ErrTokenExpired) {
@@ -102,3 +256,57 @@ func (m *Manager) GetTokenID(tokenString string) (string, error) {
 	}
 	return claims.ID, nil
 }
+
+// AdminSessionAudience marks tokens issued for the admin API. API tokens have
+// no audience, so they are never accepted as admin sessions.
+const AdminSessionAudience = "ccproxy-admin"
+
+// AdminSessionClaims identify an administrator signed in through SSO
+type AdminSessionClaims struct {
+	Name  string `json:"name,omitempty"`
+	Email string `json:"email,omitempty"`
+	Role  string `json:"role"`
+	jwt.RegisteredClaims
+}
+
+// GenerateAdminSession issues an admin session token for subject with the given role
+func (m *Manager) GenerateAdminSession(subject, name, email, role string, expiry time.Duration) (string, *AdminSessionClaims, error) {
+	now := time.Now()
+	claims := &AdminSessionClaims{
+		Name:  name,
+		Email: email,
+		Role:  role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.New().String(),
+			Subject:   subject,
+			Issuer:    m.issuer,
+			Audience:  jwt.ClaimStrings{AdminSessionAudience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(expiry)),
+		},
+	}
+
+	tokenString, err := m.sign(claims)
+	if err != nil {
+		return "", nil, err
+	}
+	return tokenString, claims, nil
+}
+
+// ValidateAdminSession validates an admin session token
+func (m *Manager) ValidateAdminSession(tokenString string) (*AdminSessionClaims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &AdminSessionClaims{}, m.keyFunc, jwt.WithAudience(AdminSessionAudience), jwt.WithIssuer(m.issuer))
+
+	if err != nil {
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			return nil, ErrExpiredToken
+		}
+		return nil, ErrInvalidToken
+	}
+
+	if claims, ok := token.Claims.(*AdminSessionClaims); ok && token.Valid && claims.Role != "" {
+		return claims, nil
+	}
+
+	return nil, ErrInvalidToken
+}
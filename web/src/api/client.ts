@@ -24,7 +24,7 @@ import type {
   UpdateTokenSettingsRequest,
 } from './types';
 
-const API_BASE = '/api';
+const API_BASE = '/api/v1';
 
 class ApiClient {
   private adminKey: string | null = null;
@@ -20,6 +20,24 @@ export interface OAuthLoginRequest {
   name: string;
 }
 
+export interface Job<Result = unknown> {
+  id: string;
+  type: string;
+  status: 'pending' | 'running' | 'succeeded' | 'failed' | 'canceled';
+  progress: number;
+  steps: { name: string; status: string; attempts: number; error?: string }[];
+  attempts: number;
+  max_attempts: number;
+  result?: Result;
+  error?: string;
+}
+
+export interface OnboardingResult {
+  account_id: string;
+  organization_id: string;
+  expires_at: string;
+}
+
 export interface SessionKeyAccountRequest {
   name: string;
   session_key: string;
@@ -36,7 +54,7 @@ export function useAccounts() {
     queryKey: ['accounts'],
     queryFn: async () => {
       const adminKey = localStorage.getItem('adminKey');
-      const response = await fetch('/api/account/list', {
+      const response = await fetch('/api/v1/account/list', {
         headers: {
           'X-Admin-Key': adminKey || '',
         },
@@ -54,7 +72,7 @@ export function useOAuthLogin() {
   return useMutation({
     mutationFn: async (req: OAuthLoginRequest) => {
       const adminKey = localStorage.getItem('adminKey');
-      const response = await fetch('/api/account/oauth', {
+      const response = await fetch('/api/v1/account/oauth', {
         method: 'POST',
         headers: {
           'Content-Type': 'application/json',
@@ -66,7 +84,23 @@ export function useOAuthLogin() {
         const error = await response.json();
         throw new Error(error.error || 'OAuth login failed');
       }
-      return response.json();
+      const { status_url } = await response.json();
+
+      // The login runs as a background job; poll it until it finishes
+      for (;;) {
+        await new Promise((resolve) => setTimeout(resolve, 1000));
+        const jobResponse = await fetch(status_url, {
+          headers: {
+            'X-Admin-Key': adminKey || '',
+          },
+        });
+        if (!jobResponse.ok) throw new Error('Failed to fetch OAuth login job');
+        const job = (await jobResponse.json()) as Job<OnboardingResult>;
+        if (job.status === 'succeeded' && job.result) return job.result;
+        if (job.status === 'failed' || job.status === 'canceled') {
+          throw new Error(job.error || 'OAuth login failed');
+        }
+      }
     },
     onSuccess: () => {
       queryClient.invalidateQueries({ queryKey: ['accounts'] });
@@ -80,7 +114,7 @@ export function useCreateSessionKeyAccount() {
   return useMutation({
     mutationFn: async (req: SessionKeyAccountRequest) => {
       const adminKey = localStorage.getItem('adminKey');
-      const response = await fetch('/api/account/sessionkey', {
+      const response = await fetch('/api/v1/account/sessionkey', {
         method: 'POST',
         headers: {
           'Content-Type': 'application/json',
@@ -106,7 +140,7 @@ export function useUpdateAccount() {
   return useMutation({
     mutationFn: async ({ id, data }: { id: string; data: UpdateAccountRequest }) => {
       const adminKey = localStorage.getItem('adminKey');
-      const response = await fetch(`/api/account/${id}`, {
+      const response = await fetch(`/api/v1/account/${id}`, {
         method: 'PUT',
         headers: {
           'Content-Type': 'application/json',
@@ -132,7 +166,7 @@ export function useDeleteAccount() {
   return useMutation({
     mutationFn: async (id: string) => {
       const adminKey = localStorage.getItem('adminKey');
-      const response = await fetch(`/api/account/${id}`, {
+      const response = await fetch(`/api/v1/account/${id}`, {
         method: 'DELETE',
         headers: {
           'X-Admin-Key': adminKey || '',
@@ -156,7 +190,7 @@ export function useDeactivateAccount() {
   return useMutation({
     mutationFn: async (id: string) => {
       const adminKey = localStorage.getItem('adminKey');
-      const response = await fetch(`/api/account/${id}/deactivate`, {
+      const response = await fetch(`/api/v1/account/${id}/deactivate`, {
         method: 'POST',
         headers: {
           'X-Admin-Key': adminKey || '',
@@ -180,7 +214,7 @@ export function useRefreshToken() {
   return useMutation({
     mutationFn: async (id: string) => {
       const adminKey = localStorage.getItem('adminKey');
-      const response = await fetch(`/api/account/${id}/refresh`, {
+      const response = await fetch(`/api/v1/account/${id}/refresh`, {
         method: 'POST',
         headers: {
           'X-Admin-Key': adminKey || '',
@@ -202,7 +236,7 @@ export function useCheckHealth() {
   return useMutation({
     mutationFn: async (id: string) => {
       const adminKey = localStorage.getItem('adminKey');
-      const response = await fetch(`/api/account/${id}/check`, {
+      const response = await fetch(`/api/v1/account/${id}/check`, {
         method: 'POST',
         headers: {
           'X-Admin-Key': adminKey || '',